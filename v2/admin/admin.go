@@ -0,0 +1,476 @@
+// Package admin serves an HTTP API to inspect and control the tasks, queues
+// and workers of a machinery server, e.g. for dashboards and ops tooling.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const (
+	// runningHorizon is added to the current time to read the heartbeats of
+	// every running task, not only the stale ones
+	runningHorizon = 24 * time.Hour
+	// defaultFailuresLimit is the number of failed tasks returned when no
+	// limit is given
+	defaultFailuresLimit = 50
+)
+
+// Queue is the depth of a queue
+type Queue struct {
+	Name    string `json:"name"`
+	Pending int    `json:"pending"`
+}
+
+// Group is the status of a group
+type Group struct {
+	UUID      string             `json:"uuid"`
+	Completed bool               `json:"completed"`
+	States    []*tasks.TaskState `json:"states"`
+}
+
+// Failure is a failed task waiting in a dead letter queue
+type Failure struct {
+	Queue     string           `json:"queue"`
+	Signature *tasks.Signature `json:"signature"`
+	Error     string           `json:"error"`
+	// Attempts is the failure history of the task, empty if the result
+	// backend does not record it
+	Attempts []*tasks.Failure `json:"attempts,omitempty"`
+}
+
+// Handler serves the admin API of a server:
+//
+//	GET    /tasks                          names of the registered tasks
+//	GET    /tasks/{uuid}                   state of a task
+//	POST   /tasks/{uuid}/cancel            cancel a task
+//	GET    /running                        running tasks, recorded by heartbeats
+//	GET    /delayed                        tasks waiting for their ETA
+//	GET    /queues                         depths of the known queues
+//	GET    /queues/{name}                  pending tasks of a queue
+//	POST   /queues/{name}/purge            drop the pending tasks of a queue
+//	POST   /queues/{name}/requeue          requeue the tasks of a dead letter queue
+//	POST   /queues/{name}/move?to={queue}  move the pending tasks to another queue, up to &limit={limit}
+//	GET    /failures?limit={limit}         failed tasks in dead letter queues
+//	GET    /groups/{uuid}?count={count}    status of a group of count tasks
+//	GET    /workers                        registered workers
+//	GET    /schedules                      stored schedules
+//	POST   /schedules                      add a schedule
+//	GET    /schedules/{name}               a stored schedule
+//	PUT    /schedules/{name}               update a schedule
+//	DELETE /schedules/{name}               remove a schedule
+//
+// Responses are JSON, errors are returned as {"error": "..."}. The dashboard
+// is served at / when enabled.
+type Handler struct {
+	server *machinery.Server
+	// Dashboard serves a web dashboard at / showing the queues, the
+	// throughput and the status of the workers, failed tasks and groups
+	Dashboard bool
+}
+
+// NewHandler creates the handler of the admin API of the server, mount it
+// with http.StripPrefix to serve it under a path
+func NewHandler(server *machinery.Server) *Handler {
+	return &Handler{server: server}
+}
+
+// ServeHTTP routes the request to the endpoint of the API
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	route := func(method string, segments ...string) bool {
+		if r.Method != method || len(parts) != len(segments) {
+			return false
+		}
+		for i, segment := range segments {
+			if segment != "*" && segment != parts[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch {
+	case h.Dashboard && route(http.MethodGet, ""):
+		serveDashboard(w)
+	case route(http.MethodGet, "tasks"):
+		names := h.server.GetRegisteredTaskNames()
+		sort.Strings(names)
+		writeJSON(w, http.StatusOK, names)
+	case route(http.MethodGet, "tasks", "*"):
+		h.getTask(w, parts[1])
+	case route(http.MethodPost, "tasks", "*", "cancel"):
+		h.cancelTask(w, parts[1])
+	case route(http.MethodGet, "running"):
+		h.getRunning(w)
+	case route(http.MethodGet, "delayed"):
+		h.getDelayed(w)
+	case route(http.MethodGet, "queues"):
+		h.getQueues(w)
+	case route(http.MethodGet, "queues", "*"):
+		h.getPending(w, parts[1])
+	case route(http.MethodPost, "queues", "*", "purge"):
+		h.purgeQueue(w, parts[1])
+	case route(http.MethodPost, "queues", "*", "requeue"):
+		h.requeueQueue(w, parts[1])
+	case route(http.MethodPost, "queues", "*", "move"):
+		h.moveMessages(w, r, parts[1])
+	case route(http.MethodGet, "failures"):
+		h.getFailures(w, r.URL.Query().Get("limit"))
+	case route(http.MethodGet, "groups", "*"):
+		h.getGroup(w, parts[1], r.URL.Query().Get("count"))
+	case route(http.MethodGet, "workers"):
+		h.getWorkers(w)
+	case route(http.MethodGet, "schedules"):
+		h.getSchedules(w)
+	case route(http.MethodPost, "schedules"):
+		h.addSchedule(w, r)
+	case route(http.MethodGet, "schedules", "*"):
+		h.getSchedule(w, parts[1])
+	case route(http.MethodPut, "schedules", "*"):
+		h.updateSchedule(w, r, parts[1])
+	case route(http.MethodDelete, "schedules", "*"):
+		h.removeSchedule(w, parts[1])
+	default:
+		writeError(w, http.StatusNotFound, errors.New("Not found"))
+	}
+}
+
+func (h *Handler) getTask(w http.ResponseWriter, taskUUID string) {
+	state, err := h.server.GetBackend().GetState(taskUUID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+func (h *Handler) cancelTask(w http.ResponseWriter, taskUUID string) {
+	if err := h.server.CancelTask(taskUUID); err != nil {
+		writeError(w, http.StatusConflict, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) getRunning(w http.ResponseWriter) {
+	signatures, err := backends.StaleHeartbeats(h.server.GetBackend(), time.Now().Add(runningHorizon))
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nonNil(signatures))
+}
+
+func (h *Handler) getDelayed(w http.ResponseWriter) {
+	signatures, err := h.server.GetBroker().GetDelayedTasks()
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nonNil(signatures))
+}
+
+// getQueues returns the depths of the known queues
+func (h *Handler) getQueues(w http.ResponseWriter) {
+	names := h.queueNames()
+	queues := make([]*Queue, 0, len(names))
+	for _, name := range names {
+		pending, err := h.server.GetBroker().GetPendingTasks(name)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+		queues = append(queues, &Queue{Name: name, Pending: len(pending)})
+	}
+	writeJSON(w, http.StatusOK, queues)
+}
+
+// queueNames returns the default queue, the queues with their own settings
+// and their dead letter and poison queues, sorted
+func (h *Handler) queueNames() []string {
+	return sortedNames(append(h.consumedQueues(), h.deadLetterQueues()...))
+}
+
+// consumedQueues returns the default queue and the queues with their own
+// settings
+func (h *Handler) consumedQueues() []string {
+	cnf := h.server.GetConfig()
+	names := []string{cnf.DefaultQueue}
+	for name := range cnf.Queues {
+		names = append(names, name)
+	}
+	return names
+}
+
+// deadLetterQueues returns the dead letter and poison queues of the consumed
+// queues, sorted
+func (h *Handler) deadLetterQueues() []string {
+	cnf := h.server.GetConfig()
+	var names []string
+	for _, name := range h.consumedQueues() {
+		if deadLetterQueue := cnf.GetDeadLetterQueue(name); deadLetterQueue != "" {
+			names = append(names, deadLetterQueue)
+		}
+		if poisonQueue := cnf.GetPoisonQueue(name); poisonQueue != "" {
+			names = append(names, poisonQueue)
+		}
+	}
+	return sortedNames(names)
+}
+
+// sortedNames returns the names sorted without duplicates
+func sortedNames(names []string) []string {
+	unique := make(map[string]struct{}, len(names))
+	sorted := make([]string, 0, len(names))
+	for _, name := range names {
+		if _, ok := unique[name]; !ok {
+			unique[name] = struct{}{}
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+func (h *Handler) getPending(w http.ResponseWriter, queue string) {
+	signatures, err := h.server.GetBroker().GetPendingTasks(queue)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nonNil(signatures))
+}
+
+func (h *Handler) purgeQueue(w http.ResponseWriter, queue string) {
+	purged, err := h.server.PurgeQueue(queue)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+func (h *Handler) requeueQueue(w http.ResponseWriter, queue string) {
+	requeued, err := h.server.RequeueDeadLetters(queue, nil)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"requeued": requeued})
+}
+
+// getFailures returns the failed tasks waiting in the dead letter queues with
+// their errors and the failure history recorded by the result backend
+func (h *Handler) moveMessages(w http.ResponseWriter, r *http.Request, queue string) {
+	to := r.URL.Query().Get("to")
+	if to == "" {
+		writeError(w, http.StatusBadRequest, errors.New("The queue to move the tasks to is required"))
+		return
+	}
+	var limit int
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			writeError(w, http.StatusBadRequest, errors.New("The limit must be a positive number"))
+			return
+		}
+	}
+
+	moved, err := h.server.MoveMessages(queue, to, limit)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"moved": moved})
+}
+
+func (h *Handler) getFailures(w http.ResponseWriter, limit string) {
+	maxFailures := defaultFailuresLimit
+	if limit != "" {
+		var err error
+		if maxFailures, err = strconv.Atoi(limit); err != nil || maxFailures < 1 {
+			writeError(w, http.StatusBadRequest, errors.New("The limit must be a positive number"))
+			return
+		}
+	}
+
+	failures := make([]*Failure, 0)
+	for _, queue := range h.deadLetterQueues() {
+		signatures, err := h.server.GetBroker().GetPendingTasks(queue)
+		if err != nil {
+			writeError(w, statusOf(err), err)
+			return
+		}
+
+		for _, signature := range signatures {
+			if len(failures) == maxFailures {
+				break
+			}
+			failure := &Failure{Queue: queue, Signature: signature}
+			if state, err := h.server.GetBackend().GetState(signature.UUID); err == nil {
+				failure.Error = state.Error
+			}
+			// Backends not recording failure histories only return states
+			if attempts, err := backends.Failures(h.server.GetBackend(), signature.UUID); err == nil {
+				failure.Attempts = attempts
+			}
+			failures = append(failures, failure)
+		}
+	}
+	writeJSON(w, http.StatusOK, failures)
+}
+
+func (h *Handler) getGroup(w http.ResponseWriter, groupUUID, count string) {
+	taskCount, err := strconv.Atoi(count)
+	if err != nil || taskCount < 1 {
+		writeError(w, http.StatusBadRequest, errors.New("The count of tasks of the group is required"))
+		return
+	}
+
+	states, err := h.server.GetBackend().GroupTaskStates(groupUUID, taskCount)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	group := &Group{UUID: groupUUID, Completed: true, States: states}
+	for _, state := range states {
+		if !state.IsCompleted() {
+			group.Completed = false
+		}
+	}
+	writeJSON(w, http.StatusOK, group)
+}
+
+func (h *Handler) getWorkers(w http.ResponseWriter) {
+	workers, err := h.server.GetWorkers()
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, workers)
+}
+
+func (h *Handler) getSchedules(w http.ResponseWriter) {
+	schedules, err := h.server.ListSchedules()
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedules)
+}
+
+func (h *Handler) getSchedule(w http.ResponseWriter, name string) {
+	schedule, err := backends.Schedule(h.server.GetBackend(), name)
+	if err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	if schedule == nil {
+		writeError(w, http.StatusNotFound, machinery.ErrScheduleNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+func (h *Handler) addSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, ok := decodeSchedule(w, r, "")
+	if !ok {
+		return
+	}
+
+	if err := h.server.AddSchedule(schedule); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, schedule)
+}
+
+func (h *Handler) updateSchedule(w http.ResponseWriter, r *http.Request, name string) {
+	schedule, ok := decodeSchedule(w, r, name)
+	if !ok {
+		return
+	}
+
+	if err := h.server.UpdateSchedule(schedule); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+func (h *Handler) removeSchedule(w http.ResponseWriter, name string) {
+	if err := h.server.RemoveSchedule(name); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeSchedule decodes the schedule of the request body, named after the
+// path if the name is set, it writes the error and returns false if it is not
+// a valid schedule
+func decodeSchedule(w http.ResponseWriter, r *http.Request, name string) (*tasks.Schedule, bool) {
+	schedule := new(tasks.Schedule)
+	if err := json.NewDecoder(r.Body).Decode(schedule); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("Decode schedule error: %s", err))
+		return nil, false
+	}
+	if name != "" {
+		schedule.Name = name
+	}
+	if err := schedule.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	return schedule, true
+}
+
+// statusOf returns the status code of the error, 501 when the broker or the
+// backend does not support the operation
+func statusOf(err error) int {
+	switch {
+	case errors.Is(err, errs.ErrTakePendingTasksNotSupported),
+		errors.Is(err, errs.ErrQueueManagementNotSupported),
+		errors.Is(err, backends.ErrHeartbeatsNotSupported),
+		errors.Is(err, backends.ErrWorkerRegistryNotSupported),
+		errors.Is(err, backends.ErrSchedulesNotSupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, machinery.ErrScheduleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, machinery.ErrScheduleExists):
+		return http.StatusConflict
+	case strings.EqualFold(err.Error(), "Not implemented"):
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+// nonNil returns an empty list instead of nil so it is encoded as []
+func nonNil(signatures []*tasks.Signature) []*tasks.Signature {
+	if signatures == nil {
+		return []*tasks.Signature{}
+	}
+	return signatures
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,159 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/admin"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	memorybackend "github.com/RichardKnop/machinery/v2/backends/memory"
+	memorybroker "github.com/RichardKnop/machinery/v2/brokers/memory"
+	lock "github.com/RichardKnop/machinery/v2/locks/eager"
+)
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", DeadLetterQueue: "machinery_dead_letters"}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	require.NoError(t, server.RegisterTask("add", func(a, b int64) (int64, error) { return a + b, nil }))
+	handler := admin.NewHandler(server)
+
+	call := func(method, path string, value interface{}) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		if value != nil {
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(value))
+		}
+		return recorder.Code
+	}
+
+	var names []string
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/tasks", &names))
+	assert.Equal(t, []string{"add"}, names)
+
+	// Tasks are pending until a worker consumes them
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "add"})
+	require.NoError(t, err)
+
+	var queues []*admin.Queue
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/queues", &queues))
+	assert.Equal(t, []*admin.Queue{
+		{Name: "machinery_dead_letters", Pending: 0},
+		{Name: "machinery_tasks", Pending: 1},
+	}, queues)
+
+	var pending []*tasks.Signature
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/queues/machinery_tasks", &pending))
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, asyncResult.Signature.UUID, pending[0].UUID)
+	}
+
+	var state tasks.TaskState
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/tasks/"+asyncResult.Signature.UUID, &state))
+	assert.Equal(t, tasks.StatePending, state.State)
+
+	assert.Equal(t, http.StatusNoContent, call(http.MethodPost, "/tasks/"+asyncResult.Signature.UUID+"/cancel", nil))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/tasks/"+asyncResult.Signature.UUID, &state))
+	assert.Equal(t, tasks.StateCanceled, state.State)
+
+	var purged map[string]int
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/queues/machinery_tasks/purge", &purged))
+	assert.Equal(t, map[string]int{"purged": 1}, purged)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/queues/machinery_tasks", &pending))
+	assert.Empty(t, pending)
+
+	// Failed tasks are moved to the dead letter queue
+	failedResult, err := server.SendTask(&tasks.Signature{Name: "add", RoutingKey: "machinery_dead_letters"})
+	require.NoError(t, err)
+	require.NoError(t, server.GetBackend().SetStateFailure(failedResult.Signature, "boom"))
+
+	var failures []*admin.Failure
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/failures", &failures))
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, "machinery_dead_letters", failures[0].Queue)
+		assert.Equal(t, failedResult.Signature.UUID, failures[0].Signature.UUID)
+		assert.Equal(t, "boom", failures[0].Error)
+	}
+
+	var moved map[string]int
+	assert.Equal(t, http.StatusOK, call(http.MethodPost, "/queues/machinery_dead_letters/move?to=machinery_tasks&limit=5", &moved))
+	assert.Equal(t, map[string]int{"moved": 1}, moved)
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/queues/machinery_tasks", &pending))
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "machinery_tasks", pending[0].RoutingKey)
+	}
+
+	var errResponse map[string]string
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodGet, "/groups/groupUUID", &errResponse))
+	assert.NotEmpty(t, errResponse["error"])
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/unknown", &errResponse))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, "/tasks", &errResponse))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/", &errResponse))
+}
+
+func TestHandler_Dashboard(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	handler := admin.NewHandler(server)
+	handler.Dashboard = true
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), "<title>Machinery</title>")
+}
+
+func TestHandler_Schedules(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	handler := admin.NewHandler(server)
+
+	call := func(method, path, body string, value interface{}) int {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		if value != nil {
+			require.NoError(t, json.NewDecoder(recorder.Body).Decode(value))
+		}
+		return recorder.Code
+	}
+
+	var schedule tasks.Schedule
+	report := `{"Name": "report", "Spec": "0 9 * * *", "Signatures": [{"Name": "send_report"}]}`
+	assert.Equal(t, http.StatusCreated, call(http.MethodPost, "/schedules", report, &schedule))
+	assert.Equal(t, "report", schedule.Name)
+	assert.False(t, schedule.UpdatedAt.IsZero())
+
+	var errResponse map[string]string
+	assert.Equal(t, http.StatusConflict, call(http.MethodPost, "/schedules", report, &errResponse))
+	assert.Equal(t, http.StatusBadRequest, call(http.MethodPost, "/schedules", `{"Name": "empty"}`, &errResponse))
+	assert.NotEmpty(t, errResponse["error"])
+
+	update := `{"Spec": "0 18 * * *", "Signatures": [{"Name": "send_report"}]}`
+	assert.Equal(t, http.StatusOK, call(http.MethodPut, "/schedules/report", update, &schedule))
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/schedules/report", "", &schedule))
+	assert.Equal(t, "0 18 * * *", schedule.Spec)
+
+	var schedules []*tasks.Schedule
+	assert.Equal(t, http.StatusOK, call(http.MethodGet, "/schedules", "", &schedules))
+	assert.Len(t, schedules, 1)
+
+	assert.Equal(t, http.StatusNoContent, call(http.MethodDelete, "/schedules/report", "", nil))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodGet, "/schedules/report", "", &errResponse))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodPut, "/schedules/report", update, &errResponse))
+	assert.Equal(t, http.StatusNotFound, call(http.MethodDelete, "/schedules/report", "", &errResponse))
+}
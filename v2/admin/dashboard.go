@@ -0,0 +1,19 @@
+package admin
+
+import (
+	_ "embed" // embeds the dashboard
+	"net/http"
+)
+
+// dashboard is a single page reading the admin API, throughput is computed
+// from the tasks completed by the registered workers between two refreshes
+//
+//go:embed dashboard.html
+var dashboard []byte
+
+// serveDashboard writes the page of the dashboard
+func serveDashboard(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(dashboard)
+}
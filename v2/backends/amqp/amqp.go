@@ -15,15 +15,16 @@ package amqp
 // It is important to consume the queue exclusively to avoid race conditions.
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"fmt"
+	"sync"
 
 	"github.com/RichardKnop/machinery/v2/backends/iface"
 	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/serialization"
 	"github.com/RichardKnop/machinery/v2/tasks"
 	"github.com/streadway/amqp"
 )
@@ -32,6 +33,11 @@ import (
 type Backend struct {
 	common.Backend
 	common.AMQPConnector
+
+	// pool of channels on a shared connection, so operations do not
+	// open a connection each
+	pool     *common.AMQPPool
+	poolOnce sync.Once
 }
 
 // New creates Backend instance
@@ -48,13 +54,13 @@ func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
 // NOTE: Given AMQP limitation this will only return true if all finished
 // tasks were successful as we do not keep track of completed failed tasks
 func (b *Backend) GroupCompleted(groupUUID string, groupTaskCount int) (bool, error) {
-	conn, channel, err := b.Open(b.GetConfig().ResultBackend, b.GetConfig().TLSConfig)
+	channel, err := b.channelPool().Get()
 	if err != nil {
 		return false, err
 	}
-	defer b.Close(channel, conn)
+	defer b.channelPool().Put(channel)
 
-	queueState, err := b.InspectQueue(channel, groupUUID)
+	queueState, err := b.InspectQueue(channel.Channel, groupUUID)
 	if err != nil {
 		return false, nil
 	}
@@ -64,13 +70,14 @@ func (b *Backend) GroupCompleted(groupUUID string, groupTaskCount int) (bool, er
 
 // GroupTaskStates returns states of all tasks in the group
 func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
-	conn, channel, err := b.Open(b.GetConfig().ResultBackend, b.GetConfig().TLSConfig)
+	channel, err := b.channelPool().Get()
 	if err != nil {
 		return nil, err
 	}
-	defer b.Close(channel, conn)
+	// The channel is left with a consumer, do not give it back to the pool
+	defer b.channelPool().Discard(channel)
 
-	queueState, err := b.InspectQueue(channel, groupUUID)
+	queueState, err := b.InspectQueue(channel.Channel, groupUUID)
 	if err != nil {
 		return nil, err
 	}
@@ -96,10 +103,8 @@ func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*task
 	for i := 0; i < groupTaskCount; i++ {
 		d := <-deliveries
 
-		state := new(tasks.TaskState)
-		decoder := json.NewDecoder(bytes.NewReader([]byte(d.Body)))
-		decoder.UseNumber()
-		if err := decoder.Decode(state); err != nil {
+		state, err := b.UnmarshalTaskState(d.Body)
+		if err != nil {
 			d.Nack(false, false) // multiple, requeue
 			return nil, err
 		}
@@ -117,13 +122,13 @@ func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*task
 // whether the worker should trigger chord (true) or no if it has been triggered
 // already (false)
 func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
-	conn, channel, err := b.Open(b.GetConfig().ResultBackend, b.GetConfig().TLSConfig)
+	channel, err := b.channelPool().Get()
 	if err != nil {
 		return false, err
 	}
-	defer b.Close(channel, conn)
+	defer b.channelPool().Put(channel)
 
-	_, err = b.InspectQueue(channel, amqmChordTriggeredQueue(groupUUID))
+	_, err = b.InspectQueue(channel.Channel, amqmChordTriggeredQueue(groupUUID))
 	if err != nil {
 		return true, nil
 	}
@@ -185,6 +190,21 @@ func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error
 	return b.markTaskCompleted(signature, taskState)
 }
 
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	taskState := tasks.NewCanceledTaskState(signature)
+
+	if err := b.updateState(taskState); err != nil {
+		return err
+	}
+
+	if signature.GroupUUID == "" {
+		return nil
+	}
+
+	return b.markTaskCompleted(signature, taskState)
+}
+
 // GetState returns the latest task state. It will only return the status once
 // as the message will get consumed and removed from the queue.
 func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
@@ -195,10 +215,14 @@ func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 		// Time after that the queue will be deleted.
 		"x-expires": int32(b.getExpiresIn()),
 	}
-	conn, channel, _, _, _, err := b.Connect(
-		b.GetConfig().ResultBackend,
-		"",
-		b.GetConfig().TLSConfig,
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return nil, err
+	}
+	defer b.channelPool().Put(channel)
+
+	_, err = b.Declare(
+		channel.Channel,
 		b.GetConfig().AMQP.Exchange,     // exchange name
 		b.GetConfig().AMQP.ExchangeType, // exchange type
 		taskUUID,                        // queue name
@@ -212,7 +236,6 @@ func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer b.Close(channel, conn)
 
 	d, ok, err := channel.Get(
 		taskUUID, // queue name
@@ -227,10 +250,8 @@ func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 
 	d.Ack(false)
 
-	state := new(tasks.TaskState)
-	decoder := json.NewDecoder(bytes.NewReader([]byte(d.Body)))
-	decoder.UseNumber()
-	if err := decoder.Decode(state); err != nil {
+	state, err := b.UnmarshalTaskState(d.Body)
+	if err != nil {
 		log.ERROR.Printf("Failed to unmarshal task state: %s", string(d.Body))
 		log.ERROR.Print(err)
 		return nil, err
@@ -241,33 +262,43 @@ func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 
 // PurgeState deletes stored task state
 func (b *Backend) PurgeState(taskUUID string) error {
-	conn, channel, err := b.Open(b.GetConfig().ResultBackend, b.GetConfig().TLSConfig)
+	channel, err := b.channelPool().Get()
 	if err != nil {
 		return err
 	}
-	defer b.Close(channel, conn)
+	defer b.channelPool().Put(channel)
 
-	return b.DeleteQueue(channel, taskUUID)
+	return b.DeleteQueue(channel.Channel, taskUUID)
+}
+
+// HealthCheck checks a channel can be opened on the connection to RabbitMQ
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return err
+	}
+	b.channelPool().Put(channel)
+	return nil
 }
 
 // PurgeGroupMeta deletes stored group meta data
 func (b *Backend) PurgeGroupMeta(groupUUID string) error {
-	conn, channel, err := b.Open(b.GetConfig().ResultBackend, b.GetConfig().TLSConfig)
+	channel, err := b.channelPool().Get()
 	if err != nil {
 		return err
 	}
-	defer b.Close(channel, conn)
+	defer b.channelPool().Put(channel)
 
-	b.DeleteQueue(channel, amqmChordTriggeredQueue(groupUUID))
+	b.DeleteQueue(channel.Channel, amqmChordTriggeredQueue(groupUUID))
 
-	return b.DeleteQueue(channel, groupUUID)
+	return b.DeleteQueue(channel.Channel, groupUUID)
 }
 
 // updateState saves current task state
 func (b *Backend) updateState(taskState *tasks.TaskState) error {
-	message, err := json.Marshal(taskState)
+	message, err := b.MarshalTaskState(taskState)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal task state error: %s", err)
 	}
 
 	declareQueueArgs := amqp.Table{
@@ -277,10 +308,14 @@ func (b *Backend) updateState(taskState *tasks.TaskState) error {
 		// Time after that the queue will be deleted.
 		"x-expires": int32(b.getExpiresIn()),
 	}
-	conn, channel, queue, confirmsChan, _, err := b.Connect(
-		b.GetConfig().ResultBackend,
-		"",
-		b.GetConfig().TLSConfig,
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return err
+	}
+	defer b.channelPool().Put(channel)
+
+	queue, err := b.Declare(
+		channel.Channel,
 		b.GetConfig().AMQP.Exchange,     // exchange name
 		b.GetConfig().AMQP.ExchangeType, // exchange type
 		taskState.TaskUUID,              // queue name
@@ -294,29 +329,17 @@ func (b *Backend) updateState(taskState *tasks.TaskState) error {
 	if err != nil {
 		return err
 	}
-	defer b.Close(channel, conn)
 
-	if err := channel.Publish(
+	return channel.PublishAndConfirm(
 		b.GetConfig().AMQP.Exchange, // exchange
 		queue.Name,                  // routing key
-		false,                       // mandatory
-		false,                       // immediate
 		amqp.Publishing{
-			ContentType:  "application/json",
+			ContentType:  b.contentType(),
 			Body:         message,
 			DeliveryMode: amqp.Persistent, // Persistent // Transient
 		},
-	); err != nil {
-		return err
-	}
-
-	confirmed := <-confirmsChan
-
-	if confirmed.Ack {
-		return nil
-	}
-
-	return fmt.Errorf("Failed delivery of delivery tag: %d", confirmed.DeliveryTag)
+		0, // wait until confirmed
+	)
 }
 
 // getExpiresIn returns expiration time
@@ -337,9 +360,9 @@ func (b *Backend) markTaskCompleted(signature *tasks.Signature, taskState *tasks
 		return nil
 	}
 
-	message, err := json.Marshal(taskState)
+	message, err := b.MarshalTaskState(taskState)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal task state error: %s", err)
 	}
 
 	declareQueueArgs := amqp.Table{
@@ -349,10 +372,14 @@ func (b *Backend) markTaskCompleted(signature *tasks.Signature, taskState *tasks
 		// Time after that the queue will be deleted.
 		"x-expires": int32(b.getExpiresIn()),
 	}
-	conn, channel, queue, confirmsChan, _, err := b.Connect(
-		b.GetConfig().ResultBackend,
-		"",
-		b.GetConfig().TLSConfig,
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return err
+	}
+	defer b.channelPool().Put(channel)
+
+	queue, err := b.Declare(
+		channel.Channel,
 		b.GetConfig().AMQP.Exchange,     // exchange name
 		b.GetConfig().AMQP.ExchangeType, // exchange type
 		signature.GroupUUID,             // queue name
@@ -366,31 +393,46 @@ func (b *Backend) markTaskCompleted(signature *tasks.Signature, taskState *tasks
 	if err != nil {
 		return err
 	}
-	defer b.Close(channel, conn)
 
-	if err := channel.Publish(
+	return channel.PublishAndConfirm(
 		b.GetConfig().AMQP.Exchange, // exchange
 		queue.Name,                  // routing key
-		false,                       // mandatory
-		false,                       // immediate
 		amqp.Publishing{
-			ContentType:  "application/json",
+			ContentType:  b.contentType(),
 			Body:         message,
 			DeliveryMode: amqp.Persistent, // Persistent // Transient
 		},
-	); err != nil {
-		return err
-	}
-
-	confirmed := <-confirmsChan
+		0, // wait until confirmed
+	)
+}
 
-	if !confirmed.Ack {
-		return fmt.Errorf("Failed delivery of delivery tag: %v", confirmed.DeliveryTag)
-	}
+// CloseConnections closes the pooled channels and their connection
+func (b *Backend) CloseConnections() error {
+	return b.channelPool().Close()
+}
 
-	return nil
+// channelPool returns the pool of channels, creating it on first use
+func (b *Backend) channelPool() *common.AMQPPool {
+	b.poolOnce.Do(func() {
+		b.pool = common.NewAMQPPool(
+			b.GetConfig().ResultBackend,
+			"",
+			b.GetConfig().TLSConfig,
+			b.GetConfig().AMQP.ChannelPoolSize,
+		)
+	})
+	return b.pool
 }
 
 func amqmChordTriggeredQueue(groupUUID string) string {
 	return fmt.Sprintf("%s_chord_triggered", groupUUID)
 }
+
+// contentType returns the MIME type of states encoded with the configured codec
+func (b *Backend) contentType() string {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return serialization.JSON.ContentType()
+	}
+	return codec.ContentType()
+}
@@ -0,0 +1,236 @@
+package backends
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// bufferedUpdate is a RECEIVED or STARTED state waiting to be written
+type bufferedUpdate struct {
+	signature *tasks.Signature
+	state     string
+}
+
+// Buffered wraps a backend and buffers RECEIVED and STARTED state updates,
+// which are written by a background loop at most one flush interval later.
+// Only the latest buffered update of a task is written, e.g. a task which
+// started before a flush only has its STARTED state written. All other writes
+// are synchronous and replace buffered updates of the task. Writes of a task
+// happen one at a time, writes of different tasks do not wait for each other.
+type Buffered struct {
+	iface.Backend
+	interval time.Duration
+	updates  map[string]bufferedUpdate
+	order    []string                 // task UUIDs in the order they were buffered
+	writing  map[string]chan struct{} // closed once the running write of the task returned
+	mu       sync.Mutex               // protects updates, order and writing
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+// NewBuffered creates Buffered instance and starts flushing buffered updates
+// every flush interval, Close has to be called to write the remaining ones
+func NewBuffered(backend iface.Backend, flushInterval time.Duration) *Buffered {
+	b := &Buffered{
+		Backend:  backend,
+		interval: flushInterval,
+		updates:  make(map[string]bufferedUpdate),
+		writing:  make(map[string]chan struct{}),
+		stopChan: make(chan struct{}),
+	}
+
+	b.wg.Add(1)
+	go b.flushLoop()
+	return b
+}
+
+// SetStateReceived buffers the update of the task state to RECEIVED
+func (b *Buffered) SetStateReceived(signature *tasks.Signature) error {
+	b.buffer(signature, tasks.StateReceived)
+	return nil
+}
+
+// SetStateStarted buffers the update of the task state to STARTED
+func (b *Buffered) SetStateStarted(signature *tasks.Signature) error {
+	b.buffer(signature, tasks.StateStarted)
+	return nil
+}
+
+// SetStatePending updates task state to PENDING
+func (b *Buffered) SetStatePending(signature *tasks.Signature) error {
+	return b.write(signature.UUID, func() error {
+		return b.Backend.SetStatePending(signature)
+	})
+}
+
+// SetStateRetry updates task state to RETRY
+func (b *Buffered) SetStateRetry(signature *tasks.Signature) error {
+	return b.write(signature.UUID, func() error {
+		return b.Backend.SetStateRetry(signature)
+	})
+}
+
+// SetStateSuccess updates task state to SUCCESS
+func (b *Buffered) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	return b.write(signature.UUID, func() error {
+		return b.Backend.SetStateSuccess(signature, results)
+	})
+}
+
+// SetStateFailure updates task state to FAILURE
+func (b *Buffered) SetStateFailure(signature *tasks.Signature, err string) error {
+	return b.write(signature.UUID, func() error {
+		return b.Backend.SetStateFailure(signature, err)
+	})
+}
+
+// SetStateCanceled updates task state to CANCELED
+func (b *Buffered) SetStateCanceled(signature *tasks.Signature) error {
+	return b.write(signature.UUID, func() error {
+		return b.Backend.SetStateCanceled(signature)
+	})
+}
+
+// GetState returns the latest task state, including buffered updates
+func (b *Buffered) GetState(taskUUID string) (*tasks.TaskState, error) {
+	b.mu.Lock()
+	update, ok := b.updates[taskUUID]
+	b.mu.Unlock()
+
+	if !ok {
+		return b.Backend.GetState(taskUUID)
+	}
+	if update.state == tasks.StateReceived {
+		return tasks.NewReceivedTaskState(update.signature), nil
+	}
+	return tasks.NewStartedTaskState(update.signature), nil
+}
+
+// PurgeState deletes stored task state together with its buffered update
+func (b *Buffered) PurgeState(taskUUID string) error {
+	return b.write(taskUUID, func() error {
+		return b.Backend.PurgeState(taskUUID)
+	})
+}
+
+// Flush writes all buffered updates
+func (b *Buffered) Flush() {
+	b.mu.Lock()
+	order := b.order
+	b.order = nil
+	b.mu.Unlock()
+
+	for _, taskUUID := range order {
+		// The latest update is taken when it is written, updates removed by
+		// synchronous writes in the meantime are skipped
+		b.mu.Lock()
+		update, ok := b.take(taskUUID)
+		if !ok {
+			b.mu.Unlock()
+			continue
+		}
+		done := b.startWriting(taskUUID)
+		b.mu.Unlock()
+
+		var err error
+		if update.state == tasks.StateReceived {
+			err = b.Backend.SetStateReceived(update.signature)
+		} else {
+			err = b.Backend.SetStateStarted(update.signature)
+		}
+		done()
+		if err != nil {
+			log.ERROR.Printf("Failed to write buffered %s state of task %s: %s", update.state, taskUUID, err)
+		}
+	}
+}
+
+// Close stops the flush loop and writes the remaining buffered updates
+func (b *Buffered) Close() {
+	b.stopOnce.Do(func() {
+		close(b.stopChan)
+		b.wg.Wait()
+		b.Flush()
+	})
+}
+
+// Unwrap returns the wrapped backend
+func (b *Buffered) Unwrap() iface.Backend {
+	return b.Backend
+}
+
+// buffer replaces the buffered update of the task
+func (b *Buffered) buffer(signature *tasks.Signature, state string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.updates[signature.UUID]; !ok {
+		b.order = append(b.order, signature.UUID)
+	}
+	b.updates[signature.UUID] = bufferedUpdate{signature: signature, state: state}
+}
+
+// write drops the buffered update of the task and calls fn, a flush of the
+// task cannot run concurrently and overwrite the state fn writes with an older
+// one
+func (b *Buffered) write(taskUUID string, fn func() error) error {
+	b.mu.Lock()
+	b.take(taskUUID)
+	done := b.startWriting(taskUUID)
+	b.mu.Unlock()
+
+	defer done()
+	return fn()
+}
+
+// take waits for the running write of the task and removes its buffered
+// update, b.mu has to be held
+func (b *Buffered) take(taskUUID string) (bufferedUpdate, bool) {
+	for {
+		writing, ok := b.writing[taskUUID]
+		if !ok {
+			break
+		}
+		b.mu.Unlock()
+		<-writing
+		b.mu.Lock()
+	}
+
+	update, ok := b.updates[taskUUID]
+	delete(b.updates, taskUUID)
+	return update, ok
+}
+
+// startWriting records a running write of the task, the returned function is
+// called once it returned. b.mu has to be held.
+func (b *Buffered) startWriting(taskUUID string) func() {
+	writing := make(chan struct{})
+	b.writing[taskUUID] = writing
+	return func() {
+		b.mu.Lock()
+		delete(b.writing, taskUUID)
+		b.mu.Unlock()
+		close(writing)
+	}
+}
+
+func (b *Buffered) flushLoop() {
+	defer b.wg.Done()
+
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stopChan:
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
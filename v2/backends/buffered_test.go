@@ -0,0 +1,149 @@
+package backends_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// countingBackend counts STARTED writes
+type countingBackend struct {
+	iface.Backend
+	started int
+}
+
+func (b *countingBackend) SetStateStarted(signature *tasks.Signature) error {
+	b.started++
+	return b.Backend.SetStateStarted(signature)
+}
+
+func TestBuffered(t *testing.T) {
+	t.Parallel()
+
+	wrapped := &countingBackend{Backend: memory.New(new(config.Config))}
+	backend := backends.NewBuffered(wrapped, time.Hour)
+	defer backend.Close()
+
+	signature := &tasks.Signature{UUID: "taskUUID", Name: "add"}
+	assert.NoError(t, backend.SetStatePending(signature))
+	assert.NoError(t, backend.SetStateReceived(signature))
+	assert.NoError(t, backend.SetStateStarted(signature))
+
+	// Buffered updates are not written yet, but they are read
+	state, err := wrapped.GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StatePending, state.State)
+	}
+	state, err = backend.GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateStarted, state.State)
+	}
+
+	// Only the latest update is written
+	backend.Flush()
+	state, err = wrapped.GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateStarted, state.State)
+	}
+	assert.Equal(t, 1, wrapped.started)
+
+	// Synchronous writes replace buffered updates
+	assert.NoError(t, backend.SetStateStarted(signature))
+	assert.NoError(t, backend.SetStateSuccess(signature, nil))
+	backend.Flush()
+	state, err = wrapped.GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateSuccess, state.State)
+	}
+	assert.Equal(t, 1, wrapped.started)
+}
+
+// blockingBackend blocks STARTED writes until it is unblocked
+type blockingBackend struct {
+	iface.Backend
+	blocked   chan struct{}
+	unblocked chan struct{}
+}
+
+func (b *blockingBackend) SetStateStarted(signature *tasks.Signature) error {
+	close(b.blocked)
+	<-b.unblocked
+	return b.Backend.SetStateStarted(signature)
+}
+
+func TestBufferedWriteDuringFlush(t *testing.T) {
+	t.Parallel()
+
+	wrapped := &blockingBackend{
+		Backend:   memory.New(new(config.Config)),
+		blocked:   make(chan struct{}),
+		unblocked: make(chan struct{}),
+	}
+	backend := backends.NewBuffered(wrapped, time.Hour)
+	defer backend.Close()
+
+	flushed := &tasks.Signature{UUID: "flushedTaskUUID"}
+	assert.NoError(t, backend.SetStateStarted(flushed))
+	go backend.Flush()
+	<-wrapped.blocked
+
+	// Writes of other tasks do not wait for the flush
+	assert.NoError(t, backend.SetStateSuccess(&tasks.Signature{UUID: "otherTaskUUID"}, nil))
+
+	// Writes of the flushed task wait for it, so they are not overwritten
+	succeeded := make(chan error)
+	go func() {
+		succeeded <- backend.SetStateSuccess(flushed, nil)
+	}()
+	select {
+	case <-succeeded:
+		t.Fatal("write did not wait for the flush")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(wrapped.unblocked)
+	assert.NoError(t, <-succeeded)
+
+	state, err := wrapped.GetState(flushed.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateSuccess, state.State)
+	}
+}
+
+func TestBufferedFlushInterval(t *testing.T) {
+	t.Parallel()
+
+	wrapped := memory.New(new(config.Config))
+	backend := backends.NewBuffered(wrapped, 10*time.Millisecond)
+	defer backend.Close()
+
+	signature := &tasks.Signature{UUID: "taskUUID"}
+	assert.NoError(t, backend.SetStateReceived(signature))
+
+	assert.Eventually(t, func() bool {
+		state, err := wrapped.GetState(signature.UUID)
+		return err == nil && state.State == tasks.StateReceived
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestBufferedClose(t *testing.T) {
+	t.Parallel()
+
+	wrapped := memory.New(new(config.Config))
+	backend := backends.NewBuffered(wrapped, time.Hour)
+
+	signature := &tasks.Signature{UUID: "taskUUID"}
+	assert.NoError(t, backend.SetStateStarted(signature))
+	backend.Close()
+
+	state, err := wrapped.GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateStarted, state.State)
+	}
+}
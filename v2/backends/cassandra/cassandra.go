@@ -0,0 +1,343 @@
+package cassandra
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gocql/gocql"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// Backend represents a Cassandra / ScyllaDB result backend. Stored rows expire
+// using the native TTL and chords are triggered with a lightweight transaction.
+type Backend struct {
+	common.Backend
+	session           *gocql.Session
+	keyspace          string
+	taskStatesTable   string
+	groupMetasTable   string
+	consistency       gocql.Consistency
+	serialConsistency gocql.SerialConsistency
+}
+
+// New creates Backend instance connected to the hosts, the tables are created
+// if they do not exist
+func New(cnf *config.Config, hosts []string) (iface.Backend, error) {
+	cassandraCnf := cnf.Cassandra
+	if cassandraCnf == nil {
+		cassandraCnf = new(config.CassandraConfig)
+	}
+
+	b := &Backend{
+		Backend:           common.NewBackend(cnf),
+		keyspace:          cassandraCnf.Keyspace,
+		taskStatesTable:   cassandraCnf.TaskStatesTable,
+		groupMetasTable:   cassandraCnf.GroupMetasTable,
+		consistency:       gocql.Quorum,
+		serialConsistency: gocql.Serial,
+	}
+	if b.keyspace == "" {
+		b.keyspace = "machinery"
+	}
+	if b.taskStatesTable == "" {
+		b.taskStatesTable = "task_states"
+	}
+	if b.groupMetasTable == "" {
+		b.groupMetasTable = "group_metas"
+	}
+	if cassandraCnf.Consistency != "" {
+		if err := b.consistency.UnmarshalText([]byte(cassandraCnf.Consistency)); err != nil {
+			return nil, err
+		}
+	}
+	if cassandraCnf.SerialConsistency != "" {
+		if err := b.serialConsistency.UnmarshalText([]byte(cassandraCnf.SerialConsistency)); err != nil {
+			return nil, err
+		}
+	}
+
+	b.session = cassandraCnf.Session
+	if b.session == nil {
+		cluster := gocql.NewCluster(hosts...)
+		cluster.Keyspace = b.keyspace
+		cluster.Consistency = b.consistency
+		cluster.SerialConsistency = b.serialConsistency
+
+		session, err := cluster.CreateSession()
+		if err != nil {
+			return nil, fmt.Errorf("Connect to Cassandra error: %s", err)
+		}
+		b.session = session
+	}
+
+	if err := b.createTables(); err != nil {
+		return nil, fmt.Errorf("Create Cassandra tables error: %s", err)
+	}
+
+	return b, nil
+}
+
+// InitGroup creates and saves a group meta data object
+func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
+	return b.query(
+		fmt.Sprintf(`INSERT INTO %s (group_uuid, task_uuids, chord_triggered, created_at)
+			VALUES (?, ?, false, ?) USING TTL ?`, b.table(b.groupMetasTable)),
+		groupUUID, taskUUIDs, time.Now().UTC(), b.getExpiration(),
+	).Exec()
+}
+
+// GroupCompleted returns true if all tasks in a group finished
+func (b *Backend) GroupCompleted(groupUUID string, groupTaskCount int) (bool, error) {
+	taskStates, err := b.GroupTaskStates(groupUUID, groupTaskCount)
+	if err != nil {
+		return false, err
+	}
+
+	var countSuccessTasks = 0
+	for _, taskState := range taskStates {
+		if taskState.IsCompleted() {
+			countSuccessTasks++
+		}
+	}
+
+	return countSuccessTasks == groupTaskCount, nil
+}
+
+// GroupTaskStates returns states of all tasks in the group
+func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
+	groupMeta, err := b.getGroupMeta(groupUUID)
+	if err != nil {
+		return []*tasks.TaskState{}, err
+	}
+
+	return b.getStates(groupMeta.TaskUUIDs...)
+}
+
+// TriggerChord flags chord as triggered in the backend storage to make sure
+// chord is never trigerred multiple times. Returns a boolean flag to indicate
+// whether the worker should trigger chord (true) or no if it has been triggered
+// already (false)
+func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
+	// The lightweight transaction only applies while the chord has not been
+	// triggered, so exactly one of concurrent callers succeeds
+	var chordTriggered bool
+	applied, err := b.query(
+		fmt.Sprintf(`UPDATE %s USING TTL ? SET chord_triggered = true
+			WHERE group_uuid = ? IF chord_triggered = false`, b.table(b.groupMetasTable)),
+		b.getExpiration(), groupUUID,
+	).ScanCAS(&chordTriggered)
+	if err != nil {
+		return false, err
+	}
+	if applied {
+		return true, nil
+	}
+
+	// The condition also fails when the group does not exist
+	if _, err := b.getGroupMeta(groupUUID); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// SetStatePending updates task state to PENDING
+func (b *Backend) SetStatePending(signature *tasks.Signature) error {
+	taskState := tasks.NewPendingTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateReceived updates task state to RECEIVED
+func (b *Backend) SetStateReceived(signature *tasks.Signature) error {
+	taskState := tasks.NewReceivedTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateStarted updates task state to STARTED
+func (b *Backend) SetStateStarted(signature *tasks.Signature) error {
+	taskState := tasks.NewStartedTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateRetry updates task state to RETRY
+func (b *Backend) SetStateRetry(signature *tasks.Signature) error {
+	taskState := tasks.NewRetryTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateSuccess updates task state to SUCCESS
+func (b *Backend) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	taskState := tasks.NewSuccessTaskState(signature, results)
+	return b.updateState(taskState)
+}
+
+// SetStateFailure updates task state to FAILURE
+func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error {
+	taskState := tasks.NewFailureTaskState(signature, err)
+	return b.updateState(taskState)
+}
+
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	taskState := tasks.NewCanceledTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// GetState returns the latest task state
+func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
+	var stateBytes []byte
+	err := b.query(
+		fmt.Sprintf(`SELECT state FROM %s WHERE task_uuid = ?`, b.table(b.taskStatesTable)),
+		taskUUID,
+	).Scan(&stateBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.decodeState(taskUUID, stateBytes)
+}
+
+// PurgeState deletes stored task state
+func (b *Backend) PurgeState(taskUUID string) error {
+	return b.query(
+		fmt.Sprintf(`DELETE FROM %s WHERE task_uuid = ?`, b.table(b.taskStatesTable)),
+		taskUUID,
+	).Exec()
+}
+
+// PurgeGroupMeta deletes stored group meta data
+func (b *Backend) PurgeGroupMeta(groupUUID string) error {
+	return b.query(
+		fmt.Sprintf(`DELETE FROM %s WHERE group_uuid = ?`, b.table(b.groupMetasTable)),
+		groupUUID,
+	).Exec()
+}
+
+// HealthCheck verifies the cluster answers queries
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	var releaseVersion string
+	return b.session.Query(`SELECT release_version FROM system.local`).WithContext(ctx).Scan(&releaseVersion)
+}
+
+// getGroupMeta retrieves group meta data for a group UUID
+func (b *Backend) getGroupMeta(groupUUID string) (*tasks.GroupMeta, error) {
+	groupMeta := &tasks.GroupMeta{GroupUUID: groupUUID}
+	err := b.query(
+		fmt.Sprintf(`SELECT task_uuids, chord_triggered, created_at FROM %s WHERE group_uuid = ?`,
+			b.table(b.groupMetasTable)),
+		groupUUID,
+	).Scan(&groupMeta.TaskUUIDs, &groupMeta.ChordTriggered, &groupMeta.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupMeta, nil
+}
+
+// getStates returns multiple task states, in the order of the task UUIDs
+func (b *Backend) getStates(taskUUIDs ...string) ([]*tasks.TaskState, error) {
+	iter := b.query(
+		fmt.Sprintf(`SELECT task_uuid, state FROM %s WHERE task_uuid IN ?`, b.table(b.taskStatesTable)),
+		taskUUIDs,
+	).Iter()
+
+	statesByUUID := make(map[string]*tasks.TaskState, len(taskUUIDs))
+	var (
+		taskUUID   string
+		stateBytes []byte
+	)
+	for iter.Scan(&taskUUID, &stateBytes) {
+		state, err := b.decodeState(taskUUID, stateBytes)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		statesByUUID[taskUUID] = state
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	states := make([]*tasks.TaskState, 0, len(taskUUIDs))
+	for _, taskUUID := range taskUUIDs {
+		state, ok := statesByUUID[taskUUID]
+		if !ok {
+			return nil, fmt.Errorf("Task not found: %s", taskUUID)
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// updateState saves current task state
+func (b *Backend) updateState(taskState *tasks.TaskState) error {
+	encoded, err := b.MarshalTaskState(taskState)
+	if err != nil {
+		return err
+	}
+
+	return b.query(
+		fmt.Sprintf(`INSERT INTO %s (task_uuid, state) VALUES (?, ?) USING TTL ?`, b.table(b.taskStatesTable)),
+		taskState.TaskUUID, encoded, b.getExpiration(),
+	).Exec()
+}
+
+// createTables creates the task states and group metas tables
+func (b *Backend) createTables() error {
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			task_uuid text PRIMARY KEY,
+			state blob
+		)`, b.table(b.taskStatesTable)),
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			group_uuid text PRIMARY KEY,
+			task_uuids list<text>,
+			chord_triggered boolean,
+			created_at timestamp
+		)`, b.table(b.groupMetasTable)),
+	}
+	for _, statement := range statements {
+		if err := b.session.Query(statement).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// query returns a query using the configured consistency levels
+func (b *Backend) query(statement string, values ...interface{}) *gocql.Query {
+	return b.session.Query(statement, values...).
+		Consistency(b.consistency).
+		SerialConsistency(b.serialConsistency)
+}
+
+// table returns a table name qualified by the keyspace
+func (b *Backend) table(name string) string {
+	return fmt.Sprintf("%s.%s", b.keyspace, name)
+}
+
+// getExpiration returns the TTL of stored rows in seconds
+func (b *Backend) getExpiration() int {
+	expiresIn := b.GetConfig().ResultsExpireIn
+	if expiresIn == 0 {
+		// expire results after 1 hour by default
+		expiresIn = config.DefaultResultsExpireIn
+	}
+
+	return expiresIn
+}
+
+// decodeState decodes a stored task state
+func (b *Backend) decodeState(taskUUID string, stateBytes []byte) (*tasks.TaskState, error) {
+	state, err := b.UnmarshalTaskState(stateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal task state %s: %v", taskUUID, err)
+	}
+
+	return state, nil
+}
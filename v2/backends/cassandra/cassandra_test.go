@@ -0,0 +1,85 @@
+package cassandra_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/RichardKnop/machinery/v2/backends/cassandra"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupCompleted(t *testing.T) {
+	cassandraHosts := os.Getenv("CASSANDRA_HOSTS")
+	if cassandraHosts == "" {
+		t.Skip("CASSANDRA_HOSTS is not defined")
+	}
+
+	groupUUID := "testGroupUUID"
+	task1 := &tasks.Signature{
+		UUID:      "testTaskUUID1",
+		GroupUUID: groupUUID,
+	}
+	task2 := &tasks.Signature{
+		UUID:      "testTaskUUID2",
+		GroupUUID: groupUUID,
+	}
+
+	backend, err := cassandra.New(new(config.Config), strings.Split(cassandraHosts, ","))
+	require.NoError(t, err)
+
+	// Cleanup before the test
+	backend.PurgeState(task1.UUID)
+	backend.PurgeState(task2.UUID)
+	backend.PurgeGroupMeta(groupUUID)
+
+	groupCompleted, err := backend.GroupCompleted(groupUUID, 2)
+	if assert.Error(t, err) {
+		assert.False(t, groupCompleted)
+	}
+
+	backend.InitGroup(groupUUID, []string{task1.UUID, task2.UUID})
+
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.Error(t, err) {
+		assert.False(t, groupCompleted)
+	}
+
+	backend.SetStatePending(task1)
+	backend.SetStateStarted(task2)
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.False(t, groupCompleted)
+	}
+
+	taskResults := []*tasks.TaskResult{new(tasks.TaskResult)}
+	backend.SetStateSuccess(task1, taskResults)
+	backend.SetStateFailure(task2, "Some error")
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.True(t, groupCompleted)
+	}
+
+	shouldTrigger, err := backend.TriggerChord(groupUUID)
+	if assert.NoError(t, err) {
+		assert.True(t, shouldTrigger)
+	}
+
+	shouldTrigger, err = backend.TriggerChord(groupUUID)
+	if assert.NoError(t, err) {
+		assert.False(t, shouldTrigger)
+	}
+}
+
+func TestNewInvalidConsistency(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{
+		Cassandra: &config.CassandraConfig{Consistency: "SOME"},
+	}
+	_, err := cassandra.New(cnf, []string{"127.0.0.1"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package backends
+
+import (
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrChildrenNotSupported is returned when a backend does not record the
+// child tasks sent by running tasks
+var ErrChildrenNotSupported = errors.New("Result backend does not track child tasks")
+
+// AddChild records the task as a child of the parent task in the backend or
+// the backends it wraps
+func AddChild(backend iface.Backend, parentUUID, childUUID string) error {
+	trackers := childTrackers(backend)
+	if len(trackers) == 0 {
+		return ErrChildrenNotSupported
+	}
+
+	for _, tracker := range trackers {
+		if err := tracker.AddChild(parentUUID, childUUID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Children returns UUIDs of the children of the parent task, read from the
+// first backend recording them
+func Children(backend iface.Backend, parentUUID string) ([]string, error) {
+	trackers := childTrackers(backend)
+	if len(trackers) == 0 {
+		return nil, ErrChildrenNotSupported
+	}
+
+	return trackers[0].Children(parentUUID)
+}
+
+// ChildTaskStates returns states of all children of the parent task. States
+// are read through the backend, e.g. decrypted by Encrypted.
+func ChildTaskStates(backend iface.Backend, parentUUID string) ([]*tasks.TaskState, error) {
+	childUUIDs, err := Children(backend, parentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	states := make([]*tasks.TaskState, 0, len(childUUIDs))
+	for _, childUUID := range childUUIDs {
+		state, err := backend.GetState(childUUID)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// ChildrenCompleted returns true if all children of the parent task finished,
+// which is also the case when the parent task sent none
+func ChildrenCompleted(backend iface.Backend, parentUUID string) (bool, error) {
+	states, err := ChildTaskStates(backend, parentUUID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, state := range states {
+		if !state.IsCompleted() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// childTrackers returns the backends recording child tasks, the backend
+// itself or the backends it wraps
+func childTrackers(backend iface.Backend) []iface.ChildTracker {
+	return implementations[iface.ChildTracker](backend)
+}
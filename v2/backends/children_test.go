@@ -0,0 +1,67 @@
+package backends_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/null"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestChildren(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{
+		ResultEncryptionKey: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")),
+	}
+	backend, err := backends.NewEncrypted(cnf, memory.New(cnf))
+	require.NoError(t, err)
+
+	// A parent without children has completed them
+	completed, err := backends.ChildrenCompleted(backend, "parentUUID")
+	if assert.NoError(t, err) {
+		assert.True(t, completed)
+	}
+
+	first := &tasks.Signature{UUID: "firstChildUUID", ParentUUID: "parentUUID"}
+	second := &tasks.Signature{UUID: "secondChildUUID", ParentUUID: "parentUUID"}
+	for _, child := range []*tasks.Signature{first, second, first} {
+		require.NoError(t, backends.AddChild(backend, child.ParentUUID, child.UUID))
+		require.NoError(t, backend.SetStatePending(child))
+	}
+
+	childUUIDs, err := backends.Children(backend, "parentUUID")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{first.UUID, second.UUID}, childUUIDs)
+	}
+
+	require.NoError(t, backend.SetStateSuccess(first, []*tasks.TaskResult{{Type: "string", Value: "secret"}}))
+	completed, err = backends.ChildrenCompleted(backend, "parentUUID")
+	if assert.NoError(t, err) {
+		assert.False(t, completed)
+	}
+
+	require.NoError(t, backend.SetStateFailure(second, "error"))
+	completed, err = backends.ChildrenCompleted(backend, "parentUUID")
+	if assert.NoError(t, err) {
+		assert.True(t, completed)
+	}
+
+	// States are decrypted
+	states, err := backends.ChildTaskStates(backend, "parentUUID")
+	if assert.NoError(t, err) && assert.Len(t, states, 2) {
+		assert.Equal(t, "secret", states[0].Results[0].Value)
+		assert.Equal(t, tasks.StateFailure, states[1].State)
+	}
+
+	err = backends.AddChild(null.New(), "parentUUID", "childUUID")
+	assert.Equal(t, backends.ErrChildrenNotSupported, err)
+	_, err = backends.ChildTaskStates(null.New(), "parentUUID")
+	assert.Equal(t, backends.ErrChildrenNotSupported, err)
+}
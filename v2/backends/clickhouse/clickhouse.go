@@ -0,0 +1,381 @@
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	// registers the clickhouse database/sql driver
+	_ "github.com/ClickHouse/clickhouse-go/v2"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrChordsNotSupported is returned when triggering a chord without a primary
+// backend, an append-only table cannot flag a chord as triggered atomically
+var ErrChordsNotSupported = errors.New("ClickHouse backend cannot trigger chords without a primary backend")
+
+// Backend represents a ClickHouse backend appending every task state
+// transition to a history table for analytical queries.
+//
+// It is meant to be chained behind a primary backend, which then keeps serving
+// task states, group metas and chords while transitions are also recorded.
+// Without a primary backend task states are read from the history.
+type Backend struct {
+	common.Backend
+	db       *sql.DB
+	primary  iface.Backend
+	table    string
+	workerID string
+	started  map[string]time.Time // start times of running tasks, to record durations
+	mu       sync.Mutex
+}
+
+// New creates Backend instance connected to the ClickHouse DSN, e.g.
+// clickhouse://localhost:9000/default. The primary backend may be nil.
+func New(cnf *config.Config, dsn string, primary iface.Backend) (iface.Backend, error) {
+	db, err := sql.Open("clickhouse", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("Open ClickHouse connection error: %s", err)
+	}
+
+	b := &Backend{
+		Backend: common.NewBackend(cnf),
+		db:      db,
+		primary: primary,
+		table:   "task_history",
+		started: make(map[string]time.Time),
+	}
+	if cnf.ClickHouse != nil {
+		if cnf.ClickHouse.Table != "" {
+			b.table = cnf.ClickHouse.Table
+		}
+		b.workerID = cnf.ClickHouse.WorkerID
+	}
+	if b.workerID == "" {
+		hostname, _ := os.Hostname()
+		b.workerID = fmt.Sprintf("%s:%d", hostname, os.Getpid())
+	}
+
+	if err := b.createTable(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Create ClickHouse table error: %s", err)
+	}
+
+	return b, nil
+}
+
+// InitGroup creates and saves a group meta data object
+func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
+	if b.primary != nil {
+		return b.primary.InitGroup(groupUUID, taskUUIDs)
+	}
+
+	// Tasks of the group are found by the group UUID of their transitions
+	return nil
+}
+
+// GroupCompleted returns true if all tasks in a group finished
+func (b *Backend) GroupCompleted(groupUUID string, groupTaskCount int) (bool, error) {
+	if b.primary != nil {
+		return b.primary.GroupCompleted(groupUUID, groupTaskCount)
+	}
+
+	taskStates, err := b.GroupTaskStates(groupUUID, groupTaskCount)
+	if err != nil {
+		return false, err
+	}
+
+	var countSuccessTasks = 0
+	for _, taskState := range taskStates {
+		if taskState.IsCompleted() {
+			countSuccessTasks++
+		}
+	}
+
+	return countSuccessTasks == groupTaskCount, nil
+}
+
+// GroupTaskStates returns states of all tasks in the group
+func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
+	if b.primary != nil {
+		return b.primary.GroupTaskStates(groupUUID, groupTaskCount)
+	}
+
+	rows, err := b.db.Query(fmt.Sprintf(
+		`SELECT task_uuid, argMax(task_name, created_at), argMax(state, created_at),
+			argMax(results, created_at), argMax(error, created_at), max(created_at)
+		FROM %s WHERE group_uuid = ? GROUP BY task_uuid`, b.table),
+		groupUUID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := make([]*tasks.TaskState, 0, groupTaskCount)
+	for rows.Next() {
+		state, err := scanState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+// TriggerChord flags chord as triggered in the backend storage to make sure
+// chord is never trigerred multiple times. Returns a boolean flag to indicate
+// whether the worker should trigger chord (true) or no if it has been triggered
+// already (false)
+func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
+	if b.primary != nil {
+		return b.primary.TriggerChord(groupUUID)
+	}
+
+	return false, ErrChordsNotSupported
+}
+
+// SetStatePending updates task state to PENDING
+func (b *Backend) SetStatePending(signature *tasks.Signature) error {
+	if b.primary != nil {
+		if err := b.primary.SetStatePending(signature); err != nil {
+			return err
+		}
+	}
+
+	taskState := tasks.NewPendingTaskState(signature)
+	return b.record(signature, taskState)
+}
+
+// SetStateReceived updates task state to RECEIVED
+func (b *Backend) SetStateReceived(signature *tasks.Signature) error {
+	if b.primary != nil {
+		if err := b.primary.SetStateReceived(signature); err != nil {
+			return err
+		}
+	}
+
+	taskState := tasks.NewReceivedTaskState(signature)
+	return b.record(signature, taskState)
+}
+
+// SetStateStarted updates task state to STARTED
+func (b *Backend) SetStateStarted(signature *tasks.Signature) error {
+	if b.primary != nil {
+		if err := b.primary.SetStateStarted(signature); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	b.started[signature.UUID] = time.Now()
+	b.mu.Unlock()
+
+	taskState := tasks.NewStartedTaskState(signature)
+	return b.record(signature, taskState)
+}
+
+// SetStateRetry updates task state to RETRY
+func (b *Backend) SetStateRetry(signature *tasks.Signature) error {
+	if b.primary != nil {
+		if err := b.primary.SetStateRetry(signature); err != nil {
+			return err
+		}
+	}
+
+	taskState := tasks.NewRetryTaskState(signature)
+	return b.record(signature, taskState)
+}
+
+// SetStateSuccess updates task state to SUCCESS
+func (b *Backend) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	if b.primary != nil {
+		if err := b.primary.SetStateSuccess(signature, results); err != nil {
+			return err
+		}
+	}
+
+	taskState := tasks.NewSuccessTaskState(signature, results)
+	return b.record(signature, taskState)
+}
+
+// SetStateFailure updates task state to FAILURE
+func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error {
+	if b.primary != nil {
+		if err := b.primary.SetStateFailure(signature, err); err != nil {
+			return err
+		}
+	}
+
+	taskState := tasks.NewFailureTaskState(signature, err)
+	return b.record(signature, taskState)
+}
+
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	if b.primary != nil {
+		if err := b.primary.SetStateCanceled(signature); err != nil {
+			return err
+		}
+	}
+
+	taskState := tasks.NewCanceledTaskState(signature)
+	return b.record(signature, taskState)
+}
+
+// GetState returns the latest task state
+func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
+	if b.primary != nil {
+		return b.primary.GetState(taskUUID)
+	}
+
+	row := b.db.QueryRow(fmt.Sprintf(
+		`SELECT task_uuid, task_name, state, results, error, created_at
+		FROM %s WHERE task_uuid = ? ORDER BY created_at DESC LIMIT 1`, b.table),
+		taskUUID,
+	)
+	state, err := scanState(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Task not found: %s", taskUUID)
+	}
+	return state, err
+}
+
+// PurgeState deletes stored task state, the history is kept
+func (b *Backend) PurgeState(taskUUID string) error {
+	if b.primary != nil {
+		return b.primary.PurgeState(taskUUID)
+	}
+	return nil
+}
+
+// PurgeGroupMeta deletes stored group meta data, the history is kept
+func (b *Backend) PurgeGroupMeta(groupUUID string) error {
+	if b.primary != nil {
+		return b.primary.PurgeGroupMeta(groupUUID)
+	}
+	return nil
+}
+
+// IsAMQP returns true when the primary backend is AMQP
+func (b *Backend) IsAMQP() bool {
+	return b.primary != nil && b.primary.IsAMQP()
+}
+
+// HealthCheck verifies both the primary backend and ClickHouse are reachable
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	if b.primary != nil {
+		if err := b.primary.HealthCheck(ctx); err != nil {
+			return err
+		}
+	}
+	return b.db.PingContext(ctx)
+}
+
+// Unwrap returns the primary backend, nil without one
+func (b *Backend) Unwrap() iface.Backend {
+	return b.primary
+}
+
+// record appends a state transition to the history. With a primary backend the
+// state has already been saved, so failing to record it is only logged.
+func (b *Backend) record(signature *tasks.Signature, taskState *tasks.TaskState) error {
+	err := b.insert(signature, taskState)
+	if err != nil && b.primary != nil {
+		log.ERROR.Printf("Failed to record %s state of task %s in ClickHouse: %s", taskState.State, signature.UUID, err)
+		return nil
+	}
+	return err
+}
+
+func (b *Backend) insert(signature *tasks.Signature, taskState *tasks.TaskState) error {
+	results, err := json.Marshal(taskState.Results)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.db.Exec(fmt.Sprintf(
+		`INSERT INTO %s (task_uuid, task_name, group_uuid, state, results, error, worker_id, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`, b.table),
+		signature.UUID,
+		signature.Name,
+		signature.GroupUUID,
+		taskState.State,
+		string(results),
+		taskState.Error,
+		b.workerID,
+		uint64(b.duration(signature.UUID, taskState.State)/time.Millisecond),
+		time.Now().UTC(),
+	)
+	return err
+}
+
+// duration returns how long the task ran when it finished, zero otherwise
+func (b *Backend) duration(taskUUID, state string) time.Duration {
+	if state != tasks.StateSuccess && state != tasks.StateFailure && state != tasks.StateCanceled && state != tasks.StateRetry {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	started, ok := b.started[taskUUID]
+	if !ok {
+		return 0
+	}
+	delete(b.started, taskUUID)
+	return time.Since(started)
+}
+
+// createTable creates the history table, partitioned by month
+func (b *Backend) createTable() error {
+	_, err := b.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		task_uuid   String,
+		task_name   LowCardinality(String),
+		group_uuid  String,
+		state       LowCardinality(String),
+		results     String,
+		error       String,
+		worker_id   LowCardinality(String),
+		duration_ms UInt64,
+		created_at  DateTime64(6, 'UTC')
+	) ENGINE = MergeTree
+	PARTITION BY toYYYYMM(created_at)
+	ORDER BY (task_name, created_at, task_uuid)`, b.table))
+	return err
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanState decodes a task state from a history row
+func scanState(row scanner) (*tasks.TaskState, error) {
+	var (
+		state   = new(tasks.TaskState)
+		results string
+	)
+	if err := row.Scan(&state.TaskUUID, &state.TaskName, &state.State, &results, &state.Error, &state.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(results)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&state.Results); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal results of task %s: %v", state.TaskUUID, err)
+	}
+
+	return state, nil
+}
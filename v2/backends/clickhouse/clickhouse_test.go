@@ -0,0 +1,80 @@
+package clickhouse_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/RichardKnop/machinery/v2/backends/clickhouse"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStandalone(t *testing.T) {
+	clickhouseURL := os.Getenv("CLICKHOUSE_URL")
+	if clickhouseURL == "" {
+		t.Skip("CLICKHOUSE_URL is not defined")
+	}
+
+	cnf := &config.Config{ClickHouse: &config.ClickHouseConfig{Table: "task_history_test"}}
+	backend, err := clickhouse.New(cnf, clickhouseURL, nil)
+	require.NoError(t, err)
+
+	groupUUID := "testGroupUUID"
+	task1 := &tasks.Signature{UUID: "testTaskUUID1", Name: "add", GroupUUID: groupUUID}
+	task2 := &tasks.Signature{UUID: "testTaskUUID2", Name: "add", GroupUUID: groupUUID}
+
+	backend.InitGroup(groupUUID, []string{task1.UUID, task2.UUID})
+	backend.SetStatePending(task1)
+	backend.SetStatePending(task2)
+	backend.SetStateStarted(task1)
+	backend.SetStateSuccess(task1, []*tasks.TaskResult{{Type: "int64", Value: 2}})
+
+	state, err := backend.GetState(task1.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateSuccess, state.State)
+		assert.Len(t, state.Results, 1)
+	}
+
+	groupCompleted, err := backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.False(t, groupCompleted)
+	}
+
+	backend.SetStateFailure(task2, "Some error")
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.True(t, groupCompleted)
+	}
+
+	_, err = backend.TriggerChord(groupUUID)
+	assert.Equal(t, clickhouse.ErrChordsNotSupported, err)
+}
+
+func TestChained(t *testing.T) {
+	clickhouseURL := os.Getenv("CLICKHOUSE_URL")
+	if clickhouseURL == "" {
+		t.Skip("CLICKHOUSE_URL is not defined")
+	}
+
+	cnf := &config.Config{ClickHouse: &config.ClickHouseConfig{Table: "task_history_test"}}
+	primary := memory.New(cnf)
+	backend, err := clickhouse.New(cnf, clickhouseURL, primary)
+	require.NoError(t, err)
+
+	task := &tasks.Signature{UUID: "testChainedTaskUUID", Name: "add"}
+	assert.NoError(t, backend.SetStatePending(task))
+	assert.NoError(t, backend.SetStateStarted(task))
+
+	// States are read from the primary backend
+	state, err := primary.GetState(task.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateStarted, state.State)
+	}
+	state, err = backend.GetState(task.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateStarted, state.State)
+	}
+}
@@ -0,0 +1,53 @@
+package backends
+
+import (
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+)
+
+// ErrDeliveriesNotSupported is returned when a backend does not count
+// deliveries of tasks
+var ErrDeliveriesNotSupported = errors.New("Result backend does not count deliveries")
+
+// CountDelivery counts a delivery of the task in the backend or the backends
+// it wraps, it returns the count of the first backend counting deliveries
+func CountDelivery(backend iface.Backend, taskUUID string) (int, error) {
+	counters := deliveryCounters(backend)
+	if len(counters) == 0 {
+		return 0, ErrDeliveriesNotSupported
+	}
+
+	count, err := counters[0].CountDelivery(taskUUID)
+	if err != nil {
+		return 0, err
+	}
+	for _, counter := range counters[1:] {
+		if _, err := counter.CountDelivery(taskUUID); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+// ResetDeliveries resets the deliveries of the task in the backend or the
+// backends it wraps
+func ResetDeliveries(backend iface.Backend, taskUUID string) error {
+	counters := deliveryCounters(backend)
+	if len(counters) == 0 {
+		return ErrDeliveriesNotSupported
+	}
+
+	for _, counter := range counters {
+		if err := counter.ResetDeliveries(taskUUID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliveryCounters returns the backends counting deliveries, the backend
+// itself or the backends it wraps
+func deliveryCounters(backend iface.Backend) []iface.DeliveryCounter {
+	return implementations[iface.DeliveryCounter](backend)
+}
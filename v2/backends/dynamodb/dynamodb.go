@@ -1,34 +1,53 @@
 package dynamodb
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws/session"
-
 	"github.com/RichardKnop/machinery/v2/backends/iface"
 	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
 	"github.com/RichardKnop/machinery/v2/tasks"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 const (
 	BatchItemsLimit  = 99
 	MaxFetchAttempts = 3
+	// TTLAttribute is the attribute holding the expiration time of items
+	TTLAttribute = "TTL"
+	// tableCreationTimeout is how long to wait for created tables to become active
+	tableCreationTimeout = 5 * time.Minute
 )
 
+// API is the part of the DynamoDB client used by the backend
+type API interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	DescribeTable(ctx context.Context, params *dynamodb.DescribeTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error)
+	DescribeTimeToLive(ctx context.Context, params *dynamodb.DescribeTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error)
+	UpdateTimeToLive(ctx context.Context, params *dynamodb.UpdateTimeToLiveInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
 // Backend ...
 type Backend struct {
 	common.Backend
 	cnf    *config.Config
-	client dynamodbiface.DynamoDBAPI
+	client API
 }
 
 // New creates a Backend instance
@@ -38,20 +57,51 @@ func New(cnf *config.Config) iface.Backend {
 	if cnf.DynamoDB != nil && cnf.DynamoDB.Client != nil {
 		backend.client = cnf.DynamoDB.Client
 	} else {
-		sess := session.Must(session.NewSessionWithOptions(session.Options{
-			SharedConfigState: session.SharedConfigEnable,
-		}))
-		backend.client = dynamodb.New(sess)
+		backend.client = newClient(cnf.DynamoDB)
 	}
 
-	// Check if needed tables exist
-	err := backend.checkRequiredTablesIfExist()
+	// Create the tables or check if needed tables exist
+	var err error
+	if cnf.DynamoDB != nil && cnf.DynamoDB.CreateTables {
+		err = backend.createTables()
+	} else {
+		err = backend.checkRequiredTablesIfExist()
+	}
 	if err != nil {
 		log.FATAL.Printf("Failed to prepare tables. Error: %v", err)
 	}
 	return backend
 }
 
+// newClient creates a DynamoDB client, the SDK loads credentials from the environment,
+// the shared credentials file ~/.aws/credentials or a web identity token file
+func newClient(cnf *config.DynamoDBConfig) *dynamodb.Client {
+	var (
+		opts     common.AWSOptions
+		endpoint string
+	)
+	if cnf != nil {
+		opts = common.AWSOptions{
+			Region:               cnf.Region,
+			RoleARN:              cnf.RoleARN,
+			RoleSessionName:      cnf.RoleSessionName,
+			WebIdentityTokenFile: cnf.WebIdentityTokenFile,
+		}
+		endpoint = cnf.Endpoint
+	}
+
+	awsCfg, err := common.NewAWSConfig(context.Background(), opts)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load AWS config: %s", err))
+	}
+
+	return dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+		if endpoint != "" {
+			o.EndpointResolver = dynamodb.EndpointResolverFromURL(endpoint)
+		}
+	})
+}
+
 // InitGroup ...
 func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
 	meta := tasks.GroupMeta{
@@ -60,7 +110,7 @@ func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
 		CreatedAt: time.Now().UTC(),
 		TTL:       b.getExpirationTime(),
 	}
-	av, err := dynamodbattribute.MarshalMap(meta)
+	av, err := attributevalue.MarshalMap(meta)
 	if err != nil {
 		log.ERROR.Printf("Error when marshaling Dynamodb attributes. Err: %v", err)
 		return err
@@ -69,7 +119,7 @@ func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
 		Item:      av,
 		TableName: aws.String(b.cnf.DynamoDB.GroupMetasTable),
 	}
-	_, err = b.client.PutItem(input)
+	_, err = b.client.PutItem(context.Background(), input)
 
 	if err != nil {
 		log.ERROR.Printf("Got error when calling PutItem: %v; Error: %v", input, err)
@@ -148,7 +198,7 @@ func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
 func (b *Backend) SetStatePending(signature *tasks.Signature) error {
 	taskState := tasks.NewPendingTaskState(signature)
 	// taskUUID is the primary key of the table, so a new task need to be created first, instead of using dynamodb.UpdateItemInput directly
-	return b.initTaskState(taskState)
+	return b.initTaskState(taskState, signature.GroupUUID)
 }
 
 // SetStateReceived ...
@@ -183,14 +233,19 @@ func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error
 	return b.updateToFailureStateWithError(taskState)
 }
 
+// SetStateCanceled ...
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	taskState := tasks.NewCanceledTaskState(signature)
+	taskState.TTL = b.getExpirationTime()
+	return b.setTaskState(taskState)
+}
+
 // GetState ...
 func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
-	result, err := b.client.GetItem(&dynamodb.GetItemInput{
+	result, err := b.client.GetItem(context.Background(), &dynamodb.GetItemInput{
 		TableName: aws.String(b.cnf.DynamoDB.TaskStatesTable),
-		Key: map[string]*dynamodb.AttributeValue{
-			"TaskUUID": {
-				S: aws.String(taskUUID),
-			},
+		Key: map[string]types.AttributeValue{
+			"TaskUUID": &types.AttributeValueMemberS{Value: taskUUID},
 		},
 		ConsistentRead: aws.Bool(true),
 	})
@@ -200,6 +255,40 @@ func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 	return b.unmarshalTaskStateGetItemResult(result)
 }
 
+// QueryGroupTaskStates returns states of all tasks in the group using the
+// group index, which has to be configured. Reads from a global secondary index
+// are eventually consistent, so recent changes may be missing.
+func (b *Backend) QueryGroupTaskStates(groupUUID string) ([]*tasks.TaskState, error) {
+	if b.cnf.DynamoDB.GroupIndex == "" {
+		return nil, errors.New("DynamoDB group index is not configured")
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(b.cnf.DynamoDB.TaskStatesTable),
+		IndexName:              aws.String(b.cnf.DynamoDB.GroupIndex),
+		KeyConditionExpression: aws.String("GroupUUID = :g"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":g": &types.AttributeValueMemberS{Value: groupUUID},
+		},
+	}
+
+	var states []*tasks.TaskState
+	paginator := dynamodb.NewQueryPaginator(b.client, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		var pageStates []*tasks.TaskState
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &pageStates); err != nil {
+			return nil, fmt.Errorf("Got error when unmarshal map. Error: %v", err)
+		}
+		states = append(states, pageStates...)
+	}
+	return states, nil
+}
+
 // getStates returns the current states for the given list of tasks.
 // It uses batch fetch API. If any keys fail to fetch, it'll retry with exponential backoff until maxFetchAttempts times.
 func (b *Backend) getStates(tasksToFetch []string) ([]*tasks.TaskState, error) {
@@ -240,17 +329,15 @@ func (b *Backend) getStates(tasksToFetch []string) ([]*tasks.TaskState, error) {
 // https://docs.aws.amazon.com/sdk-for-go/api/service/dynamodb/#DynamoDB.BatchGetItem
 func (b *Backend) batchFetchTaskStates(taskUUIDs []string) ([]*tasks.TaskState, []string, error) {
 	tableName := b.cnf.DynamoDB.TaskStatesTable
-	keys := make([]map[string]*dynamodb.AttributeValue, len(taskUUIDs))
+	keys := make([]map[string]types.AttributeValue, len(taskUUIDs))
 	for i, tid := range taskUUIDs {
-		keys[i] = map[string]*dynamodb.AttributeValue{
-			"TaskUUID": {
-				S: aws.String(tid),
-			},
+		keys[i] = map[string]types.AttributeValue{
+			"TaskUUID": &types.AttributeValueMemberS{Value: tid},
 		}
 	}
 
 	input := &dynamodb.BatchGetItemInput{
-		RequestItems: map[string]*dynamodb.KeysAndAttributes{
+		RequestItems: map[string]types.KeysAndAttributes{
 			tableName: {
 				ConsistentRead: aws.Bool(true),
 				Keys:           keys,
@@ -258,7 +345,7 @@ func (b *Backend) batchFetchTaskStates(taskUUIDs []string) ([]*tasks.TaskState,
 		},
 	}
 
-	result, err := b.client.BatchGetItem(input)
+	result, err := b.client.BatchGetItem(context.Background(), input)
 	if err != nil {
 		return nil, nil, fmt.Errorf("BatchGetItem failed. Error: [%s]", err)
 	}
@@ -269,14 +356,14 @@ func (b *Backend) batchFetchTaskStates(taskUUIDs []string) ([]*tasks.TaskState,
 	}
 
 	states := []*tasks.TaskState{}
-	if err := dynamodbattribute.UnmarshalListOfMaps(fetchedKeys, &states); err != nil {
+	if err := attributevalue.UnmarshalListOfMaps(fetchedKeys, &states); err != nil {
 		return nil, nil, fmt.Errorf("Got error when unmarshal map. Error: %v", err)
 	}
 
 	// Look for any unprocessed keys
 	var unfetchedKeys []string
-	if result.UnprocessedKeys[tableName] != nil {
-		unfetchedKeys, err = getUnfetchedKeys(result.UnprocessedKeys[tableName])
+	if unprocessed, ok := result.UnprocessedKeys[tableName]; ok {
+		unfetchedKeys, err = getUnfetchedKeys(unprocessed)
 		if err != nil {
 			return nil, nil, fmt.Errorf("unable to fetch some keys: [%+v]. Error: [%s]", result.UnprocessedKeys, err)
 		}
@@ -288,14 +375,12 @@ func (b *Backend) batchFetchTaskStates(taskUUIDs []string) ([]*tasks.TaskState,
 // PurgeState ...
 func (b *Backend) PurgeState(taskUUID string) error {
 	input := &dynamodb.DeleteItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"TaskUUID": {
-				N: aws.String(taskUUID),
-			},
+		Key: map[string]types.AttributeValue{
+			"TaskUUID": &types.AttributeValueMemberN{Value: taskUUID},
 		},
 		TableName: aws.String(b.cnf.DynamoDB.TaskStatesTable),
 	}
-	_, err := b.client.DeleteItem(input)
+	_, err := b.client.DeleteItem(context.Background(), input)
 
 	if err != nil {
 		return err
@@ -303,17 +388,21 @@ func (b *Backend) PurgeState(taskUUID string) error {
 	return nil
 }
 
+// HealthCheck checks the tables can be listed
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	_, err := b.client.ListTables(ctx, &dynamodb.ListTablesInput{Limit: aws.Int32(1)})
+	return err
+}
+
 // PurgeGroupMeta ...
 func (b *Backend) PurgeGroupMeta(groupUUID string) error {
 	input := &dynamodb.DeleteItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"GroupUUID": {
-				N: aws.String(groupUUID),
-			},
+		Key: map[string]types.AttributeValue{
+			"GroupUUID": &types.AttributeValueMemberN{Value: groupUUID},
 		},
 		TableName: aws.String(b.cnf.DynamoDB.GroupMetasTable),
 	}
-	_, err := b.client.DeleteItem(input)
+	_, err := b.client.DeleteItem(context.Background(), input)
 
 	if err != nil {
 		return err
@@ -321,13 +410,71 @@ func (b *Backend) PurgeGroupMeta(groupUUID string) error {
 	return nil
 }
 
+// CollectGarbage deletes items whose TTL passed, DynamoDB deletes them itself
+// only within a few days and they are read until then. Group metas created by
+// locking a group which does not exist have no TTL and are deleted as well.
+func (b *Backend) CollectGarbage(ctx context.Context) (int, error) {
+	purged, err := b.deleteExpired(ctx, b.cnf.DynamoDB.TaskStatesTable, "TaskUUID", "#T < :now")
+	if err != nil {
+		return purged, err
+	}
+
+	n, err := b.deleteExpired(ctx, b.cnf.DynamoDB.GroupMetasTable, "GroupUUID", "#T < :now OR attribute_not_exists(TaskUUIDs)")
+	return purged + n, err
+}
+
+// deleteExpired scans the table for items matching the condition and deletes
+// them unless they were updated in the meantime
+func (b *Backend) deleteExpired(ctx context.Context, tableName, key, condition string) (int, error) {
+	names := map[string]string{"#T": TTLAttribute, "#K": key}
+	values := map[string]types.AttributeValue{
+		":now": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", time.Now().Unix())},
+	}
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		FilterExpression:          aws.String(condition),
+		ProjectionExpression:      aws.String("#K"),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	}
+
+	purged := 0
+	for {
+		output, err := b.client.Scan(ctx, input)
+		if err != nil {
+			return purged, err
+		}
+
+		for _, item := range output.Items {
+			_, err := b.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+				TableName:                 aws.String(tableName),
+				Key:                       map[string]types.AttributeValue{key: item[key]},
+				ConditionExpression:       aws.String(condition),
+				ExpressionAttributeNames:  map[string]string{"#T": TTLAttribute},
+				ExpressionAttributeValues: values,
+			})
+			var conditionFailed *types.ConditionalCheckFailedException
+			if errors.As(err, &conditionFailed) {
+				continue
+			}
+			if err != nil {
+				return purged, err
+			}
+			purged++
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return purged, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
+	}
+}
+
 func (b *Backend) getGroupMeta(groupUUID string) (*tasks.GroupMeta, error) {
-	result, err := b.client.GetItem(&dynamodb.GetItemInput{
+	result, err := b.client.GetItem(context.Background(), &dynamodb.GetItemInput{
 		TableName: aws.String(b.cnf.DynamoDB.GroupMetasTable),
-		Key: map[string]*dynamodb.AttributeValue{
-			"GroupUUID": {
-				S: aws.String(groupUUID),
-			},
+		Key: map[string]types.AttributeValue{
+			"GroupUUID": &types.AttributeValueMemberS{Value: groupUUID},
 		},
 		ConsistentRead: aws.Bool(true),
 	})
@@ -361,25 +508,21 @@ func (b *Backend) unlockGroupMeta(groupUUID string) error {
 
 func (b *Backend) updateGroupMetaLock(groupUUID string, status bool) error {
 	input := &dynamodb.UpdateItemInput{
-		ExpressionAttributeNames: map[string]*string{
-			"#L": aws.String("Lock"),
+		ExpressionAttributeNames: map[string]string{
+			"#L": "Lock",
 		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":l": {
-				BOOL: aws.Bool(status),
-			},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":l": &types.AttributeValueMemberBOOL{Value: status},
 		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"GroupUUID": {
-				S: aws.String(groupUUID),
-			},
+		Key: map[string]types.AttributeValue{
+			"GroupUUID": &types.AttributeValueMemberS{Value: groupUUID},
 		},
-		ReturnValues:     aws.String("UPDATED_NEW"),
+		ReturnValues:     types.ReturnValueUpdatedNew,
 		TableName:        aws.String(b.cnf.DynamoDB.GroupMetasTable),
 		UpdateExpression: aws.String("SET #L = :l"),
 	}
 
-	_, err := b.client.UpdateItem(input)
+	_, err := b.client.UpdateItem(context.Background(), input)
 
 	if err != nil {
 		return err
@@ -389,25 +532,21 @@ func (b *Backend) updateGroupMetaLock(groupUUID string, status bool) error {
 
 func (b *Backend) chordTriggered(groupUUID string) error {
 	input := &dynamodb.UpdateItemInput{
-		ExpressionAttributeNames: map[string]*string{
-			"#CT": aws.String("ChordTriggered"),
+		ExpressionAttributeNames: map[string]string{
+			"#CT": "ChordTriggered",
 		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":ct": {
-				BOOL: aws.Bool(true),
-			},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":ct": &types.AttributeValueMemberBOOL{Value: true},
 		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"GroupUUID": {
-				S: aws.String(groupUUID),
-			},
+		Key: map[string]types.AttributeValue{
+			"GroupUUID": &types.AttributeValueMemberS{Value: groupUUID},
 		},
-		ReturnValues:     aws.String("UPDATED_NEW"),
+		ReturnValues:     types.ReturnValueUpdatedNew,
 		TableName:        aws.String(b.cnf.DynamoDB.GroupMetasTable),
 		UpdateExpression: aws.String("SET #CT = :ct"),
 	}
 
-	_, err := b.client.UpdateItem(input)
+	_, err := b.client.UpdateItem(context.Background(), input)
 
 	if err != nil {
 		return err
@@ -416,53 +555,41 @@ func (b *Backend) chordTriggered(groupUUID string) error {
 }
 
 func (b *Backend) setTaskState(taskState *tasks.TaskState) error {
-	expAttributeNames := map[string]*string{
-		"#S": aws.String("State"),
+	expAttributeNames := map[string]string{
+		"#S": "State",
 	}
-	expAttributeValues := map[string]*dynamodb.AttributeValue{
-		":s": {
-			S: aws.String(taskState.State),
-		},
+	expAttributeValues := map[string]types.AttributeValue{
+		":s": &types.AttributeValueMemberS{Value: taskState.State},
 	}
-	keyAttributeValues := map[string]*dynamodb.AttributeValue{
-		"TaskUUID": {
-			S: aws.String(taskState.TaskUUID),
-		},
+	keyAttributeValues := map[string]types.AttributeValue{
+		"TaskUUID": &types.AttributeValueMemberS{Value: taskState.TaskUUID},
 	}
 	exp := "SET #S = :s"
 	if !taskState.CreatedAt.IsZero() {
-		expAttributeNames["#C"] = aws.String("CreatedAt")
-		expAttributeValues[":c"] = &dynamodb.AttributeValue{
-			S: aws.String(taskState.CreatedAt.String()),
-		}
+		expAttributeNames["#C"] = "CreatedAt"
+		expAttributeValues[":c"] = &types.AttributeValueMemberS{Value: taskState.CreatedAt.String()}
 		exp += ", #C = :c"
 	}
 	if taskState.TTL > 0 {
-		expAttributeNames["#T"] = aws.String("TTL")
-		expAttributeValues[":t"] = &dynamodb.AttributeValue{
-			N: aws.String(fmt.Sprintf("%d", taskState.TTL)),
-		}
+		expAttributeNames["#T"] = "TTL"
+		expAttributeValues[":t"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", taskState.TTL)}
 		exp += ", #T = :t"
 	}
 	if taskState.Results != nil && len(taskState.Results) != 0 {
-		expAttributeNames["#R"] = aws.String("Results")
-		var results []*dynamodb.AttributeValue
+		expAttributeNames["#R"] = "Results"
+		var results []types.AttributeValue
 		for _, r := range taskState.Results {
-			avMap := map[string]*dynamodb.AttributeValue{
-				"Type": {
-					S: aws.String(r.Type),
-				},
-				"Value": {
-					S: aws.String(fmt.Sprintf("%v", r.Value)),
-				},
+			avMap := map[string]types.AttributeValue{
+				"Type":  &types.AttributeValueMemberS{Value: r.Type},
+				"Value": &types.AttributeValueMemberS{Value: fmt.Sprintf("%v", r.Value)},
 			}
-			rs := &dynamodb.AttributeValue{
-				M: avMap,
+			rs := &types.AttributeValueMemberM{
+				Value: avMap,
 			}
 			results = append(results, rs)
 		}
-		expAttributeValues[":r"] = &dynamodb.AttributeValue{
-			L: results,
+		expAttributeValues[":r"] = &types.AttributeValueMemberL{
+			Value: results,
 		}
 		exp += ", #R = :r"
 	}
@@ -470,12 +597,12 @@ func (b *Backend) setTaskState(taskState *tasks.TaskState) error {
 		ExpressionAttributeNames:  expAttributeNames,
 		ExpressionAttributeValues: expAttributeValues,
 		Key:                       keyAttributeValues,
-		ReturnValues:              aws.String("UPDATED_NEW"),
+		ReturnValues:              types.ReturnValueUpdatedNew,
 		TableName:                 aws.String(b.cnf.DynamoDB.TaskStatesTable),
 		UpdateExpression:          aws.String(exp),
 	}
 
-	_, err := b.client.UpdateItem(input)
+	_, err := b.client.UpdateItem(context.Background(), input)
 
 	if err != nil {
 		return err
@@ -483,8 +610,8 @@ func (b *Backend) setTaskState(taskState *tasks.TaskState) error {
 	return nil
 }
 
-func (b *Backend) initTaskState(taskState *tasks.TaskState) error {
-	av, err := dynamodbattribute.MarshalMap(taskState)
+func (b *Backend) initTaskState(taskState *tasks.TaskState, groupUUID string) error {
+	av, err := attributevalue.MarshalMap(taskState)
 	input := &dynamodb.PutItemInput{
 		Item:      av,
 		TableName: aws.String(b.cnf.DynamoDB.TaskStatesTable),
@@ -492,7 +619,11 @@ func (b *Backend) initTaskState(taskState *tasks.TaskState) error {
 	if err != nil {
 		return err
 	}
-	_, err = b.client.PutItem(input)
+	// The group UUID is the key of the group index, key attributes cannot be empty
+	if groupUUID != "" {
+		av["GroupUUID"] = &types.AttributeValueMemberS{Value: groupUUID}
+	}
+	_, err = b.client.PutItem(context.Background(), input)
 
 	if err != nil {
 		return err
@@ -502,37 +633,29 @@ func (b *Backend) initTaskState(taskState *tasks.TaskState) error {
 
 func (b *Backend) updateToFailureStateWithError(taskState *tasks.TaskState) error {
 	input := &dynamodb.UpdateItemInput{
-		ExpressionAttributeNames: map[string]*string{
-			"#S": aws.String("State"),
-			"#E": aws.String("Error"),
+		ExpressionAttributeNames: map[string]string{
+			"#S": "State",
+			"#E": "Error",
 		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":s": {
-				S: aws.String(taskState.State),
-			},
-			":e": {
-				S: aws.String(taskState.Error),
-			},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s": &types.AttributeValueMemberS{Value: taskState.State},
+			":e": &types.AttributeValueMemberS{Value: taskState.Error},
 		},
-		Key: map[string]*dynamodb.AttributeValue{
-			"TaskUUID": {
-				S: aws.String(taskState.TaskUUID),
-			},
+		Key: map[string]types.AttributeValue{
+			"TaskUUID": &types.AttributeValueMemberS{Value: taskState.TaskUUID},
 		},
-		ReturnValues:     aws.String("UPDATED_NEW"),
+		ReturnValues:     types.ReturnValueUpdatedNew,
 		TableName:        aws.String(b.cnf.DynamoDB.TaskStatesTable),
 		UpdateExpression: aws.String("SET #S = :s, #E = :e"),
 	}
 
 	if taskState.TTL > 0 {
-		input.ExpressionAttributeNames["#T"] = aws.String("TTL")
-		input.ExpressionAttributeValues[":t"] = &dynamodb.AttributeValue{
-			N: aws.String(fmt.Sprintf("%d", taskState.TTL)),
-		}
-		input.UpdateExpression = aws.String(aws.StringValue(input.UpdateExpression) + ", #T = :t")
+		input.ExpressionAttributeNames["#T"] = "TTL"
+		input.ExpressionAttributeValues[":t"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", taskState.TTL)}
+		input.UpdateExpression = aws.String(aws.ToString(input.UpdateExpression) + ", #T = :t")
 	}
 
-	_, err := b.client.UpdateItem(input)
+	_, err := b.client.UpdateItem(context.Background(), input)
 
 	if err != nil {
 		return err
@@ -547,7 +670,7 @@ func (b *Backend) unmarshalGroupMetaGetItemResult(result *dynamodb.GetItemOutput
 		return nil, err
 	}
 	item := tasks.GroupMeta{}
-	err := dynamodbattribute.UnmarshalMap(result.Item, &item)
+	err := attributevalue.UnmarshalMap(result.Item, &item)
 	if err != nil {
 		log.ERROR.Printf("Got error when unmarshal map. Error: %v", err)
 		return nil, err
@@ -562,7 +685,7 @@ func (b *Backend) unmarshalTaskStateGetItemResult(result *dynamodb.GetItemOutput
 		return nil, err
 	}
 	state := tasks.TaskState{}
-	err := dynamodbattribute.UnmarshalMap(result.Item, &state)
+	err := attributevalue.UnmarshalMap(result.Item, &state)
 	if err != nil {
 		log.ERROR.Printf("Got error when unmarshal map. Error: %v", err)
 		return nil, err
@@ -575,7 +698,7 @@ func (b *Backend) checkRequiredTablesIfExist() error {
 		taskTableName  = b.cnf.DynamoDB.TaskStatesTable
 		groupTableName = b.cnf.DynamoDB.GroupMetasTable
 	)
-	result, err := b.client.ListTables(&dynamodb.ListTablesInput{})
+	result, err := b.client.ListTables(context.Background(), &dynamodb.ListTablesInput{})
 	if err != nil {
 		return err
 	}
@@ -588,9 +711,112 @@ func (b *Backend) checkRequiredTablesIfExist() error {
 	return nil
 }
 
-func (b *Backend) tableExists(tableName string, tableNames []*string) bool {
+// createTables creates the tables which do not exist and enables their TTL attribute
+func (b *Backend) createTables() error {
+	result, err := b.client.ListTables(context.Background(), &dynamodb.ListTablesInput{})
+	if err != nil {
+		return err
+	}
+
+	taskTable := b.newCreateTableInput(b.cnf.DynamoDB.TaskStatesTable, "TaskUUID")
+	if b.cnf.DynamoDB.GroupIndex != "" {
+		taskTable.AttributeDefinitions = append(taskTable.AttributeDefinitions, types.AttributeDefinition{
+			AttributeName: aws.String("GroupUUID"),
+			AttributeType: types.ScalarAttributeTypeS,
+		})
+		taskTable.GlobalSecondaryIndexes = []types.GlobalSecondaryIndex{{
+			IndexName: aws.String(b.cnf.DynamoDB.GroupIndex),
+			KeySchema: []types.KeySchemaElement{{
+				AttributeName: aws.String("GroupUUID"),
+				KeyType:       types.KeyTypeHash,
+			}},
+			Projection:            &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			ProvisionedThroughput: taskTable.ProvisionedThroughput,
+		}}
+	}
+	groupTable := b.newCreateTableInput(b.cnf.DynamoDB.GroupMetasTable, "GroupUUID")
+
+	for _, input := range []*dynamodb.CreateTableInput{taskTable, groupTable} {
+		if !b.tableExists(*input.TableName, result.TableNames) {
+			if err := b.createTable(input); err != nil {
+				return err
+			}
+		}
+		if err := b.enableTTL(*input.TableName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newCreateTableInput returns the input creating a table with a string hash key,
+// with on-demand billing unless capacity units are configured
+func (b *Backend) newCreateTableInput(tableName, key string) *dynamodb.CreateTableInput {
+	input := &dynamodb.CreateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: []types.AttributeDefinition{{
+			AttributeName: aws.String(key),
+			AttributeType: types.ScalarAttributeTypeS,
+		}},
+		KeySchema: []types.KeySchemaElement{{
+			AttributeName: aws.String(key),
+			KeyType:       types.KeyTypeHash,
+		}},
+		BillingMode: types.BillingModePayPerRequest,
+	}
+
+	if b.cnf.DynamoDB.ReadCapacityUnits > 0 || b.cnf.DynamoDB.WriteCapacityUnits > 0 {
+		input.BillingMode = types.BillingModeProvisioned
+		input.ProvisionedThroughput = &types.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(b.cnf.DynamoDB.ReadCapacityUnits),
+			WriteCapacityUnits: aws.Int64(b.cnf.DynamoDB.WriteCapacityUnits),
+		}
+	}
+	return input
+}
+
+// createTable creates a table and waits until it is active
+func (b *Backend) createTable(input *dynamodb.CreateTableInput) error {
+	log.INFO.Printf("Creating DynamoDB table %s", *input.TableName)
+	if _, err := b.client.CreateTable(context.Background(), input); err != nil {
+		return fmt.Errorf("Create table %s error: %v", *input.TableName, err)
+	}
+
+	waiter := dynamodb.NewTableExistsWaiter(b.client)
+	return waiter.Wait(context.Background(), &dynamodb.DescribeTableInput{TableName: input.TableName}, tableCreationTimeout)
+}
+
+// enableTTL makes DynamoDB delete items once the time in their TTL attribute passed
+func (b *Backend) enableTTL(tableName string) error {
+	result, err := b.client.DescribeTimeToLive(context.Background(), &dynamodb.DescribeTimeToLiveInput{
+		TableName: aws.String(tableName),
+	})
+	if err != nil {
+		return err
+	}
+	if description := result.TimeToLiveDescription; description != nil {
+		switch description.TimeToLiveStatus {
+		case types.TimeToLiveStatusEnabled, types.TimeToLiveStatusEnabling:
+			return nil
+		}
+	}
+
+	_, err = b.client.UpdateTimeToLive(context.Background(), &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(TTLAttribute),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("Enable TTL of table %s error: %v", tableName, err)
+	}
+	return nil
+}
+
+func (b *Backend) tableExists(tableName string, tableNames []string) bool {
 	for _, t := range tableNames {
-		if tableName == *t {
+		if tableName == t {
 			return true
 		}
 	}
@@ -607,10 +833,10 @@ func (b *Backend) getExpirationTime() int64 {
 }
 
 // getUnfetchedKeys returns keys that were not fetched in a batch request.
-func getUnfetchedKeys(unprocessed *dynamodb.KeysAndAttributes) ([]string, error) {
+func getUnfetchedKeys(unprocessed types.KeysAndAttributes) ([]string, error) {
 	states := []*tasks.TaskState{}
 	var taskIDs []string
-	if err := dynamodbattribute.UnmarshalListOfMaps(unprocessed.Keys, &states); err != nil {
+	if err := attributevalue.UnmarshalListOfMaps(unprocessed.Keys, &states); err != nil {
 		return nil, fmt.Errorf("Got error when unmarshal map. Error: %v", err)
 	}
 	for _, s := range states {
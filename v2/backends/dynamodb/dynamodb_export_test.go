@@ -1,30 +1,31 @@
 package dynamodb
 
 import (
+	"context"
 	"errors"
 	"os"
 
+	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/tasks"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 var (
 	TestDynamoDBBackend    *Backend
 	TestErrDynamoDBBackend *Backend
 	TestCnf                *config.Config
-	TestDBClient           dynamodbiface.DynamoDBAPI
-	TestErrDBClient        dynamodbiface.DynamoDBAPI
+	TestDBClient           API
+	TestErrDBClient        API
 	TestGroupMeta          *tasks.GroupMeta
-	TestTask1              map[string]*dynamodb.AttributeValue
-	TestTask2              map[string]*dynamodb.AttributeValue
-	TestTask3              map[string]*dynamodb.AttributeValue
+	TestTask1              map[string]types.AttributeValue
+	TestTask2              map[string]types.AttributeValue
+	TestTask3              map[string]types.AttributeValue
 )
 
 type TestDynamoDBClient struct {
-	dynamodbiface.DynamoDBAPI
+	API
 	PutItemOverride      func(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
 	UpdateItemOverride   func(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error)
 	GetItemOverride      func(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
@@ -37,20 +38,20 @@ func (t *TestDynamoDBClient) ResetOverrides() {
 	t.BatchGetItemOverride = nil
 }
 
-func (t *TestDynamoDBClient) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+func (t *TestDynamoDBClient) PutItem(_ context.Context, input *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 	if t.PutItemOverride != nil {
 		return t.PutItemOverride(input)
 	}
 	return &dynamodb.PutItemOutput{}, nil
 }
-func (t *TestDynamoDBClient) BatchGetItem(input *dynamodb.BatchGetItemInput) (*dynamodb.BatchGetItemOutput, error) {
+func (t *TestDynamoDBClient) BatchGetItem(_ context.Context, input *dynamodb.BatchGetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
 	if t.BatchGetItemOverride != nil {
 		return t.BatchGetItemOverride(input)
 	}
 	return &dynamodb.BatchGetItemOutput{}, nil
 }
 
-func (t *TestDynamoDBClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+func (t *TestDynamoDBClient) GetItem(_ context.Context, input *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 	if t.GetItemOverride != nil {
 		return t.GetItemOverride(input)
 	}
@@ -58,60 +59,40 @@ func (t *TestDynamoDBClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.Ge
 	switch *input.TableName {
 	case "group_metas":
 		output = &dynamodb.GetItemOutput{
-			Item: map[string]*dynamodb.AttributeValue{
-				"TaskUUIDs": {
-					L: []*dynamodb.AttributeValue{
-						{
-							S: aws.String("testTaskUUID1"),
-						},
-						{
-							S: aws.String("testTaskUUID2"),
-						},
-						{
-							S: aws.String("testTaskUUID3"),
-						},
-					},
+			Item: map[string]types.AttributeValue{
+				"TaskUUIDs": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+					&types.AttributeValueMemberS{Value: "testTaskUUID1"},
+					&types.AttributeValueMemberS{Value: "testTaskUUID2"},
+					&types.AttributeValueMemberS{Value: "testTaskUUID3"},
 				},
-				"ChordTriggered": {
-					BOOL: aws.Bool(false),
-				},
-				"GroupUUID": {
-					S: aws.String("testGroupUUID"),
-				},
-				"Lock": {
-					BOOL: aws.Bool(false),
 				},
+				"ChordTriggered": &types.AttributeValueMemberBOOL{Value: false},
+				"GroupUUID":      &types.AttributeValueMemberS{Value: "testGroupUUID"},
+				"Lock":           &types.AttributeValueMemberBOOL{Value: false},
 			},
 		}
 	case "task_states":
-		if input.Key["TaskUUID"] == nil {
+		if _, ok := input.Key["TaskUUID"]; !ok {
 			output = &dynamodb.GetItemOutput{
-				Item: map[string]*dynamodb.AttributeValue{
-					"Error": {
-						NULL: aws.Bool(false),
-					},
-					"State": {
-						S: aws.String(tasks.StatePending),
-					},
-					"TaskUUID": {
-						S: aws.String("testTaskUUID1"),
-					},
-					"Results:": {
-						NULL: aws.Bool(true),
-					},
+				Item: map[string]types.AttributeValue{
+					"Error":    &types.AttributeValueMemberNULL{Value: false},
+					"State":    &types.AttributeValueMemberS{Value: tasks.StatePending},
+					"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID1"},
+					"Results:": &types.AttributeValueMemberNULL{Value: true},
 				},
 			}
 		} else {
-			if *(input.Key["TaskUUID"].S) == "testTaskUUID1" {
+			taskUUID := input.Key["TaskUUID"].(*types.AttributeValueMemberS).Value
+			if taskUUID == "testTaskUUID1" {
 				output = &dynamodb.GetItemOutput{
 					Item: TestTask1,
 				}
-			} else if *(input.Key["TaskUUID"].S) == "testTaskUUID2" {
+			} else if taskUUID == "testTaskUUID2" {
 				output = &dynamodb.GetItemOutput{
 					Item: TestTask2,
 				}
 
-			} else if *(input.Key["TaskUUID"].S) == "testTaskUUID3" {
+			} else if taskUUID == "testTaskUUID3" {
 				output = &dynamodb.GetItemOutput{
 					Item: TestTask3,
 				}
@@ -122,55 +103,111 @@ func (t *TestDynamoDBClient) GetItem(input *dynamodb.GetItemInput) (*dynamodb.Ge
 	return output, nil
 }
 
-func (t *TestDynamoDBClient) DeleteItem(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+func (t *TestDynamoDBClient) DeleteItem(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
 	return &dynamodb.DeleteItemOutput{}, nil
 }
 
-func (t *TestDynamoDBClient) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+func (t *TestDynamoDBClient) UpdateItem(_ context.Context, input *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 	if t.UpdateItemOverride != nil {
 		return t.UpdateItemOverride(input)
 	}
 	return &dynamodb.UpdateItemOutput{}, nil
 }
 
-func (t *TestDynamoDBClient) ListTables(*dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
+func (t *TestDynamoDBClient) ListTables(_ context.Context, _ *dynamodb.ListTablesInput, _ ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
 	return &dynamodb.ListTablesOutput{
-		TableNames: []*string{
-			aws.String("group_metas"),
-			aws.String("task_states"),
+		TableNames: []string{
+			"group_metas",
+			"task_states",
 		},
 	}, nil
 }
 
 // Always returns error
 type TestErrDynamoDBClient struct {
-	dynamodbiface.DynamoDBAPI
+	API
 }
 
-func (t *TestErrDynamoDBClient) PutItem(*dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+func (t *TestErrDynamoDBClient) PutItem(_ context.Context, _ *dynamodb.PutItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
 	return nil, errors.New("error when putting an item")
 }
 
-func (t *TestErrDynamoDBClient) GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+func (t *TestErrDynamoDBClient) GetItem(_ context.Context, _ *dynamodb.GetItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
 	return nil, errors.New("error when getting an item")
 }
 
-func (t *TestErrDynamoDBClient) DeleteItem(*dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+func (t *TestErrDynamoDBClient) DeleteItem(_ context.Context, _ *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
 	return nil, errors.New("error when deleting an item")
 }
 
-func (t *TestErrDynamoDBClient) Scan(*dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+func (t *TestErrDynamoDBClient) Scan(_ context.Context, _ *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
 	return nil, errors.New("error when scanning an item")
 }
 
-func (t *TestErrDynamoDBClient) UpdateItem(*dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+func (t *TestErrDynamoDBClient) UpdateItem(_ context.Context, _ *dynamodb.UpdateItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
 	return nil, errors.New("error when updating an item")
 }
 
-func (t *TestErrDynamoDBClient) ListTables(*dynamodb.ListTablesInput) (*dynamodb.ListTablesOutput, error) {
+func (t *TestErrDynamoDBClient) ListTables(_ context.Context, _ *dynamodb.ListTablesInput, _ ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
 	return nil, errors.New("error when listing tables")
 }
 
+// Records the calls creating tables, tables in Tables exist already
+type TestProvisioningDynamoDBClient struct {
+	API
+	Tables                 []string
+	CreateTableInputs      []*dynamodb.CreateTableInput
+	UpdateTimeToLiveInputs []*dynamodb.UpdateTimeToLiveInput
+	QueryItems             []map[string]types.AttributeValue
+	ScanItems              map[string][]map[string]types.AttributeValue
+	DeleteItemInputs       []*dynamodb.DeleteItemInput
+}
+
+func (t *TestProvisioningDynamoDBClient) ListTables(_ context.Context, _ *dynamodb.ListTablesInput, _ ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
+	return &dynamodb.ListTablesOutput{TableNames: t.Tables}, nil
+}
+
+func (t *TestProvisioningDynamoDBClient) CreateTable(_ context.Context, input *dynamodb.CreateTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	t.CreateTableInputs = append(t.CreateTableInputs, input)
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (t *TestProvisioningDynamoDBClient) DescribeTable(_ context.Context, input *dynamodb.DescribeTableInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTableOutput, error) {
+	return &dynamodb.DescribeTableOutput{
+		Table: &types.TableDescription{TableName: input.TableName, TableStatus: types.TableStatusActive},
+	}, nil
+}
+
+func (t *TestProvisioningDynamoDBClient) DescribeTimeToLive(_ context.Context, input *dynamodb.DescribeTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	status := types.TimeToLiveStatusDisabled
+	for _, updated := range t.UpdateTimeToLiveInputs {
+		if *updated.TableName == *input.TableName {
+			status = types.TimeToLiveStatusEnabled
+		}
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{
+		TimeToLiveDescription: &types.TimeToLiveDescription{TimeToLiveStatus: status},
+	}, nil
+}
+
+func (t *TestProvisioningDynamoDBClient) UpdateTimeToLive(_ context.Context, input *dynamodb.UpdateTimeToLiveInput, _ ...func(*dynamodb.Options)) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	t.UpdateTimeToLiveInputs = append(t.UpdateTimeToLiveInputs, input)
+	return &dynamodb.UpdateTimeToLiveOutput{}, nil
+}
+
+func (t *TestProvisioningDynamoDBClient) Query(_ context.Context, _ *dynamodb.QueryInput, _ ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return &dynamodb.QueryOutput{Items: t.QueryItems}, nil
+}
+
+func (t *TestProvisioningDynamoDBClient) Scan(_ context.Context, input *dynamodb.ScanInput, _ ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{Items: t.ScanItems[*input.TableName]}, nil
+}
+
+func (t *TestProvisioningDynamoDBClient) DeleteItem(_ context.Context, input *dynamodb.DeleteItemInput, _ ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	t.DeleteItemInputs = append(t.DeleteItemInputs, input)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
 func init() {
 	TestCnf = &config.Config{
 		ResultBackend:   os.Getenv("DYNAMODB_URL"),
@@ -196,7 +233,7 @@ func (b *Backend) GetConfig() *config.Config {
 	return b.cnf
 }
 
-func (b *Backend) GetClient() dynamodbiface.DynamoDBAPI {
+func (b *Backend) GetClient() API {
 	return b.client
 }
 
@@ -240,10 +277,18 @@ func (b *Backend) UpdateToFailureStateWithErrorForTest(taskState *tasks.TaskStat
 	return b.updateToFailureStateWithError(taskState)
 }
 
-func (b *Backend) TableExistsForTest(tableName string, tableNames []*string) bool {
+func (b *Backend) TableExistsForTest(tableName string, tableNames []string) bool {
 	return b.tableExists(tableName, tableNames)
 }
 
 func (b *Backend) CheckRequiredTablesIfExistForTest() error {
 	return b.checkRequiredTablesIfExist()
 }
+
+func NewBackendForTest(cnf *config.Config, client API) *Backend {
+	return &Backend{Backend: common.NewBackend(cnf), cnf: cnf, client: client}
+}
+
+func (b *Backend) CreateTablesForTest() error {
+	return b.createTables()
+}
@@ -1,18 +1,20 @@
 package dynamodb_test
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 	"testing"
 	"time"
 
 	"github.com/RichardKnop/machinery/v2/backends/dynamodb"
+	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
 	"github.com/RichardKnop/machinery/v2/tasks"
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/stretchr/testify/assert"
 
-	awsdynamodb "github.com/aws/aws-sdk-go/service/dynamodb"
+	awsdynamodb "github.com/aws/aws-sdk-go-v2/service/dynamodb"
 )
 
 func TestNew(t *testing.T) {
@@ -41,7 +43,7 @@ func TestInitGroup(t *testing.T) {
 		isPutItemCalled = true
 		assert.NotNil(t, input)
 
-		actualTTLStr := *input.Item["TTL"].N
+		actualTTLStr := input.Item["TTL"].(*types.AttributeValueMemberN).Value
 		expectedTTLTime := time.Now().Add(3 * time.Hour)
 		assertTTLValue(t, expectedTTLTime, actualTTLStr)
 
@@ -68,14 +70,14 @@ func TestGroupCompleted(t *testing.T) {
 	client.BatchGetItemOverride = func(input *awsdynamodb.BatchGetItemInput) (*awsdynamodb.BatchGetItemOutput, error) {
 		isBatchGetItemCalled = true
 		assert.NotNil(t, input)
-		assert.Nil(t, input.Validate())
+		assert.NotEmpty(t, input.RequestItems)
 
 		return &awsdynamodb.BatchGetItemOutput{
-			Responses: map[string][]map[string]*awsdynamodb.AttributeValue{
+			Responses: map[string][]map[string]types.AttributeValue{
 				tableName: {
-					{"State": {S: aws.String(tasks.StateSuccess)}},
-					{"State": {S: aws.String(tasks.StateSuccess)}},
-					{"State": {S: aws.String(tasks.StateFailure)}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateSuccess}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateSuccess}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateFailure}},
 				},
 			},
 		}, nil
@@ -105,11 +107,11 @@ func TestGroupCompletedReturnsFalse(t *testing.T) {
 	// Override DynamoDB BatchGetItem() behavior
 	client.BatchGetItemOverride = func(_ *awsdynamodb.BatchGetItemInput) (*awsdynamodb.BatchGetItemOutput, error) {
 		return &awsdynamodb.BatchGetItemOutput{
-			Responses: map[string][]map[string]*awsdynamodb.AttributeValue{
+			Responses: map[string][]map[string]types.AttributeValue{
 				tableName: {
-					{"State": {S: aws.String(tasks.StateSuccess)}},
-					{"State": {S: aws.String(tasks.StateFailure)}},
-					{"State": {S: aws.String(tasks.StatePending)}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateSuccess}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateFailure}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StatePending}},
 				},
 			},
 		}, nil
@@ -130,16 +132,16 @@ func TestGroupCompletedRetries(t *testing.T) {
 		countBatchGetItemAPICalls++
 
 		return &awsdynamodb.BatchGetItemOutput{
-			Responses: map[string][]map[string]*awsdynamodb.AttributeValue{
+			Responses: map[string][]map[string]types.AttributeValue{
 				tableName: {
-					{"State": {S: aws.String(tasks.StateSuccess)}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateSuccess}},
 				},
 			},
-			UnprocessedKeys: map[string]*awsdynamodb.KeysAndAttributes{
+			UnprocessedKeys: map[string]types.KeysAndAttributes{
 				tableName: {
-					Keys: []map[string]*awsdynamodb.AttributeValue{
-						{"TaskUUID": {S: aws.String("unfetchedTaskUUID1")}},
-						{"TaskUUID": {S: aws.String("unfetchedTaskUUID2")}},
+					Keys: []map[string]types.AttributeValue{
+						{"TaskUUID": &types.AttributeValueMemberS{Value: "unfetchedTaskUUID1"}},
+						{"TaskUUID": &types.AttributeValueMemberS{Value: "unfetchedTaskUUID2"}},
 					},
 				},
 			},
@@ -163,15 +165,15 @@ func TestGroupCompletedRetrieSuccess(t *testing.T) {
 		// simulate unfetched keys on 1st attempt.
 		if countBatchGetItemAPICalls == 1 {
 			return &awsdynamodb.BatchGetItemOutput{
-				Responses: map[string][]map[string]*awsdynamodb.AttributeValue{
+				Responses: map[string][]map[string]types.AttributeValue{
 					tableName: {}, // no keys returned in this attempt.
 				},
-				UnprocessedKeys: map[string]*awsdynamodb.KeysAndAttributes{
+				UnprocessedKeys: map[string]types.KeysAndAttributes{
 					tableName: {
-						Keys: []map[string]*awsdynamodb.AttributeValue{
-							{"TaskUUID": {S: aws.String("unfetchedTaskUUID1")}},
-							{"TaskUUID": {S: aws.String("unfetchedTaskUUID2")}},
-							{"TaskUUID": {S: aws.String("unfetchedTaskUUID3")}},
+						Keys: []map[string]types.AttributeValue{
+							{"TaskUUID": &types.AttributeValueMemberS{Value: "unfetchedTaskUUID1"}},
+							{"TaskUUID": &types.AttributeValueMemberS{Value: "unfetchedTaskUUID2"}},
+							{"TaskUUID": &types.AttributeValueMemberS{Value: "unfetchedTaskUUID3"}},
 						},
 					},
 				},
@@ -181,11 +183,11 @@ func TestGroupCompletedRetrieSuccess(t *testing.T) {
 
 		// Return all keys in subsequent attempts.
 		return &awsdynamodb.BatchGetItemOutput{
-			Responses: map[string][]map[string]*awsdynamodb.AttributeValue{
+			Responses: map[string][]map[string]types.AttributeValue{
 				tableName: {
-					{"State": {S: aws.String(tasks.StateSuccess)}},
-					{"State": {S: aws.String(tasks.StateSuccess)}},
-					{"State": {S: aws.String(tasks.StateSuccess)}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateSuccess}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateSuccess}},
+					{"State": &types.AttributeValueMemberS{Value: tasks.StateSuccess}},
 				},
 			},
 		}, nil
@@ -218,36 +220,20 @@ func TestPrivateFuncGetGroupMeta(t *testing.T) {
 
 func TestPrivateFuncUnmarshalTaskStateGetItemResult(t *testing.T) {
 	result := awsdynamodb.GetItemOutput{
-		Item: map[string]*awsdynamodb.AttributeValue{
-			"Error": {
-				NULL: aws.Bool(true),
-			},
-			"State": {
-				S: aws.String(tasks.StatePending),
-			},
-			"TaskUUID": {
-				S: aws.String("testTaskUUID1"),
-			},
-			"Results:": {
-				NULL: aws.Bool(true),
-			},
+		Item: map[string]types.AttributeValue{
+			"Error":    &types.AttributeValueMemberNULL{Value: true},
+			"State":    &types.AttributeValueMemberS{Value: tasks.StatePending},
+			"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID1"},
+			"Results:": &types.AttributeValueMemberNULL{Value: true},
 		},
 	}
 
 	invalidResult := awsdynamodb.GetItemOutput{
-		Item: map[string]*awsdynamodb.AttributeValue{
-			"Error": {
-				BOOL: aws.Bool(true),
-			},
-			"State": {
-				S: aws.String(tasks.StatePending),
-			},
-			"TaskUUID": {
-				S: aws.String("testTaskUUID1"),
-			},
-			"Results:": {
-				BOOL: aws.Bool(true),
-			},
+		Item: map[string]types.AttributeValue{
+			"Error":    &types.AttributeValueMemberBOOL{Value: true},
+			"State":    &types.AttributeValueMemberS{Value: tasks.StatePending},
+			"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID1"},
+			"Results:": &types.AttributeValueMemberBOOL{Value: true},
 		},
 	}
 
@@ -271,56 +257,30 @@ func TestPrivateFuncUnmarshalTaskStateGetItemResult(t *testing.T) {
 
 func TestPrivateFuncUnmarshalGroupMetaGetItemResult(t *testing.T) {
 	result := awsdynamodb.GetItemOutput{
-		Item: map[string]*awsdynamodb.AttributeValue{
-			"TaskUUIDs": {
-				L: []*awsdynamodb.AttributeValue{
-					{
-						S: aws.String("testTaskUUID1"),
-					},
-					{
-						S: aws.String("testTaskUUID2"),
-					},
-					{
-						S: aws.String("testTaskUUID3"),
-					},
-				},
-			},
-			"ChordTriggered": {
-				BOOL: aws.Bool(false),
+		Item: map[string]types.AttributeValue{
+			"TaskUUIDs": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+				&types.AttributeValueMemberS{Value: "testTaskUUID1"},
+				&types.AttributeValueMemberS{Value: "testTaskUUID2"},
+				&types.AttributeValueMemberS{Value: "testTaskUUID3"},
 			},
-			"GroupUUID": {
-				S: aws.String("testGroupUUID"),
-			},
-			"Lock": {
-				BOOL: aws.Bool(false),
 			},
+			"ChordTriggered": &types.AttributeValueMemberBOOL{Value: false},
+			"GroupUUID":      &types.AttributeValueMemberS{Value: "testGroupUUID"},
+			"Lock":           &types.AttributeValueMemberBOOL{Value: false},
 		},
 	}
 
 	invalidResult := awsdynamodb.GetItemOutput{
-		Item: map[string]*awsdynamodb.AttributeValue{
-			"TaskUUIDs": {
-				L: []*awsdynamodb.AttributeValue{
-					{
-						S: aws.String("testTaskUUID1"),
-					},
-					{
-						S: aws.String("testTaskUUID2"),
-					},
-					{
-						S: aws.String("testTaskUUID3"),
-					},
-				},
-			},
-			"ChordTriggered": {
-				S: aws.String("false"), // this attribute is invalid
+		Item: map[string]types.AttributeValue{
+			"TaskUUIDs": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+				&types.AttributeValueMemberS{Value: "testTaskUUID1"},
+				&types.AttributeValueMemberS{Value: "testTaskUUID2"},
+				&types.AttributeValueMemberS{Value: "testTaskUUID3"},
 			},
-			"GroupUUID": {
-				S: aws.String("testGroupUUID"),
-			},
-			"Lock": {
-				BOOL: aws.Bool(false),
 			},
+			"ChordTriggered": &types.AttributeValueMemberS{Value: "false"}, // this attribute is invalid
+			"GroupUUID":      &types.AttributeValueMemberS{Value: "testGroupUUID"},
+			"Lock":           &types.AttributeValueMemberBOOL{Value: false},
 		},
 	}
 
@@ -367,14 +327,14 @@ func verifyUpdateInput(t *testing.T, input *awsdynamodb.UpdateItemInput, expecte
 	assert.NotNil(t, input)
 
 	// verify task ID
-	assert.Equal(t, expectedTaskID, *input.Key["TaskUUID"].S)
+	assert.Equal(t, expectedTaskID, input.Key["TaskUUID"].(*types.AttributeValueMemberS).Value)
 
 	// verify task state
-	assert.Equal(t, expectedState, *input.ExpressionAttributeValues[":s"].S)
+	assert.Equal(t, expectedState, input.ExpressionAttributeValues[":s"].(*types.AttributeValueMemberS).Value)
 
 	// Verify TTL
 	if !expectedTTLTime.IsZero() {
-		actualTTLStr := *input.ExpressionAttributeValues[":t"].N
+		actualTTLStr := input.ExpressionAttributeValues[":t"].(*types.AttributeValueMemberN).Value
 		assertTTLValue(t, expectedTTLTime, actualTTLStr)
 	}
 }
@@ -500,27 +460,27 @@ func TestGroupTaskStates(t *testing.T) {
 	client := dynamodb.TestDynamoDBBackend.GetClient().(*dynamodb.TestDynamoDBClient)
 	tableName := dynamodb.TestDynamoDBBackend.GetConfig().DynamoDB.TaskStatesTable
 	client.BatchGetItemOverride = func(input *awsdynamodb.BatchGetItemInput) (*awsdynamodb.BatchGetItemOutput, error) {
-		assert.Nil(t, input.Validate())
+		assert.NotEmpty(t, input.RequestItems)
 		return &awsdynamodb.BatchGetItemOutput{
-			Responses: map[string][]map[string]*awsdynamodb.AttributeValue{
+			Responses: map[string][]map[string]types.AttributeValue{
 				tableName: {
 					{
-						"TaskUUID": {S: aws.String("testTaskUUID1")},
-						"Results:": {NULL: aws.Bool(true)},
-						"State":    {S: aws.String(tasks.StatePending)},
-						"Error":    {NULL: aws.Bool(true)},
+						"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID1"},
+						"Results:": &types.AttributeValueMemberNULL{Value: true},
+						"State":    &types.AttributeValueMemberS{Value: tasks.StatePending},
+						"Error":    &types.AttributeValueMemberNULL{Value: true},
 					},
 					{
-						"TaskUUID": {S: aws.String("testTaskUUID2")},
-						"Results:": {NULL: aws.Bool(true)},
-						"State":    {S: aws.String(tasks.StateStarted)},
-						"Error":    {NULL: aws.Bool(true)},
+						"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID2"},
+						"Results:": &types.AttributeValueMemberNULL{Value: true},
+						"State":    &types.AttributeValueMemberS{Value: tasks.StateStarted},
+						"Error":    &types.AttributeValueMemberNULL{Value: true},
 					},
 					{
-						"TaskUUID": {S: aws.String("testTaskUUID3")},
-						"Results:": {NULL: aws.Bool(true)},
-						"State":    {S: aws.String(tasks.StateSuccess)},
-						"Error":    {NULL: aws.Bool(true)},
+						"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID3"},
+						"Results:": &types.AttributeValueMemberNULL{Value: true},
+						"State":    &types.AttributeValueMemberS{Value: tasks.StateSuccess},
+						"Error":    &types.AttributeValueMemberNULL{Value: true},
 					},
 				},
 			},
@@ -553,11 +513,11 @@ func TestGetState(t *testing.T) {
 	client := dynamodb.TestDynamoDBBackend.GetClient().(*dynamodb.TestDynamoDBClient)
 	client.GetItemOverride = func(input *awsdynamodb.GetItemInput) (*awsdynamodb.GetItemOutput, error) {
 		return &awsdynamodb.GetItemOutput{
-			Item: map[string]*awsdynamodb.AttributeValue{
-				"TaskUUID": {S: aws.String("testTaskUUID1")},
-				"Results:": {NULL: aws.Bool(true)},
-				"State":    {S: aws.String(tasks.StatePending)},
-				"Error":    {NULL: aws.Bool(false)},
+			Item: map[string]types.AttributeValue{
+				"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID1"},
+				"Results:": &types.AttributeValueMemberNULL{Value: true},
+				"State":    &types.AttributeValueMemberS{Value: tasks.StatePending},
+				"Error":    &types.AttributeValueMemberNULL{Value: false},
 			},
 		}, nil
 	}
@@ -635,7 +595,7 @@ func TestPrivateFuncUpdateToFailureStateWithError(t *testing.T) {
 }
 
 func TestPrivateFuncTableExistsForTest(t *testing.T) {
-	tables := []*string{aws.String("foo")}
+	tables := []string{"foo"}
 	assert.False(t, dynamodb.TestDynamoDBBackend.TableExistsForTest("bar", tables))
 	assert.True(t, dynamodb.TestDynamoDBBackend.TableExistsForTest("foo", tables))
 }
@@ -656,3 +616,142 @@ func TestPrivateFuncCheckRequiredTablesIfExistForTest(t *testing.T) {
 	assert.NotNil(t, err)
 	dynamodb.TestDynamoDBBackend.GetConfig().DynamoDB.GroupMetasTable = groupTable
 }
+
+func TestCreateTables(t *testing.T) {
+	cnf := &config.Config{
+		DynamoDB: &config.DynamoDBConfig{
+			TaskStatesTable: "task_states",
+			GroupMetasTable: "group_metas",
+			GroupIndex:      "group_index",
+		},
+	}
+	client := &dynamodb.TestProvisioningDynamoDBClient{Tables: []string{"group_metas"}}
+	backend := dynamodb.NewBackendForTest(cnf, client)
+
+	assert.NoError(t, backend.CreateTablesForTest())
+
+	// Only the missing table is created, with on-demand billing and the group index
+	if assert.Len(t, client.CreateTableInputs, 1) {
+		input := client.CreateTableInputs[0]
+		assert.Equal(t, "task_states", *input.TableName)
+		assert.Equal(t, types.BillingModePayPerRequest, input.BillingMode)
+		assert.Nil(t, input.ProvisionedThroughput)
+		if assert.Len(t, input.GlobalSecondaryIndexes, 1) {
+			assert.Equal(t, "group_index", *input.GlobalSecondaryIndexes[0].IndexName)
+			assert.Equal(t, "GroupUUID", *input.GlobalSecondaryIndexes[0].KeySchema[0].AttributeName)
+		}
+	}
+
+	// TTL is enabled on both tables
+	if assert.Len(t, client.UpdateTimeToLiveInputs, 2) {
+		for _, input := range client.UpdateTimeToLiveInputs {
+			assert.Equal(t, dynamodb.TTLAttribute, *input.TimeToLiveSpecification.AttributeName)
+			assert.True(t, *input.TimeToLiveSpecification.Enabled)
+		}
+	}
+
+	// Enabled TTL is left as it is
+	assert.NoError(t, backend.CreateTablesForTest())
+	assert.Len(t, client.UpdateTimeToLiveInputs, 2)
+}
+
+func TestCreateTablesProvisioned(t *testing.T) {
+	cnf := &config.Config{
+		DynamoDB: &config.DynamoDBConfig{
+			TaskStatesTable:    "task_states",
+			GroupMetasTable:    "group_metas",
+			ReadCapacityUnits:  5,
+			WriteCapacityUnits: 10,
+		},
+	}
+	client := new(dynamodb.TestProvisioningDynamoDBClient)
+	backend := dynamodb.NewBackendForTest(cnf, client)
+
+	assert.NoError(t, backend.CreateTablesForTest())
+	if assert.Len(t, client.CreateTableInputs, 2) {
+		for _, input := range client.CreateTableInputs {
+			assert.Equal(t, types.BillingModeProvisioned, input.BillingMode)
+			assert.Equal(t, int64(5), *input.ProvisionedThroughput.ReadCapacityUnits)
+			assert.Equal(t, int64(10), *input.ProvisionedThroughput.WriteCapacityUnits)
+			assert.Empty(t, input.GlobalSecondaryIndexes)
+		}
+	}
+}
+
+func TestQueryGroupTaskStates(t *testing.T) {
+	cnf := &config.Config{
+		DynamoDB: &config.DynamoDBConfig{TaskStatesTable: "task_states"},
+	}
+	client := &dynamodb.TestProvisioningDynamoDBClient{
+		QueryItems: []map[string]types.AttributeValue{
+			{
+				"TaskUUID":  &types.AttributeValueMemberS{Value: "testTaskUUID1"},
+				"GroupUUID": &types.AttributeValueMemberS{Value: "testGroupUUID"},
+				"State":     &types.AttributeValueMemberS{Value: tasks.StateSuccess},
+			},
+		},
+	}
+	backend := dynamodb.NewBackendForTest(cnf, client)
+
+	_, err := backend.QueryGroupTaskStates("testGroupUUID")
+	assert.Error(t, err)
+
+	cnf.DynamoDB.GroupIndex = "group_index"
+	states, err := backend.QueryGroupTaskStates("testGroupUUID")
+	if assert.NoError(t, err) && assert.Len(t, states, 1) {
+		assert.Equal(t, "testTaskUUID1", states[0].TaskUUID)
+		assert.Equal(t, tasks.StateSuccess, states[0].State)
+	}
+}
+
+func TestSetStatePendingGroupUUID(t *testing.T) {
+	client := dynamodb.TestDynamoDBBackend.GetClient().(*dynamodb.TestDynamoDBClient)
+	defer client.ResetOverrides()
+
+	var item map[string]types.AttributeValue
+	client.PutItemOverride = func(input *awsdynamodb.PutItemInput) (*awsdynamodb.PutItemOutput, error) {
+		item = input.Item
+		return &awsdynamodb.PutItemOutput{}, nil
+	}
+
+	signature := &tasks.Signature{UUID: "testTaskUUID", GroupUUID: "testGroupUUID"}
+	assert.NoError(t, dynamodb.TestDynamoDBBackend.SetStatePending(signature))
+	assert.Equal(t, &types.AttributeValueMemberS{Value: "testGroupUUID"}, item["GroupUUID"])
+
+	signature = &tasks.Signature{UUID: "testTaskUUID"}
+	assert.NoError(t, dynamodb.TestDynamoDBBackend.SetStatePending(signature))
+	assert.NotContains(t, item, "GroupUUID")
+}
+
+func TestCollectGarbage(t *testing.T) {
+	cnf := &config.Config{
+		DynamoDB: &config.DynamoDBConfig{
+			TaskStatesTable: "task_states",
+			GroupMetasTable: "group_metas",
+		},
+	}
+	client := &dynamodb.TestProvisioningDynamoDBClient{
+		ScanItems: map[string][]map[string]types.AttributeValue{
+			"task_states": {
+				{"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID1"}},
+				{"TaskUUID": &types.AttributeValueMemberS{Value: "testTaskUUID2"}},
+			},
+			"group_metas": {
+				{"GroupUUID": &types.AttributeValueMemberS{Value: "testGroupUUID"}},
+			},
+		},
+	}
+	backend := dynamodb.NewBackendForTest(cnf, client)
+
+	purged, err := backend.CollectGarbage(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, purged)
+
+	if assert.Len(t, client.DeleteItemInputs, 3) {
+		input := client.DeleteItemInputs[2]
+		assert.Equal(t, "group_metas", *input.TableName)
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "testGroupUUID"}, input.Key["GroupUUID"])
+		// Items updated since they were scanned are not deleted
+		assert.Contains(t, *input.ConditionExpression, "#T < :now")
+	}
+}
@@ -0,0 +1,187 @@
+package backends
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// EncryptedType is the type of the single result saved in place of encrypted
+// results, its value is the base64 encoded nonce and ciphertext
+const EncryptedType = "machinery_encrypted"
+
+// encryptedErrorPrefix prefixes encrypted errors of failed tasks
+const encryptedErrorPrefix = EncryptedType + ":"
+
+// ErrNoEncryptionKey is returned when ResultEncryptionKey is not configured
+var ErrNoEncryptionKey = errors.New("ResultEncryptionKey is not configured")
+
+// Encrypted wraps a backend and encrypts results and errors of tasks with
+// AES-GCM before they are stored, states read from the wrapped backend are
+// decrypted. Any backend can be wrapped since states keep their structure.
+type Encrypted struct {
+	iface.Backend
+	aead cipher.AEAD
+}
+
+// NewEncrypted creates Encrypted instance using the base64 encoded AES key of
+// the ResultEncryptionKey setting, 16, 24 or 32 bytes long
+func NewEncrypted(cnf *config.Config, backend iface.Backend) (*Encrypted, error) {
+	if cnf.ResultEncryptionKey == "" {
+		return nil, ErrNoEncryptionKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(cnf.ResultEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("Decode ResultEncryptionKey error: %s", err)
+	}
+	return NewEncryptedWithKey(backend, key)
+}
+
+// NewEncryptedWithKey creates Encrypted instance using the AES key, e.g. a data
+// key decrypted with a key management service for envelope encryption
+func NewEncryptedWithKey(backend iface.Backend, key []byte) (*Encrypted, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encrypted{Backend: backend, aead: aead}, nil
+}
+
+// SetStateSuccess updates task state to SUCCESS with encrypted results
+func (e *Encrypted) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	plaintext, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("Marshal task results error: %v", err)
+	}
+
+	ciphertext, err := e.encrypt(plaintext, signature.UUID)
+	if err != nil {
+		return err
+	}
+
+	encrypted := []*tasks.TaskResult{{Type: EncryptedType, Value: ciphertext}}
+	return e.Backend.SetStateSuccess(signature, encrypted)
+}
+
+// SetStateFailure updates task state to FAILURE with an encrypted error
+func (e *Encrypted) SetStateFailure(signature *tasks.Signature, err string) error {
+	ciphertext, encryptErr := e.encrypt([]byte(err), signature.UUID)
+	if encryptErr != nil {
+		return encryptErr
+	}
+
+	return e.Backend.SetStateFailure(signature, encryptedErrorPrefix+ciphertext)
+}
+
+// GroupTaskStates returns decrypted states of all tasks in the group
+func (e *Encrypted) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
+	states, err := e.Backend.GroupTaskStates(groupUUID, groupTaskCount)
+	if err != nil {
+		return states, err
+	}
+
+	for _, state := range states {
+		if err := e.decrypt(state); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// GetState returns the latest decrypted task state
+func (e *Encrypted) GetState(taskUUID string) (*tasks.TaskState, error) {
+	state, err := e.Backend.GetState(taskUUID)
+	if err != nil {
+		return state, err
+	}
+
+	if err := e.decrypt(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// Unwrap returns the wrapped backend
+func (e *Encrypted) Unwrap() iface.Backend {
+	return e.Backend
+}
+
+// encrypt returns the base64 encoded nonce and ciphertext, the task UUID is
+// authenticated so ciphertexts cannot be swapped between tasks
+func (e *Encrypted) encrypt(plaintext []byte, taskUUID string) (string, error) {
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := e.aead.Seal(nonce, nonce, plaintext, []byte(taskUUID))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt replaces encrypted results and errors of the state
+func (e *Encrypted) decrypt(state *tasks.TaskState) error {
+	if state == nil {
+		return nil
+	}
+
+	if len(state.Results) == 1 && state.Results[0].Type == EncryptedType {
+		ciphertext, ok := state.Results[0].Value.(string)
+		if !ok {
+			return fmt.Errorf("Invalid encrypted results of task %s", state.TaskUUID)
+		}
+
+		plaintext, err := e.open(ciphertext, state.TaskUUID)
+		if err != nil {
+			return err
+		}
+
+		var results []*tasks.TaskResult
+		decoder := json.NewDecoder(strings.NewReader(string(plaintext)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&results); err != nil {
+			return fmt.Errorf("Failed to unmarshal results of task %s: %v", state.TaskUUID, err)
+		}
+		state.Results = results
+	}
+
+	if strings.HasPrefix(state.Error, encryptedErrorPrefix) {
+		plaintext, err := e.open(strings.TrimPrefix(state.Error, encryptedErrorPrefix), state.TaskUUID)
+		if err != nil {
+			return err
+		}
+		state.Error = string(plaintext)
+	}
+
+	return nil
+}
+
+func (e *Encrypted) open(ciphertext, taskUUID string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < e.aead.NonceSize() {
+		return nil, fmt.Errorf("Invalid ciphertext of task %s", taskUUID)
+	}
+
+	nonce, sealed := sealed[:e.aead.NonceSize()], sealed[e.aead.NonceSize():]
+	plaintext, err := e.aead.Open(nil, nonce, sealed, []byte(taskUUID))
+	if err != nil {
+		return nil, fmt.Errorf("Decrypt state of task %s error: %v", taskUUID, err)
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,75 @@
+package backends_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestEncrypted(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{
+		ResultEncryptionKey: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef")),
+	}
+	wrapped := memory.New(cnf)
+	backend, err := backends.NewEncrypted(cnf, wrapped)
+	require.NoError(t, err)
+
+	succeeded := &tasks.Signature{UUID: "succeededTaskUUID", GroupUUID: "groupUUID"}
+	failed := &tasks.Signature{UUID: "failedTaskUUID", GroupUUID: "groupUUID"}
+	assert.NoError(t, backend.InitGroup("groupUUID", []string{succeeded.UUID, failed.UUID}))
+	assert.NoError(t, backend.SetStateSuccess(succeeded, []*tasks.TaskResult{{Type: "string", Value: "secret"}}))
+	assert.NoError(t, backend.SetStateFailure(failed, "secret error"))
+
+	// Nothing is stored in plaintext
+	state, err := wrapped.GetState(succeeded.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, backends.EncryptedType, state.Results[0].Type)
+		assert.NotContains(t, state.Results[0].Value, "secret")
+	}
+	state, err = wrapped.GetState(failed.UUID)
+	if assert.NoError(t, err) {
+		assert.NotContains(t, state.Error, "secret")
+	}
+
+	state, err = backend.GetState(succeeded.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "secret", state.Results[0].Value)
+	}
+
+	states, err := backend.GroupTaskStates("groupUUID", 2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "secret", states[0].Results[0].Value)
+		assert.Equal(t, "secret error", states[1].Error)
+	}
+
+	// A different key cannot decrypt the states
+	other, err := backends.NewEncryptedWithKey(wrapped, []byte(strings.Repeat("k", 32)))
+	require.NoError(t, err)
+	_, err = other.GetState(succeeded.UUID)
+	assert.Error(t, err)
+}
+
+func TestNewEncrypted(t *testing.T) {
+	t.Parallel()
+
+	wrapped := memory.New(new(config.Config))
+
+	_, err := backends.NewEncrypted(new(config.Config), wrapped)
+	assert.Equal(t, backends.ErrNoEncryptionKey, err)
+
+	_, err = backends.NewEncrypted(&config.Config{ResultEncryptionKey: "not base64"}, wrapped)
+	assert.Error(t, err)
+
+	_, err = backends.NewEncryptedWithKey(wrapped, []byte("short"))
+	assert.Error(t, err)
+}
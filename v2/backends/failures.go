@@ -0,0 +1,111 @@
+package backends
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrFailureHistoryNotSupported is returned when a backend does not record
+// the failed attempts of tasks
+var ErrFailureHistoryNotSupported = errors.New("Result backend does not record failure history")
+
+// ErrFailedTasksNotSupported is returned when a backend does not record the
+// tasks which failed
+var ErrFailedTasksNotSupported = errors.New("Result backend does not record failed tasks")
+
+// AppendFailure appends the failure to the failure history of the task in the
+// backend or the backends it wraps. Encrypted backends do not record failures,
+// they would be stored in plain text.
+func AppendFailure(backend iface.Backend, taskUUID string, failure *tasks.Failure) error {
+	recorders := failureRecorders(backend)
+	if len(recorders) == 0 {
+		return ErrFailureHistoryNotSupported
+	}
+
+	for _, recorder := range recorders {
+		if err := recorder.AppendFailure(taskUUID, failure); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Failures returns the failure history of the task, read from the first
+// backend recording it
+func Failures(backend iface.Backend, taskUUID string) ([]*tasks.Failure, error) {
+	recorders := failureRecorders(backend)
+	if len(recorders) == 0 {
+		return nil, ErrFailureHistoryNotSupported
+	}
+
+	return recorders[0].Failures(taskUUID)
+}
+
+// failureRecorders returns the backends recording failures, the backend
+// itself or the backends it wraps
+func failureRecorders(backend iface.Backend) []iface.FailureRecorder {
+	return plaintextImplementations[iface.FailureRecorder](backend)
+}
+
+// RecordFailedTask records the failed task in the backend or the backends it
+// wraps, encrypted backends do not record failed tasks
+func RecordFailedTask(backend iface.Backend, failed *tasks.FailedTask) error {
+	recorders := failedTaskRecorders(backend)
+	if len(recorders) == 0 {
+		return ErrFailedTasksNotSupported
+	}
+
+	for _, recorder := range recorders {
+		if err := recorder.RecordFailedTask(failed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FailedTask returns the failed task, nil if it has not been recorded, read
+// from the first backend recording failed tasks
+func FailedTask(backend iface.Backend, taskUUID string) (*tasks.FailedTask, error) {
+	recorders := failedTaskRecorders(backend)
+	if len(recorders) == 0 {
+		return nil, ErrFailedTasksNotSupported
+	}
+
+	return recorders[0].FailedTask(taskUUID)
+}
+
+// FailedTasks returns the tasks with the name which failed since the time, of
+// any name if it is empty, read from the first backend recording failed tasks
+func FailedTasks(backend iface.Backend, taskName string, since time.Time) ([]*tasks.FailedTask, error) {
+	recorders := failedTaskRecorders(backend)
+	if len(recorders) == 0 {
+		return nil, ErrFailedTasksNotSupported
+	}
+
+	return recorders[0].FailedTasks(taskName, since)
+}
+
+// RemoveFailedTask removes the failed task from the backend or the backends
+// it wraps
+func RemoveFailedTask(backend iface.Backend, taskUUID string) error {
+	recorders := failedTaskRecorders(backend)
+	if len(recorders) == 0 {
+		return ErrFailedTasksNotSupported
+	}
+
+	for _, recorder := range recorders {
+		if err := recorder.RemoveFailedTask(taskUUID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// failedTaskRecorders returns the backends recording failed tasks, the
+// backend itself or the backends it wraps
+func failedTaskRecorders(backend iface.Backend) []iface.FailedTaskRecorder {
+	return plaintextImplementations[iface.FailedTaskRecorder](backend)
+}
@@ -0,0 +1,84 @@
+package backends_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/null"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestFailures(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	backend := backends.NewTiered(backends.ReadFastest, memory.New(cnf), null.New())
+
+	startedAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	failures := []*tasks.Failure{
+		{Attempt: 1, Error: "timeout", ErrorType: "*url.Error", Hostname: "worker-1", StartedAt: startedAt, FailedAt: startedAt.Add(time.Second)},
+		{Attempt: 2, Error: "boom", ErrorType: "string", Stack: "goroutine 1 [running]:", Hostname: "worker-2", StartedAt: startedAt.Add(time.Minute), FailedAt: startedAt.Add(time.Minute)},
+	}
+	for _, failure := range failures {
+		require.NoError(t, backends.AppendFailure(backend, "taskUUID", failure))
+	}
+
+	history, err := backends.Failures(backend, "taskUUID")
+	if assert.NoError(t, err) {
+		assert.Equal(t, failures, history)
+	}
+
+	err = backends.AppendFailure(null.New(), "taskUUID", failures[0])
+	assert.Equal(t, backends.ErrFailureHistoryNotSupported, err)
+	_, err = backends.Failures(null.New(), "taskUUID")
+	assert.Equal(t, backends.ErrFailureHistoryNotSupported, err)
+}
+
+func TestFailedTasks(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	backend := backends.NewTiered(backends.ReadFastest, memory.New(cnf), null.New())
+
+	failedAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	failedTasks := []*tasks.FailedTask{
+		{Signature: &tasks.Signature{UUID: "taskUUID1", Name: "send_email"}, Error: "timeout", FailedAt: failedAt},
+		{Signature: &tasks.Signature{UUID: "taskUUID2", Name: "send_email"}, Error: "boom", FailedAt: failedAt.Add(time.Hour)},
+		{Signature: &tasks.Signature{UUID: "taskUUID3", Name: "resize_image"}, Error: "boom", FailedAt: failedAt.Add(time.Hour)},
+	}
+	for _, failed := range failedTasks {
+		require.NoError(t, backends.RecordFailedTask(backend, failed))
+	}
+
+	failed, err := backends.FailedTask(backend, "taskUUID1")
+	if assert.NoError(t, err) && assert.NotNil(t, failed) {
+		assert.Equal(t, "send_email", failed.Signature.Name)
+		assert.Equal(t, "timeout", failed.Error)
+		assert.Equal(t, failedAt, failed.FailedAt)
+	}
+
+	found, err := backends.FailedTasks(backend, "send_email", failedAt.Add(time.Minute))
+	if assert.NoError(t, err) && assert.Len(t, found, 1) {
+		assert.Equal(t, "taskUUID2", found[0].Signature.UUID)
+	}
+	found, err = backends.FailedTasks(backend, "", failedAt)
+	if assert.NoError(t, err) && assert.Len(t, found, 3) {
+		assert.Equal(t, "taskUUID1", found[0].Signature.UUID)
+	}
+
+	require.NoError(t, backends.RemoveFailedTask(backend, "taskUUID1"))
+	failed, err = backends.FailedTask(backend, "taskUUID1")
+	assert.NoError(t, err)
+	assert.Nil(t, failed)
+
+	err = backends.RecordFailedTask(null.New(), failedTasks[0])
+	assert.Equal(t, backends.ErrFailedTasksNotSupported, err)
+	_, err = backends.FailedTasks(null.New(), "", failedAt)
+	assert.Equal(t, backends.ErrFailedTasksNotSupported, err)
+}
@@ -0,0 +1,87 @@
+package backends
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/log"
+)
+
+// ErrGCNotSupported is returned when a backend does not collect garbage, its
+// database evicts expired results itself
+var ErrGCNotSupported = errors.New("Result backend does not collect garbage")
+
+// GC periodically purges expired task states and group metas of a backend
+// implementing GarbageCollector, for databases without native TTLs. Several
+// workers may run it at the same time.
+type GC struct {
+	backend  iface.Backend
+	interval time.Duration
+}
+
+// NewGC creates GC instance collecting garbage every interval
+func NewGC(backend iface.Backend, interval time.Duration) *GC {
+	return &GC{
+		backend:  backend,
+		interval: interval,
+	}
+}
+
+// Supported returns true if the backend collects garbage
+func (gc *GC) Supported() bool {
+	return len(collectors(gc.backend)) > 0
+}
+
+// Collect purges expired results once and returns how many were purged
+func (gc *GC) Collect(ctx context.Context) (int, error) {
+	collectors := collectors(gc.backend)
+	if len(collectors) == 0 {
+		return 0, ErrGCNotSupported
+	}
+
+	var (
+		purged   int
+		firstErr error
+	)
+	for _, collector := range collectors {
+		n, err := collector.CollectGarbage(ctx)
+		purged += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return purged, firstErr
+}
+
+// Run collects garbage every interval until ctx is done
+func (gc *GC) Run(ctx context.Context) {
+	if !gc.Supported() {
+		return
+	}
+
+	ticker := time.NewTicker(gc.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := gc.Collect(ctx)
+			if err != nil {
+				log.ERROR.Printf("Result backend garbage collection error: %s", err)
+			}
+			if purged > 0 {
+				log.INFO.Printf("Purged %d expired results from the result backend", purged)
+			}
+		}
+	}
+}
+
+// collectors returns the backends collecting garbage, the backend itself or
+// the backends it wraps
+func collectors(backend iface.Backend) []iface.GarbageCollector {
+	return implementations[iface.GarbageCollector](backend)
+}
@@ -0,0 +1,55 @@
+package backends_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+// collectingBackend purges a fixed number of results
+type collectingBackend struct {
+	iface.Backend
+	purged int
+	err    error
+}
+
+func (b collectingBackend) CollectGarbage(ctx context.Context) (int, error) {
+	return b.purged, b.err
+}
+
+func TestGC(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{
+		ResultEncryptionKey: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")),
+	}
+	encrypted, err := backends.NewEncrypted(cnf, collectingBackend{Backend: memory.New(cnf), purged: 2})
+	require.NoError(t, err)
+
+	// Wrapped backends are collected, a failing one does not stop the others
+	tiered := backends.NewTiered(
+		backends.ReadFastest,
+		memory.New(cnf),
+		encrypted,
+		collectingBackend{Backend: memory.New(cnf), purged: 1, err: errors.New("unavailable")},
+	)
+	gc := backends.NewGC(tiered, 0)
+	assert.True(t, gc.Supported())
+	purged, err := gc.Collect(context.Background())
+	assert.EqualError(t, err, "unavailable")
+	assert.Equal(t, 3, purged)
+
+	gc = backends.NewGC(memory.New(cnf), 0)
+	assert.False(t, gc.Supported())
+	_, err = gc.Collect(context.Background())
+	assert.Equal(t, backends.ErrGCNotSupported, err)
+}
@@ -0,0 +1,72 @@
+package backends
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrHeartbeatsNotSupported is returned when a backend does not record
+// heartbeats of running tasks
+var ErrHeartbeatsNotSupported = errors.New("Result backend does not record heartbeats")
+
+// HeartbeatsSupported returns true if the backend or the backends it wraps
+// record heartbeats
+func HeartbeatsSupported(backend iface.Backend) bool {
+	return len(heartbeaters(backend)) > 0
+}
+
+// Heartbeat records that the task is still running in the backend or the
+// backends it wraps
+func Heartbeat(backend iface.Backend, signature *tasks.Signature) error {
+	found := heartbeaters(backend)
+	if len(found) == 0 {
+		return ErrHeartbeatsNotSupported
+	}
+
+	for _, heartbeater := range found {
+		if err := heartbeater.Heartbeat(signature); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveHeartbeat removes the heartbeat of the task, it returns false if the
+// first backend recording heartbeats had none
+func RemoveHeartbeat(backend iface.Backend, taskUUID string) (bool, error) {
+	found := heartbeaters(backend)
+	if len(found) == 0 {
+		return false, ErrHeartbeatsNotSupported
+	}
+
+	removed, err := found[0].RemoveHeartbeat(taskUUID)
+	if err != nil {
+		return false, err
+	}
+	for _, heartbeater := range found[1:] {
+		if _, err := heartbeater.RemoveHeartbeat(taskUUID); err != nil {
+			return false, err
+		}
+	}
+	return removed, nil
+}
+
+// StaleHeartbeats returns signatures of the tasks whose latest heartbeat is
+// older than the time, read from the first backend recording heartbeats
+func StaleHeartbeats(backend iface.Backend, before time.Time) ([]*tasks.Signature, error) {
+	found := heartbeaters(backend)
+	if len(found) == 0 {
+		return nil, ErrHeartbeatsNotSupported
+	}
+
+	return found[0].StaleHeartbeats(before)
+}
+
+// heartbeaters returns the backends recording heartbeats, the backend itself
+// or the backends it wraps
+func heartbeaters(backend iface.Backend) []iface.Heartbeater {
+	return implementations[iface.Heartbeater](backend)
+}
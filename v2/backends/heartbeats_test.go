@@ -0,0 +1,53 @@
+package backends_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/null"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestHeartbeats(t *testing.T) {
+	t.Parallel()
+
+	fast, durable := memory.New(new(config.Config)), memory.New(new(config.Config))
+	backend := backends.NewTiered(backends.ReadFastest, fast, durable)
+	assert.True(t, backends.HeartbeatsSupported(backend))
+
+	signature := &tasks.Signature{UUID: "taskUUID", Name: "task"}
+	require.NoError(t, backends.Heartbeat(backend, signature))
+
+	stale, err := backends.StaleHeartbeats(backend, time.Now().Add(-time.Minute))
+	if assert.NoError(t, err) {
+		assert.Empty(t, stale)
+	}
+	stale, err = backends.StaleHeartbeats(backend, time.Now().Add(time.Minute))
+	if assert.NoError(t, err) && assert.Len(t, stale, 1) {
+		assert.Equal(t, signature.UUID, stale[0].UUID)
+		assert.Equal(t, signature.Name, stale[0].Name)
+	}
+
+	// Only the first removal claims the task
+	removed, err := backends.RemoveHeartbeat(backend, signature.UUID)
+	if assert.NoError(t, err) {
+		assert.True(t, removed)
+	}
+	removed, err = backends.RemoveHeartbeat(backend, signature.UUID)
+	if assert.NoError(t, err) {
+		assert.False(t, removed)
+	}
+	stale, err = backends.StaleHeartbeats(durable, time.Now().Add(time.Minute))
+	if assert.NoError(t, err) {
+		assert.Empty(t, stale)
+	}
+
+	assert.False(t, backends.HeartbeatsSupported(null.New()))
+	assert.Equal(t, backends.ErrHeartbeatsNotSupported, backends.Heartbeat(null.New(), signature))
+}
@@ -0,0 +1,45 @@
+package backends
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+)
+
+// ErrIdempotencyNotSupported is returned when a backend does not record
+// idempotency keys of sent tasks
+var ErrIdempotencyNotSupported = errors.New("Result backend does not record idempotency keys")
+
+// ClaimIdempotencyKey records the task under the key for the window in the
+// first backend recording idempotency keys, unless another task has been
+// recorded under it. It returns the UUID of the task recorded under the key
+// and true if it is the given task.
+func ClaimIdempotencyKey(backend iface.Backend, key, taskUUID string, window time.Duration) (string, bool, error) {
+	deduplicator := findDeduplicator(backend)
+	if deduplicator == nil {
+		return "", false, ErrIdempotencyNotSupported
+	}
+
+	return deduplicator.ClaimIdempotencyKey(key, taskUUID, window)
+}
+
+// ReleaseIdempotencyKey deletes the key from the first backend recording
+// idempotency keys if the task is recorded under it
+func ReleaseIdempotencyKey(backend iface.Backend, key, taskUUID string) error {
+	deduplicator := findDeduplicator(backend)
+	if deduplicator == nil {
+		return ErrIdempotencyNotSupported
+	}
+
+	return deduplicator.ReleaseIdempotencyKey(key, taskUUID)
+}
+
+// findDeduplicator returns the backend recording idempotency keys, the
+// backend itself or the first backend it wraps recording them
+func findDeduplicator(backend iface.Backend) iface.Deduplicator {
+	if deduplicators := implementations[iface.Deduplicator](backend); len(deduplicators) > 0 {
+		return deduplicators[0]
+	}
+	return nil
+}
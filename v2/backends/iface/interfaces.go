@@ -1,6 +1,10 @@
 package iface
 
 import (
+	"context"
+	"io"
+	"time"
+
 	"github.com/RichardKnop/machinery/v2/tasks"
 )
 
@@ -19,10 +23,168 @@ type Backend interface {
 	SetStateRetry(signature *tasks.Signature) error
 	SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error
 	SetStateFailure(signature *tasks.Signature, err string) error
+	SetStateCanceled(signature *tasks.Signature) error
 	GetState(taskUUID string) (*tasks.TaskState, error)
 
 	// Purging stored stored tasks states and group meta data
 	IsAMQP() bool
 	PurgeState(taskUUID string) error
 	PurgeGroupMeta(groupUUID string) error
+
+	// Checking the connection to the result store
+	HealthCheck(ctx context.Context) error
+}
+
+// Wrapper is implemented by backends wrapping another backend, e.g. to encrypt
+// results. Embedding the wrapped backend does not promote its optional
+// interfaces, they are found through Unwrap instead.
+type Wrapper interface {
+	Unwrap() Backend
+}
+
+// MultiWrapper is implemented by backends wrapping several backends, e.g.
+// tiered backends, their optional interfaces are found through Unwrap like
+// those of a Wrapper
+type MultiWrapper interface {
+	Unwrap() []Backend
+}
+
+// StateStreamer is implemented by backends which can stream the results of a
+// task, e.g. from an object store, instead of reading them into memory
+type StateStreamer interface {
+	// GetStateStream returns the latest task state and, when the task
+	// succeeded, a reader over its JSON encoded results which must be closed.
+	// Results of the returned state are not set.
+	GetStateStream(ctx context.Context, taskUUID string) (*tasks.TaskState, io.ReadCloser, error)
+}
+
+// StateSubscriber is implemented by backends which push changes of task
+// states, waiting for a task then does not need to poll GetState
+type StateSubscriber interface {
+	// Subscribe returns a channel receiving the new state of the task on each
+	// change, it is closed when ctx is done or the subscription is lost.
+	// Changes are dropped while the channel is full.
+	Subscribe(ctx context.Context, taskUUID string) (<-chan *tasks.TaskState, error)
+}
+
+// GarbageCollector is implemented by backends whose databases do not evict
+// expired task states and group metas themselves, or not promptly
+type GarbageCollector interface {
+	// CollectGarbage purges task states and group metas older than
+	// ResultsExpireIn and returns how many were purged
+	CollectGarbage(ctx context.Context) (int, error)
+}
+
+// ChildTracker is implemented by backends which record the child tasks sent
+// by running tasks, see tasks.PublisherFromContext
+type ChildTracker interface {
+	// AddChild records the task as a child of the parent task, adding a child
+	// more than once, e.g. when it is retried, records it once
+	AddChild(parentUUID, childUUID string) error
+	// Children returns UUIDs of the children of the parent task in the order
+	// they were added
+	Children(parentUUID string) ([]string, error)
+}
+
+// PartialResultRecorder is implemented by backends which record the partial
+// results emitted by running tasks, see tasks.EmitResult
+type PartialResultRecorder interface {
+	// AppendPartialResult appends the result to the partial results of the task
+	AppendPartialResult(taskUUID string, result *tasks.TaskResult) error
+	// PartialResults returns the partial results of the task in the order
+	// they were appended
+	PartialResults(taskUUID string) ([]*tasks.TaskResult, error)
+}
+
+// FailureRecorder is implemented by backends which record the failed attempts
+// of tasks
+type FailureRecorder interface {
+	// AppendFailure appends the failure to the failure history of the task
+	AppendFailure(taskUUID string, failure *tasks.Failure) error
+	// Failures returns the failure history of the task, oldest first
+	Failures(taskUUID string) ([]*tasks.Failure, error)
+}
+
+// FailedTaskRecorder is implemented by backends which record the tasks which
+// failed for good, so they can be replayed, until the results expire
+type FailedTaskRecorder interface {
+	// RecordFailedTask records the failed task
+	RecordFailedTask(failed *tasks.FailedTask) error
+	// FailedTask returns the failed task, nil if it has not been recorded
+	FailedTask(taskUUID string) (*tasks.FailedTask, error)
+	// FailedTasks returns the tasks with the name which failed since the
+	// time, of any name if it is empty, oldest first
+	FailedTasks(taskName string, since time.Time) ([]*tasks.FailedTask, error)
+	// RemoveFailedTask removes the failed task, e.g. once it was replayed
+	RemoveFailedTask(taskUUID string) error
+}
+
+// ScheduleStore is implemented by backends which store schedules of periodic
+// tasks, they do not expire
+type ScheduleStore interface {
+	// SaveSchedule creates the schedule or replaces the one with its name
+	SaveSchedule(schedule *tasks.Schedule) error
+	// Schedule returns the schedule with the name, nil if there is none
+	Schedule(name string) (*tasks.Schedule, error)
+	// Schedules returns the stored schedules sorted by name
+	Schedules() ([]*tasks.Schedule, error)
+	// DeleteSchedule deletes the schedule with the name and when it was run,
+	// if any
+	DeleteSchedule(name string) error
+	// SetScheduleLastRun records when the schedule with the name was run
+	SetScheduleLastRun(name string, at time.Time) error
+	// ScheduleLastRun returns when the schedule with the name was run for the
+	// last time, the zero time if it was never run
+	ScheduleLastRun(name string) (time.Time, error)
+}
+
+// Heartbeater is implemented by backends which record heartbeats of running
+// tasks, so tasks whose worker stopped while running them can be found
+type Heartbeater interface {
+	// Heartbeat records that the task is still running
+	Heartbeat(signature *tasks.Signature) error
+	// RemoveHeartbeat removes the heartbeat of the task, it returns false if
+	// there was none, e.g. because another worker removed it first
+	RemoveHeartbeat(taskUUID string) (bool, error)
+	// StaleHeartbeats returns signatures of the tasks whose latest heartbeat
+	// is older than the time
+	StaleHeartbeats(before time.Time) ([]*tasks.Signature, error)
+}
+
+// DeliveryCounter is implemented by backends which count deliveries of tasks
+// to workers, so tasks which never finish, e.g. because they crash their
+// workers, can be quarantined
+type DeliveryCounter interface {
+	// CountDelivery counts a delivery of the task and returns how many times
+	// it has been delivered since its deliveries were last reset
+	CountDelivery(taskUUID string) (int, error)
+	// ResetDeliveries resets the deliveries of the task once an attempt of the
+	// task finished
+	ResetDeliveries(taskUUID string) error
+}
+
+// Deduplicator is implemented by backends which record idempotency keys of
+// sent tasks, so sending a task with the same key again is skipped
+type Deduplicator interface {
+	// ClaimIdempotencyKey records the task under the key for the window
+	// unless a task has been recorded under it already. It returns the UUID
+	// of the recorded task and true if it is the given task, e.g. when it is
+	// sent again to be retried.
+	ClaimIdempotencyKey(key, taskUUID string, window time.Duration) (string, bool, error)
+	// ReleaseIdempotencyKey deletes the key if the task is recorded under
+	// it, e.g. when the task could not be sent
+	ReleaseIdempotencyKey(key, taskUUID string) error
+}
+
+// WorkerRegistry is implemented by backends which record the workers
+// consuming tasks, so operators can see which workers are alive
+type WorkerRegistry interface {
+	// RegisterWorker records the worker until the TTL passed, registering it
+	// again replaces its info and extends its registration
+	RegisterWorker(worker *tasks.WorkerInfo, ttl time.Duration) error
+	// UnregisterWorker removes the worker, e.g. once it stopped
+	UnregisterWorker(workerID string) error
+	// Workers returns the registered workers whose registration has not
+	// expired
+	Workers() ([]*tasks.WorkerInfo, error)
 }
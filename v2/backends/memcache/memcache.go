@@ -2,6 +2,7 @@ package memcache
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"time"
 
@@ -162,6 +163,12 @@ func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error
 	return b.updateState(taskState)
 }
 
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	taskState := tasks.NewCanceledTaskState(signature)
+	return b.updateState(taskState)
+}
+
 // GetState returns the latest task state
 func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 	item, err := b.getClient().Get(taskUUID)
@@ -169,14 +176,7 @@ func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 		return nil, err
 	}
 
-	state := new(tasks.TaskState)
-	decoder := json.NewDecoder(bytes.NewReader(item.Value))
-	decoder.UseNumber()
-	if err := decoder.Decode(state); err != nil {
-		return nil, err
-	}
-
-	return state, nil
+	return b.UnmarshalTaskState(item.Value)
 }
 
 // PurgeState deletes stored task state
@@ -184,6 +184,11 @@ func (b *Backend) PurgeState(taskUUID string) error {
 	return b.getClient().Delete(taskUUID)
 }
 
+// HealthCheck pings the memcache servers
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	return b.getClient().Ping()
+}
+
 // PurgeGroupMeta deletes stored group meta data
 func (b *Backend) PurgeGroupMeta(groupUUID string) error {
 	return b.getClient().Delete(groupUUID)
@@ -191,7 +196,7 @@ func (b *Backend) PurgeGroupMeta(groupUUID string) error {
 
 // updateState saves current task state
 func (b *Backend) updateState(taskState *tasks.TaskState) error {
-	encoded, err := json.Marshal(taskState)
+	encoded, err := b.MarshalTaskState(taskState)
 	if err != nil {
 		return err
 	}
@@ -260,10 +265,8 @@ func (b *Backend) getStates(taskUUIDs ...string) ([]*tasks.TaskState, error) {
 			return nil, err
 		}
 
-		state := new(tasks.TaskState)
-		decoder := json.NewDecoder(bytes.NewReader(item.Value))
-		decoder.UseNumber()
-		if err := decoder.Decode(state); err != nil {
+		state, err := b.UnmarshalTaskState(item.Value)
+		if err != nil {
 			return nil, err
 		}
 
@@ -0,0 +1,681 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrGroupNotFound ...
+type ErrGroupNotFound struct {
+	groupUUID string
+}
+
+// NewErrGroupNotFound returns new instance of ErrGroupNotFound
+func NewErrGroupNotFound(groupUUID string) ErrGroupNotFound {
+	return ErrGroupNotFound{groupUUID: groupUUID}
+}
+
+// Error implements error interface
+func (e ErrGroupNotFound) Error() string {
+	return fmt.Sprintf("Group not found: %v", e.groupUUID)
+}
+
+// ErrTaskNotFound ...
+type ErrTaskNotFound struct {
+	taskUUID string
+}
+
+// NewErrTaskNotFound returns new instance of ErrTaskNotFound
+func NewErrTaskNotFound(taskUUID string) ErrTaskNotFound {
+	return ErrTaskNotFound{taskUUID: taskUUID}
+}
+
+// Error implements error interface
+func (e ErrTaskNotFound) Error() string {
+	return fmt.Sprintf("Task not found: %v", e.taskUUID)
+}
+
+// groupMeta stores the tasks of a group and whether its chord has been triggered
+type groupMeta struct {
+	taskUUIDs      []string
+	chordTriggered bool
+}
+
+// heartbeat is the latest heartbeat of a running task
+type heartbeat struct {
+	signature *tasks.Signature
+	at        time.Time
+}
+
+// idempotencyKey is a task recorded under an idempotency key until it expires
+type idempotencyKey struct {
+	taskUUID string
+	expires  time.Time
+}
+
+// registeredWorker is a worker registered until its registration expires
+type registeredWorker struct {
+	info    tasks.WorkerInfo
+	expires time.Time
+}
+
+// Backend represents an in-memory result backend safe for concurrent use
+// by several workers, meant to be used together with the in-memory broker
+type Backend struct {
+	common.Backend
+	groups map[string]*groupMeta
+	tasks  map[string][]byte
+	// subscribers are notified when the state of their task changes
+	subscribers map[string][]chan *tasks.TaskState
+	// children are the UUIDs of child tasks by the UUID of their parent
+	children map[string][]string
+	// partialResults are the encoded partial results of tasks by their UUIDs
+	partialResults map[string][][]byte
+	// failures are the encoded failed attempts of tasks by their UUIDs
+	failures map[string][][]byte
+	// failedTasks are the tasks which failed for good by their UUIDs
+	failedTasks map[string]*tasks.FailedTask
+	// schedules of periodic tasks by their names
+	schedules map[string]*tasks.Schedule
+	// scheduleRuns are the last runs of schedules by their names
+	scheduleRuns map[string]time.Time
+	// heartbeats of running tasks by their UUIDs
+	heartbeats map[string]heartbeat
+	// deliveries counts deliveries of tasks by their UUIDs
+	deliveries map[string]int
+	// idempotencyKeys of sent tasks
+	idempotencyKeys map[string]idempotencyKey
+	// workers registered by their IDs
+	workers map[string]registeredWorker
+	mu      sync.Mutex
+}
+
+// New creates Backend instance
+func New(cnf *config.Config) iface.Backend {
+	return &Backend{
+		Backend: common.NewBackend(cnf),
+		groups:  make(map[string]*groupMeta),
+		tasks:   make(map[string][]byte),
+
+		subscribers: make(map[string][]chan *tasks.TaskState),
+		children:    make(map[string][]string),
+		heartbeats:  make(map[string]heartbeat),
+		deliveries:  make(map[string]int),
+
+		partialResults: make(map[string][][]byte),
+		failures:       make(map[string][][]byte),
+		failedTasks:    make(map[string]*tasks.FailedTask),
+		schedules:      make(map[string]*tasks.Schedule),
+		scheduleRuns:   make(map[string]time.Time),
+
+		idempotencyKeys: make(map[string]idempotencyKey),
+		workers:         make(map[string]registeredWorker),
+	}
+}
+
+// InitGroup creates and saves a group meta data object
+func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.groups[groupUUID] = &groupMeta{taskUUIDs: append([]string(nil), taskUUIDs...)}
+	return nil
+}
+
+// GroupCompleted returns true if all tasks in a group finished
+func (b *Backend) GroupCompleted(groupUUID string, groupTaskCount int) (bool, error) {
+	taskStates, err := b.GroupTaskStates(groupUUID, groupTaskCount)
+	if err != nil {
+		return false, err
+	}
+
+	var countSuccessTasks = 0
+	for _, taskState := range taskStates {
+		if taskState.IsCompleted() {
+			countSuccessTasks++
+		}
+	}
+
+	return countSuccessTasks == groupTaskCount, nil
+}
+
+// GroupTaskStates returns states of all tasks in the group
+func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	meta, ok := b.groups[groupUUID]
+	if !ok {
+		return nil, NewErrGroupNotFound(groupUUID)
+	}
+
+	states := make([]*tasks.TaskState, 0, groupTaskCount)
+	for _, taskUUID := range meta.taskUUIDs {
+		state, err := b.getState(taskUUID)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// TriggerChord flags chord as triggered in the backend storage to make sure
+// chord is never trigerred multiple times. Returns a boolean flag to indicate
+// whether the worker should trigger chord (true) or no if it has been triggered
+// already (false)
+func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	meta, ok := b.groups[groupUUID]
+	if !ok {
+		return false, NewErrGroupNotFound(groupUUID)
+	}
+
+	// Chord has already been triggered, return false (should not trigger again)
+	if meta.chordTriggered {
+		return false, nil
+	}
+
+	meta.chordTriggered = true
+	return true, nil
+}
+
+// SetStatePending updates task state to PENDING
+func (b *Backend) SetStatePending(signature *tasks.Signature) error {
+	state := tasks.NewPendingTaskState(signature)
+	return b.updateState(state)
+}
+
+// SetStateReceived updates task state to RECEIVED
+func (b *Backend) SetStateReceived(signature *tasks.Signature) error {
+	state := tasks.NewReceivedTaskState(signature)
+	return b.updateState(state)
+}
+
+// SetStateStarted updates task state to STARTED
+func (b *Backend) SetStateStarted(signature *tasks.Signature) error {
+	state := tasks.NewStartedTaskState(signature)
+	return b.updateState(state)
+}
+
+// SetStateRetry updates task state to RETRY
+func (b *Backend) SetStateRetry(signature *tasks.Signature) error {
+	state := tasks.NewRetryTaskState(signature)
+	return b.updateState(state)
+}
+
+// SetStateSuccess updates task state to SUCCESS
+func (b *Backend) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	state := tasks.NewSuccessTaskState(signature, results)
+	return b.updateState(state)
+}
+
+// SetStateFailure updates task state to FAILURE
+func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error {
+	state := tasks.NewFailureTaskState(signature, err)
+	return b.updateState(state)
+}
+
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	state := tasks.NewCanceledTaskState(signature)
+	return b.updateState(state)
+}
+
+// GetState returns the latest task state
+func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.getState(taskUUID)
+}
+
+// Subscribe returns a channel receiving the state of the task on each change
+// until ctx is done
+func (b *Backend) Subscribe(ctx context.Context, taskUUID string) (<-chan *tasks.TaskState, error) {
+	changes := make(chan *tasks.TaskState, 1)
+
+	b.mu.Lock()
+	b.subscribers[taskUUID] = append(b.subscribers[taskUUID], changes)
+	b.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		subscribers := b.subscribers[taskUUID]
+		for i, subscriber := range subscribers {
+			if subscriber == changes {
+				subscribers = append(subscribers[:i], subscribers[i+1:]...)
+				break
+			}
+		}
+		if len(subscribers) == 0 {
+			delete(b.subscribers, taskUUID)
+		} else {
+			b.subscribers[taskUUID] = subscribers
+		}
+		close(changes)
+	}()
+
+	return changes, nil
+}
+
+// AddChild records the task as a child of the parent task
+func (b *Backend) AddChild(parentUUID, childUUID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, existing := range b.children[parentUUID] {
+		if existing == childUUID {
+			return nil
+		}
+	}
+
+	b.children[parentUUID] = append(b.children[parentUUID], childUUID)
+	return nil
+}
+
+// Children returns UUIDs of the children of the parent task
+func (b *Backend) Children(parentUUID string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]string(nil), b.children[parentUUID]...), nil
+}
+
+// AppendPartialResult appends the result to the partial results of the task
+func (b *Backend) AppendPartialResult(taskUUID string, result *tasks.TaskResult) error {
+	encoded, err := b.MarshalTaskResult(result)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.partialResults[taskUUID] = append(b.partialResults[taskUUID], encoded)
+	return nil
+}
+
+// PartialResults returns the partial results of the task
+func (b *Backend) PartialResults(taskUUID string) ([]*tasks.TaskResult, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	results := make([]*tasks.TaskResult, 0, len(b.partialResults[taskUUID]))
+	for _, encoded := range b.partialResults[taskUUID] {
+		result, err := b.UnmarshalTaskResult(encoded)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// AppendFailure appends the failure to the failure history of the task
+func (b *Backend) AppendFailure(taskUUID string, failure *tasks.Failure) error {
+	encoded, err := b.MarshalFailure(failure)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures[taskUUID] = append(b.failures[taskUUID], encoded)
+	return nil
+}
+
+// Failures returns the failure history of the task
+func (b *Backend) Failures(taskUUID string) ([]*tasks.Failure, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failures := make([]*tasks.Failure, 0, len(b.failures[taskUUID]))
+	for _, encoded := range b.failures[taskUUID] {
+		failure, err := b.UnmarshalFailure(encoded)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+	return failures, nil
+}
+
+// RecordFailedTask records the failed task
+func (b *Backend) RecordFailedTask(failed *tasks.FailedTask) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failedTasks[failed.Signature.UUID] = copyFailedTask(failed)
+	return nil
+}
+
+// FailedTask returns the failed task, nil if it has not been recorded
+func (b *Backend) FailedTask(taskUUID string) (*tasks.FailedTask, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed, ok := b.failedTasks[taskUUID]
+	if !ok {
+		return nil, nil
+	}
+	return copyFailedTask(failed), nil
+}
+
+// FailedTasks returns the tasks with the name which failed since the time, of
+// any name if it is empty, oldest first
+func (b *Backend) FailedTasks(taskName string, since time.Time) ([]*tasks.FailedTask, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	found := make([]*tasks.FailedTask, 0)
+	for _, failed := range b.failedTasks {
+		if (taskName == "" || failed.Signature.Name == taskName) && !failed.FailedAt.Before(since) {
+			found = append(found, copyFailedTask(failed))
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].FailedAt.Before(found[j].FailedAt)
+	})
+	return found, nil
+}
+
+// RemoveFailedTask removes the failed task
+func (b *Backend) RemoveFailedTask(taskUUID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.failedTasks, taskUUID)
+	return nil
+}
+
+// copyFailedTask copies the failed task so the recorded one is not shared
+func copyFailedTask(failed *tasks.FailedTask) *tasks.FailedTask {
+	return &tasks.FailedTask{
+		Signature: tasks.CopySignature(failed.Signature),
+		Error:     failed.Error,
+		FailedAt:  failed.FailedAt,
+	}
+}
+
+// SaveSchedule creates the schedule or replaces the one with its name
+func (b *Backend) SaveSchedule(schedule *tasks.Schedule) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.schedules[schedule.Name] = tasks.CopySchedule(schedule)
+	return nil
+}
+
+// Schedule returns the schedule with the name, nil if there is none
+func (b *Backend) Schedule(name string) (*tasks.Schedule, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	schedule, ok := b.schedules[name]
+	if !ok {
+		return nil, nil
+	}
+	return tasks.CopySchedule(schedule), nil
+}
+
+// Schedules returns the stored schedules sorted by name
+func (b *Backend) Schedules() ([]*tasks.Schedule, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	schedules := make([]*tasks.Schedule, 0, len(b.schedules))
+	for _, schedule := range b.schedules {
+		schedules = append(schedules, tasks.CopySchedule(schedule))
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+	return schedules, nil
+}
+
+// DeleteSchedule deletes the schedule with the name and its last run, if any
+func (b *Backend) DeleteSchedule(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.schedules, name)
+	delete(b.scheduleRuns, name)
+	return nil
+}
+
+// SetScheduleLastRun records when the schedule with the name was run
+func (b *Backend) SetScheduleLastRun(name string, at time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.scheduleRuns[name] = at
+	return nil
+}
+
+// ScheduleLastRun returns when the schedule with the name was run for the
+// last time, the zero time if it was never run
+func (b *Backend) ScheduleLastRun(name string) (time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.scheduleRuns[name], nil
+}
+
+// CountDelivery counts a delivery of the task
+func (b *Backend) CountDelivery(taskUUID string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deliveries[taskUUID]++
+	return b.deliveries[taskUUID], nil
+}
+
+// ResetDeliveries resets the deliveries of the task
+func (b *Backend) ResetDeliveries(taskUUID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.deliveries, taskUUID)
+	return nil
+}
+
+// Heartbeat records that the task is still running
+func (b *Backend) Heartbeat(signature *tasks.Signature) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.heartbeats[signature.UUID] = heartbeat{
+		signature: tasks.CopySignature(signature),
+		at:        time.Now(),
+	}
+	return nil
+}
+
+// RemoveHeartbeat removes the heartbeat of the task
+func (b *Backend) RemoveHeartbeat(taskUUID string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.heartbeats[taskUUID]; !ok {
+		return false, nil
+	}
+
+	delete(b.heartbeats, taskUUID)
+	return true, nil
+}
+
+// StaleHeartbeats returns signatures of the tasks whose latest heartbeat is
+// older than the time
+func (b *Backend) StaleHeartbeats(before time.Time) ([]*tasks.Signature, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var signatures []*tasks.Signature
+	for _, heartbeat := range b.heartbeats {
+		if heartbeat.at.Before(before) {
+			signatures = append(signatures, tasks.CopySignature(heartbeat.signature))
+		}
+	}
+	return signatures, nil
+}
+
+// RegisterWorker records the worker until the TTL passed
+func (b *Backend) RegisterWorker(worker *tasks.WorkerInfo, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info := *worker
+	info.Queues = append([]string(nil), worker.Queues...)
+	b.workers[worker.ID] = registeredWorker{info: info, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+// UnregisterWorker removes the worker
+func (b *Backend) UnregisterWorker(workerID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.workers, workerID)
+	return nil
+}
+
+// Workers returns the registered workers ordered by their IDs, workers whose
+// registration expired are removed
+func (b *Backend) Workers() ([]*tasks.WorkerInfo, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	workers := make([]*tasks.WorkerInfo, 0, len(b.workers))
+	for id, worker := range b.workers {
+		if !now.Before(worker.expires) {
+			delete(b.workers, id)
+			continue
+		}
+		info := worker.info
+		info.Queues = append([]string(nil), worker.info.Queues...)
+		workers = append(workers, &info)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].ID < workers[j].ID })
+	return workers, nil
+}
+
+// ClaimIdempotencyKey records the task under the key for the window unless
+// another task has been recorded under it
+func (b *Backend) ClaimIdempotencyKey(key, taskUUID string, window time.Duration) (string, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := b.idempotencyKeys[key]; ok && now.Before(existing.expires) {
+		return existing.taskUUID, existing.taskUUID == taskUUID, nil
+	}
+
+	b.idempotencyKeys[key] = idempotencyKey{taskUUID: taskUUID, expires: now.Add(window)}
+	return taskUUID, true, nil
+}
+
+// ReleaseIdempotencyKey deletes the key if the task is recorded under it
+func (b *Backend) ReleaseIdempotencyKey(key, taskUUID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if existing, ok := b.idempotencyKeys[key]; ok && existing.taskUUID == taskUUID {
+		delete(b.idempotencyKeys, key)
+	}
+	return nil
+}
+
+// PurgeState deletes stored task state
+func (b *Backend) PurgeState(taskUUID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.tasks[taskUUID]; !ok {
+		return NewErrTaskNotFound(taskUUID)
+	}
+
+	delete(b.tasks, taskUUID)
+	delete(b.partialResults, taskUUID)
+	delete(b.failures, taskUUID)
+	delete(b.failedTasks, taskUUID)
+	return nil
+}
+
+// PurgeGroupMeta deletes stored group meta data
+func (b *Backend) PurgeGroupMeta(groupUUID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.groups[groupUUID]; !ok {
+		return NewErrGroupNotFound(groupUUID)
+	}
+
+	delete(b.groups, groupUUID)
+	return nil
+}
+
+// getState decodes the stored task state, the caller must hold the mutex
+func (b *Backend) getState(taskUUID string) (*tasks.TaskState, error) {
+	taskStateBytes, ok := b.tasks[taskUUID]
+	if !ok {
+		return nil, NewErrTaskNotFound(taskUUID)
+	}
+
+	state, err := b.UnmarshalTaskState(taskStateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal task state %s: %v", taskUUID, err)
+	}
+
+	return state, nil
+}
+
+func (b *Backend) updateState(s *tasks.TaskState) error {
+	// Task states are kept serialized to behave like with any other backend,
+	// e.g. results are decoded from JSON the same way
+	msg, err := b.MarshalTaskState(s)
+	if err != nil {
+		return fmt.Errorf("Marshal task state error: %v", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.tasks[s.TaskUUID] = msg
+	b.notify(s.TaskUUID)
+	return nil
+}
+
+// notify sends the stored state to subscribers of the task, each receives its
+// own decoded copy. A subscriber which has not received the previous state
+// yet misses the change. The caller must hold the mutex.
+func (b *Backend) notify(taskUUID string) {
+	for _, subscriber := range b.subscribers[taskUUID] {
+		state, err := b.getState(taskUUID)
+		if err != nil {
+			return
+		}
+
+		select {
+		case subscriber <- state:
+		default:
+		}
+	}
+}
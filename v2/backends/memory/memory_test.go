@@ -0,0 +1,65 @@
+package memory_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/result"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	backend := memory.New(new(config.Config))
+	signature := &tasks.Signature{UUID: "taskUUID", Name: "task"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := backend.(iface.StateSubscriber).Subscribe(ctx, signature.UUID)
+	require.NoError(t, err)
+
+	require.NoError(t, backend.SetStateStarted(signature))
+	state := <-changes
+	assert.Equal(t, tasks.StateStarted, state.State)
+
+	// Changes of other tasks are not received
+	require.NoError(t, backend.SetStateStarted(&tasks.Signature{UUID: "otherTaskUUID"}))
+	select {
+	case state := <-changes:
+		t.Fatalf("Unexpected change: %v", state)
+	default:
+	}
+
+	cancel()
+	_, ok := <-changes
+	assert.False(t, ok)
+
+	// Nobody is notified after the subscription ended
+	assert.NoError(t, backend.SetStateSuccess(signature, nil))
+}
+
+func TestGetWaitsForChange(t *testing.T) {
+	t.Parallel()
+
+	backend := memory.New(new(config.Config))
+	signature := &tasks.Signature{UUID: "taskUUID", Name: "task"}
+	require.NoError(t, backend.SetStatePending(signature))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		backend.SetStateSuccess(signature, []*tasks.TaskResult{{Type: "int64", Value: 42}})
+	}()
+
+	// The state change wakes Get up long before the sleep is over
+	results, err := result.NewAsyncResult(signature, backend).GetWithTimeout(5*time.Second, time.Hour)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(42), results[0].Interface())
+	}
+}
@@ -3,6 +3,7 @@ package mongo
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"reflect"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"github.com/RichardKnop/machinery/v2/backends/iface"
 	"github.com/RichardKnop/machinery/v2/common"
@@ -26,6 +28,8 @@ type Backend struct {
 	client *mongo.Client
 	tc     *mongo.Collection
 	gmc    *mongo.Collection
+	// tcRead reads polled task states, from secondaries when configured
+	tcRead *mongo.Collection
 	once   sync.Once
 }
 
@@ -87,6 +91,9 @@ func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*task
 // whether the worker should trigger chord (true) or no if it has been triggered
 // already (false)
 func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
+	// A single document update is atomic, the filter only matches while the
+	// chord has not been triggered so exactly one of concurrent callers
+	// finds the document
 	query := bson.M{
 		"_id":             groupUUID,
 		"chord_triggered": false,
@@ -97,16 +104,20 @@ func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
 		},
 	}
 
-	_, err := b.groupMetasCollection().UpdateOne(context.Background(), query, change, options.Update())
+	err := b.groupMetasCollection().FindOneAndUpdate(context.Background(), query, change).Err()
+	if err == nil {
+		return true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return false, err
+	}
 
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.WARNING.Printf("Chord already triggered for group %s", groupUUID)
-			return false, nil
-		}
+	// The filter also does not match when the group does not exist
+	if _, err := b.getGroupMeta(groupUUID); err != nil {
 		return false, err
 	}
-	return true, nil
+	log.WARNING.Printf("Chord already triggered for group %s", groupUUID)
+	return false, nil
 }
 
 // SetStatePending updates task state to PENDING
@@ -175,10 +186,21 @@ func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error
 	return b.updateState(signature, update)
 }
 
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	update := bson.M{"state": tasks.StateCanceled}
+	return b.updateState(signature, update)
+}
+
 // GetState returns the latest task state
 func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 	state := &tasks.TaskState{}
-	err := b.tasksCollection().FindOne(context.Background(), bson.M{"_id": taskUUID}).Decode(state)
+	err := b.readTasksCollection().FindOne(context.Background(), bson.M{"_id": taskUUID}).Decode(state)
+
+	// A state which has not been replicated to the secondary yet is read from the primary
+	if err == mongo.ErrNoDocuments && b.readTasksCollection() != b.tasksCollection() {
+		err = b.tasksCollection().FindOne(context.Background(), bson.M{"_id": taskUUID}).Decode(state)
+	}
 
 	if err != nil {
 		return nil, err
@@ -186,12 +208,85 @@ func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 	return state, nil
 }
 
+// Subscribe returns a channel receiving the state of the task on each change,
+// read from a change stream. Change streams need a replica set or sharded
+// cluster, an error is returned by a standalone server.
+func (b *Backend) Subscribe(ctx context.Context, taskUUID string) (<-chan *tasks.TaskState, error) {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: bson.M{"documentKey._id": taskUUID}}}}
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	stream, err := b.tasksCollection().Watch(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(chan *tasks.TaskState, 1)
+	go func() {
+		defer close(changes)
+		defer stream.Close(context.Background())
+
+		for stream.Next(ctx) {
+			var event struct {
+				FullDocument *tasks.TaskState `bson:"fullDocument"`
+			}
+			if err := stream.Decode(&event); err != nil {
+				log.ERROR.Printf("Failed to decode change of task state %s: %v", taskUUID, err)
+				continue
+			}
+			// Deleted states have no document
+			if event.FullDocument == nil {
+				continue
+			}
+
+			select {
+			case changes <- event.FullDocument:
+			default:
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
 // PurgeState deletes stored task state
 func (b *Backend) PurgeState(taskUUID string) error {
 	_, err := b.tasksCollection().DeleteOne(context.Background(), bson.M{"_id": taskUUID})
 	return err
 }
 
+// HealthCheck pings the MongoDB server
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	b.once.Do(func() {
+		b.connect()
+	})
+
+	if b.client == nil {
+		return errors.New("Not connected to MongoDB")
+	}
+	return b.client.Ping(ctx, nil)
+}
+
+// CollectGarbage deletes task states and group metas created longer than
+// ResultsExpireIn ago, and group lock documents left without a group. The TTL
+// indexes cannot expire them since they do not index dates.
+func (b *Backend) CollectGarbage(ctx context.Context) (int, error) {
+	expired := bson.M{"created_at": bson.M{"$lt": time.Now().UTC().Add(-b.getExpiration())}}
+
+	result, err := b.tasksCollection().DeleteMany(ctx, expired)
+	if err != nil {
+		return 0, err
+	}
+	purged := int(result.DeletedCount)
+
+	result, err = b.groupMetasCollection().DeleteMany(ctx, bson.M{"$or": []bson.M{
+		expired,
+		{"task_uuids": bson.M{"$exists": false}},
+	}})
+	if err != nil {
+		return purged, err
+	}
+	return purged + int(result.DeletedCount), nil
+}
+
 // PurgeGroupMeta deletes stored group meta data
 func (b *Backend) PurgeGroupMeta(groupUUID string) error {
 	_, err := b.groupMetasCollection().DeleteOne(context.Background(), bson.M{"_id": groupUUID})
@@ -263,6 +358,16 @@ func (b *Backend) updateState(signature *tasks.Signature, update bson.M) error {
 	return err
 }
 
+// getExpiration returns how long results are kept
+func (b *Backend) getExpiration() time.Duration {
+	expiresIn := b.GetConfig().ResultsExpireIn
+	if expiresIn == 0 {
+		// expire results after 1 hour by default
+		expiresIn = config.DefaultResultsExpireIn
+	}
+	return time.Duration(expiresIn) * time.Second
+}
+
 func (b *Backend) tasksCollection() *mongo.Collection {
 	b.once.Do(func() {
 		b.connect()
@@ -271,6 +376,14 @@ func (b *Backend) tasksCollection() *mongo.Collection {
 	return b.tc
 }
 
+func (b *Backend) readTasksCollection() *mongo.Collection {
+	b.once.Do(func() {
+		b.connect()
+	})
+
+	return b.tcRead
+}
+
 func (b *Backend) groupMetasCollection() *mongo.Collection {
 	b.once.Do(func() {
 		b.connect()
@@ -297,6 +410,18 @@ func (b *Backend) connect() error {
 	b.tc = b.client.Database(database).Collection("tasks")
 	b.gmc = b.client.Database(database).Collection("group_metas")
 
+	b.tcRead = b.tc
+	if mongoCnf := b.GetConfig().MongoDB; mongoCnf != nil && mongoCnf.ReadFromSecondaries {
+		var opts []readpref.Option
+		if mongoCnf.MaxStaleness > 0 {
+			opts = append(opts, readpref.WithMaxStaleness(time.Duration(mongoCnf.MaxStaleness)*time.Second))
+		}
+		b.tcRead = b.client.Database(database).Collection(
+			"tasks",
+			options.Collection().SetReadPreference(readpref.SecondaryPreferred(opts...)),
+		)
+	}
+
 	err = b.createMongoIndexes(database)
 	if err != nil {
 		return err
@@ -1,7 +1,10 @@
 package mongo_test
 
 import (
+	"context"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/RichardKnop/machinery/v2/backends/iface"
@@ -245,3 +248,57 @@ func TestGroupStates(t *testing.T) {
 		assert.Equal(t, taskUUIDs[i], taskState.TaskUUID)
 	}
 }
+
+func TestTriggerChord(t *testing.T) {
+	if os.Getenv("MONGODB_URL") == "" {
+		t.Skip("MONGODB_URL is not defined")
+	}
+
+	backend, err := newBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Workers completing the last tasks at the same time trigger the chord once
+	var (
+		wg        sync.WaitGroup
+		triggered int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shouldTrigger, err := backend.TriggerChord(groupUUID)
+			assert.NoError(t, err)
+			if shouldTrigger {
+				atomic.AddInt32(&triggered, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), triggered)
+
+	_, err = backend.TriggerChord("unknownGroupUUID")
+	assert.Error(t, err)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	if os.Getenv("MONGODB_URL") == "" {
+		t.Skip("MONGODB_URL is not defined")
+	}
+
+	backend, err := newBackend()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Results created within ResultsExpireIn are kept
+	assert.NoError(t, backend.SetStatePending(&tasks.Signature{UUID: taskUUIDs[0]}))
+	_, err = backend.(iface.GarbageCollector).CollectGarbage(context.Background())
+	assert.NoError(t, err)
+
+	_, err = backend.GetState(taskUUIDs[0])
+	assert.NoError(t, err)
+	_, err = backend.GroupTaskStates(groupUUID, len(taskUUIDs))
+	assert.NoError(t, err)
+}
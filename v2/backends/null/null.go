@@ -121,6 +121,12 @@ func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error
 	return b.updateState(state)
 }
 
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	state := tasks.NewCanceledTaskState(signature)
+	return b.updateState(state)
+}
+
 // GetState returns the latest task state
 func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 	return nil, NewErrTasknotFound(taskUUID)
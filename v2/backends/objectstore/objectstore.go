@@ -0,0 +1,189 @@
+package objectstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ReferenceType is the type of the single result saved in the wrapped backend
+// in place of results moved to the object store, its value is the object key
+const ReferenceType = "machinery_object_reference"
+
+// Store is an object store results are written to, e.g. S3
+type Store interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// StreamStore is implemented by stores which can read objects as streams
+type StreamStore interface {
+	GetStream(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// Backend wraps a result backend, results of successful tasks larger than
+// the threshold are written to the object store and only a reference to them
+// is saved in the wrapped backend. References are resolved when states are read,
+// so async results get the original results.
+type Backend struct {
+	iface.Backend
+	store     Store
+	threshold int
+}
+
+// New creates Backend instance, results whose JSON encoding is larger than
+// threshold bytes are moved to the store
+func New(backend iface.Backend, store Store, threshold int) iface.Backend {
+	return &Backend{
+		Backend:   backend,
+		store:     store,
+		threshold: threshold,
+	}
+}
+
+// SetStateSuccess updates task state to SUCCESS
+func (b *Backend) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	encoded, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("Marshal task results error: %v", err)
+	}
+
+	if len(encoded) <= b.threshold {
+		return b.Backend.SetStateSuccess(signature, results)
+	}
+
+	key := objectKey(signature.UUID)
+	if err := b.store.Put(context.Background(), key, encoded); err != nil {
+		return fmt.Errorf("Put results of task %s to object store error: %v", signature.UUID, err)
+	}
+
+	reference := []*tasks.TaskResult{{Type: ReferenceType, Value: key}}
+	return b.Backend.SetStateSuccess(signature, reference)
+}
+
+// GroupTaskStates returns states of all tasks in the group
+func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
+	states, err := b.Backend.GroupTaskStates(groupUUID, groupTaskCount)
+	if err != nil {
+		return states, err
+	}
+
+	for _, state := range states {
+		if err := b.resolve(state); err != nil {
+			return nil, err
+		}
+	}
+	return states, nil
+}
+
+// GetState returns the latest task state
+func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
+	state, err := b.Backend.GetState(taskUUID)
+	if err != nil {
+		return state, err
+	}
+
+	if err := b.resolve(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// GetStateStream returns the latest task state and, when the task succeeded, a
+// reader over its JSON encoded results. Results moved to the object store are
+// streamed from it when it implements StreamStore.
+func (b *Backend) GetStateStream(ctx context.Context, taskUUID string) (*tasks.TaskState, io.ReadCloser, error) {
+	state, err := b.Backend.GetState(taskUUID)
+	if err != nil || !state.IsSuccess() {
+		return state, nil, err
+	}
+
+	results := state.Results
+	state.Results = nil
+
+	key, ok := referenceKey(results)
+	if !ok {
+		encoded, err := json.Marshal(results)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Marshal task results error: %v", err)
+		}
+		return state, ioutil.NopCloser(bytes.NewReader(encoded)), nil
+	}
+
+	var stream io.ReadCloser
+	if streamStore, ok := b.store.(StreamStore); ok {
+		stream, err = streamStore.GetStream(ctx, key)
+	} else {
+		var encoded []byte
+		if encoded, err = b.store.Get(ctx, key); err == nil {
+			stream = ioutil.NopCloser(bytes.NewReader(encoded))
+		}
+	}
+	if err != nil {
+		return state, nil, fmt.Errorf("Get results of task %s from object store error: %v", taskUUID, err)
+	}
+	return state, stream, nil
+}
+
+// PurgeState deletes stored task state together with its results in the object store
+func (b *Backend) PurgeState(taskUUID string) error {
+	if err := b.store.Delete(context.Background(), objectKey(taskUUID)); err != nil {
+		return fmt.Errorf("Delete results of task %s from object store error: %v", taskUUID, err)
+	}
+
+	return b.Backend.PurgeState(taskUUID)
+}
+
+// Unwrap returns the wrapped backend
+func (b *Backend) Unwrap() iface.Backend {
+	return b.Backend
+}
+
+// resolve replaces a reference with the results read from the object store
+func (b *Backend) resolve(state *tasks.TaskState) error {
+	if state == nil || len(state.Results) != 1 || state.Results[0].Type != ReferenceType {
+		return nil
+	}
+
+	key, ok := referenceKey(state.Results)
+	if !ok {
+		return fmt.Errorf("Invalid object reference of task %s: %v", state.TaskUUID, state.Results[0].Value)
+	}
+
+	encoded, err := b.store.Get(context.Background(), key)
+	if err != nil {
+		return fmt.Errorf("Get results of task %s from object store error: %v", state.TaskUUID, err)
+	}
+
+	var results []*tasks.TaskResult
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&results); err != nil {
+		return fmt.Errorf("Failed to unmarshal results of task %s: %v", state.TaskUUID, err)
+	}
+
+	state.Results = results
+	return nil
+}
+
+// referenceKey returns the object key of results replaced by a reference
+func referenceKey(results []*tasks.TaskResult) (string, bool) {
+	if len(results) != 1 || results[0].Type != ReferenceType {
+		return "", false
+	}
+
+	key, ok := results[0].Value.(string)
+	return key, ok
+}
+
+// objectKey returns the key results of a task are stored under
+func objectKey(taskUUID string) string {
+	return fmt.Sprintf("results/%s.json", taskUUID)
+}
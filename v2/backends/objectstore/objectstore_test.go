@@ -0,0 +1,180 @@
+package objectstore_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/objectstore"
+	"github.com/RichardKnop/machinery/v2/backends/result"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+type memoryStore struct {
+	objects map[string][]byte
+	mu      sync.Mutex
+}
+
+func (s *memoryStore) Put(ctx context.Context, key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[key] = data
+	return nil
+}
+
+func (s *memoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return data, nil
+}
+
+func (s *memoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func TestLargeResults(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	wrapped := memory.New(cnf)
+	store := &memoryStore{objects: make(map[string][]byte)}
+	backend := objectstore.New(wrapped, store, 64)
+
+	small := &tasks.Signature{UUID: "smallTaskUUID"}
+	large := &tasks.Signature{UUID: "largeTaskUUID", GroupUUID: "groupUUID"}
+	largeValue := strings.Repeat("a", 100)
+
+	assert.NoError(t, backend.InitGroup("groupUUID", []string{large.UUID}))
+	assert.NoError(t, backend.SetStateSuccess(small, []*tasks.TaskResult{{Type: "string", Value: "b"}}))
+	assert.NoError(t, backend.SetStateSuccess(large, []*tasks.TaskResult{{Type: "string", Value: largeValue}}))
+	assert.Len(t, store.objects, 1)
+
+	// Only the reference is saved in the wrapped backend
+	state, err := wrapped.GetState(large.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, objectstore.ReferenceType, state.Results[0].Type)
+	}
+
+	values, err := result.NewAsyncResult(large, backend).Get(time.Millisecond)
+	if assert.NoError(t, err) {
+		assert.Equal(t, largeValue, values[0].Interface())
+	}
+
+	values, err = result.NewAsyncResult(small, backend).Get(time.Millisecond)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "b", values[0].Interface())
+	}
+
+	states, err := backend.GroupTaskStates("groupUUID", 1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, largeValue, states[0].Results[0].Value)
+	}
+
+	assert.NoError(t, backend.PurgeState(large.UUID))
+	assert.Empty(t, store.objects)
+}
+
+type fakeS3 struct {
+	memoryStore
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := ioutil.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectOutput{}, f.Put(ctx, *params.Bucket+"/"+*params.Key, data)
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, err := f.Get(ctx, *params.Bucket+"/"+*params.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	return &s3.DeleteObjectOutput{}, f.Delete(ctx, *params.Bucket+"/"+*params.Key)
+}
+
+func TestS3Store(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeS3{memoryStore{objects: make(map[string][]byte)}}
+	store := objectstore.NewS3Store(client, "bucket", "machinery")
+	ctx := context.Background()
+
+	assert.NoError(t, store.Put(ctx, "results/taskUUID.json", []byte("[]")))
+	assert.Contains(t, client.objects, "bucket/machinery/results/taskUUID.json")
+
+	data, err := store.Get(ctx, "results/taskUUID.json")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "[]", string(data))
+	}
+
+	assert.NoError(t, store.Delete(ctx, "results/taskUUID.json"))
+	_, err = store.Get(ctx, "results/taskUUID.json")
+	assert.Error(t, err)
+}
+
+func TestStreamResults(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	wrapped := memory.New(cnf)
+	client := &fakeS3{memoryStore{objects: make(map[string][]byte)}}
+	backend := objectstore.New(wrapped, objectstore.NewS3Store(client, "bucket", ""), 64)
+
+	large := &tasks.Signature{UUID: "largeTaskUUID"}
+	small := &tasks.Signature{UUID: "smallTaskUUID"}
+	failed := &tasks.Signature{UUID: "failedTaskUUID"}
+	largeValue := strings.Repeat("a", 100)
+	assert.NoError(t, backend.SetStateSuccess(large, []*tasks.TaskResult{{Type: "string", Value: largeValue}}))
+	assert.NoError(t, backend.SetStateSuccess(small, []*tasks.TaskResult{{Type: "string", Value: "b"}}))
+	assert.NoError(t, backend.SetStateFailure(failed, "some error"))
+
+	for _, signature := range []*tasks.Signature{large, small} {
+		stream, err := result.NewAsyncResult(signature, backend).Stream(time.Millisecond)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		data, err := ioutil.ReadAll(stream)
+		assert.NoError(t, err)
+		assert.NoError(t, stream.Close())
+		assert.Contains(t, string(data), `"Type":"string"`)
+	}
+
+	_, err := result.NewAsyncResult(failed, backend).Stream(time.Millisecond)
+	assert.EqualError(t, err, "some error")
+
+	// Backends which cannot stream results encode them
+	stream, err := result.NewAsyncResult(small, wrapped).StreamWithTimeout(time.Second, time.Millisecond)
+	if assert.NoError(t, err) {
+		data, err := ioutil.ReadAll(stream)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[{"Type":"string","Value":"b"}]`, string(data))
+	}
+
+	pending := &tasks.Signature{UUID: "pendingTaskUUID"}
+	assert.NoError(t, backend.SetStatePending(pending))
+	_, err = result.NewAsyncResult(pending, backend).StreamWithTimeout(10*time.Millisecond, time.Millisecond)
+	assert.Equal(t, result.ErrTimeoutReached, err)
+}
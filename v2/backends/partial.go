@@ -0,0 +1,46 @@
+package backends
+
+import (
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrPartialResultsNotSupported is returned when a backend does not record
+// the partial results emitted by running tasks
+var ErrPartialResultsNotSupported = errors.New("Result backend does not record partial results")
+
+// AppendPartialResult appends the result to the partial results of the task
+// in the backend or the backends it wraps. Encrypted backends do not record
+// partial results, they would be stored in plain text.
+func AppendPartialResult(backend iface.Backend, taskUUID string, result *tasks.TaskResult) error {
+	recorders := partialResultRecorders(backend)
+	if len(recorders) == 0 {
+		return ErrPartialResultsNotSupported
+	}
+
+	for _, recorder := range recorders {
+		if err := recorder.AppendPartialResult(taskUUID, result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PartialResults returns the partial results of the task, read from the first
+// backend recording them
+func PartialResults(backend iface.Backend, taskUUID string) ([]*tasks.TaskResult, error) {
+	recorders := partialResultRecorders(backend)
+	if len(recorders) == 0 {
+		return nil, ErrPartialResultsNotSupported
+	}
+
+	return recorders[0].PartialResults(taskUUID)
+}
+
+// partialResultRecorders returns the backends recording partial results, the
+// backend itself or the backends it wraps
+func partialResultRecorders(backend iface.Backend) []iface.PartialResultRecorder {
+	return plaintextImplementations[iface.PartialResultRecorder](backend)
+}
@@ -0,0 +1,39 @@
+package backends_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/null"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestPartialResults(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	backend := backends.NewTiered(backends.ReadFastest, memory.New(cnf), null.New())
+
+	pages := []*tasks.TaskResult{
+		{Type: "string", Value: "page-1"},
+		{Type: "string", Value: "page-2"},
+	}
+	for _, page := range pages {
+		require.NoError(t, backends.AppendPartialResult(backend, "taskUUID", page))
+	}
+
+	results, err := backends.PartialResults(backend, "taskUUID")
+	if assert.NoError(t, err) {
+		assert.Equal(t, pages, results)
+	}
+
+	err = backends.AppendPartialResult(null.New(), "taskUUID", pages[0])
+	assert.Equal(t, backends.ErrPartialResultsNotSupported, err)
+	_, err = backends.PartialResults(null.New(), "taskUUID")
+	assert.Equal(t, backends.ErrPartialResultsNotSupported, err)
+}
@@ -4,7 +4,8 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"strings"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -19,6 +20,10 @@ import (
 	"github.com/RichardKnop/machinery/v2/tasks"
 )
 
+var completeTaskScriptGR = redis.NewScript(completeTaskLua)
+
+var releaseIdempotencyKeyScriptGR = redis.NewScript(releaseIdempotencyKeyLua)
+
 // BackendGR represents a Redis result backend
 type BackendGR struct {
 	common.Backend
@@ -30,31 +35,35 @@ type BackendGR struct {
 	socketPath string
 	redsync    *redsync.Redsync
 	redisOnce  sync.Once
+	keys       keyLayout
+	// replicas polled task states are read from
+	replicas     []redis.UniversalClient
+	readReplicas *readReplicas
 }
 
 // NewGR creates Backend instance
 func NewGR(cnf *config.Config, addrs []string, db int) iface.Backend {
 	b := &BackendGR{
 		Backend: common.NewBackend(cnf),
+		keys:    newKeyLayout(cnf),
 	}
-	parts := strings.Split(addrs[0], "@")
-	if len(parts) >= 2 {
-		// with passwrod
-		b.password = strings.Join(parts[:len(parts)-1], "@")
-		addrs[0] = parts[len(parts)-1] // addr is the last one without @
-	}
+	b.rclient = common.NewGoRedisClient(addrs, db, cnf.Redis, common.RedisBackendTLSConfig(cnf))
+	b.redsync = redsync.New(redsyncgoredis.NewPool(b.rclient))
 
-	ropt := &redis.UniversalOptions{
-		Addrs:    addrs,
-		DB:       db,
-		Password: b.password,
-	}
+	var maxStaleness int
 	if cnf.Redis != nil {
-		ropt.MasterName = cnf.Redis.MasterName
+		// Replicas are single nodes, read from directly
+		replicaCnf := *cnf.Redis
+		replicaCnf.MasterName = ""
+		replicaCnf.Cluster = false
+		for _, addr := range cnf.Redis.ReadReplicas {
+			replica := common.NewGoRedisClient([]string{addr}, db, &replicaCnf, common.RedisBackendTLSConfig(cnf))
+			b.replicas = append(b.replicas, replica)
+		}
+		maxStaleness = cnf.Redis.ReplicaMaxStaleness
 	}
+	b.readReplicas = newReadReplicas(len(b.replicas), maxStaleness)
 
-	b.rclient = redis.NewUniversalClient(ropt)
-	b.redsync = redsync.New(redsyncgoredis.NewPool(b.rclient))
 	return b
 }
 
@@ -71,23 +80,51 @@ func (b *BackendGR) InitGroup(groupUUID string, taskUUIDs []string) error {
 		return err
 	}
 
+	// Both keys are in the slot of the group when group keys are hash tagged
 	expiration := b.getExpiration()
-	err = b.rclient.Set(context.Background(), groupUUID, encoded, expiration).Err()
+	_, err = b.rclient.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), b.keys.group(groupUUID), encoded, expiration)
+		pipe.Set(context.Background(), b.keys.completedCount(groupUUID), 0, expiration)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if !b.keys.tagStates {
+		return nil
+	}
+
+	// States of the tasks are stored in the slot of the group, they are found
+	// by the task UUID through references in the slots of the tasks
+	_, err = b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, taskUUID := range taskUUIDs {
+			ref := stateRefPrefix + b.keys.state(taskUUID, groupUUID)
+			pipe.Set(context.Background(), b.keys.stateRef(taskUUID), ref, expiration)
+		}
+		return nil
+	})
+	return err
 }
 
 // GroupCompleted returns true if all tasks in a group finished
 func (b *BackendGR) GroupCompleted(groupUUID string, groupTaskCount int) (bool, error) {
+	completed, err := b.rclient.Get(context.Background(), b.keys.completedCount(groupUUID)).Int()
+	if err == nil {
+		return completed == groupTaskCount, nil
+	}
+	if err != redis.Nil {
+		return false, err
+	}
+
+	// Groups initialized without the counter, e.g. by an older version, are
+	// completed when the states of all their tasks are
 	groupMeta, err := b.getGroupMeta(groupUUID)
 	if err != nil {
 		return false, err
 	}
 
-	taskStates, err := b.getStates(groupMeta.TaskUUIDs...)
+	taskStates, err := b.getStates(groupUUID, groupMeta.TaskUUIDs...)
 	if err != nil {
 		return false, err
 	}
@@ -109,7 +146,7 @@ func (b *BackendGR) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*ta
 		return []*tasks.TaskState{}, err
 	}
 
-	return b.getStates(groupMeta.TaskUUIDs...)
+	return b.getStates(groupUUID, groupMeta.TaskUUIDs...)
 }
 
 // TriggerChord flags chord as triggered in the backend storage to make sure
@@ -117,7 +154,7 @@ func (b *BackendGR) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*ta
 // whether the worker should trigger chord (true) or no if it has been triggered
 // already (false)
 func (b *BackendGR) TriggerChord(groupUUID string) (bool, error) {
-	m := b.redsync.NewMutex("TriggerChordMutex")
+	m := b.redsync.NewMutex(b.keys.chordMutex(groupUUID))
 	if err := m.Lock(); err != nil {
 		return false, err
 	}
@@ -143,7 +180,7 @@ func (b *BackendGR) TriggerChord(groupUUID string) (bool, error) {
 	}
 
 	expiration := b.getExpiration()
-	err = b.rclient.Set(context.Background(), groupUUID, encoded, expiration).Err()
+	err = b.rclient.Set(context.Background(), b.keys.group(groupUUID), encoded, expiration).Err()
 	if err != nil {
 		return false, err
 	}
@@ -151,8 +188,8 @@ func (b *BackendGR) TriggerChord(groupUUID string) (bool, error) {
 	return true, nil
 }
 
-func (b *BackendGR) mergeNewTaskState(newState *tasks.TaskState) {
-	state, err := b.GetState(newState.TaskUUID)
+func (b *BackendGR) mergeNewTaskState(newState *tasks.TaskState, groupUUID string) {
+	state, err := b.getState(b.rclient, b.keys.state(newState.TaskUUID, groupUUID))
 	if err == nil {
 		newState.CreatedAt = state.CreatedAt
 		newState.TaskName = state.TaskName
@@ -162,64 +199,105 @@ func (b *BackendGR) mergeNewTaskState(newState *tasks.TaskState) {
 // SetStatePending updates task state to PENDING
 func (b *BackendGR) SetStatePending(signature *tasks.Signature) error {
 	taskState := tasks.NewPendingTaskState(signature)
-	return b.updateState(taskState)
+	return b.updateState(taskState, signature.GroupUUID)
 }
 
 // SetStateReceived updates task state to RECEIVED
 func (b *BackendGR) SetStateReceived(signature *tasks.Signature) error {
 	taskState := tasks.NewReceivedTaskState(signature)
-	b.mergeNewTaskState(taskState)
-	return b.updateState(taskState)
+	b.mergeNewTaskState(taskState, signature.GroupUUID)
+	return b.updateState(taskState, signature.GroupUUID)
 }
 
 // SetStateStarted updates task state to STARTED
 func (b *BackendGR) SetStateStarted(signature *tasks.Signature) error {
 	taskState := tasks.NewStartedTaskState(signature)
-	b.mergeNewTaskState(taskState)
-	return b.updateState(taskState)
+	b.mergeNewTaskState(taskState, signature.GroupUUID)
+	return b.updateState(taskState, signature.GroupUUID)
 }
 
 // SetStateRetry updates task state to RETRY
 func (b *BackendGR) SetStateRetry(signature *tasks.Signature) error {
 	taskState := tasks.NewRetryTaskState(signature)
-	b.mergeNewTaskState(taskState)
-	return b.updateState(taskState)
+	b.mergeNewTaskState(taskState, signature.GroupUUID)
+	return b.updateState(taskState, signature.GroupUUID)
 }
 
 // SetStateSuccess updates task state to SUCCESS
 func (b *BackendGR) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
 	taskState := tasks.NewSuccessTaskState(signature, results)
-	b.mergeNewTaskState(taskState)
-	return b.updateState(taskState)
+	b.mergeNewTaskState(taskState, signature.GroupUUID)
+	if err := b.updateState(taskState, signature.GroupUUID); err != nil {
+		return err
+	}
+	return b.completeTask(signature)
 }
 
 // SetStateFailure updates task state to FAILURE
 func (b *BackendGR) SetStateFailure(signature *tasks.Signature, err string) error {
 	taskState := tasks.NewFailureTaskState(signature, err)
-	b.mergeNewTaskState(taskState)
-	return b.updateState(taskState)
+	b.mergeNewTaskState(taskState, signature.GroupUUID)
+	if err := b.updateState(taskState, signature.GroupUUID); err != nil {
+		return err
+	}
+	return b.completeTask(signature)
 }
 
-// GetState returns the latest task state
+// SetStateCanceled updates task state to CANCELED
+func (b *BackendGR) SetStateCanceled(signature *tasks.Signature) error {
+	taskState := tasks.NewCanceledTaskState(signature)
+	b.mergeNewTaskState(taskState, signature.GroupUUID)
+	if err := b.updateState(taskState, signature.GroupUUID); err != nil {
+		return err
+	}
+	return b.completeTask(signature)
+}
+
+// GetState returns the latest task state. It is read from a read replica when
+// one is configured and not stale, the primary is read when the state has not
+// been replicated yet.
 func (b *BackendGR) GetState(taskUUID string) (*tasks.TaskState, error) {
+	key := b.keys.stateRef(taskUUID)
+	if i := b.readReplicas.pick(b.replicaInfo); i >= 0 {
+		if state, err := b.getState(b.replicas[i], key); err == nil {
+			return state, nil
+		}
+	}
 
-	item, err := b.rclient.Get(context.Background(), taskUUID).Bytes()
+	return b.getState(b.rclient, key)
+}
+
+// getState returns the task state stored under the key, following the
+// reference to the slot of its group
+func (b *BackendGR) getState(client redis.UniversalClient, key string) (*tasks.TaskState, error) {
+	item, err := client.Get(context.Background(), key).Bytes()
 	if err != nil {
 		return nil, err
 	}
-	state := new(tasks.TaskState)
-	decoder := json.NewDecoder(bytes.NewReader(item))
-	decoder.UseNumber()
-	if err := decoder.Decode(state); err != nil {
-		return nil, err
+	if stateKey, ok := b.keys.referencedState(item); ok {
+		if item, err = client.Get(context.Background(), stateKey).Bytes(); err != nil {
+			return nil, err
+		}
 	}
-
-	return state, nil
+	return b.UnmarshalTaskState(item)
 }
 
 // PurgeState deletes stored task state
 func (b *BackendGR) PurgeState(taskUUID string) error {
-	err := b.rclient.Del(context.Background(), taskUUID).Err()
+	ref := b.keys.stateRef(taskUUID)
+	if b.keys.tagStates {
+		item, err := b.rclient.Get(context.Background(), ref).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if stateKey, ok := b.keys.referencedState(item); ok {
+			if err := b.rclient.Del(context.Background(), stateKey).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := b.rclient.Del(context.Background(), ref).Err()
 	if err != nil {
 		return err
 	}
@@ -227,9 +305,471 @@ func (b *BackendGR) PurgeState(taskUUID string) error {
 	return nil
 }
 
+// HealthCheck pings the Redis server
+func (b *BackendGR) HealthCheck(ctx context.Context) error {
+	return b.rclient.Ping(ctx).Err()
+}
+
+// Subscribe returns a channel receiving states of the task published on change,
+// NotifyStateChanges must be enabled
+func (b *BackendGR) Subscribe(ctx context.Context, taskUUID string) (<-chan *tasks.TaskState, error) {
+	if !notifyStateChanges(b.GetConfig()) {
+		return nil, ErrStateNotificationsDisabled
+	}
+
+	pubsub := b.rclient.Subscribe(ctx, b.keys.stateChannel(taskUUID))
+	// Wait for the subscription to be confirmed so no change is missed after
+	// Subscribe returns
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	changes := make(chan *tasks.TaskState, 1)
+	go func() {
+		defer close(changes)
+		defer pubsub.Close()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				state, err := b.UnmarshalTaskState([]byte(message.Payload))
+				deliverState(changes, state, err)
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// AddChild records the task as a child of the parent task
+func (b *BackendGR) AddChild(parentUUID, childUUID string) error {
+	key := b.keys.children(parentUUID)
+	score := float64(time.Now().UnixNano() / int64(time.Microsecond))
+	_, err := b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZAddNX(context.Background(), key, &redis.Z{Score: score, Member: childUUID})
+		pipe.Expire(context.Background(), key, b.getExpiration())
+		return nil
+	})
+	return err
+}
+
+// Children returns UUIDs of the children of the parent task
+func (b *BackendGR) Children(parentUUID string) ([]string, error) {
+	return b.rclient.ZRange(context.Background(), b.keys.children(parentUUID), 0, -1).Result()
+}
+
+// AppendPartialResult appends the result to the partial results of the task
+func (b *BackendGR) AppendPartialResult(taskUUID string, result *tasks.TaskResult) error {
+	encoded, err := b.MarshalTaskResult(result)
+	if err != nil {
+		return err
+	}
+
+	key := b.keys.partialResults(taskUUID)
+	_, err = b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.RPush(context.Background(), key, encoded)
+		pipe.Expire(context.Background(), key, b.getExpiration())
+		return nil
+	})
+	return err
+}
+
+// PartialResults returns the partial results of the task
+func (b *BackendGR) PartialResults(taskUUID string) ([]*tasks.TaskResult, error) {
+	items, err := b.rclient.LRange(context.Background(), b.keys.partialResults(taskUUID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*tasks.TaskResult, 0, len(items))
+	for _, item := range items {
+		result, err := b.UnmarshalTaskResult([]byte(item))
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// AppendFailure appends the failure to the failure history of the task
+func (b *BackendGR) AppendFailure(taskUUID string, failure *tasks.Failure) error {
+	encoded, err := b.MarshalFailure(failure)
+	if err != nil {
+		return err
+	}
+
+	key := b.keys.failures(taskUUID)
+	_, err = b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.RPush(context.Background(), key, encoded)
+		pipe.Expire(context.Background(), key, b.getExpiration())
+		return nil
+	})
+	return err
+}
+
+// Failures returns the failure history of the task
+func (b *BackendGR) Failures(taskUUID string) ([]*tasks.Failure, error) {
+	items, err := b.rclient.LRange(context.Background(), b.keys.failures(taskUUID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]*tasks.Failure, 0, len(items))
+	for _, item := range items {
+		failure, err := b.UnmarshalFailure([]byte(item))
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+	return failures, nil
+}
+
+// RecordFailedTask records the failed task, failed tasks older than the
+// results expiration are removed
+func (b *BackendGR) RecordFailedTask(failed *tasks.FailedTask) error {
+	encoded, err := json.Marshal(failed)
+	if err != nil {
+		return err
+	}
+
+	expired := time.Now().Add(-b.getExpiration()).UnixNano() / int64(time.Millisecond)
+	expiredUUIDs, err := b.rclient.ZRangeByScore(context.Background(), b.keys.failedTasks(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("(%d", expired),
+	}).Result()
+	if err != nil {
+		return err
+	}
+	for _, taskUUID := range expiredUUIDs {
+		if err := b.RemoveFailedTask(taskUUID); err != nil {
+			return err
+		}
+	}
+
+	_, err = b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(context.Background(), b.keys.failedTasks(), &redis.Z{
+			Score:  float64(failed.FailedAt.UnixNano() / int64(time.Millisecond)),
+			Member: failed.Signature.UUID,
+		})
+		pipe.HSet(context.Background(), b.keys.failedTaskRecords(), failed.Signature.UUID, encoded)
+		return nil
+	})
+	return err
+}
+
+// FailedTask returns the failed task, nil if it has not been recorded
+func (b *BackendGR) FailedTask(taskUUID string) (*tasks.FailedTask, error) {
+	encoded, err := b.rclient.HGet(context.Background(), b.keys.failedTaskRecords(), taskUUID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	failed := new(tasks.FailedTask)
+	if err := json.Unmarshal(encoded, failed); err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// FailedTasks returns the tasks with the name which failed since the time, of
+// any name if it is empty, oldest first
+func (b *BackendGR) FailedTasks(taskName string, since time.Time) ([]*tasks.FailedTask, error) {
+	taskUUIDs, err := b.rclient.ZRangeByScore(context.Background(), b.keys.failedTasks(), &redis.ZRangeBy{
+		Min: fmt.Sprintf("%d", since.UnixNano()/int64(time.Millisecond)),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(taskUUIDs) == 0 {
+		return []*tasks.FailedTask{}, err
+	}
+
+	values, err := b.rclient.HMGet(context.Background(), b.keys.failedTaskRecords(), taskUUIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			encoded[i] = []byte(s)
+		}
+	}
+	return decodeFailedTasks(encoded, taskName)
+}
+
+// RemoveFailedTask removes the failed task
+func (b *BackendGR) RemoveFailedTask(taskUUID string) error {
+	_, err := b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZRem(context.Background(), b.keys.failedTasks(), taskUUID)
+		pipe.HDel(context.Background(), b.keys.failedTaskRecords(), taskUUID)
+		return nil
+	})
+	return err
+}
+
+// SaveSchedule creates the schedule or replaces the one with its name
+func (b *BackendGR) SaveSchedule(schedule *tasks.Schedule) error {
+	encoded, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	return b.rclient.HSet(context.Background(), b.keys.schedules(), schedule.Name, encoded).Err()
+}
+
+// Schedule returns the schedule with the name, nil if there is none
+func (b *BackendGR) Schedule(name string) (*tasks.Schedule, error) {
+	encoded, err := b.rclient.HGet(context.Background(), b.keys.schedules(), name).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := new(tasks.Schedule)
+	if err := json.Unmarshal(encoded, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Schedules returns the stored schedules sorted by name
+func (b *BackendGR) Schedules() ([]*tasks.Schedule, error) {
+	values, err := b.rclient.HVals(context.Background(), b.keys.schedules()).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		encoded[i] = []byte(value)
+	}
+	return decodeSchedules(encoded)
+}
+
+// DeleteSchedule deletes the schedule with the name and its last run, if any
+func (b *BackendGR) DeleteSchedule(name string) error {
+	_, err := b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.HDel(context.Background(), b.keys.schedules(), name)
+		pipe.HDel(context.Background(), b.keys.scheduleRuns(), name)
+		return nil
+	})
+	return err
+}
+
+// SetScheduleLastRun records when the schedule with the name was run
+func (b *BackendGR) SetScheduleLastRun(name string, at time.Time) error {
+	return b.rclient.HSet(context.Background(), b.keys.scheduleRuns(), name, at.UnixNano()).Err()
+}
+
+// ScheduleLastRun returns when the schedule with the name was run for the
+// last time, the zero time if it was never run
+func (b *BackendGR) ScheduleLastRun(name string) (time.Time, error) {
+	at, err := b.rclient.HGet(context.Background(), b.keys.scheduleRuns(), name).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, at).UTC(), nil
+}
+
+// CountDelivery counts a delivery of the task
+func (b *BackendGR) CountDelivery(taskUUID string) (int, error) {
+	key := b.keys.deliveries(taskUUID)
+
+	var incr *redis.IntCmd
+	_, err := b.rclient.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(context.Background(), key)
+		pipe.Expire(context.Background(), key, b.getExpiration())
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// ResetDeliveries resets the deliveries of the task
+func (b *BackendGR) ResetDeliveries(taskUUID string) error {
+	return b.rclient.Del(context.Background(), b.keys.deliveries(taskUUID)).Err()
+}
+
+// Heartbeat records that the task is still running
+func (b *BackendGR) Heartbeat(signature *tasks.Signature) error {
+	encoded, err := json.Marshal(signature)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(context.Background(), b.keys.heartbeats(), &redis.Z{Score: float64(time.Now().Unix()), Member: signature.UUID})
+		pipe.HSet(context.Background(), b.keys.heartbeatSignatures(), signature.UUID, encoded)
+		return nil
+	})
+	return err
+}
+
+// RemoveHeartbeat removes the heartbeat of the task
+func (b *BackendGR) RemoveHeartbeat(taskUUID string) (bool, error) {
+	removed, err := b.rclient.ZRem(context.Background(), b.keys.heartbeats(), taskUUID).Result()
+	if err != nil {
+		return false, err
+	}
+	if err := b.rclient.HDel(context.Background(), b.keys.heartbeatSignatures(), taskUUID).Err(); err != nil {
+		return false, err
+	}
+	return removed == 1, nil
+}
+
+// StaleHeartbeats returns signatures of the tasks whose latest heartbeat is
+// older than the time
+func (b *BackendGR) StaleHeartbeats(before time.Time) ([]*tasks.Signature, error) {
+	taskUUIDs, err := b.rclient.ZRangeByScore(context.Background(), b.keys.heartbeats(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("(%d", before.Unix()),
+	}).Result()
+	if err != nil || len(taskUUIDs) == 0 {
+		return nil, err
+	}
+
+	values, err := b.rclient.HMGet(context.Background(), b.keys.heartbeatSignatures(), taskUUIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			encoded[i] = []byte(s)
+		}
+	}
+	return decodeHeartbeatSignatures(encoded)
+}
+
+// RegisterWorker records the worker until the TTL passed
+func (b *BackendGR) RegisterWorker(worker *tasks.WorkerInfo, ttl time.Duration) error {
+	encoded, err := json.Marshal(worker)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(context.Background(), b.keys.workers(), &redis.Z{
+			Score:  float64(time.Now().Add(ttl).UnixNano() / int64(time.Millisecond)),
+			Member: worker.ID,
+		})
+		pipe.HSet(context.Background(), b.keys.workerInfos(), worker.ID, encoded)
+		return nil
+	})
+	return err
+}
+
+// UnregisterWorker removes the worker
+func (b *BackendGR) UnregisterWorker(workerID string) error {
+	_, err := b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.ZRem(context.Background(), b.keys.workers(), workerID)
+		pipe.HDel(context.Background(), b.keys.workerInfos(), workerID)
+		return nil
+	})
+	return err
+}
+
+// Workers returns the registered workers ordered by their IDs, workers whose
+// registration expired are removed
+func (b *BackendGR) Workers() ([]*tasks.WorkerInfo, error) {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	expired, err := b.rclient.ZRangeByScore(context.Background(), b.keys.workers(), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: fmt.Sprintf("%d", now),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, workerID := range expired {
+		if err := b.UnregisterWorker(workerID); err != nil {
+			return nil, err
+		}
+	}
+
+	workerIDs, err := b.rclient.ZRangeByScore(context.Background(), b.keys.workers(), &redis.ZRangeBy{
+		Min: fmt.Sprintf("(%d", now),
+		Max: "+inf",
+	}).Result()
+	if err != nil || len(workerIDs) == 0 {
+		return []*tasks.WorkerInfo{}, err
+	}
+	sort.Strings(workerIDs)
+
+	values, err := b.rclient.HMGet(context.Background(), b.keys.workerInfos(), workerIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		if s, ok := value.(string); ok {
+			encoded[i] = []byte(s)
+		}
+	}
+	return decodeWorkers(encoded)
+}
+
+// ClaimIdempotencyKey records the task under the key for the window unless a
+// task has been recorded under it already
+func (b *BackendGR) ClaimIdempotencyKey(key, taskUUID string, window time.Duration) (string, bool, error) {
+	redisKey := b.keys.idempotencyKey(key)
+	// The recorded task may expire between setting and getting the key
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		claimed, err := b.rclient.SetNX(context.Background(), redisKey, taskUUID, window).Result()
+		if err != nil {
+			return "", false, err
+		}
+		if claimed {
+			return taskUUID, true, nil
+		}
+
+		existing, err := b.rclient.Get(context.Background(), redisKey).Result()
+		if err == nil {
+			return existing, existing == taskUUID, nil
+		}
+		if err != redis.Nil {
+			return "", false, err
+		}
+	}
+	return "", false, fmt.Errorf("Failed to claim idempotency key %s", key)
+}
+
+// ReleaseIdempotencyKey deletes the key if the task is recorded under it
+func (b *BackendGR) ReleaseIdempotencyKey(key, taskUUID string) error {
+	return releaseIdempotencyKeyScriptGR.Run(
+		context.Background(),
+		b.rclient,
+		[]string{b.keys.idempotencyKey(key)},
+		taskUUID,
+	).Err()
+}
+
 // PurgeGroupMeta deletes stored group meta data
 func (b *BackendGR) PurgeGroupMeta(groupUUID string) error {
-	err := b.rclient.Del(context.Background(), groupUUID).Err()
+	err := b.rclient.Del(
+		context.Background(),
+		b.keys.group(groupUUID),
+		b.keys.completedCount(groupUUID),
+		b.keys.completedTasks(groupUUID),
+	).Err()
 	if err != nil {
 		return err
 	}
@@ -239,7 +779,7 @@ func (b *BackendGR) PurgeGroupMeta(groupUUID string) error {
 
 // getGroupMeta retrieves group meta data, convenience function to avoid repetition
 func (b *BackendGR) getGroupMeta(groupUUID string) (*tasks.GroupMeta, error) {
-	item, err := b.rclient.Get(context.Background(), groupUUID).Bytes()
+	item, err := b.rclient.Get(context.Background(), b.keys.group(groupUUID)).Bytes()
 	if err != nil {
 		return nil, err
 	}
@@ -254,13 +794,13 @@ func (b *BackendGR) getGroupMeta(groupUUID string) (*tasks.GroupMeta, error) {
 	return groupMeta, nil
 }
 
-// getStates returns multiple task states
-func (b *BackendGR) getStates(taskUUIDs ...string) ([]*tasks.TaskState, error) {
+// getStates returns multiple task states of a group
+func (b *BackendGR) getStates(groupUUID string, taskUUIDs ...string) ([]*tasks.TaskState, error) {
 	taskStates := make([]*tasks.TaskState, len(taskUUIDs))
 	// to avoid CROSSSLOT error, use pipeline
 	cmders, err := b.rclient.Pipelined(context.Background(), func(pipeliner redis.Pipeliner) error {
 		for _, uuid := range taskUUIDs {
-			pipeliner.Get(context.Background(), uuid)
+			pipeliner.Get(context.Background(), b.keys.state(uuid, groupUUID))
 		}
 		return nil
 	})
@@ -272,10 +812,8 @@ func (b *BackendGR) getStates(taskUUIDs ...string) ([]*tasks.TaskState, error) {
 		if err1 != nil {
 			return taskStates, err1
 		}
-		taskState := new(tasks.TaskState)
-		decoder := json.NewDecoder(bytes.NewReader(stateBytes))
-		decoder.UseNumber()
-		if err1 = decoder.Decode(taskState); err1 != nil {
+		taskState, err1 := b.UnmarshalTaskState(stateBytes)
+		if err1 != nil {
 			log.ERROR.Print(err1)
 			return taskStates, err1
 		}
@@ -285,20 +823,46 @@ func (b *BackendGR) getStates(taskUUIDs ...string) ([]*tasks.TaskState, error) {
 	return taskStates, nil
 }
 
-// updateState saves current task state
-func (b *BackendGR) updateState(taskState *tasks.TaskState) error {
-	encoded, err := json.Marshal(taskState)
+// updateState saves current task state of a task of the group
+func (b *BackendGR) updateState(taskState *tasks.TaskState, groupUUID string) error {
+	encoded, err := b.MarshalTaskState(taskState)
 	if err != nil {
 		return err
 	}
 
 	expiration := b.getExpiration()
-	_, err = b.rclient.Set(context.Background(), taskState.TaskUUID, encoded, expiration).Result()
-	if err != nil {
+	key := b.keys.state(taskState.TaskUUID, groupUUID)
+	if !notifyStateChanges(b.GetConfig()) {
+		_, err = b.rclient.Set(context.Background(), key, encoded, expiration).Result()
 		return err
 	}
 
-	return nil
+	_, err = b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		pipe.Set(context.Background(), key, encoded, expiration)
+		pipe.Publish(context.Background(), b.keys.stateChannel(taskState.TaskUUID), encoded)
+		return nil
+	})
+	return err
+}
+
+// replicaInfo returns the INFO replication section of a read replica
+func (b *BackendGR) replicaInfo(i int) (string, error) {
+	return b.replicas[i].Info(context.Background(), "replication").Result()
+}
+
+// completeTask counts the finished task in the completed tasks of its group
+func (b *BackendGR) completeTask(signature *tasks.Signature) error {
+	if signature.GroupUUID == "" {
+		return nil
+	}
+
+	return completeTaskScriptGR.Run(
+		context.Background(),
+		b.rclient,
+		[]string{b.keys.completedCount(signature.GroupUUID), b.keys.completedTasks(signature.GroupUUID)},
+		signature.UUID,
+		int64(b.getExpiration().Seconds()),
+	).Err()
 }
 
 // getExpiration returns expiration for a stored task state
@@ -52,10 +52,10 @@ func TestGroupCompletedGR(t *testing.T) {
 
 	backend.InitGroup(groupUUID, []string{task1.UUID, task2.UUID})
 
+	// The completed tasks counter of the group starts at 0
 	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
-	if assert.Error(t, err) {
+	if assert.NoError(t, err) {
 		assert.False(t, groupCompleted)
-		assert.Equal(t, "redis: nil", err.Error())
 	}
 
 	backend.SetStatePending(task1)
@@ -73,6 +73,13 @@ func TestGroupCompletedGR(t *testing.T) {
 		assert.False(t, groupCompleted)
 	}
 
+	// Saving the final state of a task again does not count it twice
+	backend.SetStateSuccess(task2, taskResults)
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.False(t, groupCompleted)
+	}
+
 	backend.SetStateFailure(task1, "Some error")
 	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
 	if assert.NoError(t, err) {
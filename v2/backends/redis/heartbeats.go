@@ -0,0 +1,80 @@
+package redis
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// decodeWorkers decodes registered workers, workers which have been
+// unregistered in the meantime are skipped
+func decodeWorkers(encoded [][]byte) ([]*tasks.WorkerInfo, error) {
+	workers := make([]*tasks.WorkerInfo, 0, len(encoded))
+	for _, value := range encoded {
+		if value == nil {
+			continue
+		}
+
+		worker := new(tasks.WorkerInfo)
+		if err := json.Unmarshal(value, worker); err != nil {
+			return nil, err
+		}
+		workers = append(workers, worker)
+	}
+	return workers, nil
+}
+
+// decodeHeartbeatSignatures decodes signatures saved with heartbeats, tasks
+// whose signature has been removed in the meantime are skipped
+func decodeHeartbeatSignatures(encoded [][]byte) ([]*tasks.Signature, error) {
+	signatures := make([]*tasks.Signature, 0, len(encoded))
+	for _, value := range encoded {
+		if value == nil {
+			continue
+		}
+
+		signature := new(tasks.Signature)
+		if err := json.Unmarshal(value, signature); err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures, nil
+}
+
+// decodeFailedTasks decodes recorded failed tasks with the name, of any name
+// if it is empty, tasks which have been removed in the meantime are skipped
+func decodeFailedTasks(encoded [][]byte, taskName string) ([]*tasks.FailedTask, error) {
+	failedTasks := make([]*tasks.FailedTask, 0, len(encoded))
+	for _, value := range encoded {
+		if value == nil {
+			continue
+		}
+
+		failed := new(tasks.FailedTask)
+		if err := json.Unmarshal(value, failed); err != nil {
+			return nil, err
+		}
+		if taskName == "" || failed.Signature.Name == taskName {
+			failedTasks = append(failedTasks, failed)
+		}
+	}
+	return failedTasks, nil
+}
+
+// decodeSchedules decodes stored schedules sorted by name
+func decodeSchedules(encoded [][]byte) ([]*tasks.Schedule, error) {
+	schedules := make([]*tasks.Schedule, 0, len(encoded))
+	for _, value := range encoded {
+		schedule := new(tasks.Schedule)
+		if err := json.Unmarshal(value, schedule); err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+	return schedules, nil
+}
@@ -0,0 +1,170 @@
+package redis
+
+import (
+	"strings"
+
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+// stateRefPrefix starts the value saved under the task UUID of a task whose
+// state is stored in the slot of its group, it is followed by the key of the
+// state. It cannot start an encoded task state.
+const stateRefPrefix = "\x00MRF"
+
+// keyLayout builds the names of the keys used by the backend
+type keyLayout struct {
+	namespace string
+	// tagGroups hash tags the keys of a group so they share a slot
+	tagGroups bool
+	// tagStates stores states of tasks in a group in the slot of the group
+	tagStates bool
+}
+
+func newKeyLayout(cnf *config.Config) keyLayout {
+	if cnf.Redis == nil {
+		return keyLayout{}
+	}
+
+	return keyLayout{
+		namespace: cnf.Redis.KeyNamespace,
+		tagGroups: cnf.Redis.Cluster || cnf.Redis.HashTagKeys,
+		tagStates: cnf.Redis.HashTagKeys,
+	}
+}
+
+// group returns the key of the group meta data
+func (k keyLayout) group(groupUUID string) string {
+	if k.tagGroups {
+		return k.namespace + common.RedisHashTag(groupUUID)
+	}
+	return k.namespace + groupUUID
+}
+
+// completedCount returns the key of the number of finished tasks of a group
+func (k keyLayout) completedCount(groupUUID string) string {
+	return k.group(groupUUID) + ":completed_count"
+}
+
+// completedTasks returns the key of the set of finished tasks of a group
+func (k keyLayout) completedTasks(groupUUID string) string {
+	return k.group(groupUUID) + ":completed"
+}
+
+// chordMutex returns the name of the mutex guarding chord triggering. When
+// group keys are hash tagged there is a mutex per group, stored in its slot
+func (k keyLayout) chordMutex(groupUUID string) string {
+	if k.tagGroups {
+		return k.group(groupUUID) + ":chord_mutex"
+	}
+	return k.namespace + "TriggerChordMutex"
+}
+
+// state returns the key of the state of a task. With hash tagged states,
+// states of tasks in a group are stored in the slot of the group and stateRef
+// refers to them.
+func (k keyLayout) state(taskUUID, groupUUID string) string {
+	if k.tagStates && groupUUID != "" {
+		return k.group(groupUUID) + ":" + taskUUID
+	}
+	return k.stateRef(taskUUID)
+}
+
+// stateRef returns the key a state is looked up with by the task UUID only
+func (k keyLayout) stateRef(taskUUID string) string {
+	if k.tagStates {
+		return k.namespace + common.RedisHashTag(taskUUID)
+	}
+	return k.namespace + taskUUID
+}
+
+// stateChannel returns the pub/sub channel changes of a task state are
+// published on
+func (k keyLayout) stateChannel(taskUUID string) string {
+	return k.namespace + "machinery_task_state:" + taskUUID
+}
+
+// children returns the key of the sorted set of the child tasks of a task,
+// scored by when they were added
+func (k keyLayout) children(parentUUID string) string {
+	return k.namespace + "machinery_children:" + parentUUID
+}
+
+// partialResults returns the key of the list of the partial results of a
+// task in the order they were emitted
+func (k keyLayout) partialResults(taskUUID string) string {
+	return k.namespace + "machinery_partial_results:" + taskUUID
+}
+
+// failures returns the key of the list of the failed attempts of a task,
+// oldest first
+func (k keyLayout) failures(taskUUID string) string {
+	return k.namespace + "machinery_failures:" + taskUUID
+}
+
+// failedTasks returns the key of the sorted set of the tasks which failed for
+// good, scored by the unix time in milliseconds they failed at
+func (k keyLayout) failedTasks() string {
+	return k.namespace + "machinery_failed_tasks"
+}
+
+// failedTaskRecords returns the key of the hash of the failed tasks by their
+// UUIDs
+func (k keyLayout) failedTaskRecords() string {
+	return k.failedTasks() + ":records"
+}
+
+// schedules returns the key of the hash of the schedules of periodic tasks by
+// their names
+func (k keyLayout) schedules() string {
+	return k.namespace + "machinery_schedules"
+}
+
+// scheduleRuns returns the key of the hash of the last runs of schedules by
+// their names
+func (k keyLayout) scheduleRuns() string {
+	return k.namespace + "machinery_schedule_runs"
+}
+
+// deliveries returns the key of the counter of deliveries of a task
+func (k keyLayout) deliveries(taskUUID string) string {
+	return k.namespace + "machinery_deliveries:" + taskUUID
+}
+
+// heartbeats returns the key of the sorted set of running tasks, scored by
+// the unix time of their latest heartbeat
+func (k keyLayout) heartbeats() string {
+	return k.namespace + "machinery_heartbeats"
+}
+
+// heartbeatSignatures returns the key of the hash of signatures of running
+// tasks by their UUIDs
+func (k keyLayout) heartbeatSignatures() string {
+	return k.heartbeats() + ":signatures"
+}
+
+// workers returns the key of the sorted set of registered workers, scored by
+// the unix time in milliseconds their registration expires at
+func (k keyLayout) workers() string {
+	return k.namespace + "machinery_workers"
+}
+
+// workerInfos returns the key of the hash of registered workers by their IDs
+func (k keyLayout) workerInfos() string {
+	return k.workers() + ":info"
+}
+
+// idempotencyKey returns the key the task sent with the idempotency key is
+// recorded under
+func (k keyLayout) idempotencyKey(key string) string {
+	return k.namespace + "machinery_idempotency:" + key
+}
+
+// referencedState returns the key of the state a stored value refers to, if
+// it is a reference to the state of a task in the slot of its group
+func (k keyLayout) referencedState(value []byte) (string, bool) {
+	if !k.tagStates || !strings.HasPrefix(string(value), stateRefPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(string(value), stateRefPrefix), true
+}
@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+func TestKeyLayout(t *testing.T) {
+	t.Parallel()
+
+	// Keys are unchanged by default
+	keys := newKeyLayout(new(config.Config))
+	assert.Equal(t, "groupUUID", keys.group("groupUUID"))
+	assert.Equal(t, "groupUUID:completed_count", keys.completedCount("groupUUID"))
+	assert.Equal(t, "taskUUID", keys.state("taskUUID", "groupUUID"))
+	assert.Equal(t, "taskUUID", keys.stateRef("taskUUID"))
+	assert.Equal(t, "TriggerChordMutex", keys.chordMutex("groupUUID"))
+
+	keys = newKeyLayout(&config.Config{Redis: &config.RedisConfig{Cluster: true}})
+	assert.Equal(t, "{groupUUID}", keys.group("groupUUID"))
+	assert.Equal(t, "{groupUUID}:chord_mutex", keys.chordMutex("groupUUID"))
+	assert.Equal(t, "taskUUID", keys.state("taskUUID", "groupUUID"))
+
+	keys = newKeyLayout(&config.Config{
+		Redis: &config.RedisConfig{HashTagKeys: true, KeyNamespace: "machinery:"},
+	})
+	assert.Equal(t, "machinery:{groupUUID}", keys.group("groupUUID"))
+	assert.Equal(t, "machinery:{groupUUID}:completed", keys.completedTasks("groupUUID"))
+	assert.Equal(t, "machinery:{groupUUID}:taskUUID", keys.state("taskUUID", "groupUUID"))
+	assert.Equal(t, "machinery:{taskUUID}", keys.state("taskUUID", ""))
+	assert.Equal(t, "machinery:{taskUUID}", keys.stateRef("taskUUID"))
+
+	stateKey, ok := keys.referencedState([]byte(stateRefPrefix + "machinery:{groupUUID}:taskUUID"))
+	assert.True(t, ok)
+	assert.Equal(t, "machinery:{groupUUID}:taskUUID", stateKey)
+
+	_, ok = keys.referencedState([]byte(`{"TaskUUID":"taskUUID"}`))
+	assert.False(t, ok)
+}
@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrStateNotificationsDisabled is returned by Subscribe when the backend does
+// not publish changes of task states
+var ErrStateNotificationsDisabled = errors.New("Task state notifications are disabled, enable NotifyStateChanges in the Redis config")
+
+// notifyStateChanges returns true if task states are published on change
+func notifyStateChanges(cnf *config.Config) bool {
+	return cnf.Redis != nil && cnf.Redis.NotifyStateChanges
+}
+
+// deliverState decodes a published task state and sends it to the subscriber,
+// it is dropped if the subscriber has not received the previous one yet
+func deliverState(changes chan<- *tasks.TaskState, state *tasks.TaskState, err error) {
+	if err != nil {
+		log.ERROR.Printf("Failed to unmarshal published task state: %v", err)
+		return
+	}
+
+	select {
+	case changes <- state:
+	default:
+	}
+}
@@ -2,8 +2,11 @@ package redis
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,6 +21,38 @@ import (
 	"github.com/RichardKnop/machinery/v2/tasks"
 )
 
+// completeTaskLua counts a finished task of a group in the group's completed
+// tasks counter (KEYS[1]). The task UUID is added to a set (KEYS[2]) first so
+// a task whose final state is saved again, e.g. after a redelivery, is only
+// counted once. Groups initialized without the counter are left alone.
+const completeTaskLua = `
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if redis.call('SADD', KEYS[2], ARGV[1]) == 1 then
+	redis.call('EXPIRE', KEYS[2], ARGV[2])
+	redis.call('INCR', KEYS[1])
+end
+return 1
+`
+
+var completeTaskScript = redis.NewScript(2, completeTaskLua)
+
+// releaseIdempotencyKeyLua deletes the idempotency key (KEYS[1]) if the task
+// (ARGV[1]) is recorded under it
+const releaseIdempotencyKeyLua = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`
+
+var releaseIdempotencyKeyScript = redis.NewScript(1, releaseIdempotencyKeyLua)
+
+// maxClaimAttempts limits how often claiming an idempotency key is attempted
+// when the task recorded under it keeps expiring in the meantime
+const maxClaimAttempts = 3
+
 // Backend represents a Redis result backend
 type Backend struct {
 	common.Backend
@@ -29,6 +64,10 @@ type Backend struct {
 	socketPath string
 	redsync    *redsync.Redsync
 	redisOnce  sync.Once
+	keys       keyLayout
+	// pools of the replicas polled task states are read from
+	replicaPools []*redis.Pool
+	readReplicas *readReplicas
 	common.RedisConnector
 }
 
@@ -36,6 +75,7 @@ type Backend struct {
 func New(cnf *config.Config, host, password, socketPath string, db int) iface.Backend {
 	return &Backend{
 		Backend:    common.NewBackend(cnf),
+		keys:       newKeyLayout(cnf),
 		host:       host,
 		db:         db,
 		password:   password,
@@ -60,12 +100,26 @@ func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
 	defer conn.Close()
 
 	expiration := int64(b.getExpiration().Seconds())
-	_, err = conn.Do("SET", groupUUID, encoded, "EX", expiration)
+	_ = conn.Send("MULTI")
+	_ = conn.Send("SET", b.keys.group(groupUUID), encoded, "EX", expiration)
+	_ = conn.Send("SET", b.keys.completedCount(groupUUID), 0, "EX", expiration)
+	_, err = conn.Do("EXEC")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if !b.keys.tagStates {
+		return nil
+	}
+
+	// States of the tasks are stored in the slot of the group, they are found
+	// by the task UUID through references in the slots of the tasks
+	for _, taskUUID := range taskUUIDs {
+		ref := stateRefPrefix + b.keys.state(taskUUID, groupUUID)
+		_ = conn.Send("SET", b.keys.stateRef(taskUUID), ref, "EX", expiration)
+	}
+	_, err = conn.Do("")
+	return err
 }
 
 // GroupCompleted returns true if all tasks in a group finished
@@ -73,12 +127,22 @@ func (b *Backend) GroupCompleted(groupUUID string, groupTaskCount int) (bool, er
 	conn := b.open()
 	defer conn.Close()
 
+	completed, err := redis.Int(conn.Do("GET", b.keys.completedCount(groupUUID)))
+	if err == nil {
+		return completed == groupTaskCount, nil
+	}
+	if err != redis.ErrNil {
+		return false, err
+	}
+
+	// Groups initialized without the counter, e.g. by an older version, are
+	// completed when the states of all their tasks are
 	groupMeta, err := b.getGroupMeta(conn, groupUUID)
 	if err != nil {
 		return false, err
 	}
 
-	taskStates, err := b.getStates(conn, groupMeta.TaskUUIDs...)
+	taskStates, err := b.getStates(conn, groupUUID, groupMeta.TaskUUIDs...)
 	if err != nil {
 		return false, err
 	}
@@ -103,7 +167,7 @@ func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*task
 		return []*tasks.TaskState{}, err
 	}
 
-	return b.getStates(conn, groupMeta.TaskUUIDs...)
+	return b.getStates(conn, groupUUID, groupMeta.TaskUUIDs...)
 }
 
 // TriggerChord flags chord as triggered in the backend storage to make sure
@@ -114,7 +178,7 @@ func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
 	conn := b.open()
 	defer conn.Close()
 
-	m := b.redsync.NewMutex("TriggerChordMutex")
+	m := b.redsync.NewMutex(b.keys.chordMutex(groupUUID))
 	if err := m.Lock(); err != nil {
 		return false, err
 	}
@@ -140,7 +204,7 @@ func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
 	}
 
 	expiration := int64(b.getExpiration().Seconds())
-	_, err = conn.Do("SET", groupUUID, encoded, "EX", expiration)
+	_, err = conn.Do("SET", b.keys.group(groupUUID), encoded, "EX", expiration)
 	if err != nil {
 		return false, err
 	}
@@ -148,8 +212,8 @@ func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
 	return true, nil
 }
 
-func (b *Backend) mergeNewTaskState(conn redis.Conn, newState *tasks.TaskState) {
-	state, err := b.getState(conn, newState.TaskUUID)
+func (b *Backend) mergeNewTaskState(conn redis.Conn, newState *tasks.TaskState, groupUUID string) {
+	state, err := b.getState(conn, b.keys.state(newState.TaskUUID, groupUUID))
 	if err == nil {
 		newState.CreatedAt = state.CreatedAt
 		newState.TaskName = state.TaskName
@@ -162,7 +226,7 @@ func (b *Backend) SetStatePending(signature *tasks.Signature) error {
 	defer conn.Close()
 
 	taskState := tasks.NewPendingTaskState(signature)
-	return b.updateState(conn, taskState)
+	return b.updateState(conn, taskState, signature.GroupUUID)
 }
 
 // SetStateReceived updates task state to RECEIVED
@@ -171,8 +235,8 @@ func (b *Backend) SetStateReceived(signature *tasks.Signature) error {
 	defer conn.Close()
 
 	taskState := tasks.NewReceivedTaskState(signature)
-	b.mergeNewTaskState(conn, taskState)
-	return b.updateState(conn, taskState)
+	b.mergeNewTaskState(conn, taskState, signature.GroupUUID)
+	return b.updateState(conn, taskState, signature.GroupUUID)
 }
 
 // SetStateStarted updates task state to STARTED
@@ -181,8 +245,8 @@ func (b *Backend) SetStateStarted(signature *tasks.Signature) error {
 	defer conn.Close()
 
 	taskState := tasks.NewStartedTaskState(signature)
-	b.mergeNewTaskState(conn, taskState)
-	return b.updateState(conn, taskState)
+	b.mergeNewTaskState(conn, taskState, signature.GroupUUID)
+	return b.updateState(conn, taskState, signature.GroupUUID)
 }
 
 // SetStateRetry updates task state to RETRY
@@ -191,8 +255,8 @@ func (b *Backend) SetStateRetry(signature *tasks.Signature) error {
 	defer conn.Close()
 
 	taskState := tasks.NewRetryTaskState(signature)
-	b.mergeNewTaskState(conn, taskState)
-	return b.updateState(conn, taskState)
+	b.mergeNewTaskState(conn, taskState, signature.GroupUUID)
+	return b.updateState(conn, taskState, signature.GroupUUID)
 }
 
 // SetStateSuccess updates task state to SUCCESS
@@ -201,8 +265,11 @@ func (b *Backend) SetStateSuccess(signature *tasks.Signature, results []*tasks.T
 	defer conn.Close()
 
 	taskState := tasks.NewSuccessTaskState(signature, results)
-	b.mergeNewTaskState(conn, taskState)
-	return b.updateState(conn, taskState)
+	b.mergeNewTaskState(conn, taskState, signature.GroupUUID)
+	if err := b.updateState(conn, taskState, signature.GroupUUID); err != nil {
+		return err
+	}
+	return b.completeTask(conn, signature)
 }
 
 // SetStateFailure updates task state to FAILURE
@@ -211,31 +278,59 @@ func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error
 	defer conn.Close()
 
 	taskState := tasks.NewFailureTaskState(signature, err)
-	b.mergeNewTaskState(conn, taskState)
-	return b.updateState(conn, taskState)
+	b.mergeNewTaskState(conn, taskState, signature.GroupUUID)
+	if err := b.updateState(conn, taskState, signature.GroupUUID); err != nil {
+		return err
+	}
+	return b.completeTask(conn, signature)
+}
+
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	conn := b.open()
+	defer conn.Close()
+
+	taskState := tasks.NewCanceledTaskState(signature)
+	b.mergeNewTaskState(conn, taskState, signature.GroupUUID)
+	if err := b.updateState(conn, taskState, signature.GroupUUID); err != nil {
+		return err
+	}
+	return b.completeTask(conn, signature)
 }
 
-// GetState returns the latest task state
+// GetState returns the latest task state. It is read from a read replica when
+// one is configured and not stale, the primary is read when the state has not
+// been replicated yet.
 func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
 	conn := b.open()
 	defer conn.Close()
 
-	return b.getState(conn, taskUUID)
+	key := b.keys.stateRef(taskUUID)
+	if i := b.readReplicas.pick(b.replicaInfo); i >= 0 {
+		replicaConn := b.replicaPools[i].Get()
+		state, err := b.getState(replicaConn, key)
+		replicaConn.Close()
+		if err == nil {
+			return state, nil
+		}
+	}
+
+	return b.getState(conn, key)
 }
 
-func (b *Backend) getState(conn redis.Conn, taskUUID string) (*tasks.TaskState, error) {
-	item, err := redis.Bytes(conn.Do("GET", taskUUID))
+// getState returns the task state stored under the key, following the
+// reference to the slot of its group
+func (b *Backend) getState(conn redis.Conn, key string) (*tasks.TaskState, error) {
+	item, err := redis.Bytes(conn.Do("GET", key))
 	if err != nil {
 		return nil, err
 	}
-	state := new(tasks.TaskState)
-	decoder := json.NewDecoder(bytes.NewReader(item))
-	decoder.UseNumber()
-	if err := decoder.Decode(state); err != nil {
-		return nil, err
+	if stateKey, ok := b.keys.referencedState(item); ok {
+		if item, err = redis.Bytes(conn.Do("GET", stateKey)); err != nil {
+			return nil, err
+		}
 	}
-
-	return state, nil
+	return b.UnmarshalTaskState(item)
 }
 
 // PurgeState deletes stored task state
@@ -243,7 +338,20 @@ func (b *Backend) PurgeState(taskUUID string) error {
 	conn := b.open()
 	defer conn.Close()
 
-	_, err := conn.Do("DEL", taskUUID)
+	ref := b.keys.stateRef(taskUUID)
+	if b.keys.tagStates {
+		item, err := redis.Bytes(conn.Do("GET", ref))
+		if err != nil && err != redis.ErrNil {
+			return err
+		}
+		if stateKey, ok := b.keys.referencedState(item); ok {
+			if _, err := conn.Do("DEL", stateKey); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := conn.Do("DEL", ref)
 	if err != nil {
 		return err
 	}
@@ -251,12 +359,557 @@ func (b *Backend) PurgeState(taskUUID string) error {
 	return nil
 }
 
+// HealthCheck pings the Redis server
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	conn := b.open()
+	defer conn.Close()
+
+	_, err := conn.Do("PING")
+	return err
+}
+
+// Subscribe returns a channel receiving states of the task published on change,
+// NotifyStateChanges must be enabled
+func (b *Backend) Subscribe(ctx context.Context, taskUUID string) (<-chan *tasks.TaskState, error) {
+	if !notifyStateChanges(b.GetConfig()) {
+		return nil, ErrStateNotificationsDisabled
+	}
+
+	psc := redis.PubSubConn{Conn: b.open()}
+	if err := psc.Subscribe(b.keys.stateChannel(taskUUID)); err != nil {
+		psc.Close()
+		return nil, err
+	}
+	// Wait for the subscription to be confirmed so no change is missed after
+	// Subscribe returns
+	if err, ok := psc.ReceiveWithTimeout(0).(error); ok {
+		psc.Close()
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			// Unblocks the receiving goroutine with the unsubscribe reply
+			psc.Unsubscribe()
+		case <-done:
+		}
+	}()
+
+	changes := make(chan *tasks.TaskState, 1)
+	go func() {
+		defer close(changes)
+		defer psc.Close()
+		defer close(done)
+
+		for {
+			// The subscription is idle while the task runs, wait without the
+			// read timeout of the pool
+			switch v := psc.ReceiveWithTimeout(0).(type) {
+			case redis.Message:
+				state, err := b.UnmarshalTaskState(v.Data)
+				deliverState(changes, state, err)
+			case redis.Subscription:
+				if v.Count == 0 {
+					return
+				}
+			case error:
+				return
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// AddChild records the task as a child of the parent task
+func (b *Backend) AddChild(parentUUID, childUUID string) error {
+	conn := b.open()
+	defer conn.Close()
+
+	key := b.keys.children(parentUUID)
+	score := time.Now().UnixNano() / int64(time.Microsecond)
+	if err := conn.Send("ZADD", key, "NX", score, childUUID); err != nil {
+		return err
+	}
+	if err := conn.Send("PEXPIRE", key, b.getExpiration().Milliseconds()); err != nil {
+		return err
+	}
+	_, err := conn.Do("")
+	return err
+}
+
+// Children returns UUIDs of the children of the parent task
+func (b *Backend) Children(parentUUID string) ([]string, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	return redis.Strings(conn.Do("ZRANGE", b.keys.children(parentUUID), 0, -1))
+}
+
+// AppendPartialResult appends the result to the partial results of the task
+func (b *Backend) AppendPartialResult(taskUUID string, result *tasks.TaskResult) error {
+	encoded, err := b.MarshalTaskResult(result)
+	if err != nil {
+		return err
+	}
+
+	conn := b.open()
+	defer conn.Close()
+
+	key := b.keys.partialResults(taskUUID)
+	if err := conn.Send("RPUSH", key, encoded); err != nil {
+		return err
+	}
+	if err := conn.Send("PEXPIRE", key, b.getExpiration().Milliseconds()); err != nil {
+		return err
+	}
+	_, err = conn.Do("")
+	return err
+}
+
+// PartialResults returns the partial results of the task
+func (b *Backend) PartialResults(taskUUID string) ([]*tasks.TaskResult, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	items, err := redis.ByteSlices(conn.Do("LRANGE", b.keys.partialResults(taskUUID), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*tasks.TaskResult, 0, len(items))
+	for _, item := range items {
+		result, err := b.UnmarshalTaskResult(item)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// AppendFailure appends the failure to the failure history of the task
+func (b *Backend) AppendFailure(taskUUID string, failure *tasks.Failure) error {
+	encoded, err := b.MarshalFailure(failure)
+	if err != nil {
+		return err
+	}
+
+	conn := b.open()
+	defer conn.Close()
+
+	key := b.keys.failures(taskUUID)
+	if err := conn.Send("RPUSH", key, encoded); err != nil {
+		return err
+	}
+	if err := conn.Send("PEXPIRE", key, b.getExpiration().Milliseconds()); err != nil {
+		return err
+	}
+	_, err = conn.Do("")
+	return err
+}
+
+// Failures returns the failure history of the task
+func (b *Backend) Failures(taskUUID string) ([]*tasks.Failure, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	items, err := redis.ByteSlices(conn.Do("LRANGE", b.keys.failures(taskUUID), 0, -1))
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make([]*tasks.Failure, 0, len(items))
+	for _, item := range items {
+		failure, err := b.UnmarshalFailure(item)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+	return failures, nil
+}
+
+// RecordFailedTask records the failed task, failed tasks older than the
+// results expiration are removed
+func (b *Backend) RecordFailedTask(failed *tasks.FailedTask) error {
+	encoded, err := json.Marshal(failed)
+	if err != nil {
+		return err
+	}
+
+	conn := b.open()
+	defer conn.Close()
+
+	expired := time.Now().Add(-b.getExpiration()).UnixNano() / int64(time.Millisecond)
+	expiredUUIDs, err := redis.Strings(conn.Do("ZRANGEBYSCORE", b.keys.failedTasks(), "-inf", fmt.Sprintf("(%d", expired)))
+	if err != nil {
+		return err
+	}
+	if len(expiredUUIDs) > 0 {
+		if _, err := conn.Do("ZREM", redis.Args{b.keys.failedTasks()}.AddFlat(expiredUUIDs)...); err != nil {
+			return err
+		}
+		if _, err := conn.Do("HDEL", redis.Args{b.keys.failedTaskRecords()}.AddFlat(expiredUUIDs)...); err != nil {
+			return err
+		}
+	}
+
+	if err := conn.Send("ZADD", b.keys.failedTasks(), failed.FailedAt.UnixNano()/int64(time.Millisecond), failed.Signature.UUID); err != nil {
+		return err
+	}
+	if err := conn.Send("HSET", b.keys.failedTaskRecords(), failed.Signature.UUID, encoded); err != nil {
+		return err
+	}
+	_, err = conn.Do("")
+	return err
+}
+
+// FailedTask returns the failed task, nil if it has not been recorded
+func (b *Backend) FailedTask(taskUUID string) (*tasks.FailedTask, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	encoded, err := redis.Bytes(conn.Do("HGET", b.keys.failedTaskRecords(), taskUUID))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	failed := new(tasks.FailedTask)
+	if err := json.Unmarshal(encoded, failed); err != nil {
+		return nil, err
+	}
+	return failed, nil
+}
+
+// FailedTasks returns the tasks with the name which failed since the time, of
+// any name if it is empty, oldest first
+func (b *Backend) FailedTasks(taskName string, since time.Time) ([]*tasks.FailedTask, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	taskUUIDs, err := redis.Strings(conn.Do("ZRANGEBYSCORE", b.keys.failedTasks(), since.UnixNano()/int64(time.Millisecond), "+inf"))
+	if err != nil || len(taskUUIDs) == 0 {
+		return []*tasks.FailedTask{}, err
+	}
+
+	args := redis.Args{b.keys.failedTaskRecords()}.AddFlat(taskUUIDs)
+	encoded, err := redis.ByteSlices(conn.Do("HMGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	return decodeFailedTasks(encoded, taskName)
+}
+
+// RemoveFailedTask removes the failed task
+func (b *Backend) RemoveFailedTask(taskUUID string) error {
+	conn := b.open()
+	defer conn.Close()
+
+	if err := conn.Send("ZREM", b.keys.failedTasks(), taskUUID); err != nil {
+		return err
+	}
+	if err := conn.Send("HDEL", b.keys.failedTaskRecords(), taskUUID); err != nil {
+		return err
+	}
+	_, err := conn.Do("")
+	return err
+}
+
+// SaveSchedule creates the schedule or replaces the one with its name
+func (b *Backend) SaveSchedule(schedule *tasks.Schedule) error {
+	encoded, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+
+	conn := b.open()
+	defer conn.Close()
+
+	_, err = conn.Do("HSET", b.keys.schedules(), schedule.Name, encoded)
+	return err
+}
+
+// Schedule returns the schedule with the name, nil if there is none
+func (b *Backend) Schedule(name string) (*tasks.Schedule, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	encoded, err := redis.Bytes(conn.Do("HGET", b.keys.schedules(), name))
+	if err == redis.ErrNil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	schedule := new(tasks.Schedule)
+	if err := json.Unmarshal(encoded, schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
+// Schedules returns the stored schedules sorted by name
+func (b *Backend) Schedules() ([]*tasks.Schedule, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	encoded, err := redis.ByteSlices(conn.Do("HVALS", b.keys.schedules()))
+	if err != nil {
+		return nil, err
+	}
+	return decodeSchedules(encoded)
+}
+
+// DeleteSchedule deletes the schedule with the name and its last run, if any
+func (b *Backend) DeleteSchedule(name string) error {
+	conn := b.open()
+	defer conn.Close()
+
+	if err := conn.Send("HDEL", b.keys.schedules(), name); err != nil {
+		return err
+	}
+	if err := conn.Send("HDEL", b.keys.scheduleRuns(), name); err != nil {
+		return err
+	}
+	_, err := conn.Do("")
+	return err
+}
+
+// SetScheduleLastRun records when the schedule with the name was run
+func (b *Backend) SetScheduleLastRun(name string, at time.Time) error {
+	conn := b.open()
+	defer conn.Close()
+
+	_, err := conn.Do("HSET", b.keys.scheduleRuns(), name, at.UnixNano())
+	return err
+}
+
+// ScheduleLastRun returns when the schedule with the name was run for the
+// last time, the zero time if it was never run
+func (b *Backend) ScheduleLastRun(name string) (time.Time, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	at, err := redis.Int64(conn.Do("HGET", b.keys.scheduleRuns(), name))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, at).UTC(), nil
+}
+
+// CountDelivery counts a delivery of the task
+func (b *Backend) CountDelivery(taskUUID string) (int, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	key := b.keys.deliveries(taskUUID)
+	if err := conn.Send("MULTI"); err != nil {
+		return 0, err
+	}
+	if err := conn.Send("INCR", key); err != nil {
+		return 0, err
+	}
+	if err := conn.Send("PEXPIRE", key, b.getExpiration().Milliseconds()); err != nil {
+		return 0, err
+	}
+	replies, err := redis.Values(conn.Do("EXEC"))
+	if err != nil {
+		return 0, err
+	}
+	return redis.Int(replies[0], nil)
+}
+
+// ResetDeliveries resets the deliveries of the task
+func (b *Backend) ResetDeliveries(taskUUID string) error {
+	conn := b.open()
+	defer conn.Close()
+
+	_, err := conn.Do("DEL", b.keys.deliveries(taskUUID))
+	return err
+}
+
+// Heartbeat records that the task is still running
+func (b *Backend) Heartbeat(signature *tasks.Signature) error {
+	encoded, err := json.Marshal(signature)
+	if err != nil {
+		return err
+	}
+
+	conn := b.open()
+	defer conn.Close()
+
+	if err := conn.Send("ZADD", b.keys.heartbeats(), time.Now().Unix(), signature.UUID); err != nil {
+		return err
+	}
+	if err := conn.Send("HSET", b.keys.heartbeatSignatures(), signature.UUID, encoded); err != nil {
+		return err
+	}
+	_, err = conn.Do("")
+	return err
+}
+
+// RemoveHeartbeat removes the heartbeat of the task
+func (b *Backend) RemoveHeartbeat(taskUUID string) (bool, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	removed, err := redis.Int(conn.Do("ZREM", b.keys.heartbeats(), taskUUID))
+	if err != nil {
+		return false, err
+	}
+	if _, err := conn.Do("HDEL", b.keys.heartbeatSignatures(), taskUUID); err != nil {
+		return false, err
+	}
+	return removed == 1, nil
+}
+
+// StaleHeartbeats returns signatures of the tasks whose latest heartbeat is
+// older than the time
+func (b *Backend) StaleHeartbeats(before time.Time) ([]*tasks.Signature, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	taskUUIDs, err := redis.Strings(conn.Do("ZRANGEBYSCORE", b.keys.heartbeats(), "-inf", fmt.Sprintf("(%d", before.Unix())))
+	if err != nil || len(taskUUIDs) == 0 {
+		return nil, err
+	}
+
+	args := redis.Args{b.keys.heartbeatSignatures()}.AddFlat(taskUUIDs)
+	encoded, err := redis.ByteSlices(conn.Do("HMGET", args...))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeHeartbeatSignatures(encoded)
+}
+
+// RegisterWorker records the worker until the TTL passed
+func (b *Backend) RegisterWorker(worker *tasks.WorkerInfo, ttl time.Duration) error {
+	encoded, err := json.Marshal(worker)
+	if err != nil {
+		return err
+	}
+
+	conn := b.open()
+	defer conn.Close()
+
+	if err := conn.Send("ZADD", b.keys.workers(), time.Now().Add(ttl).UnixNano()/int64(time.Millisecond), worker.ID); err != nil {
+		return err
+	}
+	if err := conn.Send("HSET", b.keys.workerInfos(), worker.ID, encoded); err != nil {
+		return err
+	}
+	_, err = conn.Do("")
+	return err
+}
+
+// UnregisterWorker removes the worker
+func (b *Backend) UnregisterWorker(workerID string) error {
+	conn := b.open()
+	defer conn.Close()
+
+	if err := conn.Send("ZREM", b.keys.workers(), workerID); err != nil {
+		return err
+	}
+	if err := conn.Send("HDEL", b.keys.workerInfos(), workerID); err != nil {
+		return err
+	}
+	_, err := conn.Do("")
+	return err
+}
+
+// Workers returns the registered workers ordered by their IDs, workers whose
+// registration expired are removed
+func (b *Backend) Workers() ([]*tasks.WorkerInfo, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	expired, err := redis.Strings(conn.Do("ZRANGEBYSCORE", b.keys.workers(), "-inf", now))
+	if err != nil {
+		return nil, err
+	}
+	for _, workerID := range expired {
+		if _, err := conn.Do("ZREM", b.keys.workers(), workerID); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Do("HDEL", b.keys.workerInfos(), workerID); err != nil {
+			return nil, err
+		}
+	}
+
+	workerIDs, err := redis.Strings(conn.Do("ZRANGEBYSCORE", b.keys.workers(), fmt.Sprintf("(%d", now), "+inf"))
+	if err != nil || len(workerIDs) == 0 {
+		return []*tasks.WorkerInfo{}, err
+	}
+	sort.Strings(workerIDs)
+
+	args := redis.Args{b.keys.workerInfos()}.AddFlat(workerIDs)
+	encoded, err := redis.ByteSlices(conn.Do("HMGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	return decodeWorkers(encoded)
+}
+
+// ClaimIdempotencyKey records the task under the key for the window unless a
+// task has been recorded under it already
+func (b *Backend) ClaimIdempotencyKey(key, taskUUID string, window time.Duration) (string, bool, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	redisKey := b.keys.idempotencyKey(key)
+	// The recorded task may expire between setting and getting the key
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		_, err := redis.String(conn.Do("SET", redisKey, taskUUID, "NX", "PX", window.Milliseconds()))
+		if err == nil {
+			return taskUUID, true, nil
+		}
+		if err != redis.ErrNil {
+			return "", false, err
+		}
+
+		existing, err := redis.String(conn.Do("GET", redisKey))
+		if err == nil {
+			return existing, existing == taskUUID, nil
+		}
+		if err != redis.ErrNil {
+			return "", false, err
+		}
+	}
+	return "", false, fmt.Errorf("Failed to claim idempotency key %s", key)
+}
+
+// ReleaseIdempotencyKey deletes the key if the task is recorded under it
+func (b *Backend) ReleaseIdempotencyKey(key, taskUUID string) error {
+	conn := b.open()
+	defer conn.Close()
+
+	_, err := releaseIdempotencyKeyScript.Do(conn, b.keys.idempotencyKey(key), taskUUID)
+	return err
+}
+
 // PurgeGroupMeta deletes stored group meta data
 func (b *Backend) PurgeGroupMeta(groupUUID string) error {
 	conn := b.open()
 	defer conn.Close()
 
-	_, err := conn.Do("DEL", groupUUID)
+	_, err := conn.Do(
+		"DEL",
+		b.keys.group(groupUUID),
+		b.keys.completedCount(groupUUID),
+		b.keys.completedTasks(groupUUID),
+	)
 	if err != nil {
 		return err
 	}
@@ -267,7 +920,7 @@ func (b *Backend) PurgeGroupMeta(groupUUID string) error {
 // getGroupMeta retrieves group meta data, convenience function to avoid repetition
 func (b *Backend) getGroupMeta(conn redis.Conn, groupUUID string) (*tasks.GroupMeta, error) {
 
-	item, err := redis.Bytes(conn.Do("GET", groupUUID))
+	item, err := redis.Bytes(conn.Do("GET", b.keys.group(groupUUID)))
 	if err != nil {
 		return nil, err
 	}
@@ -282,17 +935,17 @@ func (b *Backend) getGroupMeta(conn redis.Conn, groupUUID string) (*tasks.GroupM
 	return groupMeta, nil
 }
 
-// getStates returns multiple task states
-func (b *Backend) getStates(conn redis.Conn, taskUUIDs ...string) ([]*tasks.TaskState, error) {
+// getStates returns multiple task states of a group
+func (b *Backend) getStates(conn redis.Conn, groupUUID string, taskUUIDs ...string) ([]*tasks.TaskState, error) {
 	taskStates := make([]*tasks.TaskState, len(taskUUIDs))
 
 	// conn.Do requires []interface{}... can't pass []string unfortunately
-	taskUUIDInterfaces := make([]interface{}, len(taskUUIDs))
+	stateKeys := make([]interface{}, len(taskUUIDs))
 	for i, taskUUID := range taskUUIDs {
-		taskUUIDInterfaces[i] = interface{}(taskUUID)
+		stateKeys[i] = interface{}(b.keys.state(taskUUID, groupUUID))
 	}
 
-	reply, err := redis.Values(conn.Do("MGET", taskUUIDInterfaces...))
+	reply, err := redis.Values(conn.Do("MGET", stateKeys...))
 	if err != nil {
 		return taskStates, err
 	}
@@ -303,10 +956,8 @@ func (b *Backend) getStates(conn redis.Conn, taskUUIDs ...string) ([]*tasks.Task
 			return taskStates, fmt.Errorf("Expected byte array, instead got: %v", value)
 		}
 
-		taskState := new(tasks.TaskState)
-		decoder := json.NewDecoder(bytes.NewReader(stateBytes))
-		decoder.UseNumber()
-		if err := decoder.Decode(taskState); err != nil {
+		taskState, err := b.UnmarshalTaskState(stateBytes)
+		if err != nil {
 			log.ERROR.Print(err)
 			return taskStates, err
 		}
@@ -317,20 +968,45 @@ func (b *Backend) getStates(conn redis.Conn, taskUUIDs ...string) ([]*tasks.Task
 	return taskStates, nil
 }
 
-// updateState saves current task state
-func (b *Backend) updateState(conn redis.Conn, taskState *tasks.TaskState) error {
-	encoded, err := json.Marshal(taskState)
+// updateState saves current task state of a task of the group
+func (b *Backend) updateState(conn redis.Conn, taskState *tasks.TaskState, groupUUID string) error {
+	encoded, err := b.MarshalTaskState(taskState)
 	if err != nil {
 		return err
 	}
 
 	expiration := int64(b.getExpiration().Seconds())
-	_, err = conn.Do("SET", taskState.TaskUUID, encoded, "EX", expiration)
-	if err != nil {
+	key := b.keys.state(taskState.TaskUUID, groupUUID)
+	if !notifyStateChanges(b.GetConfig()) {
+		_, err = conn.Do("SET", key, encoded, "EX", expiration)
 		return err
 	}
 
-	return nil
+	if err := conn.Send("SET", key, encoded, "EX", expiration); err != nil {
+		return err
+	}
+	if err := conn.Send("PUBLISH", b.keys.stateChannel(taskState.TaskUUID), encoded); err != nil {
+		return err
+	}
+	_, err = conn.Do("")
+	return err
+}
+
+// completeTask counts the finished task in the completed tasks of its group
+func (b *Backend) completeTask(conn redis.Conn, signature *tasks.Signature) error {
+	if signature.GroupUUID == "" {
+		return nil
+	}
+
+	expiration := int64(b.getExpiration().Seconds())
+	_, err := completeTaskScript.Do(
+		conn,
+		b.keys.completedCount(signature.GroupUUID),
+		b.keys.completedTasks(signature.GroupUUID),
+		signature.UUID,
+		expiration,
+	)
+	return err
 }
 
 // getExpiration returns expiration for a stored task state
@@ -347,8 +1023,33 @@ func (b *Backend) getExpiration() time.Duration {
 // open returns or creates instance of Redis connection
 func (b *Backend) open() redis.Conn {
 	b.redisOnce.Do(func() {
-		b.pool = b.NewPool(b.socketPath, b.host, b.password, b.db, b.GetConfig().Redis, b.GetConfig().TLSConfig)
+		b.pool = b.NewPool(b.socketPath, b.host, b.password, b.db, b.GetConfig().Redis, common.RedisBackendTLSConfig(b.GetConfig()))
 		b.redsync = redsync.New(redsyncredis.NewPool(b.pool))
+
+		var maxStaleness int
+		if redisCnf := b.GetConfig().Redis; redisCnf != nil {
+			// Replicas are read from directly, not through sentinels
+			replicaCnf := *redisCnf
+			replicaCnf.MasterName = ""
+			for _, addr := range redisCnf.ReadReplicas {
+				password := b.password
+				if i := strings.LastIndex(addr, "@"); i >= 0 {
+					password, addr = addr[:i], addr[i+1:]
+				}
+				pool := b.NewPool("", addr, password, b.db, &replicaCnf, common.RedisBackendTLSConfig(b.GetConfig()))
+				b.replicaPools = append(b.replicaPools, pool)
+			}
+			maxStaleness = redisCnf.ReplicaMaxStaleness
+		}
+		b.readReplicas = newReadReplicas(len(b.replicaPools), maxStaleness)
 	})
 	return b.pool.Get()
 }
+
+// replicaInfo returns the INFO replication section of a read replica
+func (b *Backend) replicaInfo(i int) (string, error) {
+	conn := b.replicaPools[i].Get()
+	defer conn.Close()
+
+	return redis.String(conn.Do("INFO", "replication"))
+}
@@ -1,9 +1,12 @@
 package redis_test
 
 import (
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/RichardKnop/machinery/v2/backends/iface"
 	"github.com/RichardKnop/machinery/v2/backends/redis"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/tasks"
@@ -42,10 +45,10 @@ func TestGroupCompleted(t *testing.T) {
 
 	backend.InitGroup(groupUUID, []string{task1.UUID, task2.UUID})
 
+	// The completed tasks counter of the group starts at 0
 	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
-	if assert.Error(t, err) {
+	if assert.NoError(t, err) {
 		assert.False(t, groupCompleted)
-		assert.Equal(t, "Expected byte array, instead got: <nil>", err.Error())
 	}
 
 	backend.SetStatePending(task1)
@@ -63,6 +66,13 @@ func TestGroupCompleted(t *testing.T) {
 		assert.False(t, groupCompleted)
 	}
 
+	// Saving the final state of a task again does not count it twice
+	backend.SetStateSuccess(task2, taskResults)
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.False(t, groupCompleted)
+	}
+
 	backend.SetStateFailure(task1, "Some error")
 	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
 	if assert.NoError(t, err) {
@@ -155,3 +165,163 @@ func TestPurgeState(t *testing.T) {
 	assert.Nil(t, taskState)
 	assert.Error(t, err)
 }
+
+func TestChildren(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	redisPassword := os.Getenv("REDIS_PASSWORD")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	backend := redis.New(new(config.Config), redisURL, redisPassword, "", 0).(iface.ChildTracker)
+
+	for _, childUUID := range []string{"testChildUUID1", "testChildUUID2", "testChildUUID1"} {
+		assert.NoError(t, backend.AddChild("testParentUUID", childUUID))
+	}
+
+	childUUIDs, err := backend.Children("testParentUUID")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"testChildUUID1", "testChildUUID2"}, childUUIDs)
+}
+
+func TestHeartbeats(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	redisPassword := os.Getenv("REDIS_PASSWORD")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	backend := redis.New(new(config.Config), redisURL, redisPassword, "", 0).(iface.Heartbeater)
+
+	signature := &tasks.Signature{UUID: "testHeartbeatTaskUUID", Name: "test"}
+	assert.NoError(t, backend.Heartbeat(signature))
+
+	stale, err := backend.StaleHeartbeats(time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Contains(t, stale, signature)
+
+	removed, err := backend.RemoveHeartbeat(signature.UUID)
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = backend.RemoveHeartbeat(signature.UUID)
+	assert.NoError(t, err)
+	assert.False(t, removed)
+}
+
+func TestClaimIdempotencyKey(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	redisPassword := os.Getenv("REDIS_PASSWORD")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	backend := redis.New(new(config.Config), redisURL, redisPassword, "", 0).(iface.Deduplicator)
+	key := fmt.Sprintf("testIdempotencyKey%d", time.Now().UnixNano())
+
+	taskUUID, claimed, err := backend.ClaimIdempotencyKey(key, "testTaskUUID1", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, "testTaskUUID1", taskUUID)
+
+	taskUUID, claimed, err = backend.ClaimIdempotencyKey(key, "testTaskUUID2", time.Second)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Equal(t, "testTaskUUID1", taskUUID)
+
+	// The recorded task claims the key again when it is retried
+	_, claimed, err = backend.ClaimIdempotencyKey(key, "testTaskUUID1", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+
+	// Only the recorded task releases the key
+	assert.NoError(t, backend.ReleaseIdempotencyKey(key, "testTaskUUID2"))
+	_, claimed, err = backend.ClaimIdempotencyKey(key, "testTaskUUID2", time.Second)
+	assert.NoError(t, err)
+	assert.False(t, claimed)
+
+	assert.NoError(t, backend.ReleaseIdempotencyKey(key, "testTaskUUID1"))
+	_, claimed, err = backend.ClaimIdempotencyKey(key, "testTaskUUID2", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, claimed)
+}
+
+func TestFailedTasks(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	redisPassword := os.Getenv("REDIS_PASSWORD")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	backend := redis.New(new(config.Config), redisURL, redisPassword, "", 0).(iface.FailedTaskRecorder)
+	since := time.Now().Add(-time.Second)
+	failed := &tasks.FailedTask{
+		Signature: &tasks.Signature{UUID: fmt.Sprintf("testFailedTaskUUID%d", time.Now().UnixNano()), Name: "testFailedTask"},
+		Error:     "boom",
+		FailedAt:  time.Now().UTC(),
+	}
+	assert.NoError(t, backend.RecordFailedTask(failed))
+
+	recorded, err := backend.FailedTask(failed.Signature.UUID)
+	if assert.NoError(t, err) && assert.NotNil(t, recorded) {
+		assert.Equal(t, failed.Signature.Name, recorded.Signature.Name)
+		assert.Equal(t, "boom", recorded.Error)
+	}
+
+	found, err := backend.FailedTasks("testFailedTask", since)
+	assert.NoError(t, err)
+	uuids := make([]string, len(found))
+	for i, failed := range found {
+		uuids[i] = failed.Signature.UUID
+	}
+	assert.Contains(t, uuids, failed.Signature.UUID)
+
+	assert.NoError(t, backend.RemoveFailedTask(failed.Signature.UUID))
+	recorded, err = backend.FailedTask(failed.Signature.UUID)
+	assert.NoError(t, err)
+	assert.Nil(t, recorded)
+}
+
+func TestSchedules(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	redisPassword := os.Getenv("REDIS_PASSWORD")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	backend := redis.New(new(config.Config), redisURL, redisPassword, "", 0).(iface.ScheduleStore)
+	schedule := &tasks.Schedule{
+		Name:       fmt.Sprintf("testSchedule%d", time.Now().UnixNano()),
+		Spec:       "0 9 * * *",
+		Signatures: []*tasks.Signature{{Name: "testTask"}},
+		UpdatedAt:  time.Now().UTC(),
+	}
+	assert.NoError(t, backend.SaveSchedule(schedule))
+
+	stored, err := backend.Schedule(schedule.Name)
+	if assert.NoError(t, err) && assert.NotNil(t, stored) {
+		assert.Equal(t, schedule.Spec, stored.Spec)
+		assert.True(t, schedule.UpdatedAt.Equal(stored.UpdatedAt))
+	}
+
+	schedules, err := backend.Schedules()
+	assert.NoError(t, err)
+	names := make([]string, len(schedules))
+	for i, schedule := range schedules {
+		names[i] = schedule.Name
+	}
+	assert.Contains(t, names, schedule.Name)
+
+	ranAt := time.Now().UTC()
+	assert.NoError(t, backend.SetScheduleLastRun(schedule.Name, ranAt))
+	lastRun, err := backend.ScheduleLastRun(schedule.Name)
+	assert.NoError(t, err)
+	assert.True(t, ranAt.Equal(lastRun))
+
+	assert.NoError(t, backend.DeleteSchedule(schedule.Name))
+	stored, err = backend.Schedule(schedule.Name)
+	assert.NoError(t, err)
+	assert.Nil(t, stored)
+	lastRun, err = backend.ScheduleLastRun(schedule.Name)
+	assert.NoError(t, err)
+	assert.True(t, lastRun.IsZero())
+}
@@ -0,0 +1,100 @@
+package redis
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// replicaCheckInterval is how long the staleness of a replica is cached
+const replicaCheckInterval = time.Second
+
+// readReplicas picks the read replica polled task states are read from
+type readReplicas struct {
+	statuses     []*replicaStatus
+	maxStaleness time.Duration
+	next         uint32
+}
+
+func newReadReplicas(count, maxStaleness int) *readReplicas {
+	r := &readReplicas{
+		statuses:     make([]*replicaStatus, count),
+		maxStaleness: time.Duration(maxStaleness) * time.Second,
+	}
+	for i := range r.statuses {
+		r.statuses[i] = new(replicaStatus)
+	}
+	return r
+}
+
+// pick returns the index of the next replica in turn which is not stale, or -1
+// when there is none. info returns the INFO replication section of a replica.
+func (r *readReplicas) pick(info func(i int) (string, error)) int {
+	count := len(r.statuses)
+	if count == 0 {
+		return -1
+	}
+
+	start := int(atomic.AddUint32(&r.next, 1))
+	for j := 0; j < count; j++ {
+		i := (start + j) % count
+		if r.maxStaleness == 0 || r.statuses[i].fresh(r.maxStaleness, func() (string, error) { return info(i) }) {
+			return i
+		}
+	}
+	return -1
+}
+
+// replicaStatus caches whether a replica is fresh enough to be read from
+type replicaStatus struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	isFresh   bool
+}
+
+func (s *replicaStatus) fresh(maxStaleness time.Duration, info func() (string, error)) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checkedAt) < replicaCheckInterval {
+		return s.isFresh
+	}
+	s.checkedAt = time.Now()
+
+	replication, err := info()
+	if err != nil {
+		s.isFresh = false
+		return false
+	}
+	lag, ok := replicationLag(replication)
+	s.isFresh = ok && lag <= maxStaleness
+	return s.isFresh
+}
+
+// replicationLag returns how long ago a replica last heard from its primary,
+// parsed from its INFO replication section. It is false when the link to the
+// primary is down.
+func replicationLag(info string) (time.Duration, bool) {
+	var (
+		linkUp bool
+		lag    = -1
+	)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "master_link_status:up":
+			linkUp = true
+		case strings.HasPrefix(line, "master_last_io_seconds_ago:"):
+			if n, err := strconv.Atoi(strings.TrimPrefix(line, "master_last_io_seconds_ago:")); err == nil {
+				lag = n
+			}
+		}
+	}
+
+	if !linkUp || lag < 0 {
+		return 0, false
+	}
+	return time.Duration(lag) * time.Second, true
+}
@@ -0,0 +1,54 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationLag(t *testing.T) {
+	t.Parallel()
+
+	lag, ok := replicationLag("# Replication\r\nrole:slave\r\nmaster_link_status:up\r\nmaster_last_io_seconds_ago:3\r\n")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, lag)
+
+	_, ok = replicationLag("# Replication\r\nrole:slave\r\nmaster_link_status:down\r\nmaster_last_io_seconds_ago:-1\r\n")
+	assert.False(t, ok)
+
+	_, ok = replicationLag("# Replication\r\nrole:master\r\n")
+	assert.False(t, ok)
+}
+
+func TestReadReplicasPick(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, -1, newReadReplicas(0, 0).pick(nil))
+
+	// Without a staleness limit replicas are picked in turn
+	replicas := newReadReplicas(2, 0)
+	first := replicas.pick(nil)
+	assert.NotEqual(t, first, replicas.pick(nil))
+
+	// Stale replicas and replicas which cannot be reached are skipped
+	infos := []string{
+		"master_link_status:up\r\nmaster_last_io_seconds_ago:30\r\n",
+		"master_link_status:up\r\nmaster_last_io_seconds_ago:1\r\n",
+	}
+	replicas = newReadReplicas(3, 10)
+	info := func(i int) (string, error) {
+		if i == 2 {
+			return "", errors.New("connection refused")
+		}
+		return infos[i], nil
+	}
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, 1, replicas.pick(info))
+	}
+
+	// The staleness of replicas is cached
+	infos[1] = "master_link_status:down\r\n"
+	assert.Equal(t, 1, replicas.pick(info))
+}
@@ -1,10 +1,16 @@
 package result
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
+	"io"
+	"io/ioutil"
 	"reflect"
 	"time"
 
+	"github.com/RichardKnop/machinery/v2/backends"
 	"github.com/RichardKnop/machinery/v2/backends/iface"
 	"github.com/RichardKnop/machinery/v2/tasks"
 )
@@ -14,6 +20,8 @@ var (
 	ErrBackendNotConfigured = errors.New("Result backend not configured")
 	// ErrTimeoutReached ...
 	ErrTimeoutReached = errors.New("Timeout reached")
+	// ErrTaskCanceled is returned for results of a canceled task
+	ErrTaskCanceled = errors.New("Task canceled")
 )
 
 // AsyncResult represents a task result
@@ -36,6 +44,13 @@ type ChainAsyncResult struct {
 	backend      iface.Backend
 }
 
+// DAGAsyncResult represents a result of a DAG of tasks
+type DAGAsyncResult struct {
+	names        []string
+	asyncResults []*AsyncResult
+	backend      iface.Backend
+}
+
 // NewAsyncResult creates AsyncResult instance
 func NewAsyncResult(signature *tasks.Signature, backend iface.Backend) *AsyncResult {
 	return &AsyncResult{
@@ -87,6 +102,10 @@ func (asyncResult *AsyncResult) Touch() ([]reflect.Value, error) {
 		return nil, errors.New(asyncResult.taskState.Error)
 	}
 
+	if asyncResult.taskState.IsCanceled() {
+		return nil, ErrTaskCanceled
+	}
+
 	if asyncResult.taskState.IsSuccess() {
 		return tasks.ReflectTaskResults(asyncResult.taskState.Results)
 	}
@@ -94,13 +113,19 @@ func (asyncResult *AsyncResult) Touch() ([]reflect.Value, error) {
 	return nil, nil
 }
 
-// Get returns task results (synchronous blocking call)
+// Get returns task results (synchronous blocking call). Backends implementing
+// StateSubscriber wake it up when the task state changes, sleepDuration is
+// then only the longest wait between state checks.
 func (asyncResult *AsyncResult) Get(sleepDuration time.Duration) ([]reflect.Value, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := asyncResult.subscribe(ctx)
+
 	for {
 		results, err := asyncResult.Touch()
 
 		if results == nil && err == nil {
-			time.Sleep(sleepDuration)
+			wait(changes, sleepDuration)
 		} else {
 			return results, err
 		}
@@ -111,6 +136,10 @@ func (asyncResult *AsyncResult) Get(sleepDuration time.Duration) ([]reflect.Valu
 func (asyncResult *AsyncResult) GetWithTimeout(timeoutDuration, sleepDuration time.Duration) ([]reflect.Value, error) {
 	timeout := time.NewTimer(timeoutDuration)
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes := asyncResult.subscribe(ctx)
+
 	for {
 		select {
 		case <-timeout.C:
@@ -119,7 +148,7 @@ func (asyncResult *AsyncResult) GetWithTimeout(timeoutDuration, sleepDuration ti
 			results, err := asyncResult.Touch()
 
 			if results == nil && err == nil {
-				time.Sleep(sleepDuration)
+				wait(changes, sleepDuration)
 			} else {
 				return results, err
 			}
@@ -127,6 +156,127 @@ func (asyncResult *AsyncResult) GetWithTimeout(timeoutDuration, sleepDuration ti
 	}
 }
 
+// subscribe returns changes of the task state pushed by the backend, nil if
+// it does not push them so the state is polled
+func (asyncResult *AsyncResult) subscribe(ctx context.Context) <-chan *tasks.TaskState {
+	changes, err := backends.Subscribe(ctx, asyncResult.backend, asyncResult.Signature.UUID)
+	if err != nil {
+		return nil
+	}
+	return changes
+}
+
+// wait sleeps for sleepDuration or until the task state changes
+func wait(changes <-chan *tasks.TaskState, sleepDuration time.Duration) {
+	if changes == nil {
+		time.Sleep(sleepDuration)
+		return
+	}
+
+	timer := time.NewTimer(sleepDuration)
+	defer timer.Stop()
+
+	select {
+	case _, ok := <-changes:
+		// The subscription is lost, keep polling
+		if !ok {
+			<-timer.C
+		}
+	case <-timer.C:
+	}
+}
+
+// Stream returns a reader over the JSON encoded results of the task once it
+// succeeded (synchronous blocking call). Backends implementing StateStreamer,
+// e.g. the object store backend, stream large results instead of reading them
+// into memory. The reader must be closed.
+func (asyncResult *AsyncResult) Stream(sleepDuration time.Duration) (io.ReadCloser, error) {
+	for {
+		stream, err := asyncResult.touchStream()
+
+		if stream == nil && err == nil {
+			time.Sleep(sleepDuration)
+		} else {
+			return stream, err
+		}
+	}
+}
+
+// StreamWithTimeout returns a reader over the JSON encoded results of the task
+// with a timeout (synchronous blocking call)
+func (asyncResult *AsyncResult) StreamWithTimeout(timeoutDuration, sleepDuration time.Duration) (io.ReadCloser, error) {
+	timeout := time.NewTimer(timeoutDuration)
+
+	for {
+		select {
+		case <-timeout.C:
+			return nil, ErrTimeoutReached
+		default:
+			stream, err := asyncResult.touchStream()
+
+			if stream == nil && err == nil {
+				time.Sleep(sleepDuration)
+			} else {
+				return stream, err
+			}
+		}
+	}
+}
+
+// touchStream returns a reader over the results of the task if it succeeded
+// and does not wait
+func (asyncResult *AsyncResult) touchStream() (io.ReadCloser, error) {
+	if asyncResult.backend == nil {
+		return nil, ErrBackendNotConfigured
+	}
+
+	streamer, ok := asyncResult.backend.(iface.StateStreamer)
+	if !ok {
+		asyncResult.GetState()
+
+		// Purge state if we are using AMQP backend
+		if asyncResult.backend.IsAMQP() && asyncResult.taskState.IsCompleted() {
+			asyncResult.backend.PurgeState(asyncResult.taskState.TaskUUID)
+		}
+
+		if asyncResult.taskState.IsFailure() {
+			return nil, errors.New(asyncResult.taskState.Error)
+		}
+		if asyncResult.taskState.IsCanceled() {
+			return nil, ErrTaskCanceled
+		}
+		if !asyncResult.taskState.IsSuccess() {
+			return nil, nil
+		}
+
+		encoded, err := json.Marshal(asyncResult.taskState.Results)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(bytes.NewReader(encoded)), nil
+	}
+
+	taskState, stream, err := streamer.GetStateStream(context.Background(), asyncResult.Signature.UUID)
+	if err != nil {
+		// Like GetState the task may not have a state yet, but results of
+		// a successful task which cannot be read are an error
+		if taskState != nil && taskState.IsSuccess() {
+			return nil, err
+		}
+		return nil, nil
+	}
+	asyncResult.taskState = taskState
+
+	if taskState.IsFailure() {
+		return nil, errors.New(taskState.Error)
+	}
+	if taskState.IsCanceled() {
+		return nil, ErrTaskCanceled
+	}
+
+	return stream, nil
+}
+
 // GetState returns latest task state
 func (asyncResult *AsyncResult) GetState() *tasks.TaskState {
 	if asyncResult.taskState.IsCompleted() {
@@ -141,6 +291,84 @@ func (asyncResult *AsyncResult) GetState() *tasks.TaskState {
 	return asyncResult.taskState
 }
 
+// GetFailureHistory returns the failed attempts of the task, oldest first,
+// if the result backend records them
+func (asyncResult *AsyncResult) GetFailureHistory() ([]*tasks.Failure, error) {
+	if asyncResult.backend == nil {
+		return nil, ErrBackendNotConfigured
+	}
+	return backends.Failures(asyncResult.backend, asyncResult.Signature.UUID)
+}
+
+// NewDAGAsyncResult creates DAGAsyncResult instance
+func NewDAGAsyncResult(dag *tasks.DAG, backend iface.Backend) *DAGAsyncResult {
+	dagAsyncResult := &DAGAsyncResult{
+		names:        make([]string, len(dag.Nodes)),
+		asyncResults: make([]*AsyncResult, len(dag.Nodes)),
+		backend:      backend,
+	}
+	for i, node := range dag.Nodes {
+		dagAsyncResult.names[i] = node.Name
+		dagAsyncResult.asyncResults[i] = NewAsyncResult(node.Signature, backend)
+	}
+	return dagAsyncResult
+}
+
+// Get returns results of all tasks of a DAG by the names of their nodes
+// (synchronous blocking call). The error of the first failed task is
+// returned, tasks depending on it fail as well so the DAG always completes.
+func (dagAsyncResult *DAGAsyncResult) Get(sleepDuration time.Duration) (map[string][]reflect.Value, error) {
+	if dagAsyncResult.backend == nil {
+		return nil, ErrBackendNotConfigured
+	}
+
+	results := make(map[string][]reflect.Value, len(dagAsyncResult.names))
+	for i, asyncResult := range dagAsyncResult.asyncResults {
+		nodeResults, err := asyncResult.Get(sleepDuration)
+		if err != nil {
+			return nil, err
+		}
+		results[dagAsyncResult.names[i]] = nodeResults
+	}
+
+	return results, nil
+}
+
+// GetWithTimeout returns results of all tasks of a DAG by the names of their
+// nodes with a timeout (synchronous blocking call)
+func (dagAsyncResult *DAGAsyncResult) GetWithTimeout(timeoutDuration, sleepDuration time.Duration) (map[string][]reflect.Value, error) {
+	if dagAsyncResult.backend == nil {
+		return nil, ErrBackendNotConfigured
+	}
+
+	deadline := time.Now().Add(timeoutDuration)
+	results := make(map[string][]reflect.Value, len(dagAsyncResult.names))
+	for i, asyncResult := range dagAsyncResult.asyncResults {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ErrTimeoutReached
+		}
+
+		nodeResults, err := asyncResult.GetWithTimeout(remaining, sleepDuration)
+		if err != nil {
+			return nil, err
+		}
+		results[dagAsyncResult.names[i]] = nodeResults
+	}
+
+	return results, nil
+}
+
+// GetStates returns the current states of all tasks of a DAG by the names of
+// their nodes
+func (dagAsyncResult *DAGAsyncResult) GetStates() map[string]*tasks.TaskState {
+	states := make(map[string]*tasks.TaskState, len(dagAsyncResult.names))
+	for i, asyncResult := range dagAsyncResult.asyncResults {
+		states[dagAsyncResult.names[i]] = asyncResult.GetState()
+	}
+	return states
+}
+
 // Get returns results of a chain of tasks (synchronous blocking call)
 func (chainAsyncResult *ChainAsyncResult) Get(sleepDuration time.Duration) ([]reflect.Value, error) {
 	if chainAsyncResult.backend == nil {
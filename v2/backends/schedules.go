@@ -0,0 +1,116 @@
+package backends
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrSchedulesNotSupported is returned when a backend does not store
+// schedules
+var ErrSchedulesNotSupported = errors.New("Result backend does not store schedules")
+
+// SaveSchedule saves the schedule in the backend or the backends it wraps,
+// replacing the one with its name, schedules with Runs cannot be saved. Its UpdatedAt is set to the current time
+// so servers syncing the schedules pick up the change.
+func SaveSchedule(backend iface.Backend, schedule *tasks.Schedule) error {
+	stores := scheduleStores(backend)
+	if len(stores) == 0 {
+		return ErrSchedulesNotSupported
+	}
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	if schedule.Runs != nil {
+		return fmt.Errorf("Schedule %s has runs which cannot be stored", schedule.Name)
+	}
+
+	schedule.UpdatedAt = time.Now().UTC()
+	for _, store := range stores {
+		if err := store.SaveSchedule(schedule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Schedule returns the schedule with the name, nil if there is none, read from
+// the first backend storing schedules
+func Schedule(backend iface.Backend, name string) (*tasks.Schedule, error) {
+	stores := scheduleStores(backend)
+	if len(stores) == 0 {
+		return nil, ErrSchedulesNotSupported
+	}
+
+	return stores[0].Schedule(name)
+}
+
+// Schedules returns the stored schedules sorted by name, read from the first
+// backend storing schedules
+func Schedules(backend iface.Backend) ([]*tasks.Schedule, error) {
+	stores := scheduleStores(backend)
+	if len(stores) == 0 {
+		return nil, ErrSchedulesNotSupported
+	}
+
+	return stores[0].Schedules()
+}
+
+// DeleteSchedule deletes the schedule with the name from the backend or the
+// backends it wraps
+func DeleteSchedule(backend iface.Backend, name string) error {
+	stores := scheduleStores(backend)
+	if len(stores) == 0 {
+		return ErrSchedulesNotSupported
+	}
+
+	for _, store := range stores {
+		if err := store.DeleteSchedule(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetScheduleLastRun records when the schedule with the name was run in the
+// backend or the backends it wraps
+func SetScheduleLastRun(backend iface.Backend, name string, at time.Time) error {
+	stores := scheduleStores(backend)
+	if len(stores) == 0 {
+		return ErrSchedulesNotSupported
+	}
+
+	for _, store := range stores {
+		if err := store.SetScheduleLastRun(name, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScheduleLastRun returns when the schedule with the name was run for the
+// last time, the zero time if it was never run, read from the first backend
+// storing schedules
+func ScheduleLastRun(backend iface.Backend, name string) (time.Time, error) {
+	stores := scheduleStores(backend)
+	if len(stores) == 0 {
+		return time.Time{}, ErrSchedulesNotSupported
+	}
+
+	return stores[0].ScheduleLastRun(name)
+}
+
+// SchedulesSupported returns whether the backend or a backend it wraps
+// stores schedules
+func SchedulesSupported(backend iface.Backend) bool {
+	return len(scheduleStores(backend)) > 0
+}
+
+// scheduleStores returns the backends storing schedules, the backend itself
+// or the backends it wraps
+func scheduleStores(backend iface.Backend) []iface.ScheduleStore {
+	return plaintextImplementations[iface.ScheduleStore](backend)
+}
@@ -0,0 +1,71 @@
+package backends_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/null"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/scheduler"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestSchedules(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	backend := backends.NewTiered(backends.ReadFastest, memory.New(cnf), null.New())
+
+	report := &tasks.Schedule{Name: "report", Spec: "0 9 * * *", Signatures: []*tasks.Signature{{Name: "send_report"}}}
+	cleanup := &tasks.Schedule{Name: "cleanup", Spec: "@hourly", Kind: tasks.ScheduleGroup, Signatures: []*tasks.Signature{{Name: "purge_cache"}, {Name: "purge_files"}}}
+	require.NoError(t, backends.SaveSchedule(backend, report))
+	require.NoError(t, backends.SaveSchedule(backend, cleanup))
+	assert.False(t, report.UpdatedAt.IsZero())
+
+	schedule, err := backends.Schedule(backend, "report")
+	if assert.NoError(t, err) && assert.NotNil(t, schedule) {
+		assert.Equal(t, report.Spec, schedule.Spec)
+		assert.Equal(t, report.UpdatedAt, schedule.UpdatedAt)
+		assert.Equal(t, "send_report", schedule.Signatures[0].Name)
+	}
+
+	schedules, err := backends.Schedules(backend)
+	if assert.NoError(t, err) && assert.Len(t, schedules, 2) {
+		assert.Equal(t, "cleanup", schedules[0].Name)
+		assert.Equal(t, tasks.ScheduleGroup, schedules[0].Kind)
+		assert.Len(t, schedules[0].Signatures, 2)
+		assert.Equal(t, "report", schedules[1].Name)
+	}
+
+	err = backends.SaveSchedule(backend, &tasks.Schedule{Name: "invalid", Spec: "@daily", Kind: tasks.ScheduleChord, Signatures: report.Signatures})
+	assert.Error(t, err)
+	err = backends.SaveSchedule(backend, &tasks.Schedule{Name: "invalid", Runs: scheduler.Every(time.Hour), Signatures: report.Signatures})
+	assert.Error(t, err)
+
+	lastRun, err := backends.ScheduleLastRun(backend, "report")
+	assert.NoError(t, err)
+	assert.True(t, lastRun.IsZero())
+	ranAt := time.Now().UTC()
+	require.NoError(t, backends.SetScheduleLastRun(backend, "report", ranAt))
+	lastRun, err = backends.ScheduleLastRun(backend, "report")
+	assert.NoError(t, err)
+	assert.True(t, ranAt.Equal(lastRun))
+
+	require.NoError(t, backends.DeleteSchedule(backend, "report"))
+	schedule, err = backends.Schedule(backend, "report")
+	assert.NoError(t, err)
+	assert.Nil(t, schedule)
+	lastRun, err = backends.ScheduleLastRun(backend, "report")
+	assert.NoError(t, err)
+	assert.True(t, lastRun.IsZero())
+
+	err = backends.SaveSchedule(null.New(), report)
+	assert.Equal(t, backends.ErrSchedulesNotSupported, err)
+	_, err = backends.Schedules(null.New())
+	assert.Equal(t, backends.ErrSchedulesNotSupported, err)
+}
@@ -0,0 +1,336 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	// registers the sqlite3 database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS task_states (
+	task_uuid  TEXT PRIMARY KEY,
+	state      BLOB NOT NULL,
+	expires_at INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS task_states_expires_at ON task_states (expires_at);
+CREATE TABLE IF NOT EXISTS group_metas (
+	group_uuid      TEXT PRIMARY KEY,
+	task_uuids      TEXT NOT NULL,
+	chord_triggered INTEGER NOT NULL DEFAULT 0,
+	created_at      INTEGER NOT NULL,
+	expires_at      INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS group_metas_expires_at ON group_metas (expires_at);
+`
+
+// Backend represents a result backend persisting task states and group meta
+// data in a local SQLite database, meant for single node deployments
+type Backend struct {
+	common.Backend
+	db *sql.DB
+}
+
+// New creates Backend instance, the database file and its tables are created
+// if they do not exist
+func New(cnf *config.Config, path string) (iface.Backend, error) {
+	dsn := fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", path)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("Open sqlite database %s error: %s", path, err)
+	}
+
+	// SQLite allows a single writer at a time, sharing one connection
+	// serializes writes instead of failing them with "database is locked"
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Create sqlite tables error: %s", err)
+	}
+
+	return &Backend{
+		Backend: common.NewBackend(cnf),
+		db:      db,
+	}, nil
+}
+
+// InitGroup creates and saves a group meta data object
+func (b *Backend) InitGroup(groupUUID string, taskUUIDs []string) error {
+	encoded, err := json.Marshal(taskUUIDs)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	_, err = b.db.Exec(
+		`INSERT OR REPLACE INTO group_metas (group_uuid, task_uuids, chord_triggered, created_at, expires_at)
+		VALUES (?, ?, 0, ?, ?)`,
+		groupUUID, string(encoded), now.Unix(), b.expiresAt(now),
+	)
+	return err
+}
+
+// GroupCompleted returns true if all tasks in a group finished
+func (b *Backend) GroupCompleted(groupUUID string, groupTaskCount int) (bool, error) {
+	taskStates, err := b.GroupTaskStates(groupUUID, groupTaskCount)
+	if err != nil {
+		return false, err
+	}
+
+	var countSuccessTasks = 0
+	for _, taskState := range taskStates {
+		if taskState.IsCompleted() {
+			countSuccessTasks++
+		}
+	}
+
+	return countSuccessTasks == groupTaskCount, nil
+}
+
+// GroupTaskStates returns states of all tasks in the group
+func (b *Backend) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
+	groupMeta, err := b.getGroupMeta(groupUUID)
+	if err != nil {
+		return []*tasks.TaskState{}, err
+	}
+
+	states := make([]*tasks.TaskState, 0, groupTaskCount)
+	for _, taskUUID := range groupMeta.TaskUUIDs {
+		state, err := b.GetState(taskUUID)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+// TriggerChord flags chord as triggered in the backend storage to make sure
+// chord is never trigerred multiple times. Returns a boolean flag to indicate
+// whether the worker should trigger chord (true) or no if it has been triggered
+// already (false)
+func (b *Backend) TriggerChord(groupUUID string) (bool, error) {
+	// The update only matches a group whose chord has not been triggered yet,
+	// so exactly one of concurrent callers affects a row
+	result, err := b.db.Exec(
+		`UPDATE group_metas SET chord_triggered = 1
+		WHERE group_uuid = ? AND chord_triggered = 0 AND expires_at > ?`,
+		groupUUID, time.Now().UTC().Unix(),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if affected == 1 {
+		return true, nil
+	}
+
+	// Chord has already been triggered, return false (should not trigger again)
+	if _, err := b.getGroupMeta(groupUUID); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// SetStatePending updates task state to PENDING
+func (b *Backend) SetStatePending(signature *tasks.Signature) error {
+	taskState := tasks.NewPendingTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateReceived updates task state to RECEIVED
+func (b *Backend) SetStateReceived(signature *tasks.Signature) error {
+	taskState := tasks.NewReceivedTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateStarted updates task state to STARTED
+func (b *Backend) SetStateStarted(signature *tasks.Signature) error {
+	taskState := tasks.NewStartedTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateRetry updates task state to RETRY
+func (b *Backend) SetStateRetry(signature *tasks.Signature) error {
+	taskState := tasks.NewRetryTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// SetStateSuccess updates task state to SUCCESS
+func (b *Backend) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	taskState := tasks.NewSuccessTaskState(signature, results)
+	return b.updateState(taskState)
+}
+
+// SetStateFailure updates task state to FAILURE
+func (b *Backend) SetStateFailure(signature *tasks.Signature, err string) error {
+	taskState := tasks.NewFailureTaskState(signature, err)
+	return b.updateState(taskState)
+}
+
+// SetStateCanceled updates task state to CANCELED
+func (b *Backend) SetStateCanceled(signature *tasks.Signature) error {
+	taskState := tasks.NewCanceledTaskState(signature)
+	return b.updateState(taskState)
+}
+
+// GetState returns the latest task state
+func (b *Backend) GetState(taskUUID string) (*tasks.TaskState, error) {
+	var stateBytes []byte
+	err := b.db.QueryRow(
+		`SELECT state FROM task_states WHERE task_uuid = ? AND expires_at > ?`,
+		taskUUID, time.Now().UTC().Unix(),
+	).Scan(&stateBytes)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Task not found: %s", taskUUID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := b.UnmarshalTaskState(stateBytes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal task state %s: %v", taskUUID, err)
+	}
+
+	return state, nil
+}
+
+// PurgeState deletes stored task state
+func (b *Backend) PurgeState(taskUUID string) error {
+	_, err := b.db.Exec(`DELETE FROM task_states WHERE task_uuid = ?`, taskUUID)
+	return err
+}
+
+// PurgeGroupMeta deletes stored group meta data
+func (b *Backend) PurgeGroupMeta(groupUUID string) error {
+	_, err := b.db.Exec(`DELETE FROM group_metas WHERE group_uuid = ?`, groupUUID)
+	return err
+}
+
+// HealthCheck verifies the database can be queried
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	return b.db.PingContext(ctx)
+}
+
+// CollectGarbage removes expired rows, they are otherwise only removed when a
+// task state is saved
+func (b *Backend) CollectGarbage(ctx context.Context) (int, error) {
+	return deleteExpired(ctx, b.db, time.Now().UTC())
+}
+
+// Close closes the underlying database
+func (b *Backend) Close() error {
+	return b.db.Close()
+}
+
+// getGroupMeta retrieves group meta data for a group UUID
+func (b *Backend) getGroupMeta(groupUUID string) (*tasks.GroupMeta, error) {
+	var (
+		taskUUIDs      string
+		chordTriggered bool
+		createdAt      int64
+	)
+	err := b.db.QueryRow(
+		`SELECT task_uuids, chord_triggered, created_at FROM group_metas
+		WHERE group_uuid = ? AND expires_at > ?`,
+		groupUUID, time.Now().UTC().Unix(),
+	).Scan(&taskUUIDs, &chordTriggered, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("Group not found: %s", groupUUID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	groupMeta := &tasks.GroupMeta{
+		GroupUUID:      groupUUID,
+		ChordTriggered: chordTriggered,
+		CreatedAt:      time.Unix(createdAt, 0).UTC(),
+	}
+	if err := json.Unmarshal([]byte(taskUUIDs), &groupMeta.TaskUUIDs); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal group meta %s: %v", groupUUID, err)
+	}
+
+	return groupMeta, nil
+}
+
+// updateState saves current task state and removes expired rows, the
+// database is local so there is nothing else to evict them
+func (b *Backend) updateState(taskState *tasks.TaskState) error {
+	encoded, err := b.MarshalTaskState(taskState)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := deleteExpired(context.Background(), tx, now); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT OR REPLACE INTO task_states (task_uuid, state, expires_at) VALUES (?, ?, ?)`,
+		taskState.TaskUUID, encoded, b.expiresAt(now),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// execer is implemented by both the database and its transactions
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// deleteExpired deletes expired task states and group metas and returns how
+// many were deleted
+func deleteExpired(ctx context.Context, db execer, now time.Time) (int, error) {
+	var deleted int64
+	for _, query := range []string{
+		`DELETE FROM task_states WHERE expires_at <= ?`,
+		`DELETE FROM group_metas WHERE expires_at <= ?`,
+	} {
+		result, err := db.ExecContext(ctx, query, now.Unix())
+		if err != nil {
+			return int(deleted), err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return int(deleted), err
+		}
+		deleted += affected
+	}
+	return int(deleted), nil
+}
+
+// expiresAt returns the unix time at which a row saved now expires
+func (b *Backend) expiresAt(now time.Time) int64 {
+	expiresIn := b.GetConfig().ResultsExpireIn
+	if expiresIn == 0 {
+		// expire results after 1 hour by default
+		expiresIn = config.DefaultResultsExpireIn
+	}
+
+	return now.Add(time.Duration(expiresIn) * time.Second).Unix()
+}
@@ -0,0 +1,160 @@
+package sqlite_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/backends/sqlite"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBackend(t *testing.T, cnf *config.Config) iface.Backend {
+	backend, err := sqlite.New(cnf, filepath.Join(t.TempDir(), "results.db"))
+	require.NoError(t, err)
+	return backend
+}
+
+func TestGroupCompleted(t *testing.T) {
+	t.Parallel()
+
+	groupUUID := "testGroupUUID"
+	task1 := &tasks.Signature{
+		UUID:      "testTaskUUID1",
+		GroupUUID: groupUUID,
+	}
+	task2 := &tasks.Signature{
+		UUID:      "testTaskUUID2",
+		GroupUUID: groupUUID,
+	}
+
+	backend := newBackend(t, new(config.Config))
+
+	groupCompleted, err := backend.GroupCompleted(groupUUID, 2)
+	if assert.Error(t, err) {
+		assert.False(t, groupCompleted)
+		assert.Equal(t, "Group not found: testGroupUUID", err.Error())
+	}
+
+	assert.NoError(t, backend.InitGroup(groupUUID, []string{task1.UUID, task2.UUID}))
+
+	backend.SetStatePending(task1)
+	backend.SetStateStarted(task2)
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.False(t, groupCompleted)
+	}
+
+	taskResults := []*tasks.TaskResult{{Type: "int64", Value: 2}}
+	backend.SetStateSuccess(task1, taskResults)
+	backend.SetStateFailure(task2, "Some error")
+	groupCompleted, err = backend.GroupCompleted(groupUUID, 2)
+	if assert.NoError(t, err) {
+		assert.True(t, groupCompleted)
+	}
+
+	states, err := backend.GroupTaskStates(groupUUID, 2)
+	if assert.NoError(t, err) && assert.Len(t, states, 2) {
+		assert.Equal(t, tasks.StateSuccess, states[0].State)
+		assert.Equal(t, "2", string(states[0].Results[0].Value.(json.Number)))
+		assert.Equal(t, tasks.StateFailure, states[1].State)
+		assert.Equal(t, "Some error", states[1].Error)
+	}
+
+	assert.NoError(t, backend.PurgeGroupMeta(groupUUID))
+	_, err = backend.GroupTaskStates(groupUUID, 2)
+	assert.Error(t, err)
+}
+
+func TestTriggerChord(t *testing.T) {
+	t.Parallel()
+
+	groupUUID := "testGroupUUID"
+	backend := newBackend(t, new(config.Config))
+
+	_, err := backend.TriggerChord(groupUUID)
+	assert.Error(t, err)
+
+	assert.NoError(t, backend.InitGroup(groupUUID, []string{"testTaskUUID1"}))
+
+	shouldTrigger, err := backend.TriggerChord(groupUUID)
+	if assert.NoError(t, err) {
+		assert.True(t, shouldTrigger)
+	}
+
+	shouldTrigger, err = backend.TriggerChord(groupUUID)
+	if assert.NoError(t, err) {
+		assert.False(t, shouldTrigger)
+	}
+}
+
+func TestGetState(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{UUID: "testTaskUUID", Name: "add"}
+	path := filepath.Join(t.TempDir(), "results.db")
+
+	backend, err := sqlite.New(new(config.Config), path)
+	require.NoError(t, err)
+
+	_, err = backend.GetState(signature.UUID)
+	assert.Error(t, err)
+
+	assert.NoError(t, backend.SetStatePending(signature))
+	assert.NoError(t, backend.SetStateReceived(signature))
+
+	// States are persisted, a backend reopening the same file sees them
+	reopened, err := sqlite.New(new(config.Config), path)
+	require.NoError(t, err)
+
+	state, err := reopened.GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateReceived, state.State)
+	}
+
+	assert.NoError(t, backend.PurgeState(signature.UUID))
+	_, err = reopened.GetState(signature.UUID)
+	assert.Error(t, err)
+}
+
+func TestResultsExpireIn(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{UUID: "testTaskUUID"}
+	backend := newBackend(t, &config.Config{ResultsExpireIn: -1})
+
+	assert.NoError(t, backend.SetStatePending(signature))
+	_, err := backend.GetState(signature.UUID)
+	assert.Error(t, err)
+}
+
+func TestCollectGarbage(t *testing.T) {
+	t.Parallel()
+
+	backend := newBackend(t, &config.Config{ResultsExpireIn: -1})
+	assert.NoError(t, backend.SetStatePending(&tasks.Signature{UUID: "testTaskUUID"}))
+	assert.NoError(t, backend.InitGroup("testGroupUUID", []string{"testTaskUUID"}))
+
+	gc := backends.NewGC(backend, time.Hour)
+	purged, err := gc.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, purged)
+
+	purged, err = gc.Collect(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, purged)
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	backend := newBackend(t, new(config.Config))
+	assert.NoError(t, backend.HealthCheck(context.Background()))
+}
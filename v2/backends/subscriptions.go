@@ -0,0 +1,25 @@
+package backends
+
+import (
+	"context"
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrSubscriptionsNotSupported is returned when a backend does not push
+// changes of task states
+var ErrSubscriptionsNotSupported = errors.New("Result backend does not push task state changes")
+
+// Subscribe returns a channel receiving the new state of the task on each
+// change, pushed by the backend or the first backend it wraps pushing them.
+// States pushed by a wrapped backend are the ones it saved, e.g. with
+// encrypted results, so the state should be read again from the backend.
+func Subscribe(ctx context.Context, backend iface.Backend, taskUUID string) (<-chan *tasks.TaskState, error) {
+	found := implementations[iface.StateSubscriber](backend)
+	if len(found) == 0 {
+		return nil, ErrSubscriptionsNotSupported
+	}
+	return found[0].Subscribe(ctx, taskUUID)
+}
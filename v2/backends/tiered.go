@@ -0,0 +1,271 @@
+package backends
+
+import (
+	"context"
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrNoBackends is returned when a tiered backend has no backends
+var ErrNoBackends = errors.New("Tiered backend has no backends")
+
+// ReadConsistency determines which backends of a tiered backend task states
+// are read from
+type ReadConsistency int
+
+const (
+	// ReadFastest reads from the first backend, falling back to the next
+	// backends when reading fails
+	ReadFastest ReadConsistency = iota
+	// ReadDurable reads from the last backend
+	ReadDurable
+	// ReadLatest reads from all backends and returns the most progressed
+	// state, e.g. SUCCESS over STARTED
+	ReadLatest
+)
+
+// stateProgress orders states by how far a task has progressed
+var stateProgress = map[string]int{
+	tasks.StatePending:  0,
+	tasks.StateReceived: 1,
+	tasks.StateStarted:  2,
+	tasks.StateRetry:    3,
+	tasks.StateSuccess:  4,
+	tasks.StateFailure:  4,
+	tasks.StateCanceled: 4,
+}
+
+// Tiered writes task states and group metas to several backends, ordered
+// from the fastest to the most durable, e.g. Redis for fast polling and a
+// database for durability. Reads depend on the read consistency. Chords are
+// triggered by the first backend only, so it has to flag them atomically.
+type Tiered struct {
+	backends    []iface.Backend
+	consistency ReadConsistency
+}
+
+// NewTiered creates Tiered instance, backends are ordered from the fastest
+// to the most durable
+func NewTiered(consistency ReadConsistency, backends ...iface.Backend) *Tiered {
+	return &Tiered{
+		backends:    backends,
+		consistency: consistency,
+	}
+}
+
+// InitGroup creates and saves a group meta data object
+func (t *Tiered) InitGroup(groupUUID string, taskUUIDs []string) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.InitGroup(groupUUID, taskUUIDs)
+	})
+}
+
+// GroupCompleted returns true if all tasks in a group finished
+func (t *Tiered) GroupCompleted(groupUUID string, groupTaskCount int) (bool, error) {
+	taskStates, err := t.GroupTaskStates(groupUUID, groupTaskCount)
+	if err != nil {
+		return false, err
+	}
+
+	var countSuccessTasks = 0
+	for _, taskState := range taskStates {
+		if taskState.IsCompleted() {
+			countSuccessTasks++
+		}
+	}
+
+	return countSuccessTasks == groupTaskCount, nil
+}
+
+// GroupTaskStates returns states of all tasks in the group
+func (t *Tiered) GroupTaskStates(groupUUID string, groupTaskCount int) ([]*tasks.TaskState, error) {
+	var latest []*tasks.TaskState
+	err := t.read(func(backend iface.Backend) error {
+		states, err := backend.GroupTaskStates(groupUUID, groupTaskCount)
+		if err != nil {
+			return err
+		}
+
+		if latest == nil || len(latest) != len(states) {
+			latest = states
+			return nil
+		}
+		for i, state := range states {
+			if state.TaskUUID == latest[i].TaskUUID && progressed(state, latest[i]) {
+				latest[i] = state
+			}
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// TriggerChord flags chord as triggered in the backend storage to make sure
+// chord is never trigerred multiple times. Returns a boolean flag to indicate
+// whether the worker should trigger chord (true) or no if it has been triggered
+// already (false)
+func (t *Tiered) TriggerChord(groupUUID string) (bool, error) {
+	if len(t.backends) == 0 {
+		return false, ErrNoBackends
+	}
+	return t.backends[0].TriggerChord(groupUUID)
+}
+
+// SetStatePending updates task state to PENDING
+func (t *Tiered) SetStatePending(signature *tasks.Signature) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.SetStatePending(signature)
+	})
+}
+
+// SetStateReceived updates task state to RECEIVED
+func (t *Tiered) SetStateReceived(signature *tasks.Signature) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.SetStateReceived(signature)
+	})
+}
+
+// SetStateStarted updates task state to STARTED
+func (t *Tiered) SetStateStarted(signature *tasks.Signature) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.SetStateStarted(signature)
+	})
+}
+
+// SetStateRetry updates task state to RETRY
+func (t *Tiered) SetStateRetry(signature *tasks.Signature) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.SetStateRetry(signature)
+	})
+}
+
+// SetStateSuccess updates task state to SUCCESS
+func (t *Tiered) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.SetStateSuccess(signature, results)
+	})
+}
+
+// SetStateFailure updates task state to FAILURE
+func (t *Tiered) SetStateFailure(signature *tasks.Signature, err string) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.SetStateFailure(signature, err)
+	})
+}
+
+// SetStateCanceled updates task state to CANCELED
+func (t *Tiered) SetStateCanceled(signature *tasks.Signature) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.SetStateCanceled(signature)
+	})
+}
+
+// GetState returns the latest task state
+func (t *Tiered) GetState(taskUUID string) (*tasks.TaskState, error) {
+	var latest *tasks.TaskState
+	err := t.read(func(backend iface.Backend) error {
+		state, err := backend.GetState(taskUUID)
+		if err != nil {
+			return err
+		}
+
+		if latest == nil || progressed(state, latest) {
+			latest = state
+		}
+		return nil
+	})
+	return latest, err
+}
+
+// IsAMQP returns true when the first backend is AMQP
+func (t *Tiered) IsAMQP() bool {
+	return len(t.backends) > 0 && t.backends[0].IsAMQP()
+}
+
+// PurgeState deletes stored task state
+func (t *Tiered) PurgeState(taskUUID string) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.PurgeState(taskUUID)
+	})
+}
+
+// PurgeGroupMeta deletes stored group meta data
+func (t *Tiered) PurgeGroupMeta(groupUUID string) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.PurgeGroupMeta(groupUUID)
+	})
+}
+
+// HealthCheck returns an error when any of the backends is unhealthy
+func (t *Tiered) HealthCheck(ctx context.Context) error {
+	return t.write(func(backend iface.Backend) error {
+		return backend.HealthCheck(ctx)
+	})
+}
+
+// Unwrap returns the tiered backends
+func (t *Tiered) Unwrap() []iface.Backend {
+	return t.backends
+}
+
+// write calls fn with every backend, a failing backend does not stop the
+// remaining ones from being written to and its error is returned
+func (t *Tiered) write(fn func(backend iface.Backend) error) error {
+	if len(t.backends) == 0 {
+		return ErrNoBackends
+	}
+
+	var firstErr error
+	for _, backend := range t.backends {
+		if err := fn(backend); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// read calls fn with the backends selected by the read consistency, the error
+// of the last backend is returned if none succeeded
+func (t *Tiered) read(fn func(backend iface.Backend) error) error {
+	if len(t.backends) == 0 {
+		return ErrNoBackends
+	}
+
+	switch t.consistency {
+	case ReadDurable:
+		return fn(t.backends[len(t.backends)-1])
+	case ReadLatest:
+		var (
+			lastErr   error
+			succeeded bool
+		)
+		for _, backend := range t.backends {
+			if err := fn(backend); err != nil {
+				lastErr = err
+				continue
+			}
+			succeeded = true
+		}
+		if succeeded {
+			return nil
+		}
+		return lastErr
+	default:
+		var lastErr error
+		for _, backend := range t.backends {
+			err := fn(backend)
+			if err == nil {
+				return nil
+			}
+			lastErr = err
+		}
+		return lastErr
+	}
+}
+
+// progressed returns true if the task of state has progressed further than in other
+func progressed(state, other *tasks.TaskState) bool {
+	return stateProgress[state.State] > stateProgress[other.State]
+}
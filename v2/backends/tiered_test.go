@@ -0,0 +1,111 @@
+package backends_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// failingBackend fails every call
+type failingBackend struct {
+	iface.Backend
+}
+
+func (b failingBackend) SetStateSuccess(signature *tasks.Signature, results []*tasks.TaskResult) error {
+	return errors.New("unavailable")
+}
+
+func (b failingBackend) GetState(taskUUID string) (*tasks.TaskState, error) {
+	return nil, errors.New("unavailable")
+}
+
+func (b failingBackend) HealthCheck(ctx context.Context) error {
+	return errors.New("unavailable")
+}
+
+func TestTieredWrite(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	fast, durable := memory.New(cnf), memory.New(cnf)
+	tiered := backends.NewTiered(backends.ReadFastest, fast, durable)
+
+	signature := &tasks.Signature{UUID: "taskUUID", GroupUUID: "groupUUID"}
+	assert.NoError(t, tiered.InitGroup("groupUUID", []string{signature.UUID}))
+	assert.NoError(t, tiered.SetStateSuccess(signature, nil))
+
+	for _, backend := range []iface.Backend{fast, durable} {
+		state, err := backend.GetState(signature.UUID)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tasks.StateSuccess, state.State)
+		}
+	}
+
+	completed, err := tiered.GroupCompleted("groupUUID", 1)
+	if assert.NoError(t, err) {
+		assert.True(t, completed)
+	}
+
+	// Chords are only triggered by the first backend
+	shouldTrigger, err := tiered.TriggerChord("groupUUID")
+	if assert.NoError(t, err) {
+		assert.True(t, shouldTrigger)
+	}
+	shouldTrigger, err = durable.TriggerChord("groupUUID")
+	if assert.NoError(t, err) {
+		assert.True(t, shouldTrigger)
+	}
+
+	// A failing backend does not stop writes to the other ones
+	unavailable := failingBackend{memory.New(cnf)}
+	tiered = backends.NewTiered(backends.ReadFastest, unavailable, durable)
+	assert.Error(t, tiered.SetStateSuccess(&tasks.Signature{UUID: "otherTaskUUID"}, nil))
+	_, err = durable.GetState("otherTaskUUID")
+	assert.NoError(t, err)
+	assert.Error(t, tiered.HealthCheck(context.Background()))
+}
+
+func TestTieredRead(t *testing.T) {
+	t.Parallel()
+
+	cnf := new(config.Config)
+	fast, durable := memory.New(cnf), memory.New(cnf)
+	signature := &tasks.Signature{UUID: "taskUUID"}
+
+	// The fast backend lags behind the durable one
+	fast.SetStateStarted(signature)
+	durable.SetStateSuccess(signature, nil)
+
+	state, err := backends.NewTiered(backends.ReadFastest, fast, durable).GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateStarted, state.State)
+	}
+
+	state, err = backends.NewTiered(backends.ReadDurable, fast, durable).GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateSuccess, state.State)
+	}
+
+	state, err = backends.NewTiered(backends.ReadLatest, fast, durable).GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateSuccess, state.State)
+	}
+
+	// Reads fall back to the next backend
+	unavailable := failingBackend{fast}
+	state, err = backends.NewTiered(backends.ReadFastest, unavailable, durable).GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateSuccess, state.State)
+	}
+
+	_, err = backends.NewTiered(backends.ReadFastest).GetState(signature.UUID)
+	assert.Equal(t, backends.ErrNoBackends, err)
+}
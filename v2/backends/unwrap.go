@@ -0,0 +1,42 @@
+package backends
+
+import (
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+)
+
+// implementations returns the backends implementing T, the backend itself or
+// the backends it wraps, in the order of the tiers of tiered backends
+func implementations[T any](backend iface.Backend) []T {
+	return find[T](backend, true)
+}
+
+// plaintextImplementations returns the backends implementing T like
+// implementations, except for backends wrapped by Encrypted, which would
+// store what T records in plain text
+func plaintextImplementations[T any](backend iface.Backend) []T {
+	return find[T](backend, false)
+}
+
+func find[T any](backend iface.Backend, throughEncrypted bool) []T {
+	if backend == nil {
+		return nil
+	}
+	if implementation, ok := backend.(T); ok {
+		return []T{implementation}
+	}
+	if _, ok := backend.(*Encrypted); ok && !throughEncrypted {
+		return nil
+	}
+
+	switch b := backend.(type) {
+	case iface.Wrapper:
+		return find[T](b.Unwrap(), throughEncrypted)
+	case iface.MultiWrapper:
+		var found []T
+		for _, wrapped := range b.Unwrap() {
+			found = append(found, find[T](wrapped, throughEncrypted)...)
+		}
+		return found
+	}
+	return nil
+}
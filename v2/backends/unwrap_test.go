@@ -0,0 +1,86 @@
+package backends_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/null"
+	"github.com/RichardKnop/machinery/v2/backends/objectstore"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// wrappingBackend wraps a backend without embedding it, like the ClickHouse
+// backend wraps its primary backend
+type wrappingBackend struct {
+	iface.Backend
+}
+
+func (b wrappingBackend) Unwrap() iface.Backend {
+	return b.Backend
+}
+
+func TestUnwrap(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{
+		ResultEncryptionKey: base64.StdEncoding.EncodeToString([]byte("0123456789abcdef")),
+	}
+	wrapped := memory.New(cnf)
+	backend := backends.NewTiered(
+		backends.ReadFastest,
+		null.New(),
+		wrappingBackend{Backend: objectstore.New(wrapped, nil, 1024)},
+	)
+
+	_, claimed, err := backends.ClaimIdempotencyKey(backend, "key", "taskUUID", time.Minute)
+	if assert.NoError(t, err) {
+		assert.True(t, claimed)
+	}
+	require.NoError(t, backends.AppendFailure(backend, "taskUUID", &tasks.Failure{Attempt: 1, Error: "boom"}))
+	history, err := backends.Failures(wrapped, "taskUUID")
+	if assert.NoError(t, err) {
+		assert.Len(t, history, 1)
+	}
+
+	// Failures would be stored in plain text by the backend Encrypted wraps
+	encrypted, err := backends.NewEncrypted(cnf, backend)
+	require.NoError(t, err)
+	err = backends.AppendFailure(encrypted, "taskUUID", &tasks.Failure{Attempt: 2, Error: "boom"})
+	assert.Equal(t, backends.ErrFailureHistoryNotSupported, err)
+	_, claimed, err = backends.ClaimIdempotencyKey(encrypted, "key", "otherTaskUUID", time.Minute)
+	if assert.NoError(t, err) {
+		assert.False(t, claimed)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	wrapped := memory.New(new(config.Config))
+	backend := objectstore.New(wrapped, nil, 1024)
+	changes, err := backends.Subscribe(ctx, backend, "taskUUID")
+	require.NoError(t, err)
+
+	require.NoError(t, backend.SetStatePending(&tasks.Signature{UUID: "taskUUID"}))
+	select {
+	case state := <-changes:
+		assert.Equal(t, tasks.StatePending, state.State)
+	case <-time.After(time.Second):
+		t.Fatal("task state change was not pushed")
+	}
+
+	_, err = backends.Subscribe(ctx, null.New(), "taskUUID")
+	assert.Equal(t, backends.ErrSubscriptionsNotSupported, err)
+}
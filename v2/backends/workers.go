@@ -0,0 +1,68 @@
+package backends
+
+import (
+	"errors"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// ErrWorkerRegistryNotSupported is returned when a backend does not record
+// the workers consuming tasks
+var ErrWorkerRegistryNotSupported = errors.New("Result backend does not record workers")
+
+// WorkerRegistrySupported returns true if the backend or the backends it
+// wraps record workers
+func WorkerRegistrySupported(backend iface.Backend) bool {
+	return len(workerRegistries(backend)) > 0
+}
+
+// RegisterWorker records the worker until the TTL passed in the backend or
+// the backends it wraps
+func RegisterWorker(backend iface.Backend, worker *tasks.WorkerInfo, ttl time.Duration) error {
+	found := workerRegistries(backend)
+	if len(found) == 0 {
+		return ErrWorkerRegistryNotSupported
+	}
+
+	for _, registry := range found {
+		if err := registry.RegisterWorker(worker, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnregisterWorker removes the worker from the backend or the backends it
+// wraps
+func UnregisterWorker(backend iface.Backend, workerID string) error {
+	found := workerRegistries(backend)
+	if len(found) == 0 {
+		return ErrWorkerRegistryNotSupported
+	}
+
+	for _, registry := range found {
+		if err := registry.UnregisterWorker(workerID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Workers returns the registered workers, read from the first backend
+// recording workers
+func Workers(backend iface.Backend) ([]*tasks.WorkerInfo, error) {
+	found := workerRegistries(backend)
+	if len(found) == 0 {
+		return nil, ErrWorkerRegistryNotSupported
+	}
+
+	return found[0].Workers()
+}
+
+// workerRegistries returns the backends recording workers, the backend
+// itself or the backends it wraps
+func workerRegistries(backend iface.Backend) []iface.WorkerRegistry {
+	return implementations[iface.WorkerRegistry](backend)
+}
@@ -0,0 +1,45 @@
+package backends_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/null"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestWorkerRegistry(t *testing.T) {
+	t.Parallel()
+
+	fast, durable := memory.New(new(config.Config)), memory.New(new(config.Config))
+	backend := backends.NewTiered(backends.ReadFastest, fast, durable)
+	assert.True(t, backends.WorkerRegistrySupported(backend))
+
+	alive := &tasks.WorkerInfo{ID: "alive", ConsumerTag: "worker", Queues: []string{"machinery_tasks"}}
+	gone := &tasks.WorkerInfo{ID: "gone", ConsumerTag: "worker"}
+	require.NoError(t, backends.RegisterWorker(backend, alive, time.Minute))
+	require.NoError(t, backends.RegisterWorker(backend, gone, time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	// Workers whose registration expired are not returned
+	workers, err := backends.Workers(durable)
+	if assert.NoError(t, err) && assert.Len(t, workers, 1) {
+		assert.Equal(t, alive, workers[0])
+	}
+
+	require.NoError(t, backends.UnregisterWorker(backend, alive.ID))
+	workers, err = backends.Workers(backend)
+	if assert.NoError(t, err) {
+		assert.Empty(t, workers)
+	}
+
+	assert.False(t, backends.WorkerRegistrySupported(null.New()))
+	_, err = backends.Workers(null.New())
+	assert.Equal(t, backends.ErrWorkerRegistryNotSupported, err)
+}
@@ -0,0 +1,145 @@
+package machinery
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+	"github.com/RichardKnop/machinery/v2/tracing"
+)
+
+// batchTask is a registered batch handler with the size and the wait of its
+// batches
+type batchTask struct {
+	handler tasks.BatchHandler
+	size    int
+	wait    time.Duration
+}
+
+// batch holds the tasks received for a batch handler until it is processed
+type batch struct {
+	entries []*batchEntry
+	timer   *time.Timer
+}
+
+// batchEntry is a task of a batch, done receives the error of finishing it
+type batchEntry struct {
+	item *tasks.BatchItem
+	done chan error
+}
+
+// processBatched adds the task to the pending batch of its name and waits
+// until the batch has been processed
+func (worker *Worker) processBatched(signature *tasks.Signature, batchTask *batchTask) error {
+	item, err := tasks.NewBatchItem(signature)
+	// if this failed, the task is malformed, fail it without retrying
+	if err != nil {
+		worker.moveToDeadLetterQueue(signature, tasks.DeadLetterReasonUnprocessable, err)
+		worker.taskFailed(signature, err)
+		return err
+	}
+
+	return <-worker.addToBatch(signature.Name, batchTask, item)
+}
+
+// addToBatch adds the item to the pending batch of the name, the batch is
+// processed once it is full or the wait passed since its first item was added
+func (worker *Worker) addToBatch(name string, batchTask *batchTask, item *tasks.BatchItem) <-chan error {
+	worker.batchesMu.Lock()
+	defer worker.batchesMu.Unlock()
+
+	if worker.batches == nil {
+		worker.batches = make(map[string]*batch)
+	}
+
+	pending, ok := worker.batches[name]
+	if !ok {
+		pending = new(batch)
+		pending.timer = time.AfterFunc(batchTask.wait, func() {
+			worker.flushBatch(name, pending, batchTask)
+		})
+		worker.batches[name] = pending
+	}
+
+	entry := &batchEntry{item: item, done: make(chan error, 1)}
+	pending.entries = append(pending.entries, entry)
+
+	if len(pending.entries) >= batchTask.size {
+		pending.timer.Stop()
+		delete(worker.batches, name)
+		go worker.processBatch(batchTask, pending.entries)
+	}
+
+	return entry.done
+}
+
+// flushBatch processes the batch once its wait passed unless it has already
+// been processed as full
+func (worker *Worker) flushBatch(name string, pending *batch, batchTask *batchTask) {
+	worker.batchesMu.Lock()
+	if worker.batches[name] != pending {
+		worker.batchesMu.Unlock()
+		return
+	}
+	delete(worker.batches, name)
+	worker.batchesMu.Unlock()
+
+	worker.processBatch(batchTask, pending.entries)
+}
+
+// processBatch calls the batch handler once with the tasks of the batch and
+// then finishes each of them like a task returning the error of the handler
+func (worker *Worker) processBatch(batchTask *batchTask, entries []*batchEntry) {
+	started := make([]*batchEntry, 0, len(entries))
+	items := make([]*tasks.BatchItem, 0, len(entries))
+	for _, entry := range entries {
+		signature := entry.item.Signature
+		if err := worker.setState(signature, tasks.StateStarted, worker.server.GetBackend().SetStateStarted); err != nil {
+			entry.done <- fmt.Errorf("Set state to 'started' for task %s returned error: %s", signature.UUID, err)
+			continue
+		}
+		worker.server.emitEvent(EventTaskStarted, signature, nil, "")
+		if worker.preTaskHandler != nil {
+			worker.preTaskHandler(signature)
+		}
+		started = append(started, entry)
+		items = append(items, entry.item)
+	}
+	if len(items) == 0 {
+		return
+	}
+
+	ctx, span := tracing.StartSpanFromHeaders(items[0].Signature.Headers, items[0].Signature.Name)
+	defer span.End()
+
+	startedAt := time.Now()
+	err := worker.callBatchHandler(ctx, batchTask.handler, items)
+
+	for _, entry := range started {
+		signature := entry.item.Signature
+		if worker.postTaskHandler != nil {
+			worker.postTaskHandler(signature)
+		}
+		if err != nil {
+			worker.recordFailure(signature, err, startedAt)
+			entry.done <- worker.taskErroredOrPanicked(signature, err)
+			continue
+		}
+		entry.done <- worker.taskSucceeded(signature, []*tasks.TaskResult{})
+	}
+}
+
+// callBatchHandler calls the batch handler recovering from its panics
+func (worker *Worker) callBatchHandler(ctx context.Context, handler tasks.BatchHandler, items []*tasks.BatchItem) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			log.ERROR.Printf("Batch handler of %d tasks %s panicked: %v", len(items), items[0].Signature.Name, e)
+			err = tasks.NewErrPanicked(e, debug.Stack())
+		}
+	}()
+
+	return handler(ctx, items)
+}
@@ -1,9 +1,7 @@
 package amqp
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
@@ -13,11 +11,25 @@ import (
 	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/retry"
 	"github.com/RichardKnop/machinery/v2/tasks"
 	"github.com/pkg/errors"
 	"github.com/streadway/amqp"
 )
 
+// Queue types which can be set in config.AMQP.QueueType
+const (
+	QueueTypeClassic = "classic"
+	QueueTypeQuorum  = "quorum"
+	QueueTypeStream  = "stream"
+)
+
+const defaultConfirmTimeout = 30 * time.Second
+
+// delayedMessageExchangeType is the exchange type provided by the
+// rabbitmq_delayed_message_exchange plugin
+const delayedMessageExchangeType = "x-delayed-message"
+
 type AMQPConnection struct {
 	queueName    string
 	connection   *amqp.Connection
@@ -26,6 +38,10 @@ type AMQPConnection struct {
 	confirmation <-chan amqp.Confirmation
 	errorchan    <-chan *amqp.Error
 	cleanup      chan struct{}
+	// publishMutex serializes publishing when waiting for publisher confirms,
+	// deliveryTag is the tag of the last message published on the channel
+	publishMutex sync.Mutex
+	deliveryTag  uint64
 }
 
 // Broker represents an AMQP broker
@@ -36,6 +52,10 @@ type Broker struct {
 
 	connections      map[string]*AMQPConnection
 	connectionsMutex sync.RWMutex
+
+	// pool of channels on a shared connection used to publish delayed tasks
+	pool     *common.AMQPPool
+	poolOnce sync.Once
 }
 
 // New creates new Broker instance
@@ -61,9 +81,9 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 		queueName,                       // queue name
 		true,                            // queue durable
 		false,                           // queue delete when unused
-		b.GetConfig().AMQP.BindingKey,   // queue binding key
+		b.bindingKey(queueName),         // queue binding key
 		nil,                             // exchange declare args
-		amqp.Table(b.GetConfig().AMQP.QueueDeclareArgs), // queue declare args
+		b.queueDeclareArgs(queueName),   // queue declare args
 		amqp.Table(b.GetConfig().AMQP.QueueBindingArgs), // queue binding args
 	)
 	if err != nil {
@@ -72,8 +92,35 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 	}
 	defer b.Close(channel, conn)
 
+	if err := b.declareDeadLetterQueue(channel, queueName); err != nil {
+		return b.GetRetry(), err
+	}
+
+	prefetchCount := b.GetConfig().AMQP.PrefetchCount
+	if queueConfig := b.GetConfig().GetQueueConfig(queueName); queueConfig.PrefetchCount > 0 {
+		prefetchCount = queueConfig.PrefetchCount
+	}
+	if customPrefetch := common.GetCustomPrefetch(taskProcessor); customPrefetch > 0 {
+		prefetchCount = customPrefetch
+	}
+	var consumeArgs amqp.Table
+	if b.isStream() {
+		// Consuming from a stream requires a prefetch count and the offset to start reading at
+		if prefetchCount <= 0 {
+			prefetchCount = concurrency
+		}
+		if prefetchCount <= 0 {
+			prefetchCount = 1
+		}
+		offset := b.GetConfig().AMQP.StreamOffset
+		if offset == "" {
+			offset = "next"
+		}
+		consumeArgs = amqp.Table{"x-stream-offset": offset}
+	}
+
 	if err = channel.Qos(
-		b.GetConfig().AMQP.PrefetchCount,
+		prefetchCount,
 		0,     // prefetch size
 		false, // global
 	); err != nil {
@@ -87,12 +134,44 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 		false,       // exclusive
 		false,       // no-local
 		false,       // no-wait
-		nil,         // arguments
+		consumeArgs, // arguments
 	)
 	if err != nil {
 		return b.GetRetry(), fmt.Errorf("Queue consume error: %s", err)
 	}
 
+	broadcasts, err := b.consumeBroadcasts(channel, consumerTag)
+	if err != nil {
+		return b.GetRetry(), err
+	}
+
+	// A goroutine to process broadcast tasks published to every worker, it
+	// stops before the channel is closed
+	var broadcastWG sync.WaitGroup
+	consumed := make(chan struct{})
+	broadcastWG.Add(1)
+	go func() {
+		defer broadcastWG.Done()
+
+		for {
+			select {
+			case <-consumed:
+				return
+			case d, open := <-broadcasts:
+				if !open {
+					return
+				}
+				if err := b.consumeOne(d, taskProcessor, true); err != nil {
+					log.ERROR.Printf("Failed to process broadcast task: %s", err)
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(consumed)
+		broadcastWG.Wait()
+	}()
+
 	log.INFO.Print("[*] Waiting for messages. To exit press CTRL+C")
 
 	if err := b.consume(deliveries, concurrency, taskProcessor, amqpCloseChan); err != nil {
@@ -178,6 +257,35 @@ func (b *Broker) CloseConnections() error {
 		close(conn.cleanup)
 		delete(b.connections, key)
 	}
+
+	if b.pool != nil {
+		if err := b.pool.Close(); err != nil {
+			log.ERROR.Print("Failed to close pooled connection")
+		}
+	}
+	return nil
+}
+
+// channelPool returns the pool of channels, creating it on first use
+func (b *Broker) channelPool() *common.AMQPPool {
+	b.poolOnce.Do(func() {
+		b.pool = common.NewAMQPPool(
+			b.GetConfig().Broker,
+			b.GetConfig().MultipleBrokerSeparator,
+			b.GetConfig().TLSConfig,
+			b.GetConfig().AMQP.ChannelPoolSize,
+		)
+	})
+	return b.pool
+}
+
+// HealthCheck checks a channel can be opened on the connection to RabbitMQ
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return err
+	}
+	b.channelPool().Put(channel)
 	return nil
 }
 
@@ -186,9 +294,9 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 	// Adjust routing key (this decides which queue the message will be published to)
 	b.AdjustRoutingKey(signature)
 
-	msg, err := json.Marshal(signature)
+	msg, err := b.MarshalSignature(signature)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal signature error: %s", err)
 	}
 
 	// Check the ETA signature field, if it is set and it is in the future,
@@ -204,7 +312,7 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 	}
 
 	queue := b.GetConfig().DefaultQueue
-	bindingKey := b.GetConfig().AMQP.BindingKey // queue binding key
+	bindingKey := b.bindingKey(queue) // queue binding key
 	if b.isDirectExchange() {
 		queue = signature.RoutingKey
 		bindingKey = signature.RoutingKey
@@ -212,9 +320,9 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 
 	connection, err := b.GetOrOpenConnection(
 		queue,
-		bindingKey, // queue binding key
-		nil,        // exchange declare args
-		amqp.Table(b.GetConfig().AMQP.QueueDeclareArgs), // queue declare args
+		bindingKey,                // queue binding key
+		nil,                       // exchange declare args
+		b.queueDeclareArgs(queue), // queue declare args
 		amqp.Table(b.GetConfig().AMQP.QueueBindingArgs), // queue binding args
 	)
 	if err != nil {
@@ -224,18 +332,38 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 	channel := connection.channel
 	confirmsChan := connection.confirmation
 
+	publishing := amqp.Publishing{
+		Headers:      amqp.Table(signature.Headers),
+		ContentType:  b.ContentType(),
+		Body:         msg,
+		Priority:     b.priority(signature, queue),
+		DeliveryMode: amqp.Persistent,
+	}
+
+	if b.GetConfig().AMQP.PublisherConfirms {
+		connection.publishMutex.Lock()
+		defer connection.publishMutex.Unlock()
+
+		if err := channel.Publish(
+			b.GetConfig().AMQP.Exchange, // exchange name
+			signature.RoutingKey,        // routing key
+			false,                       // mandatory
+			false,                       // immediate
+			publishing,
+		); err != nil {
+			return errors.Wrap(err, "Failed to publish task")
+		}
+		connection.deliveryTag++
+
+		return b.waitForConfirm(confirmsChan, connection.deliveryTag)
+	}
+
 	if err := channel.Publish(
 		b.GetConfig().AMQP.Exchange, // exchange name
 		signature.RoutingKey,        // routing key
 		false,                       // mandatory
 		false,                       // immediate
-		amqp.Publishing{
-			Headers:      amqp.Table(signature.Headers),
-			ContentType:  "application/json",
-			Body:         msg,
-			Priority:     signature.Priority,
-			DeliveryMode: amqp.Persistent,
-		},
+		publishing,
 	); err != nil {
 		return errors.Wrap(err, "Failed to publish task")
 	}
@@ -249,6 +377,111 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 	return fmt.Errorf("Failed delivery of delivery tag: %v", confirmed.DeliveryTag)
 }
 
+// PublishBroadcast publishes a new message on the fanout exchange every
+// consuming worker has bound a queue of its own to
+func (b *Broker) PublishBroadcast(ctx context.Context, signature *tasks.Signature) error {
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return err
+	}
+
+	if err := b.declareBroadcastExchange(channel.Channel); err != nil {
+		b.channelPool().Discard(channel)
+		return err
+	}
+
+	if err := channel.PublishAndConfirm(
+		b.broadcastExchange(), // exchange
+		"",                    // routing key
+		amqp.Publishing{
+			Headers:      amqp.Table(signature.Headers),
+			ContentType:  b.ContentType(),
+			Body:         msg,
+			DeliveryMode: amqp.Persistent,
+		},
+		b.confirmTimeout(),
+	); err != nil {
+		b.channelPool().Discard(channel)
+		return err
+	}
+
+	b.channelPool().Put(channel)
+	return nil
+}
+
+// consumeBroadcasts declares an exclusive queue of the worker bound to the
+// broadcast exchange and consumes from it, the queue is deleted once the
+// worker disconnects
+func (b *Broker) consumeBroadcasts(channel *amqp.Channel, consumerTag string) (<-chan amqp.Delivery, error) {
+	if err := b.declareBroadcastExchange(channel); err != nil {
+		return nil, err
+	}
+
+	queue, err := channel.QueueDeclare(
+		"",    // name, generated by the server
+		false, // durable
+		true,  // delete when unused
+		true,  // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Broadcast queue declare error: %s", err)
+	}
+
+	if err := channel.QueueBind(
+		queue.Name,            // name of the queue
+		"",                    // binding key
+		b.broadcastExchange(), // source exchange
+		false,                 // noWait
+		nil,                   // arguments
+	); err != nil {
+		return nil, fmt.Errorf("Broadcast queue bind error: %s", err)
+	}
+
+	deliveries, err := channel.Consume(
+		queue.Name,               // queue
+		consumerTag+"_broadcast", // consumer tag
+		false,                    // auto-ack
+		true,                     // exclusive
+		false,                    // no-local
+		false,                    // no-wait
+		nil,                      // arguments
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Broadcast queue consume error: %s", err)
+	}
+	return deliveries, nil
+}
+
+// declareBroadcastExchange declares the fanout exchange broadcast tasks are
+// published to
+func (b *Broker) declareBroadcastExchange(channel *amqp.Channel) error {
+	if err := channel.ExchangeDeclare(
+		b.broadcastExchange(), // name of the exchange
+		amqp.ExchangeFanout,   // type
+		true,                  // durable
+		false,                 // delete when complete
+		false,                 // internal
+		false,                 // noWait
+		nil,                   // arguments
+	); err != nil {
+		return fmt.Errorf("Broadcast exchange declare error: %s", err)
+	}
+	return nil
+}
+
+// broadcastExchange returns the name of the fanout exchange broadcast tasks
+// are published to, the exchange with the "_broadcast" suffix
+func (b *Broker) broadcastExchange() string {
+	return b.GetConfig().AMQP.Exchange + "_broadcast"
+}
+
 // consume takes delivered messages from the channel and manages a worker pool
 // to process tasks concurrently
 func (b *Broker) consume(deliveries <-chan amqp.Delivery, concurrency int, taskProcessor iface.TaskProcessor, amqpCloseChan <-chan *amqp.Error) error {
@@ -311,16 +544,16 @@ func (b *Broker) consumeOne(delivery amqp.Delivery, taskProcessor iface.TaskProc
 
 	// Unmarshal message body into signature struct
 	signature := new(tasks.Signature)
-	decoder := json.NewDecoder(bytes.NewReader(delivery.Body))
-	decoder.UseNumber()
-	if err := decoder.Decode(signature); err != nil {
+	if err := b.UnmarshalSignatureWithContentType(delivery.Body, delivery.ContentType, signature); err != nil {
 		delivery.Nack(multiple, requeue)
 		return errs.NewErrCouldNotUnmarshalTaskSignature(delivery.Body, err)
 	}
 
 	// If the task is not registered, we nack it and requeue,
-	// there might be different workers for processing specific tasks
-	if !b.IsTaskRegistered(signature.Name) {
+	// there might be different workers for processing specific tasks.
+	// Broadcast tasks are left to the worker, which handles control tasks and
+	// drops the others it does not know, other workers received their own copy
+	if !b.IsTaskRegistered(signature.Name) && !signature.Broadcast {
 		requeue = true
 		log.INFO.Printf("Task not registered with this worker. Requeing message: %s", delivery.Body)
 
@@ -331,6 +564,12 @@ func (b *Broker) consumeOne(delivery amqp.Delivery, taskProcessor iface.TaskProc
 		return nil
 	}
 
+	// Requeueing a message which reached the delivery limit of a quorum queue
+	// would drop it, hand it over to the retry or dead letter flow instead
+	if ack && b.deliveryLimitReached(delivery) {
+		return b.handleDeliveryLimit(delivery, signature)
+	}
+
 	log.DEBUG.Printf("Received new message: %s", delivery.Body)
 
 	err := taskProcessor.Process(signature)
@@ -349,9 +588,13 @@ func (b *Broker) delay(signature *tasks.Signature, delayMs int64) error {
 		return errors.New("Cannot delay task by 0ms")
 	}
 
-	message, err := json.Marshal(signature)
+	message, err := b.MarshalSignature(signature)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	if b.GetConfig().AMQP.DelayedMessageExchange != "" {
+		return b.delayWithExchange(signature, message, delayMs)
 	}
 
 	// It's necessary to redeclare the queue each time (to zero its TTL timer).
@@ -372,10 +615,13 @@ func (b *Broker) delay(signature *tasks.Signature, delayMs int64) error {
 		// Time after that the queue will be deleted.
 		"x-expires": delayMs * 2,
 	}
-	conn, channel, _, _, _, err := b.Connect(
-		b.GetConfig().Broker,
-		b.GetConfig().MultipleBrokerSeparator,
-		b.GetConfig().TLSConfig,
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return err
+	}
+
+	if _, err := b.Declare(
+		channel.Channel,
 		b.GetConfig().AMQP.Exchange,     // exchange name
 		b.GetConfig().AMQP.ExchangeType, // exchange type
 		queueName,                       // queue name
@@ -385,31 +631,260 @@ func (b *Broker) delay(signature *tasks.Signature, delayMs int64) error {
 		nil,                             // exchange declare args
 		declareQueueArgs,                // queue declare args
 		amqp.Table(b.GetConfig().AMQP.QueueBindingArgs), // queue binding args
-	)
-	if err != nil {
+	); err != nil {
+		b.channelPool().Put(channel)
 		return err
 	}
 
-	defer b.Close(channel, conn)
+	// The priority is kept when the message expires and is dead-lettered
+	// to the destination queue
+	destinationQueue := b.GetConfig().DefaultQueue
+	if b.isDirectExchange() {
+		destinationQueue = signature.RoutingKey
+	}
 
-	if err := channel.Publish(
+	// Pooled channels always wait for the confirmation, an unread one
+	// would block the next borrower of the channel
+	if err := channel.PublishAndConfirm(
 		b.GetConfig().AMQP.Exchange, // exchange
 		queueName,                   // routing key
-		false,                       // mandatory
-		false,                       // immediate
 		amqp.Publishing{
 			Headers:      amqp.Table(signature.Headers),
-			ContentType:  "application/json",
+			ContentType:  b.ContentType(),
 			Body:         message,
+			Priority:     b.priority(signature, destinationQueue),
 			DeliveryMode: amqp.Persistent,
 		},
+		b.confirmTimeout(),
 	); err != nil {
+		b.channelPool().Discard(channel)
 		return err
 	}
 
+	b.channelPool().Put(channel)
 	return nil
 }
 
+// delayWithExchange publishes the task to the exchange of the RabbitMQ delayed
+// message plugin which holds it for delayMs miliseconds before routing it to
+// the destination queue, no temporary queue is needed
+func (b *Broker) delayWithExchange(signature *tasks.Signature, message []byte, delayMs int64) error {
+	queue := b.GetConfig().DefaultQueue
+	bindingKey := b.bindingKey(queue) // queue binding key
+	if b.isDirectExchange() {
+		queue = signature.RoutingKey
+		bindingKey = signature.RoutingKey
+	}
+
+	channel, err := b.channelPool().Get()
+	if err != nil {
+		return err
+	}
+
+	// Bind the destination queue to the delayed exchange the same way
+	// it is bound to the main exchange
+	if _, err := b.Declare(
+		channel.Channel,
+		b.GetConfig().AMQP.DelayedMessageExchange, // exchange name
+		delayedMessageExchangeType,                // exchange type
+		queue,                                     // queue name
+		true,                                      // queue durable
+		false,                                     // queue delete when unused
+		bindingKey,                                // queue binding key
+		b.delayedExchangeDeclareArgs(),            // exchange declare args
+		b.queueDeclareArgs(queue),                 // queue declare args
+		amqp.Table(b.GetConfig().AMQP.QueueBindingArgs), // queue binding args
+	); err != nil {
+		b.channelPool().Put(channel)
+		return err
+	}
+
+	headers := make(amqp.Table, len(signature.Headers)+1)
+	for k, v := range signature.Headers {
+		headers[k] = v
+	}
+	headers["x-delay"] = delayMs
+
+	if err := channel.PublishAndConfirm(
+		b.GetConfig().AMQP.DelayedMessageExchange, // exchange
+		signature.RoutingKey,                      // routing key
+		amqp.Publishing{
+			Headers:      headers,
+			ContentType:  b.ContentType(),
+			Body:         message,
+			Priority:     b.priority(signature, queue),
+			DeliveryMode: amqp.Persistent,
+		},
+		b.confirmTimeout(),
+	); err != nil {
+		b.channelPool().Discard(channel)
+		return err
+	}
+
+	b.channelPool().Put(channel)
+	return nil
+}
+
+// delayedExchangeDeclareArgs returns the arguments of the delayed message
+// exchange, it routes messages the same way as the main exchange
+func (b *Broker) delayedExchangeDeclareArgs() amqp.Table {
+	exchangeType := b.GetConfig().AMQP.ExchangeType
+	if exchangeType == "" {
+		exchangeType = "direct"
+	}
+	return amqp.Table{"x-delayed-type": exchangeType}
+}
+
+// waitForConfirm blocks until the broker confirms the message with the delivery tag
+func (b *Broker) waitForConfirm(confirmsChan <-chan amqp.Confirmation, deliveryTag uint64) error {
+	return common.WaitForConfirm(confirmsChan, deliveryTag, b.confirmTimeout())
+}
+
+// confirmTimeout returns how long to wait for a publisher confirm
+func (b *Broker) confirmTimeout() time.Duration {
+	if b.GetConfig().AMQP.ConfirmTimeout > 0 {
+		return time.Duration(b.GetConfig().AMQP.ConfirmTimeout) * time.Second
+	}
+	return defaultConfirmTimeout
+}
+
+// handleDeliveryLimit republishes the task as a retry if it has retries left,
+// otherwise the message is rejected so it is routed to the dead letter exchange
+func (b *Broker) handleDeliveryLimit(delivery amqp.Delivery, signature *tasks.Signature) error {
+	if signature.RetryCount > 0 {
+		signature.RetryCount--
+		strategy, err := retry.GetStrategy(signature.RetryStrategy)
+		if err != nil {
+			strategy = retry.FibonacciStrategy()
+		}
+		retryIn := signature.NextRetryDelay(strategy)
+		eta := time.Now().UTC().Add(retryIn)
+		signature.ETA = &eta
+
+		log.WARNING.Printf("Task %s reached the delivery limit, retrying in %.0f seconds", signature.UUID, retryIn.Seconds())
+
+		if err := b.Publish(context.Background(), signature); err != nil {
+			delivery.Nack(false, false) // multiple, requeue
+			return err
+		}
+		return delivery.Ack(false) // multiple
+	}
+
+	log.ERROR.Printf("Task %s reached the delivery limit, rejecting message: %s", signature.UUID, delivery.Body)
+
+	return delivery.Nack(false, false) // multiple, requeue
+}
+
+// deliveryLimitReached returns true if the message comes from a quorum queue
+// and it has been delivered as many times as the delivery limit allows
+func (b *Broker) deliveryLimitReached(delivery amqp.Delivery) bool {
+	cnf := b.GetConfig().AMQP
+	if cnf == nil || cnf.QueueType != QueueTypeQuorum || cnf.DeliveryLimit <= 0 {
+		return false
+	}
+
+	var count int64
+	switch v := delivery.Headers["x-delivery-count"].(type) {
+	case int64:
+		count = v
+	case int32:
+		count = int64(v)
+	case int:
+		count = int64(v)
+	}
+	return count >= int64(cnf.DeliveryLimit)
+}
+
+// queueDeclareArgs returns QueueDeclareArgs extended with the arguments
+// required by the configured queue type
+func (b *Broker) queueDeclareArgs(queueName string) amqp.Table {
+	cnf := b.GetConfig().AMQP
+
+	args := make(amqp.Table, len(cnf.QueueDeclareArgs))
+	for k, v := range cnf.QueueDeclareArgs {
+		args[k] = v
+	}
+
+	switch cnf.QueueType {
+	case QueueTypeQuorum:
+		args["x-queue-type"] = QueueTypeQuorum
+		if cnf.DeliveryLimit > 0 {
+			args["x-delivery-limit"] = cnf.DeliveryLimit
+		}
+	case QueueTypeStream:
+		args["x-queue-type"] = QueueTypeStream
+	}
+
+	if cnf.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = cnf.DeadLetterExchange
+	}
+
+	// Rejected messages are routed by the default exchange to the dead letter queue
+	if deadLetterQueue := b.GetConfig().GetDeadLetterQueue(queueName); deadLetterQueue != "" {
+		args["x-dead-letter-exchange"] = ""
+		args["x-dead-letter-routing-key"] = deadLetterQueue
+	}
+
+	if maxPriority := b.maxPriority(queueName); maxPriority > 0 {
+		args["x-max-priority"] = int32(maxPriority)
+	}
+
+	return args
+}
+
+// maxPriority returns the highest priority supported by the queue, zero when
+// the queue does not support priorities
+func (b *Broker) maxPriority(queueName string) uint8 {
+	if maxPriority := b.GetConfig().GetQueueConfig(queueName).MaxPriority; maxPriority > 0 {
+		return maxPriority
+	}
+	return b.GetConfig().AMQP.MaxPriority
+}
+
+// priority returns the priority the task is published with to the queue,
+// RabbitMQ handles priorities above the highest one of the queue as the highest
+// one, they are capped so the message shows the priority it is consumed with
+func (b *Broker) priority(signature *tasks.Signature, queueName string) uint8 {
+	maxPriority := b.maxPriority(queueName)
+	if maxPriority > 0 && signature.Priority > maxPriority {
+		return maxPriority
+	}
+	return signature.Priority
+}
+
+// declareDeadLetterQueue declares the dead letter queue of the queue if it has one
+func (b *Broker) declareDeadLetterQueue(channel *amqp.Channel, queueName string) error {
+	deadLetterQueue := b.GetConfig().GetDeadLetterQueue(queueName)
+	if deadLetterQueue == "" {
+		return nil
+	}
+
+	// The default exchange routes to the queue without binding it
+	if _, err := channel.QueueDeclare(
+		deadLetterQueue, // name
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		nil,             // arguments
+	); err != nil {
+		return fmt.Errorf("Dead letter queue declare error: %s", err)
+	}
+	return nil
+}
+
+// bindingKey returns the binding key of the queue
+func (b *Broker) bindingKey(queueName string) string {
+	if bindingKey := b.GetConfig().GetQueueConfig(queueName).BindingKey; bindingKey != "" {
+		return bindingKey
+	}
+	return b.GetConfig().AMQP.BindingKey
+}
+
+func (b *Broker) isStream() bool {
+	return b.GetConfig().AMQP != nil && b.GetConfig().AMQP.QueueType == QueueTypeStream
+}
+
 func (b *Broker) isDirectExchange() bool {
 	return b.GetConfig().AMQP != nil && b.GetConfig().AMQP.ExchangeType == "direct"
 }
@@ -457,12 +932,17 @@ func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
 		queue = b.GetConfig().DefaultQueue
 	}
 
-	bindingKey := b.GetConfig().AMQP.BindingKey // queue binding key
+	// Messages are not removed from a stream once consumed
+	if b.isStream() {
+		return nil, errors.New("Getting pending tasks is not supported for streams")
+	}
+
+	bindingKey := b.bindingKey(queue) // queue binding key
 	conn, err := b.GetOrOpenConnection(
 		queue,
-		bindingKey, // queue binding key
-		nil,        // exchange declare args
-		amqp.Table(b.GetConfig().AMQP.QueueDeclareArgs), // queue declare args
+		bindingKey,                // queue binding key
+		nil,                       // exchange declare args
+		b.queueDeclareArgs(queue), // queue declare args
 		amqp.Table(b.GetConfig().AMQP.QueueBindingArgs), // queue binding args
 	)
 	if err != nil {
@@ -490,3 +970,87 @@ func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
 
 	return dumper.Signatures, nil
 }
+
+// queueChannel returns a channel of a connection to the queue, which is
+// declared if needed
+func (b *Broker) queueChannel(queue string) (*amqp.Channel, error) {
+	conn, err := b.GetOrOpenConnection(
+		queue,
+		b.bindingKey(queue),       // queue binding key
+		nil,                       // exchange declare args
+		b.queueDeclareArgs(queue), // queue declare args
+		amqp.Table(b.GetConfig().AMQP.QueueBindingArgs), // queue binding args
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to get a connection for queue %s", queue)
+	}
+	return conn.channel, nil
+}
+
+// PurgeQueue drops the messages waiting in the queue and returns how many
+// were dropped
+func (b *Broker) PurgeQueue(queue string) (int, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	channel, err := b.queueChannel(queue)
+	if err != nil {
+		return 0, err
+	}
+	purged, err := channel.QueuePurge(queue, false) // no-wait
+	if err != nil {
+		return 0, errors.Wrapf(err, "Failed to purge queue %s", queue)
+	}
+	return purged, nil
+}
+
+// MoveMessages moves up to limit messages waiting in a queue, all of them when
+// limit is not positive, to another queue and returns how many were moved.
+// Messages are published to the other queue before they are acknowledged, a
+// message which cannot be decoded is requeued and stops the move.
+func (b *Broker) MoveMessages(from, to string, limit int) (int, error) {
+	if from == "" {
+		from = b.GetConfig().DefaultQueue
+	}
+	if to == "" {
+		to = b.GetConfig().DefaultQueue
+	}
+
+	// Messages are not removed from a stream once consumed
+	if b.isStream() {
+		return 0, errors.New("Moving messages is not supported for streams")
+	}
+
+	channel, err := b.queueChannel(from)
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+	for limit <= 0 || moved < limit {
+		delivery, ok, err := channel.Get(from, false) // auto-ack
+		if err != nil {
+			return moved, errors.Wrap(err, "Failed to get from queue")
+		}
+		if !ok {
+			break
+		}
+
+		signature := new(tasks.Signature)
+		if err := b.UnmarshalSignatureWithContentType(delivery.Body, delivery.ContentType, signature); err != nil {
+			delivery.Nack(false, true) // multiple, requeue
+			return moved, errs.NewErrCouldNotUnmarshalTaskSignature(delivery.Body, err)
+		}
+		signature.RoutingKey = to
+		if err := b.Publish(context.Background(), signature); err != nil {
+			delivery.Nack(false, true) // multiple, requeue
+			return moved, err
+		}
+		if err := delivery.Ack(false); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	return moved, nil
+}
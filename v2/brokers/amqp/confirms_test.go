@@ -0,0 +1,44 @@
+package amqp
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+func TestWaitForConfirm(t *testing.T) {
+	t.Parallel()
+
+	broker := New(&config.Config{
+		AMQP: &config.AMQPConfig{PublisherConfirms: true, ConfirmTimeout: 1},
+	}).(*Broker)
+
+	t.Run("skips late confirmations", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation, 2)
+		confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: false}
+		confirms <- amqp.Confirmation{DeliveryTag: 2, Ack: true}
+
+		assert.NoError(t, broker.waitForConfirm(confirms, 2))
+	})
+
+	t.Run("nack", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation, 1)
+		confirms <- amqp.Confirmation{DeliveryTag: 1, Ack: false}
+
+		assert.Error(t, broker.waitForConfirm(confirms, 1))
+	})
+
+	t.Run("closed channel", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation)
+		close(confirms)
+
+		assert.Error(t, broker.waitForConfirm(confirms, 1))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		assert.Error(t, broker.waitForConfirm(make(chan amqp.Confirmation), 1))
+	})
+}
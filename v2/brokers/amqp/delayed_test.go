@@ -0,0 +1,29 @@
+package amqp
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+func TestDelayedExchangeDeclareArgs(t *testing.T) {
+	t.Parallel()
+
+	broker := New(&config.Config{
+		AMQP: &config.AMQPConfig{
+			ExchangeType:           "topic",
+			DelayedMessageExchange: "machinery_delayed",
+		},
+	}).(*Broker)
+
+	assert.Equal(t, amqp.Table{"x-delayed-type": "topic"}, broker.delayedExchangeDeclareArgs())
+
+	broker = New(&config.Config{
+		AMQP: &config.AMQPConfig{DelayedMessageExchange: "machinery_delayed"},
+	}).(*Broker)
+
+	assert.Equal(t, amqp.Table{"x-delayed-type": "direct"}, broker.delayedExchangeDeclareArgs())
+}
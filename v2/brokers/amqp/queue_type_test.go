@@ -0,0 +1,152 @@
+package amqp
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+type acknowledger struct {
+	acked, nacked, requeued bool
+}
+
+func (a *acknowledger) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *acknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	a.nacked, a.requeued = true, requeue
+	return nil
+}
+
+func (a *acknowledger) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+type countingProcessor struct {
+	processed int
+}
+
+func (p *countingProcessor) Process(signature *tasks.Signature) error {
+	p.processed++
+	return nil
+}
+
+func (p *countingProcessor) CustomQueue() string {
+	return ""
+}
+
+func (p *countingProcessor) PreConsumeHandler() bool {
+	return true
+}
+
+func TestQueueDeclareArgs(t *testing.T) {
+	t.Parallel()
+
+	broker := New(&config.Config{
+		AMQP: &config.AMQPConfig{
+			QueueDeclareArgs:   config.QueueDeclareArgs{"x-max-length": 100},
+			QueueType:          QueueTypeQuorum,
+			DeliveryLimit:      5,
+			DeadLetterExchange: "machinery_dlx",
+		},
+	}).(*Broker)
+
+	assert.Equal(t, amqp.Table{
+		"x-max-length":           100,
+		"x-queue-type":           "quorum",
+		"x-delivery-limit":       5,
+		"x-dead-letter-exchange": "machinery_dlx",
+	}, broker.queueDeclareArgs(""))
+
+	broker = New(&config.Config{
+		AMQP: &config.AMQPConfig{QueueType: QueueTypeStream},
+	}).(*Broker)
+
+	assert.Equal(t, amqp.Table{"x-queue-type": "stream"}, broker.queueDeclareArgs(""))
+}
+
+func TestConsumeOneDeliveryLimit(t *testing.T) {
+	t.Parallel()
+
+	broker := New(&config.Config{
+		AMQP: &config.AMQPConfig{QueueType: QueueTypeQuorum, DeliveryLimit: 3},
+	}).(*Broker)
+	broker.SetRegisteredTaskNames([]string{"add"})
+
+	body := []byte(`{"UUID":"1","Name":"add"}`)
+
+	t.Run("below the limit", func(t *testing.T) {
+		ack, processor := new(acknowledger), new(countingProcessor)
+		delivery := amqp.Delivery{Acknowledger: ack, Body: body, Headers: amqp.Table{"x-delivery-count": int64(2)}}
+
+		assert.NoError(t, broker.consumeOne(delivery, processor, true))
+		assert.Equal(t, 1, processor.processed)
+		assert.True(t, ack.acked)
+	})
+
+	t.Run("limit reached without retries left", func(t *testing.T) {
+		ack, processor := new(acknowledger), new(countingProcessor)
+		delivery := amqp.Delivery{Acknowledger: ack, Body: body, Headers: amqp.Table{"x-delivery-count": int64(3)}}
+
+		assert.NoError(t, broker.consumeOne(delivery, processor, true))
+		assert.Equal(t, 0, processor.processed)
+		assert.True(t, ack.nacked)
+		assert.False(t, ack.requeued)
+	})
+}
+
+func TestPerQueueConfig(t *testing.T) {
+	t.Parallel()
+
+	broker := New(&config.Config{
+		AMQP: &config.AMQPConfig{
+			BindingKey:         "machinery_task",
+			DeadLetterExchange: "machinery_dlx",
+		},
+		Queues: map[string]config.QueueConfig{
+			"reports": {
+				BindingKey:      "reports_task",
+				MaxPriority:     10,
+				DeadLetterQueue: "reports_dlq",
+			},
+		},
+	}).(*Broker)
+
+	assert.Equal(t, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": "reports_dlq",
+		"x-max-priority":            int32(10),
+	}, broker.queueDeclareArgs("reports"))
+	assert.Equal(t, "reports_task", broker.bindingKey("reports"))
+
+	assert.Equal(t, amqp.Table{"x-dead-letter-exchange": "machinery_dlx"}, broker.queueDeclareArgs("other"))
+	assert.Equal(t, "machinery_task", broker.bindingKey("other"))
+}
+
+func TestPriority(t *testing.T) {
+	t.Parallel()
+
+	broker := New(&config.Config{
+		AMQP: &config.AMQPConfig{MaxPriority: 5},
+		Queues: map[string]config.QueueConfig{
+			"urgent": {MaxPriority: 10},
+		},
+	}).(*Broker)
+
+	assert.Equal(t, amqp.Table{"x-max-priority": int32(5)}, broker.queueDeclareArgs("machinery_tasks"))
+	assert.Equal(t, amqp.Table{"x-max-priority": int32(10)}, broker.queueDeclareArgs("urgent"))
+
+	assert.Equal(t, uint8(3), broker.priority(&tasks.Signature{Priority: 3}, "machinery_tasks"))
+	assert.Equal(t, uint8(5), broker.priority(&tasks.Signature{Priority: 8}, "machinery_tasks"))
+	assert.Equal(t, uint8(8), broker.priority(&tasks.Signature{Priority: 8}, "urgent"))
+
+	// Without priorities the priority is published unchanged and ignored by RabbitMQ
+	broker.GetConfig().AMQP.MaxPriority = 0
+	assert.Equal(t, uint8(8), broker.priority(&tasks.Signature{Priority: 8}, "machinery_tasks"))
+}
@@ -0,0 +1,567 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const (
+	// pollPeriod is how often an empty queue is checked for new tasks
+	// published by another process
+	pollPeriod = time.Second
+	// delayedTasksPollPeriod is how often due delayed tasks are moved to their queue
+	delayedTasksPollPeriod = 500 * time.Millisecond
+)
+
+var delayedBucket = []byte("delayed")
+
+// delivery is a message taken from a queue together with its key in the
+// processing bucket
+type delivery struct {
+	key  []byte
+	body []byte
+}
+
+// Broker represents an embedded broker persisting tasks in a local bolt database.
+// A bolt database can only be opened by one process at a time, so all workers
+// and publishers of a deployment have to share the same broker instance.
+type Broker struct {
+	common.Broker
+	db           *bolt.DB
+	notify       chan struct{}  // signals consumers that a task has been queued
+	consumingWG  sync.WaitGroup // wait group to make sure whole consumption completes
+	processingWG sync.WaitGroup // use wait group to make sure task processing completes
+	delayedWG    sync.WaitGroup
+	requeuedMu   sync.Mutex
+	requeued     map[string]bool // queues whose processing bucket has been put back
+}
+
+// New creates new Broker instance, the database file is created if it does not exist
+func New(cnf *config.Config, path string) (iface.Broker, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Open bolt database %s error: %s", path, err)
+	}
+
+	return &Broker{
+		Broker:   common.NewBroker(cnf),
+		db:       db,
+		notify:   make(chan struct{}, 1),
+		requeued: make(map[string]bool),
+	}, nil
+}
+
+// StartConsuming enters a loop and waits for incoming messages
+func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) (bool, error) {
+	b.consumingWG.Add(1)
+	defer b.consumingWG.Done()
+
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU() * 2
+	}
+
+	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
+
+	queue := getQueue(b.GetConfig(), taskProcessor)
+
+	// Tasks still in the processing bucket were being processed when the
+	// process stopped, put them back so they are processed again. This is
+	// only done on the first start, a worker starting to consume again after
+	// an error may still be processing the tasks of the bucket.
+	if err := b.requeueProcessingOnce(queue); err != nil {
+		return b.GetRetry(), err
+	}
+
+	// Closed when this call returns to stop the goroutines it started, which
+	// does not stop consumption like b.StopConsuming
+	stop := make(chan struct{})
+	var loopsWG sync.WaitGroup
+
+	// Channel to which we will push tasks ready for processing by worker
+	deliveries := make(chan *delivery, concurrency)
+	pool := make(chan struct{}, concurrency)
+
+	// initialize worker pool with maxWorkers workers
+	for i := 0; i < concurrency; i++ {
+		pool <- struct{}{}
+	}
+
+	// A receiving goroutine keeps taking tasks from the queue and sends them
+	// to the deliveries channel
+	loopsWG.Add(1)
+	go func() {
+		defer loopsWG.Done()
+
+		log.INFO.Print("[*] Waiting for messages. To exit press CTRL+C")
+
+		for {
+			select {
+			// A way to stop this goroutine from b.StopConsuming
+			case <-b.GetStopChan():
+				return
+			case <-stop:
+				return
+			case <-pool:
+				d, err := b.nextTask(queue)
+				if err != nil {
+					log.ERROR.Print(err)
+				}
+				if d != nil {
+					select {
+					case deliveries <- d:
+					case <-b.GetStopChan():
+						return
+					case <-stop:
+						// The task is not going to be processed, put it back
+						if err := b.done(queue, d.key, d.body); err != nil {
+							log.ERROR.Print(err)
+						}
+						return
+					}
+				} else {
+					// Nothing queued, wait for a task to be published
+					select {
+					case <-b.notify:
+					case <-time.After(pollPeriod):
+					case <-b.GetStopChan():
+						return
+					case <-stop:
+						return
+					}
+				}
+
+				pool <- struct{}{}
+			}
+		}
+	}()
+
+	// A goroutine to watch for delayed tasks and move them to their queue
+	// once they are due
+	b.delayedWG.Add(1)
+	loopsWG.Add(1)
+	go func() {
+		defer b.delayedWG.Done()
+		defer loopsWG.Done()
+
+		ticker := time.NewTicker(delayedTasksPollPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			// A way to stop this goroutine from b.StopConsuming
+			case <-b.GetStopChan():
+				return
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := b.moveDueTasks(time.Now().UTC()); err != nil {
+					log.ERROR.Print(err)
+				}
+			}
+		}
+	}()
+
+	err := b.consume(deliveries, queue, concurrency, taskProcessor)
+
+	// Stop the goroutines before the worker may start consuming again, tasks
+	// received but not processed are put back to the queue
+	close(stop)
+	loopsWG.Wait()
+	close(deliveries)
+	for d := range deliveries {
+		if err := b.done(queue, d.key, d.body); err != nil {
+			log.ERROR.Print(err)
+		}
+	}
+
+	// Waiting for any tasks being processed to finish
+	b.processingWG.Wait()
+
+	return b.GetRetry(), err
+}
+
+// StopConsuming quits the loop
+func (b *Broker) StopConsuming() {
+	b.Broker.StopConsuming()
+	// Waiting for the delayed tasks goroutine to have stopped
+	b.delayedWG.Wait()
+	// Waiting for consumption to finish
+	b.consumingWG.Wait()
+}
+
+// Close closes the underlying database and releases its file lock
+func (b *Broker) Close() error {
+	return b.db.Close()
+}
+
+// Publish stores a new message in the queue pointed to by the routing key
+func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	// Adjust routing key (this decides which queue the message will be published to)
+	b.Broker.AdjustRoutingKey(signature)
+
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		// Check the ETA signature field, if it is set and it is in the future,
+		// delay the task
+		if signature.ETA != nil && signature.ETA.After(time.Now().UTC()) {
+			bucket, err := tx.CreateBucketIfNotExists(delayedBucket)
+			if err != nil {
+				return err
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			return bucket.Put(delayedKey(*signature.ETA, seq), msg)
+		}
+
+		return enqueue(tx, signature.RoutingKey, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("Bolt publish error: %s", err)
+	}
+
+	b.signal()
+	return nil
+}
+
+// HealthCheck checks the database is open
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// GetPendingTasks returns a slice of task signatures waiting in the queue
+func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	var taskSignatures []*tasks.Signature
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(queueBucket(queue))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			signature, err := b.decodeSignature(v)
+			if err != nil {
+				return err
+			}
+			taskSignatures = append(taskSignatures, signature)
+			return nil
+		})
+	})
+	return taskSignatures, err
+}
+
+// GetDelayedTasks returns a slice of task signatures that are scheduled, but not yet in the queue
+func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
+	var taskSignatures []*tasks.Signature
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(delayedBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(_, v []byte) error {
+			signature, err := b.decodeSignature(v)
+			if err != nil {
+				return err
+			}
+			taskSignatures = append(taskSignatures, signature)
+			return nil
+		})
+	})
+	return taskSignatures, err
+}
+
+// consume takes delivered messages from the channel and manages a worker pool
+// to process tasks concurrently
+func (b *Broker) consume(deliveries <-chan *delivery, queue string, concurrency int, taskProcessor iface.TaskProcessor) error {
+	errorsChan := make(chan error, concurrency*2)
+	pool := make(chan struct{}, concurrency)
+
+	// init pool for Worker tasks execution, as many slots as Worker concurrency param
+	go func() {
+		for i := 0; i < concurrency; i++ {
+			pool <- struct{}{}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-errorsChan:
+			return err
+		case d := <-deliveries:
+			// get execution slot from pool (blocks until one is available)
+			<-pool
+
+			b.processingWG.Add(1)
+
+			// Consume the task inside a goroutine so multiple tasks
+			// can be processed concurrently
+			go func() {
+				if err := b.consumeOne(d, queue, taskProcessor); err != nil {
+					select {
+					case errorsChan <- err:
+					default:
+					}
+				}
+
+				b.processingWG.Done()
+
+				// give slot back to pool
+				pool <- struct{}{}
+			}()
+		case <-b.GetStopChan():
+			return nil
+		}
+	}
+}
+
+// consumeOne processes a single message using TaskProcessor
+func (b *Broker) consumeOne(d *delivery, queue string, taskProcessor iface.TaskProcessor) error {
+	signature, err := b.decodeSignature(d.body)
+	if err != nil {
+		// A malformed message will never be processed, drop it
+		b.done(queue, d.key, nil)
+		return errs.NewErrCouldNotUnmarshalTaskSignature(d.body, err)
+	}
+
+	// If the task is not registered, we requeue it,
+	// there might be different workers for processing specific tasks
+	if !b.IsTaskRegistered(signature.Name) {
+		if signature.IgnoreWhenTaskNotRegistered {
+			return b.done(queue, d.key, nil)
+		}
+		log.INFO.Printf("Task not registered with this worker. Requeuing message: %s", d.body)
+
+		return b.done(queue, d.key, d.body)
+	}
+
+	log.DEBUG.Printf("Received new message: %s", d.body)
+
+	if err := taskProcessor.Process(signature); err != nil {
+		// Leave the message in the processing bucket, it is put back
+		// to the queue the next time the process starts consuming
+		if err == errs.ErrStopTaskDeletion {
+			return nil
+		}
+		return err
+	}
+
+	return b.done(queue, d.key, nil)
+}
+
+// nextTask moves the first message of the queue to the processing bucket,
+// it returns nil if the queue is empty
+func (b *Broker) nextTask(queue string) (d *delivery, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(queueBucket(queue))
+		if bucket == nil {
+			return nil
+		}
+		k, v := bucket.Cursor().First()
+		if k == nil {
+			return nil
+		}
+
+		processing, err := tx.CreateBucketIfNotExists(processingBucket(queue))
+		if err != nil {
+			return err
+		}
+		// Values are only valid for the life of the transaction
+		d = &delivery{key: copyBytes(k), body: copyBytes(v)}
+		if err := processing.Put(d.key, d.body); err != nil {
+			return err
+		}
+		return bucket.Delete(k)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Bolt receive error: %s", err)
+	}
+	return d, nil
+}
+
+// done removes the message from the processing bucket, if requeue is not nil
+// it is appended to the queue again in the same transaction
+func (b *Broker) done(queue string, key, requeue []byte) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		if processing := tx.Bucket(processingBucket(queue)); processing != nil {
+			if err := processing.Delete(key); err != nil {
+				return err
+			}
+		}
+		if requeue == nil {
+			return nil
+		}
+		return enqueue(tx, queue, requeue)
+	})
+	if err != nil {
+		return fmt.Errorf("Bolt delete error: %s", err)
+	}
+	if requeue != nil {
+		b.signal()
+	}
+	return nil
+}
+
+// requeueProcessingOnce moves the messages left in the processing bucket back
+// to the queue the first time the queue is consumed
+func (b *Broker) requeueProcessingOnce(queue string) error {
+	b.requeuedMu.Lock()
+	defer b.requeuedMu.Unlock()
+
+	if b.requeued[queue] {
+		return nil
+	}
+	if err := b.requeueProcessing(queue); err != nil {
+		return err
+	}
+	b.requeued[queue] = true
+	return nil
+}
+
+// requeueProcessing moves all messages left in the processing bucket back to the queue
+func (b *Broker) requeueProcessing(queue string) error {
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		processing := tx.Bucket(processingBucket(queue))
+		if processing == nil {
+			return nil
+		}
+		if err := processing.ForEach(func(_, v []byte) error {
+			return enqueue(tx, queue, v)
+		}); err != nil {
+			return err
+		}
+		return tx.DeleteBucket(processingBucket(queue))
+	})
+	if err != nil {
+		return fmt.Errorf("Bolt requeue error: %s", err)
+	}
+	return nil
+}
+
+// moveDueTasks moves delayed tasks with ETA before now to their queues
+func (b *Broker) moveDueTasks(now time.Time) error {
+	moved := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(delayedBucket)
+		if bucket == nil {
+			return nil
+		}
+
+		// Keys are ordered by ETA so we can stop at the first task not due yet.
+		// Keys are deleted after iterating as deleting moves the cursor.
+		due := itob(uint64(now.UnixNano()))
+		var keys [][]byte
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil && bytes.Compare(k[:8], due) <= 0; k, v = c.Next() {
+			signature, err := b.decodeSignature(v)
+			if err != nil {
+				log.ERROR.Print(errs.NewErrCouldNotUnmarshalTaskSignature(v, err))
+			} else if err := enqueue(tx, signature.RoutingKey, v); err != nil {
+				return err
+			}
+			keys = append(keys, k)
+		}
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		moved = len(keys) > 0
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Bolt delayed tasks error: %s", err)
+	}
+	if moved {
+		b.signal()
+	}
+	return nil
+}
+
+// signal wakes up a consumer waiting for tasks without blocking
+func (b *Broker) signal() {
+	select {
+	case b.notify <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue appends the message to the queue, keys are sequence numbers so
+// messages are consumed in the order they were queued
+func enqueue(tx *bolt.Tx, queue string, msg []byte) error {
+	bucket, err := tx.CreateBucketIfNotExists(queueBucket(queue))
+	if err != nil {
+		return err
+	}
+	seq, err := bucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	return bucket.Put(itob(seq), msg)
+}
+
+func queueBucket(queue string) []byte {
+	return []byte("queue:" + queue)
+}
+
+func processingBucket(queue string) []byte {
+	return []byte("processing:" + queue)
+}
+
+// delayedKey sorts delayed tasks by their ETA, the sequence number keeps
+// keys of tasks with the same ETA unique
+func delayedKey(eta time.Time, seq uint64) []byte {
+	return append(itob(uint64(eta.UnixNano())), itob(seq)...)
+}
+
+// itob returns a big endian representation of v which sorts the same way as v
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func copyBytes(v []byte) []byte {
+	c := make([]byte, len(v))
+	copy(c, v)
+	return c
+}
+
+func (b *Broker) decodeSignature(body []byte) (*tasks.Signature, error) {
+	signature := new(tasks.Signature)
+	if err := b.UnmarshalSignature(body, signature); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+func getQueue(config *config.Config, taskProcessor iface.TaskProcessor) string {
+	customQueue := taskProcessor.CustomQueue()
+	if customQueue == "" {
+		return config.DefaultQueue
+	}
+	return customQueue
+}
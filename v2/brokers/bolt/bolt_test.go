@@ -0,0 +1,208 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+type processor struct {
+	processed chan *tasks.Signature
+}
+
+func (p *processor) Process(signature *tasks.Signature) error {
+	p.processed <- signature
+	return nil
+}
+
+func (p *processor) CustomQueue() string {
+	return ""
+}
+
+func (p *processor) PreConsumeHandler() bool {
+	return true
+}
+
+func newTestBroker(t *testing.T) *Broker {
+	broker, err := New(&config.Config{DefaultQueue: "machinery_tasks"}, filepath.Join(t.TempDir(), "machinery.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { broker.(*Broker).Close() })
+	return broker.(*Broker)
+}
+
+func TestPublishAndGetTasks(t *testing.T) {
+	t.Parallel()
+
+	broker := newTestBroker(t)
+
+	eta := time.Now().UTC().Add(time.Hour)
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "1", Name: "add"}))
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "2", Name: "add"}))
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "3", Name: "add", ETA: &eta}))
+
+	pending, err := broker.GetPendingTasks("")
+	require.NoError(t, err)
+	if assert.Len(t, pending, 2) {
+		assert.Equal(t, "1", pending[0].UUID)
+		assert.Equal(t, "2", pending[1].UUID)
+	}
+
+	delayed, err := broker.GetDelayedTasks()
+	require.NoError(t, err)
+	if assert.Len(t, delayed, 1) {
+		assert.Equal(t, "3", delayed[0].UUID)
+	}
+
+	// Moving due tasks before the ETA leaves the task delayed
+	require.NoError(t, broker.moveDueTasks(time.Now().UTC()))
+	pending, err = broker.GetPendingTasks("machinery_tasks")
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	require.NoError(t, broker.moveDueTasks(eta.Add(time.Second)))
+	pending, err = broker.GetPendingTasks("machinery_tasks")
+	require.NoError(t, err)
+	if assert.Len(t, pending, 3) {
+		assert.Equal(t, "3", pending[2].UUID)
+	}
+	delayed, err = broker.GetDelayedTasks()
+	require.NoError(t, err)
+	assert.Empty(t, delayed)
+}
+
+func TestRequeueProcessing(t *testing.T) {
+	t.Parallel()
+
+	broker := newTestBroker(t)
+
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "1", Name: "add"}))
+
+	d, err := broker.nextTask("machinery_tasks")
+	require.NoError(t, err)
+	require.NotNil(t, d)
+
+	pending, err := broker.GetPendingTasks("machinery_tasks")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// The worker died while processing the task
+	require.NoError(t, broker.requeueProcessing("machinery_tasks"))
+
+	pending, err = broker.GetPendingTasks("machinery_tasks")
+	require.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "1", pending[0].UUID)
+	}
+}
+
+func TestStartConsuming(t *testing.T) {
+	t.Parallel()
+
+	broker := newTestBroker(t)
+	broker.SetRegisteredTaskNames([]string{"add"})
+
+	p := &processor{processed: make(chan *tasks.Signature, 1)}
+	go broker.StartConsuming("", 1, p)
+
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "1", Name: "add"}))
+
+	select {
+	case signature := <-p.processed:
+		assert.Equal(t, "1", signature.UUID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not processed")
+	}
+
+	broker.StopConsuming()
+
+	pending, err := broker.GetPendingTasks("machinery_tasks")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+// failingProcessor fails to process the "fail" task, which stops consumption,
+// while the "slow" task runs until it is released
+type failingProcessor struct {
+	started chan struct{}
+	release chan struct{}
+	slow    int32
+}
+
+func (p *failingProcessor) Process(signature *tasks.Signature) error {
+	if signature.Name == "fail" {
+		<-p.started
+		return errors.New("connection lost")
+	}
+	atomic.AddInt32(&p.slow, 1)
+	close(p.started)
+	<-p.release
+	return nil
+}
+
+func (p *failingProcessor) CustomQueue() string {
+	return ""
+}
+
+func (p *failingProcessor) PreConsumeHandler() bool {
+	return true
+}
+
+func TestStartConsumingAgainAfterError(t *testing.T) {
+	t.Parallel()
+
+	broker := newTestBroker(t)
+	broker.SetRegisteredTaskNames([]string{"slow", "fail"})
+
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "1", Name: "slow"}))
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "2", Name: "fail"}))
+
+	p := &failingProcessor{started: make(chan struct{}), release: make(chan struct{})}
+	returned := make(chan error, 1)
+	go func() {
+		_, err := broker.StartConsuming("", 2, p)
+		returned <- err
+	}()
+
+	// Consumption only ends once the running task finished
+	<-p.started
+	select {
+	case <-returned:
+		t.Fatal("consumption ended while a task was running")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(p.release)
+	select {
+	case err := <-returned:
+		assert.EqualError(t, err, "connection lost")
+	case <-time.After(5 * time.Second):
+		t.Fatal("consumption did not end")
+	}
+
+	// Starting to consume again does not put the finished task back
+	broker.SetRegisteredTaskNames([]string{"slow", "add"})
+	again := &processor{processed: make(chan *tasks.Signature, 2)}
+	go broker.StartConsuming("", 2, again)
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{UUID: "3", Name: "add"}))
+	select {
+	case signature := <-again.processed:
+		assert.Equal(t, "3", signature.UUID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not processed")
+	}
+	broker.StopConsuming()
+
+	assert.Empty(t, again.processed)
+	pending, err := broker.GetPendingTasks("machinery_tasks")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&p.slow))
+}
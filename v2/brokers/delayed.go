@@ -0,0 +1,131 @@
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const (
+	// delayedTasksPollPeriod is how often consuming workers publish the due
+	// tasks of the store to the broker
+	delayedTasksPollPeriod = 500 * time.Millisecond
+	// delayedTasksBatchSize is how many due tasks are published at once
+	delayedTasksBatchSize = 100
+)
+
+// delayedTaskBroker keeps tasks with an ETA in the future in a store
+type delayedTaskBroker struct {
+	*middlewareBroker
+	store delayedtasks.Store
+}
+
+// WithDelayedTaskStore wraps the broker so tasks published with an ETA in the
+// future are kept in the store, consuming workers publish them to the broker
+// once they are due. It gives brokers which cannot delay tasks, or only for a
+// limited time, the ETA behavior of the store, e.g. persisted in Redis.
+// Broadcast tasks are not delayed.
+func WithDelayedTaskStore(broker iface.Broker, store delayedtasks.Store) iface.Broker {
+	return &delayedTaskBroker{
+		middlewareBroker: &middlewareBroker{Broker: broker, publish: broker.Publish},
+		store:            store,
+	}
+}
+
+// Publish keeps the task in the store when its ETA is in the future, or
+// places it on the broker
+func (b *delayedTaskBroker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	if signature.ETA == nil || !signature.ETA.After(time.Now().UTC()) {
+		return b.Broker.Publish(ctx, signature)
+	}
+
+	msg, err := json.Marshal(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+	return b.store.Add(*signature.ETA, msg)
+}
+
+// PublishBatch keeps the tasks whose ETA is in the future in the store and
+// places the others on the broker
+func (b *delayedTaskBroker) PublishBatch(ctx context.Context, signatures []*tasks.Signature) error {
+	now := time.Now().UTC()
+	due := make([]*tasks.Signature, 0, len(signatures))
+	for _, signature := range signatures {
+		if signature.ETA == nil || !signature.ETA.After(now) {
+			due = append(due, signature)
+			continue
+		}
+		if err := b.Publish(ctx, signature); err != nil {
+			return err
+		}
+	}
+
+	if len(due) == 0 {
+		return nil
+	}
+	return b.middlewareBroker.PublishBatch(ctx, due)
+}
+
+// GetDelayedTasks returns the task signatures kept in the store
+func (b *delayedTaskBroker) GetDelayedTasks() ([]*tasks.Signature, error) {
+	msgs, err := b.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	signatures := make([]*tasks.Signature, len(msgs))
+	for i, msg := range msgs {
+		signature := new(tasks.Signature)
+		if err := json.Unmarshal(msg, signature); err != nil {
+			return nil, err
+		}
+		signatures[i] = signature
+	}
+	return signatures, nil
+}
+
+// StartConsuming consumes from the broker and publishes the due tasks of the
+// store to it until consumption ends
+func (b *delayedTaskBroker) StartConsuming(consumerTag string, concurrency int, p iface.TaskProcessor) (bool, error) {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		ticker := time.NewTicker(delayedTasksPollPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := b.publishDueTasks(); err != nil {
+					log.ERROR.Printf("Failed to publish delayed tasks: %s", err)
+				}
+			}
+		}
+	}()
+
+	return b.middlewareBroker.StartConsuming(consumerTag, concurrency, p)
+}
+
+// publishDueTasks publishes the tasks of the store which are due to the broker
+func (b *delayedTaskBroker) publishDueTasks() error {
+	_, err := delayedtasks.Forward(b.store, time.Now().UTC(), delayedTasksBatchSize, func(msg []byte) error {
+		signature := new(tasks.Signature)
+		if err := json.Unmarshal(msg, signature); err != nil {
+			// Such a task could never be published, it is dropped
+			log.ERROR.Printf("Failed to decode delayed task %s: %s", msg, err)
+			return nil
+		}
+		return b.Broker.Publish(context.Background(), signature)
+	})
+	return err
+}
@@ -0,0 +1,89 @@
+package brokers_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/brokers"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/brokers/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	delayedmemory "github.com/RichardKnop/machinery/v2/delayedtasks/memory"
+)
+
+func TestWithDelayedTaskStore(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	inner := memory.New(cnf)
+	broker := brokers.WithDelayedTaskStore(inner, delayedmemory.New())
+	broker.SetRegisteredTaskNames([]string{"foo", "bar"})
+
+	eta := time.Now().UTC().Add(time.Second)
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{Name: "foo", ETA: &eta}))
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{Name: "bar"}))
+
+	delayed, err := broker.GetDelayedTasks()
+	require.NoError(t, err)
+	if assert.Len(t, delayed, 1) {
+		assert.Equal(t, "foo", delayed[0].Name)
+	}
+	innerDelayed, err := inner.GetDelayedTasks()
+	require.NoError(t, err)
+	assert.Empty(t, innerDelayed)
+
+	p := &processor{processed: make(chan *tasks.Signature, 2)}
+	go broker.StartConsuming("test", 1, p)
+	defer broker.StopConsuming()
+
+	for _, name := range []string{"bar", "foo"} {
+		select {
+		case signature := <-p.processed:
+			assert.Equal(t, name, signature.Name)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("task %s was not consumed", name)
+		}
+	}
+	assert.False(t, time.Now().UTC().Before(eta))
+
+	delayed, err = broker.GetDelayedTasks()
+	require.NoError(t, err)
+	assert.Empty(t, delayed)
+}
+
+func TestWithDelayedTaskStorePublishBatch(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	inner := &batchBroker{Broker: memory.New(cnf)}
+	broker := brokers.WithDelayedTaskStore(inner, delayedmemory.New())
+
+	eta := time.Now().UTC().Add(time.Minute)
+	signatures := []*tasks.Signature{{Name: "foo", ETA: &eta}, {Name: "bar"}}
+	require.NoError(t, broker.(iface.BatchPublisher).PublishBatch(context.Background(), signatures))
+
+	delayed, err := broker.GetDelayedTasks()
+	require.NoError(t, err)
+	if assert.Len(t, delayed, 1) {
+		assert.Equal(t, "foo", delayed[0].Name)
+	}
+	assert.Equal(t, [][]string{{"bar"}}, inner.batches)
+}
+
+func TestWithDelayedTaskStoreCustomPrefetch(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	inner := &prefetchBroker{Broker: memory.New(cnf)}
+	broker := brokers.WithDelayedTaskStore(inner, delayedmemory.New())
+
+	_, err := broker.StartConsuming("test", 1, new(prefetchProcessor))
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.prefetch)
+}
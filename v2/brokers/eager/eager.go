@@ -1,9 +1,7 @@
 package eager
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 
@@ -44,24 +42,27 @@ func (eagerBroker *Broker) Publish(ctx context.Context, task *tasks.Signature) e
 		return errors.New("worker is not assigned in eager-mode")
 	}
 
-	// faking the behavior to marshal input into json
+	// faking the behavior to marshal input with the configured codec
 	// and unmarshal it back
-	message, err := json.Marshal(task)
+	message, err := eagerBroker.MarshalSignature(task)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal signature error: %s", err)
 	}
 
 	signature := new(tasks.Signature)
-	decoder := json.NewDecoder(bytes.NewReader(message))
-	decoder.UseNumber()
-	if err := decoder.Decode(signature); err != nil {
-		return fmt.Errorf("JSON unmarshal error: %s", err)
+	if err := eagerBroker.UnmarshalSignature(message, signature); err != nil {
+		return fmt.Errorf("Unmarshal signature error: %s", err)
 	}
 
 	// blocking call to the task directly
 	return eagerBroker.worker.Process(signature)
 }
 
+// PublishBroadcast processes the task by the only worker of the eager broker
+func (eagerBroker *Broker) PublishBroadcast(ctx context.Context, task *tasks.Signature) error {
+	return eagerBroker.Publish(ctx, task)
+}
+
 // AssignWorker assigns a worker to the eager broker
 func (eagerBroker *Broker) AssignWorker(w iface.TaskProcessor) {
 	eagerBroker.worker = w
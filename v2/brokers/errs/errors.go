@@ -26,3 +26,12 @@ var ErrConsumerStopped = errors.New("the server has been stopped")
 
 // ErrStopTaskDeletion indicates that the task should not be deleted from source after task failure
 var ErrStopTaskDeletion = errors.New("task should not be deleted")
+
+// ErrBroadcastNotSupported is returned when broadcasting a task with a broker which cannot publish a task to every worker
+var ErrBroadcastNotSupported = errors.New("broker does not support broadcasting tasks")
+
+// ErrTakePendingTasksNotSupported is returned when taking tasks off a queue with a broker which cannot remove pending tasks
+var ErrTakePendingTasksNotSupported = errors.New("broker does not support taking pending tasks")
+
+// ErrQueueManagementNotSupported is returned when purging or moving the tasks of a queue with a broker which cannot
+var ErrQueueManagementNotSupported = errors.New("broker does not support purging queues and moving messages")
@@ -0,0 +1,266 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	healthCheckTimeout         = 5 * time.Second
+)
+
+// ErrNoBrokers is returned when publishing without any broker to fail over to
+var ErrNoBrokers = errors.New("No brokers configured")
+
+// Broker wraps several brokers ordered by priority. Tasks are published to
+// the first broker available, a broker failing to publish is skipped until
+// the health check interval has passed and its health check succeeds, so
+// publishing falls back to the primary as soon as it is reachable again.
+// Workers consume from all brokers so tasks published during an outage are
+// processed too.
+type Broker struct {
+	common.Broker
+	brokers     []iface.Broker
+	failedAt    []time.Time // zero when the broker is considered healthy
+	active      int
+	mu          sync.Mutex
+	consumingWG sync.WaitGroup // wait group to make sure whole consumption completes
+}
+
+// New creates new Broker instance, the first broker is the primary one and
+// the others are used in the given order when the previous ones fail
+func New(cnf *config.Config, brokers ...iface.Broker) iface.Broker {
+	return &Broker{
+		Broker:   common.NewBroker(cnf),
+		brokers:  brokers,
+		failedAt: make([]time.Time, len(brokers)),
+	}
+}
+
+// SetRegisteredTaskNames sets registered task names on all brokers
+func (b *Broker) SetRegisteredTaskNames(names []string) {
+	b.Broker.SetRegisteredTaskNames(names)
+	for _, broker := range b.brokers {
+		broker.SetRegisteredTaskNames(names)
+	}
+}
+
+// StartConsuming consumes from all brokers until StopConsuming is called,
+// each broker is restarted on its own when its consumption fails
+func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) (bool, error) {
+	b.consumingWG.Add(1)
+	defer b.consumingWG.Done()
+
+	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
+
+	var wg sync.WaitGroup
+	for i, broker := range b.brokers {
+		wg.Add(1)
+		go func(i int, broker iface.Broker) {
+			defer wg.Done()
+
+			for {
+				retry, err := broker.StartConsuming(consumerTag, concurrency, taskProcessor)
+				if !retry {
+					return
+				}
+				log.WARNING.Printf("Broker %d failed with error: %s", i, err)
+				b.markFailed(i)
+
+				select {
+				case <-b.GetStopChan():
+					return
+				default:
+				}
+			}
+		}(i, broker)
+	}
+	wg.Wait()
+
+	return b.GetRetry(), nil
+}
+
+// StopConsuming quits consuming from all brokers
+func (b *Broker) StopConsuming() {
+	b.Broker.StopConsuming()
+	for _, broker := range b.brokers {
+		broker.StopConsuming()
+	}
+	// Waiting for consumption to finish
+	b.consumingWG.Wait()
+}
+
+// Publish places a new message on the first available broker
+func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	if len(b.brokers) == 0 {
+		return ErrNoBrokers
+	}
+
+	candidates := b.candidates(ctx)
+
+	var err error
+	for _, i := range candidates {
+		if err = b.brokers[i].Publish(ctx, signature); err != nil {
+			log.WARNING.Printf("Failed to publish task %s to broker %d: %s", signature.UUID, i, err)
+			b.markFailed(i)
+			continue
+		}
+
+		b.setActive(i)
+		return nil
+	}
+
+	return err
+}
+
+// PublishBroadcast publishes a task to every worker through the first
+// available broker which can broadcast tasks, workers consume from all brokers
+// so each of them receives it
+func (b *Broker) PublishBroadcast(ctx context.Context, signature *tasks.Signature) error {
+	err := errs.ErrBroadcastNotSupported
+	for _, i := range b.candidates(ctx) {
+		broadcaster, ok := b.brokers[i].(iface.Broadcaster)
+		if !ok {
+			continue
+		}
+		if err = broadcaster.PublishBroadcast(ctx, signature); err != nil {
+			log.WARNING.Printf("Failed to broadcast task %s with broker %d: %s", signature.UUID, i, err)
+			b.markFailed(i)
+			continue
+		}
+		return nil
+	}
+	return err
+}
+
+// HealthCheck returns nil when at least one of the brokers is healthy, so
+// tasks can still be published
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	if len(b.brokers) == 0 {
+		return ErrNoBrokers
+	}
+
+	var err error
+	for _, broker := range b.brokers {
+		if err = broker.HealthCheck(ctx); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("No healthy broker, last error: %s", err)
+}
+
+// GetPendingTasks returns a slice of task signatures waiting in the queue of
+// the broker tasks are currently published to
+func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
+	if len(b.brokers) == 0 {
+		return nil, ErrNoBrokers
+	}
+	return b.activeBroker().GetPendingTasks(queue)
+}
+
+// GetDelayedTasks returns a slice of task signatures that are scheduled, but
+// not yet in the queue of the broker tasks are currently published to
+func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
+	if len(b.brokers) == 0 {
+		return nil, ErrNoBrokers
+	}
+	return b.activeBroker().GetDelayedTasks()
+}
+
+// AdjustRoutingKey makes sure the routing key is correct for the broker
+// tasks are currently published to
+func (b *Broker) AdjustRoutingKey(s *tasks.Signature) {
+	if len(b.brokers) == 0 {
+		b.Broker.AdjustRoutingKey(s)
+		return
+	}
+	b.activeBroker().AdjustRoutingKey(s)
+}
+
+// candidates returns indexes of the brokers to try publishing to in priority
+// order. Brokers which failed recently are left out unless none is left.
+func (b *Broker) candidates(ctx context.Context) []int {
+	available := make([]int, 0, len(b.brokers))
+	failed := make([]int, 0, len(b.brokers))
+	for i := range b.brokers {
+		if b.available(ctx, i) {
+			available = append(available, i)
+		} else {
+			failed = append(failed, i)
+		}
+	}
+	return append(available, failed...)
+}
+
+// available returns true unless the broker failed within the health check
+// interval or its health check still fails
+func (b *Broker) available(ctx context.Context, i int) bool {
+	b.mu.Lock()
+	failedAt := b.failedAt[i]
+	b.mu.Unlock()
+
+	if failedAt.IsZero() {
+		return true
+	}
+	if time.Since(failedAt) < b.healthCheckInterval() {
+		return false
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	if err := b.brokers[i].HealthCheck(checkCtx); err != nil {
+		log.WARNING.Printf("Broker %d is still unhealthy: %s", i, err)
+		b.markFailed(i)
+		return false
+	}
+
+	b.mu.Lock()
+	b.failedAt[i] = time.Time{}
+	b.mu.Unlock()
+	return true
+}
+
+func (b *Broker) markFailed(i int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failedAt[i] = time.Now()
+}
+
+func (b *Broker) setActive(i int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.active != i {
+		log.WARNING.Printf("Switching from broker %d to broker %d", b.active, i)
+		b.active = i
+	}
+	b.failedAt[i] = time.Time{}
+}
+
+func (b *Broker) activeBroker() iface.Broker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.brokers[b.active]
+}
+
+// healthCheckInterval returns how long a failed broker is skipped
+func (b *Broker) healthCheckInterval() time.Duration {
+	if b.GetConfig().BrokerHealthCheckInterval > 0 {
+		return time.Duration(b.GetConfig().BrokerHealthCheckInterval) * time.Second
+	}
+	return defaultHealthCheckInterval
+}
@@ -0,0 +1,204 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/brokers/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// flakyBroker fails to publish and its health check fails while down is set
+type flakyBroker struct {
+	iface.Broker
+	mu         sync.Mutex
+	down       bool
+	broadcasts int
+}
+
+func (b *flakyBroker) setDown(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+}
+
+func (b *flakyBroker) HealthCheck(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.down {
+		return errors.New("broker is down")
+	}
+	return nil
+}
+
+func (b *flakyBroker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	if err := b.HealthCheck(ctx); err != nil {
+		return err
+	}
+	return b.Broker.Publish(ctx, signature)
+}
+
+func (b *flakyBroker) PublishBroadcast(ctx context.Context, signature *tasks.Signature) error {
+	if err := b.HealthCheck(ctx); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.broadcasts++
+	return nil
+}
+
+type processor struct {
+	processed chan *tasks.Signature
+}
+
+func (p *processor) Process(signature *tasks.Signature) error {
+	p.processed <- signature
+	return nil
+}
+func (p *processor) CustomQueue() string     { return "" }
+func (p *processor) PreConsumeHandler() bool { return true }
+
+func newTestBroker() (*Broker, *flakyBroker, *flakyBroker) {
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	primary := &flakyBroker{Broker: memory.New(cnf)}
+	secondary := &flakyBroker{Broker: memory.New(cnf)}
+	return New(cnf, primary, secondary).(*Broker), primary, secondary
+}
+
+func pending(t *testing.T, b iface.Broker) int {
+	signatures, err := b.GetPendingTasks("")
+	require.NoError(t, err)
+	return len(signatures)
+}
+
+func TestPublishFailover(t *testing.T) {
+	t.Parallel()
+
+	broker, primary, secondary := newTestBroker()
+	ctx := context.Background()
+
+	require.NoError(t, broker.Publish(ctx, &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, 1, pending(t, primary))
+
+	// The primary is down, tasks go to the secondary
+	primary.setDown(true)
+	require.NoError(t, broker.Publish(ctx, &tasks.Signature{Name: "foo"}))
+	require.NoError(t, broker.Publish(ctx, &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, 1, pending(t, primary))
+	assert.Equal(t, 2, pending(t, secondary))
+	assert.Equal(t, secondary, broker.activeBroker())
+
+	// Once the interval passed the primary is health checked again
+	primary.setDown(false)
+	broker.failedAt[0] = time.Now().Add(-time.Hour)
+	require.NoError(t, broker.Publish(ctx, &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, 2, pending(t, primary))
+	assert.Equal(t, primary, broker.activeBroker())
+
+	// All brokers are down
+	primary.setDown(true)
+	secondary.setDown(true)
+	assert.Error(t, broker.Publish(ctx, &tasks.Signature{Name: "foo"}))
+}
+
+func TestPublishSkipsUnhealthyBroker(t *testing.T) {
+	t.Parallel()
+
+	broker, primary, secondary := newTestBroker()
+	ctx := context.Background()
+
+	primary.setDown(true)
+	require.NoError(t, broker.Publish(ctx, &tasks.Signature{Name: "foo"}))
+
+	// The health check still fails after the interval
+	broker.failedAt[0] = time.Now().Add(-time.Hour)
+	require.NoError(t, broker.Publish(ctx, &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, 2, pending(t, secondary))
+	assert.False(t, broker.available(ctx, 0))
+}
+
+func TestPublishBroadcast(t *testing.T) {
+	t.Parallel()
+
+	broker, primary, secondary := newTestBroker()
+	ctx := context.Background()
+
+	require.NoError(t, broker.PublishBroadcast(ctx, &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, 1, primary.broadcasts)
+
+	primary.setDown(true)
+	require.NoError(t, broker.PublishBroadcast(ctx, &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, 1, primary.broadcasts)
+	assert.Equal(t, 1, secondary.broadcasts)
+
+	// Brokers which cannot broadcast tasks are skipped
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	unsupported := struct{ iface.Broker }{memory.New(cnf)}
+	broker = New(cnf, unsupported, secondary).(*Broker)
+	require.NoError(t, broker.PublishBroadcast(ctx, &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, 2, secondary.broadcasts)
+
+	broker = New(cnf, unsupported).(*Broker)
+	assert.Equal(t, errs.ErrBroadcastNotSupported, broker.PublishBroadcast(ctx, &tasks.Signature{Name: "foo"}))
+}
+
+func TestConsumeFromAllBrokers(t *testing.T) {
+	t.Parallel()
+
+	broker, primary, secondary := newTestBroker()
+	broker.SetRegisteredTaskNames([]string{"foo"})
+	ctx := context.Background()
+
+	require.NoError(t, primary.Publish(ctx, &tasks.Signature{UUID: "1", Name: "foo"}))
+	require.NoError(t, secondary.Publish(ctx, &tasks.Signature{UUID: "2", Name: "foo"}))
+
+	p := &processor{processed: make(chan *tasks.Signature, 2)}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		retry, err := broker.StartConsuming("test", 1, p)
+		assert.False(t, retry)
+		assert.NoError(t, err)
+	}()
+
+	uuids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case s := <-p.processed:
+			uuids[s.UUID] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("task was not consumed")
+		}
+	}
+	assert.Equal(t, map[string]bool{"1": true, "2": true}, uuids)
+
+	broker.StopConsuming()
+	<-done
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	broker, primary, secondary := newTestBroker()
+	ctx := context.Background()
+
+	assert.NoError(t, broker.HealthCheck(ctx))
+
+	primary.setDown(true)
+	assert.NoError(t, broker.HealthCheck(ctx))
+
+	secondary.setDown(true)
+	assert.EqualError(t, broker.HealthCheck(ctx), "No healthy broker, last error: broker is down")
+
+	assert.Equal(t, ErrNoBrokers, New(&config.Config{}).HealthCheck(ctx))
+}
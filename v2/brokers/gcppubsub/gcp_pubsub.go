@@ -1,9 +1,7 @@
 package gcppubsub
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -12,6 +10,7 @@ import (
 	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/serialization"
 	"github.com/RichardKnop/machinery/v2/tasks"
 )
 
@@ -22,6 +21,13 @@ type Broker struct {
 	service          *pubsub.Client
 	subscriptionName string
 	MaxExtension     time.Duration
+	EnableOrdering   bool
+
+	// ExactlyOnce waits for acknowledgements to be confirmed, MinExtensionPeriod
+	// and MaxExtensionPeriod bound each extension of the ack deadline
+	ExactlyOnce        bool
+	MinExtensionPeriod time.Duration
+	MaxExtensionPeriod time.Duration
 
 	stopDone chan struct{}
 }
@@ -35,6 +41,10 @@ func New(cnf *config.Config, projectID, subscriptionName string) (iface.Broker,
 
 	if cnf.GCPPubSub != nil {
 		b.MaxExtension = cnf.GCPPubSub.MaxExtension
+		b.EnableOrdering = cnf.GCPPubSub.EnableOrdering
+		b.ExactlyOnce = cnf.GCPPubSub.ExactlyOnce
+		b.MinExtensionPeriod = cnf.GCPPubSub.MinExtensionPeriod
+		b.MaxExtensionPeriod = cnf.GCPPubSub.MaxExtensionPeriod
 	}
 
 	if cnf.GCPPubSub != nil && cnf.GCPPubSub.Client != nil {
@@ -46,7 +56,12 @@ func New(cnf *config.Config, projectID, subscriptionName string) (iface.Broker,
 		}
 		b.service = pubsubClient
 		cnf.GCPPubSub = &config.GCPPubSubConfig{
-			Client: pubsubClient,
+			Client:             pubsubClient,
+			MaxExtension:       b.MaxExtension,
+			EnableOrdering:     b.EnableOrdering,
+			ExactlyOnce:        b.ExactlyOnce,
+			MinExtensionPeriod: b.MinExtensionPeriod,
+			MaxExtensionPeriod: b.MaxExtensionPeriod,
 		}
 	}
 
@@ -65,10 +80,7 @@ func New(cnf *config.Config, projectID, subscriptionName string) (iface.Broker,
 
 	// Validate subscription exists
 	sub := b.service.Subscription(b.subscriptionName)
-
-	if b.MaxExtension != 0 {
-		sub.ReceiveSettings.MaxExtension = b.MaxExtension
-	}
+	b.applyReceiveSettings(sub)
 
 	subscriptionExists, err := sub.Exists(ctx)
 	if err != nil {
@@ -78,6 +90,16 @@ func New(cnf *config.Config, projectID, subscriptionName string) (iface.Broker,
 		return nil, fmt.Errorf("subscription does not exist, instead got %s", b.subscriptionName)
 	}
 
+	if b.ExactlyOnce {
+		subConfig, err := sub.Config(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !subConfig.EnableExactlyOnceDelivery {
+			log.WARNING.Printf("Exactly-once delivery is not enabled on subscription %s", b.subscriptionName)
+		}
+	}
+
 	return b, nil
 }
 
@@ -86,10 +108,7 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
 
 	sub := b.service.Subscription(b.subscriptionName)
-
-	if b.MaxExtension != 0 {
-		sub.ReceiveSettings.MaxExtension = b.MaxExtension
-	}
+	b.applyReceiveSettings(sub)
 
 	sub.ReceiveSettings.NumGoroutines = concurrency
 	log.INFO.Print("[*] Waiting for messages. To exit press CTRL+C")
@@ -102,7 +121,7 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 
 	for {
 		err := sub.Receive(ctx, func(_ctx context.Context, msg *pubsub.Message) {
-			b.consumeOne(msg, taskProcessor)
+			b.consumeOne(_ctx, msg, taskProcessor)
 		})
 		if err == nil {
 			break
@@ -125,15 +144,27 @@ func (b *Broker) StopConsuming() {
 	<-b.stopDone
 }
 
+// HealthCheck checks the subscription can be read
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	exists, err := b.service.Subscription(b.subscriptionName).Exists(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("Subscription %s does not exist", b.subscriptionName)
+	}
+	return nil
+}
+
 // Publish places a new message on the default queue or the queue pointed to
 // by the routing key
 func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
 	// Adjust routing key (this decides which queue the message will be published to)
 	b.AdjustRoutingKey(signature)
 
-	msg, err := json.Marshal(signature)
+	msg, err := b.MarshalSignature(signature)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal signature error: %s", err)
 	}
 
 	topic := b.service.Topic(signature.RoutingKey)
@@ -149,13 +180,27 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 		}
 	}
 
-	result := topic.Publish(ctx, &pubsub.Message{
-		Data: msg,
-	})
+	message := &pubsub.Message{
+		Data:       msg,
+		Attributes: map[string]string{serialization.ContentTypeHeader: b.ContentType()},
+	}
+
+	// Messages sharing an ordering key are delivered in the order they were published
+	// to subscriptions with message ordering enabled
+	if b.EnableOrdering {
+		topic.EnableMessageOrdering = true
+		message.OrderingKey = signature.RoutingKey
+	}
+
+	result := topic.Publish(ctx, message)
 
 	id, err := result.Get(ctx)
 	if err != nil {
 		log.ERROR.Printf("Error when sending a message: %v", err)
+		if message.OrderingKey != "" {
+			// Publishing of the ordering key is paused after an error
+			topic.ResumePublish(message.OrderingKey)
+		}
 		return err
 	}
 
@@ -164,33 +209,77 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 }
 
 // consumeOne processes a single message using TaskProcessor
-func (b *Broker) consumeOne(delivery *pubsub.Message, taskProcessor iface.TaskProcessor) {
+func (b *Broker) consumeOne(ctx context.Context, delivery *pubsub.Message, taskProcessor iface.TaskProcessor) {
 	if len(delivery.Data) == 0 {
-		delivery.Nack()
+		b.nack(ctx, delivery)
 		log.ERROR.Printf("received an empty message, the delivery was %v", delivery)
+		return
 	}
 
 	sig := new(tasks.Signature)
-	decoder := json.NewDecoder(bytes.NewBuffer(delivery.Data))
-	decoder.UseNumber()
-	if err := decoder.Decode(sig); err != nil {
-		delivery.Nack()
+	if err := b.UnmarshalSignatureWithContentType(delivery.Data, delivery.Attributes[serialization.ContentTypeHeader], sig); err != nil {
+		b.nack(ctx, delivery)
 		log.ERROR.Printf("unmarshal error. the delivery is %v", delivery)
+		return
 	}
 
 	// If the task is not registered return an error
 	// and leave the message in the queue
 	if !b.IsTaskRegistered(sig.Name) {
-		delivery.Nack()
+		b.nack(ctx, delivery)
 		log.ERROR.Printf("task %s is not registered", sig.Name)
+		return
 	}
 
+	// The ack deadline is extended by the client while the task is processed
 	err := taskProcessor.Process(sig)
 	if err != nil {
-		delivery.Nack()
-		log.ERROR.Printf("Failed process of task", err)
+		b.nack(ctx, delivery)
+		log.ERROR.Printf("Failed process of task: %v", err)
+		return
 	}
 
 	// Call Ack() after successfully consuming and processing the message
-	delivery.Ack()
+	b.ack(ctx, delivery)
+}
+
+// ack acknowledges the message, with exactly-once delivery it waits for the
+// acknowledgement to be confirmed, a message whose ack failed is redelivered
+func (b *Broker) ack(ctx context.Context, delivery *pubsub.Message) {
+	if !b.ExactlyOnce {
+		delivery.Ack()
+		return
+	}
+
+	status, err := delivery.AckWithResult().Get(ctx)
+	if err != nil {
+		log.ERROR.Printf("Failed to acknowledge message %s, status %d: %v", delivery.ID, status, err)
+	}
+}
+
+// nack negatively acknowledges the message so it is redelivered
+func (b *Broker) nack(ctx context.Context, delivery *pubsub.Message) {
+	if !b.ExactlyOnce {
+		delivery.Nack()
+		return
+	}
+
+	status, err := delivery.NackWithResult().Get(ctx)
+	if err != nil {
+		log.ERROR.Printf("Failed to negatively acknowledge message %s, status %d: %v", delivery.ID, status, err)
+	}
+}
+
+// applyReceiveSettings sets how long and by how much the ack deadline of
+// received messages is extended
+func (b *Broker) applyReceiveSettings(sub *pubsub.Subscription) {
+	if b.MaxExtension != 0 {
+		sub.ReceiveSettings.MaxExtension = b.MaxExtension
+	}
+	if b.MinExtensionPeriod != 0 {
+		sub.ReceiveSettings.MinExtensionPeriod = b.MinExtensionPeriod
+	}
+	if b.MaxExtensionPeriod != 0 {
+		sub.ReceiveSettings.MaxExtensionPeriod = b.MaxExtensionPeriod
+	}
 }
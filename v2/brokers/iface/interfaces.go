@@ -18,6 +18,38 @@ type Broker interface {
 	GetPendingTasks(queue string) ([]*tasks.Signature, error)
 	GetDelayedTasks() ([]*tasks.Signature, error)
 	AdjustRoutingKey(s *tasks.Signature)
+	HealthCheck(ctx context.Context) error
+}
+
+// BatchPublisher - implemented by brokers which can publish several tasks
+// with a single request, used when sending groups
+type BatchPublisher interface {
+	PublishBatch(ctx context.Context, signatures []*tasks.Signature) error
+}
+
+// Broadcaster - implemented by brokers which can publish a task to every
+// worker consuming from them, each worker processes its own copy. Only workers
+// consuming, or registered, when the task is published receive it.
+type Broadcaster interface {
+	PublishBroadcast(ctx context.Context, signature *tasks.Signature) error
+}
+
+// PendingTaskTaker - implemented by brokers which can take pending tasks off
+// a queue, used to requeue tasks from dead letter queues
+type PendingTaskTaker interface {
+	TakePendingTasks(queue string, filter func(*tasks.Signature) bool) ([]*tasks.Signature, error)
+}
+
+// QueueManager - implemented by brokers which can drop or move the pending
+// tasks of a queue, used to clean up backlogs and drain dead letter queues
+type QueueManager interface {
+	// PurgeQueue drops the pending tasks of the queue and returns how many
+	// were dropped
+	PurgeQueue(queue string) (int, error)
+	// MoveMessages moves up to limit pending tasks, all of them when limit
+	// is not positive, from a queue to another and returns how many were
+	// moved, the routing key of the moved tasks is the queue they were moved to
+	MoveMessages(from, to string, limit int) (int, error)
 }
 
 // TaskProcessor - can process a delivered task
@@ -27,3 +59,9 @@ type TaskProcessor interface {
 	CustomQueue() string
 	PreConsumeHandler() bool
 }
+
+// CustomPrefetcher - implemented by task processors limiting how many messages
+// are fetched ahead of processing, separately from the concurrency
+type CustomPrefetcher interface {
+	CustomPrefetch() int
+}
@@ -0,0 +1,425 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/serialization"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const defaultConsumerGroup = "machinery"
+
+// Message key strategies deciding which partition of the topic a task goes to
+const (
+	// MessageKeyRoutingKey keys messages by the routing key of the task, so
+	// tasks of a routing key keep their order on a single partition, which
+	// only a single worker of the consumer group consumes from
+	MessageKeyRoutingKey = "routing_key"
+	// MessageKeyGroup keys messages by BrokerMessageGroupId, or the task UUID
+	// when it is not set, so tasks of a group keep their order
+	MessageKeyGroup = "message_group"
+	// MessageKeyUUID keys messages by the task UUID, spreading tasks evenly
+	// between the partitions, the default
+	MessageKeyUUID = "uuid"
+)
+
+// delivery is a fetched message together with its decoded signature
+type delivery struct {
+	message   kafka.Message
+	signature *tasks.Signature
+}
+
+// Broker represents a Kafka broker
+type Broker struct {
+	common.Broker
+	brokers      []string
+	writer       *kafka.Writer
+	consumingWG  sync.WaitGroup // wait group to make sure whole consumption completes
+	processingWG sync.WaitGroup // use wait group to make sure task processing completes
+	topics       sync.Map       // topics already created by this broker
+}
+
+// New creates new Broker instance
+func New(cnf *config.Config, brokers []string) iface.Broker {
+	b := &Broker{Broker: common.NewBroker(cnf), brokers: brokers}
+
+	switch b.messageKeyStrategy() {
+	case MessageKeyRoutingKey, MessageKeyGroup, MessageKeyUUID:
+	default:
+		log.WARNING.Printf("Unknown Kafka message key strategy %s, keying messages by task UUID", b.messageKeyStrategy())
+	}
+
+	b.writer = &kafka.Writer{
+		Addr: kafka.TCP(brokers...),
+		// Messages with the same key always end up in the same partition
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+
+	return b
+}
+
+// StartConsuming enters a loop and waits for incoming messages
+func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) (bool, error) {
+	b.consumingWG.Add(1)
+	defer b.consumingWG.Done()
+
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU() * 2
+	}
+
+	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
+
+	// Dial the cluster to make sure connection is live
+	conn, err := b.dial(context.Background())
+	if err != nil {
+		b.GetRetryFunc()(b.GetRetryStopChan())
+
+		// Return err if retry is still true.
+		// If retry is false, broker.StopConsuming() has been called and
+		// therefore Kafka might have been stopped. Return nil exit
+		// StartConsuming()
+		if b.GetRetry() {
+			return b.GetRetry(), err
+		}
+		return b.GetRetry(), errs.ErrConsumerStopped
+	}
+	conn.Close()
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     b.brokers,
+		GroupID:     b.consumerGroup(),
+		Topic:       getQueue(b.GetConfig(), taskProcessor),
+		MinBytes:    1,
+		MaxBytes:    10e6,
+		StartOffset: kafka.FirstOffset,
+		// Offsets are committed explicitly once a task has been processed
+		CommitInterval: 0,
+	})
+	defer reader.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.GetStopChan():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	deliveries := make(chan *delivery, concurrency)
+	errorsChan := make(chan error, 1)
+	offsets := newOffsetTracker()
+
+	// A receiving goroutine keeps fetching messages from the assigned partitions.
+	// Offsets are not committed here, only after the task has been processed.
+	go func() {
+		log.INFO.Print("[*] Waiting for messages. To exit press CTRL+C")
+
+		for {
+			msg, err := reader.FetchMessage(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					select {
+					case errorsChan <- err:
+					default:
+					}
+				}
+				return
+			}
+			offsets.track(msg)
+
+			signature := new(tasks.Signature)
+			if err := b.UnmarshalSignatureWithContentType(msg.Value, contentType(msg), signature); err != nil {
+				log.ERROR.Print(errs.NewErrCouldNotUnmarshalTaskSignature(msg.Value, err))
+				b.commit(reader, offsets, msg)
+				continue
+			}
+
+			d := &delivery{message: msg, signature: signature}
+
+			// Kafka has no native delayed delivery, hold the message back until
+			// its ETA without taking a processing slot. The offset stays uncommitted
+			// so the task is redelivered if the worker dies in the meantime.
+			if signature.ETA != nil && signature.ETA.After(time.Now().UTC()) {
+				go func() {
+					select {
+					case <-time.After(time.Until(*d.signature.ETA)):
+						select {
+						case deliveries <- d:
+						case <-ctx.Done():
+						}
+					case <-ctx.Done():
+					}
+				}()
+				continue
+			}
+
+			select {
+			case deliveries <- d:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := b.consume(deliveries, errorsChan, concurrency, taskProcessor, reader, offsets); err != nil {
+		return b.GetRetry(), err
+	}
+
+	// Waiting for any tasks being processed to finish
+	b.processingWG.Wait()
+
+	return b.GetRetry(), nil
+}
+
+// StopConsuming quits the loop
+func (b *Broker) StopConsuming() {
+	b.Broker.StopConsuming()
+	// Waiting for consumption to finish
+	b.consumingWG.Wait()
+
+	if err := b.writer.Close(); err != nil {
+		log.ERROR.Printf("Failed to close Kafka writer: %s", err)
+	}
+}
+
+// HealthCheck checks one of the Kafka brokers can be reached
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Publish places a new message on the topic named after the routing key
+func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	// Adjust routing key (this decides which topic the message will be published to)
+	b.Broker.AdjustRoutingKey(signature)
+
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	if err := b.ensureTopic(ctx, signature.RoutingKey); err != nil {
+		return err
+	}
+
+	return b.writer.WriteMessages(ctx, kafka.Message{
+		Topic: signature.RoutingKey,
+		Key:   []byte(messageKey(b.messageKeyStrategy(), signature)),
+		Value: msg,
+		Headers: []kafka.Header{
+			{Key: serialization.ContentTypeHeader, Value: []byte(b.ContentType())},
+		},
+	})
+}
+
+// consume takes delivered messages from the channel and manages a worker pool
+// to process tasks concurrently
+func (b *Broker) consume(deliveries <-chan *delivery, errorsChan chan error, concurrency int, taskProcessor iface.TaskProcessor, reader *kafka.Reader, offsets *offsetTracker) error {
+	pool := make(chan struct{}, concurrency)
+
+	// init pool for Worker tasks execution, as many slots as Worker concurrency param
+	go func() {
+		for i := 0; i < concurrency; i++ {
+			pool <- struct{}{}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-errorsChan:
+			return err
+		case d := <-deliveries:
+			// get execution slot from pool (blocks until one is available)
+			<-pool
+
+			b.processingWG.Add(1)
+
+			// Consume the task inside a goroutine so multiple tasks
+			// can be processed concurrently
+			go func() {
+				err := b.consumeOne(d, taskProcessor)
+
+				// Only commit once the task has completed. Kafka cannot leave a
+				// single message behind, so ErrStopTaskDeletion is not honoured.
+				b.commit(reader, offsets, d.message)
+
+				if err != nil && err != errs.ErrStopTaskDeletion {
+					select {
+					case errorsChan <- err:
+					default:
+					}
+				}
+
+				b.processingWG.Done()
+
+				// give slot back to pool
+				pool <- struct{}{}
+			}()
+		case <-b.GetStopChan():
+			return nil
+		}
+	}
+}
+
+// consumeOne processes a single message using TaskProcessor
+func (b *Broker) consumeOne(d *delivery, taskProcessor iface.TaskProcessor) error {
+	// If the task is not registered, we requeue it,
+	// there might be different workers for processing specific tasks
+	if !b.IsTaskRegistered(d.signature.Name) {
+		if d.signature.IgnoreWhenTaskNotRegistered {
+			return nil
+		}
+		log.INFO.Printf("Task not registered with this worker. Requeuing message: %s", d.message.Value)
+
+		return b.writer.WriteMessages(context.Background(), kafka.Message{
+			Topic:   d.message.Topic,
+			Key:     d.message.Key,
+			Value:   d.message.Value,
+			Headers: d.message.Headers,
+		})
+	}
+
+	log.DEBUG.Printf("Received new message: %s", d.message.Value)
+
+	return taskProcessor.Process(d.signature)
+}
+
+// commit marks the message as processed and commits the highest offset of its
+// partition below which all messages have been processed
+func (b *Broker) commit(reader *kafka.Reader, offsets *offsetTracker, msg kafka.Message) {
+	committable, ok := offsets.done(msg)
+	if !ok {
+		return
+	}
+
+	if err := reader.CommitMessages(context.Background(), committable); err != nil {
+		log.ERROR.Printf("Failed to commit offset %d of partition %d: %s", committable.Offset, committable.Partition, err)
+	}
+}
+
+// ensureTopic creates the topic with the configured number of partitions
+// the first time a task is published to it
+func (b *Broker) ensureTopic(ctx context.Context, topic string) error {
+	cnf := b.GetConfig().Kafka
+	if cnf == nil || cnf.Partitions <= 0 {
+		return nil
+	}
+	if _, ok := b.topics.Load(topic); ok {
+		return nil
+	}
+
+	conn, err := b.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Topics can only be created on the controller
+	controller, err := conn.Controller()
+	if err != nil {
+		return fmt.Errorf("Kafka controller lookup error: %s", err)
+	}
+	controllerConn, err := kafka.DialContext(ctx, "tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return fmt.Errorf("Kafka controller dial error: %s", err)
+	}
+	defer controllerConn.Close()
+
+	replicationFactor := cnf.ReplicationFactor
+	if replicationFactor <= 0 {
+		replicationFactor = 1
+	}
+
+	err = controllerConn.CreateTopics(kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     cnf.Partitions,
+		ReplicationFactor: replicationFactor,
+	})
+	if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+		return fmt.Errorf("Create topic %s error: %s", topic, err)
+	}
+
+	b.topics.Store(topic, struct{}{})
+	return nil
+}
+
+// dial opens a connection to the first reachable broker
+func (b *Broker) dial(ctx context.Context) (conn *kafka.Conn, err error) {
+	for _, addr := range b.brokers {
+		conn, err = kafka.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("Kafka dial error: %s", err)
+}
+
+func (b *Broker) consumerGroup() string {
+	if b.GetConfig().Kafka != nil && b.GetConfig().Kafka.ConsumerGroup != "" {
+		return b.GetConfig().Kafka.ConsumerGroup
+	}
+	return defaultConsumerGroup
+}
+
+// messageKeyStrategy returns the configured message key strategy, the task
+// UUID by default
+func (b *Broker) messageKeyStrategy() string {
+	if b.GetConfig().Kafka != nil && b.GetConfig().Kafka.MessageKey != "" {
+		return b.GetConfig().Kafka.MessageKey
+	}
+	return MessageKeyUUID
+}
+
+// messageKey decides which partition of the topic the message goes to, see
+// the message key strategies
+func messageKey(strategy string, signature *tasks.Signature) string {
+	switch strategy {
+	case MessageKeyGroup:
+		if signature.BrokerMessageGroupId != "" {
+			return signature.BrokerMessageGroupId
+		}
+		return signature.UUID
+	case MessageKeyRoutingKey:
+		return signature.RoutingKey
+	}
+	return signature.UUID
+}
+
+// contentType returns the content type header of the message, empty if it was
+// published without one
+func contentType(msg kafka.Message) string {
+	for _, header := range msg.Headers {
+		if header.Key == serialization.ContentTypeHeader {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func getQueue(config *config.Config, taskProcessor iface.TaskProcessor) string {
+	customQueue := taskProcessor.CustomQueue()
+	if customQueue == "" {
+		return config.DefaultQueue
+	}
+	return customQueue
+}
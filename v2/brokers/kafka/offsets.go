@@ -0,0 +1,59 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker keeps track of fetched messages per partition. Tasks finish
+// out of order when processed concurrently, but committing an offset in Kafka
+// acknowledges all messages before it, so only the highest offset below which
+// every message has been processed can be committed.
+type offsetTracker struct {
+	sync.Mutex
+	partitions map[int][]*trackedMessage
+}
+
+type trackedMessage struct {
+	message kafka.Message
+	done    bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int][]*trackedMessage)}
+}
+
+// track registers a fetched message, messages must be tracked in fetch order
+func (t *offsetTracker) track(msg kafka.Message) {
+	t.Lock()
+	defer t.Unlock()
+	t.partitions[msg.Partition] = append(t.partitions[msg.Partition], &trackedMessage{message: msg})
+}
+
+// done marks the message as processed and returns the message whose offset
+// can be committed, if any
+func (t *offsetTracker) done(msg kafka.Message) (kafka.Message, bool) {
+	t.Lock()
+	defer t.Unlock()
+
+	pending := t.partitions[msg.Partition]
+	for _, tracked := range pending {
+		if tracked.message.Offset == msg.Offset {
+			tracked.done = true
+			break
+		}
+	}
+
+	var (
+		committable kafka.Message
+		ok          bool
+	)
+	for len(pending) > 0 && pending[0].done {
+		committable, ok = pending[0].message, true
+		pending = pending[1:]
+	}
+	t.partitions[msg.Partition] = pending
+
+	return committable, ok
+}
@@ -0,0 +1,64 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	t.Parallel()
+
+	tracker := newOffsetTracker()
+	msgs := []kafka.Message{
+		{Partition: 0, Offset: 10},
+		{Partition: 0, Offset: 11},
+		{Partition: 0, Offset: 12},
+		{Partition: 1, Offset: 5},
+	}
+	for _, msg := range msgs {
+		tracker.track(msg)
+	}
+
+	// A later message finishing first must not be committed
+	_, ok := tracker.done(msgs[1])
+	assert.False(t, ok)
+
+	// Other partitions are tracked independently
+	committable, ok := tracker.done(msgs[3])
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), committable.Offset)
+
+	// Once the head finishes, everything processed after it is committed too
+	committable, ok = tracker.done(msgs[0])
+	assert.True(t, ok)
+	assert.Equal(t, int64(11), committable.Offset)
+
+	committable, ok = tracker.done(msgs[2])
+	assert.True(t, ok)
+	assert.Equal(t, int64(12), committable.Offset)
+}
+
+func TestMessageKey(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{UUID: "task_uuid", RoutingKey: "machinery_tasks"}
+	grouped := &tasks.Signature{UUID: "task_uuid", RoutingKey: "machinery_tasks", BrokerMessageGroupId: "group_id"}
+
+	assert.Equal(t, "machinery_tasks", messageKey(MessageKeyRoutingKey, grouped))
+	assert.Equal(t, "task_uuid", messageKey("", grouped))
+	assert.Equal(t, "task_uuid", messageKey(MessageKeyGroup, signature))
+	assert.Equal(t, "group_id", messageKey(MessageKeyGroup, grouped))
+	assert.Equal(t, "task_uuid", messageKey(MessageKeyUUID, grouped))
+
+	// Tasks are spread between the partitions by default
+	b := &Broker{Broker: common.NewBroker(new(config.Config))}
+	assert.Equal(t, MessageKeyUUID, b.messageKeyStrategy())
+	b = &Broker{Broker: common.NewBroker(&config.Config{Kafka: &config.KafkaConfig{MessageKey: MessageKeyRoutingKey}})}
+	assert.Equal(t, MessageKeyRoutingKey, b.messageKeyStrategy())
+}
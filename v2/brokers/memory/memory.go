@@ -0,0 +1,490 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	delayedmemory "github.com/RichardKnop/machinery/v2/delayedtasks/memory"
+)
+
+// preConsumePollPeriod is how often a worker which does not want to consume,
+// e.g. because it is paused, is asked again
+const preConsumePollPeriod = 100 * time.Millisecond
+
+// Broker represents an in-memory broker. Unlike the eager broker, tasks are
+// queued and consumed by workers asynchronously the same way real brokers do,
+// which makes it suitable for running a whole server in unit tests.
+type Broker struct {
+	common.Broker
+	queues       map[string][][]byte
+	delayed      delayedtasks.Store // tasks waiting for their ETA before being queued
+	queued       chan struct{}      // closed and replaced whenever a task is queued
+	mu           sync.Mutex
+	consumingWG  sync.WaitGroup // wait group to make sure whole consumption completes
+	processingWG sync.WaitGroup // use wait group to make sure task processing completes
+	// broadcastQueues are the queues of consuming workers broadcast tasks are
+	// placed on
+	broadcastQueues map[string]struct{}
+	consumers       int
+}
+
+// New creates new Broker instance
+func New(cnf *config.Config) iface.Broker {
+	return &Broker{
+		Broker:          common.NewBroker(cnf),
+		queues:          make(map[string][][]byte),
+		delayed:         delayedmemory.New(),
+		queued:          make(chan struct{}),
+		broadcastQueues: make(map[string]struct{}),
+	}
+}
+
+// StartConsuming enters a loop and waits for incoming messages
+func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) (bool, error) {
+	b.consumingWG.Add(1)
+	defer b.consumingWG.Done()
+
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU() * 2
+	}
+
+	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
+
+	queue := getQueue(b.GetConfig(), taskProcessor)
+	broadcastQueue := b.addBroadcastQueue()
+	defer b.removeBroadcastQueue(broadcastQueue)
+
+	// Channel to which we will push tasks ready for processing by worker
+	deliveries := make(chan []byte, concurrency)
+	pool := make(chan struct{}, concurrency)
+
+	// initialize worker pool with maxWorkers workers
+	for i := 0; i < concurrency; i++ {
+		pool <- struct{}{}
+	}
+
+	// A receiving goroutine keeps popping messages from the queue and sends
+	// them to the deliveries channel
+	go func() {
+
+		log.INFO.Print("[*] Waiting for messages. To exit press CTRL+C")
+
+		for {
+			select {
+			// A way to stop this goroutine from b.StopConsuming
+			case <-b.GetStopChan():
+				return
+			case <-pool:
+				select {
+				case <-b.GetStopChan():
+					return
+				default:
+				}
+
+				// Only broadcast tasks are received while the worker does
+				// not want to consume, e.g. because it is paused
+				queues := []string{broadcastQueue}
+				consuming := taskProcessor.PreConsumeHandler()
+				if consuming {
+					queues = append(queues, tasks.PriorityQueues(queue)...)
+				}
+
+				msg, queued := b.nextTask(queues)
+				if msg != nil {
+					select {
+					case deliveries <- msg:
+					case <-b.GetStopChan():
+						return
+					}
+				} else if consuming {
+					// Nothing queued, wait for a task to be published
+					select {
+					case <-queued:
+					case <-b.GetStopChan():
+						return
+					}
+				} else {
+					// Ask the worker again once a task is published or a
+					// while passed
+					select {
+					case <-queued:
+					case <-time.After(preConsumePollPeriod):
+					case <-b.GetStopChan():
+						return
+					}
+				}
+
+				pool <- struct{}{}
+			}
+		}
+	}()
+
+	if err := b.consume(deliveries, queue, concurrency, taskProcessor); err != nil {
+		return b.GetRetry(), err
+	}
+
+	// Waiting for any tasks being processed to finish
+	b.processingWG.Wait()
+
+	return b.GetRetry(), nil
+}
+
+// StopConsuming quits the loop
+func (b *Broker) StopConsuming() {
+	b.Broker.StopConsuming()
+	// Waiting for consumption to finish
+	b.consumingWG.Wait()
+}
+
+// Publish places a new message on the queue pointed to by the routing key
+func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	// Adjust routing key (this decides which queue the message will be published to)
+	b.Broker.AdjustRoutingKey(signature)
+
+	// Tasks are kept serialized to behave like with any other broker,
+	// e.g. arguments are decoded from JSON when consumed
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Check the ETA signature field, if it is set and it is in the future,
+	// delay the task
+	if signature.ETA != nil {
+		now := time.Now().UTC()
+
+		if signature.ETA.After(now) {
+			eta := *signature.ETA
+			if err := b.delayed.Add(eta, msg); err != nil {
+				return err
+			}
+			time.AfterFunc(eta.Sub(now), func() {
+				b.queueDueTasks(eta)
+			})
+			return nil
+		}
+	}
+
+	b.push(tasks.PriorityQueue(signature.RoutingKey, signature.Priority), msg)
+	return nil
+}
+
+// PublishBroadcast places a new message on the broadcast queue of every
+// consuming worker
+func (b *Broker) PublishBroadcast(ctx context.Context, signature *tasks.Signature) error {
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for queue := range b.broadcastQueues {
+		b.push(queue, msg)
+	}
+	return nil
+}
+
+// GetPendingTasks returns a slice of task signatures waiting in the queue,
+// from the highest priority
+func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	taskSignatures := make([]*tasks.Signature, 0)
+	for _, priorityQueue := range tasks.PriorityQueues(queue) {
+		for _, msg := range b.queues[priorityQueue] {
+			signature, err := b.decodeSignature(msg)
+			if err != nil {
+				return nil, err
+			}
+			taskSignatures = append(taskSignatures, signature)
+		}
+	}
+	return taskSignatures, nil
+}
+
+// TakePendingTasks removes the tasks waiting in the queue the filter returns
+// true for and returns them, from the highest priority. All waiting tasks are
+// taken when the filter is nil.
+func (b *Broker) TakePendingTasks(queue string, filter func(*tasks.Signature) bool) ([]*tasks.Signature, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Queues are only changed once every task has been decoded
+	taken := make([]*tasks.Signature, 0)
+	kept := make(map[string][][]byte)
+	for _, priorityQueue := range tasks.PriorityQueues(queue) {
+		kept[priorityQueue] = make([][]byte, 0, len(b.queues[priorityQueue]))
+		for _, msg := range b.queues[priorityQueue] {
+			signature, err := b.decodeSignature(msg)
+			if err != nil {
+				return nil, err
+			}
+			if filter != nil && !filter(signature) {
+				kept[priorityQueue] = append(kept[priorityQueue], msg)
+				continue
+			}
+			taken = append(taken, signature)
+		}
+	}
+	for priorityQueue, msgs := range kept {
+		b.queues[priorityQueue] = msgs
+	}
+	return taken, nil
+}
+
+// PurgeQueue drops the tasks waiting in the queue and returns how many were
+// dropped
+func (b *Broker) PurgeQueue(queue string) (int, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	purged := 0
+	for _, priorityQueue := range tasks.PriorityQueues(queue) {
+		purged += len(b.queues[priorityQueue])
+		delete(b.queues, priorityQueue)
+	}
+	return purged, nil
+}
+
+// MoveMessages moves up to limit tasks waiting in a queue, all of them when
+// limit is not positive, to another queue, from the highest priority. It
+// returns how many were moved.
+func (b *Broker) MoveMessages(from, to string, limit int) (int, error) {
+	if from == "" {
+		from = b.GetConfig().DefaultQueue
+	}
+	if to == "" {
+		to = b.GetConfig().DefaultQueue
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	moved := 0
+	for _, priorityQueue := range tasks.PriorityQueues(from) {
+		for len(b.queues[priorityQueue]) > 0 && (limit <= 0 || moved < limit) {
+			signature, err := b.decodeSignature(b.queues[priorityQueue][0])
+			if err != nil {
+				return moved, err
+			}
+			signature.RoutingKey = to
+			msg, err := b.MarshalSignature(signature)
+			if err != nil {
+				return moved, fmt.Errorf("Marshal signature error: %s", err)
+			}
+
+			b.queues[priorityQueue] = b.queues[priorityQueue][1:]
+			b.push(tasks.PriorityQueue(to, signature.Priority), msg)
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// GetDelayedTasks returns a slice of task signatures that are scheduled, but not yet in the queue
+func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
+	msgs, err := b.delayed.List()
+	if err != nil {
+		return nil, err
+	}
+
+	taskSignatures := make([]*tasks.Signature, 0, len(msgs))
+	for _, msg := range msgs {
+		signature, err := b.decodeSignature(msg)
+		if err != nil {
+			return nil, err
+		}
+		taskSignatures = append(taskSignatures, signature)
+	}
+	return taskSignatures, nil
+}
+
+// queueDueTasks queues the delayed tasks due at the ETA a timer fired for, or
+// now if it is later. The ETA is used as the wall clock may lag behind the
+// timer.
+func (b *Broker) queueDueTasks(eta time.Time) {
+	now := time.Now().UTC()
+	if eta.After(now) {
+		now = eta
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, err := delayedtasks.Forward(b.delayed, now, 0, func(msg []byte) error {
+		queue := b.GetConfig().DefaultQueue
+		var priority uint8
+		if signature, err := b.decodeSignature(msg); err == nil {
+			queue, priority = signature.RoutingKey, signature.Priority
+		}
+		b.push(tasks.PriorityQueue(queue, priority), msg)
+		return nil
+	})
+	if err != nil {
+		log.ERROR.Printf("Failed to queue delayed tasks: %s", err)
+	}
+}
+
+// consume takes delivered messages from the channel and manages a worker pool
+// to process tasks concurrently
+func (b *Broker) consume(deliveries <-chan []byte, queue string, concurrency int, taskProcessor iface.TaskProcessor) error {
+	errorsChan := make(chan error, concurrency*2)
+	pool := make(chan struct{}, concurrency)
+
+	// init pool for Worker tasks execution, as many slots as Worker concurrency param
+	go func() {
+		for i := 0; i < concurrency; i++ {
+			pool <- struct{}{}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-errorsChan:
+			return err
+		case d := <-deliveries:
+			// get execution slot from pool (blocks until one is available)
+			<-pool
+
+			b.processingWG.Add(1)
+
+			// Consume the task inside a goroutine so multiple tasks
+			// can be processed concurrently
+			go func() {
+				if err := b.consumeOne(d, queue, taskProcessor); err != nil {
+					select {
+					case errorsChan <- err:
+					default:
+					}
+				}
+
+				b.processingWG.Done()
+
+				// give slot back to pool
+				pool <- struct{}{}
+			}()
+		case <-b.GetStopChan():
+			return nil
+		}
+	}
+}
+
+// consumeOne processes a single message using TaskProcessor
+func (b *Broker) consumeOne(delivery []byte, queue string, taskProcessor iface.TaskProcessor) error {
+	signature, err := b.decodeSignature(delivery)
+	if err != nil {
+		return errs.NewErrCouldNotUnmarshalTaskSignature(delivery, err)
+	}
+
+	// If the task is not registered, we requeue it,
+	// there might be different workers for processing specific tasks.
+	// Broadcast tasks are left to the worker, which handles control tasks and
+	// drops the others it does not know, other workers received their own copy
+	if !b.IsTaskRegistered(signature.Name) && !signature.Broadcast {
+		if signature.IgnoreWhenTaskNotRegistered {
+			return nil
+		}
+		log.INFO.Printf("Task not registered with this worker. Requeuing message: %s", delivery)
+
+		b.mu.Lock()
+		b.push(tasks.PriorityQueue(queue, signature.Priority), delivery)
+		b.mu.Unlock()
+		return nil
+	}
+
+	log.DEBUG.Printf("Received new message: %s", delivery)
+
+	return taskProcessor.Process(signature)
+}
+
+// nextTask pops the first message of the first of the queues which is not
+// empty, the broadcast queue of the worker followed by the queues by priority.
+// If the queues are empty it returns a channel which is closed the next time a
+// task is queued.
+func (b *Broker) nextTask(queues []string) ([]byte, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, queue := range queues {
+		if messages := b.queues[queue]; len(messages) > 0 {
+			b.queues[queue] = messages[1:]
+			return messages[0], nil
+		}
+	}
+	return nil, b.queued
+}
+
+// addBroadcastQueue adds a broadcast queue for a consuming worker
+func (b *Broker) addBroadcastQueue() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.consumers++
+	queue := fmt.Sprintf("machinery_broadcast_%d", b.consumers)
+	b.broadcastQueues[queue] = struct{}{}
+	return queue
+}
+
+// removeBroadcastQueue removes the broadcast queue of a worker which stopped
+// consuming together with the tasks left on it
+func (b *Broker) removeBroadcastQueue(queue string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.broadcastQueues, queue)
+	delete(b.queues, queue)
+}
+
+// push appends the message to the queue and wakes up waiting consumers,
+// the caller must hold the mutex
+func (b *Broker) push(queue string, msg []byte) {
+	b.queues[queue] = append(b.queues[queue], msg)
+
+	close(b.queued)
+	b.queued = make(chan struct{})
+}
+
+func (b *Broker) decodeSignature(msg []byte) (*tasks.Signature, error) {
+	signature := new(tasks.Signature)
+	if err := b.UnmarshalSignature(msg, signature); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+func getQueue(config *config.Config, taskProcessor iface.TaskProcessor) string {
+	customQueue := taskProcessor.CustomQueue()
+	if customQueue == "" {
+		return config.DefaultQueue
+	}
+	return customQueue
+}
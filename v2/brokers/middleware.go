@@ -0,0 +1,199 @@
+package brokers
+
+import (
+	"context"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// PublishFunc publishes a task signature to the broker
+type PublishFunc func(ctx context.Context, signature *tasks.Signature) error
+
+// ConsumeFunc processes a task signature consumed from the broker
+type ConsumeFunc func(signature *tasks.Signature) error
+
+// Middleware wraps publishing and consumption of tasks, e.g. for logging,
+// metrics or changing signatures. Returning an error without calling next
+// rejects the task: it is not published, or it is handled by the broker
+// like a failed task when consuming. Returning nil without calling next
+// drops a consumed task.
+type Middleware interface {
+	WrapPublish(next PublishFunc) PublishFunc
+	WrapConsume(next ConsumeFunc) ConsumeFunc
+}
+
+// MiddlewareFuncs implements Middleware with optional functions, a nil
+// function leaves the respective step unchanged
+type MiddlewareFuncs struct {
+	Publish func(next PublishFunc) PublishFunc
+	Consume func(next ConsumeFunc) ConsumeFunc
+}
+
+// WrapPublish implements Middleware
+func (m MiddlewareFuncs) WrapPublish(next PublishFunc) PublishFunc {
+	if m.Publish == nil {
+		return next
+	}
+	return m.Publish(next)
+}
+
+// WrapConsume implements Middleware
+func (m MiddlewareFuncs) WrapConsume(next ConsumeFunc) ConsumeFunc {
+	if m.Consume == nil {
+		return next
+	}
+	return m.Consume(next)
+}
+
+// workerAssigner is implemented by the eager broker
+type workerAssigner interface {
+	AssignWorker(p iface.TaskProcessor)
+}
+
+// middlewareBroker applies middlewares to any broker
+type middlewareBroker struct {
+	iface.Broker
+	middlewares []Middleware
+	publish     PublishFunc
+}
+
+// WithMiddleware wraps the broker so published and consumed tasks go through
+// the middlewares, the first middleware is the outermost one
+func WithMiddleware(broker iface.Broker, middlewares ...Middleware) iface.Broker {
+	if len(middlewares) == 0 {
+		return broker
+	}
+
+	b := &middlewareBroker{Broker: broker, middlewares: middlewares}
+	b.publish = broker.Publish
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		b.publish = middlewares[i].WrapPublish(b.publish)
+	}
+	return b
+}
+
+// Publish places a new message on the broker after running the middlewares
+func (b *middlewareBroker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	return b.publish(ctx, signature)
+}
+
+// PublishBatch runs the middlewares for each task and publishes the tasks they
+// pass on with a single request, if the wrapped broker can publish batches, or
+// one by one otherwise. Middlewares see a batched task as published once it is
+// added to the batch, the batch is published after all of them ran.
+func (b *middlewareBroker) PublishBatch(ctx context.Context, signatures []*tasks.Signature) error {
+	batchPublisher, ok := b.Broker.(iface.BatchPublisher)
+	if !ok {
+		for _, signature := range signatures {
+			if err := b.publish(ctx, signature); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	batch := make([]*tasks.Signature, 0, len(signatures))
+	publish := PublishFunc(func(ctx context.Context, signature *tasks.Signature) error {
+		batch = append(batch, signature)
+		return nil
+	})
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		publish = b.middlewares[i].WrapPublish(publish)
+	}
+	for _, signature := range signatures {
+		if err := publish(ctx, signature); err != nil {
+			return err
+		}
+	}
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return batchPublisher.PublishBatch(ctx, batch)
+}
+
+// PublishBroadcast publishes a task to every worker after running the
+// middlewares, if the wrapped broker can broadcast tasks
+func (b *middlewareBroker) PublishBroadcast(ctx context.Context, signature *tasks.Signature) error {
+	broadcaster, ok := b.Broker.(iface.Broadcaster)
+	if !ok {
+		return errs.ErrBroadcastNotSupported
+	}
+
+	publish := PublishFunc(broadcaster.PublishBroadcast)
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		publish = b.middlewares[i].WrapPublish(publish)
+	}
+	return publish(ctx, signature)
+}
+
+// TakePendingTasks takes pending tasks off the queue, if the wrapped broker
+// can remove pending tasks
+func (b *middlewareBroker) TakePendingTasks(queue string, filter func(*tasks.Signature) bool) ([]*tasks.Signature, error) {
+	taker, ok := b.Broker.(iface.PendingTaskTaker)
+	if !ok {
+		return nil, errs.ErrTakePendingTasksNotSupported
+	}
+	return taker.TakePendingTasks(queue, filter)
+}
+
+// PurgeQueue drops the pending tasks of the queue, if the wrapped broker can
+// manage queues
+func (b *middlewareBroker) PurgeQueue(queue string) (int, error) {
+	manager, ok := b.Broker.(iface.QueueManager)
+	if !ok {
+		return 0, errs.ErrQueueManagementNotSupported
+	}
+	return manager.PurgeQueue(queue)
+}
+
+// MoveMessages moves pending tasks from a queue to another, if the wrapped
+// broker can manage queues. Moved tasks do not go through the middlewares.
+func (b *middlewareBroker) MoveMessages(from, to string, limit int) (int, error) {
+	manager, ok := b.Broker.(iface.QueueManager)
+	if !ok {
+		return 0, errs.ErrQueueManagementNotSupported
+	}
+	return manager.MoveMessages(from, to, limit)
+}
+
+// StartConsuming consumes from the broker, running the middlewares before
+// tasks are processed
+func (b *middlewareBroker) StartConsuming(consumerTag string, concurrency int, p iface.TaskProcessor) (bool, error) {
+	return b.Broker.StartConsuming(consumerTag, concurrency, b.wrapProcessor(p))
+}
+
+// AssignWorker assigns a worker to the wrapped eager broker
+func (b *middlewareBroker) AssignWorker(p iface.TaskProcessor) {
+	if assigner, ok := b.Broker.(workerAssigner); ok {
+		assigner.AssignWorker(b.wrapProcessor(p))
+	}
+}
+
+func (b *middlewareBroker) wrapProcessor(p iface.TaskProcessor) iface.TaskProcessor {
+	consume := ConsumeFunc(p.Process)
+	for i := len(b.middlewares) - 1; i >= 0; i-- {
+		consume = b.middlewares[i].WrapConsume(consume)
+	}
+	return &middlewareProcessor{TaskProcessor: p, consume: consume}
+}
+
+// middlewareProcessor runs the consume middlewares before processing tasks
+type middlewareProcessor struct {
+	iface.TaskProcessor
+	consume ConsumeFunc
+}
+
+// Process runs the middlewares and the task processor
+func (p *middlewareProcessor) Process(signature *tasks.Signature) error {
+	return p.consume(signature)
+}
+
+// CustomPrefetch returns the prefetch of the task processor, if it limits
+// how many messages are fetched ahead of processing
+func (p *middlewareProcessor) CustomPrefetch() int {
+	return common.GetCustomPrefetch(p.TaskProcessor)
+}
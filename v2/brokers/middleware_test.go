@@ -0,0 +1,199 @@
+package brokers_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/brokers"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/brokers/memory"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+type processor struct {
+	processed chan *tasks.Signature
+}
+
+func (p *processor) Process(signature *tasks.Signature) error {
+	p.processed <- signature
+	return nil
+}
+func (p *processor) CustomQueue() string     { return "" }
+func (p *processor) PreConsumeHandler() bool { return true }
+
+// prefetchProcessor limits how many messages are fetched ahead
+type prefetchProcessor struct {
+	processor
+}
+
+func (p *prefetchProcessor) CustomPrefetch() int { return 3 }
+
+// prefetchBroker records the prefetch of the processor it consumes with
+type prefetchBroker struct {
+	iface.Broker
+	prefetch int
+}
+
+func (b *prefetchBroker) StartConsuming(consumerTag string, concurrency int, p iface.TaskProcessor) (bool, error) {
+	b.prefetch = common.GetCustomPrefetch(p)
+	return false, nil
+}
+
+// batchBroker records the batches it publishes
+type batchBroker struct {
+	iface.Broker
+	batches [][]string
+}
+
+func (b *batchBroker) PublishBatch(ctx context.Context, signatures []*tasks.Signature) error {
+	names := make([]string, len(signatures))
+	for i, signature := range signatures {
+		names[i] = signature.Name
+		if err := b.Broker.Publish(ctx, signature); err != nil {
+			return err
+		}
+	}
+	b.batches = append(b.batches, names)
+	return nil
+}
+
+// order records the order middlewares run in
+type order struct {
+	name  string
+	calls *[]string
+}
+
+func (o order) WrapPublish(next brokers.PublishFunc) brokers.PublishFunc {
+	return func(ctx context.Context, signature *tasks.Signature) error {
+		*o.calls = append(*o.calls, "publish "+o.name)
+		return next(ctx, signature)
+	}
+}
+
+func (o order) WrapConsume(next brokers.ConsumeFunc) brokers.ConsumeFunc {
+	return next
+}
+
+func TestWithMiddlewarePublish(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	inner := memory.New(cnf)
+
+	var calls []string
+	reject := brokers.MiddlewareFuncs{
+		Publish: func(next brokers.PublishFunc) brokers.PublishFunc {
+			return func(ctx context.Context, signature *tasks.Signature) error {
+				if signature.Name == "rejected" {
+					return errors.New("rejected")
+				}
+				return next(ctx, signature)
+			}
+		},
+	}
+	broker := brokers.WithMiddleware(inner, order{"first", &calls}, order{"second", &calls}, reject)
+
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{Name: "foo"}))
+	assert.Equal(t, []string{"publish first", "publish second"}, calls)
+
+	assert.Error(t, broker.Publish(context.Background(), &tasks.Signature{Name: "rejected"}))
+
+	pending, err := inner.GetPendingTasks("")
+	require.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "foo", pending[0].Name)
+	}
+}
+
+func TestWithMiddlewarePublishBatch(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	drop := brokers.MiddlewareFuncs{
+		Publish: func(next brokers.PublishFunc) brokers.PublishFunc {
+			return func(ctx context.Context, signature *tasks.Signature) error {
+				if signature.Name == "dropped" {
+					return nil
+				}
+				return next(ctx, signature)
+			}
+		},
+	}
+
+	var calls []string
+	inner := &batchBroker{Broker: memory.New(cnf)}
+	broker := brokers.WithMiddleware(inner, order{"first", &calls}, drop)
+	batchPublisher, ok := broker.(iface.BatchPublisher)
+	require.True(t, ok)
+
+	signatures := []*tasks.Signature{{Name: "foo"}, {Name: "dropped"}, {Name: "bar"}}
+	require.NoError(t, batchPublisher.PublishBatch(context.Background(), signatures))
+	assert.Equal(t, []string{"publish first", "publish first", "publish first"}, calls)
+	assert.Equal(t, [][]string{{"foo", "bar"}}, inner.batches)
+
+	// Brokers which cannot publish batches get the tasks one by one
+	unbatched := memory.New(cnf)
+	broker = brokers.WithMiddleware(unbatched, drop)
+	require.NoError(t, broker.(iface.BatchPublisher).PublishBatch(context.Background(), signatures))
+	pending, err := unbatched.GetPendingTasks("")
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestWithMiddlewareConsume(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	drop := brokers.MiddlewareFuncs{
+		Consume: func(next brokers.ConsumeFunc) brokers.ConsumeFunc {
+			return func(signature *tasks.Signature) error {
+				if signature.Name == "dropped" {
+					return nil
+				}
+				return next(signature)
+			}
+		},
+	}
+	broker := brokers.WithMiddleware(memory.New(cnf), drop)
+	broker.SetRegisteredTaskNames([]string{"foo", "dropped"})
+
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{Name: "dropped"}))
+	require.NoError(t, broker.Publish(context.Background(), &tasks.Signature{Name: "foo"}))
+
+	p := &processor{processed: make(chan *tasks.Signature, 2)}
+	go broker.StartConsuming("test", 1, p)
+	defer broker.StopConsuming()
+
+	select {
+	case signature := <-p.processed:
+		assert.Equal(t, "foo", signature.Name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("task was not consumed")
+	}
+}
+
+func TestWithMiddlewareCustomPrefetch(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	inner := &prefetchBroker{Broker: memory.New(cnf)}
+	broker := brokers.WithMiddleware(inner, brokers.MiddlewareFuncs{})
+
+	_, err := broker.StartConsuming("test", 1, new(prefetchProcessor))
+	require.NoError(t, err)
+	assert.Equal(t, 3, inner.prefetch)
+}
+
+func TestWithMiddlewareNone(t *testing.T) {
+	t.Parallel()
+
+	inner := memory.New(&config.Config{})
+	assert.Equal(t, inner, brokers.WithMiddleware(inner))
+}
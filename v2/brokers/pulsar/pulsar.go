@@ -0,0 +1,301 @@
+package pulsar
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/retry"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	apachepulsar "github.com/apache/pulsar-client-go/pulsar"
+)
+
+const (
+	defaultSubscriptionName = "machinery"
+	// maxNackBackoff caps the redelivery delay of negatively acknowledged messages
+	maxNackBackoff = time.Hour
+)
+
+// Broker represents an Apache Pulsar broker
+type Broker struct {
+	common.Broker
+	client       apachepulsar.Client
+	processingWG sync.WaitGroup // use wait group to make sure task processing completes on interrupt signal
+	consumingWG  sync.WaitGroup // wait group to make sure whole consumption completes
+
+	producers      map[string]apachepulsar.Producer
+	producersMutex sync.Mutex
+}
+
+// New creates new Broker instance
+func New(cnf *config.Config, url string) (iface.Broker, error) {
+	client, err := apachepulsar.NewClient(apachepulsar.ClientOptions{URL: url})
+	if err != nil {
+		return nil, fmt.Errorf("Pulsar client error: %s", err)
+	}
+
+	return &Broker{
+		Broker:    common.NewBroker(cnf),
+		client:    client,
+		producers: make(map[string]apachepulsar.Producer),
+	}, nil
+}
+
+// StartConsuming enters a loop and waits for incoming messages
+func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) (bool, error) {
+	b.consumingWG.Add(1)
+	defer b.consumingWG.Done()
+
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU() * 2
+	}
+
+	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
+
+	queue := taskProcessor.CustomQueue()
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	// A shared subscription distributes messages between all workers in a
+	// round robin fashion and is required for delayed delivery
+	options := apachepulsar.ConsumerOptions{
+		Topic:             queue,
+		SubscriptionName:  b.subscriptionName(),
+		Name:              consumerTag,
+		Type:              apachepulsar.Shared,
+		NackBackoffPolicy: new(fibonacciBackoff),
+	}
+	if cnf := b.GetConfig().Pulsar; cnf != nil && cnf.MaxDeliveries > 0 {
+		options.DLQ = &apachepulsar.DLQPolicy{
+			MaxDeliveries:   cnf.MaxDeliveries,
+			DeadLetterTopic: cnf.DeadLetterTopic,
+		}
+	}
+
+	consumer, err := b.client.Subscribe(options)
+	if err != nil {
+		b.GetRetryFunc()(b.GetRetryStopChan())
+		return b.GetRetry(), fmt.Errorf("Pulsar subscribe error: %s", err)
+	}
+	defer consumer.Close()
+
+	log.INFO.Print("[*] Waiting for messages. To exit press CTRL+C")
+
+	if err := b.consume(consumer, concurrency, taskProcessor); err != nil {
+		return b.GetRetry(), err
+	}
+
+	// Waiting for any tasks being processed to finish
+	b.processingWG.Wait()
+
+	return b.GetRetry(), nil
+}
+
+// StopConsuming quits the loop and closes the producers and the client
+func (b *Broker) StopConsuming() {
+	b.Broker.StopConsuming()
+
+	// Waiting for any tasks being processed to finish
+	b.processingWG.Wait()
+	// Waiting for the consumer to be closed
+	b.consumingWG.Wait()
+
+	b.producersMutex.Lock()
+	for topic, producer := range b.producers {
+		producer.Close()
+		delete(b.producers, topic)
+	}
+	b.producersMutex.Unlock()
+
+	b.client.Close()
+}
+
+// HealthCheck checks the partitions of the default topic can be looked up
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	if _, err := b.client.TopicPartitions(b.GetConfig().DefaultQueue); err != nil {
+		return fmt.Errorf("Pulsar health check error: %s", err)
+	}
+	return nil
+}
+
+// Publish places a new message on the topic pointed to by the routing key
+func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	// Adjust routing key (this decides which topic the message will be published to)
+	b.AdjustRoutingKey(signature)
+
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	producer, err := b.getOrCreateProducer(signature.RoutingKey)
+	if err != nil {
+		return err
+	}
+
+	message := &apachepulsar.ProducerMessage{
+		Payload: msg,
+		Key:     signature.BrokerMessageGroupId,
+	}
+
+	// Check the ETA signature field, if it is set and it is in the future,
+	// let Pulsar deliver the message at that time
+	if signature.ETA != nil && signature.ETA.After(time.Now().UTC()) {
+		message.DeliverAt = *signature.ETA
+	}
+
+	if _, err := producer.Send(ctx, message); err != nil {
+		return fmt.Errorf("Pulsar send error: %s", err)
+	}
+
+	return nil
+}
+
+// consume takes delivered messages from the consumer and manages a worker pool
+// to process tasks concurrently
+func (b *Broker) consume(consumer apachepulsar.Consumer, concurrency int, taskProcessor iface.TaskProcessor) error {
+	pool := make(chan struct{}, concurrency)
+
+	// initialize worker pool with maxWorkers workers
+	go func() {
+		for i := 0; i < concurrency; i++ {
+			pool <- struct{}{}
+		}
+	}()
+
+	// make channel with a capacity makes it become a buffered channel so that a worker which wants to
+	// push an error to `errorsChan` doesn't need to be blocked while the for-loop is blocked waiting
+	// a worker, that is, it avoids a possible deadlock
+	errorsChan := make(chan error, 1)
+
+	deliveries := consumer.Chan()
+	for {
+		select {
+		case err := <-errorsChan:
+			return err
+		case d := <-deliveries:
+			// get worker from pool (blocks until one is available)
+			<-pool
+
+			b.processingWG.Add(1)
+
+			// Consume the task inside a goroutine so multiple tasks
+			// can be processed concurrently
+			go func() {
+				if err := b.consumeOne(d, taskProcessor); err != nil {
+					select {
+					case errorsChan <- err:
+					default:
+					}
+				}
+
+				b.processingWG.Done()
+
+				// give worker back to pool
+				pool <- struct{}{}
+			}()
+		case <-b.GetStopChan():
+			return nil
+		}
+	}
+}
+
+// consumeOne processes a single message using TaskProcessor
+func (b *Broker) consumeOne(delivery apachepulsar.ConsumerMessage, taskProcessor iface.TaskProcessor) error {
+	if len(delivery.Payload()) == 0 {
+		delivery.Ack(delivery.Message)
+		return nil
+	}
+
+	// Unmarshal message body into signature struct, a malformed message
+	// will never succeed so it is acknowledged rather than redelivered
+	signature := new(tasks.Signature)
+	if err := b.UnmarshalSignature(delivery.Payload(), signature); err != nil {
+		delivery.Ack(delivery.Message)
+		return errs.NewErrCouldNotUnmarshalTaskSignature(delivery.Payload(), err)
+	}
+
+	// If the task is not registered, we nack it so it is redelivered,
+	// there might be different workers for processing specific tasks
+	if !b.IsTaskRegistered(signature.Name) {
+		if signature.IgnoreWhenTaskNotRegistered {
+			delivery.Ack(delivery.Message)
+			return nil
+		}
+		log.INFO.Printf("Task not registered with this worker. Requeuing message: %s", delivery.Payload())
+
+		delivery.Nack(delivery.Message)
+		return nil
+	}
+
+	log.DEBUG.Printf("Received new message: %s", delivery.Payload())
+
+	// Retried tasks are sent again by the worker with their retry delay, so
+	// processing only fails when the task could not be handled, e.g. because
+	// the result backend is down
+	err := taskProcessor.Process(signature)
+	if err != nil {
+		// Negatively acknowledge the message, it is redelivered with backoff
+		// and eventually moved to the dead letter topic if configured
+		delivery.Nack(delivery.Message)
+		if err == errs.ErrStopTaskDeletion {
+			return nil
+		}
+		return err
+	}
+
+	return delivery.Ack(delivery.Message)
+}
+
+// getOrCreateProducer returns a producer for the topic, producers are reused
+// to avoid having to create a new one for every published message
+func (b *Broker) getOrCreateProducer(topic string) (apachepulsar.Producer, error) {
+	b.producersMutex.Lock()
+	defer b.producersMutex.Unlock()
+
+	producer, ok := b.producers[topic]
+	if ok {
+		return producer, nil
+	}
+
+	producer, err := b.client.CreateProducer(apachepulsar.ProducerOptions{Topic: topic})
+	if err != nil {
+		return nil, fmt.Errorf("Pulsar create producer for topic %s error: %s", topic, err)
+	}
+	b.producers[topic] = producer
+
+	return producer, nil
+}
+
+func (b *Broker) subscriptionName() string {
+	if b.GetConfig().Pulsar != nil && b.GetConfig().Pulsar.SubscriptionName != "" {
+		return b.GetConfig().Pulsar.SubscriptionName
+	}
+	return defaultSubscriptionName
+}
+
+// fibonacciBackoff spaces out redeliveries of negatively acknowledged messages
+// like the default retry strategy of the worker
+type fibonacciBackoff struct{}
+
+// Next returns the delay before the message is redelivered
+func (*fibonacciBackoff) Next(redeliveryCount uint32) time.Duration {
+	fibonacci := retry.Fibonacci()
+	delay := fibonacci()
+	for i := uint32(0); i < redeliveryCount; i++ {
+		delay = fibonacci()
+		if time.Duration(delay)*time.Second >= maxNackBackoff {
+			return maxNackBackoff
+		}
+	}
+	return time.Duration(delay) * time.Second
+}
@@ -0,0 +1,20 @@
+package pulsar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFibonacciBackoff(t *testing.T) {
+	t.Parallel()
+
+	backoff := new(fibonacciBackoff)
+
+	assert.Equal(t, 1*time.Second, backoff.Next(0))
+	assert.Equal(t, 1*time.Second, backoff.Next(1))
+	assert.Equal(t, 2*time.Second, backoff.Next(2))
+	assert.Equal(t, 8*time.Second, backoff.Next(5))
+	assert.Equal(t, maxNackBackoff, backoff.Next(100))
+}
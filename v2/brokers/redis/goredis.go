@@ -1,25 +1,26 @@
 package redis
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"runtime"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/go-redsync/redsync/v4"
+	"github.com/google/uuid"
 
 	"github.com/RichardKnop/machinery/v2/brokers/errs"
 	"github.com/RichardKnop/machinery/v2/brokers/iface"
 	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
 	"github.com/RichardKnop/machinery/v2/log"
 	"github.com/RichardKnop/machinery/v2/tasks"
+
+	delayedredis "github.com/RichardKnop/machinery/v2/delayedtasks/redis"
 )
 
 // BrokerGR represents a Redis broker
@@ -29,40 +30,28 @@ type BrokerGR struct {
 	consumingWG  sync.WaitGroup // wait group to make sure whole consumption completes
 	processingWG sync.WaitGroup // use wait group to make sure task processing completes
 	delayedWG    sync.WaitGroup
+	broadcastWG  sync.WaitGroup
 	// If set, path to a socket file overrides hostname
 	socketPath           string
 	redsync              *redsync.Redsync
 	redisOnce            sync.Once
 	redisDelayedTasksKey string
+	delayedTasks         delayedtasks.Store
+	broadcastID          string // unique to the broker, identifies its broadcast queues
 }
 
 // NewGR creates new Broker instance
 func NewGR(cnf *config.Config, addrs []string, db int) iface.Broker {
 	b := &BrokerGR{Broker: common.NewBroker(cnf)}
+	b.broadcastID = uuid.New().String()
 
-	var password string
-	parts := strings.Split(addrs[0], "@")
-	if len(parts) >= 2 {
-		// with password
-		password = strings.Join(parts[:len(parts)-1], "@")
-		addrs[0] = parts[len(parts)-1] // addr is the last one without @
-	}
-
-	ropt := &redis.UniversalOptions{
-		Addrs:    addrs,
-		DB:       db,
-		Password: password,
-	}
-	if cnf.Redis != nil {
-		ropt.MasterName = cnf.Redis.MasterName
-	}
-
-	b.rclient = redis.NewUniversalClient(ropt)
+	b.rclient = common.NewGoRedisClient(addrs, db, cnf.Redis, common.RedisBrokerTLSConfig(cnf))
 	if cnf.Redis.DelayedTasksKey != "" {
 		b.redisDelayedTasksKey = cnf.Redis.DelayedTasksKey
 	} else {
 		b.redisDelayedTasksKey = defaultRedisDelayedTasksKey
 	}
+	b.delayedTasks = delayedredis.New(b.rclient, b.redisDelayedTasksKey)
 	return b
 }
 
@@ -92,8 +81,13 @@ func (b *BrokerGR) StartConsuming(consumerTag string, concurrency int, taskProce
 		return b.GetRetry(), errs.ErrConsumerStopped
 	}
 
-	// Channel to which we will push tasks ready for processing by worker
-	deliveries := make(chan []byte, concurrency)
+	// Channel to which we will push tasks ready for processing by worker,
+	// it buffers as many tasks as the worker prefetches
+	prefetch := concurrency
+	if customPrefetch := common.GetCustomPrefetch(taskProcessor); customPrefetch > 0 {
+		prefetch = customPrefetch
+	}
+	deliveries := make(chan []byte, prefetch)
 	pool := make(chan struct{}, concurrency)
 
 	// initialize worker pool with maxWorkers workers
@@ -115,10 +109,19 @@ func (b *BrokerGR) StartConsuming(consumerTag string, concurrency int, taskProce
 				close(deliveries)
 				return
 			case <-pool:
-				task, _ := b.nextTask(getQueueGR(b.GetConfig(), taskProcessor))
-				//TODO: should this error be ignored?
-				if len(task) > 0 {
-					deliveries <- task
+				if taskProcessor.PreConsumeHandler() {
+					task, _ := b.nextTask(getQueueGR(b.GetConfig(), taskProcessor))
+					//TODO: should this error be ignored?
+					if len(task) > 0 {
+						deliveries <- task
+					}
+				} else {
+					// The worker does not want to consume, e.g. because it
+					// is paused, ask it again after a poll period
+					select {
+					case <-b.GetStopChan():
+					case <-time.After(b.normalTasksPollPeriod()):
+					}
 				}
 
 				pool <- struct{}{}
@@ -138,21 +141,32 @@ func (b *BrokerGR) StartConsuming(consumerTag string, concurrency int, taskProce
 			case <-b.GetStopChan():
 				return
 			default:
-				task, err := b.nextDelayedTask(b.redisDelayedTasksKey)
-				if err != nil {
-					continue
+				if err := b.moveDelayedTasks(); err != nil {
+					log.ERROR.Printf("Failed to move delayed tasks: %s", err)
 				}
+			}
+		}
+	}()
 
-				signature := new(tasks.Signature)
-				decoder := json.NewDecoder(bytes.NewReader(task))
-				decoder.UseNumber()
-				if err := decoder.Decode(signature); err != nil {
-					log.ERROR.Print(errs.NewErrCouldNotUnmarshalTaskSignature(task, err))
-				}
+	// A goroutine to process broadcast tasks published to every worker
+	b.broadcastWG.Add(1)
+	go func() {
+		defer b.broadcastWG.Done()
+
+		queue := broadcastQueue(b.GetConfig(), b.broadcastID, consumerTag)
+		for {
+			if err := b.consumeBroadcasts(queue, taskProcessor); err != nil {
+				log.ERROR.Printf("Failed to receive broadcast tasks: %s", err)
+			}
 
-				if err := b.Publish(context.Background(), signature); err != nil {
-					log.ERROR.Print(err)
+			select {
+			// A way to stop this goroutine from b.StopConsuming
+			case <-b.GetStopChan():
+				if err := b.unregisterBroadcastQueue(queue); err != nil {
+					log.ERROR.Printf("Failed to unregister broadcast queue: %s", err)
 				}
+				return
+			case <-time.After(time.Second):
 			}
 		}
 	}()
@@ -172,36 +186,93 @@ func (b *BrokerGR) StopConsuming() {
 	b.Broker.StopConsuming()
 	// Waiting for the delayed tasks goroutine to have stopped
 	b.delayedWG.Wait()
+	// Waiting for the broadcast tasks goroutine to have stopped
+	b.broadcastWG.Wait()
 	// Waiting for consumption to finish
 	b.consumingWG.Wait()
 
 	b.rclient.Close()
 }
 
+// HealthCheck pings the Redis server
+func (b *BrokerGR) HealthCheck(ctx context.Context) error {
+	return b.rclient.Ping(ctx).Err()
+}
+
 // Publish places a new message on the default queue
 func (b *BrokerGR) Publish(ctx context.Context, signature *tasks.Signature) error {
+	return b.publish(context.Background(), b.rclient, signature)
+}
+
+// PublishBatch places new messages on their queues with a single pipeline,
+// so a group is published with one round trip
+func (b *BrokerGR) PublishBatch(ctx context.Context, signatures []*tasks.Signature) error {
+	_, err := b.rclient.Pipelined(context.Background(), func(pipe redis.Pipeliner) error {
+		for _, signature := range signatures {
+			if err := b.publish(context.Background(), pipe, signature); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return err
+}
+
+// PublishBroadcast places a new message on the broadcast queue of every
+// registered worker. Workers which are reconnecting receive it once they
+// consume again, registrations not refreshed within broadcastQueueTTL are
+// removed first.
+func (b *BrokerGR) PublishBroadcast(ctx context.Context, signature *tasks.Signature) error {
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	registry := broadcastRegistry(b.GetConfig())
+	expired := strconv.FormatInt(time.Now().Add(-broadcastQueueTTL).UnixMilli(), 10)
+	if err := b.rclient.ZRemRangeByScore(ctx, registry, "-inf", expired).Err(); err != nil {
+		return err
+	}
+	queues, err := b.rclient.ZRange(ctx, registry, 0, -1).Result()
+	if err != nil || len(queues) == 0 {
+		return err
+	}
+
+	// Queues of workers gone since they registered expire
+	_, err = b.rclient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, queue := range queues {
+			pipe.RPush(ctx, queue, msg)
+			pipe.PExpire(ctx, queue, broadcastQueueTTL)
+		}
+		return nil
+	})
+	return err
+}
+
+// publish places the task on its queue, or in the delayed tasks ZSET when its
+// ETA is in the future
+func (b *BrokerGR) publish(ctx context.Context, cmdable redis.Cmdable, signature *tasks.Signature) error {
 	// Adjust routing key (this decides which queue the message will be published to)
 	b.Broker.AdjustRoutingKey(signature)
 
-	msg, err := json.Marshal(signature)
+	msg, err := b.MarshalSignature(signature)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal signature error: %s", err)
 	}
 
 	// Check the ETA signature field, if it is set and it is in the future,
-	// delay the task
+	// delay the task. It is added to the ZSET of the delayed tasks store with
+	// the command so it can be part of a pipeline.
 	if signature.ETA != nil {
 		now := time.Now().UTC()
 
 		if signature.ETA.After(now) {
 			score := signature.ETA.UnixNano()
-			err = b.rclient.ZAdd(context.Background(), b.redisDelayedTasksKey, &redis.Z{Score: float64(score), Member: msg}).Err()
-			return err
+			return cmdable.ZAdd(ctx, b.redisDelayedTasksKey, &redis.Z{Score: float64(score), Member: msg}).Err()
 		}
 	}
 
-	err = b.rclient.RPush(context.Background(), signature.RoutingKey, msg).Err()
-	return err
+	return cmdable.RPush(ctx, taskQueue(b.GetConfig(), signature.RoutingKey, signature.Priority), msg).Err()
 }
 
 // GetPendingTasks returns a slice of task signatures waiting in the queue
@@ -210,27 +281,133 @@ func (b *BrokerGR) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
 	if queue == "" {
 		queue = b.GetConfig().DefaultQueue
 	}
-	results, err := b.rclient.LRange(context.Background(), queue, 0, -1).Result()
-	if err != nil {
-		return nil, err
-	}
 
-	taskSignatures := make([]*tasks.Signature, len(results))
-	for i, result := range results {
-		signature := new(tasks.Signature)
-		decoder := json.NewDecoder(strings.NewReader(result))
-		decoder.UseNumber()
-		if err := decoder.Decode(signature); err != nil {
+	taskSignatures := make([]*tasks.Signature, 0)
+	for _, list := range consumedQueues(b.GetConfig(), queue) {
+		results, err := b.rclient.LRange(context.Background(), list, 0, -1).Result()
+		if err != nil {
 			return nil, err
 		}
-		taskSignatures[i] = signature
+
+		for _, result := range results {
+			signature := new(tasks.Signature)
+			if err := b.UnmarshalSignature([]byte(result), signature); err != nil {
+				return nil, err
+			}
+			taskSignatures = append(taskSignatures, signature)
+		}
 	}
 	return taskSignatures, nil
 }
 
+// TakePendingTasks removes the tasks waiting in the queue the filter returns
+// true for and returns them. All waiting tasks are taken when the filter is
+// nil. A task consumed meanwhile is not taken.
+func (b *BrokerGR) TakePendingTasks(queue string, filter func(*tasks.Signature) bool) ([]*tasks.Signature, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	taken := make([]*tasks.Signature, 0)
+	for _, list := range consumedQueues(b.GetConfig(), queue) {
+		results, err := b.rclient.LRange(context.Background(), list, 0, -1).Result()
+		if err != nil {
+			return taken, err
+		}
+
+		for _, result := range results {
+			signature := new(tasks.Signature)
+			if err := b.UnmarshalSignature([]byte(result), signature); err != nil {
+				return taken, err
+			}
+			if filter != nil && !filter(signature) {
+				continue
+			}
+
+			removed, err := b.rclient.LRem(context.Background(), list, 1, result).Result()
+			if err != nil {
+				return taken, err
+			}
+			if removed > 0 {
+				taken = append(taken, signature)
+			}
+		}
+	}
+	return taken, nil
+}
+
+// PurgeQueue drops the tasks waiting in the queue and returns how many were
+// dropped
+func (b *BrokerGR) PurgeQueue(queue string) (int, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	purged := 0
+	for _, list := range consumedQueues(b.GetConfig(), queue) {
+		var length *redis.IntCmd
+		_, err := b.rclient.TxPipelined(context.Background(), func(pipe redis.Pipeliner) error {
+			length = pipe.LLen(context.Background(), list)
+			pipe.Del(context.Background(), list)
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+		purged += int(length.Val())
+	}
+	return purged, nil
+}
+
+// MoveMessages moves up to limit tasks waiting in a queue, all of them when
+// limit is not positive, to another queue, from the highest priority. It
+// returns how many were moved. Tasks are moved one at a time, a task which
+// cannot be decoded is put back and stops the move.
+func (b *BrokerGR) MoveMessages(from, to string, limit int) (int, error) {
+	if from == "" {
+		from = b.GetConfig().DefaultQueue
+	}
+	if to == "" {
+		to = b.GetConfig().DefaultQueue
+	}
+
+	ctx := context.Background()
+	moved := 0
+	for _, list := range consumedQueues(b.GetConfig(), from) {
+		for limit <= 0 || moved < limit {
+			result, err := b.rclient.LPop(ctx, list).Bytes()
+			if err == redis.Nil {
+				break
+			}
+			if err != nil {
+				return moved, err
+			}
+
+			signature := new(tasks.Signature)
+			if err := b.UnmarshalSignature(result, signature); err != nil {
+				b.rclient.LPush(ctx, list, result)
+				return moved, err
+			}
+			signature.RoutingKey = to
+			msg, err := b.MarshalSignature(signature)
+			if err != nil {
+				b.rclient.LPush(ctx, list, result)
+				return moved, fmt.Errorf("Marshal signature error: %s", err)
+			}
+
+			if err := b.rclient.RPush(ctx, taskQueue(b.GetConfig(), to, signature.Priority), msg).Err(); err != nil {
+				b.rclient.LPush(ctx, list, result)
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
 // GetDelayedTasks returns a slice of task signatures that are scheduled, but not yet in the queue
 func (b *BrokerGR) GetDelayedTasks() ([]*tasks.Signature, error) {
-	results, err := b.rclient.ZRange(context.Background(), b.redisDelayedTasksKey, 0, -1).Result()
+	results, err := b.delayedTasks.List()
 	if err != nil {
 		return nil, err
 	}
@@ -238,9 +415,7 @@ func (b *BrokerGR) GetDelayedTasks() ([]*tasks.Signature, error) {
 	taskSignatures := make([]*tasks.Signature, len(results))
 	for i, result := range results {
 		signature := new(tasks.Signature)
-		decoder := json.NewDecoder(strings.NewReader(result))
-		decoder.UseNumber()
-		if err := decoder.Decode(signature); err != nil {
+		if err := b.UnmarshalSignature(result, signature); err != nil {
 			return nil, err
 		}
 		taskSignatures[i] = signature
@@ -297,21 +472,23 @@ func (b *BrokerGR) consume(deliveries <-chan []byte, concurrency int, taskProces
 // consumeOne processes a single message using TaskProcessor
 func (b *BrokerGR) consumeOne(delivery []byte, taskProcessor iface.TaskProcessor) error {
 	signature := new(tasks.Signature)
-	decoder := json.NewDecoder(bytes.NewReader(delivery))
-	decoder.UseNumber()
-	if err := decoder.Decode(signature); err != nil {
+	if err := b.UnmarshalSignature(delivery, signature); err != nil {
+		b.moveToDeadLetterQueue(delivery, taskProcessor)
 		return errs.NewErrCouldNotUnmarshalTaskSignature(delivery, err)
 	}
 
 	// If the task is not registered, we requeue it,
-	// there might be different workers for processing specific tasks
-	if !b.IsTaskRegistered(signature.Name) {
+	// there might be different workers for processing specific tasks.
+	// Broadcast tasks are left to the worker, which handles control tasks and
+	// drops the others it does not know, other workers received their own copy
+	if !b.IsTaskRegistered(signature.Name) && !signature.Broadcast {
 		if signature.IgnoreWhenTaskNotRegistered {
 			return nil
 		}
 		log.INFO.Printf("Task not registered with this worker. Requeuing message: %s", delivery)
 
-		b.rclient.RPush(context.Background(), getQueueGR(b.GetConfig(), taskProcessor), delivery)
+		queue := taskQueue(b.GetConfig(), getQueueGR(b.GetConfig(), taskProcessor), signature.Priority)
+		b.rclient.RPush(context.Background(), queue, delivery)
 		return nil
 	}
 
@@ -320,9 +497,86 @@ func (b *BrokerGR) consumeOne(delivery []byte, taskProcessor iface.TaskProcessor
 	return taskProcessor.Process(signature)
 }
 
-// nextTask pops next available task from the default queue
-func (b *BrokerGR) nextTask(queue string) (result []byte, err error) {
+// consumeBroadcasts registers the broadcast queue of the worker and processes
+// the broadcast tasks pushed to it one by one until consuming stops or Redis
+// fails. Tasks pushed in the meantime stay on the queue.
+func (b *BrokerGR) consumeBroadcasts(queue string, taskProcessor iface.TaskProcessor) error {
+	if err := b.registerBroadcastQueue(queue); err != nil {
+		return err
+	}
+
+	// The registration is refreshed while broadcast tasks are processed
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(broadcastRegistrationInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := b.registerBroadcastQueue(queue); err != nil {
+					log.ERROR.Printf("Failed to register broadcast queue: %s", err)
+				}
+			}
+		}
+	}()
+
+	for {
+		select {
+		// A way to stop this goroutine from b.StopConsuming
+		case <-b.GetStopChan():
+			return nil
+		default:
+		}
 
+		items, err := b.rclient.BLPop(context.Background(), b.normalTasksPollPeriod(), queue).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// items[0] - the name of the key where an element was popped
+		// items[1] - the value of the popped element
+		if len(items) != 2 {
+			continue
+		}
+		if err := b.consumeOne([]byte(items[1]), taskProcessor); err != nil {
+			log.ERROR.Printf("Failed to process broadcast task: %s", err)
+		}
+	}
+}
+
+// registerBroadcastQueue adds the broadcast queue to the registry of the
+// queues broadcast tasks are pushed to, or refreshes its registration
+func (b *BrokerGR) registerBroadcastQueue(queue string) error {
+	ctx := context.Background()
+	_, err := b.rclient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZAdd(ctx, broadcastRegistry(b.GetConfig()), &redis.Z{Score: float64(time.Now().UnixMilli()), Member: queue})
+		pipe.PExpire(ctx, queue, broadcastQueueTTL)
+		return nil
+	})
+	return err
+}
+
+// unregisterBroadcastQueue removes the broadcast queue together with its
+// pending tasks once the worker stops
+func (b *BrokerGR) unregisterBroadcastQueue(queue string) error {
+	ctx := context.Background()
+	_, err := b.rclient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.ZRem(ctx, broadcastRegistry(b.GetConfig()), queue)
+		pipe.Del(ctx, queue)
+		return nil
+	})
+	return err
+}
+
+// normalTasksPollPeriod returns how long to wait for a task to be queued
+func (b *BrokerGR) normalTasksPollPeriod() time.Duration {
 	pollPeriodMilliseconds := 1000 // default poll period for normal tasks
 	if b.GetConfig().Redis != nil {
 		configuredPollPeriod := b.GetConfig().Redis.NormalTasksPollPeriod
@@ -330,9 +584,16 @@ func (b *BrokerGR) nextTask(queue string) (result []byte, err error) {
 			pollPeriodMilliseconds = configuredPollPeriod
 		}
 	}
-	pollPeriod := time.Duration(pollPeriodMilliseconds) * time.Millisecond
+	return time.Duration(pollPeriodMilliseconds) * time.Millisecond
+}
 
-	items, err := b.rclient.BLPop(context.Background(), pollPeriod, queue).Result()
+// nextTask pops next available task from the default queue, from its list
+// with the highest priority when priority queues are enabled
+func (b *BrokerGR) nextTask(queue string) (result []byte, err error) {
+	pollPeriod := b.normalTasksPollPeriod()
+
+	// BLPOP pops from the first of the lists which is not empty
+	items, err := b.rclient.BLPop(context.Background(), pollPeriod, consumedQueues(b.GetConfig(), queue)...).Result()
 	if err != nil {
 		return []byte{}, err
 	}
@@ -348,23 +609,10 @@ func (b *BrokerGR) nextTask(queue string) (result []byte, err error) {
 	return result, nil
 }
 
-// nextDelayedTask pops a value from the ZSET key using WATCH/MULTI/EXEC commands.
-func (b *BrokerGR) nextDelayedTask(key string) (result []byte, err error) {
-
-	//pipe := b.rclient.Pipeline()
-	//
-	//defer func() {
-	//	// Return connection to normal state on error.
-	//	// https://redis.io/commands/discard
-	//	if err != nil {
-	//		pipe.Discard()
-	//	}
-	//}()
-
-	var (
-		items []string
-	)
-
+// moveDelayedTasks moves up to delayedTasksBatchSize tasks which are due from
+// the delayed tasks store to their queues. They are pushed one by one as the
+// queues may live on other nodes of a cluster.
+func (b *BrokerGR) moveDelayedTasks() error {
 	pollPeriod := 500 // default poll period for delayed tasks
 	if b.GetConfig().Redis != nil {
 		configuredPollPeriod := b.GetConfig().Redis.DelayedTasksPollPeriod
@@ -375,45 +623,28 @@ func (b *BrokerGR) nextDelayedTask(key string) (result []byte, err error) {
 		}
 	}
 
-	for {
-		// Space out queries to ZSET so we don't bombard redis
-		// server with relentless ZRANGEBYSCOREs
-		time.Sleep(time.Duration(pollPeriod) * time.Millisecond)
-		watchFunc := func(tx *redis.Tx) error {
-
-			now := time.Now().UTC().UnixNano()
-
-			// https://redis.io/commands/zrangebyscore
-			ctx := context.Background()
-			items, err = tx.ZRevRangeByScore(ctx, key, &redis.ZRangeBy{
-				Min: "0", Max: strconv.FormatInt(now, 10), Offset: 0, Count: 1,
-			}).Result()
-			if err != nil {
-				return err
-			}
-			if len(items) != 1 {
-				return redis.Nil
-			}
-
-			// only return the first zrange value if there are no other changes in this key
-			// to make sure a delayed task would only be consumed once
-			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
-				pipe.ZRem(ctx, key, items[0])
-				result = []byte(items[0])
-				return nil
-			})
+	// Space out queries to ZSET so we don't bombard redis
+	// server with relentless ZRANGEBYSCOREs
+	time.Sleep(time.Duration(pollPeriod) * time.Millisecond)
 
-			return err
-		}
+	ctx := context.Background()
+	_, err := delayedtasks.Forward(b.delayedTasks, time.Now().UTC(), delayedTasksBatchSize, func(msg []byte) error {
+		return b.rclient.RPush(ctx, delayedTaskQueue(&b.Broker, msg), msg).Err()
+	})
+	return err
+}
 
-		if err = b.rclient.Watch(context.Background(), watchFunc, key); err != nil {
-			return
-		} else {
-			break
-		}
+// moveToDeadLetterQueue keeps a message which cannot be processed in the dead
+// letter queue of the queue, it is dropped if the queue has none
+func (b *BrokerGR) moveToDeadLetterQueue(delivery []byte, taskProcessor iface.TaskProcessor) {
+	deadLetterQueue := b.GetConfig().GetDeadLetterQueue(getQueueGR(b.GetConfig(), taskProcessor))
+	if deadLetterQueue == "" {
+		return
 	}
 
-	return
+	if err := b.rclient.RPush(context.Background(), deadLetterQueue, delivery).Err(); err != nil {
+		log.ERROR.Printf("Failed to move message to dead letter queue %s: %s", deadLetterQueue, err)
+	}
 }
 
 func getQueueGR(config *config.Config, taskProcessor iface.TaskProcessor) string {
@@ -1,9 +1,7 @@
 package redis
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"math"
 	"runtime"
@@ -13,16 +11,30 @@ import (
 	"github.com/go-redsync/redsync/v4"
 	redsyncredis "github.com/go-redsync/redsync/v4/redis/redigo"
 	"github.com/gomodule/redigo/redis"
+	"github.com/google/uuid"
 
 	"github.com/RichardKnop/machinery/v2/brokers/errs"
 	"github.com/RichardKnop/machinery/v2/brokers/iface"
 	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+	delayedredis "github.com/RichardKnop/machinery/v2/delayedtasks/redis"
 	"github.com/RichardKnop/machinery/v2/log"
 	"github.com/RichardKnop/machinery/v2/tasks"
 )
 
-const defaultRedisDelayedTasksKey = "delayed_tasks"
+const (
+	defaultRedisDelayedTasksKey = "delayed_tasks"
+	// delayedTasksBatchSize is how many due tasks are moved from the delayed
+	// tasks store to their queues at once
+	delayedTasksBatchSize = 100
+	// broadcastQueueTTL is how long the broadcast queue of a worker is kept
+	// after it last refreshed its registration
+	broadcastQueueTTL = time.Minute
+	// broadcastRegistrationInterval is how often consuming workers refresh the
+	// registration of their broadcast queues
+	broadcastRegistrationInterval = 10 * time.Second
+)
 
 // Broker represents a Redis broker
 type Broker struct {
@@ -35,11 +47,14 @@ type Broker struct {
 	consumingWG  sync.WaitGroup // wait group to make sure whole consumption completes
 	processingWG sync.WaitGroup // use wait group to make sure task processing completes
 	delayedWG    sync.WaitGroup
+	broadcastWG  sync.WaitGroup
 	// If set, path to a socket file overrides hostname
 	socketPath           string
 	redsync              *redsync.Redsync
 	redisOnce            sync.Once
 	redisDelayedTasksKey string
+	delayedTasks         delayedtasks.Store
+	broadcastID          string // unique to the broker, identifies its broadcast queues
 }
 
 // New creates new Broker instance
@@ -49,6 +64,7 @@ func New(cnf *config.Config, host, password, socketPath string, db int) iface.Br
 	b.db = db
 	b.password = password
 	b.socketPath = socketPath
+	b.broadcastID = uuid.New().String()
 
 	if cnf.Redis != nil && cnf.Redis.DelayedTasksKey != "" {
 		b.redisDelayedTasksKey = cnf.Redis.DelayedTasksKey
@@ -88,8 +104,13 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 		return b.GetRetry(), errs.ErrConsumerStopped
 	}
 
-	// Channel to which we will push tasks ready for processing by worker
-	deliveries := make(chan []byte, concurrency)
+	// Channel to which we will push tasks ready for processing by worker,
+	// it buffers as many tasks as the worker prefetches
+	prefetch := concurrency
+	if customPrefetch := common.GetCustomPrefetch(taskProcessor); customPrefetch > 0 {
+		prefetch = customPrefetch
+	}
+	deliveries := make(chan []byte, prefetch)
 	pool := make(chan struct{}, concurrency)
 
 	// initialize worker pool with maxWorkers workers
@@ -124,6 +145,13 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 					if len(task) > 0 {
 						deliveries <- task
 					}
+				} else {
+					// The worker does not want to consume, e.g. because it
+					// is paused, ask it again after a poll period
+					select {
+					case <-b.GetStopChan():
+					case <-time.After(b.normalTasksPollPeriod()):
+					}
 				}
 
 				pool <- struct{}{}
@@ -143,21 +171,32 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 			case <-b.GetStopChan():
 				return
 			default:
-				task, err := b.nextDelayedTask(b.redisDelayedTasksKey)
-				if err != nil {
-					continue
+				if err := b.moveDelayedTasks(); err != nil {
+					log.ERROR.Printf("Failed to move delayed tasks: %s", err)
 				}
+			}
+		}
+	}()
 
-				signature := new(tasks.Signature)
-				decoder := json.NewDecoder(bytes.NewReader(task))
-				decoder.UseNumber()
-				if err := decoder.Decode(signature); err != nil {
-					log.ERROR.Print(errs.NewErrCouldNotUnmarshalTaskSignature(task, err))
-				}
+	// A goroutine to process broadcast tasks published to every worker
+	b.broadcastWG.Add(1)
+	go func() {
+		defer b.broadcastWG.Done()
+
+		queue := broadcastQueue(b.GetConfig(), b.broadcastID, consumerTag)
+		for {
+			if err := b.consumeBroadcasts(queue, taskProcessor); err != nil {
+				log.ERROR.Printf("Failed to receive broadcast tasks: %s", err)
+			}
 
-				if err := b.Publish(context.Background(), signature); err != nil {
-					log.ERROR.Print(err)
+			select {
+			// A way to stop this goroutine from b.StopConsuming
+			case <-b.GetStopChan():
+				if err := b.unregisterBroadcastQueue(queue); err != nil {
+					log.ERROR.Printf("Failed to unregister broadcast queue: %s", err)
 				}
+				return
+			case <-time.After(time.Second):
 			}
 		}
 	}()
@@ -177,6 +216,8 @@ func (b *Broker) StopConsuming() {
 	b.Broker.StopConsuming()
 	// Waiting for the delayed tasks goroutine to have stopped
 	b.delayedWG.Wait()
+	// Waiting for the broadcast tasks goroutine to have stopped
+	b.broadcastWG.Wait()
 	// Waiting for consumption to finish
 	b.consumingWG.Wait()
 	// Wait for currently processing tasks to finish as well.
@@ -187,19 +228,108 @@ func (b *Broker) StopConsuming() {
 	}
 }
 
+// HealthCheck pings the Redis server
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	conn := b.open()
+	defer conn.Close()
+
+	_, err := conn.Do("PING")
+	return err
+}
+
 // Publish places a new message on the default queue
 func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
-	// Adjust routing key (this decides which queue the message will be published to)
-	b.Broker.AdjustRoutingKey(signature)
+	command, args, err := b.publishCommand(signature)
+	if err != nil {
+		return err
+	}
+
+	conn := b.open()
+	defer conn.Close()
+
+	_, err = conn.Do(command, args...)
+	return err
+}
+
+// PublishBatch places new messages on their queues in a single MULTI/EXEC
+// transaction, so a group is published with one round trip
+func (b *Broker) PublishBatch(ctx context.Context, signatures []*tasks.Signature) (err error) {
+	conn := b.open()
+	defer conn.Close()
+
+	if err = conn.Send("MULTI"); err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			conn.Do("DISCARD")
+		}
+	}()
 
-	msg, err := json.Marshal(signature)
+	for _, signature := range signatures {
+		command, args, err := b.publishCommand(signature)
+		if err != nil {
+			return err
+		}
+		if err = conn.Send(command, args...); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// PublishBroadcast places a new message on the broadcast queue of every
+// registered worker. Workers which are reconnecting receive it once they
+// consume again, registrations not refreshed within broadcastQueueTTL are
+// removed first.
+func (b *Broker) PublishBroadcast(ctx context.Context, signature *tasks.Signature) error {
+	msg, err := b.MarshalSignature(signature)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return fmt.Errorf("Marshal signature error: %s", err)
 	}
 
 	conn := b.open()
 	defer conn.Close()
 
+	registry := broadcastRegistry(b.GetConfig())
+	expired := time.Now().Add(-broadcastQueueTTL).UnixMilli()
+	if _, err := conn.Do("ZREMRANGEBYSCORE", registry, "-inf", expired); err != nil {
+		return err
+	}
+	queues, err := redis.Strings(conn.Do("ZRANGE", registry, 0, -1))
+	if err != nil || len(queues) == 0 {
+		return err
+	}
+
+	// Queues of workers gone since they registered expire
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	for _, queue := range queues {
+		if err := conn.Send("RPUSH", queue, msg); err != nil {
+			return err
+		}
+		if err := conn.Send("PEXPIRE", queue, broadcastQueueTTL.Milliseconds()); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Do("EXEC")
+	return err
+}
+
+// publishCommand returns the command placing the task on its queue, or in the
+// delayed tasks ZSET when its ETA is in the future
+func (b *Broker) publishCommand(signature *tasks.Signature) (string, []interface{}, error) {
+	// Adjust routing key (this decides which queue the message will be published to)
+	b.Broker.AdjustRoutingKey(signature)
+
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return "", nil, fmt.Errorf("Marshal signature error: %s", err)
+	}
+
 	// Check the ETA signature field, if it is set and it is in the future,
 	// delay the task
 	if signature.ETA != nil {
@@ -207,13 +337,11 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 
 		if signature.ETA.After(now) {
 			score := signature.ETA.UnixNano()
-			_, err = conn.Do("ZADD", b.redisDelayedTasksKey, score, msg)
-			return err
+			return "ZADD", []interface{}{b.redisDelayedTasksKey, score, msg}, nil
 		}
 	}
 
-	_, err = conn.Do("RPUSH", signature.RoutingKey, msg)
-	return err
+	return "RPUSH", []interface{}{taskQueue(b.GetConfig(), signature.RoutingKey, signature.Priority), msg}, nil
 }
 
 // GetPendingTasks returns a slice of task signatures waiting in the queue
@@ -224,38 +352,151 @@ func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
 	if queue == "" {
 		queue = b.GetConfig().DefaultQueue
 	}
-	dataBytes, err := conn.Do("LRANGE", queue, 0, -1)
-	if err != nil {
-		return nil, err
-	}
-	results, err := redis.ByteSlices(dataBytes, err)
-	if err != nil {
-		return nil, err
-	}
 
-	taskSignatures := make([]*tasks.Signature, len(results))
-	for i, result := range results {
-		signature := new(tasks.Signature)
-		decoder := json.NewDecoder(bytes.NewReader(result))
-		decoder.UseNumber()
-		if err := decoder.Decode(signature); err != nil {
+	taskSignatures := make([]*tasks.Signature, 0)
+	for _, list := range consumedQueues(b.GetConfig(), queue) {
+		results, err := redis.ByteSlices(conn.Do("LRANGE", list, 0, -1))
+		if err != nil {
 			return nil, err
 		}
-		taskSignatures[i] = signature
+
+		for _, result := range results {
+			signature := new(tasks.Signature)
+			if err := b.UnmarshalSignature(result, signature); err != nil {
+				return nil, err
+			}
+			taskSignatures = append(taskSignatures, signature)
+		}
 	}
 	return taskSignatures, nil
 }
 
-// GetDelayedTasks returns a slice of task signatures that are scheduled, but not yet in the queue
-func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
+// TakePendingTasks removes the tasks waiting in the queue the filter returns
+// true for and returns them. All waiting tasks are taken when the filter is
+// nil. A task consumed meanwhile is not taken.
+func (b *Broker) TakePendingTasks(queue string, filter func(*tasks.Signature) bool) ([]*tasks.Signature, error) {
 	conn := b.open()
 	defer conn.Close()
 
-	dataBytes, err := conn.Do("ZRANGE", b.redisDelayedTasksKey, 0, -1)
-	if err != nil {
-		return nil, err
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
 	}
-	results, err := redis.ByteSlices(dataBytes, err)
+
+	taken := make([]*tasks.Signature, 0)
+	for _, list := range consumedQueues(b.GetConfig(), queue) {
+		results, err := redis.ByteSlices(conn.Do("LRANGE", list, 0, -1))
+		if err != nil {
+			return taken, err
+		}
+
+		for _, result := range results {
+			signature := new(tasks.Signature)
+			if err := b.UnmarshalSignature(result, signature); err != nil {
+				return taken, err
+			}
+			if filter != nil && !filter(signature) {
+				continue
+			}
+
+			removed, err := redis.Int(conn.Do("LREM", list, 1, result))
+			if err != nil {
+				return taken, err
+			}
+			if removed > 0 {
+				taken = append(taken, signature)
+			}
+		}
+	}
+	return taken, nil
+}
+
+// PurgeQueue drops the tasks waiting in the queue and returns how many were
+// dropped
+func (b *Broker) PurgeQueue(queue string) (int, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	purged := 0
+	for _, list := range consumedQueues(b.GetConfig(), queue) {
+		if err := conn.Send("MULTI"); err != nil {
+			return purged, err
+		}
+		if err := conn.Send("LLEN", list); err != nil {
+			return purged, err
+		}
+		if err := conn.Send("DEL", list); err != nil {
+			return purged, err
+		}
+		replies, err := redis.Values(conn.Do("EXEC"))
+		if err != nil {
+			return purged, err
+		}
+		length, err := redis.Int(replies[0], nil)
+		if err != nil {
+			return purged, err
+		}
+		purged += length
+	}
+	return purged, nil
+}
+
+// MoveMessages moves up to limit tasks waiting in a queue, all of them when
+// limit is not positive, to another queue, from the highest priority. It
+// returns how many were moved. Tasks are moved one at a time, a task which
+// cannot be decoded is put back and stops the move.
+func (b *Broker) MoveMessages(from, to string, limit int) (int, error) {
+	conn := b.open()
+	defer conn.Close()
+
+	if from == "" {
+		from = b.GetConfig().DefaultQueue
+	}
+	if to == "" {
+		to = b.GetConfig().DefaultQueue
+	}
+
+	moved := 0
+	for _, list := range consumedQueues(b.GetConfig(), from) {
+		for limit <= 0 || moved < limit {
+			result, err := redis.Bytes(conn.Do("LPOP", list))
+			if err == redis.ErrNil {
+				break
+			}
+			if err != nil {
+				return moved, err
+			}
+
+			signature := new(tasks.Signature)
+			if err := b.UnmarshalSignature(result, signature); err != nil {
+				conn.Do("LPUSH", list, result)
+				return moved, err
+			}
+			signature.RoutingKey = to
+			msg, err := b.MarshalSignature(signature)
+			if err != nil {
+				conn.Do("LPUSH", list, result)
+				return moved, fmt.Errorf("Marshal signature error: %s", err)
+			}
+
+			if _, err := conn.Do("RPUSH", taskQueue(b.GetConfig(), to, signature.Priority), msg); err != nil {
+				conn.Do("LPUSH", list, result)
+				return moved, err
+			}
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// GetDelayedTasks returns a slice of task signatures that are scheduled, but not yet in the queue
+func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
+	b.init()
+
+	results, err := b.delayedTasks.List()
 	if err != nil {
 		return nil, err
 	}
@@ -263,9 +504,7 @@ func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
 	taskSignatures := make([]*tasks.Signature, len(results))
 	for i, result := range results {
 		signature := new(tasks.Signature)
-		decoder := json.NewDecoder(bytes.NewReader(result))
-		decoder.UseNumber()
-		if err := decoder.Decode(signature); err != nil {
+		if err := b.UnmarshalSignature(result, signature); err != nil {
 			return nil, err
 		}
 		taskSignatures[i] = signature
@@ -327,15 +566,16 @@ func (b *Broker) consume(deliveries <-chan []byte, concurrency int, taskProcesso
 // consumeOne processes a single message using TaskProcessor
 func (b *Broker) consumeOne(delivery []byte, taskProcessor iface.TaskProcessor) error {
 	signature := new(tasks.Signature)
-	decoder := json.NewDecoder(bytes.NewReader(delivery))
-	decoder.UseNumber()
-	if err := decoder.Decode(signature); err != nil {
+	if err := b.UnmarshalSignature(delivery, signature); err != nil {
+		b.moveToDeadLetterQueue(delivery, taskProcessor)
 		return errs.NewErrCouldNotUnmarshalTaskSignature(delivery, err)
 	}
 
 	// If the task is not registered, we requeue it,
-	// there might be different workers for processing specific tasks
-	if !b.IsTaskRegistered(signature.Name) {
+	// there might be different workers for processing specific tasks.
+	// Broadcast tasks are left to the worker, which handles control tasks and
+	// drops the others it does not know, other workers received their own copy
+	if !b.IsTaskRegistered(signature.Name) && !signature.Broadcast {
 		if signature.IgnoreWhenTaskNotRegistered {
 			return nil
 		}
@@ -349,11 +589,103 @@ func (b *Broker) consumeOne(delivery []byte, taskProcessor iface.TaskProcessor)
 	return taskProcessor.Process(signature)
 }
 
-// nextTask pops next available task from the default queue
-func (b *Broker) nextTask(queue string) (result []byte, err error) {
+// consumeBroadcasts registers the broadcast queue of the worker and processes
+// the broadcast tasks pushed to it one by one until consuming stops or Redis
+// fails. Tasks pushed in the meantime stay on the queue.
+func (b *Broker) consumeBroadcasts(queue string, taskProcessor iface.TaskProcessor) error {
+	if err := b.registerBroadcastQueue(queue); err != nil {
+		return err
+	}
+
+	// The registration is refreshed while broadcast tasks are processed
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(broadcastRegistrationInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := b.registerBroadcastQueue(queue); err != nil {
+					log.ERROR.Printf("Failed to register broadcast queue: %s", err)
+				}
+			}
+		}
+	}()
+
+	pollPeriodSeconds := math.Ceil(b.normalTasksPollPeriod().Seconds())
+	for {
+		select {
+		// A way to stop this goroutine from b.StopConsuming
+		case <-b.GetStopChan():
+			return nil
+		default:
+		}
+
+		conn := b.open()
+		items, err := redis.ByteSlices(conn.Do("BLPOP", queue, pollPeriodSeconds))
+		conn.Close()
+		if err == redis.ErrNil {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// items[0] - the name of the key where an element was popped
+		// items[1] - the value of the popped element
+		if len(items) != 2 {
+			continue
+		}
+		if err := b.consumeOne(items[1], taskProcessor); err != nil {
+			log.ERROR.Printf("Failed to process broadcast task: %s", err)
+		}
+	}
+}
+
+// registerBroadcastQueue adds the broadcast queue to the registry of the
+// queues broadcast tasks are pushed to, or refreshes its registration
+func (b *Broker) registerBroadcastQueue(queue string) error {
 	conn := b.open()
 	defer conn.Close()
 
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	if err := conn.Send("ZADD", broadcastRegistry(b.GetConfig()), time.Now().UnixMilli(), queue); err != nil {
+		return err
+	}
+	if err := conn.Send("PEXPIRE", queue, broadcastQueueTTL.Milliseconds()); err != nil {
+		return err
+	}
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// unregisterBroadcastQueue removes the broadcast queue together with its
+// pending tasks once the worker stops
+func (b *Broker) unregisterBroadcastQueue(queue string) error {
+	conn := b.open()
+	defer conn.Close()
+
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	if err := conn.Send("ZREM", broadcastRegistry(b.GetConfig()), queue); err != nil {
+		return err
+	}
+	if err := conn.Send("DEL", queue); err != nil {
+		return err
+	}
+	_, err := conn.Do("EXEC")
+	return err
+}
+
+// normalTasksPollPeriod returns how long to wait for a task to be queued
+func (b *Broker) normalTasksPollPeriod() time.Duration {
 	pollPeriodMilliseconds := 1000 // default poll period for normal tasks
 	if b.GetConfig().Redis != nil {
 		configuredPollPeriod := b.GetConfig().Redis.NormalTasksPollPeriod
@@ -361,7 +693,16 @@ func (b *Broker) nextTask(queue string) (result []byte, err error) {
 			pollPeriodMilliseconds = configuredPollPeriod
 		}
 	}
-	pollPeriod := time.Duration(pollPeriodMilliseconds) * time.Millisecond
+	return time.Duration(pollPeriodMilliseconds) * time.Millisecond
+}
+
+// nextTask pops next available task from the default queue, from its list
+// with the highest priority when priority queues are enabled
+func (b *Broker) nextTask(queue string) (result []byte, err error) {
+	conn := b.open()
+	defer conn.Close()
+
+	pollPeriod := b.normalTasksPollPeriod()
 
 	// Issue 548: BLPOP expects an integer timeout expresses in seconds.
 	// The call will if the value is a float. Convert to integer using
@@ -370,7 +711,9 @@ func (b *Broker) nextTask(queue string) (result []byte, err error) {
 	//   math.Ceil(0.2) --> 1 (timeout after 1 second)
 	pollPeriodSeconds := math.Ceil(pollPeriod.Seconds())
 
-	items, err := redis.ByteSlices(conn.Do("BLPOP", queue, pollPeriodSeconds))
+	// BLPOP pops from the first of the lists which is not empty
+	args := redis.Args{}.AddFlat(consumedQueues(b.GetConfig(), queue)).Add(pollPeriodSeconds)
+	items, err := redis.ByteSlices(conn.Do("BLPOP", args...))
 	if err != nil {
 		return []byte{}, err
 	}
@@ -386,28 +729,9 @@ func (b *Broker) nextTask(queue string) (result []byte, err error) {
 	return result, nil
 }
 
-// nextDelayedTask pops a value from the ZSET key using WATCH/MULTI/EXEC commands.
-// https://github.com/gomodule/redigo/blob/master/redis/zpop_example_test.go
-func (b *Broker) nextDelayedTask(key string) (result []byte, err error) {
-	conn := b.open()
-	defer conn.Close()
-
-	defer func() {
-		// Return connection to normal state on error.
-		// https://redis.io/commands/discard
-		// https://redis.io/commands/unwatch
-		if err == redis.ErrNil {
-			conn.Do("UNWATCH")
-		} else if err != nil {
-			conn.Do("DISCARD")
-		}
-	}()
-
-	var (
-		items [][]byte
-		reply interface{}
-	)
-
+// moveDelayedTasks moves up to delayedTasksBatchSize tasks which are due from
+// the delayed tasks store to their queues
+func (b *Broker) moveDelayedTasks() error {
 	pollPeriod := 500 // default poll period for delayed tasks
 	if b.GetConfig().Redis != nil {
 		configuredPollPeriod := b.GetConfig().Redis.DelayedTasksPollPeriod
@@ -418,57 +742,33 @@ func (b *Broker) nextDelayedTask(key string) (result []byte, err error) {
 		}
 	}
 
-	for {
-		// Space out queries to ZSET so we don't bombard redis
-		// server with relentless ZRANGEBYSCOREs
-		time.Sleep(time.Duration(pollPeriod) * time.Millisecond)
-		if _, err = conn.Do("WATCH", key); err != nil {
-			return
-		}
-
-		now := time.Now().UTC().UnixNano()
-
-		// https://redis.io/commands/zrangebyscore
-		items, err = redis.ByteSlices(conn.Do(
-			"ZRANGEBYSCORE",
-			key,
-			0,
-			now,
-			"LIMIT",
-			0,
-			1,
-		))
-		if err != nil {
-			return
-		}
-		if len(items) != 1 {
-			err = redis.ErrNil
-			return
-		}
+	// Space out queries to ZSET so we don't bombard redis
+	// server with relentless ZRANGEBYSCOREs
+	time.Sleep(time.Duration(pollPeriod) * time.Millisecond)
 
-		_ = conn.Send("MULTI")
-		_ = conn.Send("ZREM", key, items[0])
-		reply, err = conn.Do("EXEC")
-		if err != nil {
-			return
-		}
-
-		if reply != nil {
-			result = items[0]
-			break
-		}
-	}
+	b.init()
+	_, err := delayedtasks.Forward(b.delayedTasks, time.Now().UTC(), delayedTasksBatchSize, func(msg []byte) error {
+		conn := b.open()
+		defer conn.Close()
 
-	return
+		_, err := conn.Do("RPUSH", delayedTaskQueue(&b.Broker, msg), msg)
+		return err
+	})
+	return err
 }
 
-// open returns or creates instance of Redis connection
-func (b *Broker) open() redis.Conn {
+// init creates the connection pool and what depends on it on first use
+func (b *Broker) init() {
 	b.redisOnce.Do(func() {
-		b.pool = b.NewPool(b.socketPath, b.host, b.password, b.db, b.GetConfig().Redis, b.GetConfig().TLSConfig)
+		b.pool = b.NewPool(b.socketPath, b.host, b.password, b.db, b.GetConfig().Redis, common.RedisBrokerTLSConfig(b.GetConfig()))
 		b.redsync = redsync.New(redsyncredis.NewPool(b.pool))
+		b.delayedTasks = delayedredis.NewRedigo(b.pool, b.redisDelayedTasksKey, delayedredis.DefaultAckTimeout)
 	})
+}
 
+// open returns or creates instance of Redis connection
+func (b *Broker) open() redis.Conn {
+	b.init()
 	return b.pool.Get()
 }
 
@@ -480,8 +780,77 @@ func getQueue(config *config.Config, taskProcessor iface.TaskProcessor) string {
 	return customQueue
 }
 
+// delayedTaskQueue returns the queue a delayed task is moved to when it is due,
+// a task which cannot be decoded goes to the default queue where it is handled
+// like any other message which cannot be decoded
+func delayedTaskQueue(broker *common.Broker, task []byte) string {
+	cnf := broker.GetConfig()
+	signature := new(tasks.Signature)
+	if err := broker.UnmarshalSignature(task, signature); err != nil {
+		log.ERROR.Print(errs.NewErrCouldNotUnmarshalTaskSignature(task, err))
+		return cnf.DefaultQueue
+	}
+
+	if signature.RoutingKey == "" {
+		return cnf.DefaultQueue
+	}
+	return taskQueue(cnf, signature.RoutingKey, signature.Priority)
+}
+
+// taskQueue returns the list tasks of the queue with the priority are pushed
+// to, the queue itself unless priority queues are enabled
+func taskQueue(cnf *config.Config, queue string, priority uint8) string {
+	if cnf.Redis == nil || !cnf.Redis.PriorityQueues {
+		return queue
+	}
+	return tasks.PriorityQueue(queue, priority)
+}
+
+// broadcastRegistry returns the sorted set of the broadcast queues of the
+// workers scored by when they registered, the default queue with the
+// "_broadcast" suffix
+func broadcastRegistry(cnf *config.Config) string {
+	return cnf.DefaultQueue + "_broadcast"
+}
+
+// broadcastQueue returns the list broadcast tasks are pushed to for the
+// worker consuming with the consumer tag from the broker
+func broadcastQueue(cnf *config.Config, brokerID, consumerTag string) string {
+	return fmt.Sprintf("%s:%s:%s", broadcastRegistry(cnf), brokerID, consumerTag)
+}
+
+// consumedQueues returns the lists tasks of the queue are popped from, from
+// the highest priority
+func consumedQueues(cnf *config.Config, queue string) []string {
+	if cnf.Redis == nil || !cnf.Redis.PriorityQueues {
+		return []string{queue}
+	}
+	return tasks.PriorityQueues(queue)
+}
+
 func (b *Broker) requeueMessage(delivery []byte, taskProcessor iface.TaskProcessor) {
+	queue := getQueue(b.GetConfig(), taskProcessor)
+	signature := new(tasks.Signature)
+	if err := b.UnmarshalSignature(delivery, signature); err == nil {
+		queue = taskQueue(b.GetConfig(), queue, signature.Priority)
+	}
+
 	conn := b.open()
 	defer conn.Close()
-	conn.Do("RPUSH", getQueue(b.GetConfig(), taskProcessor), delivery)
+	conn.Do("RPUSH", queue, delivery)
+}
+
+// moveToDeadLetterQueue keeps a message which cannot be processed in the dead
+// letter queue of the queue, it is dropped if the queue has none
+func (b *Broker) moveToDeadLetterQueue(delivery []byte, taskProcessor iface.TaskProcessor) {
+	deadLetterQueue := b.GetConfig().GetDeadLetterQueue(getQueue(b.GetConfig(), taskProcessor))
+	if deadLetterQueue == "" {
+		return
+	}
+
+	conn := b.open()
+	defer conn.Close()
+	if _, err := conn.Do("RPUSH", deadLetterQueue, delivery); err != nil {
+		log.ERROR.Printf("Failed to move message to dead letter queue %s: %s", deadLetterQueue, err)
+	}
 }
@@ -0,0 +1,604 @@
+package redisstream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/brokers/iface"
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const (
+	defaultConsumerGroup   = "machinery"
+	defaultDelayedTasksKey = "delayed_stream_tasks"
+	defaultClaimMinIdle    = 300 // seconds
+	signatureField         = "signature"
+)
+
+// Broker represents a Redis Streams broker. Unlike the list based Redis broker,
+// messages stay in the consumer group's pending entries list until the task
+// has been processed, so tasks of a crashed worker are reclaimed by other workers.
+type Broker struct {
+	common.Broker
+	rclient         redis.UniversalClient
+	consumingWG     sync.WaitGroup // wait group to make sure whole consumption completes
+	processingWG    sync.WaitGroup // use wait group to make sure task processing completes
+	delayedWG       sync.WaitGroup
+	delayedTasksKey string
+	running         map[string]struct{} // IDs of messages being processed by this consumer
+	runningMu       sync.Mutex
+}
+
+// New creates new Broker instance
+func New(cnf *config.Config, addrs []string, db int) iface.Broker {
+	b := &Broker{Broker: common.NewBroker(cnf), running: make(map[string]struct{})}
+
+	var password string
+	parts := strings.Split(addrs[0], "@")
+	if len(parts) >= 2 {
+		// with password
+		password = strings.Join(parts[:len(parts)-1], "@")
+		addrs[0] = parts[len(parts)-1] // addr is the last one without @
+	}
+
+	ropt := &redis.UniversalOptions{
+		Addrs:     addrs,
+		DB:        db,
+		Password:  password,
+		TLSConfig: common.RedisBrokerTLSConfig(cnf),
+	}
+	if cnf.Redis != nil {
+		ropt.MasterName = cnf.Redis.MasterName
+	}
+
+	b.rclient = redis.NewUniversalClient(ropt)
+	if cnf.Redis != nil && cnf.Redis.DelayedTasksKey != "" {
+		b.delayedTasksKey = cnf.Redis.DelayedTasksKey
+	} else {
+		b.delayedTasksKey = defaultDelayedTasksKey
+	}
+	return b
+}
+
+// StartConsuming enters a loop and waits for incoming messages
+func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) (bool, error) {
+	b.consumingWG.Add(1)
+	defer b.consumingWG.Done()
+
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU() * 2
+	}
+
+	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
+
+	stream := getQueue(b.GetConfig(), taskProcessor)
+	consumer := consumerName(consumerTag)
+
+	// Create the consumer group (and the stream) to make sure connection is live
+	if err := b.createGroup(stream); err != nil {
+		b.GetRetryFunc()(b.GetRetryStopChan())
+
+		// Return err if retry is still true.
+		// If retry is false, broker.StopConsuming() has been called and
+		// therefore Redis might have been stopped. Return nil exit
+		// StartConsuming()
+		if b.GetRetry() {
+			return b.GetRetry(), err
+		}
+		return b.GetRetry(), errs.ErrConsumerStopped
+	}
+
+	// Channel to which we will push tasks ready for processing by worker
+	deliveries := make(chan redis.XMessage, concurrency)
+	pool := make(chan struct{}, concurrency)
+
+	// initialize worker pool with maxWorkers workers
+	for i := 0; i < concurrency; i++ {
+		pool <- struct{}{}
+	}
+
+	// A receiving goroutine keeps reading new messages of the consumer group
+	// with XREADGROUP and sends them to the deliveries channel
+	go func() {
+
+		log.INFO.Print("[*] Waiting for messages. To exit press CTRL+C")
+
+		for {
+			select {
+			// A way to stop this goroutine from b.StopConsuming
+			case <-b.GetStopChan():
+				return
+			case <-pool:
+				messages, _ := b.nextMessages(stream, consumer, 1)
+				for _, message := range messages {
+					select {
+					case deliveries <- message:
+					case <-b.GetStopChan():
+						return
+					}
+				}
+
+				pool <- struct{}{}
+			}
+		}
+	}()
+
+	// A goroutine to watch for delayed tasks and add them to the stream
+	// once they are due
+	b.delayedWG.Add(1)
+	go func() {
+		defer b.delayedWG.Done()
+
+		for {
+			select {
+			// A way to stop this goroutine from b.StopConsuming
+			case <-b.GetStopChan():
+				return
+			default:
+				task, err := b.nextDelayedTask(b.delayedTasksKey)
+				if err != nil {
+					continue
+				}
+
+				signature, err := b.decodeSignature(task)
+				if err != nil {
+					log.ERROR.Print(errs.NewErrCouldNotUnmarshalTaskSignature(task, err))
+					continue
+				}
+
+				if err := b.Publish(context.Background(), signature); err != nil {
+					log.ERROR.Print(err)
+				}
+			}
+		}
+	}()
+
+	// A goroutine to reclaim messages which were delivered to a consumer that
+	// died before acknowledging them. Messages still being processed by this
+	// consumer are claimed again first, which resets their idle time so tasks
+	// running for longer than the min idle time are not reclaimed
+	b.delayedWG.Add(1)
+	go func() {
+		defer b.delayedWG.Done()
+
+		minIdle := b.claimMinIdle()
+		ticker := time.NewTicker(claimPeriod(minIdle))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-b.GetStopChan():
+				return
+			case <-ticker.C:
+				if err := b.refreshRunning(stream, consumer); err != nil {
+					log.ERROR.Printf("Failed to refresh running messages of stream %s: %s", stream, err)
+				}
+				messages, err := b.claimMessages(stream, consumer, minIdle, int64(concurrency))
+				if err != nil {
+					log.ERROR.Printf("Failed to reclaim pending messages of stream %s: %s", stream, err)
+					continue
+				}
+				for _, message := range messages {
+					log.WARNING.Printf("Reclaimed message %s idle for more than %s", message.ID, minIdle)
+					select {
+					case deliveries <- message:
+					case <-b.GetStopChan():
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	if err := b.consume(deliveries, stream, concurrency, taskProcessor); err != nil {
+		return b.GetRetry(), err
+	}
+
+	// Waiting for any tasks being processed to finish
+	b.processingWG.Wait()
+
+	return b.GetRetry(), nil
+}
+
+// StopConsuming quits the loop
+func (b *Broker) StopConsuming() {
+	b.Broker.StopConsuming()
+	// Waiting for the delayed tasks and reclaiming goroutines to have stopped
+	b.delayedWG.Wait()
+	// Waiting for consumption to finish
+	b.consumingWG.Wait()
+
+	b.rclient.Close()
+}
+
+// HealthCheck pings the Redis server
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	return b.rclient.Ping(ctx).Err()
+}
+
+// Publish adds a new message to the stream pointed to by the routing key
+func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	// Adjust routing key (this decides which stream the message will be added to)
+	b.Broker.AdjustRoutingKey(signature)
+
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return fmt.Errorf("Marshal signature error: %s", err)
+	}
+
+	// Check the ETA signature field, if it is set and it is in the future,
+	// delay the task
+	if signature.ETA != nil {
+		now := time.Now().UTC()
+
+		if signature.ETA.After(now) {
+			score := signature.ETA.UnixNano()
+			return b.rclient.ZAdd(ctx, b.delayedTasksKey, &redis.Z{Score: float64(score), Member: msg}).Err()
+		}
+	}
+
+	return b.rclient.XAdd(ctx, &redis.XAddArgs{
+		Stream: signature.RoutingKey,
+		Values: map[string]interface{}{signatureField: msg},
+	}).Err()
+}
+
+// GetPendingTasks returns a slice of task signatures waiting in the stream,
+// including tasks which have been delivered but not yet acknowledged
+func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	messages, err := b.rclient.XRange(context.Background(), queue, "-", "+").Result()
+	if err != nil {
+		return nil, err
+	}
+
+	taskSignatures := make([]*tasks.Signature, len(messages))
+	for i, message := range messages {
+		signature, err := b.decodeSignature(messageBody(message))
+		if err != nil {
+			return nil, err
+		}
+		taskSignatures[i] = signature
+	}
+	return taskSignatures, nil
+}
+
+// GetDelayedTasks returns a slice of task signatures that are scheduled, but not yet in the stream
+func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
+	results, err := b.rclient.ZRange(context.Background(), b.delayedTasksKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	taskSignatures := make([]*tasks.Signature, len(results))
+	for i, result := range results {
+		signature, err := b.decodeSignature([]byte(result))
+		if err != nil {
+			return nil, err
+		}
+		taskSignatures[i] = signature
+	}
+	return taskSignatures, nil
+}
+
+// consume takes delivered messages from the channel and manages a worker pool
+// to process tasks concurrently
+func (b *Broker) consume(deliveries <-chan redis.XMessage, stream string, concurrency int, taskProcessor iface.TaskProcessor) error {
+	errorsChan := make(chan error, concurrency*2)
+	pool := make(chan struct{}, concurrency)
+
+	// init pool for Worker tasks execution, as many slots as Worker concurrency param
+	go func() {
+		for i := 0; i < concurrency; i++ {
+			pool <- struct{}{}
+		}
+	}()
+
+	for {
+		select {
+		case err := <-errorsChan:
+			return err
+		case d := <-deliveries:
+			b.setRunning(d.ID, true)
+
+			// get execution slot from pool (blocks until one is available)
+			<-pool
+
+			b.processingWG.Add(1)
+
+			// Consume the task inside a goroutine so multiple tasks
+			// can be processed concurrently
+			go func() {
+				if err := b.consumeOne(d, stream, taskProcessor); err != nil {
+					select {
+					case errorsChan <- err:
+					default:
+					}
+				}
+				b.setRunning(d.ID, false)
+
+				b.processingWG.Done()
+
+				// give slot back to pool
+				pool <- struct{}{}
+			}()
+		case <-b.GetStopChan():
+			return nil
+		}
+	}
+}
+
+// consumeOne processes a single message using TaskProcessor and acknowledges
+// it once the task has been processed
+func (b *Broker) consumeOne(delivery redis.XMessage, stream string, taskProcessor iface.TaskProcessor) error {
+	body := messageBody(delivery)
+	signature, err := b.decodeSignature(body)
+	if err != nil {
+		// A malformed message will never be processed, drop it
+		b.ack(stream, delivery.ID)
+		return errs.NewErrCouldNotUnmarshalTaskSignature(body, err)
+	}
+
+	// If the task is not registered, we requeue it,
+	// there might be different workers for processing specific tasks
+	if !b.IsTaskRegistered(signature.Name) {
+		if !signature.IgnoreWhenTaskNotRegistered {
+			log.INFO.Printf("Task not registered with this worker. Requeuing message: %s", body)
+
+			if err := b.rclient.XAdd(context.Background(), &redis.XAddArgs{
+				Stream: stream,
+				Values: map[string]interface{}{signatureField: body},
+			}).Err(); err != nil {
+				return err
+			}
+		}
+		return b.ack(stream, delivery.ID)
+	}
+
+	log.DEBUG.Printf("Received new message: %s", body)
+
+	if err := taskProcessor.Process(signature); err != nil {
+		// Leave the message pending, it is reclaimed and processed again
+		// once it has been idle for long enough
+		if err == errs.ErrStopTaskDeletion {
+			return nil
+		}
+		return err
+	}
+
+	return b.ack(stream, delivery.ID)
+}
+
+// ack acknowledges the message and removes it from the stream
+func (b *Broker) ack(stream, id string) error {
+	ctx := context.Background()
+	_, err := b.rclient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAck(ctx, stream, b.consumerGroup(), id)
+		pipe.XDel(ctx, stream, id)
+		return nil
+	})
+	return err
+}
+
+// createGroup creates the consumer group reading the stream from the beginning,
+// the stream itself is created if it does not exist yet
+func (b *Broker) createGroup(stream string) error {
+	err := b.rclient.XGroupCreateMkStream(context.Background(), stream, b.consumerGroup(), "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// nextMessages reads new messages delivered to this consumer
+func (b *Broker) nextMessages(stream, consumer string, count int64) ([]redis.XMessage, error) {
+	pollPeriodMilliseconds := 1000 // default poll period for normal tasks
+	if b.GetConfig().Redis != nil {
+		configuredPollPeriod := b.GetConfig().Redis.NormalTasksPollPeriod
+		if configuredPollPeriod > 0 {
+			pollPeriodMilliseconds = configuredPollPeriod
+		}
+	}
+
+	streams, err := b.rclient.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+		Group:    b.consumerGroup(),
+		Consumer: consumer,
+		Streams:  []string{stream, ">"},
+		Count:    count,
+		Block:    time.Duration(pollPeriodMilliseconds) * time.Millisecond,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []redis.XMessage
+	for _, s := range streams {
+		messages = append(messages, s.Messages...)
+	}
+	return messages, nil
+}
+
+// claimMessages transfers ownership of messages pending for longer than
+// minIdle to this consumer. XPENDING and XCLAIM are used instead of XAUTOCLAIM,
+// whose reply changed in Redis 7
+func (b *Broker) claimMessages(stream, consumer string, minIdle time.Duration, count int64) ([]redis.XMessage, error) {
+	ctx := context.Background()
+	pending, err := b.rclient.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: stream,
+		Group:  b.consumerGroup(),
+		Idle:   minIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  count,
+	}).Result()
+	if err != nil || len(pending) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+	}
+
+	// XCLAIM checks the idle time again, so a message refreshed or claimed
+	// by another consumer in the meantime is left alone
+	return b.rclient.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    b.consumerGroup(),
+		Consumer: consumer,
+		MinIdle:  minIdle,
+		Messages: ids,
+	}).Result()
+}
+
+// setRunning marks a delivered message as being processed by this consumer,
+// or unmarks it once processing has finished
+func (b *Broker) setRunning(id string, running bool) {
+	b.runningMu.Lock()
+	defer b.runningMu.Unlock()
+	if running {
+		b.running[id] = struct{}{}
+	} else {
+		delete(b.running, id)
+	}
+}
+
+// refreshRunning claims the messages being processed by this consumer again
+// with XCLAIM JUSTID, which resets their idle time without delivering them
+func (b *Broker) refreshRunning(stream, consumer string) error {
+	b.runningMu.Lock()
+	ids := make([]string, 0, len(b.running))
+	for id := range b.running {
+		ids = append(ids, id)
+	}
+	b.runningMu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+	return b.rclient.XClaimJustID(context.Background(), &redis.XClaimArgs{
+		Stream:   stream,
+		Group:    b.consumerGroup(),
+		Consumer: consumer,
+		MinIdle:  0,
+		Messages: ids,
+	}).Err()
+}
+
+// nextDelayedTask pops a due value from the ZSET key using WATCH/MULTI/EXEC commands.
+func (b *Broker) nextDelayedTask(key string) (result []byte, err error) {
+	pollPeriod := 500 // default poll period for delayed tasks
+	if b.GetConfig().Redis != nil {
+		configuredPollPeriod := b.GetConfig().Redis.DelayedTasksPollPeriod
+		if configuredPollPeriod > 0 {
+			pollPeriod = configuredPollPeriod
+		}
+	}
+
+	// Space out queries to ZSET so we don't bombard redis
+	// server with relentless ZRANGEBYSCOREs
+	time.Sleep(time.Duration(pollPeriod) * time.Millisecond)
+
+	watchFunc := func(tx *redis.Tx) error {
+		now := time.Now().UTC().UnixNano()
+
+		ctx := context.Background()
+		items, err := tx.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+			Min: "0", Max: strconv.FormatInt(now, 10), Offset: 0, Count: 1,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		if len(items) != 1 {
+			return redis.Nil
+		}
+
+		// only return the first zrange value if there are no other changes in this key
+		// to make sure a delayed task would only be consumed once
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, key, items[0])
+			result = []byte(items[0])
+			return nil
+		})
+
+		return err
+	}
+
+	err = b.rclient.Watch(context.Background(), watchFunc, key)
+	return
+}
+
+func (b *Broker) consumerGroup() string {
+	if b.GetConfig().Redis != nil && b.GetConfig().Redis.StreamConsumerGroup != "" {
+		return b.GetConfig().Redis.StreamConsumerGroup
+	}
+	return defaultConsumerGroup
+}
+
+func (b *Broker) claimMinIdle() time.Duration {
+	minIdle := defaultClaimMinIdle
+	if b.GetConfig().Redis != nil && b.GetConfig().Redis.StreamClaimMinIdle > 0 {
+		minIdle = b.GetConfig().Redis.StreamClaimMinIdle
+	}
+	return time.Duration(minIdle) * time.Second
+}
+
+// claimPeriod returns how often pending messages are checked for reclaiming
+func claimPeriod(minIdle time.Duration) time.Duration {
+	period := minIdle / 2
+	if period < time.Second {
+		period = time.Second
+	}
+	return period
+}
+
+// consumerName returns a consumer name unique within the consumer group,
+// falling back to hostname and pid when no consumer tag is given
+func consumerName(consumerTag string) string {
+	if consumerTag != "" {
+		return consumerTag
+	}
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+func messageBody(message redis.XMessage) []byte {
+	switch v := message.Values[signatureField].(type) {
+	case string:
+		return []byte(v)
+	case []byte:
+		return v
+	}
+	return nil
+}
+
+func (b *Broker) decodeSignature(body []byte) (*tasks.Signature, error) {
+	signature := new(tasks.Signature)
+	if err := b.UnmarshalSignature(body, signature); err != nil {
+		return nil, err
+	}
+	return signature, nil
+}
+
+func getQueue(config *config.Config, taskProcessor iface.TaskProcessor) string {
+	customQueue := taskProcessor.CustomQueue()
+	if customQueue == "" {
+		return config.DefaultQueue
+	}
+	return customQueue
+}
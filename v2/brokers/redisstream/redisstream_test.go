@@ -0,0 +1,88 @@
+package redisstream
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+func TestClaimPeriod(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 150*time.Second, claimPeriod(300*time.Second))
+	assert.Equal(t, time.Second, claimPeriod(time.Second))
+}
+
+func TestConsumerName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "worker-1", consumerName("worker-1"))
+	assert.NotEmpty(t, consumerName(""))
+}
+
+func TestMessageBody(t *testing.T) {
+	t.Parallel()
+
+	body := `{"UUID":"foo","Name":"add"}`
+	message := redis.XMessage{ID: "1-0", Values: map[string]interface{}{signatureField: body}}
+	assert.Equal(t, []byte(body), messageBody(message))
+
+	b := &Broker{Broker: common.NewBroker(new(config.Config))}
+	signature, err := b.decodeSignature(messageBody(message))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "foo", signature.UUID)
+		assert.Equal(t, "add", signature.Name)
+	}
+
+	assert.Nil(t, messageBody(redis.XMessage{ID: "2-0"}))
+}
+
+func TestRefreshRunning(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	stream := "test_refresh_running"
+	b := New(&config.Config{DefaultQueue: stream}, []string{redisURL}, 0).(*Broker)
+	ctx := context.Background()
+	b.rclient.Del(ctx, stream)
+	defer b.rclient.Del(ctx, stream)
+
+	if !assert.NoError(t, b.createGroup(stream)) {
+		return
+	}
+	assert.NoError(t, b.rclient.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{signatureField: `{"UUID":"foo","Name":"add"}`},
+	}).Err())
+
+	messages, err := b.nextMessages(stream, "consumer", 1)
+	if !assert.NoError(t, err) || !assert.Len(t, messages, 1) {
+		return
+	}
+	b.setRunning(messages[0].ID, true)
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// Refreshing the running message resets its idle time, so it is not reclaimed
+	assert.NoError(t, b.refreshRunning(stream, "consumer"))
+	claimed, err := b.claimMessages(stream, "other", time.Second, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed)
+
+	// Once it is no longer running, it goes idle and is reclaimed
+	b.setRunning(messages[0].ID, false)
+	assert.NoError(t, b.refreshRunning(stream, "consumer"))
+	time.Sleep(1100 * time.Millisecond)
+	claimed, err = b.claimMessages(stream, "other", time.Second, 1)
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+}
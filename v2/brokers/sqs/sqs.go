@@ -2,9 +2,8 @@ package sqs
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,27 +14,50 @@ import (
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
 	"github.com/RichardKnop/machinery/v2/tasks"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 
-	awssqs "github.com/aws/aws-sdk-go/service/sqs"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
 const (
 	maxAWSSQSDelay = time.Minute * 15 // Max supported SQS delay is 15 min: https://docs.aws.amazon.com/AWSSimpleQueueService/latest/APIReference/API_SendMessage.html
+	maxAWSSQSBatch = 10               // Max number of messages sent, received or deleted with a single request
+	// deleteBatchInterval is how long a processed message waits for others to be deleted with it
+	deleteBatchInterval = 100 * time.Millisecond
 )
 
+// API is the part of the SQS client used by the broker
+type API interface {
+	SendMessage(ctx context.Context, params *awssqs.SendMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *awssqs.SendMessageBatchInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error)
+	ReceiveMessage(ctx context.Context, params *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *awssqs.DeleteMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, params *awssqs.DeleteMessageBatchInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageBatchOutput, error)
+	GetQueueAttributes(ctx context.Context, params *awssqs.GetQueueAttributesInput, optFns ...func(*awssqs.Options)) (*awssqs.GetQueueAttributesOutput, error)
+	PurgeQueue(ctx context.Context, params *awssqs.PurgeQueueInput, optFns ...func(*awssqs.Options)) (*awssqs.PurgeQueueOutput, error)
+}
+
+// deleteRequest is a processed message waiting to be deleted in a batch
+type deleteRequest struct {
+	qURL          *string
+	receiptHandle *string
+	result        chan error
+}
+
 // Broker represents a AWS SQS broker
-// There are examples on: https://docs.aws.amazon.com/sdk-for-go/v1/developer-guide/sqs-example-create-queue.html
+// There are examples on: https://aws.github.io/aws-sdk-go-v2/docs/code-examples/sqs/
 type Broker struct {
 	common.Broker
 	processingWG      sync.WaitGroup // use wait group to make sure task processing completes on interrupt signal
 	receivingWG       sync.WaitGroup
 	stopReceivingChan chan int
-	sess              *session.Session
-	service           sqsiface.SQSAPI
+	service           API
 	queueUrl          *string
+	queueName         string
+	customPrefetch    int
+	pendingDeletes    []*deleteRequest
+	deletesMutex      sync.Mutex
 }
 
 // New creates new Broker instance
@@ -45,24 +67,50 @@ func New(cnf *config.Config) iface.Broker {
 		// Use provided *SQS client
 		b.service = cnf.SQS.Client
 	} else {
-		// Initialize a session that the SDK will use to load credentials from the shared credentials file, ~/.aws/credentials.
-		// See details on: https://docs.aws.amazon.com/sdk-for-go/v1/developer-guide/configuring-sdk.html
-		// Also, env AWS_REGION is also required
-		b.sess = session.Must(session.NewSessionWithOptions(session.Options{
-			SharedConfigState: session.SharedConfigEnable,
-		}))
-		b.service = awssqs.New(b.sess)
+		b.service = newClient(cnf.SQS)
 	}
 
 	return b
 }
 
+// newClient creates a SQS client, the SDK loads credentials from the environment,
+// the shared credentials file ~/.aws/credentials or a web identity token file.
+// See details on: https://aws.github.io/aws-sdk-go-v2/docs/configuring-sdk/
+func newClient(cnf *config.SQSConfig) *awssqs.Client {
+	var (
+		opts     common.AWSOptions
+		endpoint string
+	)
+	if cnf != nil {
+		opts = common.AWSOptions{
+			Region:               cnf.Region,
+			RoleARN:              cnf.RoleARN,
+			RoleSessionName:      cnf.RoleSessionName,
+			WebIdentityTokenFile: cnf.WebIdentityTokenFile,
+		}
+		endpoint = cnf.Endpoint
+	}
+
+	awsCfg, err := common.NewAWSConfig(context.Background(), opts)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to load AWS config: %s", err))
+	}
+
+	return awssqs.NewFromConfig(awsCfg, func(o *awssqs.Options) {
+		if endpoint != "" {
+			o.EndpointResolver = awssqs.EndpointResolverFromURL(endpoint)
+		}
+	})
+}
+
 // StartConsuming enters a loop and waits for incoming messages
 func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) (bool, error) {
 	b.Broker.StartConsuming(consumerTag, concurrency, taskProcessor)
 	qURL := b.getQueueURL(taskProcessor)
 	//save it so that it can be used later when attempting to delete task
 	b.queueUrl = qURL
+	b.queueName = b.getQueueName(taskProcessor)
+	b.customPrefetch = common.GetCustomPrefetch(taskProcessor)
 
 	deliveries := make(chan *awssqs.ReceiveMessageOutput, concurrency)
 	pool := make(chan struct{}, concurrency)
@@ -86,17 +134,32 @@ func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcess
 				close(deliveries)
 				return
 			case <-pool:
-				output, err := b.receiveMessage(qURL)
-				if err == nil && len(output.Messages) > 0 {
-					deliveries <- output
+				// Receive as many messages at once as there are free workers
+				slots := 1
+			takeSlots:
+				for slots < b.maxNumberOfMessages() {
+					select {
+					case <-pool:
+						slots++
+					default:
+						break takeSlots
+					}
+				}
 
+				received := 0
+				output, err := b.receiveByPriority(qURL, int64(slots))
+				if err != nil {
+					log.ERROR.Printf("Queue consume error: %s", err)
 				} else {
-					//return back to pool right away
-					pool <- struct{}{}
-					if err != nil {
-						log.ERROR.Printf("Queue consume error: %s", err)
+					for _, message := range output.Messages {
+						deliveries <- &awssqs.ReceiveMessageOutput{Messages: []types.Message{message}}
+						received++
 					}
+				}
 
+				//return unused workers back to pool right away
+				for i := received; i < slots; i++ {
+					pool <- struct{}{}
 				}
 			}
 
@@ -123,11 +186,180 @@ func (b *Broker) StopConsuming() {
 	b.receivingWG.Wait()
 }
 
+// HealthCheck checks the attributes of the consumed queue can be read
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	_, err := b.service.GetQueueAttributes(ctx, &awssqs.GetQueueAttributesInput{
+		QueueUrl:       b.defaultQueueURL(),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn},
+	})
+	return err
+}
+
 // Publish places a new message on the default queue
 func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error {
-	msg, err := json.Marshal(signature)
+	MsgInput, err := b.newSendMessageInput(signature)
 	if err != nil {
-		return fmt.Errorf("JSON marshal error: %s", err)
+		return err
+	}
+
+	result, err := b.service.SendMessage(ctx, MsgInput)
+
+	if err != nil {
+		log.ERROR.Printf("Error when sending a message: %v", err)
+		return err
+
+	}
+	log.INFO.Printf("Sending a message successfully, the messageId is %v", *result.MessageId)
+	return nil
+
+}
+
+// PublishBatch places new messages on their queues, sending up to 10 messages per request
+func (b *Broker) PublishBatch(ctx context.Context, signatures []*tasks.Signature) error {
+	var qURLs []string
+	entries := make(map[string][]types.SendMessageBatchRequestEntry)
+
+	for i, signature := range signatures {
+		MsgInput, err := b.newSendMessageInput(signature)
+		if err != nil {
+			return err
+		}
+
+		qURL := *MsgInput.QueueUrl
+		if _, ok := entries[qURL]; !ok {
+			qURLs = append(qURLs, qURL)
+		}
+		entries[qURL] = append(entries[qURL], types.SendMessageBatchRequestEntry{
+			Id:                     aws.String(strconv.Itoa(i)),
+			MessageBody:            MsgInput.MessageBody,
+			MessageDeduplicationId: MsgInput.MessageDeduplicationId,
+			MessageGroupId:         MsgInput.MessageGroupId,
+			DelaySeconds:           MsgInput.DelaySeconds,
+		})
+	}
+
+	for _, qURL := range qURLs {
+		queueEntries := entries[qURL]
+		for len(queueEntries) > 0 {
+			n := len(queueEntries)
+			if n > maxAWSSQSBatch {
+				n = maxAWSSQSBatch
+			}
+
+			result, err := b.service.SendMessageBatch(ctx, &awssqs.SendMessageBatchInput{
+				QueueUrl: aws.String(qURL),
+				Entries:  queueEntries[:n],
+			})
+			if err != nil {
+				log.ERROR.Printf("Error when sending a batch of messages: %v", err)
+				return err
+			}
+			if len(result.Failed) > 0 {
+				return fmt.Errorf("Failed sending %d of %d messages: %s", len(result.Failed), n, aws.ToString(result.Failed[0].Message))
+			}
+			log.INFO.Printf("Sending a batch of %d messages successfully", len(result.Successful))
+
+			queueEntries = queueEntries[n:]
+		}
+	}
+
+	return nil
+}
+
+// PurgeQueue is a method drops the messages of the queue, and of its priority queues when
+// they are enabled. SQS deletes them asynchronously, it returns how many messages the queues
+// approximately had.
+func (b *Broker) PurgeQueue(queue string) (int, error) {
+	if queue == "" {
+		queue = b.GetConfig().DefaultQueue
+	}
+
+	purged := 0
+	for _, qURL := range b.queueURLs(queue) {
+		attributes, err := b.service.GetQueueAttributes(context.Background(), &awssqs.GetQueueAttributesInput{
+			QueueUrl:       qURL,
+			AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+		})
+		if err != nil {
+			return purged, err
+		}
+		if _, err := b.service.PurgeQueue(context.Background(), &awssqs.PurgeQueueInput{QueueUrl: qURL}); err != nil {
+			return purged, err
+		}
+		count, _ := strconv.Atoi(attributes.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+		purged += count
+	}
+	return purged, nil
+}
+
+// MoveMessages is a method moves up to limit messages of a queue, all of them when limit is not
+// positive, to another queue, from the highest priority, and returns how many were moved. A message
+// is deleted once it has been sent to the other queue, messages received but not moved because of
+// an error are received again once their visibility timeout passed.
+func (b *Broker) MoveMessages(from, to string, limit int) (int, error) {
+	if from == "" {
+		from = b.GetConfig().DefaultQueue
+	}
+	if to == "" {
+		to = b.GetConfig().DefaultQueue
+	}
+
+	moved := 0
+	for _, qURL := range b.queueURLs(from) {
+		for limit <= 0 || moved < limit {
+			maxNumberOfMessages := maxAWSSQSBatch
+			if limit > 0 && limit-moved < maxNumberOfMessages {
+				maxNumberOfMessages = limit - moved
+			}
+			output, err := b.receiveMessagesWaiting(qURL, int64(maxNumberOfMessages), 0)
+			if err != nil {
+				return moved, err
+			}
+			if len(output.Messages) == 0 {
+				break
+			}
+
+			for _, message := range output.Messages {
+				signature := new(tasks.Signature)
+				if err := b.UnmarshalSignature([]byte(aws.ToString(message.Body)), signature); err != nil {
+					return moved, errs.NewErrCouldNotUnmarshalTaskSignature([]byte(aws.ToString(message.Body)), err)
+				}
+				signature.RoutingKey = to
+				if err := b.Publish(context.Background(), signature); err != nil {
+					return moved, err
+				}
+				if _, err := b.service.DeleteMessage(context.Background(), &awssqs.DeleteMessageInput{
+					QueueUrl:      qURL,
+					ReceiptHandle: message.ReceiptHandle,
+				}); err != nil {
+					return moved, err
+				}
+				moved++
+			}
+		}
+	}
+	return moved, nil
+}
+
+// queueURLs is a method returns the urls of the queue and of its priority queues when they are
+// enabled, from the highest priority
+func (b *Broker) queueURLs(queue string) []*string {
+	if !b.priorityQueues() {
+		return []*string{aws.String(b.GetConfig().Broker + "/" + queue)}
+	}
+
+	qURLs := make([]*string, 0, 3)
+	for _, priority := range []uint8{tasks.PriorityHigh, tasks.PriorityMedium, tasks.PriorityLow} {
+		qURLs = append(qURLs, aws.String(b.GetConfig().Broker+"/"+b.taskQueue(queue, priority)))
+	}
+	return qURLs
+}
+
+// newSendMessageInput is a method which returns the input for sending the task to AWS SQS
+func (b *Broker) newSendMessageInput(signature *tasks.Signature) (*awssqs.SendMessageInput, error) {
+	msg, err := b.MarshalSignature(signature)
+	if err != nil {
+		return nil, fmt.Errorf("Marshal signature error: %s", err)
 	}
 
 	// Check that signature.RoutingKey is set, if not switch to DefaultQueue
@@ -135,46 +367,32 @@ func (b *Broker) Publish(ctx context.Context, signature *tasks.Signature) error
 
 	MsgInput := &awssqs.SendMessageInput{
 		MessageBody: aws.String(string(msg)),
-		QueueUrl:    aws.String(b.GetConfig().Broker + "/" + signature.RoutingKey),
+		QueueUrl:    aws.String(b.GetConfig().Broker + "/" + b.taskQueue(signature.RoutingKey, signature.Priority)),
 	}
 
 	// if this is a fifo queue, there needs to be some additional parameters.
 	if strings.HasSuffix(signature.RoutingKey, ".fifo") {
-		// Use Machinery's signature Task UUID as SQS Message Group ID.
-		MsgDedupID := signature.UUID
-		MsgInput.MessageDeduplicationId = aws.String(MsgDedupID)
-
-		// Do not Use Machinery's signature Group UUID as SQS Message Group ID, instead use BrokerMessageGroupId
-		MsgGroupID := signature.BrokerMessageGroupId
-		if MsgGroupID == "" {
-			return fmt.Errorf("please specify BrokerMessageGroupId attribute for task Signature when submitting a task to FIFO queue")
-		}
-		MsgInput.MessageGroupId = aws.String(MsgGroupID)
+		MsgInput.MessageDeduplicationId = aws.String(messageDeduplicationID(signature))
+
+		MsgInput.MessageGroupId = aws.String(messageGroupID(signature))
 	}
 
 	// Check the ETA signature field, if it is set and it is in the future,
 	// and is not a fifo queue, set a delay in seconds for the task.
+	// Longer delays than SQS supports are capped, the task is requeued
+	// with the remaining delay when it is received (see requeueDelayed)
 	if signature.ETA != nil && !strings.HasSuffix(signature.RoutingKey, ".fifo") {
 		now := time.Now().UTC()
 		delay := signature.ETA.Sub(now)
+		if delay > maxAWSSQSDelay {
+			delay = maxAWSSQSDelay
+		}
 		if delay > 0 {
-			if delay > maxAWSSQSDelay {
-				return errors.New("Max AWS SQS delay exceeded")
-			}
-			MsgInput.DelaySeconds = aws.Int64(int64(delay.Seconds()))
+			MsgInput.DelaySeconds = int32(delay.Seconds())
 		}
 	}
 
-	result, err := b.service.SendMessageWithContext(ctx, MsgInput)
-
-	if err != nil {
-		log.ERROR.Printf("Error when sending a message: %v", err)
-		return err
-
-	}
-	log.INFO.Printf("Sending a message successfully, the messageId is %v", *result.MessageId)
-	return nil
-
+	return MsgInput, nil
 }
 
 // consume is a method which keeps consuming deliveries from a channel, until there is an error or a stop signal
@@ -197,14 +415,17 @@ func (b *Broker) consume(deliveries <-chan *awssqs.ReceiveMessageOutput, concurr
 func (b *Broker) consumeOne(delivery *awssqs.ReceiveMessageOutput, taskProcessor iface.TaskProcessor) error {
 	if len(delivery.Messages) == 0 {
 		log.ERROR.Printf("received an empty message, the delivery was %v", delivery)
-		return errors.New("received empty message, the delivery is " + delivery.GoString())
+		return fmt.Errorf("received empty message, the delivery is %v", delivery)
 	}
 
 	sig := new(tasks.Signature)
-	decoder := json.NewDecoder(strings.NewReader(*delivery.Messages[0].Body))
-	decoder.UseNumber()
-	if err := decoder.Decode(sig); err != nil {
+	if err := b.UnmarshalSignature([]byte(*delivery.Messages[0].Body), sig); err != nil {
 		log.ERROR.Printf("unmarshal error. the delivery is %v", delivery)
+		// keep the message in the dead letter queue of the queue if it has one
+		if dlqErr := b.moveToDeadLetterQueue(&delivery.Messages[0]); dlqErr != nil {
+			log.ERROR.Printf("error when moving the delivery to the dead letter queue. delivery is %v, Error=%s", delivery, dlqErr)
+			return err
+		}
 		// if the unmarshal fails, remove the delivery from the queue
 		if delErr := b.deleteOne(delivery); delErr != nil {
 			log.ERROR.Printf("error when deleting the delivery. delivery is %v, Error=%s", delivery, delErr)
@@ -224,6 +445,11 @@ func (b *Broker) consumeOne(delivery *awssqs.ReceiveMessageOutput, taskProcessor
 		return fmt.Errorf("task %s is not registered", sig.Name)
 	}
 
+	// A task delayed for longer than SQS supports is sent again with the remaining delay
+	if b.isDelayed(sig) {
+		return b.requeueDelayed(delivery, sig)
+	}
+
 	err := taskProcessor.Process(sig)
 	if err != nil {
 		// stop task deletion in case we want to send messages to dlq in sqs
@@ -239,10 +465,43 @@ func (b *Broker) consumeOne(delivery *awssqs.ReceiveMessageOutput, taskProcessor
 	return err
 }
 
+// isDelayed is a method which returns true if the ETA of a task received
+// from a standard queue is still at least a second away
+func (b *Broker) isDelayed(sig *tasks.Signature) bool {
+	if sig.ETA == nil || strings.HasSuffix(sig.RoutingKey, ".fifo") {
+		return false
+	}
+	return sig.ETA.Sub(time.Now().UTC()) >= time.Second
+}
+
+// requeueDelayed is a method which sends the task to its queue again, delayed until
+// its ETA or by the max supported delay, and deletes the received message
+func (b *Broker) requeueDelayed(delivery *awssqs.ReceiveMessageOutput, sig *tasks.Signature) error {
+	// The receipt handle belongs to the received message, not to the new one
+	sig.SQSReceiptHandle = ""
+
+	log.DEBUG.Printf("Task %s is delayed until %s, requeueing it", sig.UUID, sig.ETA)
+
+	MsgInput, err := b.newSendMessageInput(sig)
+	if err != nil {
+		return err
+	}
+	if _, err := b.service.SendMessage(context.Background(), MsgInput); err != nil {
+		return err
+	}
+	return b.deleteOne(delivery)
+}
+
 // deleteOne is a method delete a delivery from AWS SQS
 func (b *Broker) deleteOne(delivery *awssqs.ReceiveMessageOutput) error {
-	qURL := b.defaultQueueURL()
-	_, err := b.service.DeleteMessage(&awssqs.DeleteMessageInput{
+	qURL := b.deliveryQueueURL(delivery)
+
+	// Messages received in batches are also deleted in batches
+	if b.maxNumberOfMessages() > 1 {
+		return b.deleteBatched(qURL, delivery.Messages[0].ReceiptHandle)
+	}
+
+	_, err := b.service.DeleteMessage(context.Background(), &awssqs.DeleteMessageInput{
 		QueueUrl:      qURL,
 		ReceiptHandle: delivery.Messages[0].ReceiptHandle,
 	})
@@ -253,6 +512,136 @@ func (b *Broker) deleteOne(delivery *awssqs.ReceiveMessageOutput) error {
 	return nil
 }
 
+// deleteBatched is a method which queues the message for deletion and blocks until
+// it has been deleted together with other messages processed in the meantime
+func (b *Broker) deleteBatched(qURL, receiptHandle *string) error {
+	request := &deleteRequest{qURL: qURL, receiptHandle: receiptHandle, result: make(chan error, 1)}
+
+	b.deletesMutex.Lock()
+	b.pendingDeletes = append(b.pendingDeletes, request)
+	switch len(b.pendingDeletes) {
+	case maxAWSSQSBatch:
+		batch := b.pendingDeletes
+		b.pendingDeletes = nil
+		b.deletesMutex.Unlock()
+		b.deleteBatch(batch)
+	case 1:
+		// The first message of a batch schedules the deletion of the whole batch
+		time.AfterFunc(deleteBatchInterval, b.flushDeletes)
+		b.deletesMutex.Unlock()
+	default:
+		b.deletesMutex.Unlock()
+	}
+
+	return <-request.result
+}
+
+// flushDeletes is a method which deletes all messages waiting for deletion
+func (b *Broker) flushDeletes() {
+	b.deletesMutex.Lock()
+	batch := b.pendingDeletes
+	b.pendingDeletes = nil
+	b.deletesMutex.Unlock()
+
+	if len(batch) > 0 {
+		b.deleteBatch(batch)
+	}
+}
+
+// deleteBatch is a method which deletes the messages with DeleteMessageBatch
+// and reports the result to each request
+func (b *Broker) deleteBatch(batch []*deleteRequest) {
+	byQueue := make(map[string][]*deleteRequest)
+	for _, request := range batch {
+		byQueue[*request.qURL] = append(byQueue[*request.qURL], request)
+	}
+
+	for qURL, requests := range byQueue {
+		entries := make([]types.DeleteMessageBatchRequestEntry, len(requests))
+		for i, request := range requests {
+			entries[i] = types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: request.receiptHandle,
+			}
+		}
+
+		output, err := b.service.DeleteMessageBatch(context.Background(), &awssqs.DeleteMessageBatchInput{
+			QueueUrl: aws.String(qURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			for _, request := range requests {
+				request.result <- err
+			}
+			continue
+		}
+
+		failed := make(map[string]error, len(output.Failed))
+		for _, entry := range output.Failed {
+			failed[aws.ToString(entry.Id)] = fmt.Errorf("Failed deleting message: %s", aws.ToString(entry.Message))
+		}
+		for i, request := range requests {
+			request.result <- failed[strconv.Itoa(i)]
+		}
+	}
+}
+
+// maxNumberOfMessages is a method which returns how many messages are received with a single request
+func (b *Broker) maxNumberOfMessages() int {
+	var maxNumberOfMessages int
+	if b.GetConfig().SQS != nil {
+		maxNumberOfMessages = b.GetConfig().SQS.MaxNumberOfMessages
+	}
+	if prefetchCount := b.queueConfig().PrefetchCount; prefetchCount > 0 {
+		maxNumberOfMessages = prefetchCount
+	}
+	if b.customPrefetch > 0 {
+		maxNumberOfMessages = b.customPrefetch
+	}
+
+	if maxNumberOfMessages < 1 {
+		return 1
+	}
+	if maxNumberOfMessages > maxAWSSQSBatch {
+		return maxAWSSQSBatch
+	}
+	return maxNumberOfMessages
+}
+
+// consumedQueue is a method which returns the name of the consumed queue
+func (b *Broker) consumedQueue() string {
+	if b.queueName == "" {
+		return b.GetConfig().DefaultQueue
+	}
+	return b.queueName
+}
+
+// queueConfig is a method which returns the settings of the consumed queue
+func (b *Broker) queueConfig() config.QueueConfig {
+	return b.GetConfig().GetQueueConfig(b.consumedQueue())
+}
+
+// moveToDeadLetterQueue is a method which sends the message to the dead letter queue
+// of the consumed queue, it does nothing when the queue has none
+func (b *Broker) moveToDeadLetterQueue(message *types.Message) error {
+	deadLetterQueue := b.GetConfig().GetDeadLetterQueue(b.consumedQueue())
+	if deadLetterQueue == "" {
+		return nil
+	}
+
+	input := &awssqs.SendMessageInput{
+		MessageBody: message.Body,
+		QueueUrl:    aws.String(b.GetConfig().Broker + "/" + deadLetterQueue),
+	}
+	if strings.HasSuffix(deadLetterQueue, ".fifo") {
+		input.MessageGroupId = aws.String(deadLetterQueue)
+		input.MessageDeduplicationId = message.MessageId
+	}
+
+	_, err := b.service.SendMessage(context.Background(), input)
+	return err
+}
+
 // defaultQueueURL is a method returns the default queue url
 func (b *Broker) defaultQueueURL() *string {
 	if b.queueUrl != nil {
@@ -265,29 +654,64 @@ func (b *Broker) defaultQueueURL() *string {
 
 // receiveMessage is a method receives a message from specified queue url
 func (b *Broker) receiveMessage(qURL *string) (*awssqs.ReceiveMessageOutput, error) {
+	return b.receiveMessages(qURL, 1)
+}
+
+// receiveMessages is a method receives up to maxNumberOfMessages messages from specified queue url
+func (b *Broker) receiveMessages(qURL *string, maxNumberOfMessages int64) (*awssqs.ReceiveMessageOutput, error) {
 	var waitTimeSeconds int
-	var visibilityTimeout *int
 	if b.GetConfig().SQS != nil {
 		waitTimeSeconds = b.GetConfig().SQS.WaitTimeSeconds
+	}
+	return b.receiveMessagesWaiting(qURL, maxNumberOfMessages, waitTimeSeconds)
+}
+
+// receiveByPriority is a method receives up to maxNumberOfMessages messages from the
+// queue with the highest priority which has any when priority queues are enabled,
+// only the queue itself is long polled
+func (b *Broker) receiveByPriority(qURL *string, maxNumberOfMessages int64) (*awssqs.ReceiveMessageOutput, error) {
+	if !b.priorityQueues() {
+		return b.receiveMessages(qURL, maxNumberOfMessages)
+	}
+
+	for _, priority := range []uint8{tasks.PriorityHigh, tasks.PriorityMedium} {
+		priorityURL := aws.String(b.GetConfig().Broker + "/" + b.taskQueue(b.consumedQueue(), priority))
+		output, err := b.receiveMessagesWaiting(priorityURL, maxNumberOfMessages, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(output.Messages) > 0 {
+			return output, nil
+		}
+	}
+	return b.receiveMessages(qURL, maxNumberOfMessages)
+}
+
+// receiveMessagesWaiting is a method receives up to maxNumberOfMessages messages from
+// specified queue url, waiting for them up to waitTimeSeconds
+func (b *Broker) receiveMessagesWaiting(qURL *string, maxNumberOfMessages int64, waitTimeSeconds int) (*awssqs.ReceiveMessageOutput, error) {
+	var visibilityTimeout *int
+	if b.GetConfig().SQS != nil {
 		visibilityTimeout = b.GetConfig().SQS.VisibilityTimeout
-	} else {
-		waitTimeSeconds = 0
 	}
 	input := &awssqs.ReceiveMessageInput{
-		AttributeNames: []*string{
-			aws.String(awssqs.MessageSystemAttributeNameSentTimestamp),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeName(types.MessageSystemAttributeNameSentTimestamp),
 		},
-		MessageAttributeNames: []*string{
-			aws.String(awssqs.QueueAttributeNameAll),
+		MessageAttributeNames: []string{
+			string(types.QueueAttributeNameAll),
 		},
 		QueueUrl:            qURL,
-		MaxNumberOfMessages: aws.Int64(1),
-		WaitTimeSeconds:     aws.Int64(int64(waitTimeSeconds)),
+		MaxNumberOfMessages: int32(maxNumberOfMessages),
+		WaitTimeSeconds:     int32(waitTimeSeconds),
+	}
+	if queueVisibilityTimeout := b.queueConfig().VisibilityTimeout; queueVisibilityTimeout != nil {
+		visibilityTimeout = queueVisibilityTimeout
 	}
 	if visibilityTimeout != nil {
-		input.VisibilityTimeout = aws.Int64(int64(*visibilityTimeout))
+		input.VisibilityTimeout = int32(*visibilityTimeout)
 	}
-	result, err := b.service.ReceiveMessage(input)
+	result, err := b.service.ReceiveMessage(context.Background(), input)
 	if err != nil {
 		return nil, err
 	}
@@ -356,13 +780,68 @@ func (b *Broker) stopReceiving() {
 	b.stopReceivingChan <- 1
 }
 
+// messageGroupID returns the SQS Message Group ID for FIFO queues, messages sharing
+// the same group are delivered in order. BrokerMessageGroupId takes precedence,
+// tasks of a group are kept together, other tasks are ordered per queue.
+// messageDeduplicationID returns the deduplication ID of the task in FIFO
+// queues, the task UUID followed by the retry attempt. FIFO queues ignore the
+// ETA of retries, which would otherwise be dropped as duplicates of the task
+// within the deduplication interval of 5 minutes.
+func messageDeduplicationID(signature *tasks.Signature) string {
+	return fmt.Sprintf("%s-%d", signature.UUID, signature.RetryAttempt)
+}
+
+func messageGroupID(signature *tasks.Signature) string {
+	if signature.BrokerMessageGroupId != "" {
+		return signature.BrokerMessageGroupId
+	}
+	if signature.GroupUUID != "" {
+		return signature.GroupUUID
+	}
+	return signature.RoutingKey
+}
+
+// priorityQueues is a method returns true if tasks are sent to separate queues by priority
+func (b *Broker) priorityQueues() bool {
+	return b.GetConfig().SQS != nil && b.GetConfig().SQS.PriorityQueues
+}
+
+// taskQueue is a method returns the name of the queue tasks of the queue with the priority
+// are sent to, the priority suffix of a FIFO queue precedes its ".fifo" suffix
+func (b *Broker) taskQueue(queue string, priority uint8) string {
+	if !b.priorityQueues() {
+		return queue
+	}
+	if strings.HasSuffix(queue, ".fifo") {
+		return tasks.PriorityQueue(strings.TrimSuffix(queue, ".fifo"), priority) + ".fifo"
+	}
+	return tasks.PriorityQueue(queue, priority)
+}
+
+// deliveryQueueURL is a method returns the url of the queue a delivery was received from,
+// with priority queues it is the queue of the priority of the task
+func (b *Broker) deliveryQueueURL(delivery *awssqs.ReceiveMessageOutput) *string {
+	if !b.priorityQueues() {
+		return b.defaultQueueURL()
+	}
+
+	sig := new(tasks.Signature)
+	if err := b.UnmarshalSignature([]byte(aws.ToString(delivery.Messages[0].Body)), sig); err != nil {
+		return b.defaultQueueURL()
+	}
+	return aws.String(b.GetConfig().Broker + "/" + b.taskQueue(b.consumedQueue(), sig.Priority))
+}
+
 // getQueueURL is a method returns that returns queueURL first by checking if custom queue was set and usign it
 // otherwise using default queueName from config
 func (b *Broker) getQueueURL(taskProcessor iface.TaskProcessor) *string {
-	queueName := b.GetConfig().DefaultQueue
+	return aws.String(b.GetConfig().Broker + "/" + b.getQueueName(taskProcessor))
+}
+
+// getQueueName is a method returns the name of the custom queue if it was set, otherwise the default queue
+func (b *Broker) getQueueName(taskProcessor iface.TaskProcessor) string {
 	if taskProcessor.CustomQueue() != "" {
-		queueName = taskProcessor.CustomQueue()
+		return taskProcessor.CustomQueue()
 	}
-
-	return aws.String(b.GetConfig().Broker + "/" + queueName)
+	return b.GetConfig().DefaultQueue
 }
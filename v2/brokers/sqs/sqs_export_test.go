@@ -1,21 +1,22 @@
 package sqs
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"sync"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sqs/sqsiface"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 
 	"github.com/RichardKnop/machinery/v2/brokers/iface"
 	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
 
-	awssqs "github.com/aws/aws-sdk-go/service/sqs"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
 var (
@@ -23,10 +24,10 @@ var (
 )
 
 type FakeSQS struct {
-	sqsiface.SQSAPI
+	API
 }
 
-func (f *FakeSQS) SendMessage(*awssqs.SendMessageInput) (*awssqs.SendMessageOutput, error) {
+func (f *FakeSQS) SendMessage(ctx context.Context, input *awssqs.SendMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageOutput, error) {
 	output := awssqs.SendMessageOutput{
 		MD5OfMessageAttributes: aws.String("d25a6aea97eb8f585bfa92d314504a92"),
 		MD5OfMessageBody:       aws.String("bbdc5fdb8be7251f5c910905db994bab"),
@@ -35,29 +36,76 @@ func (f *FakeSQS) SendMessage(*awssqs.SendMessageInput) (*awssqs.SendMessageOutp
 	return &output, nil
 }
 
-func (f *FakeSQS) ReceiveMessage(*awssqs.ReceiveMessageInput) (*awssqs.ReceiveMessageOutput, error) {
+func (f *FakeSQS) ReceiveMessage(ctx context.Context, input *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
 	return ReceiveMessageOutput, nil
 }
 
-func (f *FakeSQS) DeleteMessage(*awssqs.DeleteMessageInput) (*awssqs.DeleteMessageOutput, error) {
+func (f *FakeSQS) DeleteMessage(ctx context.Context, input *awssqs.DeleteMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error) {
 	return &awssqs.DeleteMessageOutput{}, nil
 }
 
+type BatchSQS struct {
+	FakeSQS
+	mu                sync.Mutex
+	SendInputs        []*awssqs.SendMessageInput
+	ReceiveInputs     []*awssqs.ReceiveMessageInput
+	SendBatchInputs   []*awssqs.SendMessageBatchInput
+	DeleteBatchInputs []*awssqs.DeleteMessageBatchInput
+}
+
+func (f *BatchSQS) SendMessage(ctx context.Context, input *awssqs.SendMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.SendInputs = append(f.SendInputs, input)
+	return f.FakeSQS.SendMessage(ctx, input)
+}
+
+func (f *BatchSQS) ReceiveMessage(ctx context.Context, input *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ReceiveInputs = append(f.ReceiveInputs, input)
+	return f.FakeSQS.ReceiveMessage(ctx, input)
+}
+
+func (f *BatchSQS) SendMessageBatch(ctx context.Context, input *awssqs.SendMessageBatchInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.SendBatchInputs = append(f.SendBatchInputs, input)
+
+	output := new(awssqs.SendMessageBatchOutput)
+	for _, entry := range input.Entries {
+		output.Successful = append(output.Successful, types.SendMessageBatchResultEntry{Id: entry.Id})
+	}
+	return output, nil
+}
+
+func (f *BatchSQS) DeleteMessageBatch(ctx context.Context, input *awssqs.DeleteMessageBatchInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.DeleteBatchInputs = append(f.DeleteBatchInputs, input)
+
+	output := new(awssqs.DeleteMessageBatchOutput)
+	for _, entry := range input.Entries {
+		output.Successful = append(output.Successful, types.DeleteMessageBatchResultEntry{Id: entry.Id})
+	}
+	return output, nil
+}
+
 type ErrorSQS struct {
-	sqsiface.SQSAPI
+	API
 }
 
-func (e *ErrorSQS) SendMessage(*awssqs.SendMessageInput) (*awssqs.SendMessageOutput, error) {
+func (e *ErrorSQS) SendMessage(ctx context.Context, input *awssqs.SendMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.SendMessageOutput, error) {
 	err := errors.New("this is an error")
 	return nil, err
 }
 
-func (e *ErrorSQS) ReceiveMessage(*awssqs.ReceiveMessageInput) (*awssqs.ReceiveMessageOutput, error) {
+func (e *ErrorSQS) ReceiveMessage(ctx context.Context, input *awssqs.ReceiveMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.ReceiveMessageOutput, error) {
 	err := errors.New("this is an error")
 	return nil, err
 }
 
-func (e *ErrorSQS) DeleteMessage(*awssqs.DeleteMessageInput) (*awssqs.DeleteMessageOutput, error) {
+func (e *ErrorSQS) DeleteMessage(ctx context.Context, input *awssqs.DeleteMessageInput, optFns ...func(*awssqs.Options)) (*awssqs.DeleteMessageOutput, error) {
 	err := errors.New("this is an error")
 	return nil, err
 }
@@ -66,15 +114,15 @@ func init() {
 	// TODO: chang message body to signature example
 	messageBody, _ := json.Marshal(map[string]int{"apple": 5, "lettuce": 7})
 	ReceiveMessageOutput = &awssqs.ReceiveMessageOutput{
-		Messages: []*awssqs.Message{
+		Messages: []types.Message{
 			{
-				Attributes: map[string]*string{
-					"SentTimestamp": aws.String("1512962021537"),
+				Attributes: map[string]string{
+					"SentTimestamp": "1512962021537",
 				},
 				Body:                   aws.String(string(messageBody)),
 				MD5OfBody:              aws.String("bbdc5fdb8be7251f5c910905db994bab"),
 				MD5OfMessageAttributes: aws.String("d25a6aea97eb8f585bfa92d314504a92"),
-				MessageAttributes: map[string]*awssqs.MessageAttributeValue{
+				MessageAttributes: map[string]types.MessageAttributeValue{
 					"Title": {
 						DataType:    aws.String("String"),
 						StringValue: aws.String("The Whistler"),
@@ -113,14 +161,9 @@ func NewTestConfig() *config.Config {
 func NewTestBroker() *Broker {
 
 	cnf := NewTestConfig()
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
-
 	svc := new(FakeSQS)
 	return &Broker{
 		Broker:            common.NewBroker(cnf),
-		sess:              sess,
 		service:           svc,
 		processingWG:      sync.WaitGroup{},
 		receivingWG:       sync.WaitGroup{},
@@ -128,17 +171,25 @@ func NewTestBroker() *Broker {
 	}
 }
 
-func NewTestErrorBroker() *Broker {
+func NewTestBatchBroker(svc *BatchSQS) *Broker {
 
 	cnf := NewTestConfig()
-	sess := session.Must(session.NewSessionWithOptions(session.Options{
-		SharedConfigState: session.SharedConfigEnable,
-	}))
+	cnf.SQS = &config.SQSConfig{MaxNumberOfMessages: 10}
+	return &Broker{
+		Broker:            common.NewBroker(cnf),
+		service:           svc,
+		processingWG:      sync.WaitGroup{},
+		receivingWG:       sync.WaitGroup{},
+		stopReceivingChan: make(chan int),
+	}
+}
+
+func NewTestErrorBroker() *Broker {
 
+	cnf := NewTestConfig()
 	errSvc := new(ErrorSQS)
 	return &Broker{
 		Broker:            common.NewBroker(cnf),
-		sess:              sess,
 		service:           errSvc,
 		processingWG:      sync.WaitGroup{},
 		receivingWG:       sync.WaitGroup{},
@@ -158,6 +209,14 @@ func (b *Broker) DeleteOneForTest(delivery *awssqs.ReceiveMessageOutput) error {
 	return b.deleteOne(delivery)
 }
 
+func (b *Broker) MaxNumberOfMessagesForTest() int {
+	return b.maxNumberOfMessages()
+}
+
+func (b *Broker) SetCustomPrefetchForTest(customPrefetch int) {
+	b.customPrefetch = customPrefetch
+}
+
 func (b *Broker) DefaultQueueURLForTest() *string {
 	return b.defaultQueueURL()
 }
@@ -166,6 +225,10 @@ func (b *Broker) ReceiveMessageForTest(qURL *string) (*awssqs.ReceiveMessageOutp
 	return b.receiveMessage(qURL)
 }
 
+func (b *Broker) ReceiveByPriorityForTest(qURL *string, maxNumberOfMessages int64) (*awssqs.ReceiveMessageOutput, error) {
+	return b.receiveByPriority(qURL, maxNumberOfMessages)
+}
+
 func (b *Broker) InitializePoolForTest(pool chan struct{}, concurrency int) {
 	b.initializePool(pool, concurrency)
 }
@@ -198,6 +261,10 @@ func (b *Broker) GetStopChanForTest() chan int {
 	return b.GetStopChan()
 }
 
+func (b *Broker) WaitProcessingForTest() {
+	b.processingWG.Wait()
+}
+
 func (b *Broker) GetRetryStopChanForTest() chan int {
 	return b.GetRetryStopChan()
 }
@@ -206,6 +273,14 @@ func (b *Broker) GetQueueURLForTest(taskProcessor iface.TaskProcessor) *string {
 	return b.getQueueURL(taskProcessor)
 }
 
+func (b *Broker) NewSendMessageInputForTest(signature *tasks.Signature) (*awssqs.SendMessageInput, error) {
+	return b.newSendMessageInput(signature)
+}
+
+func MessageGroupIDForTest(signature *tasks.Signature) string {
+	return messageGroupID(signature)
+}
+
 func (b *Broker) GetCustomQueueURL(customQueue string) *string {
 	return aws.String(b.GetConfig().Broker + "/" + customQueue)
 }
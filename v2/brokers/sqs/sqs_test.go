@@ -2,20 +2,26 @@ package sqs_test
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/RichardKnop/machinery/v2"
+	eagerbackend "github.com/RichardKnop/machinery/v2/backends/eager"
 	"github.com/RichardKnop/machinery/v2/brokers/sqs"
 	"github.com/RichardKnop/machinery/v2/config"
+	eagerlock "github.com/RichardKnop/machinery/v2/locks/eager"
 	"github.com/RichardKnop/machinery/v2/retry"
+	"github.com/RichardKnop/machinery/v2/tasks"
 
-	awssqs "github.com/aws/aws-sdk-go/service/sqs"
+	awssqs "github.com/aws/aws-sdk-go-v2/service/sqs"
 )
 
 var (
@@ -77,7 +83,7 @@ func TestPrivateFunc_continueReceivingMessages(t *testing.T) {
 
 	// Test when there is no message
 	outputCopy := *receiveMessageOutput
-	receiveMessageOutput.Messages = []*awssqs.Message{}
+	receiveMessageOutput.Messages = []types.Message{}
 	whetherContinue, err = broker.ContinueReceivingMessagesForTest(qURL, deliveries)
 	assert.True(t, whetherContinue)
 	assert.Nil(t, err)
@@ -87,42 +93,36 @@ func TestPrivateFunc_continueReceivingMessages(t *testing.T) {
 
 func TestPrivateFunc_consume(t *testing.T) {
 
-	server1, err := machinery.NewServer(cnf)
-	if err != nil {
-		t.Fatal(err)
-	}
+	server1 := machinery.NewServer(cnf, sqs.NewTestBroker(), eagerbackend.New(), eagerlock.New())
 	pool := make(chan struct{})
 	wk := server1.NewWorker("sms_worker", 0)
 	deliveries := make(chan *awssqs.ReceiveMessageOutput)
 	outputCopy := *receiveMessageOutput
-	outputCopy.Messages = []*awssqs.Message{}
+	outputCopy.Messages = []types.Message{}
 	go func() { deliveries <- &outputCopy }()
 
 	broker := sqs.NewTestBroker()
 
 	// an infinite loop will be executed only when there is no error
-	err = broker.ConsumeForTest(deliveries, 0, wk, pool)
+	err := broker.ConsumeForTest(deliveries, 0, wk, pool)
 	assert.NotNil(t, err)
 }
 
 func TestPrivateFunc_consumeOne(t *testing.T) {
 
-	server1, err := machinery.NewServer(cnf)
-	if err != nil {
-		t.Fatal(err)
-	}
+	server1 := machinery.NewServer(cnf, sqs.NewTestBroker(), eagerbackend.New(), eagerlock.New())
 	wk := server1.NewWorker("sms_worker", 0)
 	broker := sqs.NewTestBroker()
 
-	err = broker.ConsumeOneForTest(receiveMessageOutput, wk)
+	err := broker.ConsumeOneForTest(receiveMessageOutput, wk)
 	assert.NotNil(t, err)
 
 	outputCopy := *receiveMessageOutput
-	outputCopy.Messages = []*awssqs.Message{}
+	outputCopy.Messages = []types.Message{}
 	err = broker.ConsumeOneForTest(&outputCopy, wk)
 	assert.NotNil(t, err)
 
-	outputCopy.Messages = []*awssqs.Message{
+	outputCopy.Messages = []types.Message{
 		{
 			Body: aws.String("foo message"),
 		},
@@ -143,10 +143,7 @@ func TestPrivateFunc_initializePool(t *testing.T) {
 
 func TestPrivateFunc_startConsuming(t *testing.T) {
 
-	server1, err := machinery.NewServer(cnf)
-	if err != nil {
-		t.Fatal(err)
-	}
+	server1 := machinery.NewServer(cnf, sqs.NewTestBroker(), eagerbackend.New(), eagerlock.New())
 
 	wk := server1.NewWorker("sms_worker", 0)
 	broker := sqs.NewTestBroker()
@@ -195,12 +192,17 @@ func TestPrivateFunc_consumeDeliveries(t *testing.T) {
 
 	concurrency := 0
 	pool := make(chan struct{}, concurrency)
-	errorsChan := make(chan error)
-	deliveries := make(chan *awssqs.ReceiveMessageOutput)
-	server1, err := machinery.NewServer(cnf)
-	if err != nil {
-		t.Fatal(err)
+	// Errors of consumed deliveries are buffered and drained between the
+	// steps, so they are not received by the next step instead of its input
+	errorsChan := make(chan error, 1)
+	drainErrors := func() {
+		select {
+		case <-errorsChan:
+		default:
+		}
 	}
+	deliveries := make(chan *awssqs.ReceiveMessageOutput)
+	server1 := machinery.NewServer(cnf, sqs.NewTestBroker(), eagerbackend.New(), eagerlock.New())
 
 	wk := server1.NewWorker("sms_worker", 0)
 	broker := sqs.NewTestBroker()
@@ -209,6 +211,8 @@ func TestPrivateFunc_consumeDeliveries(t *testing.T) {
 	whetherContinue, err := broker.ConsumeDeliveriesForTest(deliveries, concurrency, wk, pool, errorsChan)
 	assert.True(t, whetherContinue)
 	assert.Nil(t, err)
+	broker.WaitProcessingForTest()
+	drainErrors()
 
 	go func() { errorsChan <- errors.New("foo error") }()
 	whetherContinue, err = broker.ConsumeDeliveriesForTest(deliveries, concurrency, wk, pool, errorsChan)
@@ -221,9 +225,10 @@ func TestPrivateFunc_consumeDeliveries(t *testing.T) {
 	assert.Nil(t, err)
 
 	outputCopy := *receiveMessageOutput
-	outputCopy.Messages = []*awssqs.Message{}
+	outputCopy.Messages = []types.Message{}
 	go func() { deliveries <- &outputCopy }()
 	whetherContinue, err = broker.ConsumeDeliveriesForTest(deliveries, concurrency, wk, pool, errorsChan)
+	broker.WaitProcessingForTest()
 	e := <-errorsChan
 	assert.True(t, whetherContinue)
 	assert.NotNil(t, e)
@@ -265,10 +270,7 @@ func TestPrivateFunc_deleteOne(t *testing.T) {
 
 func Test_CustomQueueName(t *testing.T) {
 
-	server1, err := machinery.NewServer(cnf)
-	if err != nil {
-		t.Fatal(err)
-	}
+	server1 := machinery.NewServer(cnf, sqs.NewTestBroker(), eagerbackend.New(), eagerlock.New())
 
 	broker := sqs.NewTestBroker()
 
@@ -294,11 +296,8 @@ func TestPrivateFunc_consumeWithConcurrency(t *testing.T) {
 	output := make(chan string) // The output channel
 
 	cnf.ResultBackend = "eager"
-	server1, err := machinery.NewServer(cnf)
-	if err != nil {
-		t.Fatal(err)
-	}
-	err = server1.RegisterTask("test-task", func(ctx context.Context) error {
+	server1 := machinery.NewServer(cnf, sqs.NewTestBroker(), eagerbackend.New(), eagerlock.New())
+	err := server1.RegisterTask("test-task", func(ctx context.Context) error {
 		output <- testResp
 
 		return nil
@@ -313,7 +312,7 @@ func TestPrivateFunc_consumeWithConcurrency(t *testing.T) {
 	wk := server1.NewWorker("sms_worker", 1)
 	deliveries := make(chan *awssqs.ReceiveMessageOutput)
 	outputCopy := *receiveMessageOutput
-	outputCopy.Messages = []*awssqs.Message{
+	outputCopy.Messages = []types.Message{
 		{
 			MessageId: aws.String("test-sqs-msg1"),
 			Body:      aws.String(msg),
@@ -338,3 +337,211 @@ func TestPrivateFunc_consumeWithConcurrency(t *testing.T) {
 		t.Fatal("task not processed in 10 seconds")
 	}
 }
+
+func TestPrivateFunc_messageGroupID(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{RoutingKey: "test_queue.fifo"}
+	assert.Equal(t, "test_queue.fifo", sqs.MessageGroupIDForTest(signature))
+
+	signature.GroupUUID = "group_uuid"
+	assert.Equal(t, "group_uuid", sqs.MessageGroupIDForTest(signature))
+
+	signature.BrokerMessageGroupId = "message_group_id"
+	assert.Equal(t, "message_group_id", sqs.MessageGroupIDForTest(signature))
+}
+
+func TestPublishBatch(t *testing.T) {
+	t.Parallel()
+
+	svc := new(sqs.BatchSQS)
+	broker := sqs.NewTestBatchBroker(svc)
+
+	signatures := make([]*tasks.Signature, 23)
+	for i := range signatures {
+		signatures[i] = &tasks.Signature{Name: "test", UUID: fmt.Sprintf("task_%d", i)}
+	}
+
+	err := broker.PublishBatch(context.Background(), signatures)
+	assert.NoError(t, err)
+
+	if assert.Len(t, svc.SendBatchInputs, 3) {
+		assert.Len(t, svc.SendBatchInputs[0].Entries, 10)
+		assert.Len(t, svc.SendBatchInputs[1].Entries, 10)
+		assert.Len(t, svc.SendBatchInputs[2].Entries, 3)
+		assert.Equal(t, "https://sqs.foo.amazonaws.com.cn/test_queue", *svc.SendBatchInputs[0].QueueUrl)
+	}
+}
+
+func TestPrivateFunc_deleteBatched(t *testing.T) {
+	t.Parallel()
+
+	svc := new(sqs.BatchSQS)
+	broker := sqs.NewTestBatchBroker(svc)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			delivery := &awssqs.ReceiveMessageOutput{
+				Messages: []types.Message{{ReceiptHandle: aws.String(fmt.Sprintf("handle_%d", i))}},
+			}
+			assert.NoError(t, broker.DeleteOneForTest(delivery))
+		}(i)
+	}
+	wg.Wait()
+
+	if assert.Len(t, svc.DeleteBatchInputs, 1) {
+		assert.Len(t, svc.DeleteBatchInputs[0].Entries, 3)
+	}
+}
+
+func TestPrivateFunc_queueConfig(t *testing.T) {
+	t.Parallel()
+
+	svc := new(sqs.BatchSQS)
+	broker := sqs.NewTestBatchBroker(svc)
+	visibilityTimeout := 30
+	broker.GetConfig().Queues = map[string]config.QueueConfig{
+		"test_queue": {PrefetchCount: 3, VisibilityTimeout: &visibilityTimeout, DeadLetterQueue: "test_dlq"},
+	}
+	assert.Equal(t, 3, broker.MaxNumberOfMessagesForTest())
+	broker.SetCustomPrefetchForTest(2)
+	assert.Equal(t, 2, broker.MaxNumberOfMessagesForTest())
+	broker.SetCustomPrefetchForTest(0)
+
+	_, err := broker.ReceiveMessageForTest(broker.DefaultQueueURLForTest())
+	assert.NoError(t, err)
+	if assert.Len(t, svc.ReceiveInputs, 1) {
+		assert.Equal(t, int32(30), svc.ReceiveInputs[0].VisibilityTimeout)
+	}
+
+	// A message which cannot be decoded is moved to the dead letter queue
+	server := machinery.NewServer(broker.GetConfig(), sqs.NewTestBroker(), eagerbackend.New(), eagerlock.New())
+	err = broker.ConsumeOneForTest(&awssqs.ReceiveMessageOutput{
+		Messages: []types.Message{{Body: aws.String("foo message"), ReceiptHandle: aws.String("foo")}},
+	}, server.NewWorker("sms_worker", 0))
+	assert.Error(t, err)
+	if assert.Len(t, svc.SendInputs, 1) {
+		assert.Equal(t, "https://sqs.foo.amazonaws.com.cn/test_dlq", *svc.SendInputs[0].QueueUrl)
+		assert.Equal(t, "foo message", *svc.SendInputs[0].MessageBody)
+	}
+	assert.Len(t, svc.DeleteBatchInputs, 1)
+}
+
+type countingProcessor struct {
+	processed int
+}
+
+func (p *countingProcessor) Process(signature *tasks.Signature) error {
+	p.processed++
+	return nil
+}
+
+func (p *countingProcessor) CustomQueue() string {
+	return ""
+}
+
+func (p *countingProcessor) PreConsumeHandler() bool {
+	return true
+}
+
+func TestPrivateFunc_newSendMessageInputDelay(t *testing.T) {
+	t.Parallel()
+
+	broker := sqs.NewTestBroker()
+
+	eta := time.Now().UTC().Add(time.Minute * 5)
+	input, err := broker.NewSendMessageInputForTest(&tasks.Signature{Name: "test", ETA: &eta})
+	assert.NoError(t, err)
+	assert.InDelta(t, 300, input.DelaySeconds, 1)
+
+	// Longer delays are capped to the max supported by SQS
+	eta = time.Now().UTC().Add(time.Hour)
+	input, err = broker.NewSendMessageInputForTest(&tasks.Signature{Name: "test", ETA: &eta})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(900), input.DelaySeconds)
+}
+
+func TestPrivateFunc_newSendMessageInputFIFO(t *testing.T) {
+	t.Parallel()
+
+	broker := sqs.NewTestBroker()
+
+	signature := &tasks.Signature{Name: "test", UUID: "task_uuid", RoutingKey: "test_queue.fifo"}
+	input, err := broker.NewSendMessageInputForTest(signature)
+	assert.NoError(t, err)
+	assert.Equal(t, "task_uuid-0", *input.MessageDeduplicationId)
+	assert.Equal(t, "test_queue.fifo", *input.MessageGroupId)
+
+	// A retry is not deduplicated with the message of the previous attempt
+	signature.RetryAttempt++
+	retried, err := broker.NewSendMessageInputForTest(signature)
+	assert.NoError(t, err)
+	assert.Equal(t, "task_uuid-1", *retried.MessageDeduplicationId)
+	assert.NotEqual(t, *input.MessageDeduplicationId, *retried.MessageDeduplicationId)
+}
+
+func TestPrivateFunc_consumeOneRequeuesDelayed(t *testing.T) {
+	t.Parallel()
+
+	svc := new(sqs.BatchSQS)
+	broker := sqs.NewTestBatchBroker(svc)
+	broker.SetRegisteredTaskNames([]string{"test"})
+
+	eta := time.Now().UTC().Add(time.Hour)
+	body, _ := json.Marshal(&tasks.Signature{Name: "test", UUID: "task_uuid", RoutingKey: "test_queue", ETA: &eta})
+	processor := new(countingProcessor)
+	err := broker.ConsumeOneForTest(&awssqs.ReceiveMessageOutput{
+		Messages: []types.Message{{Body: aws.String(string(body)), ReceiptHandle: aws.String("foo")}},
+	}, processor)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, processor.processed)
+
+	if assert.Len(t, svc.SendInputs, 1) {
+		assert.Equal(t, "https://sqs.foo.amazonaws.com.cn/test_queue", *svc.SendInputs[0].QueueUrl)
+		assert.Equal(t, int32(900), svc.SendInputs[0].DelaySeconds)
+	}
+	assert.Len(t, svc.DeleteBatchInputs, 1)
+}
+
+func TestPriorityQueues(t *testing.T) {
+	t.Parallel()
+
+	svc := new(sqs.BatchSQS)
+	broker := sqs.NewTestBatchBroker(svc)
+	broker.GetConfig().SQS.PriorityQueues = true
+
+	for priority, queueURL := range map[uint8]string{
+		tasks.PriorityLow:    "https://sqs.foo.amazonaws.com.cn/test_queue",
+		tasks.PriorityMedium: "https://sqs.foo.amazonaws.com.cn/test_queue_medium",
+		tasks.PriorityHigh:   "https://sqs.foo.amazonaws.com.cn/test_queue_high",
+	} {
+		input, err := broker.NewSendMessageInputForTest(&tasks.Signature{Name: "test", Priority: priority})
+		assert.NoError(t, err)
+		assert.Equal(t, queueURL, *input.QueueUrl)
+	}
+
+	// The priority suffix of a FIFO queue precedes the ".fifo" suffix
+	input, err := broker.NewSendMessageInputForTest(&tasks.Signature{Name: "test", RoutingKey: "test_queue.fifo", Priority: tasks.PriorityHigh})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://sqs.foo.amazonaws.com.cn/test_queue_high.fifo", *input.QueueUrl)
+
+	// Messages are received from the high priority queue first, without waiting
+	_, err = broker.ReceiveByPriorityForTest(broker.DefaultQueueURLForTest(), 10)
+	assert.NoError(t, err)
+	if assert.Len(t, svc.ReceiveInputs, 1) {
+		assert.Equal(t, "https://sqs.foo.amazonaws.com.cn/test_queue_high", *svc.ReceiveInputs[0].QueueUrl)
+		assert.Equal(t, int32(0), svc.ReceiveInputs[0].WaitTimeSeconds)
+	}
+
+	// Messages are deleted from the queue of their priority
+	body, _ := json.Marshal(&tasks.Signature{Name: "test", RoutingKey: "test_queue", Priority: tasks.PriorityMedium})
+	assert.NoError(t, broker.DeleteOneForTest(&awssqs.ReceiveMessageOutput{
+		Messages: []types.Message{{Body: aws.String(string(body)), ReceiptHandle: aws.String("foo")}},
+	}))
+	if assert.Len(t, svc.DeleteBatchInputs, 1) {
+		assert.Equal(t, "https://sqs.foo.amazonaws.com.cn/test_queue_medium", *svc.DeleteBatchInputs[0].QueueUrl)
+	}
+}
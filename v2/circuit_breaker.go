@@ -0,0 +1,186 @@
+package machinery
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// CircuitState is the state of the circuit breaker of a task
+type CircuitState int
+
+const (
+	// CircuitClosed - tasks are processed
+	CircuitClosed CircuitState = iota
+	// CircuitOpen - tasks are requeued until the cooldown passed
+	CircuitOpen
+	// CircuitHalfOpen - the cooldown passed, tasks are processed again, the
+	// circuit is closed by the first success or opened by the first failure
+	CircuitHalfOpen
+)
+
+// String returns the name of the state
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreakerSettings are the settings of the circuit breaker a task has
+// been registered with
+type circuitBreakerSettings struct {
+	failures int
+	window   time.Duration
+	cooldown time.Duration
+}
+
+// WithCircuitBreaker makes workers stop processing the task for the cooldown
+// once it failed the given number of times within the window, e.g. so a
+// downstream service which is down is not called over and over. Tasks
+// received meanwhile are requeued to be processed after the cooldown. Each
+// worker has its own circuit breakers, see Worker.SetCircuitBreakerHandler.
+func WithCircuitBreaker(failures int, window, cooldown time.Duration) TaskOption {
+	return func(opts *taskOptions) {
+		opts.circuitBreaker = &circuitBreakerSettings{failures: failures, window: window, cooldown: cooldown}
+	}
+}
+
+// circuitBreaker counts the failures of a task
+type circuitBreaker struct {
+	settings  *circuitBreakerSettings
+	mu        sync.Mutex
+	state     CircuitState
+	failedAt  []time.Time
+	openUntil time.Time
+}
+
+// allow returns true if the task can be processed, otherwise the time the
+// cooldown ends. The circuit is half open once the cooldown passed, the last
+// value is true if it has just become half open.
+func (b *circuitBreaker) allow(now time.Time) (allowed bool, until time.Time, halfOpened bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitOpen {
+		return true, time.Time{}, false
+	}
+	if now.Before(b.openUntil) {
+		return false, b.openUntil, false
+	}
+	b.state = CircuitHalfOpen
+	return true, time.Time{}, true
+}
+
+// succeeded closes a half open circuit, it returns true if the state changed
+func (b *circuitBreaker) succeeded() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != CircuitHalfOpen {
+		return false
+	}
+	b.state = CircuitClosed
+	b.failedAt = nil
+	return true
+}
+
+// failed opens the circuit once the task failed too many times within the
+// window or failed while the circuit was half open, it returns true if the
+// state changed
+func (b *circuitBreaker) failed(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen {
+		return false
+	}
+
+	// Only failures within the window are kept
+	failedAt := b.failedAt[:0]
+	for _, t := range b.failedAt {
+		if now.Sub(t) < b.settings.window {
+			failedAt = append(failedAt, t)
+		}
+	}
+	b.failedAt = append(failedAt, now)
+
+	if b.state == CircuitClosed && len(b.failedAt) < b.settings.failures {
+		return false
+	}
+	b.state = CircuitOpen
+	b.openUntil = now.Add(b.settings.cooldown)
+	b.failedAt = nil
+	return true
+}
+
+// getCircuitBreaker returns the circuit breaker of the task, nil if it has
+// not been registered with one
+func (worker *Worker) getCircuitBreaker(name string) *circuitBreaker {
+	settings := worker.server.getTaskOptions(name).circuitBreaker
+	if settings == nil {
+		return nil
+	}
+
+	breaker, _ := worker.breakers.LoadOrStore(name, &circuitBreaker{settings: settings})
+	return breaker.(*circuitBreaker)
+}
+
+// updateCircuit counts the outcome of the task with its circuit breaker
+func (worker *Worker) updateCircuit(breaker *circuitBreaker, name string, taskErr error) {
+	if taskErr == nil {
+		if breaker.succeeded() {
+			worker.circuitChanged(name, CircuitClosed)
+		}
+		return
+	}
+
+	if breaker.failed(time.Now()) {
+		worker.circuitChanged(name, CircuitOpen)
+	}
+}
+
+// CircuitState returns the state of the circuit breaker of the task, closed
+// if it has no circuit breaker
+func (worker *Worker) CircuitState(name string) CircuitState {
+	breaker := worker.getCircuitBreaker(name)
+	if breaker == nil {
+		return CircuitClosed
+	}
+
+	breaker.mu.Lock()
+	defer breaker.mu.Unlock()
+	return breaker.state
+}
+
+// SetCircuitBreakerHandler sets a handler called when the circuit breaker of
+// a task changes its state, e.g. to record it in metrics
+func (worker *Worker) SetCircuitBreakerHandler(handler func(name string, state CircuitState)) {
+	worker.circuitBreakerHandler = handler
+}
+
+// circuitChanged logs the new state of the circuit breaker of the task and
+// calls the circuit breaker handler
+func (worker *Worker) circuitChanged(name string, state CircuitState) {
+	log.WARNING.Printf("Circuit breaker of task %s is %s", name, state)
+	if worker.circuitBreakerHandler != nil {
+		worker.circuitBreakerHandler(name, state)
+	}
+}
+
+// requeueUntil sends the task again to be processed once the circuit breaker
+// of the task is half open
+func (worker *Worker) requeueUntil(signature *tasks.Signature, until time.Time) error {
+	log.WARNING.Printf("Circuit breaker of task %s is open. Going to requeue task %s.", signature.Name, signature.UUID)
+
+	eta := until.UTC()
+	signature.ETA = &eta
+	_, err := worker.server.resendTask(signature)
+	return err
+}
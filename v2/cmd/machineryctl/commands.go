@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// resultsPollPeriod is how often the state of a task is read while waiting
+// for its results
+const resultsPollPeriod = 100 * time.Millisecond
+
+// action wraps the command so its error is printed and makes machineryctl
+// exit with status 1
+func action(command func(c *cli.Context, server *machinery.Server) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		server, err := newServer(c)
+		if err == nil {
+			err = command(c, server)
+		}
+		if err != nil {
+			return cli.NewExitError(err.Error(), 1)
+		}
+		return nil
+	}
+}
+
+// newServer creates a server from the config and the URLs given as global
+// flags, tasks are not registered as they are only sent
+func newServer(c *cli.Context) (*machinery.Server, error) {
+	var (
+		cnf *config.Config
+		err error
+	)
+	if path := c.GlobalString("config"); path != "" {
+		cnf, err = config.NewFromYaml(path, false)
+	} else {
+		cnf, err = config.NewFromEnvironment()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if broker := c.GlobalString("broker"); broker != "" {
+		cnf.Broker = broker
+	}
+	if resultBackend := c.GlobalString("result-backend"); resultBackend != "" {
+		cnf.ResultBackend = resultBackend
+	}
+
+	broker, err := newBroker(cnf)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := newBackend(cnf)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := newLock(cnf)
+	if err != nil {
+		return nil, err
+	}
+	return machinery.NewServer(cnf, broker, backend, lock), nil
+}
+
+var (
+	inspectQueues      = action(runInspectQueues)
+	sendTask           = action(runSendTask)
+	cancelTasks        = action(runCancelTasks)
+	purgeQueue         = action(runPurgeQueue)
+	moveMessages       = action(runMoveMessages)
+	requeueDeadLetters = action(runRequeueDeadLetters)
+	listWorkers        = action(runListWorkers)
+)
+
+func runInspectQueues(c *cli.Context, server *machinery.Server) error {
+	queues := []string(c.Args())
+	if len(queues) == 0 {
+		queues = knownQueues(server.GetConfig())
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "QUEUE\tPENDING")
+	for _, queue := range queues {
+		pending, err := server.GetBroker().GetPendingTasks(queue)
+		if err != nil {
+			return fmt.Errorf("Get pending tasks of queue %s error: %s", queue, err)
+		}
+		fmt.Fprintf(w, "%s\t%d\n", queue, len(pending))
+	}
+	return w.Flush()
+}
+
+// knownQueues returns the default queue, the queues with their own settings
+// and their dead letter and poison queues, sorted
+func knownQueues(cnf *config.Config) []string {
+	consumed := []string{cnf.DefaultQueue}
+	for name := range cnf.Queues {
+		consumed = append(consumed, name)
+	}
+
+	unique := make(map[string]struct{})
+	for _, name := range consumed {
+		for _, queue := range []string{name, cnf.GetDeadLetterQueue(name), cnf.GetPoisonQueue(name)} {
+			if queue != "" {
+				unique[queue] = struct{}{}
+			}
+		}
+	}
+
+	queues := make([]string, 0, len(unique))
+	for queue := range unique {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+func runSendTask(c *cli.Context, server *machinery.Server) error {
+	if c.NArg() < 1 {
+		return errors.New("Name of the task is required")
+	}
+	if c.Int("priority") < 0 || c.Int("priority") > 255 {
+		return fmt.Errorf("Priority %d is not between 0 and 255", c.Int("priority"))
+	}
+
+	signature := &tasks.Signature{
+		Name:       c.Args().First(),
+		RoutingKey: c.String("queue"),
+		Priority:   uint8(c.Int("priority")),
+		RetryCount: c.Int("retry-count"),
+	}
+	for _, arg := range c.Args().Tail() {
+		parsed, err := parseArg(arg)
+		if err != nil {
+			return err
+		}
+		signature.Args = append(signature.Args, parsed)
+	}
+	if eta := c.String("eta"); eta != "" {
+		t, err := time.Parse(time.RFC3339, eta)
+		if err != nil {
+			return fmt.Errorf("Parse ETA error: %s", err)
+		}
+		t = t.UTC()
+		signature.ETA = &t
+	}
+
+	asyncResult, err := server.SendTask(signature)
+	if err != nil {
+		return err
+	}
+	fmt.Println(asyncResult.Signature.UUID)
+
+	if wait := c.Duration("wait"); wait > 0 {
+		results, err := asyncResult.GetWithTimeout(wait, resultsPollPeriod)
+		if err != nil {
+			return err
+		}
+		fmt.Println(tasks.HumanReadableResults(results))
+	}
+	return nil
+}
+
+// parseArg parses an argument given as TYPE=VALUE, values are decoded as JSON
+// but strings which are taken as is
+func parseArg(arg string) (tasks.Arg, error) {
+	parts := strings.SplitN(arg, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return tasks.Arg{}, fmt.Errorf("Argument %q should be in format TYPE=VALUE", arg)
+	}
+	if parts[0] == "string" {
+		return tasks.Arg{Type: parts[0], Value: parts[1]}, nil
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(parts[1])))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return tasks.Arg{}, fmt.Errorf("Decode value of argument %q error: %s", arg, err)
+	}
+	return tasks.Arg{Type: parts[0], Value: value}, nil
+}
+
+func runCancelTasks(c *cli.Context, server *machinery.Server) error {
+	if c.NArg() < 1 {
+		return errors.New("UUID of a task is required")
+	}
+
+	for _, taskUUID := range c.Args() {
+		if err := server.CancelTask(taskUUID); err != nil {
+			return err
+		}
+		fmt.Printf("Canceled task %s\n", taskUUID)
+	}
+	return nil
+}
+
+func runPurgeQueue(c *cli.Context, server *machinery.Server) error {
+	if c.NArg() != 1 {
+		return errors.New("Name of the queue is required")
+	}
+
+	purged, err := server.PurgeQueue(c.Args().First())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Purged %d tasks from queue %s\n", purged, c.Args().First())
+	return nil
+}
+
+func runMoveMessages(c *cli.Context, server *machinery.Server) error {
+	if c.NArg() != 2 {
+		return errors.New("Names of the queue to move tasks from and of the queue to move them to are required")
+	}
+
+	moved, err := server.MoveMessages(c.Args().Get(0), c.Args().Get(1), c.Int("limit"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Moved %d tasks from queue %s to queue %s\n", moved, c.Args().Get(0), c.Args().Get(1))
+	return nil
+}
+
+func runRequeueDeadLetters(c *cli.Context, server *machinery.Server) error {
+	if c.NArg() != 1 {
+		return errors.New("Name of the dead letter queue is required")
+	}
+
+	requeued, err := server.RequeueDeadLetters(c.Args().First(), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Requeued %d tasks from queue %s\n", requeued, c.Args().First())
+	return nil
+}
+
+func runListWorkers(c *cli.Context, server *machinery.Server) error {
+	workers, err := server.GetWorkers()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tHOST\tPID\tQUEUES\tCONCURRENCY\tRUNNING\tSTATUS\tHEARTBEAT")
+	for _, worker := range workers {
+		status := "consuming"
+		if worker.Draining {
+			status = "draining"
+		} else if worker.Paused {
+			status = "paused"
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%d\t%s\t%d\t%d\t%s\t%s\n",
+			worker.ID, worker.Hostname, worker.PID, strings.Join(worker.Queues, ","),
+			worker.Concurrency, worker.Running, status, worker.HeartbeatAt.Format(time.RFC3339),
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	neturl "net/url"
+
+	"github.com/RichardKnop/machinery/v2/config"
+
+	amqpbackend "github.com/RichardKnop/machinery/v2/backends/amqp"
+	dynamobackend "github.com/RichardKnop/machinery/v2/backends/dynamodb"
+	backendiface "github.com/RichardKnop/machinery/v2/backends/iface"
+	memcachebackend "github.com/RichardKnop/machinery/v2/backends/memcache"
+	mongobackend "github.com/RichardKnop/machinery/v2/backends/mongo"
+	redisbackend "github.com/RichardKnop/machinery/v2/backends/redis"
+	amqpbroker "github.com/RichardKnop/machinery/v2/brokers/amqp"
+	gcppubsubbroker "github.com/RichardKnop/machinery/v2/brokers/gcppubsub"
+	brokeriface "github.com/RichardKnop/machinery/v2/brokers/iface"
+	redisbroker "github.com/RichardKnop/machinery/v2/brokers/redis"
+	sqsbroker "github.com/RichardKnop/machinery/v2/brokers/sqs"
+	consullock "github.com/RichardKnop/machinery/v2/locks/consul"
+	eagerlock "github.com/RichardKnop/machinery/v2/locks/eager"
+	etcdlock "github.com/RichardKnop/machinery/v2/locks/etcd"
+	lockiface "github.com/RichardKnop/machinery/v2/locks/iface"
+	redislock "github.com/RichardKnop/machinery/v2/locks/redis"
+)
+
+// lockRetries is how many times the lock retries taking a lock
+const lockRetries = 3
+
+// newBroker creates the broker of the broker URL of the config
+func newBroker(cnf *config.Config) (brokeriface.Broker, error) {
+	url := cnf.Broker
+	switch {
+	case strings.HasPrefix(url, "amqp://"), strings.HasPrefix(url, "amqps://"):
+		return amqpbroker.New(cnf), nil
+	case strings.HasPrefix(url, "redis://"), strings.HasPrefix(url, "rediss://"):
+		if addrs := redisAddrs(url); len(addrs) > 1 || (cnf.Redis != nil && cnf.Redis.Cluster) {
+			return redisbroker.NewGR(cnf, addrs, 0), nil
+		}
+		host, password, db, err := parseRedisURL(url)
+		if err != nil {
+			return nil, err
+		}
+		return redisbroker.New(cnf, host, password, "", db), nil
+	case strings.HasPrefix(url, "redis+socket://"):
+		path, password, db, err := parseRedisSocketURL(url)
+		if err != nil {
+			return nil, err
+		}
+		return redisbroker.New(cnf, "", password, path, db), nil
+	case strings.HasPrefix(url, "https://sqs"):
+		return sqsbroker.New(cnf), nil
+	case strings.HasPrefix(url, "gcppubsub://"):
+		parts := strings.Split(strings.TrimPrefix(url, "gcppubsub://"), "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("GCP Pub/Sub broker URL should be in format gcppubsub://PROJECT_ID/SUBSCRIPTION_NAME, instead got %s", url)
+		}
+		return gcppubsubbroker.New(cnf, parts[0], parts[1])
+	}
+	return nil, fmt.Errorf("Unsupported broker URL: %s", url)
+}
+
+// newBackend creates the result backend of the result backend URL of the
+// config
+func newBackend(cnf *config.Config) (backendiface.Backend, error) {
+	url := cnf.ResultBackend
+	switch {
+	case strings.HasPrefix(url, "amqp://"), strings.HasPrefix(url, "amqps://"):
+		return amqpbackend.New(cnf), nil
+	case strings.HasPrefix(url, "redis://"), strings.HasPrefix(url, "rediss://"):
+		if addrs := redisAddrs(url); len(addrs) > 1 || (cnf.Redis != nil && cnf.Redis.Cluster) {
+			return redisbackend.NewGR(cnf, addrs, 0), nil
+		}
+		host, password, db, err := parseRedisURL(url)
+		if err != nil {
+			return nil, err
+		}
+		return redisbackend.New(cnf, host, password, "", db), nil
+	case strings.HasPrefix(url, "redis+socket://"):
+		path, password, db, err := parseRedisSocketURL(url)
+		if err != nil {
+			return nil, err
+		}
+		return redisbackend.New(cnf, "", password, path, db), nil
+	case strings.HasPrefix(url, "memcache://"):
+		return memcachebackend.New(cnf, strings.Split(strings.TrimPrefix(url, "memcache://"), ",")), nil
+	case strings.HasPrefix(url, "mongodb://"), strings.HasPrefix(url, "mongodb+srv://"):
+		return mongobackend.New(cnf)
+	case strings.HasPrefix(url, "https://dynamodb"):
+		return dynamobackend.New(cnf), nil
+	}
+	return nil, fmt.Errorf("Unsupported result backend URL: %s", url)
+}
+
+// newLock creates the lock of the lock URL of the config, an eager lock when
+// it has none
+func newLock(cnf *config.Config) (lockiface.Lock, error) {
+	url := cnf.Lock
+	switch {
+	case url == "":
+		return eagerlock.New(), nil
+	case strings.HasPrefix(url, "redis://"), strings.HasPrefix(url, "rediss://"):
+		if addrs := redisAddrs(url); len(addrs) > 1 || (cnf.Redis != nil && cnf.Redis.Cluster) {
+			return redislock.New(cnf, addrs, 0, lockRetries), nil
+		}
+		host, password, db, err := parseRedisURL(url)
+		if err != nil {
+			return nil, err
+		}
+		if password != "" {
+			host = password + "@" + host
+		}
+		return redislock.New(cnf, []string{host}, db, lockRetries), nil
+	case strings.HasPrefix(url, "etcd://"):
+		return etcdlock.New(cnf, strings.Split(strings.TrimPrefix(url, "etcd://"), ","), lockRetries)
+	case strings.HasPrefix(url, "consul://"):
+		return consullock.New(cnf, url, lockRetries)
+	}
+	return nil, fmt.Errorf("Unsupported lock URL: %s", url)
+}
+
+// redisAddrs returns the comma separated addresses of the Redis URL
+func redisAddrs(url string) []string {
+	url = strings.TrimPrefix(strings.TrimPrefix(url, "redis://"), "rediss://")
+	return strings.Split(url, ",")
+}
+
+// parseRedisURL parses a Redis URL in format redis://password@host:port/db
+func parseRedisURL(url string) (host, password string, db int, err error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return "", "", 0, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return "", "", 0, errors.New("No redis scheme found")
+	}
+
+	if u.User != nil {
+		var exists bool
+		if password, exists = u.User.Password(); !exists {
+			password = u.User.Username()
+		}
+	}
+
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if db, err = strconv.Atoi(path); err != nil {
+			return "", "", 0, fmt.Errorf("Invalid Redis DB %q", path)
+		}
+	}
+	return u.Host, password, db, nil
+}
+
+// parseRedisSocketURL parses a Redis URL in format
+// redis+socket://password@/path/to/file.sock:/db
+func parseRedisSocketURL(url string) (path, password string, db int, err error) {
+	remainder := strings.TrimPrefix(url, "redis+socket://")
+	if parts := strings.SplitN(remainder, "@", 2); len(parts) == 2 {
+		password, remainder = parts[0], parts[1]
+	}
+
+	parts := strings.SplitN(remainder, ":", 2)
+	path = parts[0]
+	if path == "" {
+		return "", "", 0, fmt.Errorf("Redis socket URL should be in format redis+socket://password@/path/to/file.sock:/db, instead got %s", url)
+	}
+	if len(parts) == 2 {
+		if dbParts := strings.SplitN(parts[1], "/", 2); len(dbParts) == 2 {
+			db, _ = strconv.Atoi(dbParts[1])
+		}
+	}
+	return path, password, db, nil
+}
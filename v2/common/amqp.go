@@ -37,6 +37,23 @@ func (ac *AMQPConnector) Connect(urls string, urlSeparator string, tlsConfig *tl
 		return nil, nil, amqp.Queue{}, nil, nil, err
 	}
 
+	queue, err := ac.Declare(channel, exchange, exchangeType, queueName, queueDurable, queueDelete, queueBindingKey, exchangeDeclareArgs, queueDeclareArgs, queueBindingArgs)
+	if err != nil {
+		return conn, channel, queue, nil, nil, err
+	}
+
+	// Enable publish confirmations
+	if err = channel.Confirm(false); err != nil {
+		return conn, channel, queue, nil, nil, fmt.Errorf("Channel could not be put into confirm mode: %s", err)
+	}
+
+	return conn, channel, queue, channel.NotifyPublish(make(chan amqp.Confirmation, 1)), conn.NotifyClose(make(chan *amqp.Error, 1)), nil
+}
+
+// Declare declares the exchange, declares the queue and binds it to the exchange
+// on the channel, an empty exchange or queue name skips the respective step
+func (ac *AMQPConnector) Declare(channel *amqp.Channel, exchange, exchangeType, queueName string, queueDurable, queueDelete bool, queueBindingKey string, exchangeDeclareArgs, queueDeclareArgs, queueBindingArgs amqp.Table) (amqp.Queue, error) {
+	var err error
 	if exchange != "" {
 		// Declare an exchange
 		if err = channel.ExchangeDeclare(
@@ -48,7 +65,7 @@ func (ac *AMQPConnector) Connect(urls string, urlSeparator string, tlsConfig *tl
 			false,               // noWait
 			exchangeDeclareArgs, // arguments
 		); err != nil {
-			return conn, channel, amqp.Queue{}, nil, nil, fmt.Errorf("Exchange declare error: %s", err)
+			return amqp.Queue{}, fmt.Errorf("Exchange declare error: %s", err)
 		}
 	}
 
@@ -64,7 +81,7 @@ func (ac *AMQPConnector) Connect(urls string, urlSeparator string, tlsConfig *tl
 			queueDeclareArgs, // arguments
 		)
 		if err != nil {
-			return conn, channel, amqp.Queue{}, nil, nil, fmt.Errorf("Queue declare error: %s", err)
+			return amqp.Queue{}, fmt.Errorf("Queue declare error: %s", err)
 		}
 
 		// Bind the queue
@@ -75,16 +92,11 @@ func (ac *AMQPConnector) Connect(urls string, urlSeparator string, tlsConfig *tl
 			false,            // noWait
 			queueBindingArgs, // arguments
 		); err != nil {
-			return conn, channel, queue, nil, nil, fmt.Errorf("Queue bind error: %s", err)
+			return queue, fmt.Errorf("Queue bind error: %s", err)
 		}
 	}
 
-	// Enable publish confirmations
-	if err = channel.Confirm(false); err != nil {
-		return conn, channel, queue, nil, nil, fmt.Errorf("Channel could not be put into confirm mode: %s", err)
-	}
-
-	return conn, channel, queue, channel.NotifyPublish(make(chan amqp.Confirmation, 1)), conn.NotifyClose(make(chan *amqp.Error, 1)), nil
+	return queue, nil
 }
 
 // DeleteQueue deletes a queue by name
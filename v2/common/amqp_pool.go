@@ -0,0 +1,216 @@
+package common
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// DefaultAMQPChannelPoolSize is the number of idle channels kept open when
+// config.AMQP.ChannelPoolSize is not set
+const DefaultAMQPChannelPoolSize = 10
+
+// ErrAMQPPoolClosed is returned when borrowing a channel from a closed pool
+var ErrAMQPPoolClosed = errors.New("AMQP pool is closed")
+
+// AMQPChannel is a channel in confirm mode borrowed from an AMQPPool
+type AMQPChannel struct {
+	*amqp.Channel
+	conn          *amqp.Connection
+	confirmations <-chan amqp.Confirmation
+	closed        <-chan *amqp.Error
+	deliveryTag   uint64 // tag of the last message published on the channel
+}
+
+// PublishAndConfirm publishes the message and blocks until it is confirmed by
+// the broker, a timeout of zero waits until the channel is closed
+func (c *AMQPChannel) PublishAndConfirm(exchange, key string, msg amqp.Publishing, timeout time.Duration) error {
+	if err := c.Publish(
+		exchange, // exchange
+		key,      // routing key
+		false,    // mandatory
+		false,    // immediate
+		msg,
+	); err != nil {
+		return err
+	}
+	c.deliveryTag++
+
+	return WaitForConfirm(c.confirmations, c.deliveryTag, timeout)
+}
+
+// isClosed checks whether the channel or its connection has been closed
+func (c *AMQPChannel) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return c.conn.IsClosed()
+	}
+}
+
+// AMQPPool shares a single connection and reuses channels instead of opening
+// a connection and a channel for every operation. The connection is reopened
+// on the next Get after it has been closed, e.g. because of a network error.
+type AMQPPool struct {
+	urls      []string
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	conn     *amqp.Connection
+	idle     []*AMQPChannel
+	size     int
+	shutdown bool
+}
+
+// NewAMQPPool creates a pool for the url(s), keeping up to size idle channels
+func NewAMQPPool(urls string, urlSeparator string, tlsConfig *tls.Config, size int) *AMQPPool {
+	urlsList := []string{urls}
+	if urlSeparator != "" {
+		urlsList = strings.Split(urls, urlSeparator)
+	}
+	if size <= 0 {
+		size = DefaultAMQPChannelPoolSize
+	}
+
+	return &AMQPPool{urls: urlsList, tlsConfig: tlsConfig, size: size}
+}
+
+// Get borrows an idle channel or opens a new one, it must be given back
+// with Put once done
+func (p *AMQPPool) Get() (*AMQPChannel, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.shutdown {
+		return nil, ErrAMQPPoolClosed
+	}
+
+	for len(p.idle) > 0 {
+		ch := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+		if !ch.isClosed() {
+			return ch, nil
+		}
+	}
+
+	if p.conn == nil || p.conn.IsClosed() {
+		conn, err := p.dial()
+		if err != nil {
+			return nil, err
+		}
+		p.conn = conn
+	}
+
+	channel, err := p.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("Open channel error: %s", err)
+	}
+
+	// Enable publish confirmations
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("Channel could not be put into confirm mode: %s", err)
+	}
+
+	return &AMQPChannel{
+		Channel:       channel,
+		conn:          p.conn,
+		confirmations: channel.NotifyPublish(make(chan amqp.Confirmation, 1)),
+		closed:        channel.NotifyClose(make(chan *amqp.Error, 1)),
+	}, nil
+}
+
+// Put gives the channel back to the pool. Channels closed by the broker,
+// e.g. after a failed operation, and channels over the pool size are dropped.
+func (p *AMQPPool) Put(ch *AMQPChannel) {
+	if ch == nil || ch.isClosed() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.shutdown || ch.conn != p.conn || len(p.idle) >= p.size {
+		ch.Close()
+		return
+	}
+	p.idle = append(p.idle, ch)
+}
+
+// Discard closes a channel which should not be reused, e.g. because a
+// confirmation is still pending on it
+func (p *AMQPPool) Discard(ch *AMQPChannel) {
+	if ch != nil && !ch.isClosed() {
+		ch.Close()
+	}
+}
+
+// Close closes idle channels and the connection, channels still borrowed
+// are closed together with the connection
+func (p *AMQPPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.shutdown = true
+	p.idle = nil
+
+	if p.conn == nil || p.conn.IsClosed() {
+		return nil
+	}
+	if err := p.conn.Close(); err != nil {
+		return fmt.Errorf("Close connection error: %s", err)
+	}
+	return nil
+}
+
+// dial connects to the first reachable url
+func (p *AMQPPool) dial() (*amqp.Connection, error) {
+	var err error
+	for _, url := range p.urls {
+		var conn *amqp.Connection
+		// From amqp docs: DialTLS will use the provided tls.Config when it encounters an amqps:// scheme
+		// and will dial a plain connection when it encounters an amqp:// scheme.
+		conn, err = amqp.DialTLS(url, p.tlsConfig)
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("Dial error: %s", err)
+}
+
+// WaitForConfirm blocks until the broker confirms the message with the delivery
+// tag, skipping late confirmations of messages published before. A timeout of
+// zero waits until the confirmations channel is closed.
+func WaitForConfirm(confirmsChan <-chan amqp.Confirmation, deliveryTag uint64, timeout time.Duration) error {
+	var timeoutChan <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+
+	for {
+		select {
+		case confirmed, ok := <-confirmsChan:
+			if !ok {
+				return fmt.Errorf("Channel closed before delivery tag %v was confirmed", deliveryTag)
+			}
+			// Late confirmation of a message which timed out before
+			if confirmed.DeliveryTag < deliveryTag {
+				continue
+			}
+			if confirmed.Ack {
+				return nil
+			}
+			return fmt.Errorf("Failed delivery of delivery tag: %v", confirmed.DeliveryTag)
+		case <-timeoutChan:
+			return fmt.Errorf("Timed out waiting for confirmation of delivery tag: %v", deliveryTag)
+		}
+	}
+}
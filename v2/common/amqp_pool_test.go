@@ -0,0 +1,53 @@
+package common_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/common"
+)
+
+func TestAMQPPoolGet(t *testing.T) {
+	t.Parallel()
+
+	t.Run("unreachable broker", func(t *testing.T) {
+		pool := common.NewAMQPPool("amqp://127.0.0.1:1/,amqp://127.0.0.1:2/", ",", nil, 0)
+
+		_, err := pool.Get()
+		assert.Error(t, err)
+	})
+
+	t.Run("closed pool", func(t *testing.T) {
+		pool := common.NewAMQPPool("amqp://127.0.0.1:1/", "", nil, 1)
+		assert.NoError(t, pool.Close())
+
+		_, err := pool.Get()
+		assert.Equal(t, common.ErrAMQPPoolClosed, err)
+	})
+}
+
+func TestWaitForConfirm(t *testing.T) {
+	t.Parallel()
+
+	t.Run("skips late confirmations", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation, 2)
+		confirms <- amqp.Confirmation{DeliveryTag: 3, Ack: false}
+		confirms <- amqp.Confirmation{DeliveryTag: 4, Ack: true}
+
+		assert.NoError(t, common.WaitForConfirm(confirms, 4, 0))
+	})
+
+	t.Run("closed channel without timeout", func(t *testing.T) {
+		confirms := make(chan amqp.Confirmation)
+		close(confirms)
+
+		assert.Error(t, common.WaitForConfirm(confirms, 1, 0))
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		assert.Error(t, common.WaitForConfirm(make(chan amqp.Confirmation), 1, 10*time.Millisecond))
+	})
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// AWSOptions holds the settings the AWS clients of the SQS broker and the
+// DynamoDB backend are created with, zero values use the SDK defaults
+type AWSOptions struct {
+	Region string
+	// RoleARN is the role assumed with STS, using the token of WebIdentityTokenFile
+	// when it is set (e.g. EKS IAM roles for service accounts)
+	RoleARN              string
+	RoleSessionName      string
+	WebIdentityTokenFile string
+}
+
+// NewAWSConfig loads the AWS configuration from the environment and the shared
+// config files, e.g. ~/.aws/credentials or AWS_WEB_IDENTITY_TOKEN_FILE and
+// AWS_ROLE_ARN set by EKS, the options take precedence over them
+func NewAWSConfig(ctx context.Context, opts AWSOptions) (aws.Config, error) {
+	var loadOptions []func(*awsconfig.LoadOptions) error
+	if opts.Region != "" {
+		loadOptions = append(loadOptions, awsconfig.WithRegion(opts.Region))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if opts.RoleARN == "" {
+		return cfg, nil
+	}
+
+	// The role is assumed with the credentials loaded above
+	stsClient := sts.NewFromConfig(cfg)
+	if opts.WebIdentityTokenFile != "" {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewWebIdentityRoleProvider(
+			stsClient,
+			opts.RoleARN,
+			stscreds.IdentityTokenFile(opts.WebIdentityTokenFile),
+			func(o *stscreds.WebIdentityRoleOptions) {
+				o.RoleSessionName = opts.RoleSessionName
+			},
+		))
+	} else {
+		cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(
+			stsClient,
+			opts.RoleARN,
+			func(o *stscreds.AssumeRoleOptions) {
+				if opts.RoleSessionName != "" {
+					o.RoleSessionName = opts.RoleSessionName
+				}
+			},
+		))
+	}
+
+	return cfg, nil
+}
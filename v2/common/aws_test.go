@@ -0,0 +1,27 @@
+package common_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/common"
+)
+
+func TestNewAWSConfig(t *testing.T) {
+	cfg, err := common.NewAWSConfig(context.Background(), common.AWSOptions{Region: "eu-west-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, "eu-west-1", cfg.Region)
+
+	// Assuming a role wraps the provider in a cache, nothing is requested
+	// from STS until credentials are retrieved
+	cfg, err = common.NewAWSConfig(context.Background(), common.AWSOptions{
+		Region:               "eu-west-1",
+		RoleARN:              "arn:aws:iam::123456789012:role/machinery",
+		WebIdentityTokenFile: "/var/run/secrets/token",
+	})
+	assert.NoError(t, err)
+	assert.IsType(t, new(aws.CredentialsCache), cfg.Credentials)
+}
@@ -1,6 +1,8 @@
 package common
 
 import (
+	"context"
+
 	"github.com/RichardKnop/machinery/v2/config"
 )
 
@@ -23,3 +25,9 @@ func (b *Backend) GetConfig() *config.Config {
 func (b *Backend) IsAMQP() bool {
 	return false
 }
+
+// HealthCheck returns nil, backends storing results on a server override it
+// to check they can reach it
+func (b *Backend) HealthCheck(ctx context.Context) error {
+	return nil
+}
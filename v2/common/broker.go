@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"errors"
 	"sync"
 
@@ -22,6 +23,7 @@ type Broker struct {
 	registeredTaskNames registeredTaskNames
 	retry               bool
 	retryFunc           func(chan int)
+	retryOnce           sync.Once
 	retryStopChan       chan int
 	stopChan            chan int
 }
@@ -85,6 +87,12 @@ func (b *Broker) IsTaskRegistered(name string) bool {
 	return false
 }
 
+// HealthCheck returns nil, brokers connecting to a server override it to check
+// they can reach it
+func (b *Broker) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
 // GetPendingTasks returns a slice of task.Signatures waiting in the queue
 func (b *Broker) GetPendingTasks(queue string) ([]*tasks.Signature, error) {
 	return nil, errors.New("Not implemented")
@@ -97,10 +105,21 @@ func (b *Broker) GetDelayedTasks() ([]*tasks.Signature, error) {
 
 // StartConsuming is a common part of StartConsuming method
 func (b *Broker) StartConsuming(consumerTag string, concurrency int, taskProcessor iface.TaskProcessor) {
-	if b.retryFunc == nil {
-		b.retryFunc = retry.Closure()
-	}
+	// Several workers may start consuming from the broker at once
+	b.retryOnce.Do(func() {
+		if b.retryFunc == nil {
+			b.retryFunc = retry.Closure()
+		}
+	})
+}
 
+// GetCustomPrefetch returns how many messages the task processor wants to be
+// fetched ahead of processing, or zero to keep the broker configuration
+func GetCustomPrefetch(taskProcessor iface.TaskProcessor) int {
+	if prefetcher, ok := taskProcessor.(iface.CustomPrefetcher); ok {
+		return prefetcher.CustomPrefetch()
+	}
+	return 0
 }
 
 // StopConsuming is a common part of StopConsuming
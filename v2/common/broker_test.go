@@ -72,3 +72,39 @@ func TestStopConsuming(t *testing.T) {
 		}
 	})
 }
+
+type plainProcessor struct{}
+
+func (plainProcessor) Process(signature *tasks.Signature) error { return nil }
+func (plainProcessor) CustomQueue() string                      { return "" }
+func (plainProcessor) PreConsumeHandler() bool                  { return true }
+
+func TestGetCustomPrefetch(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 0, common.GetCustomPrefetch(plainProcessor{}))
+	assert.Equal(t, 0, common.GetCustomPrefetch(&machinery.Worker{}))
+	assert.Equal(t, 5, common.GetCustomPrefetch(&machinery.Worker{Prefetch: 5}))
+}
+
+func TestUnmarshalSignatureWithContentType(t *testing.T) {
+	t.Parallel()
+
+	jsonBroker := common.NewBroker(new(config.Config))
+	msgpackBroker := common.NewBroker(&config.Config{SerializationCodec: "msgpack"})
+
+	jsonSignature, err := jsonBroker.MarshalSignature(&tasks.Signature{UUID: "jsonUUID"})
+	assert.NoError(t, err)
+	msgpackSignature, err := msgpackBroker.MarshalSignature(&tasks.Signature{UUID: "msgpackUUID"})
+	assert.NoError(t, err)
+
+	// Brokers decode signatures of either codec while a fleet migrates
+	signature := new(tasks.Signature)
+	if assert.NoError(t, msgpackBroker.UnmarshalSignatureWithContentType(jsonSignature, "", signature)) {
+		assert.Equal(t, "jsonUUID", signature.UUID)
+	}
+	signature = new(tasks.Signature)
+	if assert.NoError(t, jsonBroker.UnmarshalSignatureWithContentType(msgpackSignature, msgpackBroker.ContentType(), signature)) {
+		assert.Equal(t, "msgpackUUID", signature.UUID)
+	}
+}
@@ -0,0 +1,122 @@
+package common
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// Result compression algorithms
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressionMagic prefixes compressed task states and is followed by a byte
+// identifying the algorithm, it cannot start a JSON document or a msgpack map so
+// states stored without compression are still decoded
+const compressionMagic = "\x00MCZ"
+
+const (
+	gzipID byte = 'g'
+	zstdID byte = 'z'
+)
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+// MarshalTaskState encodes the task state with the configured codec,
+// compressed with the algorithm of the ResultCompression setting
+func (b *Backend) MarshalTaskState(taskState *tasks.TaskState) ([]byte, error) {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := codec.Marshal(taskState)
+	if err != nil {
+		return nil, err
+	}
+
+	var compression string
+	if b.cnf != nil {
+		compression = b.cnf.ResultCompression
+	}
+
+	switch compression {
+	case "":
+		return encoded, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		buf.WriteString(compressionMagic)
+		buf.WriteByte(gzipID)
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(encoded); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		initZstd()
+		dst := append([]byte(compressionMagic), zstdID)
+		return zstdEncoder.EncodeAll(encoded, dst), nil
+	default:
+		return nil, fmt.Errorf("Unknown result compression: %s", compression)
+	}
+}
+
+// UnmarshalTaskState decodes a task state encoded by MarshalTaskState, states
+// are decompressed according to their header regardless of the current setting
+func (b *Backend) UnmarshalTaskState(data []byte) (*tasks.TaskState, error) {
+	if bytes.HasPrefix(data, []byte(compressionMagic)) && len(data) > len(compressionMagic) {
+		compressed := data[len(compressionMagic)+1:]
+
+		var err error
+		switch data[len(compressionMagic)] {
+		case gzipID:
+			var reader *gzip.Reader
+			if reader, err = gzip.NewReader(bytes.NewReader(compressed)); err == nil {
+				data, err = ioutil.ReadAll(reader)
+			}
+		case zstdID:
+			initZstd()
+			data, err = zstdDecoder.DecodeAll(compressed, nil)
+		default:
+			err = fmt.Errorf("unknown algorithm %q", data[len(compressionMagic)])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Decompress task state error: %s", err)
+		}
+	}
+
+	codec, err := b.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	state := new(tasks.TaskState)
+	if err := codec.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// initZstd creates the zstd encoder and decoder, both are safe for concurrent use
+func initZstd() {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil)
+		zstdDecoder, _ = zstd.NewReader(nil)
+	})
+}
@@ -0,0 +1,65 @@
+package common_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestMarshalTaskState(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{UUID: "taskUUID", Name: "task"}
+	state := tasks.NewSuccessTaskState(signature, []*tasks.TaskResult{
+		{Type: "string", Value: strings.Repeat("result", 1000)},
+	})
+	plain, err := json.Marshal(state)
+	assert.NoError(t, err)
+
+	for _, compression := range []string{"", common.CompressionGzip, common.CompressionZstd} {
+		backend := common.NewBackend(&config.Config{ResultCompression: compression})
+
+		encoded, err := backend.MarshalTaskState(state)
+		if !assert.NoError(t, err, compression) {
+			continue
+		}
+		if compression == "" {
+			assert.Equal(t, plain, encoded)
+		} else {
+			assert.Less(t, len(encoded), len(plain), compression)
+		}
+
+		// States are decoded whatever the current setting is
+		other := common.NewBackend(new(config.Config))
+		decoded, err := other.UnmarshalTaskState(encoded)
+		if assert.NoError(t, err, compression) {
+			assert.Equal(t, tasks.StateSuccess, decoded.State)
+			assert.Equal(t, state.Results[0].Value, decoded.Results[0].Value)
+		}
+	}
+
+	backend := common.NewBackend(&config.Config{ResultCompression: "lzma"})
+	_, err = backend.MarshalTaskState(state)
+	assert.Error(t, err)
+}
+
+func TestUnmarshalTaskStateUncompressed(t *testing.T) {
+	t.Parallel()
+
+	// States stored before compression was enabled are still decoded
+	backend := common.NewBackend(&config.Config{ResultCompression: common.CompressionZstd})
+	state, err := backend.UnmarshalTaskState([]byte(`{"TaskUUID":"taskUUID","State":"SUCCESS","Results":[{"Type":"int64","Value":1}]}`))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "taskUUID", state.TaskUUID)
+		assert.Equal(t, json.Number("1"), state.Results[0].Value)
+	}
+
+	_, err = backend.UnmarshalTaskState([]byte("\x00MCZx"))
+	assert.Error(t, err)
+}
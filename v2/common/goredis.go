@@ -0,0 +1,50 @@
+package common
+
+import (
+	"crypto/tls"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+// NewGoRedisClient returns a go-redis client for the addresses, the first of
+// which may be prefixed with a "password@". A sentinel backed failover client
+// is returned when MasterName is set and a cluster client when Cluster is set
+// or several addresses are given, otherwise a single node client. Connections
+// use TLS when tlsConfig is set.
+func NewGoRedisClient(addrs []string, db int, cnf *config.RedisConfig, tlsConfig *tls.Config) redis.UniversalClient {
+	addrs = append([]string(nil), addrs...)
+
+	var password string
+	parts := strings.Split(addrs[0], "@")
+	if len(parts) >= 2 {
+		// with password
+		password = strings.Join(parts[:len(parts)-1], "@")
+		addrs[0] = parts[len(parts)-1] // addr is the last one without @
+	}
+
+	ropt := &redis.UniversalOptions{
+		Addrs:     addrs,
+		DB:        db,
+		Password:  password,
+		TLSConfig: tlsConfig,
+	}
+	if cnf != nil {
+		ropt.MasterName = cnf.MasterName
+		ropt.SentinelPassword = cnf.SentinelPassword
+
+		if cnf.Cluster && cnf.MasterName == "" {
+			return redis.NewClusterClient(ropt.Cluster())
+		}
+	}
+
+	return redis.NewUniversalClient(ropt)
+}
+
+// RedisHashTag wraps the key in a hash tag, Redis Cluster then stores all keys
+// sharing the tag in the same slot so they can be used together in transactions
+func RedisHashTag(key string) string {
+	return "{" + key + "}"
+}
@@ -0,0 +1,44 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+func TestNewGoRedisClient(t *testing.T) {
+	t.Parallel()
+
+	client := common.NewGoRedisClient([]string{"localhost:6379"}, 0, nil, nil)
+	assert.IsType(t, &redis.Client{}, client)
+
+	client = common.NewGoRedisClient([]string{"localhost:7000"}, 0, &config.RedisConfig{Cluster: true}, nil)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+
+	client = common.NewGoRedisClient([]string{"localhost:7000", "localhost:7001"}, 0, &config.RedisConfig{}, nil)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+
+	client = common.NewGoRedisClient([]string{"localhost:26379"}, 0, &config.RedisConfig{MasterName: "mymaster", Cluster: true}, nil)
+	assert.IsType(t, &redis.Client{}, client)
+}
+
+func TestNewGoRedisClientPassword(t *testing.T) {
+	t.Parallel()
+
+	addrs := []string{"secret@localhost:6379"}
+	client := common.NewGoRedisClient(addrs, 0, nil, nil).(*redis.Client)
+
+	assert.Equal(t, "localhost:6379", client.Options().Addr)
+	assert.Equal(t, "secret", client.Options().Password)
+	assert.Equal(t, "secret@localhost:6379", addrs[0])
+}
+
+func TestRedisHashTag(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "{group}", common.RedisHashTag("group"))
+}
@@ -2,6 +2,10 @@ package common
 
 import (
 	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
@@ -37,6 +41,10 @@ func (rc *RedisConnector) NewPool(socketPath, host, password string, db int, cnf
 		MaxActive:   cnf.MaxActive,
 		Wait:        cnf.Wait,
 		Dial: func() (redis.Conn, error) {
+			if rc.isSentinel(socketPath, cnf) {
+				return rc.openMaster(host, password, db, cnf, tlsConfig)
+			}
+
 			c, err := rc.open(socketPath, host, password, db, cnf, tlsConfig)
 			if err != nil {
 				return nil, err
@@ -53,6 +61,12 @@ func (rc *RedisConnector) NewPool(socketPath, host, password string, db int, cnf
 		},
 		// PINGs connections that have been idle more than 10 seconds
 		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			// The master may have been demoted by a failover since the
+			// connection was opened, drop the connection so the next
+			// dial asks the sentinels for the new master
+			if rc.isSentinel(socketPath, cnf) {
+				return checkMasterRole(c)
+			}
 			if time.Since(t) < time.Duration(10*time.Second) {
 				return nil
 			}
@@ -85,3 +99,71 @@ func (rc *RedisConnector) open(socketPath, host, password string, db int, cnf *c
 
 	return redis.Dial("tcp", host, opts...)
 }
+
+// isSentinel returns true when the host is a list of sentinels to ask for
+// the address of the master
+func (rc *RedisConnector) isSentinel(socketPath string, cnf *config.RedisConfig) bool {
+	return socketPath == "" && cnf.MasterName != ""
+}
+
+// openMaster resolves the current master through the sentinels and opens a
+// connection to it, the master is resolved again for every new connection
+func (rc *RedisConnector) openMaster(sentinels, password string, db int, cnf *config.RedisConfig, tlsConfig *tls.Config) (redis.Conn, error) {
+	addr, err := rc.masterAddr(sentinels, cnf, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := rc.open("", addr, password, db, cnf, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkMasterRole(c); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// masterAddr asks the comma separated sentinels for the address of the master
+func (rc *RedisConnector) masterAddr(sentinels string, cnf *config.RedisConfig, tlsConfig *tls.Config) (string, error) {
+	err := errors.New("No sentinel configured")
+	for _, sentinel := range strings.Split(sentinels, ",") {
+		var c redis.Conn
+		c, err = rc.open("", strings.TrimSpace(sentinel), cnf.SentinelPassword, 0, cnf, tlsConfig)
+		if err != nil {
+			continue
+		}
+
+		var reply []string
+		reply, err = redis.Strings(c.Do("SENTINEL", "get-master-addr-by-name", cnf.MasterName))
+		c.Close()
+		if err == nil && len(reply) != 2 {
+			err = fmt.Errorf("Unexpected reply from sentinel: %v", reply)
+		}
+		if err != nil {
+			continue
+		}
+
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+
+	return "", fmt.Errorf("Could not resolve master %s: %s", cnf.MasterName, err)
+}
+
+// checkMasterRole returns an error unless the connection is to a master
+func checkMasterRole(c redis.Conn) error {
+	role, err := redis.Values(c.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(role) == 0 {
+		return errors.New("Empty ROLE reply")
+	}
+	if name, _ := redis.String(role[0], nil); name != "master" {
+		return fmt.Errorf("Redis instance is not a master: %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+// fakeSentinel answers AUTH and SENTINEL get-master-addr-by-name commands
+func fakeSentinel(t *testing.T, password, masterName, masterAddr string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readCommand(r)
+					if err != nil {
+						return
+					}
+					switch {
+					case args[0] == "AUTH" && args[1] == password:
+						fmt.Fprint(conn, "+OK\r\n")
+					case args[0] == "SENTINEL" && args[2] == masterName:
+						host, port, _ := net.SplitHostPort(masterAddr)
+						fmt.Fprintf(conn, "*2\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(host), host, len(port), port)
+					default:
+						fmt.Fprint(conn, "-ERR unexpected command\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	var n int
+	if _, err := fmt.Fscanf(r, "*%d\r\n", &n); err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		var size int
+		if _, err := fmt.Fscanf(r, "$%d\r\n", &size); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := r.Read(buf); err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(string(buf), "\r\n")
+	}
+	return args, nil
+}
+
+func TestMasterAddr(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.RedisConfig{
+		MasterName:       "mymaster",
+		SentinelPassword: "secret",
+		ConnectTimeout:   1,
+	}
+	sentinel := fakeSentinel(t, "secret", "mymaster", "10.0.0.1:6380")
+
+	rc := new(RedisConnector)
+
+	// The first sentinel is down, the second one is asked
+	addr, err := rc.masterAddr("127.0.0.1:1,"+sentinel, cnf, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1:6380", addr)
+
+	_, err = rc.masterAddr(sentinel, &config.RedisConfig{MasterName: "other", SentinelPassword: "secret"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+)
+
+// RedisBrokerTLSConfig returns the TLS configuration of the broker's Redis connections
+func RedisBrokerTLSConfig(cnf *config.Config) *tls.Config {
+	var tlsCnf *config.RedisTLSConfig
+	if cnf.Redis != nil {
+		tlsCnf = cnf.Redis.BrokerTLS
+	}
+	return redisTLSConfig("broker", tlsCnf, cnf.TLSConfig)
+}
+
+// RedisBackendTLSConfig returns the TLS configuration of the result backend's Redis connections
+func RedisBackendTLSConfig(cnf *config.Config) *tls.Config {
+	var tlsCnf *config.RedisTLSConfig
+	if cnf.Redis != nil {
+		tlsCnf = cnf.Redis.BackendTLS
+	}
+	return redisTLSConfig("backend", tlsCnf, cnf.TLSConfig)
+}
+
+// RedisLockTLSConfig returns the TLS configuration of the lock's Redis connections
+func RedisLockTLSConfig(cnf *config.Config) *tls.Config {
+	var tlsCnf *config.RedisTLSConfig
+	if cnf.Redis != nil {
+		tlsCnf = cnf.Redis.LockTLS
+	}
+	return redisTLSConfig("lock", tlsCnf, cnf.TLSConfig)
+}
+
+func redisTLSConfig(component string, cnf *config.RedisTLSConfig, fallback *tls.Config) *tls.Config {
+	tlsConfig, err := NewRedisTLSConfig(cnf, fallback)
+	if err != nil {
+		log.ERROR.Printf("Invalid Redis %s TLS config: %s", component, err)
+	}
+	return tlsConfig
+}
+
+// NewRedisTLSConfig returns the TLS configuration of a Redis connection built
+// from the component's settings, or fallback when the component has none.
+// When loading a file fails the returned config is still set, so connections
+// fail the TLS handshake instead of falling back to plain text.
+func NewRedisTLSConfig(cnf *config.RedisTLSConfig, fallback *tls.Config) (*tls.Config, error) {
+	if cnf == nil {
+		return fallback, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         cnf.ServerName,
+		InsecureSkipVerify: cnf.InsecureSkipVerify,
+	}
+	if fallback != nil {
+		tlsConfig = fallback.Clone()
+		if cnf.ServerName != "" {
+			tlsConfig.ServerName = cnf.ServerName
+		}
+		if cnf.InsecureSkipVerify {
+			tlsConfig.InsecureSkipVerify = true
+		}
+	}
+
+	if cnf.CertFile != "" || cnf.KeyFile != "" {
+		if cnf.CertFile == "" || cnf.KeyFile == "" {
+			return tlsConfig, errors.New("Both a client certificate and key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(cnf.CertFile, cnf.KeyFile)
+		if err != nil {
+			return tlsConfig, fmt.Errorf("Failed to load client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if cnf.CAFile != "" {
+		pem, err := ioutil.ReadFile(cnf.CAFile)
+		if err != nil {
+			return tlsConfig, fmt.Errorf("Failed to read CA file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return tlsConfig, fmt.Errorf("No certificate found in CA file %s", cnf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return tlsConfig, nil
+}
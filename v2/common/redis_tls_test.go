@@ -0,0 +1,38 @@
+package common_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+func TestNewRedisTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	fallback := &tls.Config{ServerName: "redis.local"}
+
+	tlsConfig, err := common.NewRedisTLSConfig(nil, fallback)
+	assert.NoError(t, err)
+	assert.Equal(t, fallback, tlsConfig)
+
+	tlsConfig, err = common.NewRedisTLSConfig(&config.RedisTLSConfig{ServerName: "backend.redis.local"}, fallback)
+	assert.NoError(t, err)
+	assert.Equal(t, "backend.redis.local", tlsConfig.ServerName)
+	assert.Equal(t, "redis.local", fallback.ServerName)
+
+	// A certificate without a key is rejected but TLS stays enabled
+	tlsConfig, err = common.NewRedisTLSConfig(&config.RedisTLSConfig{CertFile: "client.crt"}, nil)
+	assert.Error(t, err)
+	assert.NotNil(t, tlsConfig)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, ioutil.WriteFile(caFile, []byte("not a certificate"), 0600))
+	_, err = common.NewRedisTLSConfig(&config.RedisTLSConfig{CAFile: caFile}, nil)
+	assert.Error(t, err)
+}
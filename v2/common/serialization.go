@@ -0,0 +1,112 @@
+package common
+
+import (
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/serialization"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// GetCodec returns the codec of the SerializationCodec setting signatures are
+// encoded with
+func (b *Broker) GetCodec() (serialization.Codec, error) {
+	return getCodec(b.cnf)
+}
+
+// MarshalSignature encodes the signature with the configured codec
+func (b *Broker) MarshalSignature(signature *tasks.Signature) ([]byte, error) {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(signature)
+}
+
+// ContentType returns the MIME type of signatures encoded with the configured
+// codec, brokers send it along with the signatures
+func (b *Broker) ContentType() string {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return serialization.JSON.ContentType()
+	}
+	return codec.ContentType()
+}
+
+// UnmarshalSignature decodes a signature encoded by MarshalSignature. A JSON
+// signature is decoded also when another codec is configured, e.g. it was
+// published before the codec changed.
+func (b *Broker) UnmarshalSignature(data []byte, signature *tasks.Signature) error {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return err
+	}
+	return serialization.Detect(data, codec).Unmarshal(data, signature)
+}
+
+// UnmarshalSignatureWithContentType decodes a signature with the codec of its
+// content type, the content type of signatures published by older versions is
+// empty and they are decoded by UnmarshalSignature
+func (b *Broker) UnmarshalSignatureWithContentType(data []byte, contentType string, signature *tasks.Signature) error {
+	if codec, ok := serialization.ForContentType(contentType); ok {
+		return codec.Unmarshal(data, signature)
+	}
+	return b.UnmarshalSignature(data, signature)
+}
+
+// GetCodec returns the codec of the SerializationCodec setting task states are
+// encoded with
+func (b *Backend) GetCodec() (serialization.Codec, error) {
+	return getCodec(b.cnf)
+}
+
+func getCodec(cnf *config.Config) (serialization.Codec, error) {
+	if cnf == nil {
+		return serialization.JSON, nil
+	}
+	return serialization.Get(cnf.SerializationCodec)
+}
+
+// MarshalTaskResult encodes a partial task result with the configured codec
+func (b *Backend) MarshalTaskResult(result *tasks.TaskResult) ([]byte, error) {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(result)
+}
+
+// UnmarshalTaskResult decodes a task result encoded by MarshalTaskResult
+func (b *Backend) UnmarshalTaskResult(data []byte) (*tasks.TaskResult, error) {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(tasks.TaskResult)
+	if err := codec.Unmarshal(data, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// MarshalFailure encodes a failed attempt of a task with the configured codec
+func (b *Backend) MarshalFailure(failure *tasks.Failure) ([]byte, error) {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+	return codec.Marshal(failure)
+}
+
+// UnmarshalFailure decodes a failed attempt encoded by MarshalFailure
+func (b *Backend) UnmarshalFailure(data []byte) (*tasks.Failure, error) {
+	codec, err := b.GetCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	failure := new(tasks.Failure)
+	if err := codec.Unmarshal(data, failure); err != nil {
+		return nil, err
+	}
+	return failure, nil
+}
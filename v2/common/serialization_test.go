@@ -0,0 +1,62 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/common"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestMarshalSignature(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{
+		UUID: "taskUUID",
+		Name: "add",
+		Args: []tasks.Arg{{Type: "int64", Value: int64(1)}},
+	}
+
+	for _, codec := range []string{"", "json", "msgpack"} {
+		broker := common.NewBroker(&config.Config{SerializationCodec: codec})
+
+		encoded, err := broker.MarshalSignature(signature)
+		require.NoError(t, err, codec)
+		if codec == "msgpack" {
+			assert.NotEqual(t, byte('{'), encoded[0])
+		}
+
+		decoded := new(tasks.Signature)
+		require.NoError(t, broker.UnmarshalSignature(encoded, decoded), codec)
+		assert.Equal(t, signature.UUID, decoded.UUID, codec)
+		assert.Equal(t, signature.Name, decoded.Name, codec)
+	}
+
+	broker := common.NewBroker(&config.Config{SerializationCodec: "xml"})
+	_, err := broker.MarshalSignature(signature)
+	assert.Error(t, err)
+}
+
+func TestMarshalTaskStateCodec(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{UUID: "taskUUID", Name: "add"}
+	state := tasks.NewSuccessTaskState(signature, []*tasks.TaskResult{{Type: "int64", Value: int64(3)}})
+
+	// The codec is applied before compression
+	for _, compression := range []string{"", common.CompressionZstd} {
+		backend := common.NewBackend(&config.Config{SerializationCodec: "msgpack", ResultCompression: compression})
+
+		encoded, err := backend.MarshalTaskState(state)
+		require.NoError(t, err, compression)
+
+		decoded, err := backend.UnmarshalTaskState(encoded)
+		if assert.NoError(t, err, compression) {
+			assert.Equal(t, tasks.StateSuccess, decoded.State)
+			assert.Equal(t, int64(3), decoded.Results[0].Value)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package machinery
+
+import (
+	"sync"
+)
+
+// concurrencyLimiter limits the number of tasks the worker processes at once,
+// unlike the pool of the broker the limit can be changed while tasks are
+// being processed
+type concurrencyLimiter struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	// limit is the number of tasks processed at once, 0 means no limit
+	limit   int
+	running int
+	// paused is set while no task is processed, see Worker.Pause
+	paused bool
+	// throttled is set while no task is processed because a resource is
+	// under pressure, see Worker.SetThrottle
+	throttled bool
+}
+
+// newConcurrencyLimiter creates a limiter with the given limit
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	l := &concurrencyLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until the task can be processed
+func (l *concurrencyLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.paused || l.throttled || (l.limit > 0 && l.running >= l.limit) {
+		l.cond.Wait()
+	}
+	l.running++
+}
+
+// release frees the slot of a processed task
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.running--
+	l.cond.Signal()
+}
+
+// setLimit changes the limit, running tasks are not interrupted when it
+// shrinks, new tasks only wait until enough of them finished
+func (l *concurrencyLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = limit
+	l.cond.Broadcast()
+}
+
+// setPaused pauses or resumes processing tasks, running tasks are not
+// interrupted
+func (l *concurrencyLimiter) setPaused(paused bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.paused = paused
+	l.cond.Broadcast()
+}
+
+// isPaused returns true if processing tasks is paused
+func (l *concurrencyLimiter) isPaused() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.paused
+}
+
+// setThrottled throttles processing tasks or stops throttling it, running
+// tasks are not interrupted
+func (l *concurrencyLimiter) setThrottled(throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.throttled = throttled
+	l.cond.Broadcast()
+}
+
+// isThrottled returns true if processing tasks is throttled
+func (l *concurrencyLimiter) isThrottled() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.throttled
+}
+
+// getLimit returns the limit
+func (l *concurrencyLimiter) getLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limit
+}
+
+// concurrencyLimiter returns the limiter of the worker, it is created with
+// the Concurrency of the worker the first time it is needed
+func (worker *Worker) concurrencyLimiter() *concurrencyLimiter {
+	worker.limiterOnce.Do(func() {
+		worker.limiter = newConcurrencyLimiter(worker.Concurrency)
+	})
+	return worker.limiter
+}
+
+// maxConcurrency returns the size of the pool the broker consumes tasks with,
+// the most tasks SetConcurrency can let the worker process at once
+func (worker *Worker) maxConcurrency() int {
+	if worker.MaxConcurrency > worker.Concurrency {
+		return worker.MaxConcurrency
+	}
+	return worker.Concurrency
+}
+
+// SetConcurrency changes the number of tasks the worker processes at once
+// without restarting it. The broker consumes tasks with a pool of
+// MaxConcurrency (or Concurrency) slots, so the concurrency can be grown up to
+// it and shrunk down to 1. Running tasks are not interrupted when it shrinks.
+func (worker *Worker) SetConcurrency(concurrency int) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if max := worker.maxConcurrency(); max > 0 && concurrency > max {
+		concurrency = max
+	}
+	worker.concurrencyLimiter().setLimit(concurrency)
+}
+
+// GetConcurrency returns the number of tasks the worker processes at once, 0
+// if it is only limited by the broker
+func (worker *Worker) GetConcurrency() int {
+	return worker.concurrencyLimiter().getLimit()
+}
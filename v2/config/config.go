@@ -3,18 +3,24 @@ package config
 import (
 	"crypto/tls"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"cloud.google.com/go/pubsub"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/gocql/gocql"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 const (
 	// DefaultResultsExpireIn is a default time used to expire task states and group metadata from the backend
 	DefaultResultsExpireIn = 3600
+	// DefaultCancelCheckInterval is a default time in seconds between checks of running tasks for cancellation
+	DefaultCancelCheckInterval = 1
+	// DefaultWorkerHeartbeatInterval is a default time in seconds between registrations of workers in the result backend
+	DefaultWorkerHeartbeatInterval = 10
 )
 
 var (
@@ -34,6 +40,13 @@ var (
 			TaskStatesTable: "task_states",
 			GroupMetasTable: "group_metas",
 		},
+		Cassandra: &CassandraConfig{
+			Keyspace:          "machinery",
+			TaskStatesTable:   "task_states",
+			GroupMetasTable:   "group_metas",
+			Consistency:       "QUORUM",
+			SerialConsistency: "SERIAL",
+		},
 		Redis: &RedisConfig{
 			MaxIdle:                3,
 			IdleTimeout:            240,
@@ -63,11 +76,178 @@ type Config struct {
 	SQS                     *SQSConfig       `yaml:"sqs"`
 	Redis                   *RedisConfig     `yaml:"redis"`
 	GCPPubSub               *GCPPubSubConfig `yaml:"-" ignored:"true"`
+	Kafka                   *KafkaConfig     `yaml:"kafka"`
+	Pulsar                  *PulsarConfig    `yaml:"pulsar"`
 	MongoDB                 *MongoDBConfig   `yaml:"-" ignored:"true"`
+	Cassandra               *CassandraConfig `yaml:"cassandra"`
 	TLSConfig               *tls.Config
 	// NoUnixSignals - when set disables signal handling in machinery
 	NoUnixSignals bool            `yaml:"no_unix_signals" envconfig:"NO_UNIX_SIGNALS"`
 	DynamoDB      *DynamoDBConfig `yaml:"dynamodb"`
+	// BrokerHealthCheckInterval - seconds a broker which failed is skipped by the
+	// failover broker before its health is checked again
+	BrokerHealthCheckInterval int `yaml:"broker_health_check_interval" envconfig:"BROKER_HEALTH_CHECK_INTERVAL"`
+	// Queues - settings of individual queues overriding the broker configuration
+	Queues map[string]QueueConfig `yaml:"queues" ignored:"true"`
+	// DeadLetterQueue - queue tasks which exhausted their retries or cannot be
+	// processed are moved to, unless their queue has its own dead letter queue
+	DeadLetterQueue string `yaml:"dead_letter_queue" envconfig:"DEAD_LETTER_QUEUE"`
+	// ClickHouse - settings of the ClickHouse task history backend
+	ClickHouse *ClickHouseConfig `yaml:"clickhouse"`
+	// ResultCompression - algorithm task states are compressed with by backends
+	// storing them serialized, gzip or zstd, they are not compressed when empty
+	ResultCompression string `yaml:"result_compression" envconfig:"RESULT_COMPRESSION"`
+	// ResultEncryptionKey - base64 encoded AES key results and errors of tasks
+	// are encrypted with by the encrypted backend wrapper
+	ResultEncryptionKey string `yaml:"result_encryption_key" envconfig:"RESULT_ENCRYPTION_KEY"`
+	// SerializationCodec - name of the codec brokers encode signatures and
+	// backends encode task states with, json, msgpack or cbor, json when empty
+	SerializationCodec string `yaml:"serialization_codec" envconfig:"SERIALIZATION_CODEC"`
+	// ResultsGCInterval - seconds between purges of expired results by workers,
+	// for backends without native TTLs, results are not purged when zero
+	ResultsGCInterval int `yaml:"results_gc_interval" envconfig:"RESULTS_GC_INTERVAL"`
+	// CancelCheckInterval - seconds between checks of the result backend for
+	// canceled running tasks, DefaultCancelCheckInterval when zero. Canceling
+	// tasks is disabled when negative, so workers do not read the state of
+	// each received task either
+	CancelCheckInterval int `yaml:"cancel_check_interval" envconfig:"CANCEL_CHECK_INTERVAL"`
+	// HeartbeatInterval - seconds between heartbeats of running tasks saved by
+	// workers in result backends recording them, no heartbeats when zero
+	HeartbeatInterval int `yaml:"heartbeat_interval" envconfig:"HEARTBEAT_INTERVAL"`
+	// StuckTaskDeadline - seconds without a heartbeat after which workers
+	// consider a started task stuck, e.g. its worker crashed, stuck tasks are
+	// not looked for when zero
+	StuckTaskDeadline int `yaml:"stuck_task_deadline" envconfig:"STUCK_TASK_DEADLINE"`
+	// RequeueStuckTasks - stuck tasks are sent again instead of failing
+	RequeueStuckTasks bool `yaml:"requeue_stuck_tasks" envconfig:"REQUEUE_STUCK_TASKS"`
+	// WorkerHeartbeatInterval - seconds between registrations of workers in
+	// result backends recording them, a worker is considered gone once it
+	// missed three, DefaultWorkerHeartbeatInterval when zero, workers are not
+	// registered when negative
+	WorkerHeartbeatInterval int `yaml:"worker_heartbeat_interval" envconfig:"WORKER_HEARTBEAT_INTERVAL"`
+	// IdempotencyWindow - seconds during which sending a task with the
+	// idempotency key of a sent task is skipped, ResultsExpireIn when zero
+	IdempotencyWindow int `yaml:"idempotency_window" envconfig:"IDEMPOTENCY_WINDOW"`
+	// MaxDeliveries - how many times a task can be delivered to workers
+	// without finishing, e.g. because it crashes them, before it is moved to
+	// the poison queue, deliveries are not counted when zero
+	MaxDeliveries int `yaml:"max_deliveries" envconfig:"MAX_DELIVERIES"`
+	// PoisonQueue - queue tasks delivered more than MaxDeliveries times are
+	// moved to, the dead letter queue of their queue when empty
+	PoisonQueue string `yaml:"poison_queue" envconfig:"POISON_QUEUE"`
+	// ShutdownTimeout - seconds a worker quitting gracefully waits for running
+	// tasks before requeueing them, running tasks are waited for when zero
+	ShutdownTimeout int `yaml:"shutdown_timeout" envconfig:"SHUTDOWN_TIMEOUT"`
+	// RateLimits - rate limits of tasks shared by every worker by task names,
+	// e.g. 100/min, see GetRateLimit
+	RateLimits map[string]string `yaml:"rate_limits" envconfig:"RATE_LIMITS"`
+	// ScheduleSyncInterval - seconds between syncs of the server with the
+	// schedules stored in result backends storing them, stored schedules are
+	// only loaded by Server.SyncSchedules when zero
+	ScheduleSyncInterval int `yaml:"schedule_sync_interval" envconfig:"SCHEDULE_SYNC_INTERVAL"`
+	// CronWithSeconds - cron specs of periodic tasks may have six fields, the
+	// first one being seconds, specs with five fields keep their meaning
+	CronWithSeconds bool `yaml:"cron_with_seconds" envconfig:"CRON_WITH_SECONDS"`
+	// SchedulerLeaseTTL - seconds the leader elected among servers holds its
+	// lease, renewed every third of it, only the leader sends periodic tasks
+	// and another server takes over once the lease of a leader which died
+	// expired, every server tries to send them when zero
+	SchedulerLeaseTTL int `yaml:"scheduler_lease_ttl" envconfig:"SCHEDULER_LEASE_TTL"`
+	// Consul - settings of the sessions of the Consul lock
+	Consul *ConsulConfig `yaml:"consul"`
+}
+
+// QueueConfig holds settings of a single queue, zero values fall back to
+// the global broker configuration
+type QueueConfig struct {
+	// PrefetchCount - AMQP prefetch count, or SQS messages received at once (up to 10)
+	PrefetchCount int `yaml:"prefetch_count"`
+	// VisibilityTimeout - SQS visibility timeout in seconds
+	VisibilityTimeout *int `yaml:"visibility_timeout"`
+	// BindingKey - AMQP binding key of the queue
+	BindingKey string `yaml:"binding_key"`
+	// MaxPriority - AMQP highest priority supported by the queue, from 1 to 255
+	MaxPriority uint8 `yaml:"max_priority"`
+	// DeadLetterQueue - queue messages which cannot be processed are moved to
+	DeadLetterQueue string `yaml:"dead_letter_queue"`
+}
+
+// GetQueueConfig returns the settings of the queue
+func (c *Config) GetQueueConfig(queue string) QueueConfig {
+	return c.Queues[queue]
+}
+
+// GetDeadLetterQueue returns the dead letter queue of the queue, or an empty
+// string if it has none. A dead letter queue does not have one itself
+func (c *Config) GetDeadLetterQueue(queue string) string {
+	deadLetterQueue := c.GetQueueConfig(queue).DeadLetterQueue
+	if deadLetterQueue == "" {
+		deadLetterQueue = c.DeadLetterQueue
+	}
+	if deadLetterQueue == queue {
+		return ""
+	}
+	return deadLetterQueue
+}
+
+// GetPoisonQueue returns the poison queue of the queue, its dead letter queue
+// when no poison queue is configured, or an empty string if it has none
+func (c *Config) GetPoisonQueue(queue string) string {
+	if c.PoisonQueue == "" {
+		return c.GetDeadLetterQueue(queue)
+	}
+	if c.PoisonQueue == queue {
+		return ""
+	}
+	return c.PoisonQueue
+}
+
+// GetRateLimit returns how many times the task can be processed per period,
+// zero if it is not rate limited. Rate limits are written as a number of tasks
+// per second, minute or hour, e.g. 100/min, or per duration, e.g. 10/30s.
+func (c *Config) GetRateLimit(name string) (int, time.Duration, error) {
+	rateLimit, ok := c.RateLimits[name]
+	if !ok {
+		return 0, 0, nil
+	}
+
+	parts := strings.SplitN(rateLimit, "/", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Rate limit %q of task %s is not a number per period", rateLimit, name)
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || limit < 1 {
+		return 0, 0, fmt.Errorf("Rate limit %q of task %s is not a positive number per period", rateLimit, name)
+	}
+
+	var per time.Duration
+	switch period := strings.TrimSpace(parts[1]); period {
+	case "s", "sec", "second":
+		per = time.Second
+	case "m", "min", "minute":
+		per = time.Minute
+	case "h", "hour":
+		per = time.Hour
+	default:
+		if per, err = time.ParseDuration(period); err != nil || per <= 0 {
+			return 0, 0, fmt.Errorf("Rate limit %q of task %s has an invalid period", rateLimit, name)
+		}
+	}
+	return limit, per, nil
+}
+
+// BrokerURLs returns the list of broker URLs, Broker may contain several URLs
+// separated by MultipleBrokerSeparator
+func (c *Config) BrokerURLs() []string {
+	if c.MultipleBrokerSeparator == "" {
+		return []string{c.Broker}
+	}
+
+	urls := strings.Split(c.Broker, c.MultipleBrokerSeparator)
+	for i, url := range urls {
+		urls[i] = strings.TrimSpace(url)
+	}
+	return urls
 }
 
 // QueueBindingArgs arguments which are used when binding to the exchange
@@ -85,22 +265,68 @@ type AMQPConfig struct {
 	BindingKey       string           `yaml:"binding_key" envconfig:"AMQP_BINDING_KEY"`
 	PrefetchCount    int              `yaml:"prefetch_count" envconfig:"AMQP_PREFETCH_COUNT"`
 	AutoDelete       bool             `yaml:"auto_delete" envconfig:"AMQP_AUTO_DELETE"`
+	// QueueType - classic (default), quorum or stream
+	QueueType          string `yaml:"queue_type" envconfig:"AMQP_QUEUE_TYPE"`
+	DeliveryLimit      int    `yaml:"delivery_limit" envconfig:"AMQP_DELIVERY_LIMIT"`
+	DeadLetterExchange string `yaml:"dead_letter_exchange" envconfig:"AMQP_DEAD_LETTER_EXCHANGE"`
+	StreamOffset       string `yaml:"stream_offset" envconfig:"AMQP_STREAM_OFFSET"`
+	// PublisherConfirms - wait for every published message, including delayed ones,
+	// to be confirmed by the broker for up to ConfirmTimeout seconds
+	PublisherConfirms bool `yaml:"publisher_confirms" envconfig:"AMQP_PUBLISHER_CONFIRMS"`
+	ConfirmTimeout    int  `yaml:"confirm_timeout" envconfig:"AMQP_CONFIRM_TIMEOUT"`
+	// ChannelPoolSize - maximum number of idle channels kept open on the shared
+	// connection used for delayed tasks and by the AMQP result backend
+	ChannelPoolSize int `yaml:"channel_pool_size" envconfig:"AMQP_CHANNEL_POOL_SIZE"`
+	// DelayedMessageExchange - name of an exchange of the rabbitmq_delayed_message_exchange
+	// plugin, when set delayed tasks are published to it instead of TTL queues
+	DelayedMessageExchange string `yaml:"delayed_message_exchange" envconfig:"AMQP_DELAYED_MESSAGE_EXCHANGE"`
+	// MaxPriority - highest priority supported by the queues, from 1 to 255,
+	// zero declares queues without priorities
+	MaxPriority uint8 `yaml:"max_priority" envconfig:"AMQP_MAX_PRIORITY"`
 }
 
 // DynamoDBConfig wraps DynamoDB related configuration
 type DynamoDBConfig struct {
-	Client          *dynamodb.DynamoDB
+	Client          *dynamodb.Client
 	TaskStatesTable string `yaml:"task_states_table" envconfig:"TASK_STATES_TABLE"`
 	GroupMetasTable string `yaml:"group_metas_table" envconfig:"GROUP_METAS_TABLE"`
+	// Region, Endpoint (e.g. LocalStack), RoleARN, RoleSessionName and WebIdentityTokenFile
+	// configure the client created when Client is not set
+	Region               string `yaml:"region" envconfig:"DYNAMODB_REGION"`
+	Endpoint             string `yaml:"endpoint" envconfig:"DYNAMODB_ENDPOINT"`
+	RoleARN              string `yaml:"role_arn" envconfig:"DYNAMODB_ROLE_ARN"`
+	RoleSessionName      string `yaml:"role_session_name" envconfig:"DYNAMODB_ROLE_SESSION_NAME"`
+	WebIdentityTokenFile string `yaml:"web_identity_token_file" envconfig:"DYNAMODB_WEB_IDENTITY_TOKEN_FILE"`
+	// CreateTables - create missing tables on startup and enable their TTL attribute
+	CreateTables bool `yaml:"create_tables" envconfig:"DYNAMODB_CREATE_TABLES"`
+	// ReadCapacityUnits and WriteCapacityUnits - provisioned throughput of created tables
+	// and indexes, tables are created with on-demand billing when they are zero
+	ReadCapacityUnits  int64 `yaml:"read_capacity_units" envconfig:"DYNAMODB_READ_CAPACITY_UNITS"`
+	WriteCapacityUnits int64 `yaml:"write_capacity_units" envconfig:"DYNAMODB_WRITE_CAPACITY_UNITS"`
+	// GroupIndex - name of a global secondary index of the task states table by
+	// group UUID, it is added when the table is created
+	GroupIndex string `yaml:"group_index" envconfig:"DYNAMODB_GROUP_INDEX"`
 }
 
 // SQSConfig wraps SQS related configuration
 type SQSConfig struct {
-	Client          *sqs.SQS
+	Client          *sqs.Client
 	WaitTimeSeconds int `yaml:"receive_wait_time_seconds" envconfig:"SQS_WAIT_TIME_SECONDS"`
 	// https://docs.aws.amazon.com/AWSSimpleQueueService/latest/SQSDeveloperGuide/sqs-visibility-timeout.html
 	// visibility timeout should default to nil to use the overall visibility timeout for the queue
 	VisibilityTimeout *int `yaml:"receive_visibility_timeout" envconfig:"SQS_VISIBILITY_TIMEOUT"`
+	// MaxNumberOfMessages received with a single request (up to 10), processed messages are then deleted in batches too
+	MaxNumberOfMessages int `yaml:"receive_max_number_of_messages" envconfig:"SQS_MAX_NUMBER_OF_MESSAGES"`
+	// Region, Endpoint (e.g. LocalStack), RoleARN, RoleSessionName and WebIdentityTokenFile
+	// configure the client created when Client is not set
+	Region               string `yaml:"region" envconfig:"SQS_REGION"`
+	Endpoint             string `yaml:"endpoint" envconfig:"SQS_ENDPOINT"`
+	RoleARN              string `yaml:"role_arn" envconfig:"SQS_ROLE_ARN"`
+	RoleSessionName      string `yaml:"role_session_name" envconfig:"SQS_ROLE_SESSION_NAME"`
+	WebIdentityTokenFile string `yaml:"web_identity_token_file" envconfig:"SQS_WEB_IDENTITY_TOKEN_FILE"`
+	// PriorityQueues makes the broker send medium and high priority tasks to separate
+	// queues received from before the queue, they have to be created too
+	PriorityQueues bool `yaml:"priority_queues" envconfig:"SQS_PRIORITY_QUEUES"`
 }
 
 // RedisConfig ...
@@ -149,18 +375,173 @@ type RedisConfig struct {
 
 	// MasterName specifies a redis master name in order to configure a sentinel-backed redis FailoverClient
 	MasterName string `yaml:"master_name" envconfig:"REDIS_MASTER_NAME"`
+
+	// SentinelPassword is used to authenticate with the sentinels, which may differ
+	// from the password of the master
+	SentinelPassword string `yaml:"sentinel_password" envconfig:"REDIS_SENTINEL_PASSWORD"`
+
+	// Cluster makes the go-redis broker and backend use a Redis Cluster client even
+	// with a single seed address, group meta data keys are then hash tagged
+	Cluster bool `yaml:"cluster" envconfig:"REDIS_CLUSTER"`
+
+	// HashTagKeys hash tags the keys of the result backend so the group meta data
+	// and the states of the tasks of a group are stored in the slot of the group
+	HashTagKeys bool `yaml:"hash_tag_keys" envconfig:"REDIS_HASH_TAG_KEYS"`
+
+	// KeyNamespace prefixes all keys of the result backend, e.g. "machinery:"
+	KeyNamespace string `yaml:"key_namespace" envconfig:"REDIS_KEY_NAMESPACE"`
+
+	// NotifyStateChanges makes the result backend publish task states on a pub/sub
+	// channel when they change, so results are waited for without polling
+	NotifyStateChanges bool `yaml:"notify_state_changes" envconfig:"REDIS_NOTIFY_STATE_CHANGES"`
+
+	// ReadReplicas are addresses of replicas, in the form [password@]host:port, the
+	// result backend reads polled task states from instead of the primary
+	ReadReplicas []string `yaml:"read_replicas" envconfig:"REDIS_READ_REPLICAS"`
+
+	// ReplicaMaxStaleness specifies the time in seconds since a replica last heard
+	// from its primary after which it is not read from. It is not checked when zero.
+	ReplicaMaxStaleness int `yaml:"replica_max_staleness" envconfig:"REDIS_REPLICA_MAX_STALENESS"`
+
+	// StreamConsumerGroup specifies the consumer group used by the redis streams broker
+	// Default: machinery
+	StreamConsumerGroup string `yaml:"stream_consumer_group" envconfig:"REDIS_STREAM_CONSUMER_GROUP"`
+
+	// StreamClaimMinIdle specifies the time in seconds a message has to stay unacknowledged
+	// before the redis streams broker reclaims it from a crashed consumer
+	// Default: 300
+	StreamClaimMinIdle int `yaml:"stream_claim_min_idle" envconfig:"REDIS_STREAM_CLAIM_MIN_IDLE"`
+
+	// BrokerTLS, BackendTLS and LockTLS configure TLS of the connections of the broker,
+	// the result backend and the lock, which may be different Redis instances.
+	// When not set, TLSConfig is used.
+	BrokerTLS  *RedisTLSConfig `yaml:"broker_tls" ignored:"true"`
+	BackendTLS *RedisTLSConfig `yaml:"backend_tls" ignored:"true"`
+	LockTLS    *RedisTLSConfig `yaml:"lock_tls" ignored:"true"`
+
+	// PriorityQueues makes the broker place medium and high priority tasks on
+	// separate lists consumed before the queue, with a Redis Cluster the queue
+	// names have to be hash tagged, e.g. "{machinery_tasks}"
+	PriorityQueues bool `yaml:"priority_queues" envconfig:"REDIS_PRIORITY_QUEUES"`
+}
+
+// RedisTLSConfig holds the TLS settings of connections to a Redis instance,
+// a client certificate and key enable mutual TLS
+type RedisTLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CAFile - PEM encoded certificates used to verify the server instead of the system ones
+	CAFile string `yaml:"ca_file"`
+	// ServerName - overrides the host name the server certificate is verified against
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
 }
 
 // GCPPubSubConfig wraps GCP PubSub related configuration
 type GCPPubSubConfig struct {
 	Client       *pubsub.Client
 	MaxExtension time.Duration
+	// EnableOrdering - publish tasks with their routing key as the ordering key, tasks
+	// are delivered in order by subscriptions created with message ordering enabled
+	EnableOrdering bool
+	// ExactlyOnce - wait for every acknowledgement to be confirmed by Pub/Sub, the
+	// subscription must be created with exactly-once delivery enabled
+	ExactlyOnce bool
+	// MinExtensionPeriod and MaxExtensionPeriod - bounds of each extension of the
+	// ack deadline while a task runs, between 10s and 600s
+	MinExtensionPeriod time.Duration
+	MaxExtensionPeriod time.Duration
+}
+
+// KafkaConfig wraps Kafka related configuration
+type KafkaConfig struct {
+	// ConsumerGroup is the consumer group workers join, partitions of a topic
+	// are balanced between all workers of the same group.
+	// Default: machinery
+	ConsumerGroup string `yaml:"consumer_group" envconfig:"KAFKA_CONSUMER_GROUP"`
+
+	// Partitions is the number of partitions used when the broker creates a topic
+	// for a routing key. When zero, topics are not created by the broker.
+	Partitions int `yaml:"partitions" envconfig:"KAFKA_PARTITIONS"`
+
+	// ReplicationFactor is used together with Partitions when creating topics.
+	// Default: 1
+	ReplicationFactor int `yaml:"replication_factor" envconfig:"KAFKA_REPLICATION_FACTOR"`
+
+	// MessageKey is the strategy keying published messages, which decides
+	// their partition: uuid, message_group or routing_key.
+	// Default: uuid
+	MessageKey string `yaml:"message_key" envconfig:"KAFKA_MESSAGE_KEY"`
+}
+
+// PulsarConfig wraps Apache Pulsar related configuration
+type PulsarConfig struct {
+	// SubscriptionName is the shared subscription all workers consume from.
+	// Default: machinery
+	SubscriptionName string `yaml:"subscription_name" envconfig:"PULSAR_SUBSCRIPTION_NAME"`
+
+	// MaxDeliveries is the number of times a negatively acknowledged message is
+	// delivered before it is moved to DeadLetterTopic. When zero, messages are
+	// redelivered forever.
+	MaxDeliveries uint32 `yaml:"max_deliveries" envconfig:"PULSAR_MAX_DELIVERIES"`
+
+	// DeadLetterTopic receives messages that exceeded MaxDeliveries.
+	// Default: <topic>-<subscription>-DLQ
+	DeadLetterTopic string `yaml:"dead_letter_topic" envconfig:"PULSAR_DEAD_LETTER_TOPIC"`
 }
 
 // MongoDBConfig ...
 type MongoDBConfig struct {
 	Client   *mongo.Client
 	Database string
+	// ReadFromSecondaries makes the backend read polled task states from
+	// secondaries of the replica set, falling back to the primary
+	ReadFromSecondaries bool
+	// MaxStaleness is the time in seconds a secondary may lag behind the primary
+	// to be read from, at least 90. It is not limited when zero.
+	MaxStaleness int
+}
+
+// CassandraConfig wraps Cassandra / ScyllaDB related configuration
+type CassandraConfig struct {
+	// Session is used instead of connecting to the hosts passed to the backend
+	Session *gocql.Session `yaml:"-" ignored:"true"`
+	// Keyspace the tables are created in, it has to exist.
+	// Default: machinery
+	Keyspace        string `yaml:"keyspace" envconfig:"CASSANDRA_KEYSPACE"`
+	TaskStatesTable string `yaml:"task_states_table" envconfig:"CASSANDRA_TASK_STATES_TABLE"`
+	GroupMetasTable string `yaml:"group_metas_table" envconfig:"CASSANDRA_GROUP_METAS_TABLE"`
+	// Consistency of reads and writes, e.g. ONE, LOCAL_QUORUM or QUORUM.
+	// Default: QUORUM
+	Consistency string `yaml:"consistency" envconfig:"CASSANDRA_CONSISTENCY"`
+	// SerialConsistency of the lightweight transaction triggering chords,
+	// SERIAL or LOCAL_SERIAL.
+	// Default: SERIAL
+	SerialConsistency string `yaml:"serial_consistency" envconfig:"CASSANDRA_SERIAL_CONSISTENCY"`
+}
+
+// ClickHouseConfig wraps ClickHouse related configuration
+type ClickHouseConfig struct {
+	// Table state transitions are appended to, it is created if it does not exist.
+	// Default: task_history
+	Table string `yaml:"table" envconfig:"CLICKHOUSE_TABLE"`
+	// WorkerID identifies the process recording the transitions.
+	// Default: <hostname>:<pid>
+	WorkerID string `yaml:"worker_id" envconfig:"CLICKHOUSE_WORKER_ID"`
+}
+
+// ConsulConfig wraps settings of the sessions of the Consul lock
+type ConsulConfig struct {
+	// SessionTTL is the TTL of the session holding the locks in seconds, it is
+	// renewed while the process runs and the locks are deleted once it expired.
+	// Default: 15
+	SessionTTL int `yaml:"session_ttl" envconfig:"CONSUL_SESSION_TTL"`
+	// LockDelay is how long in seconds locks deleted because their session
+	// expired cannot be taken again, so their holder notices it lost them
+	// before anyone else takes them, a millisecond when negative as Consul
+	// takes a delay of zero as its default.
+	// Default: 15
+	LockDelay int `yaml:"lock_delay" envconfig:"CONSUL_LOCK_DELAY"`
 }
 
 // Decode from yaml to map (any field whose type or pointer-to-type implements
@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+)
+
+// delayedTask is an encoded task waiting for its ETA
+type delayedTask struct {
+	eta time.Time
+	msg []byte
+}
+
+// Store keeps delayed tasks in memory, they are lost when the process exits
+type Store struct {
+	mu    sync.Mutex
+	tasks []delayedTask // sorted by ETA, tasks with the same ETA in the order they were added
+}
+
+// New creates a new in-memory store
+func New() delayedtasks.Store {
+	return new(Store)
+}
+
+// Add keeps the encoded task until its ETA
+func (s *Store) Add(eta time.Time, msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := sort.Search(len(s.tasks), func(i int) bool { return s.tasks[i].eta.After(eta) })
+	s.tasks = append(s.tasks, delayedTask{})
+	copy(s.tasks[i+1:], s.tasks[i:])
+	s.tasks[i] = delayedTask{eta: eta, msg: msg}
+	return nil
+}
+
+// TakeDue removes up to limit tasks whose ETA is not after now and returns
+// them, all the due tasks when limit is not positive
+func (s *Store) TakeDue(now time.Time, limit int) ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	due := sort.Search(len(s.tasks), func(i int) bool { return s.tasks[i].eta.After(now) })
+	if limit > 0 && due > limit {
+		due = limit
+	}
+
+	msgs := make([][]byte, due)
+	for i := range msgs {
+		msgs[i] = s.tasks[i].msg
+	}
+	s.tasks = append(s.tasks[:0:0], s.tasks[due:]...)
+	return msgs, nil
+}
+
+// Ack does nothing, TakeDue removes the tasks it hands out right away as they
+// would be lost with the process anyway
+func (s *Store) Ack(msgs ...[]byte) error {
+	return nil
+}
+
+// List returns the tasks kept in the store, the earliest first
+func (s *Store) List() ([][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := make([][]byte, len(s.tasks))
+	for i, task := range s.tasks {
+		msgs[i] = task.msg
+	}
+	return msgs, nil
+}
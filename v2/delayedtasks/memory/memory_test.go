@@ -0,0 +1,43 @@
+package memory_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/delayedtasks/memory"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+
+	store := memory.New()
+	now := time.Now().UTC()
+
+	require.NoError(t, store.Add(now.Add(time.Minute), []byte("later")))
+	require.NoError(t, store.Add(now.Add(-time.Second), []byte("first")))
+	require.NoError(t, store.Add(now.Add(-time.Second), []byte("second")))
+	require.NoError(t, store.Add(now, []byte("now")))
+
+	msgs, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("first"), []byte("second"), []byte("now"), []byte("later")}, msgs)
+
+	due, err := store.TakeDue(now, 2)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("first"), []byte("second")}, due)
+
+	due, err = store.TakeDue(now, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("now")}, due)
+
+	due, err = store.TakeDue(now, 0)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	msgs, err = store.List()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("later")}, msgs)
+}
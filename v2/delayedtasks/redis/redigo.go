@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+)
+
+var takeDueScriptRedigo = redis.NewScript(1, takeDueSource)
+
+// RedigoStore is the Store of delayed tasks using a redigo connection pool,
+// e.g. the one of the redigo based Redis broker
+type RedigoStore struct {
+	pool       *redis.Pool
+	key        string
+	ackTimeout time.Duration
+}
+
+// NewRedigo creates a new store keeping delayed tasks in the ZSET key, which
+// hands out tasks again when they are not acknowledged within ackTimeout
+func NewRedigo(pool *redis.Pool, key string, ackTimeout time.Duration) delayedtasks.Store {
+	return &RedigoStore{pool: pool, key: key, ackTimeout: ackTimeout}
+}
+
+// Add keeps the encoded task until its ETA
+func (s *RedigoStore) Add(eta time.Time, msg []byte) error {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("ZADD", s.key, eta.UnixNano(), msg)
+	return err
+}
+
+// TakeDue hands out up to limit tasks whose ETA is not after now, all the due
+// tasks when limit is not positive
+func (s *RedigoStore) TakeDue(now time.Time, limit int) ([][]byte, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	args := append([]interface{}{s.key}, takeDueArgs(now, limit, s.ackTimeout)...)
+	return redis.ByteSlices(takeDueScriptRedigo.Do(conn, args...))
+}
+
+// Ack removes the tasks from the ZSET
+func (s *RedigoStore) Ack(msgs ...[]byte) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{s.key}
+	for _, msg := range msgs {
+		args = append(args, msg)
+	}
+	_, err := conn.Do("ZREM", args...)
+	return err
+}
+
+// List returns the tasks kept in the store, the earliest first, including
+// tasks handed out but not acknowledged yet
+func (s *RedigoStore) List() ([][]byte, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	return redis.ByteSlices(conn.Do("ZRANGE", s.key, 0, -1))
+}
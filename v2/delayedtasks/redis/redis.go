@@ -0,0 +1,112 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+)
+
+// DefaultAckTimeout is how long the Redis stores wait for a task they handed
+// out to be acknowledged before handing it out again
+const DefaultAckTimeout = time.Minute
+
+// takeDueSource hands out the tasks due at ARGV[1] from the ZSET, up to ARGV[2]
+// or all of them when it is -1, and returns them. The tasks are kept in the
+// ZSET scored by ARGV[3], the time they are handed out again unless they have
+// been acknowledged. Running it as a script takes each task once even when
+// many workers poll the same ZSET.
+const takeDueSource = `
+local items = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, item in ipairs(items) do
+	redis.call("ZADD", KEYS[1], "XX", ARGV[3], item)
+end
+return items
+`
+
+var takeDueScript = redis.NewScript(takeDueSource)
+
+// Store keeps delayed tasks in a Redis ZSET scored by the Unix time of their
+// ETA in nanoseconds, the same layout the Redis brokers use, so the tasks are
+// persisted as far as Redis persists them. Tasks handed out stay in the ZSET,
+// scored by when they are handed out again, until they are acknowledged, so
+// they are not lost when a worker dies before publishing them.
+type Store struct {
+	client     redis.UniversalClient
+	key        string
+	ackTimeout time.Duration
+}
+
+// New creates a new store keeping delayed tasks in the ZSET key, which hands
+// out tasks again when they are not acknowledged within DefaultAckTimeout
+func New(client redis.UniversalClient, key string) delayedtasks.Store {
+	return NewWithAckTimeout(client, key, DefaultAckTimeout)
+}
+
+// NewWithAckTimeout creates a new store keeping delayed tasks in the ZSET key,
+// which hands out tasks again when they are not acknowledged within ackTimeout
+func NewWithAckTimeout(client redis.UniversalClient, key string, ackTimeout time.Duration) delayedtasks.Store {
+	return &Store{client: client, key: key, ackTimeout: ackTimeout}
+}
+
+// Add keeps the encoded task until its ETA
+func (s *Store) Add(eta time.Time, msg []byte) error {
+	return s.client.ZAdd(context.Background(), s.key, &redis.Z{Score: float64(eta.UnixNano()), Member: msg}).Err()
+}
+
+// TakeDue hands out up to limit tasks whose ETA is not after now, all the due
+// tasks when limit is not positive
+func (s *Store) TakeDue(now time.Time, limit int) ([][]byte, error) {
+	items, err := takeDueScript.Run(
+		context.Background(), s.client, []string{s.key}, takeDueArgs(now, limit, s.ackTimeout)...,
+	).StringSlice()
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+	return toBytes(items), nil
+}
+
+// Ack removes the tasks from the ZSET
+func (s *Store) Ack(msgs ...[]byte) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(msgs))
+	for i, msg := range msgs {
+		members[i] = msg
+	}
+	return s.client.ZRem(context.Background(), s.key, members...).Err()
+}
+
+// List returns the tasks kept in the store, the earliest first, including
+// tasks handed out but not acknowledged yet
+func (s *Store) List() ([][]byte, error) {
+	items, err := s.client.ZRange(context.Background(), s.key, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return toBytes(items), nil
+}
+
+// takeDueArgs returns the arguments of the take due script
+func takeDueArgs(now time.Time, limit int, ackTimeout time.Duration) []interface{} {
+	if limit <= 0 {
+		limit = -1
+	}
+	return []interface{}{
+		strconv.FormatInt(now.UnixNano(), 10),
+		limit,
+		strconv.FormatInt(now.Add(ackTimeout).UnixNano(), 10),
+	}
+}
+
+func toBytes(items []string) [][]byte {
+	msgs := make([][]byte, len(items))
+	for i, item := range items {
+		msgs[i] = []byte(item)
+	}
+	return msgs
+}
@@ -0,0 +1,111 @@
+package redis_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	redigo "github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+	"github.com/RichardKnop/machinery/v2/delayedtasks/redis"
+)
+
+func newClient(t *testing.T) goredis.UniversalClient {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	client := goredis.NewUniversalClient(&goredis.UniversalOptions{
+		Addrs:    []string{redisURL},
+		Password: os.Getenv("REDIS_PASSWORD"),
+	})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestStore(t *testing.T) {
+	client := newClient(t)
+
+	key := "test_delayed_tasks"
+	client.Del(context.Background(), key)
+	defer client.Del(context.Background(), key)
+
+	testStore(t, redis.New(client, key))
+}
+
+func TestRedigoStore(t *testing.T) {
+	client := newClient(t)
+
+	key := "test_delayed_tasks_redigo"
+	client.Del(context.Background(), key)
+	defer client.Del(context.Background(), key)
+
+	pool := &redigo.Pool{Dial: func() (redigo.Conn, error) {
+		return redigo.Dial("tcp", os.Getenv("REDIS_URL"), redigo.DialPassword(os.Getenv("REDIS_PASSWORD")))
+	}}
+	defer pool.Close()
+
+	testStore(t, redis.NewRedigo(pool, key, redis.DefaultAckTimeout))
+}
+
+func testStore(t *testing.T, store delayedtasks.Store) {
+	now := time.Now().UTC()
+
+	require.NoError(t, store.Add(now.Add(time.Minute), []byte("later")))
+	require.NoError(t, store.Add(now.Add(-2*time.Second), []byte("first")))
+	require.NoError(t, store.Add(now.Add(-time.Second), []byte("second")))
+
+	msgs, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("first"), []byte("second"), []byte("later")}, msgs)
+
+	due, err := store.TakeDue(now, 1)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("first")}, due)
+
+	due, err = store.TakeDue(now, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("second")}, due)
+
+	due, err = store.TakeDue(now, 0)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	// The tasks handed out are kept until they are acknowledged
+	require.NoError(t, store.Ack([]byte("first"), []byte("second")))
+	msgs, err = store.List()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("later")}, msgs)
+}
+
+func TestStoreAckTimeout(t *testing.T) {
+	client := newClient(t)
+
+	key := "test_delayed_tasks_ack_timeout"
+	client.Del(context.Background(), key)
+	defer client.Del(context.Background(), key)
+
+	store := redis.NewWithAckTimeout(client, key, time.Second)
+	now := time.Now().UTC()
+	require.NoError(t, store.Add(now.Add(-time.Second), []byte("foo")))
+
+	due, err := store.TakeDue(now, 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("foo")}, due)
+
+	// A task which is not acknowledged, e.g. because the worker died before
+	// publishing it, is handed out again once the ack timeout passed
+	due, err = store.TakeDue(now.Add(500*time.Millisecond), 0)
+	require.NoError(t, err)
+	assert.Empty(t, due)
+
+	due, err = store.TakeDue(now.Add(time.Second), 0)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("foo")}, due)
+}
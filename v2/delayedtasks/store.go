@@ -0,0 +1,53 @@
+package delayedtasks
+
+import (
+	"time"
+)
+
+// Store keeps encoded tasks published with an ETA in the future until they are
+// due. Stores shared by several workers, e.g. the Redis store, must hand out
+// each due task once across all of them. The tasks survive restarts of the
+// workers as long as the store itself persists them, which the memory store
+// does not. Persistent stores keep the tasks they handed out until they are
+// acknowledged, and hand them out again if they never are, e.g. because the
+// worker publishing them died.
+type Store interface {
+	// Add keeps the encoded task until its ETA, a task handed out by TakeDue
+	// is due again at the ETA instead
+	Add(eta time.Time, msg []byte) error
+	// TakeDue hands out up to limit tasks whose ETA is not after now, the
+	// earliest first. They are no longer due, but kept until they are
+	// acknowledged.
+	TakeDue(now time.Time, limit int) ([][]byte, error)
+	// Ack removes tasks handed out by TakeDue from the store once they have
+	// been published
+	Ack(msgs ...[]byte) error
+	// List returns the tasks kept in the store, the earliest first
+	List() ([][]byte, error)
+}
+
+// Forward takes up to limit tasks due at now from the store, publishes them
+// and acknowledges each task once it has been published. Tasks which could
+// not be published are added back to the store, due at now, so they are
+// published on the next attempt.
+func Forward(store Store, now time.Time, limit int, publish func(msg []byte) error) (int, error) {
+	due, err := store.TakeDue(now, limit)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, msg := range due {
+		if err := publish(msg); err != nil {
+			for _, unpublished := range due[i:] {
+				if addErr := store.Add(now, unpublished); addErr != nil {
+					return i, addErr
+				}
+			}
+			return i, err
+		}
+		if err := store.Ack(msg); err != nil {
+			return i, err
+		}
+	}
+	return len(due), nil
+}
@@ -0,0 +1,65 @@
+package delayedtasks_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/delayedtasks"
+	"github.com/RichardKnop/machinery/v2/delayedtasks/memory"
+)
+
+// ackRecordingStore records the tasks acknowledged
+type ackRecordingStore struct {
+	delayedtasks.Store
+	acked []string
+}
+
+func (s *ackRecordingStore) Ack(msgs ...[]byte) error {
+	for _, msg := range msgs {
+		s.acked = append(s.acked, string(msg))
+	}
+	return nil
+}
+
+func TestForward(t *testing.T) {
+	t.Parallel()
+
+	store := &ackRecordingStore{Store: memory.New()}
+	now := time.Now().UTC()
+	for _, msg := range []string{"foo", "bar", "baz"} {
+		require.NoError(t, store.Add(now.Add(-time.Second), []byte(msg)))
+	}
+	require.NoError(t, store.Add(now.Add(time.Minute), []byte("later")))
+
+	var published []string
+	forwarded, err := delayedtasks.Forward(store, now, 0, func(msg []byte) error {
+		if string(msg) == "bar" {
+			return errors.New("publish failed")
+		}
+		published = append(published, string(msg))
+		return nil
+	})
+	assert.EqualError(t, err, "publish failed")
+	assert.Equal(t, 1, forwarded)
+	assert.Equal(t, []string{"foo"}, published)
+	// Only the published tasks are acknowledged
+	assert.Equal(t, []string{"foo"}, store.acked)
+
+	// The tasks which were not published are due again
+	forwarded, err = delayedtasks.Forward(store, now, 1, func(msg []byte) error {
+		published = append(published, string(msg))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, forwarded)
+	assert.Equal(t, []string{"foo", "bar"}, published)
+	assert.Equal(t, []string{"foo", "bar"}, store.acked)
+
+	msgs, err := store.List()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("baz"), []byte("later")}, msgs)
+}
@@ -0,0 +1,145 @@
+package machinery
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// requeueGracePeriod is how long a worker quitting waits for the tasks it
+// requeued to return once their contexts have been canceled
+const requeueGracePeriod = 5 * time.Second
+
+// DrainStatus is the status of a worker quitting gracefully
+type DrainStatus struct {
+	// Draining is set once the worker stopped consuming
+	Draining bool
+	// Drained is set once no task is running anymore
+	Drained bool
+	// Running is the number of tasks still running
+	Running int
+	// Requeued is the number of running tasks requeued once the shutdown
+	// timeout passed
+	Requeued int
+}
+
+// drain holds the status of a worker quitting gracefully
+type drain struct {
+	mu       sync.Mutex
+	draining bool
+	requeued int
+	done     chan struct{}
+}
+
+// doneChan returns the channel closed once the worker has been drained
+func (d *drain) doneChan() chan struct{} {
+	if d.done == nil {
+		d.done = make(chan struct{})
+	}
+	return d.done
+}
+
+// Drained returns a channel which is closed once the worker quitting
+// gracefully has no running task anymore, e.g. for orchestrators to wait for
+func (worker *Worker) Drained() <-chan struct{} {
+	worker.drain.mu.Lock()
+	defer worker.drain.mu.Unlock()
+
+	return worker.drain.doneChan()
+}
+
+// DrainStatus returns the status of the worker quitting gracefully
+func (worker *Worker) DrainStatus() DrainStatus {
+	worker.drain.mu.Lock()
+	defer worker.drain.mu.Unlock()
+
+	status := DrainStatus{Draining: worker.drain.draining, Requeued: worker.drain.requeued}
+	select {
+	case <-worker.drain.doneChan():
+		status.Drained = true
+	default:
+	}
+	worker.running.Range(func(key, value interface{}) bool {
+		status.Running++
+		return true
+	})
+	return status
+}
+
+// stopConsuming stops the broker, running tasks are waited for until the
+// ShutdownTimeout passed, then they are requeued
+func (worker *Worker) stopConsuming() {
+	worker.drain.mu.Lock()
+	worker.drain.draining = true
+	worker.drain.mu.Unlock()
+
+	stopped := make(chan struct{})
+	go func() {
+		worker.server.GetBroker().StopConsuming()
+		close(stopped)
+	}()
+
+	if timeout := worker.server.GetConfig().ShutdownTimeout; timeout > 0 {
+		select {
+		case <-stopped:
+		case <-time.After(time.Duration(timeout) * time.Second):
+			worker.requeueRunning()
+
+			// Tasks returning once their contexts are canceled are
+			// acknowledged, so they are not delivered again by the broker
+			select {
+			case <-stopped:
+			case <-time.After(requeueGracePeriod):
+				log.WARNING.Print("Requeued tasks are still running, quitting anyway")
+			}
+		}
+	} else {
+		<-stopped
+	}
+
+	worker.drain.mu.Lock()
+	defer worker.drain.mu.Unlock()
+	select {
+	case <-worker.drain.doneChan():
+	default:
+		close(worker.drain.doneChan())
+	}
+}
+
+// requeueRunning sends the running tasks again for other workers to process
+// them and cancels their contexts, their results are discarded. Tasks which
+// could not be sent again keep running, so they are not acknowledged before
+// another worker got them.
+func (worker *Worker) requeueRunning() {
+	worker.running.Range(func(key, value interface{}) bool {
+		running := value.(*runningTask)
+		if !atomic.CompareAndSwapInt32(&running.requeued, 0, 1) {
+			return true
+		}
+
+		if err := worker.requeue(running.signature); err != nil {
+			log.ERROR.Printf("Failed to requeue task %s: %s", running.signature.UUID, err)
+			atomic.StoreInt32(&running.requeued, 0)
+			return true
+		}
+
+		worker.drain.mu.Lock()
+		worker.drain.requeued++
+		worker.drain.mu.Unlock()
+		running.cancel()
+		return true
+	})
+}
+
+// requeue sends the task again as it was received, it is not counted as
+// delivered as its attempt did not finish
+func (worker *Worker) requeue(signature *tasks.Signature) error {
+	log.WARNING.Printf("Shutdown timeout passed. Going to requeue task %s.", signature.UUID)
+
+	worker.resetDeliveries(signature)
+	_, err := worker.server.resendTask(tasks.CopySignature(signature))
+	return err
+}
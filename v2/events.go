@@ -0,0 +1,121 @@
+package machinery
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// EventType is the type of a task lifecycle event
+type EventType string
+
+// Task lifecycle events
+const (
+	// EventTaskPublished is emitted once a task has been published to the broker
+	EventTaskPublished EventType = "TaskPublished"
+	// EventTaskStarted is emitted once a worker started processing a task
+	EventTaskStarted EventType = "TaskStarted"
+	// EventTaskSucceeded is emitted once a task succeeded, with its results
+	EventTaskSucceeded EventType = "TaskSucceeded"
+	// EventTaskFailed is emitted once a task failed for good, with its error
+	EventTaskFailed EventType = "TaskFailed"
+	// EventTaskRetried is emitted once a failed task has been sent to be
+	// retried, with its error
+	EventTaskRetried EventType = "TaskRetried"
+	// EventGroupCompleted is emitted once all the tasks of a group completed,
+	// with the task which completed it
+	EventGroupCompleted EventType = "GroupCompleted"
+	// EventChordTriggered is emitted once the callback of a chord has been
+	// sent, with the callback
+	EventChordTriggered EventType = "ChordTriggered"
+)
+
+// eventsBuffer is the number of events buffered for each subscriber, events
+// are dropped for subscribers lagging behind further
+const eventsBuffer = 100
+
+// Event is a change in the lifecycle of a task
+type Event struct {
+	Type      EventType
+	Time      time.Time
+	Signature *tasks.Signature
+	// Results are set for EventTaskSucceeded
+	Results []*tasks.TaskResult
+	// Error is set for EventTaskFailed and EventTaskRetried
+	Error string
+}
+
+// eventBus fans out events to the subscribers
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers map[chan *Event]struct{}
+}
+
+// subscribe returns a channel receiving the events until the context is done
+func (bus *eventBus) subscribe(ctx context.Context) <-chan *Event {
+	events := make(chan *Event, eventsBuffer)
+
+	bus.mu.Lock()
+	if bus.subscribers == nil {
+		bus.subscribers = make(map[chan *Event]struct{})
+	}
+	bus.subscribers[events] = struct{}{}
+	bus.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		bus.mu.Lock()
+		delete(bus.subscribers, events)
+		close(events)
+		bus.mu.Unlock()
+	}()
+
+	return events
+}
+
+// active returns whether anyone subscribed to the events
+func (bus *eventBus) active() bool {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	return len(bus.subscribers) > 0
+}
+
+// emit sends the event to the subscribers without blocking
+func (bus *eventBus) emit(event *Event) {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+
+	for events := range bus.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.WARNING.Printf("Dropped event %s of task %s for a subscriber lagging behind", event.Type, event.Signature.UUID)
+		}
+	}
+}
+
+// Events returns a channel receiving the lifecycle events of the tasks sent
+// by the server and processed by its workers, until the context is done and
+// the channel is closed. Events are emitted in this process only, they are
+// not shared through the broker. A subscriber lagging behind by more than 100
+// events misses the following ones.
+func (server *Server) Events(ctx context.Context) <-chan *Event {
+	return server.events.subscribe(ctx)
+}
+
+// emitEvent emits an event of the task to the subscribers, if any
+func (server *Server) emitEvent(eventType EventType, signature *tasks.Signature, results []*tasks.TaskResult, err string) {
+	if !server.events.active() {
+		return
+	}
+	server.events.emit(&Event{
+		Type:      eventType,
+		Time:      time.Now().UTC(),
+		Signature: signature,
+		Results:   results,
+		Error:     err,
+	})
+}
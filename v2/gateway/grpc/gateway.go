@@ -0,0 +1,185 @@
+// Package grpc serves a gRPC gateway so services written in any language can
+// send tasks to a machinery server and follow their states, see
+// gateway.proto for the definition of the service.
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative gateway.proto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// DefaultPollInterval is how often WatchState reads the state of the task
+// when the result backend does not push its changes
+const DefaultPollInterval = time.Second
+
+// Gateway serves the Gateway service of gateway.proto with a machinery server
+type Gateway struct {
+	UnimplementedGatewayServer
+	server *machinery.Server
+	// PollInterval is how often WatchState reads the state of the task when
+	// the result backend does not push its changes
+	PollInterval time.Duration
+}
+
+// New creates a gateway sending tasks with the server
+func New(server *machinery.Server) *Gateway {
+	return &Gateway{server: server, PollInterval: DefaultPollInterval}
+}
+
+// NewServer creates a gRPC server serving the gateway of the machinery server
+func NewServer(server *machinery.Server, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	RegisterGatewayServer(s, New(server))
+	return s
+}
+
+// SendTask sends the task to the broker, its UUID is generated when it is not
+// set
+func (g *Gateway) SendTask(ctx context.Context, req *SendTaskRequest) (*SendTaskResponse, error) {
+	signature, err := toSignature(req.Signature)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	asyncResult, err := g.server.SendTaskWithContext(ctx, signature)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &SendTaskResponse{TaskUuid: asyncResult.Signature.UUID}, nil
+}
+
+// GetState returns the state of the task
+func (g *Gateway) GetState(ctx context.Context, req *GetStateRequest) (*TaskState, error) {
+	state, err := g.server.GetBackend().GetState(req.TaskUuid)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return fromTaskState(state)
+}
+
+// WatchState sends the state of the task each time it changes until the task
+// is completed. Backends implementing StateSubscriber push the changes, the
+// state is polled every PollInterval otherwise.
+func (g *Gateway) WatchState(req *GetStateRequest, stream Gateway_WatchStateServer) error {
+	ctx := stream.Context()
+
+	// Changes are subscribed to before the state is read so none is missed,
+	// receiving from a nil channel blocks so the state is polled only
+	changes, _ := backends.Subscribe(ctx, g.server.GetBackend(), req.TaskUuid)
+
+	ticker := time.NewTicker(g.PollInterval)
+	defer ticker.Stop()
+
+	var last string
+	for {
+		state, err := g.server.GetBackend().GetState(req.TaskUuid)
+		if err != nil {
+			return status.Error(codes.NotFound, err.Error())
+		}
+		if state.State != last {
+			last = state.State
+			message, err := fromTaskState(state)
+			if err != nil {
+				return err
+			}
+			if err := stream.Send(message); err != nil {
+				return err
+			}
+		}
+		if state.IsCompleted() {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status.Error(codes.Canceled, ctx.Err().Error())
+		case _, ok := <-changes:
+			// The subscription is lost, keep polling
+			if !ok {
+				changes = nil
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// toSignature converts the signature of the request, values of arguments are
+// decoded as signatures sent by brokers are so they are converted to their
+// type by workers
+func toSignature(message *Signature) (*tasks.Signature, error) {
+	if message == nil || message.Name == "" {
+		return nil, fmt.Errorf("Name of the task is required")
+	}
+	if message.Priority > math.MaxUint8 {
+		return nil, fmt.Errorf("Priority %d is greater than %d", message.Priority, math.MaxUint8)
+	}
+
+	signature := &tasks.Signature{
+		UUID:         message.Uuid,
+		Name:         message.Name,
+		RoutingKey:   message.RoutingKey,
+		Priority:     uint8(message.Priority),
+		RetryCount:   int(message.RetryCount),
+		RetryTimeout: int(message.RetryTimeout),
+	}
+
+	for _, arg := range message.Args {
+		var value interface{}
+		decoder := json.NewDecoder(bytes.NewReader([]byte(arg.Value)))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return nil, fmt.Errorf("Decode value of argument %s error: %s", arg.Name, err)
+		}
+		signature.Args = append(signature.Args, tasks.Arg{Name: arg.Name, Type: arg.Type, Value: value})
+	}
+
+	if len(message.Headers) > 0 {
+		signature.Headers = make(tasks.Headers, len(message.Headers))
+		for key, value := range message.Headers {
+			signature.Headers[key] = value
+		}
+	}
+
+	if message.Eta != "" {
+		eta, err := time.Parse(time.RFC3339, message.Eta)
+		if err != nil {
+			return nil, fmt.Errorf("Parse ETA error: %s", err)
+		}
+		eta = eta.UTC()
+		signature.ETA = &eta
+	}
+	return signature, nil
+}
+
+// fromTaskState converts the state of the task, values of results are JSON
+// encoded
+func fromTaskState(state *tasks.TaskState) (*TaskState, error) {
+	message := &TaskState{
+		TaskUuid: state.TaskUUID,
+		TaskName: state.TaskName,
+		State:    state.State,
+		Error:    state.Error,
+	}
+	for _, result := range state.Results {
+		value, err := json.Marshal(result.Value)
+		if err != nil {
+			return nil, status.Error(codes.Internal, fmt.Sprintf("Encode result of task %s error: %s", state.TaskUUID, err))
+		}
+		message.Results = append(message.Results, &TaskResult{Type: result.Type, Value: string(value)})
+	}
+	return message, nil
+}
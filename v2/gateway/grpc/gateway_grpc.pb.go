@@ -0,0 +1,215 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: gateway.proto
+
+package grpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// GatewayClient is the client API for Gateway service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GatewayClient interface {
+	// SendTask sends the task to the broker, its UUID is generated when it is
+	// not set
+	SendTask(ctx context.Context, in *SendTaskRequest, opts ...grpc.CallOption) (*SendTaskResponse, error)
+	// GetState returns the state of the task
+	GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*TaskState, error)
+	// WatchState streams the state of the task each time it changes until the
+	// task is completed
+	WatchState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (Gateway_WatchStateClient, error)
+}
+
+type gatewayClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGatewayClient(cc grpc.ClientConnInterface) GatewayClient {
+	return &gatewayClient{cc}
+}
+
+func (c *gatewayClient) SendTask(ctx context.Context, in *SendTaskRequest, opts ...grpc.CallOption) (*SendTaskResponse, error) {
+	out := new(SendTaskResponse)
+	err := c.cc.Invoke(ctx, "/machinery.gateway.v1.Gateway/SendTask", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) GetState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (*TaskState, error) {
+	out := new(TaskState)
+	err := c.cc.Invoke(ctx, "/machinery.gateway.v1.Gateway/GetState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) WatchState(ctx context.Context, in *GetStateRequest, opts ...grpc.CallOption) (Gateway_WatchStateClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Gateway_ServiceDesc.Streams[0], "/machinery.gateway.v1.Gateway/WatchState", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &gatewayWatchStateClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Gateway_WatchStateClient interface {
+	Recv() (*TaskState, error)
+	grpc.ClientStream
+}
+
+type gatewayWatchStateClient struct {
+	grpc.ClientStream
+}
+
+func (x *gatewayWatchStateClient) Recv() (*TaskState, error) {
+	m := new(TaskState)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// GatewayServer is the server API for Gateway service.
+// All implementations must embed UnimplementedGatewayServer
+// for forward compatibility
+type GatewayServer interface {
+	// SendTask sends the task to the broker, its UUID is generated when it is
+	// not set
+	SendTask(context.Context, *SendTaskRequest) (*SendTaskResponse, error)
+	// GetState returns the state of the task
+	GetState(context.Context, *GetStateRequest) (*TaskState, error)
+	// WatchState streams the state of the task each time it changes until the
+	// task is completed
+	WatchState(*GetStateRequest, Gateway_WatchStateServer) error
+	mustEmbedUnimplementedGatewayServer()
+}
+
+// UnimplementedGatewayServer must be embedded to have forward compatible implementations.
+type UnimplementedGatewayServer struct {
+}
+
+func (UnimplementedGatewayServer) SendTask(context.Context, *SendTaskRequest) (*SendTaskResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendTask not implemented")
+}
+func (UnimplementedGatewayServer) GetState(context.Context, *GetStateRequest) (*TaskState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetState not implemented")
+}
+func (UnimplementedGatewayServer) WatchState(*GetStateRequest, Gateway_WatchStateServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchState not implemented")
+}
+func (UnimplementedGatewayServer) mustEmbedUnimplementedGatewayServer() {}
+
+// UnsafeGatewayServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GatewayServer will
+// result in compilation errors.
+type UnsafeGatewayServer interface {
+	mustEmbedUnimplementedGatewayServer()
+}
+
+func RegisterGatewayServer(s grpc.ServiceRegistrar, srv GatewayServer) {
+	s.RegisterService(&Gateway_ServiceDesc, srv)
+}
+
+func _Gateway_SendTask_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendTaskRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).SendTask(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/machinery.gateway.v1.Gateway/SendTask",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).SendTask(ctx, req.(*SendTaskRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_GetState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).GetState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/machinery.gateway.v1.Gateway/GetState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).GetState(ctx, req.(*GetStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_WatchState_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetStateRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(GatewayServer).WatchState(m, &gatewayWatchStateServer{stream})
+}
+
+type Gateway_WatchStateServer interface {
+	Send(*TaskState) error
+	grpc.ServerStream
+}
+
+type gatewayWatchStateServer struct {
+	grpc.ServerStream
+}
+
+func (x *gatewayWatchStateServer) Send(m *TaskState) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Gateway_ServiceDesc is the grpc.ServiceDesc for Gateway service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gateway_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "machinery.gateway.v1.Gateway",
+	HandlerType: (*GatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendTask",
+			Handler:    _Gateway_SendTask_Handler,
+		},
+		{
+			MethodName: "GetState",
+			Handler:    _Gateway_GetState_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchState",
+			Handler:       _Gateway_WatchState_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "gateway.proto",
+}
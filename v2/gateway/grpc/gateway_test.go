@@ -0,0 +1,103 @@
+package grpc_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	memorybackend "github.com/RichardKnop/machinery/v2/backends/memory"
+	memorybroker "github.com/RichardKnop/machinery/v2/brokers/memory"
+	gateway "github.com/RichardKnop/machinery/v2/gateway/grpc"
+	lock "github.com/RichardKnop/machinery/v2/locks/eager"
+)
+
+func TestGateway(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := gateway.NewServer(server)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	conn, err := grpc.DialContext(
+		context.Background(),
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := gateway.NewGatewayClient(conn)
+
+	resp, err := client.SendTask(context.Background(), &gateway.SendTaskRequest{
+		Signature: &gateway.Signature{
+			Name: "add",
+			Args: []*gateway.Arg{
+				{Type: "int64", Value: "1"},
+				{Type: "int64", Value: "2"},
+			},
+			Headers: map[string]string{"tenant": "acme"},
+		},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.TaskUuid)
+
+	// Arguments are converted to their type by workers
+	pending, err := server.GetBroker().GetPendingTasks("")
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, resp.TaskUuid, pending[0].UUID)
+	assert.Equal(t, "add", pending[0].Name)
+	assert.Equal(t, "acme", pending[0].Headers["tenant"])
+	for i, arg := range pending[0].Args {
+		value, err := tasks.ReflectValue(arg.Type, arg.Value)
+		require.NoError(t, err)
+		assert.Equal(t, int64(i+1), value.Interface())
+	}
+
+	state, err := client.GetState(context.Background(), &gateway.GetStateRequest{TaskUuid: resp.TaskUuid})
+	require.NoError(t, err)
+	assert.Equal(t, tasks.StatePending, state.State)
+	assert.Equal(t, "add", state.TaskName)
+
+	stream, err := client.WatchState(context.Background(), &gateway.GetStateRequest{TaskUuid: resp.TaskUuid})
+	require.NoError(t, err)
+	state, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, tasks.StatePending, state.State)
+
+	results := []*tasks.TaskResult{{Type: "int64", Value: int64(3)}}
+	require.NoError(t, server.GetBackend().SetStateSuccess(pending[0], results))
+	state, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, tasks.StateSuccess, state.State)
+	if assert.Len(t, state.Results, 1) {
+		assert.Equal(t, "int64", state.Results[0].Type)
+		assert.Equal(t, "3", state.Results[0].Value)
+	}
+
+	// The stream ends once the task is completed
+	_, err = stream.Recv()
+	assert.Equal(t, io.EOF, err)
+
+	_, err = client.SendTask(context.Background(), &gateway.SendTaskRequest{Signature: &gateway.Signature{}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
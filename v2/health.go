@@ -0,0 +1,101 @@
+package machinery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/log"
+)
+
+// healthCheckTimeout bounds the broker health check of the liveness endpoint
+const healthCheckTimeout = 5 * time.Second
+
+// HealthStatus is the status reported by the health endpoints of a worker
+type HealthStatus struct {
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+	Consuming bool   `json:"consuming"`
+	Paused    bool   `json:"paused"`
+	Throttled bool   `json:"throttled"`
+	Draining  bool   `json:"draining"`
+	Running   int    `json:"running"`
+}
+
+// HealthHandler returns a handler serving the health endpoints of the worker,
+// e.g. for Kubernetes probes: /healthz is OK while the broker can be reached
+// and /readyz while the worker is consuming and not draining. Both report the
+// number of running tasks. Set HealthAddr to serve them when the worker is
+// launched.
+func (worker *Worker) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		status := worker.healthStatus()
+		if err := worker.server.GetBroker().HealthCheck(ctx); err != nil {
+			status.Error = err.Error()
+		}
+		writeHealthStatus(w, status, status.Error == "")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status := worker.healthStatus()
+		writeHealthStatus(w, status, status.Consuming && !status.Draining)
+	})
+	return mux
+}
+
+// healthStatus returns the status of the worker
+func (worker *Worker) healthStatus() HealthStatus {
+	drainStatus := worker.DrainStatus()
+	return HealthStatus{
+		Consuming: atomic.LoadInt32(&worker.consuming) == 1,
+		Paused:    worker.IsPaused(),
+		Throttled: worker.IsThrottled(),
+		Draining:  drainStatus.Draining,
+		Running:   drainStatus.Running,
+	}
+}
+
+// writeHealthStatus writes the status as JSON, with a 503 status code when
+// the check failed
+func writeHealthStatus(w http.ResponseWriter, status HealthStatus, ok bool) {
+	code := http.StatusOK
+	status.Status = "ok"
+	if !ok {
+		code = http.StatusServiceUnavailable
+		status.Status = "unavailable"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
+
+// startHealthServer serves the health endpoints on HealthAddr, the returned
+// function stops the server
+func (worker *Worker) startHealthServer() func() {
+	if worker.HealthAddr == "" {
+		return func() {}
+	}
+
+	srv := &http.Server{Addr: worker.HealthAddr, Handler: worker.HealthHandler()}
+	go func() {
+		log.INFO.Printf("Serving health endpoints on %s", worker.HealthAddr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.ERROR.Printf("Health endpoints failed: %s", err)
+		}
+	}()
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.ERROR.Printf("Failed to stop serving health endpoints: %s", err)
+		}
+	}
+}
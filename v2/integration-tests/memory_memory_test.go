@@ -0,0 +1,453 @@
+package integration_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/backends"
+	memorybackend "github.com/RichardKnop/machinery/v2/backends/memory"
+	"github.com/RichardKnop/machinery/v2/backends/result"
+	memorybroker "github.com/RichardKnop/machinery/v2/brokers/memory"
+	"github.com/RichardKnop/machinery/v2/config"
+	eagerlock "github.com/RichardKnop/machinery/v2/locks/eager"
+	"github.com/RichardKnop/machinery/v2/retry"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestMemoryMemory(t *testing.T) {
+	cnf := &config.Config{
+		DefaultQueue:    "machinery_tasks",
+		ResultsExpireIn: 3600,
+		DeadLetterQueue: "machinery_dead_letters",
+	}
+
+	broker := memorybroker.New(cnf)
+	backend := memorybackend.New(cnf)
+	lock := eagerlock.New()
+	server := machinery.NewServer(cnf, broker, backend, lock)
+
+	registerTestTasks(server)
+
+	// fails on the first attempt so it is only successful when retried
+	var attempts int64
+	server.RegisterTask("fail_once", func() (int64, error) {
+		if atomic.AddInt64(&attempts, 1) == 1 {
+			return 0, errors.New("first attempt fails")
+		}
+		return attempts, nil
+	})
+
+	// Batches of testBatch are only full if the worker receives all their
+	// tasks at once, whatever the number of CPUs
+	worker := server.NewWorker("test_worker", 10)
+	defer worker.Quit()
+	go worker.Launch()
+	testAll(server, t)
+	testSendDAG(server, t)
+
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "fail_once", RetryCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Interface() != int64(2) {
+		t.Errorf("result = %v, want int64(2)", results[0].Interface())
+	}
+
+	testSaga(server, t)
+	testSpawnChildren(server, t)
+	testCancelTask(server, t)
+	testBroadcast(server, t)
+	testBatch(server, t)
+	testTaskFunc(server, t)
+	testRetryPolicy(server, t)
+	testNonRetryable(server, t)
+	testRequeueDeadLetters(server, t)
+	testFailureHistory(server, t)
+}
+
+func testSaga(server *machinery.Server, t *testing.T) {
+	var (
+		mu     sync.Mutex
+		undone []string
+	)
+	server.RegisterTask("undo", func(step string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		undone = append(undone, step)
+		return nil
+	})
+	undo := func(step string) *tasks.Signature {
+		return &tasks.Signature{Name: "undo", Args: []tasks.Arg{{Type: "string", Value: step}}}
+	}
+
+	step1, step2, step3 := newAddTask(1, 1), newAddTask(2, 2), newErrorTask("Test error", true)
+	step1.CompensateWith, step2.CompensateWith, step3.CompensateWith = undo("step1"), undo("step2"), undo("step3")
+	// The results of step2 are not passed to step3
+	step2.Immutable = true
+
+	chain, err := tasks.NewChain(step1, step2, step3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chainAsyncResult, err := server.SendChain(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = chainAsyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.EqualError(t, err, "Test error")
+
+	// The succeeded steps are undone, latest first
+	assert.Eventually(t, func() bool {
+		completed, err := server.GetBackend().GroupCompleted(chain.SagaUUID, 2)
+		return err == nil && completed
+	}, 5*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"step2", "step1"}, undone)
+	mu.Unlock()
+
+	states, err := server.GetBackend().GroupTaskStates(chain.SagaUUID, 2)
+	if assert.NoError(t, err) && assert.Len(t, states, 2) {
+		assert.Equal(t, step2.CompensateWith.UUID, states[0].TaskUUID)
+		assert.Equal(t, step1.CompensateWith.UUID, states[1].TaskUUID)
+	}
+}
+
+func testSpawnChildren(server *machinery.Server, t *testing.T) {
+	server.RegisterTask("spawn", func(ctx context.Context, n int64) error {
+		publisher := tasks.PublisherFromContext(ctx)
+		for i := int64(0); i < n; i++ {
+			if err := publisher.Send(newAddTask(int(i), 1)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	asyncResult, err := server.SendTask(&tasks.Signature{
+		Name: "spawn",
+		Args: []tasks.Arg{{Type: "int64", Value: 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parentUUID := asyncResult.Signature.UUID
+	assert.Eventually(t, func() bool {
+		completed, err := backends.ChildrenCompleted(server.GetBackend(), parentUUID)
+		return err == nil && completed
+	}, 5*time.Second, 5*time.Millisecond)
+
+	states, err := backends.ChildTaskStates(server.GetBackend(), parentUUID)
+	if assert.NoError(t, err) && assert.Len(t, states, 3) {
+		for i, state := range states {
+			assert.Equal(t, tasks.StateSuccess, state.State)
+			assert.Equal(t, json.Number(strconv.Itoa(i+1)), state.Results[0].Value)
+		}
+	}
+}
+
+func testCancelTask(server *machinery.Server, t *testing.T) {
+	stopped := make(chan struct{})
+	server.RegisterTask("wait_for_cancel", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	})
+
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "wait_for_cancel"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return asyncResult.GetState().State == tasks.StateStarted
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// The context of the running task is canceled
+	assert.NoError(t, server.CancelTask(asyncResult.Signature.UUID))
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, result.ErrTaskCanceled, err)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Error("context of the canceled task is not canceled")
+	}
+	assert.Eventually(t, func() bool {
+		state, err := server.GetBackend().GetState(asyncResult.Signature.UUID)
+		return err == nil && state.IsCanceled()
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func testBroadcast(server *machinery.Server, t *testing.T) {
+	var reloaded int64
+	server.RegisterTask("reload_config", func() error {
+		atomic.AddInt64(&reloaded, 1)
+		return nil
+	})
+
+	// The second worker consumes once a task sent to its queue has succeeded,
+	// it stops together with the first one as they share the broker
+	worker := server.NewCustomQueueWorker("second_worker", 0, "second_queue")
+	go worker.Launch()
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "reload_config", RoutingKey: "second_queue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both workers execute the broadcast task once
+	assert.NoError(t, server.SendBroadcast(&tasks.Signature{Name: "reload_config"}))
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&reloaded) == 3
+	}, 5*time.Second, 5*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(3), atomic.LoadInt64(&reloaded))
+}
+
+func testBatch(server *machinery.Server, t *testing.T) {
+	var (
+		mu      sync.Mutex
+		batches [][]int64
+	)
+	err := server.RegisterBatchTask("bulk_insert", func(ctx context.Context, items []*tasks.BatchItem) error {
+		mu.Lock()
+		defer mu.Unlock()
+		var values []int64
+		for _, item := range items {
+			values = append(values, item.Args[0].(int64))
+		}
+		batches = append(batches, values)
+		return nil
+	}, 3, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asyncResults := make([]*result.AsyncResult, 3)
+	for i := range asyncResults {
+		asyncResults[i], err = server.SendTask(&tasks.Signature{
+			Name: "bulk_insert",
+			Args: []tasks.Arg{{Type: "int64", Value: int64(i)}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, asyncResult := range asyncResults {
+		if _, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The full batch is processed at once without waiting
+	mu.Lock()
+	defer mu.Unlock()
+	if assert.Len(t, batches, 1) {
+		assert.ElementsMatch(t, []int64{0, 1, 2}, batches[0])
+	}
+}
+
+type resizeArgs struct {
+	Width  int
+	Height int
+	Scale  float64
+}
+
+func testTaskFunc(server *machinery.Server, t *testing.T) {
+	err := machinery.RegisterTaskFunc(server, "resize", func(ctx context.Context, args resizeArgs) ([]int, error) {
+		return []int{int(float64(args.Width) * args.Scale), int(float64(args.Height) * args.Scale)}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := machinery.NewTaskFuncSignature(server, "resize", resizeArgs{Width: 640, Height: 480, Scale: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asyncResult, err := server.SendTask(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := machinery.DecodeTaskFuncResult[[]int](server, results)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []int{320, 240}, size)
+	}
+}
+
+var errUnavailable = errors.New("service unavailable")
+
+func testRetryPolicy(server *machinery.Server, t *testing.T) {
+	var attempts int64
+	err := server.RegisterTask("flaky", func(fail string) (int64, error) {
+		if n := atomic.AddInt64(&attempts, 1); n < 3 {
+			if fail == "invalid" {
+				return 0, errors.New("invalid request")
+			}
+			return 0, fmt.Errorf("attempt %d: %w", n, errUnavailable)
+		}
+		return atomic.LoadInt64(&attempts), nil
+	}, machinery.WithRetryPolicy(tasks.RetryPolicy{
+		MaxRetries:      2,
+		Backoff:         retry.Fixed(0),
+		RetryableErrors: []error{errUnavailable},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Retried without setting the retry count of the signature
+	asyncResult, err := server.SendTask(&tasks.Signature{
+		Name: "flaky",
+		Args: []tasks.Arg{{Type: "string", Value: "unavailable"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(3), results[0].Interface())
+	}
+
+	// Errors the policy does not retry fail the task at once
+	atomic.StoreInt64(&attempts, 0)
+	asyncResult, err = server.SendTask(&tasks.Signature{
+		Name: "flaky",
+		Args: []tasks.Arg{{Type: "string", Value: "invalid"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.EqualError(t, err, "invalid request")
+	assert.Equal(t, int64(1), atomic.LoadInt64(&attempts))
+}
+
+func testNonRetryable(server *machinery.Server, t *testing.T) {
+	var attempts int64
+	server.RegisterTask("charge_card", func() error {
+		atomic.AddInt64(&attempts, 1)
+		return tasks.NewErrNonRetryable(errors.New("card declined"))
+	})
+
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "charge_card", RetryCount: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.EqualError(t, err, "card declined")
+	assert.Equal(t, int64(1), atomic.LoadInt64(&attempts))
+}
+
+func testRequeueDeadLetters(server *machinery.Server, t *testing.T) {
+	var fixed int32
+	err := server.RegisterTask("reconcile", func() (string, error) {
+		if atomic.LoadInt32(&fixed) == 0 {
+			return "", errors.New("ledger mismatch")
+		}
+		return "reconciled", nil
+	}, machinery.WithRetryStrategy(retry.Fixed(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "reconcile", RetryCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.EqualError(t, err, "ledger mismatch")
+
+	// The task is moved to the dead letter queue with its failure history
+	deadLetters, err := server.GetBroker().GetPendingTasks("machinery_dead_letters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deadLetter *tasks.Signature
+	for _, signature := range deadLetters {
+		if signature.UUID == asyncResult.Signature.UUID {
+			deadLetter = signature
+		}
+	}
+	if assert.NotNil(t, deadLetter) {
+		assert.Equal(t, tasks.DeadLetterReasonRetriesExhausted, deadLetter.Headers[tasks.DeadLetterReasonHeader])
+		if assert.Len(t, deadLetter.Failures, 2) {
+			assert.Equal(t, 1, deadLetter.Failures[0].Attempt)
+			assert.Equal(t, 2, deadLetter.Failures[1].Attempt)
+			assert.Equal(t, "ledger mismatch", deadLetter.Failures[1].Error)
+		}
+	}
+
+	// Once fixed, the task is requeued and succeeds
+	atomic.StoreInt32(&fixed, 1)
+	requeued, err := server.RequeueDeadLetters("machinery_dead_letters", func(signature *tasks.Signature) bool {
+		return signature.Name == "reconcile"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, requeued)
+
+	// The failed state of the previous result is not read again
+	asyncResult = result.NewAsyncResult(asyncResult.Signature, server.GetBackend())
+	results, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "reconciled", results[0].Interface())
+	}
+}
+
+func testFailureHistory(server *machinery.Server, t *testing.T) {
+	err := server.RegisterTask("explode", func() error {
+		panic("out of fuel")
+	}, machinery.WithRetryStrategy(retry.Fixed(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "explode", RetryCount: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.EqualError(t, err, "out of fuel")
+
+	failures, err := asyncResult.GetFailureHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, failures, 2) {
+		for i, failure := range failures {
+			assert.Equal(t, i+1, failure.Attempt)
+			assert.Equal(t, "out of fuel", failure.Error)
+			assert.Equal(t, "string", failure.ErrorType)
+			assert.Contains(t, failure.Stack, "panic")
+			assert.NotEmpty(t, failure.Hostname)
+			assert.False(t, failure.FailedAt.Before(failure.StartedAt))
+		}
+	}
+}
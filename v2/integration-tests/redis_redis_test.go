@@ -42,4 +42,39 @@ func TestRedisRedis_GoRedis(t *testing.T) {
 	defer worker.Quit()
 	go worker.Launch()
 	testAll(server, t)
+	testSendDAG(server, t)
+	testBroadcast(server, t)
+}
+
+func TestRedisRedis_Redigo_Broadcast(t *testing.T) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		t.Skip("REDIS_URL is not defined")
+	}
+
+	cnf := &config.Config{
+		DefaultQueue:    "machinery_redigo_tasks",
+		ResultsExpireIn: 3600,
+		Redis: &config.RedisConfig{
+			MaxIdle:                3,
+			IdleTimeout:            240,
+			ReadTimeout:            15,
+			WriteTimeout:           15,
+			ConnectTimeout:         15,
+			NormalTasksPollPeriod:  1000,
+			DelayedTasksPollPeriod: 500,
+		},
+	}
+
+	broker := redisbroker.New(cnf, redisURL, "", "", 0)
+	backend := redisbackend.NewGR(cnf, []string{redisURL}, 0)
+	lock := eagerlock.New()
+	server := machinery.NewServer(cnf, broker, backend, lock)
+
+	registerTestTasks(server)
+
+	worker := server.NewWorker("test_worker", 0)
+	defer worker.Quit()
+	go worker.Launch()
+	testBroadcast(server, t)
 }
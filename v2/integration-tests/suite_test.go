@@ -14,6 +14,7 @@ import (
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/tasks"
 
+	backendsiface "github.com/RichardKnop/machinery/v2/backends/iface"
 	brokersiface "github.com/RichardKnop/machinery/v2/brokers/iface"
 )
 
@@ -25,6 +26,7 @@ func (a ascendingInt64s) Less(i, j int) bool { return a[i] < a[j] }
 
 type Server interface {
 	GetBroker() brokersiface.Broker
+	GetBackend() backendsiface.Backend
 	GetConfig() *config.Config
 	RegisterTasks(namedTaskFuncs map[string]interface{}) error
 	SendTaskWithContext(ctx context.Context, signature *tasks.Signature) (*result.AsyncResult, error)
@@ -35,6 +37,7 @@ type Server interface {
 	SendGroup(group *tasks.Group, sendConcurrency int) ([]*result.AsyncResult, error)
 	SendChordWithContext(ctx context.Context, chord *tasks.Chord, sendConcurrency int) (*result.ChordAsyncResult, error)
 	SendChord(chord *tasks.Chord, sendConcurrency int) (*result.ChordAsyncResult, error)
+	SendDAG(dag *tasks.DAG) (*result.DAGAsyncResult, error)
 }
 
 func testAll(server Server, t *testing.T) {
@@ -42,7 +45,9 @@ func testAll(server Server, t *testing.T) {
 	testSendGroup(server, t, 0) // with unlimited concurrency
 	testSendGroup(server, t, 2) // with limited concurrency (2 parallel tasks at the most)
 	testSendChord(server, t)
+	testSendMapReduce(server, t)
 	testSendChain(server, t)
+	testSendConditionalChain(server, t)
 	testReturnJustError(server, t)
 	testReturnMultipleValues(server, t)
 	testPanic(server, t)
@@ -174,6 +179,57 @@ func testSendChain(server Server, t *testing.T) {
 	}
 }
 
+func testSendConditionalChain(server Server, t *testing.T) {
+	for _, tc := range []struct {
+		a, b     int
+		expected int64
+	}{
+		{2, 2, 40}, // (2 + 2) is even, multiplied by 10
+		{2, 3, 6},  // (2 + 3) is odd, added to 1
+	} {
+		evenTask, oddTask := newMultipleTask(10), newAddTask(1, 0)
+		even, err := tasks.NewChain(evenTask)
+		if err != nil {
+			t.Fatal(err)
+		}
+		odd, err := tasks.NewChain(oddTask)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chain, err := tasks.NewConditionalChain(
+			&tasks.Signature{Name: "parity"},
+			map[string]*tasks.Chain{"even": even, "odd": odd},
+			newAddTask(tc.a, tc.b),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		chainAsyncResult, err := server.SendChain(chain)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The decider returns the chosen branch and the number it is passed
+		results, err := chainAsyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		branch := evenTask
+		if results[0].Interface() == "odd" {
+			branch = oddTask
+		}
+
+		results, err = result.NewChainAsyncResult([]*tasks.Signature{branch}, server.GetBackend()).
+			GetWithTimeout(5*time.Second, 5*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tc.expected, results[0].Interface())
+	}
+}
+
 func testSendChord(server Server, t *testing.T) {
 	t1, t2, t3, t4 := newAddTask(1, 1), newAddTask(2, 2), newAddTask(5, 6), newMultipleTask()
 
@@ -210,6 +266,77 @@ func testSendChord(server Server, t *testing.T) {
 	}
 }
 
+// testSendDAG is not part of testAll, DAGs are not supported by the AMQP backend
+func testSendDAG(server Server, t *testing.T) {
+	// (1 + 1) and (2 + 3) are both added to 4 and multiplied
+	dag, err := tasks.NewDAG(
+		&tasks.DAGNode{Name: "a", Signature: newAddTask(1, 1)},
+		&tasks.DAGNode{Name: "b", Signature: newAddTask(2, 3)},
+		&tasks.DAGNode{Name: "c", Signature: newAddTask(4, 0), Dependencies: []string{"a"}},
+		&tasks.DAGNode{Name: "d", Signature: newMultipleTask(), Dependencies: []string{"b", "c"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dagAsyncResult, err := server.SendDAG(dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := dagAsyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(6), results["c"][0].Interface())
+	assert.Equal(t, int64(30), results["d"][0].Interface())
+
+	// Tasks depending on a failed task fail as well
+	dag, err = tasks.NewDAG(
+		&tasks.DAGNode{Name: "fail", Signature: newErrorTask("Test error", true)},
+		&tasks.DAGNode{Name: "add", Signature: newAddTask(1, 1)},
+		&tasks.DAGNode{Name: "dependent", Signature: newAddTask(1, 1), Dependencies: []string{"fail", "add"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dagAsyncResult, err = server.SendDAG(dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = dagAsyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.EqualError(t, err, "Test error")
+	assert.Eventually(t, func() bool {
+		return dagAsyncResult.GetStates()["dependent"].IsFailure()
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Contains(t, dagAsyncResult.GetStates()["dependent"].Error, "Dependency fail")
+}
+
+func testSendMapReduce(server Server, t *testing.T) {
+	// Each item is added to 10 and the sums multiplied
+	mapper := newAddTask(10, 0)
+	mapper.Args[1] = tasks.Arg{Type: tasks.ItemArgType}
+	items := []tasks.Arg{{Type: "int64", Value: 1}, {Type: "int64", Value: 2}, {Type: "int64", Value: 3}}
+
+	chord, err := tasks.NewMapReduce(mapper, items, newMultipleTask())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chordAsyncResult, err := server.SendChord(chord, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := chordAsyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(11*12*13), results[0].Interface())
+}
+
 func testReturnJustError(server Server, t *testing.T) {
 	// Fails, returns error as the only value
 	task := newErrorTask("Test error", true)
@@ -380,6 +507,12 @@ func registerTestTasks(server Server) {
 		"panic": func() (string, error) {
 			panic(errors.New("oops"))
 		},
+		"parity": func(n int64) (string, int64, error) {
+			if n%2 == 0 {
+				return "even", n, nil
+			}
+			return "odd", n, nil
+		},
 		"delay_test": func() (int64, error) {
 			return time.Now().UTC().UnixNano(), nil
 		},
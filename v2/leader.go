@@ -0,0 +1,78 @@
+package machinery
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RichardKnop/machinery/v2/log"
+
+	lockiface "github.com/RichardKnop/machinery/v2/locks/iface"
+)
+
+// schedulerLeaderLease is the name of the lease held by the leader of the
+// servers sending periodic tasks
+const schedulerLeaderLease = "machinery_scheduler_leader"
+
+// leaseRenewalsPerTTL is how many times the scheduler leader renews its
+// lease before it expires
+const leaseRenewalsPerTTL = 3
+
+// IsSchedulerLeader returns whether the server sends periodic tasks, which
+// is always the case without leader election, see Config.SchedulerLeaseTTL
+func (server *Server) IsSchedulerLeader() bool {
+	return atomic.LoadInt32(&server.schedulerLeader) == 1
+}
+
+// startLeaderElection makes the server campaign for the lease of the
+// scheduler leader right away, so schedules registered next know whether it
+// is the leader, and then every third of the TTL of the lease,
+// which renews it while the server is the leader. Every server sends
+// periodic tasks if the lock does not support leases.
+func (server *Server) startLeaderElection(ttl time.Duration) {
+	leaser, ok := server.lock.(lockiface.Leaser)
+	if !ok {
+		log.WARNING.Print("SchedulerLeaseTTL is set but the lock does not support leases")
+		return
+	}
+
+	hostname, _ := os.Hostname()
+	server.schedulerID = fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String())
+	atomic.StoreInt32(&server.schedulerLeader, 0)
+	server.campaign(leaser, ttl)
+
+	go func() {
+		ticker := time.NewTicker(ttl / leaseRenewalsPerTTL)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			server.campaign(leaser, ttl)
+		}
+	}()
+}
+
+// campaign takes or renews the lease of the scheduler leader, the server
+// steps down if it cannot renew the lease as another server may take it
+// over once it expired
+func (server *Server) campaign(leaser lockiface.Leaser, ttl time.Duration) {
+	held, err := leaser.AcquireLease(schedulerLeaderLease, server.schedulerID, ttl)
+	if err != nil {
+		log.ERROR.Printf("Failed to acquire the lease of the scheduler leader: %s", err)
+		held = false
+	}
+
+	var leader int32
+	if held {
+		leader = 1
+	}
+	if atomic.SwapInt32(&server.schedulerLeader, leader) != leader {
+		if held {
+			log.INFO.Printf("Server %s became the scheduler leader", server.schedulerID)
+		} else {
+			log.INFO.Printf("Server %s is not the scheduler leader anymore", server.schedulerID)
+		}
+	}
+}
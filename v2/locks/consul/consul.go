@@ -0,0 +1,270 @@
+package consul
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+)
+
+const (
+	// defaultSessionTTL is the TTL of sessions when the config has none
+	defaultSessionTTL = 15 * time.Second
+	// defaultLockDelay is the lock delay of sessions when the config has none
+	defaultLockDelay = 15 * time.Second
+	// retryInterval is how long LockWithRetries waits between attempts
+	retryInterval = 100 * time.Millisecond
+)
+
+var (
+	ErrConsulLockFailed = errors.New("consul lock: failed to acquire lock")
+)
+
+// Lock stores locks and leases in the Consul KV store, they are held by a
+// session of the lock renewed in the background while the process runs. Keys
+// of the session are deleted once it expired, e.g. because the process died,
+// and cannot be taken again during the lock delay of the session.
+type Lock struct {
+	client     *api.Client
+	retries    int
+	interval   time.Duration
+	sessionTTL time.Duration
+	lockDelay  time.Duration
+
+	mu        sync.Mutex
+	session   string
+	stopRenew chan struct{}
+}
+
+// New creates a lock connected to the Consul agent of the URL in format
+// consul://[token@]host:port, e.g. the Lock URL of the config. The sessions
+// are configured by the Consul settings of the config, connections use the
+// TLS config of the config, if any.
+func New(cnf *config.Config, url string, retries int) (*Lock, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "consul" || u.Host == "" {
+		return nil, fmt.Errorf("Consul lock URL should be in format consul://[token@]host:port, instead got %s", url)
+	}
+
+	apiConfig := api.DefaultConfig()
+	apiConfig.Address = u.Host
+	if u.User != nil {
+		apiConfig.Token = u.User.Username()
+	}
+	if cnf.TLSConfig != nil {
+		apiConfig.Scheme = "https"
+		apiConfig.HttpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: cnf.TLSConfig}}
+	}
+
+	client, err := api.NewClient(apiConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := NewWithClient(client, retries)
+	if cnf.Consul != nil {
+		if cnf.Consul.SessionTTL > 0 {
+			lock.sessionTTL = time.Duration(cnf.Consul.SessionTTL) * time.Second
+		}
+		if cnf.Consul.LockDelay > 0 {
+			lock.lockDelay = time.Duration(cnf.Consul.LockDelay) * time.Second
+		} else if cnf.Consul.LockDelay < 0 {
+			// Consul takes a lock delay of zero as its default of 15 seconds
+			lock.lockDelay = time.Millisecond
+		}
+	}
+	return lock, nil
+}
+
+// NewWithClient creates a lock using the Consul client with the default
+// session TTL and lock delay of 15 seconds
+func NewWithClient(client *api.Client, retries int) *Lock {
+	return &Lock{
+		client:     client,
+		retries:    retries,
+		interval:   retryInterval,
+		sessionTTL: defaultSessionTTL,
+		lockDelay:  defaultLockDelay,
+	}
+}
+
+func (l *Lock) LockWithRetries(key string, unixTsToExpireNs int64) error {
+	for i := 0; i <= l.retries; i++ {
+		err := l.Lock(key, unixTsToExpireNs)
+		if err == nil {
+			return nil
+		}
+
+		time.Sleep(l.interval)
+	}
+	return ErrConsulLockFailed
+}
+
+// Lock takes the key with the session of the lock if it does not exist, or
+// takes it over if the lock it holds expired
+func (l *Lock) Lock(key string, unixTsToExpireNs int64) error {
+	session, err := l.getSession()
+	if err != nil {
+		return err
+	}
+
+	pair, _, err := l.client.KV().Get(key, nil)
+	if err != nil {
+		return err
+	}
+
+	lock := &api.KVTxnOp{Verb: api.KVLock, Key: key, Value: []byte(strconv.FormatInt(unixTsToExpireNs, 10)), Session: session}
+	var ops api.TxnOps
+	if pair == nil {
+		ops = api.TxnOps{
+			{KV: &api.KVTxnOp{Verb: api.KVCheckNotExists, Key: key}},
+			{KV: lock},
+		}
+	} else {
+		timeout, err := strconv.ParseInt(string(pair.Value), 10, 64)
+		if err != nil || timeout == 0 || time.Now().UnixNano() <= timeout {
+			return ErrConsulLockFailed
+		}
+		// Only take over the key if nobody else did meanwhile
+		ops = api.TxnOps{
+			{KV: &api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: pair.ModifyIndex}},
+			{KV: &api.KVTxnOp{Verb: api.KVDelete, Key: key}},
+			{KV: lock},
+		}
+	}
+
+	ok, _, _, err := l.client.Txn().Txn(ops, nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrConsulLockFailed
+	}
+	return nil
+}
+
+// Unlock deletes the key
+func (l *Lock) Unlock(key string) error {
+	_, err := l.client.KV().Delete(key, nil)
+	return err
+}
+
+// AcquireLease takes the lease of the key for the holder if it is free or
+// expired, or renews it if the holder holds it already. The key stores the
+// expiry of the lease along with its holder and is held by the session of
+// the lock, so the lease is also lost once the session expired
+func (l *Lock) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	session, err := l.getSession()
+	if err != nil {
+		return false, err
+	}
+
+	pair, _, err := l.client.KV().Get(key, nil)
+	if err != nil {
+		return false, err
+	}
+
+	value := []byte(strconv.FormatInt(time.Now().Add(ttl).UnixNano(), 10) + ":" + holder)
+	lock := &api.KVTxnOp{Verb: api.KVLock, Key: key, Value: value, Session: session}
+	var ops api.TxnOps
+	if pair == nil {
+		ops = api.TxnOps{
+			{KV: &api.KVTxnOp{Verb: api.KVCheckNotExists, Key: key}},
+			{KV: lock},
+		}
+	} else {
+		expiry, leaseHolder := parseLease(pair.Value)
+		if leaseHolder != holder && time.Now().UnixNano() <= expiry {
+			return false, nil
+		}
+		// Only renew or take over the lease if nobody else did meanwhile
+		ops = api.TxnOps{
+			{KV: &api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: pair.ModifyIndex}},
+			{KV: &api.KVTxnOp{Verb: api.KVDelete, Key: key}},
+			{KV: lock},
+		}
+	}
+
+	ok, _, _, err := l.client.Txn().Txn(ops, nil)
+	if err != nil {
+		return false, err
+	}
+	return ok, nil
+}
+
+// parseLease splits the value of a lease key into the expiry and the holder,
+// a malformed value is treated as an expired lease
+func parseLease(value []byte) (int64, string) {
+	parts := strings.SplitN(string(value), ":", 2)
+	if len(parts) != 2 {
+		return 0, ""
+	}
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, ""
+	}
+	return expiry, parts[1]
+}
+
+// Close stops renewing the session of the lock and destroys it, which
+// releases its locks
+func (l *Lock) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.session == "" {
+		return nil
+	}
+	close(l.stopRenew)
+	_, err := l.client.Session().Destroy(l.session, nil)
+	l.session = ""
+	return err
+}
+
+// getSession returns the session of the lock, it is created and renewed in
+// the background on first use, and created again once it expired
+func (l *Lock) getSession() (string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.session != "" {
+		return l.session, nil
+	}
+
+	session, _, err := l.client.Session().Create(&api.SessionEntry{
+		Name:      "machinery-lock",
+		TTL:       l.sessionTTL.String(),
+		LockDelay: l.lockDelay,
+		Behavior:  api.SessionBehaviorDelete,
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	stopRenew := make(chan struct{})
+	go func() {
+		err := l.client.Session().RenewPeriodic(l.sessionTTL.String(), session, nil, stopRenew)
+
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.session == session {
+			log.WARNING.Printf("Consul lock session %s expired: %v", session, err)
+			l.session = ""
+		}
+	}()
+
+	l.session, l.stopRenew = session, stopRenew
+	return session, nil
+}
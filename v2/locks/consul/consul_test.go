@@ -0,0 +1,132 @@
+package consul_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/locks/consul"
+	lockiface "github.com/RichardKnop/machinery/v2/locks/iface"
+	"github.com/RichardKnop/machinery/v2/utils"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	lock, err := consul.New(new(config.Config), "consul://token@localhost:8500", 3)
+	require.NoError(t, err)
+	assert.Implements(t, (*lockiface.Lock)(nil), lock)
+	assert.Implements(t, (*lockiface.Unlocker)(nil), lock)
+	assert.Implements(t, (*lockiface.Leaser)(nil), lock)
+
+	_, err = consul.New(new(config.Config), "redis://localhost:6379", 3)
+	assert.Error(t, err)
+	_, err = consul.New(new(config.Config), "consul://", 3)
+	assert.Error(t, err)
+}
+
+func newLock(t *testing.T) *consul.Lock {
+	return newLockWithDelay(t, -1)
+}
+
+func newLockWithDelay(t *testing.T, lockDelay int) *consul.Lock {
+	consulURL := os.Getenv("CONSUL_URL")
+	if consulURL == "" {
+		t.Skip("CONSUL_URL is not defined")
+	}
+
+	cnf := &config.Config{Consul: &config.ConsulConfig{SessionTTL: 10, LockDelay: lockDelay}}
+	lock, err := consul.New(cnf, consulURL, 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { lock.Close() })
+	return lock
+}
+
+func TestLock_Lock(t *testing.T) {
+	lock := newLock(t)
+	key := utils.GetPureUUID()
+
+	require.NoError(t, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	assert.Equal(t, consul.ErrConsulLockFailed, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	assert.Equal(t, consul.ErrConsulLockFailed, lock.LockWithRetries(key, time.Now().Add(25*time.Second).UnixNano()))
+
+	require.NoError(t, lock.Unlock(key))
+	assert.NoError(t, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	require.NoError(t, lock.Unlock(key))
+}
+
+func TestLock_LockExpired(t *testing.T) {
+	lock := newLock(t)
+	other := newLock(t)
+	key := utils.GetPureUUID()
+
+	require.NoError(t, lock.Lock(key, time.Now().Add(200*time.Millisecond).UnixNano()))
+	time.Sleep(300 * time.Millisecond)
+	assert.NoError(t, other.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	assert.Equal(t, consul.ErrConsulLockFailed, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	require.NoError(t, other.Unlock(key))
+}
+
+func TestLock_Close(t *testing.T) {
+	lock := newLockWithDelay(t, 1)
+	other := newLock(t)
+	key := utils.GetPureUUID()
+
+	require.NoError(t, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	// Destroying the session deletes its locks, they can be taken again once
+	// the lock delay passed
+	require.NoError(t, lock.Close())
+	assert.Equal(t, consul.ErrConsulLockFailed, other.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	time.Sleep(1100 * time.Millisecond)
+	assert.NoError(t, other.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	require.NoError(t, other.Unlock(key))
+}
+
+func TestLock_AcquireLease(t *testing.T) {
+	lock := newLock(t)
+	other := newLock(t)
+	key := utils.GetPureUUID()
+
+	held, err := lock.AcquireLease(key, "foo", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = other.AcquireLease(key, "bar", 2*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	held, err = lock.AcquireLease(key, "foo", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	require.NoError(t, lock.Unlock(key))
+	held, err = other.AcquireLease(key, "bar", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+	require.NoError(t, other.Unlock(key))
+}
+
+func TestLock_AcquireLeaseExpired(t *testing.T) {
+	lock := newLock(t)
+	other := newLock(t)
+	key := utils.GetPureUUID()
+
+	held, err := lock.AcquireLease(key, "foo", 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	// The lease expires with its TTL although the session is still renewed
+	time.Sleep(300 * time.Millisecond)
+	held, err = other.AcquireLease(key, "bar", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = lock.AcquireLease(key, "foo", 2*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+	require.NoError(t, other.Unlock(key))
+}
@@ -2,6 +2,7 @@ package eager
 
 import (
 	"errors"
+	"math"
 	"sync"
 	"time"
 )
@@ -17,6 +18,26 @@ type Lock struct {
 		sync.RWMutex
 		m map[string]int64
 	}
+	buckets struct {
+		sync.Mutex
+		m map[string]*bucket
+	}
+	leases struct {
+		sync.Mutex
+		m map[string]*lease
+	}
+}
+
+// bucket is a token bucket of TakeToken
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+// lease is a lease of AcquireLease
+type lease struct {
+	holder    string
+	expiresAt time.Time
 }
 
 func New() *Lock {
@@ -27,6 +48,14 @@ func New() *Lock {
 			sync.RWMutex
 			m map[string]int64
 		}{m: make(map[string]int64)},
+		buckets: struct {
+			sync.Mutex
+			m map[string]*bucket
+		}{m: make(map[string]*bucket)},
+		leases: struct {
+			sync.Mutex
+			m map[string]*lease
+		}{m: make(map[string]*lease)},
 	}
 }
 
@@ -53,3 +82,48 @@ func (e *Lock) Lock(key string, value int64) error {
 	}
 	return ErrEagerLockFailed
 }
+
+func (e *Lock) Unlock(key string) error {
+	e.register.Lock()
+	defer e.register.Unlock()
+	delete(e.register.m, key)
+	return nil
+}
+
+// TakeToken takes a token from the bucket of the key, refilled with limit
+// tokens per period
+func (e *Lock) TakeToken(key string, limit int, per time.Duration) (time.Duration, error) {
+	e.buckets.Lock()
+	defer e.buckets.Unlock()
+
+	now := time.Now()
+	interval := float64(per) / float64(limit)
+	b, exist := e.buckets.m[key]
+	if !exist {
+		b = &bucket{tokens: float64(limit), updatedAt: now}
+		e.buckets.m[key] = b
+	}
+
+	b.tokens = math.Min(float64(limit), b.tokens+float64(now.Sub(b.updatedAt))/interval)
+	b.updatedAt = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, nil
+	}
+	return time.Duration(math.Ceil((1 - b.tokens) * interval)), nil
+}
+
+// AcquireLease takes the lease of the key for the holder if it is free or
+// expired, or renews it if the holder holds it already
+func (e *Lock) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	e.leases.Lock()
+	defer e.leases.Unlock()
+
+	now := time.Now()
+	l, exist := e.leases.m[key]
+	if exist && l.holder != holder && now.Before(l.expiresAt) {
+		return false, nil
+	}
+	e.leases.m[key] = &lease{holder: holder, expiresAt: now.Add(ttl)}
+	return true, nil
+}
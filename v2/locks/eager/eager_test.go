@@ -39,4 +39,67 @@ func TestLock_LockWithRetries(t *testing.T) {
 func TestNew(t *testing.T) {
 	lock := New()
 	assert.Implements(t, (*lockiface.Lock)(nil), lock)
+	assert.Implements(t, (*lockiface.Unlocker)(nil), lock)
+}
+
+func TestLock_Unlock(t *testing.T) {
+	lock := New()
+	keyName := utils.GetPureUUID()
+
+	err := lock.Lock(keyName, time.Now().Add(25*time.Second).UnixNano())
+	assert.NoError(t, err)
+	assert.NoError(t, lock.Unlock(keyName))
+	err = lock.Lock(keyName, time.Now().Add(25*time.Second).UnixNano())
+	assert.NoError(t, err)
+}
+
+func TestLock_TakeToken(t *testing.T) {
+	lock := New()
+	assert.Implements(t, (*lockiface.RateLimiter)(nil), lock)
+	keyName := utils.GetPureUUID()
+
+	for i := 0; i < 2; i++ {
+		wait, err := lock.TakeToken(keyName, 2, time.Second)
+		assert.NoError(t, err)
+		assert.Zero(t, wait)
+	}
+
+	wait, err := lock.TakeToken(keyName, 2, time.Second)
+	assert.NoError(t, err)
+	assert.True(t, wait > 0 && wait <= 500*time.Millisecond, wait)
+
+	time.Sleep(wait)
+	wait, err = lock.TakeToken(keyName, 2, time.Second)
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLock_AcquireLease(t *testing.T) {
+	lock := New()
+	assert.Implements(t, (*lockiface.Leaser)(nil), lock)
+	keyName := utils.GetPureUUID()
+
+	held, err := lock.AcquireLease(keyName, "leader", 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = lock.AcquireLease(keyName, "follower", 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, held)
+
+	// Renewing the lease keeps it held by the leader
+	time.Sleep(150 * time.Millisecond)
+	held, err = lock.AcquireLease(keyName, "leader", 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, held)
+	time.Sleep(150 * time.Millisecond)
+	held, err = lock.AcquireLease(keyName, "follower", 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, held)
+
+	// The follower takes over once the lease expired
+	time.Sleep(100 * time.Millisecond)
+	held, err = lock.AcquireLease(keyName, "follower", 200*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, held)
 }
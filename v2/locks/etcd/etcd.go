@@ -0,0 +1,191 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/RichardKnop/machinery/v2/config"
+)
+
+const (
+	// requestTimeout bounds each request to etcd
+	requestTimeout = 5 * time.Second
+	// retryInterval is how long LockWithRetries waits between attempts
+	retryInterval = 100 * time.Millisecond
+)
+
+var (
+	ErrEtcdLockFailed = errors.New("etcd lock: failed to acquire lock")
+)
+
+// Lock stores locks and leases in etcd, each key is attached to an etcd lease
+// so it is deleted by etcd once it expires
+type Lock struct {
+	client   *clientv3.Client
+	retries  int
+	interval time.Duration
+}
+
+// New creates a lock connected to the etcd endpoints, e.g. localhost:2379.
+// The first endpoint may start with the credentials of the user in format
+// user:password@. The connections use the TLS config of the config, if any.
+func New(cnf *config.Config, endpoints []string, retries int) (Lock, error) {
+	endpoints = append([]string(nil), endpoints...)
+
+	var username, password string
+	if parts := strings.Split(endpoints[0], "@"); len(parts) >= 2 {
+		credentials := strings.Join(parts[:len(parts)-1], "@")
+		endpoints[0] = parts[len(parts)-1] // endpoint is the last one without @
+		if i := strings.Index(credentials, ":"); i >= 0 {
+			username, password = credentials[:i], credentials[i+1:]
+		} else {
+			username = credentials
+		}
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		Username:    username,
+		Password:    password,
+		TLS:         cnf.TLSConfig,
+		DialTimeout: requestTimeout,
+	})
+	if err != nil {
+		return Lock{}, err
+	}
+	return NewWithClient(client, retries), nil
+}
+
+// NewWithClient creates a lock using the etcd client
+func NewWithClient(client *clientv3.Client, retries int) Lock {
+	return Lock{client: client, retries: retries, interval: retryInterval}
+}
+
+func (l Lock) LockWithRetries(key string, unixTsToExpireNs int64) error {
+	for i := 0; i <= l.retries; i++ {
+		err := l.Lock(key, unixTsToExpireNs)
+		if err == nil {
+			return nil
+		}
+
+		time.Sleep(l.interval)
+	}
+	return ErrEtcdLockFailed
+}
+
+// Lock creates the key with a lease expiring with the lock, or takes over the
+// key of an expired lock whose lease has not expired yet as leases are granted
+// in whole seconds
+func (l Lock) Lock(key string, unixTsToExpireNs int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	now := time.Now().UnixNano()
+	ttl := int64(math.Ceil(float64(unixTsToExpireNs-now) / float64(time.Second)))
+	if ttl < 1 {
+		ttl = 1
+	}
+	lease, err := l.client.Grant(ctx, ttl)
+	if err != nil {
+		return err
+	}
+	put := clientv3.OpPut(key, strconv.FormatInt(unixTsToExpireNs, 10), clientv3.WithLease(lease.ID))
+
+	resp, err := l.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(put).
+		Else(clientv3.OpGet(key)).
+		Commit()
+	if err != nil {
+		l.client.Revoke(ctx, lease.ID)
+		return err
+	}
+	if resp.Succeeded {
+		return nil
+	}
+
+	if kvs := resp.Responses[0].GetResponseRange().Kvs; len(kvs) == 1 {
+		timeout, err := strconv.ParseInt(string(kvs[0].Value), 10, 64)
+		if err == nil && timeout != 0 && now > timeout {
+			// Only take over the key if nobody else did meanwhile
+			resp, err := l.client.Txn(ctx).
+				If(clientv3.Compare(clientv3.ModRevision(key), "=", kvs[0].ModRevision)).
+				Then(put).
+				Commit()
+			if err == nil && resp.Succeeded {
+				return nil
+			}
+		}
+	}
+
+	l.client.Revoke(ctx, lease.ID)
+	return ErrEtcdLockFailed
+}
+
+// Unlock deletes the key and revokes its lease
+func (l Lock) Unlock(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := l.client.Delete(ctx, key, clientv3.WithPrevKV())
+	if err != nil {
+		return err
+	}
+	for _, kv := range resp.PrevKvs {
+		if kv.Lease != 0 {
+			l.client.Revoke(ctx, clientv3.LeaseID(kv.Lease))
+		}
+	}
+	return nil
+}
+
+// AcquireLease takes the lease of the key for the holder if it is free, or
+// keeps the etcd lease of the key alive if the holder holds it already
+func (l Lock) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	current, err := l.client.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if len(current.Kvs) == 1 {
+		if string(current.Kvs[0].Value) != holder {
+			return false, nil
+		}
+		if _, err := l.client.KeepAliveOnce(ctx, clientv3.LeaseID(current.Kvs[0].Lease)); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	seconds := int64(math.Ceil(ttl.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	lease, err := l.client.Grant(ctx, seconds)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := l.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, holder, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		l.client.Revoke(ctx, lease.ID)
+		return false, err
+	}
+	return true, nil
+}
+
+// Close closes the connections to etcd
+func (l Lock) Close() error {
+	return l.client.Close()
+}
@@ -0,0 +1,84 @@
+package etcd_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/locks/etcd"
+	lockiface "github.com/RichardKnop/machinery/v2/locks/iface"
+	"github.com/RichardKnop/machinery/v2/utils"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	lock := etcd.Lock{}
+	assert.Implements(t, (*lockiface.Lock)(nil), lock)
+	assert.Implements(t, (*lockiface.Unlocker)(nil), lock)
+	assert.Implements(t, (*lockiface.Leaser)(nil), lock)
+}
+
+func newLock(t *testing.T) etcd.Lock {
+	etcdURL := os.Getenv("ETCD_URL")
+	if etcdURL == "" {
+		t.Skip("ETCD_URL is not defined")
+	}
+
+	lock, err := etcd.New(new(config.Config), strings.Split(etcdURL, ","), 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { lock.Close() })
+	return lock
+}
+
+func TestLock_Lock(t *testing.T) {
+	lock := newLock(t)
+	key := utils.GetPureUUID()
+
+	require.NoError(t, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	assert.Equal(t, etcd.ErrEtcdLockFailed, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	assert.Equal(t, etcd.ErrEtcdLockFailed, lock.LockWithRetries(key, time.Now().Add(25*time.Second).UnixNano()))
+
+	require.NoError(t, lock.Unlock(key))
+	assert.NoError(t, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	require.NoError(t, lock.Unlock(key))
+}
+
+func TestLock_LockExpired(t *testing.T) {
+	lock := newLock(t)
+	key := utils.GetPureUUID()
+
+	// The lease of the key outlives the lock by up to a second
+	require.NoError(t, lock.Lock(key, time.Now().Add(200*time.Millisecond).UnixNano()))
+	time.Sleep(300 * time.Millisecond)
+	assert.NoError(t, lock.Lock(key, time.Now().Add(25*time.Second).UnixNano()))
+	require.NoError(t, lock.Unlock(key))
+}
+
+func TestLock_AcquireLease(t *testing.T) {
+	lock := newLock(t)
+	key := utils.GetPureUUID()
+
+	held, err := lock.AcquireLease(key, "foo", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	held, err = lock.AcquireLease(key, "bar", 2*time.Second)
+	require.NoError(t, err)
+	assert.False(t, held)
+
+	held, err = lock.AcquireLease(key, "foo", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+
+	require.NoError(t, lock.Unlock(key))
+	held, err = lock.AcquireLease(key, "bar", 2*time.Second)
+	require.NoError(t, err)
+	assert.True(t, held)
+	require.NoError(t, lock.Unlock(key))
+}
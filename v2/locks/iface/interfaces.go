@@ -1,5 +1,7 @@
 package iface
 
+import "time"
+
 type Lock interface {
 	//Acquire the lock with retry
 	//key: the name of the lock,
@@ -11,3 +13,31 @@ type Lock interface {
 	//value: at the nanosecond timestamp that lock needs to be released automatically
 	Lock(key string, value int64) error
 }
+
+// Unlocker is implemented by locks which can be released before they expire
+type Unlocker interface {
+	//Release the lock
+	//key: the name of the lock
+	Unlock(key string) error
+}
+
+// RateLimiter is implemented by locks which can share token buckets between
+// workers, e.g. to rate limit a task across the cluster
+type RateLimiter interface {
+	//Take a token from the bucket
+	//key: the name of the bucket,
+	//limit: the number of tokens refilled per period, the most the bucket holds
+	//returns how long to wait for the next token when the bucket is empty
+	TakeToken(key string, limit int, per time.Duration) (time.Duration, error)
+}
+
+// Leaser is implemented by locks which can hold leases renewed by their
+// holder, e.g. to elect the leader of the servers sending periodic tasks
+type Leaser interface {
+	//Acquire the lease or renew it if it is held by the holder already
+	//key: the name of the lease,
+	//holder: the ID of who takes the lease,
+	//ttl: how long the lease is held unless it is renewed
+	//returns whether the holder holds the lease
+	AcquireLease(key, holder string, ttl time.Duration) (bool, error)
+}
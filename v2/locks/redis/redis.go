@@ -6,14 +6,59 @@ import (
 	"strings"
 	"time"
 
+	"github.com/RichardKnop/machinery/v2/common"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/go-redis/redis/v8"
 )
 
 var (
 	ErrRedisLockFailed = errors.New("redis lock: failed to acquire lock")
+	// ErrRedisLockNotConnected is returned when rate limiting or taking a
+	// lease with a lock created without retries, which has no client
+	ErrRedisLockNotConnected = errors.New("redis lock: not connected")
 )
 
+// takeTokenScript refills the token bucket stored in a hash by the time passed
+// since it was updated and takes a token, it returns the milliseconds to wait
+// for the next token when the bucket is empty
+var takeTokenScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(bucket[1])
+local updatedAt = tonumber(bucket[2])
+if tokens == nil or updatedAt == nil then
+	tokens = limit
+else
+	tokens = math.min(limit, tokens + math.max(0, now - updatedAt) / interval)
+end
+
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+else
+	wait = math.ceil((1 - tokens) * interval)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated_at", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(limit * interval) + 1000)
+return wait
+`)
+
+// acquireLeaseScript sets the holder of the lease if it is free or held by
+// the holder already, it returns 1 if the holder holds the lease
+var acquireLeaseScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if holder and holder ~= ARGV[1] then
+	return 0
+end
+
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
 type Lock struct {
 	rclient  redis.UniversalClient
 	retries  int
@@ -35,9 +80,10 @@ func New(cnf *config.Config, addrs []string, db, retries int) Lock {
 	}
 
 	ropt := &redis.UniversalOptions{
-		Addrs:    addrs,
-		DB:       db,
-		Password: password,
+		Addrs:     addrs,
+		DB:        db,
+		Password:  password,
+		TLSConfig: common.RedisLockTLSConfig(cnf),
 	}
 	if cnf.Redis != nil {
 		ropt.MasterName = cnf.Redis.MasterName
@@ -107,3 +153,37 @@ func (r Lock) Lock(key string, unixTsToExpireNs int64) error {
 
 	return nil
 }
+
+func (r Lock) Unlock(key string) error {
+	return r.rclient.Del(r.rclient.Context(), key).Err()
+}
+
+// TakeToken takes a token from the bucket of the key shared by every worker,
+// refilled with limit tokens per period
+func (r Lock) TakeToken(key string, limit int, per time.Duration) (time.Duration, error) {
+	if r.rclient == nil {
+		return 0, ErrRedisLockNotConnected
+	}
+
+	interval := float64(per.Milliseconds()) / float64(limit)
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+	wait, err := takeTokenScript.Run(r.rclient.Context(), r.rclient, []string{key}, limit, interval, now).Int64()
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait) * time.Millisecond, nil
+}
+
+// AcquireLease takes the lease of the key for the holder if it is free, or
+// renews it if the holder holds it already, the lease expires with its key
+func (r Lock) AcquireLease(key, holder string, ttl time.Duration) (bool, error) {
+	if r.rclient == nil {
+		return false, ErrRedisLockNotConnected
+	}
+
+	held, err := acquireLeaseScript.Run(r.rclient.Context(), r.rclient, []string{key}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return held == 1, nil
+}
@@ -0,0 +1,192 @@
+// Package metrics exports Prometheus metrics of the tasks published and
+// processed by machinery servers and workers.
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/brokers"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// Namespace prefixes the names of the metrics
+const Namespace = "machinery"
+
+// Metrics records the metrics of machinery:
+//
+//	machinery_tasks_published_total{task,result}    tasks published, result is success or error
+//	machinery_tasks_consumed_total{task}            tasks consumed by workers
+//	machinery_task_duration_seconds{task,state}     durations of tasks from their start to their SUCCESS, FAILURE, RETRY or CANCELED state
+//	machinery_task_retries_total{task}              retried tasks
+//	machinery_queue_pending_tasks{queue}            tasks waiting in queues, read on each scrape
+//	machinery_backend_latency_seconds{state}        latencies of recording task states in the result backend
+type Metrics struct {
+	registerer prometheus.Registerer
+	published  *prometheus.CounterVec
+	consumed   *prometheus.CounterVec
+	durations  *prometheus.HistogramVec
+	retries    *prometheus.CounterVec
+	latencies  *prometheus.HistogramVec
+	// started holds the start times of the running tasks by their UUIDs
+	started sync.Map
+}
+
+// New creates the metrics and registers them with the registerer, the
+// default Prometheus registerer if it is nil
+func New(registerer prometheus.Registerer) (*Metrics, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	m := &Metrics{
+		registerer: registerer,
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "tasks_published_total",
+			Help:      "Number of tasks published, by task name and result.",
+		}, []string{"task", "result"}),
+		consumed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "tasks_consumed_total",
+			Help:      "Number of tasks consumed by workers, by task name.",
+		}, []string{"task"}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "task_duration_seconds",
+			Help:      "Durations of tasks from their start to their final state, by task name and state.",
+			Buckets:   prometheus.ExponentialBuckets(0.005, 4, 10),
+		}, []string{"task", "state"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "task_retries_total",
+			Help:      "Number of retried tasks, by task name.",
+		}, []string{"task"}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "backend_latency_seconds",
+			Help:      "Latencies of recording task states in the result backend, by state.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"state"}),
+	}
+
+	for _, collector := range []prometheus.Collector{m.published, m.consumed, m.durations, m.retries, m.latencies} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// Middleware returns the broker middleware counting published and consumed
+// tasks, see machinery.WithBrokerMiddleware
+func (m *Metrics) Middleware() brokers.Middleware {
+	return brokers.MiddlewareFuncs{
+		Publish: func(next brokers.PublishFunc) brokers.PublishFunc {
+			return func(ctx context.Context, signature *tasks.Signature) error {
+				err := next(ctx, signature)
+				result := "success"
+				if err != nil {
+					result = "error"
+				}
+				m.published.WithLabelValues(signature.Name, result).Inc()
+				return err
+			}
+		},
+		Consume: func(next brokers.ConsumeFunc) brokers.ConsumeFunc {
+			return func(signature *tasks.Signature) error {
+				m.consumed.WithLabelValues(signature.Name).Inc()
+				return next(signature)
+			}
+		},
+	}
+}
+
+// InstrumentWorker records the durations, retries and backend latencies of
+// the tasks processed by the worker, it sets the state handler of the worker
+func (m *Metrics) InstrumentWorker(worker *machinery.Worker) {
+	worker.SetStateHandler(m.observeState)
+}
+
+// observeState records the new state of the task
+func (m *Metrics) observeState(signature *tasks.Signature, state string, latency time.Duration) {
+	m.latencies.WithLabelValues(strings.ToLower(state)).Observe(latency.Seconds())
+
+	switch state {
+	case tasks.StateStarted:
+		m.started.Store(signature.UUID, time.Now())
+		return
+	case tasks.StateRetry:
+		m.retries.WithLabelValues(signature.Name).Inc()
+	case tasks.StateSuccess, tasks.StateFailure, tasks.StateCanceled:
+	default:
+		return
+	}
+
+	// Tasks canceled or failed before they started have no duration
+	if startedAt, ok := m.started.LoadAndDelete(signature.UUID); ok {
+		duration := time.Since(startedAt.(time.Time))
+		m.durations.WithLabelValues(signature.Name, strings.ToLower(state)).Observe(duration.Seconds())
+	}
+}
+
+// RegisterQueueDepths exports the number of tasks waiting in the queues, the
+// default queue if none is given. They are read from the broker of the server
+// on each scrape.
+func (m *Metrics) RegisterQueueDepths(server *machinery.Server, queues ...string) error {
+	if len(queues) == 0 {
+		queues = []string{server.GetConfig().DefaultQueue}
+	}
+	return m.registerer.Register(&queueCollector{
+		server: server,
+		queues: queues,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(Namespace, "queue", "pending_tasks"),
+			"Number of tasks waiting in the queue.",
+			[]string{"queue"}, nil,
+		),
+	})
+}
+
+// Handler returns the handler serving the metrics, from the registerer if
+// it is a gatherer, e.g. a prometheus.Registry, otherwise from the default
+// Prometheus gatherer
+func (m *Metrics) Handler() http.Handler {
+	if gatherer, ok := m.registerer.(prometheus.Gatherer); ok {
+		return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	}
+	return promhttp.Handler()
+}
+
+// queueCollector reads the depths of the queues from the broker
+type queueCollector struct {
+	server *machinery.Server
+	queues []string
+	desc   *prometheus.Desc
+}
+
+// Describe implements prometheus.Collector
+func (c *queueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector, queues which cannot be read are
+// skipped
+func (c *queueCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, queue := range c.queues {
+		pending, err := c.server.GetBroker().GetPendingTasks(queue)
+		if err != nil {
+			log.WARNING.Printf("Failed to read the depth of queue %s: %s", queue, err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(len(pending)), queue)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/metrics"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	memorybackend "github.com/RichardKnop/machinery/v2/backends/memory"
+	memorybroker "github.com/RichardKnop/machinery/v2/brokers/memory"
+	lock "github.com/RichardKnop/machinery/v2/locks/eager"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	m, err := metrics.New(registry)
+	require.NoError(t, err)
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New(), machinery.WithBrokerMiddleware(m.Middleware()))
+	require.NoError(t, m.RegisterQueueDepths(server, "machinery_tasks", "other_tasks"))
+	require.NoError(t, server.RegisterTask("add", func(a, b int64) (int64, error) { return a + b, nil }))
+	require.NoError(t, server.RegisterTask("fail", func() error { return errors.New("boom") }))
+
+	worker := server.NewWorker("test_worker", 1)
+	m.InstrumentWorker(worker)
+	go worker.Launch()
+	defer worker.Quit()
+
+	asyncResult, err := server.SendTask(&tasks.Signature{
+		Name: "add",
+		Args: []tasks.Arg{{Type: "int64", Value: 1}, {Type: "int64", Value: 2}},
+	})
+	require.NoError(t, err)
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	require.NoError(t, err)
+
+	asyncResult, err = server.SendTask(&tasks.Signature{Name: "fail"})
+	require.NoError(t, err)
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	require.Error(t, err)
+
+	// Tasks of queues no worker consumes are pending
+	_, err = server.SendTask(&tasks.Signature{Name: "add", RoutingKey: "other_tasks"})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := recorder.Body.String()
+	assert.Contains(t, body, `machinery_tasks_published_total{result="success",task="add"} 2`)
+	assert.Contains(t, body, `machinery_tasks_consumed_total{task="add"} 1`)
+	assert.Contains(t, body, `machinery_task_duration_seconds_count{state="success",task="add"} 1`)
+	assert.Contains(t, body, `machinery_task_duration_seconds_count{state="failure",task="fail"} 1`)
+	assert.Contains(t, body, `machinery_backend_latency_seconds_count{state="started"} 2`)
+	assert.Contains(t, body, `machinery_queue_pending_tasks{queue="machinery_tasks"} 0`)
+	assert.Contains(t, body, `machinery_queue_pending_tasks{queue="other_tasks"} 1`)
+}
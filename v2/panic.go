@@ -0,0 +1,64 @@
+package machinery
+
+import (
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// PanicPolicy decides what a worker does with a task which panicked
+type PanicPolicy int
+
+const (
+	// PanicRetry - the task is handled like a task returning an error, it is
+	// retried if it has retries left
+	PanicRetry PanicPolicy = iota
+	// PanicFail - the task fails at once
+	PanicFail
+	// PanicDeadLetter - the task fails at once and is moved to the dead letter
+	// queue
+	PanicDeadLetter
+	// PanicCrash - the worker process panics again with the recovered value,
+	// the task is not finished, e.g. it is delivered again or found stuck
+	PanicCrash
+)
+
+// SetPanicHandler sets a handler called with the value recovered from a task
+// which panicked and its stack trace, before the panic policy is applied
+func (worker *Worker) SetPanicHandler(handler func(signature *tasks.Signature, value interface{}, stack string)) {
+	worker.panicHandler = handler
+}
+
+// crashesOn returns true if the worker crashes because the task returned the
+// error
+func (worker *Worker) crashesOn(err error) bool {
+	var panicked tasks.ErrPanicked
+	return worker.PanicPolicy == PanicCrash && errors.As(err, &panicked)
+}
+
+// taskErroredOrPanicked applies the panic policy to a task which panicked,
+// other errors are handled by taskErrored
+func (worker *Worker) taskErroredOrPanicked(signature *tasks.Signature, err error) error {
+	var panicked tasks.ErrPanicked
+	if !errors.As(err, &panicked) {
+		return worker.taskErrored(signature, err)
+	}
+
+	if worker.panicHandler != nil {
+		worker.panicHandler(signature, panicked.Value, panicked.Stack)
+	}
+
+	switch worker.PanicPolicy {
+	case PanicFail:
+		return worker.taskFailed(signature, err)
+	case PanicDeadLetter:
+		worker.moveToDeadLetterQueue(signature, tasks.DeadLetterReasonPanicked, err)
+		return worker.taskFailed(signature, err)
+	case PanicCrash:
+		log.FATAL.Printf("Task %s panicked, crashing the worker: %s", signature.UUID, panicked.Stack)
+		panic(panicked.Value)
+	default:
+		return worker.taskErrored(signature, err)
+	}
+}
@@ -0,0 +1,94 @@
+package machinery
+
+import (
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+const (
+	// PauseWorkersTaskName is the name of the control task broadcast by
+	// Server.PauseWorkers
+	PauseWorkersTaskName = "machinery_pause_workers"
+	// ResumeWorkersTaskName is the name of the control task broadcast by
+	// Server.ResumeWorkers
+	ResumeWorkersTaskName = "machinery_resume_workers"
+)
+
+// Pause stops the worker from processing new tasks, e.g. during a deploy or
+// while a downstream dependency is degraded. Running tasks are finished, tasks
+// received meanwhile wait until the worker is resumed.
+func (worker *Worker) Pause() {
+	if worker.IsPaused() {
+		return
+	}
+	worker.concurrencyLimiter().setPaused(true)
+	log.WARNING.Printf("Worker %s paused", worker.ConsumerTag)
+}
+
+// Resume lets a paused worker process tasks again
+func (worker *Worker) Resume() {
+	if !worker.IsPaused() {
+		return
+	}
+	worker.concurrencyLimiter().setPaused(false)
+	log.INFO.Printf("Worker %s resumed", worker.ConsumerTag)
+}
+
+// IsPaused returns true if the worker has been paused
+func (worker *Worker) IsPaused() bool {
+	return worker.concurrencyLimiter().isPaused()
+}
+
+// PauseWorkers broadcasts a control task pausing every worker consuming from
+// the queue, every worker if the queue is empty, see Worker.Pause
+func (server *Server) PauseWorkers(queue string) error {
+	return server.SendBroadcast(newControlSignature(PauseWorkersTaskName, queue))
+}
+
+// ResumeWorkers broadcasts a control task resuming every worker consuming from
+// the queue, every worker if the queue is empty, see Worker.Resume
+func (server *Server) ResumeWorkers(queue string) error {
+	return server.SendBroadcast(newControlSignature(ResumeWorkersTaskName, queue))
+}
+
+// newControlSignature creates the signature of a control task for the workers
+// of the queue
+func newControlSignature(name, queue string) *tasks.Signature {
+	return &tasks.Signature{
+		Name: name,
+		Args: []tasks.Arg{{Type: "string", Value: queue}},
+	}
+}
+
+// processControl handles the task if it is a control task broadcast by the
+// server, it returns false for any other task
+func (worker *Worker) processControl(signature *tasks.Signature) bool {
+	if !signature.Broadcast {
+		return false
+	}
+	if signature.Name != PauseWorkersTaskName && signature.Name != ResumeWorkersTaskName {
+		return false
+	}
+
+	// The control task is meant for the workers of another queue
+	if len(signature.Args) > 0 {
+		if queue, _ := signature.Args[0].Value.(string); queue != "" && queue != worker.queue() {
+			return true
+		}
+	}
+
+	if signature.Name == PauseWorkersTaskName {
+		worker.Pause()
+	} else {
+		worker.Resume()
+	}
+	return true
+}
+
+// queue returns the queue the worker consumes from
+func (worker *Worker) queue() string {
+	if worker.Queue != "" {
+		return worker.Queue
+	}
+	return worker.server.GetConfig().DefaultQueue
+}
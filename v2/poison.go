@@ -0,0 +1,49 @@
+package machinery
+
+import (
+	"fmt"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// isPoison counts the delivery of the task, it returns true if the task has
+// been delivered more than MaxDeliveries times without finishing
+func (worker *Worker) isPoison(signature *tasks.Signature) (int, bool) {
+	maxDeliveries := worker.server.GetConfig().MaxDeliveries
+	if maxDeliveries <= 0 {
+		return 0, false
+	}
+
+	deliveries, err := backends.CountDelivery(worker.server.GetBackend(), signature.UUID)
+	if err != nil {
+		if err != backends.ErrDeliveriesNotSupported {
+			log.ERROR.Printf("Failed to count delivery of task %s: %s", signature.UUID, err)
+		}
+		return 0, false
+	}
+	return deliveries, deliveries > maxDeliveries
+}
+
+// resetDeliveries resets the deliveries of the task once an attempt of the
+// task finished
+func (worker *Worker) resetDeliveries(signature *tasks.Signature) {
+	if worker.server.GetConfig().MaxDeliveries <= 0 {
+		return
+	}
+
+	err := backends.ResetDeliveries(worker.server.GetBackend(), signature.UUID)
+	if err != nil && err != backends.ErrDeliveriesNotSupported {
+		log.ERROR.Printf("Failed to reset deliveries of task %s: %s", signature.UUID, err)
+	}
+}
+
+// quarantine fails the task delivered too many times without finishing and
+// moves it to the poison queue instead of processing it again
+func (worker *Worker) quarantine(signature *tasks.Signature, deliveries int) error {
+	err := fmt.Errorf("Task %s has been delivered %d times without finishing", signature.UUID, deliveries)
+	worker.moveToDeadLetterQueue(signature, tasks.DeadLetterReasonPoison, err)
+	worker.resetDeliveries(signature)
+	return worker.taskFailed(signature, err)
+}
@@ -0,0 +1,79 @@
+package machinery
+
+import (
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	lockiface "github.com/RichardKnop/machinery/v2/locks/iface"
+)
+
+// rateLimitSettings is the rate limit a task has been registered with
+type rateLimitSettings struct {
+	limit int
+	per   time.Duration
+}
+
+// WithRateLimit limits how many times the task is processed per period by
+// every worker sharing the lock of the server, e.g. to stay within the quota
+// of a third-party API. Tasks exceeding the rate limit are requeued to be
+// processed once a token is available. It overrides the RateLimits config.
+func WithRateLimit(limit int, per time.Duration) TaskOption {
+	return func(opts *taskOptions) {
+		opts.rateLimit = &rateLimitSettings{limit: limit, per: per}
+	}
+}
+
+// rateLimitKey returns the key of the token bucket of the task
+func rateLimitKey(name string) string {
+	return "machinery_rate_limit:" + name
+}
+
+// getRateLimit returns the rate limit of the task, zero if it has none
+func (worker *Worker) getRateLimit(name string) (int, time.Duration) {
+	if settings := worker.server.getTaskOptions(name).rateLimit; settings != nil {
+		return settings.limit, settings.per
+	}
+
+	limit, per, err := worker.server.GetConfig().GetRateLimit(name)
+	if err != nil {
+		log.ERROR.Print(err)
+		return 0, 0
+	}
+	return limit, per
+}
+
+// takeToken takes a token from the bucket of the task, it returns how long to
+// wait for the next token when the task exceeded its rate limit. Tasks are
+// processed when the lock cannot rate limit them.
+func (worker *Worker) takeToken(signature *tasks.Signature) time.Duration {
+	limit, per := worker.getRateLimit(signature.Name)
+	if limit < 1 || per <= 0 {
+		return 0
+	}
+
+	limiter, ok := worker.server.lock.(lockiface.RateLimiter)
+	if !ok {
+		log.WARNING.Printf("Task %s is rate limited but the lock does not support rate limiting", signature.Name)
+		return 0
+	}
+
+	wait, err := limiter.TakeToken(rateLimitKey(signature.Name), limit, per)
+	if err != nil {
+		log.ERROR.Printf("Failed to take a token of task %s: %s", signature.Name, err)
+		return 0
+	}
+	return wait
+}
+
+// requeueRateLimited sends the task again to be processed once a token of its
+// rate limit is available
+func (worker *Worker) requeueRateLimited(signature *tasks.Signature, wait time.Duration) error {
+	log.DEBUG.Printf("Task %s exceeded its rate limit. Going to requeue task %s in %s.", signature.Name, signature.UUID, wait)
+
+	eta := time.Now().UTC().Add(wait)
+	signature.ETA = &eta
+	_, err := worker.server.resendTask(signature)
+	return err
+}
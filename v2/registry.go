@@ -0,0 +1,110 @@
+package machinery
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// workerHeartbeatsPerTTL is the number of heartbeats a worker can miss before
+// its registration expires
+const workerHeartbeatsPerTTL = 3
+
+// ID returns the ID the worker is registered with, unique even for workers
+// sharing a consumer tag
+func (worker *Worker) ID() string {
+	worker.idOnce.Do(func() {
+		worker.id = fmt.Sprintf("%s-%s", worker.ConsumerTag, uuid.New().String())
+	})
+	return worker.id
+}
+
+// Info returns the info the worker is registered with
+func (worker *Worker) Info() *tasks.WorkerInfo {
+	hostname, _ := os.Hostname()
+	drainStatus := worker.DrainStatus()
+	return &tasks.WorkerInfo{
+		ID:          worker.ID(),
+		ConsumerTag: worker.ConsumerTag,
+		Hostname:    hostname,
+		PID:         os.Getpid(),
+		Queues:      []string{worker.queue()},
+		Concurrency: worker.GetConcurrency(),
+		Version:     worker.Version,
+		StartedAt:   worker.startedAt,
+		HeartbeatAt: time.Now().UTC(),
+		Running:     drainStatus.Running,
+		Succeeded:   atomic.LoadInt64(&worker.succeeded),
+		Failed:      atomic.LoadInt64(&worker.failed),
+		Paused:      worker.IsPaused(),
+		Draining:    drainStatus.Draining,
+	}
+}
+
+// GetWorkers returns the workers registered in the result backend which are
+// alive, see Config.WorkerHeartbeatInterval
+func (server *Server) GetWorkers() ([]*tasks.WorkerInfo, error) {
+	return backends.Workers(server.backend)
+}
+
+// startRegistration registers the worker in the result backend every
+// WorkerHeartbeatInterval seconds, the returned function stops it and
+// unregisters the worker
+func (worker *Worker) startRegistration() context.CancelFunc {
+	cnf := worker.server.GetConfig()
+	backend := worker.server.GetBackend()
+	if cnf.WorkerHeartbeatInterval < 0 || backend == nil || !backends.WorkerRegistrySupported(backend) {
+		return func() {}
+	}
+
+	interval := cnf.WorkerHeartbeatInterval
+	if interval == 0 {
+		interval = config.DefaultWorkerHeartbeatInterval
+	}
+	ttl := time.Duration(interval*workerHeartbeatsPerTTL) * time.Second
+
+	worker.startedAt = time.Now().UTC()
+	worker.register(ttl)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				worker.register(ttl)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if err := backends.UnregisterWorker(backend, worker.ID()); err != nil {
+			log.ERROR.Printf("Failed to unregister worker %s: %s", worker.ID(), err)
+		}
+	}
+}
+
+// register records the worker in the result backend until the TTL passed
+func (worker *Worker) register(ttl time.Duration) {
+	if err := backends.RegisterWorker(worker.server.GetBackend(), worker.Info(), ttl); err != nil {
+		log.ERROR.Printf("Failed to register worker %s: %s", worker.ID(), err)
+	}
+}
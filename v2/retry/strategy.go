@@ -0,0 +1,107 @@
+package retry
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Strategy returns how long to wait before retrying a failed task. Attempt is
+// 1 for the first retry and previous is the delay before the previous retry,
+// zero before the first one.
+type Strategy func(attempt int, previous time.Duration) time.Duration
+
+const (
+	// DefaultBaseDelay is the delay before the first retry of the registered
+	// exponential strategies
+	DefaultBaseDelay = time.Second
+	// DefaultMaxDelay caps delays of the registered exponential strategies
+	DefaultMaxDelay = time.Hour
+)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]Strategy{}
+)
+
+func init() {
+	RegisterStrategy("fibonacci", FibonacciStrategy())
+	RegisterStrategy("exponential", Exponential(DefaultBaseDelay, DefaultMaxDelay))
+	RegisterStrategy("full_jitter", FullJitter(DefaultBaseDelay, DefaultMaxDelay))
+}
+
+// RegisterStrategy makes a strategy available by its name, e.g. to be set as
+// the RetryStrategy of signatures. A strategy registered with the name of
+// another one replaces it.
+func RegisterStrategy(name string, strategy Strategy) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+	strategies[name] = strategy
+}
+
+// GetStrategy returns the strategy registered with the name, the Fibonacci
+// strategy when the name is empty
+func GetStrategy(name string) (Strategy, error) {
+	if name == "" {
+		name = "fibonacci"
+	}
+
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+	strategy, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown retry strategy: %s", name)
+	}
+	return strategy, nil
+}
+
+// FibonacciStrategy waits the next number of the Fibonacci sequence of
+// seconds greater than the previous delay, the default strategy
+func FibonacciStrategy() Strategy {
+	return func(attempt int, previous time.Duration) time.Duration {
+		return time.Duration(FibonacciNext(int(previous/time.Second))) * time.Second
+	}
+}
+
+// Fixed waits the same delay before each retry
+func Fixed(delay time.Duration) Strategy {
+	return func(attempt int, previous time.Duration) time.Duration {
+		return delay
+	}
+}
+
+// Exponential doubles the delay with each retry starting from base, delays
+// are capped at max
+func Exponential(base, max time.Duration) Strategy {
+	return func(attempt int, previous time.Duration) time.Duration {
+		return exponentialDelay(base, max, attempt)
+	}
+}
+
+// FullJitter waits a random delay between zero and the delay of Exponential,
+// so tasks failing at the same time are not all retried at the same time
+func FullJitter(base, max time.Duration) Strategy {
+	return func(attempt int, previous time.Duration) time.Duration {
+		delay := exponentialDelay(base, max, attempt)
+		if delay <= 0 {
+			return 0
+		}
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	}
+}
+
+// exponentialDelay returns base * 2^(attempt-1) capped at max
+func exponentialDelay(base, max time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt; i++ {
+		if delay >= max/2 {
+			return max
+		}
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
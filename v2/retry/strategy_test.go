@@ -0,0 +1,41 @@
+package retry_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrategies(t *testing.T) {
+	fibonacci, err := retry.GetStrategy("")
+	require.NoError(t, err)
+	assert.Equal(t, time.Second, fibonacci(1, 0))
+	assert.Equal(t, 5*time.Second, fibonacci(4, 3*time.Second))
+
+	fixed := retry.Fixed(10 * time.Second)
+	assert.Equal(t, 10*time.Second, fixed(1, 0))
+	assert.Equal(t, 10*time.Second, fixed(5, 10*time.Second))
+
+	exponential := retry.Exponential(time.Second, time.Minute)
+	var delays []time.Duration
+	for attempt := 1; attempt <= 8; attempt++ {
+		delays = append(delays, exponential(attempt, 0))
+	}
+	assert.Equal(t, []time.Duration{
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		16 * time.Second, 32 * time.Second, time.Minute, time.Minute,
+	}, delays)
+	assert.Equal(t, time.Minute, exponential(1000, 0))
+
+	jitter := retry.FullJitter(time.Second, time.Minute)
+	for attempt := 1; attempt <= 8; attempt++ {
+		delay := jitter(attempt, 0)
+		assert.True(t, delay >= 0 && delay <= exponential(attempt, 0), delay)
+	}
+
+	_, err = retry.GetStrategy("linear")
+	assert.Error(t, err)
+}
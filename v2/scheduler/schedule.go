@@ -0,0 +1,149 @@
+// Package scheduler provides the schedules of periodic tasks, which are cron
+// specs or the intervals, one-off times and calendar rules beyond them
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Schedule tells when the runs of a periodic task are due, cron schedules
+// are one implementation of it
+type Schedule interface {
+	// Next returns the time of the next run after the time, the zero time if
+	// there is none
+	Next(time.Time) time.Time
+}
+
+// secondsParser parses cron specs with an optional first field of seconds
+var secondsParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+// Parse parses the spec of a schedule, which is one of:
+//
+//	@at 2026-12-24T18:00:00Z,2026-12-31T18:00:00Z  one-off runs at RFC3339 times
+//	@last-business-day 18:00                       on the last weekday of each month
+//	@every 1h30m                                   at a fixed interval
+//	0 9 * * *                                      a cron spec with five fields
+//
+// The spec may start with CRON_TZ= and the name of its time zone, the local
+// time zone is used otherwise.
+func Parse(spec string) (Schedule, error) {
+	return parse(spec, cron.ParseStandard)
+}
+
+// ParseWithSeconds parses the spec of a schedule like Parse, except that
+// cron specs may have six fields, the first one being seconds, e.g.
+// 30 0 9 * * * runs at 9:00:30
+func ParseWithSeconds(spec string) (Schedule, error) {
+	return parse(spec, secondsParser.Parse)
+}
+
+// parse parses the spec of a schedule with the cron parser for cron specs
+func parse(spec string, parseCron func(string) (cron.Schedule, error)) (Schedule, error) {
+	loc, rest, err := splitTimezone(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasPrefix(rest, "@at "):
+		var times []time.Time
+		for _, value := range strings.Split(strings.TrimPrefix(rest, "@at "), ",") {
+			t, err := time.Parse(time.RFC3339, strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("Parse time of spec %s error: %s", spec, err)
+			}
+			times = append(times, t)
+		}
+		return At(times...), nil
+	case strings.HasPrefix(rest, "@last-business-day "):
+		t, err := time.Parse("15:04", strings.TrimSpace(strings.TrimPrefix(rest, "@last-business-day ")))
+		if err != nil {
+			return nil, fmt.Errorf("Parse time of day of spec %s error: %s", spec, err)
+		}
+		return LastBusinessDay(t.Hour(), t.Minute(), loc), nil
+	default:
+		return parseCron(spec)
+	}
+}
+
+// splitTimezone returns the time zone the spec starts with, the local time
+// zone if it has none, and the rest of the spec
+func splitTimezone(spec string) (*time.Location, string, error) {
+	if !strings.HasPrefix(spec, "CRON_TZ=") && !strings.HasPrefix(spec, "TZ=") {
+		return time.Local, spec, nil
+	}
+
+	i := strings.Index(spec, " ")
+	if i == -1 {
+		return nil, "", fmt.Errorf("Spec %s has only a time zone", spec)
+	}
+	name := spec[strings.Index(spec, "=")+1 : i]
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, "", fmt.Errorf("Spec %s has unknown time zone %s", spec, name)
+	}
+	return loc, strings.TrimSpace(spec[i:]), nil
+}
+
+// Every returns a schedule running at a fixed interval, like the @every spec
+// it is rounded down to the second and at least a second
+func Every(interval time.Duration) Schedule {
+	return cron.Every(interval)
+}
+
+// oneOff runs at the times, sorted
+type oneOff []time.Time
+
+// At returns a schedule running once at each of the times
+func At(times ...time.Time) Schedule {
+	sorted := append(oneOff(nil), times...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Before(sorted[j])
+	})
+	return sorted
+}
+
+// Next returns the first of the times after the time
+func (times oneOff) Next(t time.Time) time.Time {
+	for _, next := range times {
+		if next.After(t) {
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// lastBusinessDay runs on the last weekday of each month at a time of day
+type lastBusinessDay struct {
+	hour, minute int
+	loc          *time.Location
+}
+
+// LastBusinessDay returns a schedule running on the last weekday of each
+// month, from Monday to Friday, at the hour and minute in the time zone
+func LastBusinessDay(hour, minute int, loc *time.Location) Schedule {
+	return lastBusinessDay{hour: hour, minute: minute, loc: loc}
+}
+
+// Next returns the time of day on the last weekday of the month of the time,
+// or of the next month if it has passed
+func (schedule lastBusinessDay) Next(t time.Time) time.Time {
+	t = t.In(schedule.loc)
+	for months := 0; ; months++ {
+		// The day before the first day of the following month
+		day := time.Date(t.Year(), t.Month()+time.Month(months)+1, 0, schedule.hour, schedule.minute, 0, 0, schedule.loc)
+		for day.Weekday() == time.Saturday || day.Weekday() == time.Sunday {
+			day = day.AddDate(0, 0, -1)
+		}
+		if day.After(t) {
+			return day
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/scheduler"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC)
+
+	schedule, err := scheduler.Parse("CRON_TZ=UTC 0 9 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, time.January, 16, 9, 0, 0, 0, time.UTC), schedule.Next(now).UTC())
+
+	schedule, err = scheduler.Parse("@every 90s")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(90*time.Second), schedule.Next(now))
+
+	schedule, err = scheduler.Parse("@at 2026-12-31T18:00:00Z, 2026-12-24T18:00:00Z")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, time.December, 24, 18, 0, 0, 0, time.UTC), schedule.Next(now))
+
+	schedule, err = scheduler.Parse("CRON_TZ=Europe/Berlin @last-business-day 18:00")
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, time.January, 30, 18, 0, 0, 0, berlin), schedule.Next(now))
+
+	for _, spec := range []string{"@at tomorrow", "@last-business-day 6pm", "CRON_TZ=Nowhere/City 0 9 * * *", "0 9 * *"} {
+		_, err := scheduler.Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestAt(t *testing.T) {
+	t.Parallel()
+
+	first := time.Date(2026, time.March, 1, 9, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	schedule := scheduler.At(second, first)
+
+	assert.Equal(t, first, schedule.Next(first.Add(-time.Minute)))
+	assert.Equal(t, second, schedule.Next(first))
+	assert.True(t, schedule.Next(second).IsZero())
+}
+
+func TestLastBusinessDay(t *testing.T) {
+	t.Parallel()
+
+	schedule := scheduler.LastBusinessDay(18, 30, time.UTC)
+
+	// May 31 2026 is a Sunday
+	next := schedule.Next(time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, time.May, 29, 18, 30, 0, 0, time.UTC), next)
+
+	// Runs of the month which passed move on to the next month
+	next = schedule.Next(next)
+	assert.Equal(t, time.Date(2026, time.June, 30, 18, 30, 0, 0, time.UTC), next)
+
+	// December rolls over to the next year
+	next = schedule.Next(time.Date(2026, time.December, 31, 19, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2027, time.January, 29, 18, 30, 0, 0, time.UTC), next)
+}
+
+func TestParseWithSeconds(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC)
+
+	schedule, err := scheduler.ParseWithSeconds("CRON_TZ=UTC 30 0 9 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, time.January, 16, 9, 0, 30, 0, time.UTC), schedule.Next(now).UTC())
+
+	// Specs with five fields keep their meaning
+	schedule, err = scheduler.ParseWithSeconds("CRON_TZ=UTC 0 9 * * *")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, time.January, 16, 9, 0, 0, 0, time.UTC), schedule.Next(now).UTC())
+
+	_, err = scheduler.Parse("CRON_TZ=UTC 30 0 9 * * *")
+	assert.Error(t, err)
+}
@@ -0,0 +1,408 @@
+package machinery
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/result"
+	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/scheduler"
+	"github.com/RichardKnop/machinery/v2/tasks"
+	"github.com/RichardKnop/machinery/v2/utils"
+
+	lockiface "github.com/RichardKnop/machinery/v2/locks/iface"
+)
+
+var (
+	// ErrScheduleExists is returned when adding a schedule with the name of a
+	// stored schedule
+	ErrScheduleExists = errors.New("Schedule with the same name exists")
+	// ErrScheduleNotFound is returned when updating or removing a schedule
+	// which is not stored
+	ErrScheduleNotFound = errors.New("Schedule not found")
+)
+
+// runningPollPeriod is how often the states of the tasks of a running
+// schedule are read while waiting for them to finish
+const runningPollPeriod = time.Second
+
+// maxMissedRuns is the most runs missed by a schedule which are sent when it
+// catches up with all of them
+const maxMissedRuns = 1000
+
+// storedSchedule is a schedule loaded from the result backend and the entry
+// of the scheduler running it
+type storedSchedule struct {
+	entryID  cron.EntryID
+	schedule *tasks.Schedule
+}
+
+// SyncSchedules loads the schedules stored in the result backend into the
+// scheduler: new schedules are added, changed ones replaced and the ones
+// which have been deleted removed. Periodic tasks registered with
+// RegisterPeriodicTask and the like are left alone. It is called every
+// ScheduleSyncInterval seconds when it is set, so schedules saved by any
+// server are picked up.
+func (server *Server) SyncSchedules() error {
+	schedules, err := backends.Schedules(server.backend)
+	if err != nil {
+		return err
+	}
+
+	server.schedulesMu.Lock()
+	defer server.schedulesMu.Unlock()
+
+	stored := make(map[string]struct{}, len(schedules))
+	for _, schedule := range schedules {
+		stored[schedule.Name] = struct{}{}
+
+		registered, ok := server.storedSchedules[schedule.Name]
+		if ok && registered.schedule.UpdatedAt.Equal(schedule.UpdatedAt) {
+			continue
+		}
+		if ok {
+			server.scheduler.Remove(registered.entryID)
+			delete(server.storedSchedules, schedule.Name)
+		}
+
+		if err := schedule.Validate(); err != nil {
+			log.ERROR.Printf("Skipped invalid schedule %s: %s", schedule.Name, err)
+			continue
+		}
+		entryID, err := server.registerSchedule(schedule)
+		if err != nil {
+			log.ERROR.Printf("Skipped invalid schedule %s: %s", schedule.Name, err)
+			continue
+		}
+		server.storedSchedules[schedule.Name] = &storedSchedule{entryID: entryID, schedule: schedule}
+	}
+
+	for name, registered := range server.storedSchedules {
+		if _, ok := stored[name]; !ok {
+			server.scheduler.Remove(registered.entryID)
+			delete(server.storedSchedules, name)
+		}
+	}
+	return nil
+}
+
+// AddSchedule stores a new schedule in the result backend and syncs the
+// scheduler with the stored schedules, other servers pick it up with their
+// next sync
+func (server *Server) AddSchedule(schedule *tasks.Schedule) error {
+	stored, err := backends.Schedule(server.backend, schedule.Name)
+	if err != nil {
+		return err
+	}
+	if stored != nil {
+		return ErrScheduleExists
+	}
+
+	if err := backends.SaveSchedule(server.backend, schedule); err != nil {
+		return err
+	}
+	return server.SyncSchedules()
+}
+
+// UpdateSchedule replaces the stored schedule with its name and syncs the
+// scheduler with the stored schedules
+func (server *Server) UpdateSchedule(schedule *tasks.Schedule) error {
+	stored, err := backends.Schedule(server.backend, schedule.Name)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return ErrScheduleNotFound
+	}
+
+	if err := backends.SaveSchedule(server.backend, schedule); err != nil {
+		return err
+	}
+	return server.SyncSchedules()
+}
+
+// RemoveSchedule deletes the stored schedule with the name and syncs the
+// scheduler with the stored schedules
+func (server *Server) RemoveSchedule(name string) error {
+	stored, err := backends.Schedule(server.backend, name)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		return ErrScheduleNotFound
+	}
+
+	if err := backends.DeleteSchedule(server.backend, name); err != nil {
+		return err
+	}
+	return server.SyncSchedules()
+}
+
+// ListSchedules returns the stored schedules sorted by name, periodic tasks
+// registered with RegisterPeriodicTask and the like are not stored
+func (server *Server) ListSchedules() ([]*tasks.Schedule, error) {
+	return backends.Schedules(server.backend)
+}
+
+// RegisterSchedule registers a periodic task, chain, group or chord in the
+// scheduler of the server like RegisterPeriodicTask and the like, e.g. to set
+// the time zone of its spec. The schedule is not stored, see SyncSchedules,
+// but the last runs of schedules catching up with missed runs are.
+func (server *Server) RegisterSchedule(schedule *tasks.Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	if schedule.CatchesUp() && !backends.SchedulesSupported(server.backend) {
+		return backends.ErrSchedulesNotSupported
+	}
+	_, err := server.registerSchedule(tasks.CopySchedule(schedule))
+	return err
+}
+
+// syncSchedulesPeriodically syncs the stored schedules every interval with
+// the scheduler itself
+func (server *Server) syncSchedulesPeriodically(interval time.Duration) error {
+	_, err := server.scheduler.AddFunc(fmt.Sprintf("@every %s", interval), func() {
+		if err := server.SyncSchedules(); err != nil {
+			log.ERROR.Printf("Sync schedules error: %s", err)
+		}
+	})
+	return err
+}
+
+// registerSchedule adds the schedule to the scheduler, each run is sent by
+// the first server taking the lock of the run, if it is the scheduler leader,
+// after the jitter of the schedule. Runs of a schedule skipping runs while it
+// is running hold another lock until their tasks finished. Runs missed since the last run are caught
+// up with right away and by the next run.
+func (server *Server) registerSchedule(schedule *tasks.Schedule) (cron.EntryID, error) {
+	//check spec
+	spec := schedule.CronSpec()
+	runs := schedule.Runs
+	if runs == nil {
+		parse := scheduler.Parse
+		if server.config.CronWithSeconds {
+			parse = scheduler.ParseWithSeconds
+		}
+
+		var err error
+		if runs, err = parse(spec); err != nil {
+			return 0, err
+		}
+	}
+
+	run := func() {
+		if !server.IsSchedulerLeader() {
+			return
+		}
+		now := time.Now()
+
+		//get lock
+		err := server.lock.LockWithRetries(utils.GetLockName(schedule.Name, spec), runLockExpiry(runs, now))
+		if err != nil {
+			return
+		}
+
+		if schedule.CatchesUp() {
+			lastRun, err := backends.ScheduleLastRun(server.backend, schedule.Name)
+			if err != nil {
+				log.ERROR.Printf("Get last run of schedule %s error: %s", schedule.Name, err)
+			} else if missed := missedRuns(runs, lastRun, now); len(missed) > 1 {
+				// The last run is the one being sent
+				server.sendMissedRuns(schedule, missed[:len(missed)-1])
+			}
+			if err := backends.SetScheduleLastRun(server.backend, schedule.Name, now); err != nil {
+				log.ERROR.Printf("Set last run of schedule %s error: %s", schedule.Name, err)
+			}
+		}
+
+		if schedule.SkipIfRunning {
+			err := server.lock.Lock(runningLockName(schedule), now.Add(schedule.GetRunningTTL()).UnixNano())
+			if err != nil {
+				log.WARNING.Printf("Skipped run of schedule %s as its previous run is running", schedule.Name)
+				return
+			}
+		}
+
+		if schedule.Jitter > 0 {
+			time.Sleep(time.Duration(rand.Int63n(int64(schedule.Jitter) + 1)))
+		}
+
+		//send task
+		stages, err := server.sendSchedule(schedule)
+		if err != nil {
+			log.ERROR.Printf("periodic task failed. task name is: %s. error is %s", schedule.Name, err.Error())
+		}
+		if schedule.SkipIfRunning {
+			server.unlockWhenFinished(schedule, stages)
+		}
+	}
+	entryID := server.scheduler.Schedule(runs, cron.FuncJob(run))
+
+	if schedule.CatchesUp() && server.IsSchedulerLeader() {
+		server.catchUp(schedule, runs, spec)
+	}
+	return entryID, nil
+}
+
+// catchUp sends the runs of the schedule missed since its last run, once by
+// the first server taking the lock of the catch up
+func (server *Server) catchUp(schedule *tasks.Schedule, runs scheduler.Schedule, spec string) {
+	now := time.Now()
+	lastRun, err := backends.ScheduleLastRun(server.backend, schedule.Name)
+	if err != nil {
+		log.ERROR.Printf("Get last run of schedule %s error: %s", schedule.Name, err)
+		return
+	}
+
+	// Runs are missed from now on if no server sends them
+	if lastRun.IsZero() {
+		if err := backends.SetScheduleLastRun(server.backend, schedule.Name, now); err != nil {
+			log.ERROR.Printf("Set last run of schedule %s error: %s", schedule.Name, err)
+		}
+		return
+	}
+
+	missed := missedRuns(runs, lastRun, now)
+	if len(missed) == 0 {
+		return
+	}
+	key := fmt.Sprintf("%s_catch_up_%d", utils.GetLockName(schedule.Name, spec), lastRun.UnixNano())
+	if err := server.lock.Lock(key, runLockExpiry(runs, now)); err != nil {
+		return
+	}
+
+	server.sendMissedRuns(schedule, missed)
+	if err := backends.SetScheduleLastRun(server.backend, schedule.Name, now); err != nil {
+		log.ERROR.Printf("Set last run of schedule %s error: %s", schedule.Name, err)
+	}
+}
+
+// runLockExpiry returns when the lock of a run expires, right before the next
+// run or in an hour after the last run
+func runLockExpiry(runs scheduler.Schedule, now time.Time) int64 {
+	next := runs.Next(now)
+	if next.IsZero() {
+		return now.Add(time.Hour).UnixNano()
+	}
+	return next.UnixNano() - 1
+}
+
+// missedRuns returns the runs of the schedule after the last run until now,
+// at most maxMissedRuns of them
+func missedRuns(runs scheduler.Schedule, lastRun, now time.Time) []time.Time {
+	var missed []time.Time
+	if lastRun.IsZero() {
+		return missed
+	}
+	for next := runs.Next(lastRun); !next.IsZero() && !next.After(now) && len(missed) < maxMissedRuns; next = runs.Next(next) {
+		missed = append(missed, next)
+	}
+	return missed
+}
+
+// sendMissedRuns sends the missed runs according to the catch up policy of
+// the schedule
+func (server *Server) sendMissedRuns(schedule *tasks.Schedule, missed []time.Time) {
+	log.WARNING.Printf("Schedule %s missed %d runs since %s", schedule.Name, len(missed), missed[0].Format(time.RFC3339))
+	if schedule.CatchUp == tasks.CatchUpOnce {
+		missed = missed[:1]
+	}
+
+	for range missed {
+		if _, err := server.sendSchedule(schedule); err != nil {
+			log.ERROR.Printf("periodic task failed. task name is: %s. error is %s", schedule.Name, err.Error())
+		}
+	}
+}
+
+// sendSchedule sends copies of the task, chain, group or chord of the
+// schedule, it returns the stages of the run, the sent tasks which run one
+// after another or at the same time within a stage
+func (server *Server) sendSchedule(schedule *tasks.Schedule) ([][]*tasks.Signature, error) {
+	switch schedule.Kind {
+	case tasks.ScheduleChain:
+		chain, err := tasks.NewChain(tasks.CopySignatures(schedule.Signatures...)...)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := server.SendChain(chain); err != nil {
+			return nil, err
+		}
+		stages := make([][]*tasks.Signature, len(chain.Tasks))
+		for i, signature := range chain.Tasks {
+			stages[i] = []*tasks.Signature{signature}
+		}
+		return stages, nil
+	case tasks.ScheduleGroup:
+		group, err := tasks.NewGroup(tasks.CopySignatures(schedule.Signatures...)...)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := server.SendGroup(group, schedule.SendConcurrency); err != nil {
+			return nil, err
+		}
+		return [][]*tasks.Signature{group.Tasks}, nil
+	case tasks.ScheduleChord:
+		group, err := tasks.NewGroup(tasks.CopySignatures(schedule.Signatures...)...)
+		if err != nil {
+			return nil, err
+		}
+		chord, err := tasks.NewChord(group, tasks.CopySignature(schedule.Callback))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := server.SendChord(chord, schedule.SendConcurrency); err != nil {
+			return nil, err
+		}
+		return [][]*tasks.Signature{group.Tasks, {chord.Callback}}, nil
+	default:
+		signature := tasks.CopySignature(schedule.Signatures[0])
+		if _, err := server.SendTask(signature); err != nil {
+			return nil, err
+		}
+		return [][]*tasks.Signature{{signature}}, nil
+	}
+}
+
+// runningLockName returns the name of the lock held while a run of the
+// schedule is running
+func runningLockName(schedule *tasks.Schedule) string {
+	return fmt.Sprintf("machinery_schedule_running:%s", schedule.Name)
+}
+
+// unlockWhenFinished releases the lock of the running schedule once the tasks
+// of each stage of its run finished, or a task failed so the next stages are
+// never sent. Locks which cannot be released expire after the running TTL.
+func (server *Server) unlockWhenFinished(schedule *tasks.Schedule, stages [][]*tasks.Signature) {
+	unlocker, ok := server.lock.(lockiface.Unlocker)
+	if !ok {
+		return
+	}
+
+	deadline := time.Now().Add(schedule.GetRunningTTL())
+	for _, stage := range stages {
+		failed := false
+		for _, signature := range stage {
+			_, err := result.NewAsyncResult(signature, server.backend).GetWithTimeout(time.Until(deadline), runningPollPeriod)
+			if err == result.ErrTimeoutReached {
+				return
+			}
+			if err != nil {
+				failed = true
+			}
+		}
+		if failed {
+			break
+		}
+	}
+
+	if err := unlocker.Unlock(runningLockName(schedule)); err != nil {
+		log.ERROR.Printf("Failed to unlock running schedule %s: %s", schedule.Name, err)
+	}
+}
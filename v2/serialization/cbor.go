@@ -0,0 +1,49 @@
+package serialization
+
+import (
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// CBOR is a compact binary codec, []byte args are kept as byte strings
+// instead of base64 strings and integers keep their sign and width instead of
+// being decoded as float64
+var CBOR Codec = newCBORCodec()
+
+type cborCodec struct {
+	encMode cbor.EncMode
+	decMode cbor.DecMode
+}
+
+func newCBORCodec() cborCodec {
+	// Times keep their nanoseconds, e.g. of ETAs
+	encMode, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	// Maps nested in args and results are decoded like JSON objects
+	decMode, err := cbor.DecOptions{
+		DefaultMapType: reflect.TypeOf(map[string]interface{}(nil)),
+	}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return cborCodec{encMode: encMode, decMode: decMode}
+}
+
+func (cborCodec) Name() string {
+	return "cbor"
+}
+
+func (cborCodec) ContentType() string {
+	return "application/cbor"
+}
+
+func (c cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return c.encMode.Marshal(v)
+}
+
+func (c cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.decMode.Unmarshal(data, v)
+}
@@ -0,0 +1,101 @@
+package serialization
+
+import (
+	"bytes"
+	"reflect"
+
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// Msgpack is a compact binary codec, integers keep their width when encoded
+// and are decoded as int64 or uint64 so they convert back to argument types
+var Msgpack Codec = msgpackCodec{}
+
+func init() {
+	// Loose decoding decodes binary data as strings, values of args and
+	// results keep it as []byte so []byte args convert back
+	msgpack.Register(tasks.Arg{}, nil, decodeTypedValue)
+	msgpack.Register(tasks.TaskResult{}, nil, decodeTypedValue)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (msgpackCodec) ContentType() string {
+	return "application/msgpack"
+}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.UseLooseInterfaceDecoding(true)
+	return decoder.Decode(v)
+}
+
+// decodeTypedValue decodes an arg or a result encoded as a map of its fields
+func decodeTypedValue(d *msgpack.Decoder, v reflect.Value) error {
+	n, err := d.DecodeMapLen()
+	if err != nil || n == -1 {
+		return err
+	}
+
+	for i := 0; i < n; i++ {
+		name, err := d.DecodeString()
+		if err != nil {
+			return err
+		}
+
+		field := v.FieldByName(name)
+		switch {
+		case name == "Value":
+			var value interface{}
+			if value, err = decodeValue(d); err == nil && value != nil {
+				field.Set(reflect.ValueOf(value))
+			}
+		case field.IsValid() && field.CanSet():
+			err = d.DecodeValue(field)
+		default:
+			err = d.Skip()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeValue decodes a value loosely but for binary data, also in arrays,
+// which is decoded as []byte
+func decodeValue(d *msgpack.Decoder) (interface{}, error) {
+	code, err := d.PeekCode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case code == msgpcode.Bin8 || code == msgpcode.Bin16 || code == msgpcode.Bin32:
+		return d.DecodeBytes()
+	case msgpcode.IsFixedArray(code) || code == msgpcode.Array16 || code == msgpcode.Array32:
+		n, err := d.DecodeArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, n)
+		for i := range values {
+			if values[i], err = decodeValue(d); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	return d.DecodeInterfaceLoose()
+}
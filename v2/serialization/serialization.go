@@ -0,0 +1,79 @@
+package serialization
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+)
+
+// ContentTypeHeader is the header carrying the content type of a signature
+// on brokers whose messages have no content type property
+const ContentTypeHeader = "content-type"
+
+// Codec encodes signatures published by brokers and task states persisted by
+// backends. Signatures are decoded with the codec of their content type, so
+// workers and clients can switch codecs one by one, task states must be
+// encoded with the same codec by all of them.
+type Codec interface {
+	// Name is the name the codec is selected with in the configuration
+	Name() string
+	// ContentType is the MIME type of encoded messages
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{}
+	// contentTypes holds the latest codec registered with each content type
+	contentTypes = map[string]Codec{}
+)
+
+func init() {
+	Register(JSON)
+	Register(Msgpack)
+	Register(CBOR)
+}
+
+// Register makes a codec available by its name, a codec registered with the
+// name of another one replaces it
+func Register(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.Name()] = codec
+	contentTypes[codec.ContentType()] = codec
+}
+
+// Get returns the codec registered with the name, JSON when the name is empty
+func Get(name string) (Codec, error) {
+	if name == "" {
+		return JSON, nil
+	}
+
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown serialization codec: %s", name)
+	}
+	return codec, nil
+}
+
+// ForContentType returns the latest codec registered with the content type,
+// false if there is none
+func ForContentType(contentType string) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := contentTypes[contentType]
+	return codec, ok
+}
+
+// Detect returns the codec the data was encoded with when the message has no
+// content type, JSON when it is a JSON object and the fallback otherwise
+func Detect(data []byte, fallback Codec) Codec {
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		return JSON
+	}
+	return fallback
+}
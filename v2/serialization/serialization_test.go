@@ -0,0 +1,124 @@
+package serialization_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/serialization"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestGet(t *testing.T) {
+	t.Parallel()
+
+	codec, err := serialization.Get("")
+	require.NoError(t, err)
+	assert.Equal(t, serialization.JSON, codec)
+
+	codec, err = serialization.Get("msgpack")
+	require.NoError(t, err)
+	assert.Equal(t, serialization.Msgpack, codec)
+
+	codec, err = serialization.Get("cbor")
+	require.NoError(t, err)
+	assert.Equal(t, serialization.CBOR, codec)
+
+	_, err = serialization.Get("xml")
+	assert.Error(t, err)
+}
+
+func TestCodecs(t *testing.T) {
+	t.Parallel()
+
+	eta := time.Now().UTC().Truncate(time.Millisecond)
+	signature := &tasks.Signature{
+		UUID: "taskUUID",
+		Name: "add",
+		ETA:  &eta,
+		Args: []tasks.Arg{
+			{Type: "int64", Value: int64(1)},
+			{Type: "uint8", Value: uint8(2)},
+			{Type: "float64", Value: 3.5},
+			{Type: "[]string", Value: []string{"a", "b"}},
+			{Type: "[]byte", Value: []byte{0, 1, 255}},
+			{Type: "int64", Value: int64(math.MaxInt64)},
+			{Type: "int64", Value: int64(-1)},
+		},
+		Headers: tasks.Headers{"trace": "id"},
+	}
+
+	for _, codec := range []serialization.Codec{serialization.JSON, serialization.Msgpack, serialization.CBOR} {
+		encoded, err := codec.Marshal(signature)
+		require.NoError(t, err, codec.Name())
+
+		decoded := new(tasks.Signature)
+		require.NoError(t, codec.Unmarshal(encoded, decoded), codec.Name())
+		assert.Equal(t, signature.UUID, decoded.UUID, codec.Name())
+		assert.True(t, signature.ETA.Equal(*decoded.ETA), codec.Name())
+		assert.Equal(t, "id", decoded.Headers["trace"], codec.Name())
+
+		// Decoded arguments convert back to the types of the task function
+		for i, arg := range signature.Args {
+			value, err := tasks.ReflectValue(arg.Type, decoded.Args[i].Value)
+			if assert.NoError(t, err, codec.Name()) {
+				assert.Equal(t, arg.Value, value.Interface(), codec.Name())
+			}
+		}
+	}
+
+	// The JSON codec keeps integers as numbers
+	decoded := new(tasks.Signature)
+	require.NoError(t, serialization.JSON.Unmarshal([]byte(`{"Args":[{"Type":"int64","Value":1}]}`), decoded))
+	assert.Equal(t, json.Number("1"), decoded.Args[0].Value)
+}
+
+type upperCodec struct {
+	serialization.Codec
+}
+
+func (upperCodec) Name() string {
+	return "upper"
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	serialization.Register(upperCodec{serialization.JSON})
+
+	codec, err := serialization.Get("upper")
+	require.NoError(t, err)
+	assert.Equal(t, "upper", codec.Name())
+	assert.Equal(t, "application/json", codec.ContentType())
+}
+
+func TestForContentType(t *testing.T) {
+	t.Parallel()
+
+	codec, ok := serialization.ForContentType("application/msgpack")
+	if assert.True(t, ok) {
+		assert.Equal(t, serialization.Msgpack, codec)
+	}
+
+	_, ok = serialization.ForContentType("application/xml")
+	assert.False(t, ok)
+}
+
+func TestDetect(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{UUID: "taskUUID", Name: "add"}
+	for _, codec := range []serialization.Codec{serialization.JSON, serialization.Msgpack} {
+		encoded, err := codec.Marshal(signature)
+		require.NoError(t, err, codec.Name())
+
+		// JSON is detected whatever the fallback is
+		assert.Equal(t, codec, serialization.Detect(encoded, serialization.Msgpack), codec.Name())
+	}
+
+	assert.Equal(t, serialization.JSON, serialization.Detect([]byte("  \n{}"), serialization.Msgpack))
+}
@@ -10,12 +10,15 @@ import (
 	"github.com/google/uuid"
 	"github.com/robfig/cron/v3"
 
+	"github.com/RichardKnop/machinery/v2/backends"
 	"github.com/RichardKnop/machinery/v2/backends/result"
+	"github.com/RichardKnop/machinery/v2/brokers"
+	"github.com/RichardKnop/machinery/v2/brokers/errs"
 	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
+	"github.com/RichardKnop/machinery/v2/retry"
 	"github.com/RichardKnop/machinery/v2/tasks"
 	"github.com/RichardKnop/machinery/v2/tracing"
-	"github.com/RichardKnop/machinery/v2/utils"
 
 	backendsiface "github.com/RichardKnop/machinery/v2/backends/iface"
 	brokersiface "github.com/RichardKnop/machinery/v2/brokers/iface"
@@ -23,27 +26,65 @@ import (
 	"go.opentelemetry.io/otel"
 )
 
+// ErrTaskNotUnique is returned when a unique task is sent while a task with
+// the same name and args is queued or running
+var ErrTaskNotUnique = errors.New("Task with the same name and args is queued or running")
+
 // Server is the main Machinery object and stores all configuration
 // All the tasks workers process are registered against the server
 type Server struct {
 	config            *config.Config
 	registeredTasks   *sync.Map
+	taskOptions       *sync.Map
 	broker            brokersiface.Broker
 	backend           backendsiface.Backend
 	lock              lockiface.Lock
 	scheduler         *cron.Cron
+	storedSchedules   map[string]*storedSchedule
+	schedulesMu       sync.Mutex
+	schedulerID       string
+	schedulerLeader   int32
 	prePublishHandler func(*tasks.Signature)
+	brokerMiddlewares []brokers.Middleware
+	events            eventBus
+}
+
+// ServerOption configures optional features of the server
+type ServerOption func(*Server)
+
+// WithBrokerMiddleware makes published and consumed tasks go through the
+// middlewares, the first middleware is the outermost one
+func WithBrokerMiddleware(middlewares ...brokers.Middleware) ServerOption {
+	return func(server *Server) {
+		server.brokerMiddlewares = append(server.brokerMiddlewares, middlewares...)
+	}
 }
 
 // NewServer creates Server instance
-func NewServer(cnf *config.Config, brokerServer brokersiface.Broker, backendServer backendsiface.Backend, lock lockiface.Lock) *Server {
+func NewServer(cnf *config.Config, brokerServer brokersiface.Broker, backendServer backendsiface.Backend, lock lockiface.Lock, opts ...ServerOption) *Server {
 	srv := &Server{
 		config:          cnf,
 		registeredTasks: new(sync.Map),
-		broker:          brokerServer,
+		taskOptions:     new(sync.Map),
 		backend:         backendServer,
 		lock:            lock,
 		scheduler:       cron.New(),
+		storedSchedules: make(map[string]*storedSchedule),
+		schedulerLeader: 1,
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	srv.SetBroker(brokerServer)
+
+	if cnf.ScheduleSyncInterval > 0 {
+		if err := srv.syncSchedulesPeriodically(time.Duration(cnf.ScheduleSyncInterval) * time.Second); err != nil {
+			log.ERROR.Printf("Failed to schedule syncs of schedules: %s", err)
+		}
+	}
+
+	if cnf.SchedulerLeaseTTL > 0 {
+		srv.startLeaderElection(time.Duration(cnf.SchedulerLeaseTTL) * time.Second)
 	}
 
 	// Run scheduler job
@@ -77,9 +118,9 @@ func (server *Server) GetBroker() brokersiface.Broker {
 	return server.broker
 }
 
-// SetBroker sets broker
+// SetBroker sets broker, wrapping it with the broker middlewares
 func (server *Server) SetBroker(broker brokersiface.Broker) {
-	server.broker = broker
+	server.broker = brokers.WithMiddleware(broker, server.brokerMiddlewares...)
 }
 
 // GetBackend returns backend
@@ -107,6 +148,18 @@ func (server *Server) SetPreTaskHandler(handler func(*tasks.Signature)) {
 	server.prePublishHandler = handler
 }
 
+// HealthCheck checks the broker and the result backend can be reached, e.g.
+// for a readiness probe, without sending a task
+func (server *Server) HealthCheck(ctx context.Context) error {
+	if err := server.broker.HealthCheck(ctx); err != nil {
+		return fmt.Errorf("Broker health check failed: %s", err)
+	}
+	if err := server.backend.HealthCheck(ctx); err != nil {
+		return fmt.Errorf("Backend health check failed: %s", err)
+	}
+	return nil
+}
+
 // RegisterTasks registers all tasks at once
 func (server *Server) RegisterTasks(namedTaskFuncs map[string]interface{}) error {
 	for _, task := range namedTaskFuncs {
@@ -121,12 +174,83 @@ func (server *Server) RegisterTasks(namedTaskFuncs map[string]interface{}) error
 	return nil
 }
 
+// TaskOption configures a task when it is registered
+type TaskOption func(*taskOptions)
+
+// taskOptions are the options a task has been registered with
+type taskOptions struct {
+	validateArgs   tasks.ArgsValidator
+	retryPolicy    tasks.RetryPolicy
+	circuitBreaker *circuitBreakerSettings
+	rateLimit      *rateLimitSettings
+}
+
+// WithArgsValidator makes the server validate the args of the task before
+// sending it, a task with invalid args is not sent and tasks.ErrInvalidArgs
+// is returned. Use tasks.MatchArgs to check the args against the task
+// function.
+func WithArgsValidator(validate tasks.ArgsValidator) TaskOption {
+	return func(opts *taskOptions) {
+		opts.validateArgs = validate
+	}
+}
+
+// WithRetryStrategy spaces out retries of the task with the strategy, unless
+// its signature names another one
+func WithRetryStrategy(strategy retry.Strategy) TaskOption {
+	return func(opts *taskOptions) {
+		opts.retryPolicy.Backoff = strategy
+	}
+}
+
+// WithRetryIf makes workers retry the task only on errors the predicate
+// returns true for, e.g. transient network errors, other errors fail it at
+// once
+func WithRetryIf(retryIf func(err error) bool) TaskOption {
+	return func(opts *taskOptions) {
+		opts.retryPolicy.RetryIf = retryIf
+	}
+}
+
+// WithRetryPolicy makes workers retry the task with the policy, the retry
+// count and the retry strategy set on its signature take precedence
+func WithRetryPolicy(policy tasks.RetryPolicy) TaskOption {
+	return func(opts *taskOptions) {
+		opts.retryPolicy = policy
+	}
+}
+
 // RegisterTask registers a single task
-func (server *Server) RegisterTask(name string, taskFunc interface{}) error {
+func (server *Server) RegisterTask(name string, taskFunc interface{}, opts ...TaskOption) error {
 	if err := tasks.ValidateTask(taskFunc); err != nil {
 		return err
 	}
+	options := new(taskOptions)
+	for _, opt := range opts {
+		opt(options)
+	}
 	server.registeredTasks.Store(name, taskFunc)
+	server.taskOptions.Store(name, options)
+	server.broker.SetRegisteredTaskNames(server.GetRegisteredTaskNames())
+	return nil
+}
+
+// RegisterBatchTask registers a handler processing up to size tasks of the
+// name at once. A worker processes a batch once it is full or wait passed since
+// its first task was received, it holds at most as many tasks as the worker
+// processes concurrently.
+func (server *Server) RegisterBatchTask(name string, handler tasks.BatchHandler, size int, wait time.Duration) error {
+	if handler == nil {
+		return errors.New("Batch handler is nil")
+	}
+	if size < 1 {
+		return fmt.Errorf("Batch size of task %s must be positive", name)
+	}
+	if wait <= 0 {
+		return fmt.Errorf("Batch wait of task %s must be positive", name)
+	}
+
+	server.registeredTasks.Store(name, &batchTask{handler: handler, size: size, wait: wait})
 	server.broker.SetRegisteredTaskNames(server.GetRegisteredTaskNames())
 	return nil
 }
@@ -148,6 +272,15 @@ func (server *Server) GetRegisteredTask(name string) (interface{}, error) {
 
 // SendTaskWithContext will inject the trace context in the signature headers before publishing it
 func (server *Server) SendTaskWithContext(ctx context.Context, signature *tasks.Signature) (*result.AsyncResult, error) {
+	return server.sendTask(ctx, signature, false)
+}
+
+// resendTask sends a task again, e.g. to retry it, a unique task keeps its lock
+func (server *Server) resendTask(signature *tasks.Signature) (*result.AsyncResult, error) {
+	return server.sendTask(context.Background(), signature, true)
+}
+
+func (server *Server) sendTask(ctx context.Context, signature *tasks.Signature, resend bool) (*result.AsyncResult, error) {
 	ctx, span := otel.Tracer("").Start(ctx, "SendTask")
 	defer span.End()
 	// span, _ := opentracing.StartSpanFromContext(ctx, "SendTask", tracing.ProducerOption(), tracing.MachineryTag)
@@ -161,14 +294,64 @@ func (server *Server) SendTaskWithContext(ctx context.Context, signature *tasks.
 		return nil, errors.New("Result backend required")
 	}
 
+	// Reject invalid args before anything is recorded for the task
+	if !resend {
+		if err := server.validateArgs(signature); err != nil {
+			return nil, err
+		}
+	}
+
 	// Auto generate a UUID if not set already
 	if signature.UUID == "" {
 		taskID := uuid.New().String()
 		signature.UUID = fmt.Sprintf("task_%v", taskID)
 	}
 
+	// Skip sending a task with the idempotency key of a sent task, a task is
+	// sent again with its own key to be retried. What has been claimed for
+	// the task is released when it could not be sent, so it can be sent again.
+	cleanup := func() {}
+	if signature.IdempotencyKey != "" {
+		taskUUID, claimed, err := backends.ClaimIdempotencyKey(server.backend, signature.IdempotencyKey, signature.UUID, server.idempotencyWindow())
+		if err != nil {
+			return nil, fmt.Errorf("Claim idempotency key error: %s", err)
+		}
+		if !claimed {
+			log.INFO.Printf("Task with idempotency key %s has been sent already as %s", signature.IdempotencyKey, taskUUID)
+			signature.UUID = taskUUID
+			return result.NewAsyncResult(signature, server.backend), nil
+		}
+		if !resend {
+			cleanup = func() { server.releaseIdempotencyKey(signature) }
+		}
+	}
+
+	// Only one unique task with the same name and args is queued or running,
+	// workers release the lock once it finished
+	if signature.UniqueTTL > 0 && !resend {
+		if err := server.lockUnique(signature); err != nil {
+			cleanup()
+			return nil, err
+		}
+		releaseIdempotencyKey := cleanup
+		cleanup = func() {
+			server.unlockUnique(signature)
+			releaseIdempotencyKey()
+		}
+	}
+
+	// Record the task as a child before it can finish, so the children of
+	// the parent are complete once the parent finished
+	if signature.ParentUUID != "" {
+		if err := backends.AddChild(server.backend, signature.ParentUUID, signature.UUID); err != nil {
+			cleanup()
+			return nil, fmt.Errorf("Add child task error: %s", err)
+		}
+	}
+
 	// Set initial task state to PENDING
 	if err := server.backend.SetStatePending(signature); err != nil {
+		cleanup()
 		return nil, fmt.Errorf("Set state pending error: %s", err)
 	}
 
@@ -177,17 +360,135 @@ func (server *Server) SendTaskWithContext(ctx context.Context, signature *tasks.
 	}
 
 	if err := server.broker.Publish(ctx, signature); err != nil {
+		cleanup()
 		return nil, fmt.Errorf("Publish message error: %s", err)
 	}
+	server.emitEvent(EventTaskPublished, signature, nil, "")
 
 	return result.NewAsyncResult(signature, server.backend), nil
 }
 
+// getTaskOptions returns the options the task has been registered with, no
+// options if it has not been registered with RegisterTask
+func (server *Server) getTaskOptions(name string) *taskOptions {
+	if value, ok := server.taskOptions.Load(name); ok {
+		return value.(*taskOptions)
+	}
+	return new(taskOptions)
+}
+
+// validateArgs validates the args of the task with the validator it has been
+// registered with, if any
+func (server *Server) validateArgs(signature *tasks.Signature) error {
+	validate := server.getTaskOptions(signature.Name).validateArgs
+	if validate == nil {
+		return nil
+	}
+
+	if err := validate(signature.Args); err != nil {
+		return tasks.ErrInvalidArgs{TaskName: signature.Name, Err: err}
+	}
+	return nil
+}
+
+// lockUnique acquires the lock of the unique task for its TTL
+func (server *Server) lockUnique(signature *tasks.Signature) error {
+	if server.lock == nil {
+		return errors.New("Lock required for unique tasks")
+	}
+
+	key, err := signature.UniqueKey()
+	if err != nil {
+		return err
+	}
+
+	if err := server.lock.Lock(key, time.Now().Add(signature.UniqueTTL).UnixNano()); err != nil {
+		log.DEBUG.Printf("Lock unique task %s error: %s", key, err)
+		return ErrTaskNotUnique
+	}
+	return nil
+}
+
+// unlockUnique releases the lock of the unique task, locks which cannot be
+// released expire after the TTL of the task
+func (server *Server) unlockUnique(signature *tasks.Signature) {
+	unlocker, ok := server.lock.(lockiface.Unlocker)
+	if !ok {
+		return
+	}
+
+	key, err := signature.UniqueKey()
+	if err == nil {
+		err = unlocker.Unlock(key)
+	}
+	if err != nil {
+		log.ERROR.Printf("Failed to unlock unique task %s: %s", signature.UUID, err)
+	}
+}
+
+// releaseIdempotencyKey releases the idempotency key of a task which could
+// not be sent, keys which cannot be released expire after the window
+func (server *Server) releaseIdempotencyKey(signature *tasks.Signature) {
+	if err := backends.ReleaseIdempotencyKey(server.backend, signature.IdempotencyKey, signature.UUID); err != nil {
+		log.ERROR.Printf("Failed to release idempotency key of task %s: %s", signature.UUID, err)
+	}
+}
+
+// idempotencyWindow returns how long idempotency keys of sent tasks are kept
+func (server *Server) idempotencyWindow() time.Duration {
+	window := server.config.IdempotencyWindow
+	if window == 0 {
+		window = server.config.ResultsExpireIn
+	}
+	if window == 0 {
+		window = config.DefaultResultsExpireIn
+	}
+	return time.Duration(window) * time.Second
+}
+
 // SendTask publishes a task to the default queue
 func (server *Server) SendTask(signature *tasks.Signature) (*result.AsyncResult, error) {
 	return server.SendTaskWithContext(context.Background(), signature)
 }
 
+// SendBroadcastWithContext publishes a task every worker consuming from the
+// broker executes once, e.g. to reload configuration. Workers which did not
+// register the task drop it. The state of the task is the state recorded by
+// the latest worker, so there is no result to wait for.
+func (server *Server) SendBroadcastWithContext(ctx context.Context, signature *tasks.Signature) error {
+	ctx, span := otel.Tracer("").Start(ctx, "SendBroadcast")
+	defer span.End()
+
+	signature.Headers = tracing.HeadersWithContext(signature.Headers, ctx)
+
+	broadcaster, ok := server.broker.(brokersiface.Broadcaster)
+	if !ok {
+		return errs.ErrBroadcastNotSupported
+	}
+
+	// Auto generate a UUID if not set already
+	if signature.UUID == "" {
+		taskID := uuid.New().String()
+		signature.UUID = fmt.Sprintf("task_%v", taskID)
+	}
+	signature.Broadcast = true
+
+	if server.prePublishHandler != nil {
+		server.prePublishHandler(signature)
+	}
+
+	if err := broadcaster.PublishBroadcast(ctx, signature); err != nil {
+		return fmt.Errorf("Publish broadcast message error: %s", err)
+	}
+	server.emitEvent(EventTaskPublished, signature, nil, "")
+	return nil
+}
+
+// SendBroadcast publishes a task every worker executes once
+func (server *Server) SendBroadcast(signature *tasks.Signature) error {
+	return server.SendBroadcastWithContext(context.Background(), signature)
+}
+
 // SendChainWithContext will inject the trace context in all the signature headers before publishing it
 func (server *Server) SendChainWithContext(ctx context.Context, chain *tasks.Chain) (*result.ChainAsyncResult, error) {
 	ctx, span := otel.Tracer("").Start(ctx, "SendChain")
@@ -224,6 +525,13 @@ func (server *Server) SendGroupWithContext(ctx context.Context, group *tasks.Gro
 		return nil, errors.New("Result backend required")
 	}
 
+	// Reject the group if any of its tasks has invalid args
+	for _, signature := range group.Tasks {
+		if err := server.validateArgs(signature); err != nil {
+			return nil, err
+		}
+	}
+
 	asyncResults := make([]*result.AsyncResult, len(group.Tasks))
 
 	var wg sync.WaitGroup
@@ -241,6 +549,25 @@ func (server *Server) SendGroupWithContext(ctx context.Context, group *tasks.Gro
 		}
 	}
 
+	// Publish the whole group at once if the broker supports it
+	if batchPublisher, ok := server.broker.(brokersiface.BatchPublisher); ok {
+		select {
+		case err := <-errorsChan:
+			return asyncResults, err
+		default:
+		}
+
+		if err := batchPublisher.PublishBatch(ctx, group.Tasks); err != nil {
+			return asyncResults, fmt.Errorf("Publish message error: %s", err)
+		}
+
+		for i, signature := range group.Tasks {
+			server.emitEvent(EventTaskPublished, signature, nil, "")
+			asyncResults[i] = result.NewAsyncResult(signature, server.backend)
+		}
+		return asyncResults, nil
+	}
+
 	pool := make(chan struct{}, sendConcurrency)
 	go func() {
 		for i := 0; i < sendConcurrency; i++ {
@@ -269,6 +596,7 @@ func (server *Server) SendGroupWithContext(ctx context.Context, group *tasks.Gro
 				errorsChan <- fmt.Errorf("Publish message error: %s", err)
 				return
 			}
+			server.emitEvent(EventTaskPublished, s, nil, "")
 
 			asyncResults[index] = result.NewAsyncResult(s, server.backend)
 		}(signature, i)
@@ -319,127 +647,251 @@ func (server *Server) SendChord(chord *tasks.Chord, sendConcurrency int) (*resul
 	return server.SendChordWithContext(context.Background(), chord, sendConcurrency)
 }
 
-// GetRegisteredTaskNames returns slice of registered task names
-func (server *Server) GetRegisteredTaskNames() []string {
-	taskNames := make([]string, 0)
+// SendDAGWithContext sends the tasks of the DAG without dependencies, workers
+// send the other tasks once their dependencies succeeded
+func (server *Server) SendDAGWithContext(ctx context.Context, dag *tasks.DAG) (*result.DAGAsyncResult, error) {
+	ctx, span := otel.Tracer("").Start(ctx, "SendDAG")
+	defer span.End()
 
-	server.registeredTasks.Range(func(key, value interface{}) bool {
-		taskNames = append(taskNames, key.(string))
-		return true
-	})
-	return taskNames
-}
+	// Make sure result backend is defined
+	if server.backend == nil {
+		return nil, errors.New("Result backend required")
+	}
+	// States are consumed when they are read from AMQP, workers could not
+	// check the dependencies of a task
+	if server.backend.IsAMQP() {
+		return nil, errors.New("DAGs are not supported by the AMQP result backend")
+	}
 
-// RegisterPeriodicTask register a periodic task which will be triggered periodically
-func (server *Server) RegisterPeriodicTask(spec, name string, signature *tasks.Signature) error {
-	//check spec
-	schedule, err := cron.ParseStandard(spec)
-	if err != nil {
-		return err
+	// The DAG group records the tasks of the DAG in the backend
+	if err := server.backend.InitGroup(dag.DAGUUID, dag.GetUUIDs()); err != nil {
+		return nil, fmt.Errorf("Init DAG %s error: %s", dag.DAGUUID, err)
 	}
 
-	f := func() {
-		//get lock
-		err := server.lock.LockWithRetries(utils.GetLockName(name, spec), schedule.Next(time.Now()).UnixNano()-1)
-		if err != nil {
-			return
+	for _, node := range dag.Nodes {
+		// The backend flags the group of the dependencies of a task when the
+		// first worker finding all of them succeeded sends it, like a chord
+		if dependencies := dag.Dependencies(node); len(dependencies) > 0 {
+			taskUUIDs := make([]string, len(dependencies))
+			for i, dependency := range dependencies {
+				taskUUIDs[i] = dependency.Signature.UUID
+			}
+			if err := server.backend.InitGroup(dag.JoinUUID(node.Name), taskUUIDs); err != nil {
+				return nil, fmt.Errorf("Init DAG %s error: %s", dag.DAGUUID, err)
+			}
 		}
 
-		//send task
-		_, err = server.SendTask(tasks.CopySignature(signature))
-		if err != nil {
-			log.ERROR.Printf("periodic task failed. task name is: %s. error is %s", name, err.Error())
+		if err := server.backend.SetStatePending(node.Signature); err != nil {
+			return nil, err
 		}
 	}
 
-	_, err = server.scheduler.AddFunc(spec, f)
-	return err
+	for _, node := range dag.Roots() {
+		signature := tasks.CopySignature(node.Signature)
+		signature.DAG = &tasks.DAGMeta{DAG: *dag, Node: node.Name}
+		if _, err := server.SendTaskWithContext(ctx, signature); err != nil {
+			return nil, err
+		}
+	}
+
+	return result.NewDAGAsyncResult(dag, server.backend), nil
 }
 
-// RegisterPeriodicChain register a periodic chain which will be triggered periodically
-func (server *Server) RegisterPeriodicChain(spec, name string, signatures ...*tasks.Signature) error {
-	//check spec
-	schedule, err := cron.ParseStandard(spec)
+// SendDAG triggers a DAG of tasks
+func (server *Server) SendDAG(dag *tasks.DAG) (*result.DAGAsyncResult, error) {
+	return server.SendDAGWithContext(context.Background(), dag)
+}
+
+// CancelTask marks the task canceled in the result backend. Workers drop the
+// task when they receive it and cancel the context of the task when it is
+// running, tasks taking a context.Context can stop then. A task which already
+// finished cannot be canceled.
+func (server *Server) CancelTask(taskUUID string) error {
+	// Make sure result backend is defined
+	if server.backend == nil {
+		return errors.New("Result backend required")
+	}
+	// States are consumed when they are read from AMQP, workers could not
+	// check whether a task has been canceled
+	if server.backend.IsAMQP() {
+		return errors.New("Canceling tasks is not supported by the AMQP result backend")
+	}
+	// Workers neither drop nor stop canceled tasks then
+	if server.config.CancelCheckInterval < 0 {
+		return errors.New("Canceling tasks is disabled by a negative CancelCheckInterval")
+	}
+
+	state, err := server.backend.GetState(taskUUID)
 	if err != nil {
-		return err
+		return fmt.Errorf("Get state of task %s error: %s", taskUUID, err)
+	}
+	if state.IsCompleted() {
+		return fmt.Errorf("Task %s has already finished", taskUUID)
 	}
 
-	f := func() {
-		// new chain
-		chain, _ := tasks.NewChain(tasks.CopySignatures(signatures...)...)
+	// Workers record the state again with the group of the task once they
+	// dropped or stopped it
+	if err := server.backend.SetStateCanceled(&tasks.Signature{UUID: taskUUID}); err != nil {
+		return fmt.Errorf("Set state canceled for task %s error: %s", taskUUID, err)
+	}
+	return nil
+}
 
-		//get lock
-		err := server.lock.LockWithRetries(utils.GetLockName(name, spec), schedule.Next(time.Now()).UnixNano()-1)
-		if err != nil {
-			return
-		}
+// RequeueDeadLetters takes the tasks the filter returns true for off the dead
+// letter queue and sends them to their original queue again, e.g. once the
+// bug they failed on has been fixed. All tasks are requeued when the filter is
+// nil. It returns how many tasks have been requeued, a task which cannot be
+// sent is put back on the dead letter queue.
+func (server *Server) RequeueDeadLetters(queue string, filter func(*tasks.Signature) bool) (int, error) {
+	taker, ok := server.broker.(brokersiface.PendingTaskTaker)
+	if !ok {
+		return 0, errs.ErrTakePendingTasksNotSupported
+	}
 
-		//send task
-		_, err = server.SendChain(chain)
-		if err != nil {
-			log.ERROR.Printf("periodic task failed. task name is: %s. error is %s", name, err.Error())
-		}
+	deadLetters, err := taker.TakePendingTasks(queue, filter)
+	if err != nil {
+		err = fmt.Errorf("Take tasks off dead letter queue %s error: %s", queue, err)
 	}
 
-	_, err = server.scheduler.AddFunc(spec, f)
-	return err
+	requeued := 0
+	for _, deadLetter := range deadLetters {
+		if _, sendErr := server.sendTask(context.Background(), tasks.NewRequeuedSignature(deadLetter), false); sendErr != nil {
+			log.ERROR.Printf("Failed to requeue task %s: %s", deadLetter.UUID, sendErr)
+			if err == nil {
+				err = fmt.Errorf("Requeue task %s error: %s", deadLetter.UUID, sendErr)
+			}
+			if pubErr := server.broker.Publish(context.Background(), deadLetter); pubErr != nil {
+				log.ERROR.Printf("Failed to put task %s back on dead letter queue %s: %s", deadLetter.UUID, queue, pubErr)
+			}
+			continue
+		}
+		requeued++
+	}
+	return requeued, err
 }
 
-// RegisterPeriodicGroup register a periodic group which will be triggered periodically
-func (server *Server) RegisterPeriodicGroup(spec, name string, sendConcurrency int, signatures ...*tasks.Signature) error {
-	//check spec
-	schedule, err := cron.ParseStandard(spec)
+// ReplayTask sends the failed task again with a new UUID and ReplayOf set to
+// its UUID, e.g. once the outage it failed on is over. It is retried again as
+// many times as before, outside of its group and chord. The failed task is
+// replayed once, it is not recorded as failed anymore.
+func (server *Server) ReplayTask(taskUUID string) (*result.AsyncResult, error) {
+	failed, err := backends.FailedTask(server.backend, taskUUID)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("Get failed task %s error: %s", taskUUID, err)
+	}
+	if failed == nil {
+		return nil, fmt.Errorf("Failed task %s not found", taskUUID)
 	}
+	return server.replay(failed)
+}
 
-	f := func() {
-		// new group
-		group, _ := tasks.NewGroup(tasks.CopySignatures(signatures...)...)
+// RequeueFailed replays the tasks with the name which failed since the time,
+// the tasks of any name if it is empty, see ReplayTask. It returns how many
+// tasks have been replayed.
+func (server *Server) RequeueFailed(taskName string, since time.Time) (int, error) {
+	failedTasks, err := backends.FailedTasks(server.backend, taskName, since)
+	if err != nil {
+		return 0, fmt.Errorf("Get failed tasks error: %s", err)
+	}
 
-		//get lock
-		err := server.lock.LockWithRetries(utils.GetLockName(name, spec), schedule.Next(time.Now()).UnixNano()-1)
-		if err != nil {
-			return
+	replayed := 0
+	for _, failed := range failedTasks {
+		if _, err := server.replay(failed); err != nil {
+			return replayed, err
 		}
+		replayed++
+	}
+	return replayed, nil
+}
 
-		//send task
-		_, err = server.SendGroup(group, sendConcurrency)
-		if err != nil {
-			log.ERROR.Printf("periodic task failed. task name is: %s. error is %s", name, err.Error())
-		}
+// replay sends a copy of the failed task and removes its record
+func (server *Server) replay(failed *tasks.FailedTask) (*result.AsyncResult, error) {
+	asyncResult, err := server.SendTask(tasks.NewReplaySignature(failed.Signature))
+	if err != nil {
+		return nil, fmt.Errorf("Replay task %s error: %s", failed.Signature.UUID, err)
 	}
+	if err := backends.RemoveFailedTask(server.backend, failed.Signature.UUID); err != nil {
+		log.ERROR.Printf("Failed to remove replayed task %s: %s", failed.Signature.UUID, err)
+	}
+	return asyncResult, nil
+}
 
-	_, err = server.scheduler.AddFunc(spec, f)
-	return err
+// PurgeQueue drops the pending tasks of the queue, e.g. a backlog of tasks a
+// bad deploy sent, and returns how many were dropped
+func (server *Server) PurgeQueue(queue string) (int, error) {
+	manager, ok := server.broker.(brokersiface.QueueManager)
+	if !ok {
+		return 0, errs.ErrQueueManagementNotSupported
+	}
+	return manager.PurgeQueue(queue)
 }
 
-// RegisterPeriodicChord register a periodic chord which will be triggered periodically
-func (server *Server) RegisterPeriodicChord(spec, name string, sendConcurrency int, callback *tasks.Signature, signatures ...*tasks.Signature) error {
-	//check spec
-	schedule, err := cron.ParseStandard(spec)
-	if err != nil {
-		return err
+// MoveMessages moves up to limit pending tasks, all of them when limit is not
+// positive, from a queue to another, e.g. to drain a dead letter queue back
+// into service. It returns how many were moved. Unlike RequeueDeadLetters the
+// tasks are moved as they are, with the failures they had.
+func (server *Server) MoveMessages(from, to string, limit int) (int, error) {
+	manager, ok := server.broker.(brokersiface.QueueManager)
+	if !ok {
+		return 0, errs.ErrQueueManagementNotSupported
 	}
+	return manager.MoveMessages(from, to, limit)
+}
 
-	f := func() {
-		// new chord
-		group, _ := tasks.NewGroup(tasks.CopySignatures(signatures...)...)
-		chord, _ := tasks.NewChord(group, tasks.CopySignature(callback))
+// GetRegisteredTaskNames returns slice of registered task names
+func (server *Server) GetRegisteredTaskNames() []string {
+	taskNames := make([]string, 0)
 
-		//get lock
-		err := server.lock.LockWithRetries(utils.GetLockName(name, spec), schedule.Next(time.Now()).UnixNano()-1)
-		if err != nil {
-			return
-		}
+	server.registeredTasks.Range(func(key, value interface{}) bool {
+		taskNames = append(taskNames, key.(string))
+		return true
+	})
+	return taskNames
+}
 
-		//send task
-		_, err = server.SendChord(chord, sendConcurrency)
-		if err != nil {
-			log.ERROR.Printf("periodic task failed. task name is: %s. error is %s", name, err.Error())
-		}
-	}
+// RegisterPeriodicTask register a periodic task which will be triggered periodically
+func (server *Server) RegisterPeriodicTask(spec, name string, signature *tasks.Signature) error {
+	_, err := server.registerSchedule(&tasks.Schedule{
+		Name:       name,
+		Spec:       spec,
+		Kind:       tasks.ScheduleTask,
+		Signatures: []*tasks.Signature{signature},
+	})
+	return err
+}
 
-	_, err = server.scheduler.AddFunc(spec, f)
+// RegisterPeriodicChain register a periodic chain which will be triggered periodically
+func (server *Server) RegisterPeriodicChain(spec, name string, signatures ...*tasks.Signature) error {
+	_, err := server.registerSchedule(&tasks.Schedule{
+		Name:       name,
+		Spec:       spec,
+		Kind:       tasks.ScheduleChain,
+		Signatures: signatures,
+	})
+	return err
+}
+
+// RegisterPeriodicGroup register a periodic group which will be triggered periodically
+func (server *Server) RegisterPeriodicGroup(spec, name string, sendConcurrency int, signatures ...*tasks.Signature) error {
+	_, err := server.registerSchedule(&tasks.Schedule{
+		Name:            name,
+		Spec:            spec,
+		Kind:            tasks.ScheduleGroup,
+		Signatures:      signatures,
+		SendConcurrency: sendConcurrency,
+	})
+	return err
+}
+
+// RegisterPeriodicChord register a periodic chord which will be triggered periodically
+func (server *Server) RegisterPeriodicChord(spec, name string, sendConcurrency int, callback *tasks.Signature, signatures ...*tasks.Signature) error {
+	_, err := server.registerSchedule(&tasks.Schedule{
+		Name:            name,
+		Spec:            spec,
+		Kind:            tasks.ScheduleChord,
+		Signatures:      signatures,
+		Callback:        callback,
+		SendConcurrency: sendConcurrency,
+	})
 	return err
 }
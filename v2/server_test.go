@@ -1,15 +1,27 @@
 package machinery_test
 
 import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/backends"
+	backendsiface "github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/brokers"
 	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/scheduler"
+	"github.com/RichardKnop/machinery/v2/tasks"
 
 	backend "github.com/RichardKnop/machinery/v2/backends/eager"
+	memorybackend "github.com/RichardKnop/machinery/v2/backends/memory"
 	broker "github.com/RichardKnop/machinery/v2/brokers/eager"
+	memorybroker "github.com/RichardKnop/machinery/v2/brokers/memory"
 	lock "github.com/RichardKnop/machinery/v2/locks/eager"
 )
 
@@ -77,6 +89,628 @@ func TestNewCustomQueueWorker(t *testing.T) {
 	assert.NoError(t, nil)
 }
 
+type batchBroker struct {
+	*broker.Broker
+	batches [][]*tasks.Signature
+}
+
+func (b *batchBroker) PublishBatch(ctx context.Context, signatures []*tasks.Signature) error {
+	b.batches = append(b.batches, signatures)
+	return nil
+}
+
+func TestSendGroupWithBatchPublisher(t *testing.T) {
+	t.Parallel()
+
+	b := &batchBroker{Broker: broker.New().(*broker.Broker)}
+	server := machinery.NewServer(&config.Config{}, b, backend.New(), lock.New())
+
+	group, err := tasks.NewGroup(&tasks.Signature{Name: "foo"}, &tasks.Signature{Name: "bar"})
+	assert.NoError(t, err)
+
+	asyncResults, err := server.SendGroup(group, 0)
+	assert.NoError(t, err)
+	assert.Len(t, asyncResults, 2)
+	if assert.Len(t, b.batches, 1) {
+		assert.Equal(t, group.Tasks, b.batches[0])
+	}
+}
+
+func TestWithBrokerMiddleware(t *testing.T) {
+	t.Parallel()
+
+	var consumed []string
+	middleware := brokers.MiddlewareFuncs{
+		Publish: func(next brokers.PublishFunc) brokers.PublishFunc {
+			return func(ctx context.Context, signature *tasks.Signature) error {
+				signature.Headers = tasks.Headers{"published_by": "middleware"}
+				return next(ctx, signature)
+			}
+		},
+		Consume: func(next brokers.ConsumeFunc) brokers.ConsumeFunc {
+			return func(signature *tasks.Signature) error {
+				consumed = append(consumed, signature.Headers["published_by"].(string))
+				return next(signature)
+			}
+		},
+	}
+
+	server := machinery.NewServer(&config.Config{}, broker.New(), backend.New(), lock.New(),
+		machinery.WithBrokerMiddleware(middleware))
+	assert.NoError(t, server.RegisterTask("foo", func() error { return nil }))
+	server.GetBroker().(broker.Mode).AssignWorker(server.NewWorker("test_worker", 1))
+
+	_, err := server.SendTask(&tasks.Signature{Name: "foo"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"middleware"}, consumed)
+}
+
 func getTestServer(t *testing.T) *machinery.Server {
 	return machinery.NewServer(&config.Config{}, broker.New(), backend.New(), lock.New())
 }
+
+type unhealthyBroker struct {
+	*broker.Broker
+}
+
+func (b *unhealthyBroker) HealthCheck(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealthCheck(t *testing.T) {
+	t.Parallel()
+
+	server := getTestServer(t)
+	assert.NoError(t, server.HealthCheck(context.Background()))
+
+	server = machinery.NewServer(&config.Config{}, &unhealthyBroker{Broker: broker.New().(*broker.Broker)}, backend.New(), lock.New())
+	err := server.HealthCheck(context.Background())
+	if assert.Error(t, err) {
+		assert.Equal(t, "Broker health check failed: connection refused", err.Error())
+	}
+}
+
+func TestSendTaskWithIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{}
+	server := machinery.NewServer(cnf, broker.New(), memorybackend.New(cnf), lock.New())
+	var processed int
+	assert.NoError(t, server.RegisterTask("charge", func() error {
+		processed++
+		return nil
+	}))
+	server.GetBroker().(broker.Mode).AssignWorker(server.NewWorker("test_worker", 1))
+
+	first, err := server.SendTask(&tasks.Signature{Name: "charge", IdempotencyKey: "payment-1"})
+	assert.NoError(t, err)
+
+	// The duplicate returns the result of the sent task
+	duplicate, err := server.SendTask(&tasks.Signature{Name: "charge", IdempotencyKey: "payment-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, first.Signature.UUID, duplicate.Signature.UUID)
+	assert.Equal(t, 1, processed)
+
+	_, err = server.SendTask(&tasks.Signature{Name: "charge", IdempotencyKey: "payment-2"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, processed)
+
+	// Keys need a backend recording them
+	server = machinery.NewServer(cnf, broker.New(), backend.New(), lock.New())
+	_, err = server.SendTask(&tasks.Signature{Name: "charge", IdempotencyKey: "payment-1"})
+	assert.Error(t, err)
+}
+
+func TestSendTaskWithIdempotencyKeyFailingToPublish(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	failPublish := true
+	broker := brokers.WithMiddleware(memorybroker.New(cnf), brokers.MiddlewareFuncs{
+		Publish: func(next brokers.PublishFunc) brokers.PublishFunc {
+			return func(ctx context.Context, signature *tasks.Signature) error {
+				if failPublish {
+					return errors.New("broker is down")
+				}
+				return next(ctx, signature)
+			}
+		},
+	})
+	server := machinery.NewServer(cnf, broker, memorybackend.New(cnf), lock.New())
+
+	_, err := server.SendTask(&tasks.Signature{Name: "charge", IdempotencyKey: "payment-1"})
+	assert.Error(t, err)
+
+	// The key of the task which could not be sent is released
+	failPublish = false
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "charge", IdempotencyKey: "payment-1"})
+	assert.NoError(t, err)
+
+	pending, err := server.GetBroker().GetPendingTasks("machinery_tasks")
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, asyncResult.Signature.UUID, pending[0].UUID)
+	}
+}
+
+func TestSendUniqueTask(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	assert.NoError(t, server.RegisterTask("sync", func(account string) error { return nil }))
+
+	newSync := func(account string) *tasks.Signature {
+		signature, err := tasks.NewSignature("sync", []tasks.Arg{{Type: "string", Value: account}}, tasks.WithUnique(time.Minute))
+		assert.NoError(t, err)
+		return signature
+	}
+
+	queued, err := server.SendTask(newSync("account-1"))
+	assert.NoError(t, err)
+	_, err = server.SendTask(newSync("account-1"))
+	assert.Equal(t, machinery.ErrTaskNotUnique, err)
+	_, err = server.SendTask(newSync("account-2"))
+	assert.NoError(t, err)
+
+	// The lock is released once the task finished
+	assert.NoError(t, server.NewWorker("test_worker", 1).Process(queued.Signature))
+	_, err = server.SendTask(newSync("account-1"))
+	assert.NoError(t, err)
+}
+
+// failingPendingBackend fails to set the state of tasks to pending
+type failingPendingBackend struct {
+	backendsiface.Backend
+	fail bool
+}
+
+func (b *failingPendingBackend) SetStatePending(signature *tasks.Signature) error {
+	if b.fail {
+		return errors.New("backend is down")
+	}
+	return b.Backend.SetStatePending(signature)
+}
+
+func TestSendUniqueTaskFailingToSetStatePending(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	backend := &failingPendingBackend{Backend: memorybackend.New(cnf), fail: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), backend, lock.New())
+
+	newSync := func() *tasks.Signature {
+		signature, err := tasks.NewSignature("sync", []tasks.Arg{{Type: "string", Value: "account-1"}}, tasks.WithUnique(time.Minute))
+		assert.NoError(t, err)
+		return signature
+	}
+
+	_, err := server.SendTask(newSync())
+	assert.EqualError(t, err, "Set state pending error: backend is down")
+
+	// The lock of the task which could not be sent is released
+	backend.fail = false
+	_, err = server.SendTask(newSync())
+	assert.NoError(t, err)
+}
+
+func TestSendTaskWithPriority(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	broker := memorybroker.New(cnf)
+	server := machinery.NewServer(cnf, broker, memorybackend.New(cnf), lock.New())
+
+	for _, priority := range []uint8{tasks.PriorityLow, tasks.PriorityMedium, tasks.PriorityHigh, 2} {
+		_, err := server.SendTask(&tasks.Signature{Name: "add", Priority: priority})
+		assert.NoError(t, err)
+	}
+
+	// Pending tasks are listed in the order they are consumed in
+	pending, err := broker.GetPendingTasks("")
+	assert.NoError(t, err)
+	priorities := make([]uint8, len(pending))
+	for i, signature := range pending {
+		priorities[i] = signature.Priority
+	}
+	assert.Equal(t, []uint8{tasks.PriorityHigh, tasks.PriorityMedium, tasks.PriorityLow, 2}, priorities)
+}
+
+func TestSendTaskWithInvalidArgs(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	add := func(a, b int64) (int64, error) { return a + b, nil }
+	assert.NoError(t, server.RegisterTask("add", add, machinery.WithArgsValidator(tasks.MatchArgs(add))))
+
+	_, err := server.SendTask(&tasks.Signature{
+		Name: "add",
+		Args: []tasks.Arg{{Type: "int64", Value: 1}, {Type: "string", Value: "2"}},
+	})
+	var invalidArgs tasks.ErrInvalidArgs
+	if assert.True(t, errors.As(err, &invalidArgs)) {
+		assert.Equal(t, "Invalid args of task add: arg 1 is string, want int64", err.Error())
+	}
+
+	_, err = server.SendTask(&tasks.Signature{
+		Name: "add",
+		Args: []tasks.Arg{{Type: "int64", Value: 1}, {Type: "int64", Value: 2}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	assert.NoError(t, server.RegisterTask("add", func(a, b int64) (int64, error) { return a + b, nil }))
+	assert.NoError(t, server.RegisterTask("done", func() error { return nil }))
+	var attempts int32
+	assert.NoError(t, server.RegisterTask("fail", func() error {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return tasks.NewErrRetryTaskLater("not yet", 10*time.Millisecond)
+		}
+		return errors.New("boom")
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := server.Events(ctx)
+
+	worker := server.NewWorker("test_worker", 1)
+	go worker.Launch()
+	defer worker.Quit()
+
+	group, err := tasks.NewGroup(
+		&tasks.Signature{Name: "add", Args: []tasks.Arg{{Type: "int64", Value: 1}, {Type: "int64", Value: 2}}},
+		&tasks.Signature{Name: "add", Args: []tasks.Arg{{Type: "int64", Value: 3}, {Type: "int64", Value: 4}}},
+	)
+	assert.NoError(t, err)
+	chord, err := tasks.NewChord(group, &tasks.Signature{Name: "done", Immutable: true})
+	assert.NoError(t, err)
+	_, err = server.SendChord(chord, 0)
+	assert.NoError(t, err)
+	_, err = server.SendTask(&tasks.Signature{Name: "fail"})
+	assert.NoError(t, err)
+
+	counts := make(map[machinery.EventType]int)
+	timeout := time.After(5 * time.Second)
+	for counts[machinery.EventTaskSucceeded] < 3 || counts[machinery.EventTaskFailed] < 1 {
+		select {
+		case event := <-events:
+			counts[event.Type]++
+			switch event.Type {
+			case machinery.EventTaskSucceeded:
+				assert.NotNil(t, event.Results)
+			case machinery.EventTaskFailed, machinery.EventTaskRetried:
+				assert.Equal(t, "fail", event.Signature.Name)
+				assert.NotEmpty(t, event.Error)
+			case machinery.EventChordTriggered:
+				assert.Equal(t, "done", event.Signature.Name)
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for events, got %v", counts)
+		}
+	}
+
+	// The retried task is published again
+	assert.Equal(t, 5, counts[machinery.EventTaskPublished])
+	assert.Equal(t, 5, counts[machinery.EventTaskStarted])
+	assert.Equal(t, 1, counts[machinery.EventTaskRetried])
+	assert.GreaterOrEqual(t, counts[machinery.EventGroupCompleted], 1)
+	assert.Equal(t, 1, counts[machinery.EventChordTriggered])
+
+	// The channel is closed once the context is done
+	cancel()
+	for range events {
+	}
+}
+
+func TestReplayTask(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	var fixed int32
+	assert.NoError(t, server.RegisterTask("flaky", func() error {
+		if atomic.LoadInt32(&fixed) == 0 {
+			return errors.New("outage")
+		}
+		return nil
+	}))
+
+	worker := server.NewWorker("test_worker", 1)
+	go worker.Launch()
+	defer worker.Quit()
+
+	since := time.Now()
+	var failedUUIDs []string
+	for i := 0; i < 3; i++ {
+		asyncResult, err := server.SendTask(&tasks.Signature{Name: "flaky"})
+		assert.NoError(t, err)
+		_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+		assert.Error(t, err)
+		failedUUIDs = append(failedUUIDs, asyncResult.Signature.UUID)
+	}
+	atomic.StoreInt32(&fixed, 1)
+
+	asyncResult, err := server.ReplayTask(failedUUIDs[0])
+	if assert.NoError(t, err) {
+		assert.NotEqual(t, failedUUIDs[0], asyncResult.Signature.UUID)
+		assert.Equal(t, failedUUIDs[0], asyncResult.Signature.ReplayOf)
+		_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+		assert.NoError(t, err)
+	}
+
+	// A failed task is replayed once
+	_, err = server.ReplayTask(failedUUIDs[0])
+	assert.Error(t, err)
+
+	replayed, err := server.RequeueFailed("flaky", since)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	replayed, err = server.RequeueFailed("", since)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, replayed)
+}
+
+func TestSyncSchedules(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	schedule := &tasks.Schedule{
+		Name:       "ping",
+		Spec:       "@every 1s",
+		Signatures: []*tasks.Signature{{Name: "ping", RoutingKey: "scheduled_tasks"}},
+	}
+	assert.NoError(t, backends.SaveSchedule(server.GetBackend(), schedule))
+	assert.NoError(t, server.SyncSchedules())
+
+	assert.Eventually(t, func() bool {
+		pending, err := server.GetBroker().GetPendingTasks("scheduled_tasks")
+		return err == nil && len(pending) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Deleted schedules are removed from the scheduler
+	assert.NoError(t, backends.DeleteSchedule(server.GetBackend(), "ping"))
+	assert.NoError(t, server.SyncSchedules())
+	pending, err := server.GetBroker().GetPendingTasks("scheduled_tasks")
+	assert.NoError(t, err)
+	time.Sleep(1500 * time.Millisecond)
+	pendingAfter, err := server.GetBroker().GetPendingTasks("scheduled_tasks")
+	assert.NoError(t, err)
+	assert.Len(t, pendingAfter, len(pending))
+}
+
+func TestSchedulerLeaderElection(t *testing.T) {
+	t.Parallel()
+
+	// Every server sends periodic tasks without leader election
+	server := machinery.NewServer(&config.Config{NoUnixSignals: true}, broker.New(), backend.New(), lock.New())
+	assert.True(t, server.IsSchedulerLeader())
+
+	cnf := &config.Config{SchedulerLeaseTTL: 3, NoUnixSignals: true}
+	sharedLock := lock.New()
+	servers := []*machinery.Server{
+		machinery.NewServer(cnf, broker.New(), backend.New(), sharedLock),
+		machinery.NewServer(cnf, broker.New(), backend.New(), sharedLock),
+	}
+	assert.Eventually(t, func() bool {
+		return servers[0].IsSchedulerLeader() != servers[1].IsSchedulerLeader()
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The leader keeps its lease by renewing it
+	time.Sleep(4 * time.Second)
+	assert.NotEqual(t, servers[0].IsSchedulerLeader(), servers[1].IsSchedulerLeader())
+}
+
+func TestRegisterScheduleInTimezone(t *testing.T) {
+	t.Parallel()
+
+	server := machinery.NewServer(&config.Config{NoUnixSignals: true}, broker.New(), backend.New(), lock.New())
+	signature := &tasks.Signature{Name: "send_report"}
+
+	assert.NoError(t, server.RegisterPeriodicTask("CRON_TZ=Europe/Berlin 0 9 * * *", "report", signature))
+	assert.Error(t, server.RegisterPeriodicTask("CRON_TZ=Nowhere/City 0 9 * * *", "report", signature))
+
+	assert.NoError(t, server.RegisterSchedule(&tasks.Schedule{
+		Name:       "report",
+		Spec:       "0 9 * * *",
+		Timezone:   "Europe/Berlin",
+		Signatures: []*tasks.Signature{signature},
+	}))
+	assert.Error(t, server.RegisterSchedule(&tasks.Schedule{
+		Name:       "report",
+		Spec:       "0 9 * * *",
+		Timezone:   "Nowhere/City",
+		Signatures: []*tasks.Signature{signature},
+	}))
+}
+
+func TestScheduleJitter(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	// Runs are sent at most the jitter after they are due
+	var sentAt []time.Time
+	var mu sync.Mutex
+	server.SetPreTaskHandler(func(*tasks.Signature) {
+		mu.Lock()
+		sentAt = append(sentAt, time.Now())
+		mu.Unlock()
+	})
+	assert.NoError(t, server.RegisterSchedule(&tasks.Schedule{
+		Name:       "jittered",
+		Spec:       "@every 2s",
+		Jitter:     500 * time.Millisecond,
+		Signatures: []*tasks.Signature{{Name: "ping", RoutingKey: "jittered_tasks"}},
+	}))
+	registeredAt := time.Now()
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(sentAt) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	delay := sentAt[0].Sub(registeredAt)
+	mu.Unlock()
+	assert.True(t, delay < 2600*time.Millisecond, delay)
+}
+
+func TestScheduleCatchUp(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	// The server was down for the last three yearly runs after lastRun
+	lastRun := time.Now().AddDate(-3, 0, -1)
+	for _, policy := range []string{tasks.CatchUpSkip, tasks.CatchUpOnce, tasks.CatchUpAll} {
+		assert.NoError(t, backends.SetScheduleLastRun(server.GetBackend(), policy, lastRun))
+		assert.NoError(t, server.RegisterSchedule(&tasks.Schedule{
+			Name:       policy,
+			Spec:       "0 0 1 1 *",
+			CatchUp:    policy,
+			Signatures: []*tasks.Signature{{Name: "report", RoutingKey: "catch_up_" + policy}},
+		}))
+	}
+
+	for policy, expected := range map[string]int{tasks.CatchUpSkip: 0, tasks.CatchUpOnce: 1, tasks.CatchUpAll: 3} {
+		pending, err := server.GetBroker().GetPendingTasks("catch_up_" + policy)
+		assert.NoError(t, err)
+		assert.Len(t, pending, expected, policy)
+	}
+
+	// The last run is recorded once missed runs were sent
+	recorded, err := backends.ScheduleLastRun(server.GetBackend(), tasks.CatchUpAll)
+	assert.NoError(t, err)
+	assert.True(t, recorded.After(lastRun))
+
+	// Schedules catching up need a result backend storing their last runs
+	server = machinery.NewServer(cnf, broker.New(), backend.New(), lock.New())
+	assert.Equal(t, backends.ErrSchedulesNotSupported, server.RegisterSchedule(&tasks.Schedule{
+		Name:       "report",
+		Spec:       "* * * * *",
+		CatchUp:    tasks.CatchUpOnce,
+		Signatures: []*tasks.Signature{{Name: "report"}},
+	}))
+}
+
+func TestScheduleSkipIfRunning(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "skip_if_running_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	var calls int32
+	done := make(chan struct{})
+	assert.NoError(t, server.RegisterTask("nightly_job", func() error {
+		atomic.AddInt32(&calls, 1)
+		<-done
+		return nil
+	}))
+
+	worker := server.NewWorker("test_worker", 2)
+	go worker.Launch()
+	defer worker.Quit()
+
+	assert.NoError(t, server.RegisterSchedule(&tasks.Schedule{
+		Name:          "nightly_job",
+		Spec:          "@every 1s",
+		SkipIfRunning: true,
+		Signatures:    []*tasks.Signature{{Name: "nightly_job"}},
+	}))
+
+	// Runs are skipped while the first one is running
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(2500 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// The next run is sent once the first one finished
+	close(done)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) > 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRegisterScheduleWithRuns(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	// One-off runs are sent once
+	assert.NoError(t, server.RegisterSchedule(&tasks.Schedule{
+		Name:       "once",
+		Runs:       scheduler.At(time.Now().Add(500 * time.Millisecond)),
+		Signatures: []*tasks.Signature{{Name: "ping", RoutingKey: "one_off_tasks"}},
+	}))
+	assert.NoError(t, server.RegisterSchedule(&tasks.Schedule{
+		Name:       "once_by_spec",
+		Spec:       "@at " + time.Now().Add(time.Second).UTC().Format(time.RFC3339),
+		Signatures: []*tasks.Signature{{Name: "ping", RoutingKey: "one_off_tasks"}},
+	}))
+
+	assert.Eventually(t, func() bool {
+		pending, err := server.GetBroker().GetPendingTasks("one_off_tasks")
+		return err == nil && len(pending) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(1500 * time.Millisecond)
+	pending, err := server.GetBroker().GetPendingTasks("one_off_tasks")
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2)
+}
+
+func TestManageSchedules(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	schedule := &tasks.Schedule{
+		Name:       "ping",
+		Spec:       "@every 1s",
+		Signatures: []*tasks.Signature{{Name: "ping", RoutingKey: "managed_tasks"}},
+	}
+	assert.NoError(t, server.AddSchedule(schedule))
+	assert.Equal(t, machinery.ErrScheduleExists, server.AddSchedule(schedule))
+
+	// Added schedules are synced right away
+	assert.Eventually(t, func() bool {
+		pending, err := server.GetBroker().GetPendingTasks("managed_tasks")
+		return err == nil && len(pending) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	schedule.Spec = "@every 1h"
+	assert.NoError(t, server.UpdateSchedule(schedule))
+	schedules, err := server.ListSchedules()
+	if assert.NoError(t, err) && assert.Len(t, schedules, 1) {
+		assert.Equal(t, "@every 1h", schedules[0].Spec)
+	}
+
+	assert.NoError(t, server.RemoveSchedule("ping"))
+	assert.Equal(t, machinery.ErrScheduleNotFound, server.RemoveSchedule("ping"))
+	assert.Equal(t, machinery.ErrScheduleNotFound, server.UpdateSchedule(schedule))
+	schedules, err = server.ListSchedules()
+	assert.NoError(t, err)
+	assert.Empty(t, schedules)
+}
+
+func TestCronWithSeconds(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{Name: "ping"}
+	server := machinery.NewServer(&config.Config{NoUnixSignals: true}, broker.New(), backend.New(), lock.New())
+	assert.Error(t, server.RegisterPeriodicTask("*/10 * * * * *", "ping", signature))
+
+	server = machinery.NewServer(&config.Config{CronWithSeconds: true, NoUnixSignals: true}, broker.New(), backend.New(), lock.New())
+	assert.NoError(t, server.RegisterPeriodicTask("*/10 * * * * *", "ping", signature))
+	assert.NoError(t, server.RegisterPeriodicTask("0 9 * * *", "ping", signature))
+}
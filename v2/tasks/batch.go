@@ -0,0 +1,31 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+)
+
+// BatchHandler processes several tasks of the same name at once, e.g. with a
+// bulk insert. The tasks of the batch fail together when it returns an error.
+type BatchHandler func(ctx context.Context, items []*BatchItem) error
+
+// BatchItem is a task of a batch with its args converted like the args of a
+// task function
+type BatchItem struct {
+	Signature *Signature
+	Args      []interface{}
+}
+
+// NewBatchItem creates a batch item converting the args of the signature
+func NewBatchItem(signature *Signature) (*BatchItem, error) {
+	args := make([]interface{}, len(signature.Args))
+	for i, arg := range signature.Args {
+		argValue, err := ReflectValue(arg.Type, arg.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Reflect task args error: %s", err)
+		}
+		args[i] = argValue.Interface()
+	}
+
+	return &BatchItem{Signature: signature, Args: args}, nil
+}
@@ -0,0 +1,197 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// DAGNode is a task of a DAG together with the names of the nodes it depends on
+type DAGNode struct {
+	Name         string
+	Signature    *Signature
+	Dependencies []string
+}
+
+// DAG is a workflow of tasks whose dependencies form a directed acyclic graph.
+// A task is sent once all tasks it depends on succeeded, their results are
+// appended to its args in the order of its dependencies unless the task is
+// immutable. When a task fails, the tasks depending on it fail as well.
+type DAG struct {
+	DAGUUID string
+	Nodes   []*DAGNode
+}
+
+// DAGMeta is carried by signatures of sent tasks of a DAG, workers send the
+// tasks depending on them from it
+type DAGMeta struct {
+	DAG
+	// Node is the name of the node of the task
+	Node string
+}
+
+// NewDAG creates a new DAG of tasks, the nodes are checked to depend on other
+// existing nodes without cycles
+func NewDAG(nodes ...*DAGNode) (*DAG, error) {
+	dag := &DAG{
+		DAGUUID: fmt.Sprintf("dag_%v", uuid.New().String()),
+		Nodes:   nodes,
+	}
+
+	names := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		if node.Name == "" {
+			return nil, errors.New("DAG node has no name")
+		}
+		if node.Signature == nil {
+			return nil, fmt.Errorf("DAG node %s has no signature", node.Name)
+		}
+		if names[node.Name] {
+			return nil, fmt.Errorf("DAG node %s is defined more than once", node.Name)
+		}
+		names[node.Name] = true
+	}
+
+	for _, node := range nodes {
+		for _, dependency := range node.Dependencies {
+			if !names[dependency] {
+				return nil, fmt.Errorf("DAG node %s depends on unknown node %s", node.Name, dependency)
+			}
+		}
+	}
+
+	if err := dag.checkCycles(); err != nil {
+		return nil, err
+	}
+
+	// Auto generate task UUIDs if needed
+	for _, node := range nodes {
+		if node.Signature.UUID == "" {
+			signatureID := uuid.New().String()
+			node.Signature.UUID = fmt.Sprintf("task_%v", signatureID)
+		}
+	}
+
+	return dag, nil
+}
+
+// GetUUIDs returns slice of task UUIDs of all nodes
+func (dag *DAG) GetUUIDs() []string {
+	taskUUIDs := make([]string, len(dag.Nodes))
+	for i, node := range dag.Nodes {
+		taskUUIDs[i] = node.Signature.UUID
+	}
+	return taskUUIDs
+}
+
+// Node returns the node with the name, nil if there is none
+func (dag *DAG) Node(name string) *DAGNode {
+	for _, node := range dag.Nodes {
+		if node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// Roots returns the nodes without dependencies, they are sent first
+func (dag *DAG) Roots() []*DAGNode {
+	var roots []*DAGNode
+	for _, node := range dag.Nodes {
+		if len(node.Dependencies) == 0 {
+			roots = append(roots, node)
+		}
+	}
+	return roots
+}
+
+// Dependencies returns the nodes the node depends on, in the order of its
+// dependencies
+func (dag *DAG) Dependencies(node *DAGNode) []*DAGNode {
+	dependencies := make([]*DAGNode, 0, len(node.Dependencies))
+	for _, name := range node.Dependencies {
+		if dependency := dag.Node(name); dependency != nil {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+	return dependencies
+}
+
+// Dependents returns the nodes depending on the named node directly
+func (dag *DAG) Dependents(name string) []*DAGNode {
+	var dependents []*DAGNode
+	for _, node := range dag.Nodes {
+		for _, dependency := range node.Dependencies {
+			if dependency == name {
+				dependents = append(dependents, node)
+				break
+			}
+		}
+	}
+	return dependents
+}
+
+// Descendants returns the nodes depending on the named node directly or
+// through other nodes
+func (dag *DAG) Descendants(name string) []*DAGNode {
+	var (
+		descendants []*DAGNode
+		seen        = map[string]bool{name: true}
+		queue       = []string{name}
+	)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, dependent := range dag.Dependents(current) {
+			if seen[dependent.Name] {
+				continue
+			}
+			seen[dependent.Name] = true
+			descendants = append(descendants, dependent)
+			queue = append(queue, dependent.Name)
+		}
+	}
+	return descendants
+}
+
+// JoinUUID returns the UUID of the group of the dependencies of the named
+// node, the backend flags it once the node has been sent
+func (dag *DAG) JoinUUID(name string) string {
+	return fmt.Sprintf("%s:%s", dag.DAGUUID, name)
+}
+
+// checkCycles returns an error if nodes depend on each other, removing nodes
+// without remaining dependencies must remove all nodes
+func (dag *DAG) checkCycles() error {
+	remaining := make(map[string]int, len(dag.Nodes))
+	var ready []string
+	for _, node := range dag.Nodes {
+		remaining[node.Name] = len(node.Dependencies)
+		if len(node.Dependencies) == 0 {
+			ready = append(ready, node.Name)
+		}
+	}
+
+	removed := 0
+	for len(ready) > 0 {
+		name := ready[0]
+		ready = ready[1:]
+		removed++
+		for _, dependent := range dag.Dependents(name) {
+			for _, dependency := range dependent.Dependencies {
+				if dependency == name {
+					remaining[dependent.Name]--
+				}
+			}
+			if remaining[dependent.Name] == 0 {
+				ready = append(ready, dependent.Name)
+			}
+		}
+	}
+
+	if removed != len(dag.Nodes) {
+		return fmt.Errorf("DAG %s has a dependency cycle", dag.DAGUUID)
+	}
+	return nil
+}
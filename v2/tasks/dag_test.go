@@ -0,0 +1,68 @@
+package tasks_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestNewDAG(t *testing.T) {
+	t.Parallel()
+
+	dag, err := tasks.NewDAG(
+		&tasks.DAGNode{Name: "a", Signature: &tasks.Signature{Name: "foo"}},
+		&tasks.DAGNode{Name: "b", Signature: &tasks.Signature{Name: "foo"}},
+		&tasks.DAGNode{Name: "c", Signature: &tasks.Signature{Name: "bar"}, Dependencies: []string{"b", "a"}},
+		&tasks.DAGNode{Name: "d", Signature: &tasks.Signature{Name: "bar"}, Dependencies: []string{"c"}},
+	)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, dag.DAGUUID)
+	for _, node := range dag.Nodes {
+		assert.NotEmpty(t, node.Signature.UUID)
+	}
+
+	names := func(nodes []*tasks.DAGNode) []string {
+		var names []string
+		for _, node := range nodes {
+			names = append(names, node.Name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"a", "b"}, names(dag.Roots()))
+	assert.Equal(t, []string{"b", "a"}, names(dag.Dependencies(dag.Node("c"))))
+	assert.Equal(t, []string{"c"}, names(dag.Dependents("a")))
+	assert.Equal(t, []string{"c", "d"}, names(dag.Descendants("b")))
+	assert.Empty(t, dag.Descendants("d"))
+	assert.Equal(t, dag.DAGUUID+":c", dag.JoinUUID("c"))
+}
+
+func TestNewDAGInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := tasks.NewDAG(
+		&tasks.DAGNode{Name: "a", Signature: &tasks.Signature{Name: "foo"}, Dependencies: []string{"b"}},
+	)
+	assert.EqualError(t, err, "DAG node a depends on unknown node b")
+
+	_, err = tasks.NewDAG(
+		&tasks.DAGNode{Name: "a", Signature: &tasks.Signature{Name: "foo"}},
+		&tasks.DAGNode{Name: "a", Signature: &tasks.Signature{Name: "foo"}},
+	)
+	assert.EqualError(t, err, "DAG node a is defined more than once")
+
+	_, err = tasks.NewDAG(&tasks.DAGNode{Name: "a"})
+	assert.EqualError(t, err, "DAG node a has no signature")
+
+	_, err = tasks.NewDAG(
+		&tasks.DAGNode{Name: "root", Signature: &tasks.Signature{Name: "foo"}},
+		&tasks.DAGNode{Name: "a", Signature: &tasks.Signature{Name: "foo"}, Dependencies: []string{"root", "b"}},
+		&tasks.DAGNode{Name: "b", Signature: &tasks.Signature{Name: "foo"}, Dependencies: []string{"a"}},
+	)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "dependency cycle")
+	}
+}
@@ -0,0 +1,81 @@
+package tasks
+
+import (
+	"time"
+)
+
+// Headers describing why a task was moved to a dead letter queue
+const (
+	DeadLetterReasonHeader   = "machinery_dead_letter_reason"
+	DeadLetterErrorHeader    = "machinery_dead_letter_error"
+	DeadLetterQueueHeader    = "machinery_dead_letter_queue"
+	DeadLetterFailedAtHeader = "machinery_dead_letter_failed_at"
+)
+
+// Reasons for moving a task to a dead letter queue
+const (
+	// DeadLetterReasonRetriesExhausted - the task failed with no retries left
+	DeadLetterReasonRetriesExhausted = "retries_exhausted"
+	// DeadLetterReasonUnprocessable - the task could not be called, e.g. its
+	// arguments could not be converted to their types
+	DeadLetterReasonUnprocessable = "unprocessable"
+	// DeadLetterReasonNotRetryable - the task failed with an error it is not
+	// retried on
+	DeadLetterReasonNotRetryable = "not_retryable"
+	// DeadLetterReasonPanicked - the task panicked and the worker moves
+	// tasks which panicked to the dead letter queue
+	DeadLetterReasonPanicked = "panicked"
+	// DeadLetterReasonPoison - the task was delivered too many times without
+	// finishing, e.g. because it crashed its workers
+	DeadLetterReasonPoison = "poison"
+)
+
+// NewDeadLetterSignature returns a copy of the signature consumed from queue
+// routed to the dead letter queue, the reason, the error and the original queue
+// are kept in headers
+func NewDeadLetterSignature(signature *Signature, queue, deadLetterQueue, reason string, taskErr error) *Signature {
+	deadLetter := CopySignature(signature)
+
+	headers := make(Headers, len(signature.Headers)+4)
+	for k, v := range signature.Headers {
+		headers[k] = v
+	}
+	headers[DeadLetterReasonHeader] = reason
+	headers[DeadLetterQueueHeader] = queue
+	headers[DeadLetterFailedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+	if taskErr != nil {
+		headers[DeadLetterErrorHeader] = taskErr.Error()
+	}
+
+	deadLetter.Headers = headers
+	deadLetter.RoutingKey = deadLetterQueue
+	deadLetter.ETA = nil
+	deadLetter.SQSReceiptHandle = ""
+	return deadLetter
+}
+
+// NewRequeuedSignature returns a copy of the task taken off a dead letter
+// queue routed back to its original queue, it is retried again as many times
+// as before it was moved to the dead letter queue
+func NewRequeuedSignature(deadLetter *Signature) *Signature {
+	signature := CopySignature(deadLetter)
+
+	headers := make(Headers, len(deadLetter.Headers))
+	for k, v := range deadLetter.Headers {
+		headers[k] = v
+	}
+	if queue, ok := headers[DeadLetterQueueHeader].(string); ok {
+		signature.RoutingKey = queue
+	}
+	delete(headers, DeadLetterReasonHeader)
+	delete(headers, DeadLetterErrorHeader)
+	delete(headers, DeadLetterQueueHeader)
+	delete(headers, DeadLetterFailedAtHeader)
+
+	signature.Headers = headers
+	signature.RetryCount = deadLetter.RetryAttempt
+	signature.RetryAttempt = 0
+	signature.RetryTimeout = 0
+	signature.ETA = nil
+	return signature
+}
@@ -0,0 +1,46 @@
+package tasks_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestNewRequeuedSignature(t *testing.T) {
+	t.Parallel()
+
+	signature := &tasks.Signature{
+		UUID:         "task_1",
+		Name:         "reconcile",
+		RoutingKey:   "payments",
+		Headers:      tasks.Headers{"tenant": "acme"},
+		RetryTimeout: 2,
+	}
+	// Failed and retried twice, then failed with no retries left
+	for i := 0; i < 3; i++ {
+		signature.RecordFailure(tasks.NewFailure(signature, errors.New("ledger mismatch"), time.Now()))
+		if i < 2 {
+			signature.RetryAttempt++
+		}
+	}
+
+	deadLetter := tasks.NewDeadLetterSignature(signature, "payments", "payments_dead_letters", tasks.DeadLetterReasonRetriesExhausted, errors.New("ledger mismatch"))
+	assert.Equal(t, "payments_dead_letters", deadLetter.RoutingKey)
+
+	requeued := tasks.NewRequeuedSignature(deadLetter)
+	assert.Equal(t, "task_1", requeued.UUID)
+	assert.Equal(t, "payments", requeued.RoutingKey)
+	assert.Equal(t, tasks.Headers{"tenant": "acme"}, requeued.Headers)
+	assert.Equal(t, 2, requeued.RetryCount)
+	assert.Equal(t, 0, requeued.RetryAttempt)
+	assert.Equal(t, 0, requeued.RetryTimeout)
+	assert.Nil(t, requeued.ETA)
+	if assert.Len(t, requeued.Failures, 3) {
+		assert.Equal(t, 3, requeued.Failures[2].Attempt)
+		assert.Equal(t, "ledger mismatch", requeued.Failures[2].Error)
+	}
+}
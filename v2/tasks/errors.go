@@ -1,6 +1,7 @@
 package tasks
 
 import (
+	"errors"
 	"fmt"
 	"time"
 )
@@ -30,3 +31,65 @@ func NewErrRetryTaskLater(msg string, retryIn time.Duration) ErrRetryTaskLater {
 type Retriable interface {
 	RetryIn() time.Duration
 }
+
+// ErrNonRetryable wraps an error the task will never succeed with, e.g. an
+// invalid request, the task is not retried and fails at once
+type ErrNonRetryable struct {
+	err error
+}
+
+// NewErrNonRetryable returns new ErrNonRetryable instance wrapping the error
+func NewErrNonRetryable(err error) ErrNonRetryable {
+	return ErrNonRetryable{err: err}
+}
+
+// Error implements the error interface
+func (e ErrNonRetryable) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e ErrNonRetryable) Unwrap() error {
+	return e.err
+}
+
+// IsNonRetryable returns true if the error or an error it wraps is
+// ErrNonRetryable
+func IsNonRetryable(err error) bool {
+	var nonRetryable ErrNonRetryable
+	return errors.As(err, &nonRetryable)
+}
+
+// ErrPanicked is returned when the task panicked, it keeps the recovered value
+// and the stack trace of the task
+type ErrPanicked struct {
+	err   error
+	Value interface{}
+	Stack string
+}
+
+// NewErrPanicked returns new ErrPanicked instance for the value recovered from
+// a panic, the error is the value if it is an error or a string and
+// ErrTaskPanicked otherwise
+func NewErrPanicked(value interface{}, stack []byte) ErrPanicked {
+	var err error
+	switch value := value.(type) {
+	default:
+		err = ErrTaskPanicked
+	case error:
+		err = value
+	case string:
+		err = errors.New(value)
+	}
+	return ErrPanicked{err: err, Value: value, Stack: string(stack)}
+}
+
+// Error implements the error interface
+func (e ErrPanicked) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error of the recovered value
+func (e ErrPanicked) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,77 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Failure is a failed attempt of a task
+type Failure struct {
+	// Attempt counts the attempts of the task from 1
+	Attempt int
+	Error   string
+	// ErrorType is the Go type of the error, or of the recovered value if the
+	// task panicked
+	ErrorType string
+	// Stack is the stack trace of the task if it panicked
+	Stack string
+	// Hostname is the host of the worker which ran the attempt
+	Hostname  string
+	StartedAt time.Time
+	FailedAt  time.Time
+}
+
+// FailedTask is a task which failed for good, recorded so it can be replayed
+type FailedTask struct {
+	Signature *Signature
+	Error     string
+	FailedAt  time.Time
+}
+
+// NewFailure returns the failure of the latest attempt of the task, started at
+// startedAt and failed with the error
+func NewFailure(signature *Signature, err error, startedAt time.Time) *Failure {
+	failure := &Failure{
+		Attempt:   signature.RetryAttempt + 1,
+		Error:     err.Error(),
+		ErrorType: fmt.Sprintf("%T", err),
+		StartedAt: startedAt.UTC(),
+		FailedAt:  time.Now().UTC(),
+	}
+
+	var panicked ErrPanicked
+	if errors.As(err, &panicked) {
+		failure.ErrorType = fmt.Sprintf("%T", panicked.Value)
+		failure.Stack = panicked.Stack
+	}
+	return failure
+}
+
+// RecordFailure adds the failure of the latest attempt of the task to its
+// failures
+func (signature *Signature) RecordFailure(failure *Failure) {
+	signature.Failures = append(signature.Failures, failure)
+}
+
+// NewReplaySignature returns a copy of the failed task with a new UUID, to be
+// sent again on its own. It is retried again as many times as before it
+// failed, outside of its group and chord.
+func NewReplaySignature(failed *Signature) *Signature {
+	signature := CopySignature(failed)
+	signature.UUID = fmt.Sprintf("task_%v", uuid.New().String())
+	signature.ReplayOf = failed.UUID
+	signature.RetryCount = failed.RetryAttempt
+	signature.RetryAttempt = 0
+	signature.RetryTimeout = 0
+	signature.Failures = nil
+	signature.ETA = nil
+	signature.GroupUUID = ""
+	signature.GroupTaskCount = 0
+	signature.ChordCallback = nil
+	signature.IdempotencyKey = ""
+	signature.SQSReceiptHandle = ""
+	return signature
+}
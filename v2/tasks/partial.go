@@ -0,0 +1,43 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoResultEmitter is returned by EmitResult when the task is not run by a
+// worker
+var ErrNoResultEmitter = errors.New("Task context has no result emitter")
+
+// ResultEmitter records a partial result of a running task, it is
+// implemented by the worker
+type ResultEmitter func(result *TaskResult) error
+
+type resultEmitterCtxType struct{}
+
+var resultEmitterCtx resultEmitterCtxType
+
+// ContextWithResultEmitter returns a copy of ctx carrying the emitter
+func ContextWithResultEmitter(ctx context.Context, emit ResultEmitter) context.Context {
+	return context.WithValue(ctx, resultEmitterCtx, emit)
+}
+
+// EmitResult records the value as a partial result of the running task, e.g.
+// a page scraped before the task finishes. Partial results are recorded by
+// the result backend in the order they are emitted.
+func EmitResult(ctx context.Context, value interface{}) error {
+	if ctx == nil {
+		return ErrNoResultEmitter
+	}
+
+	emit, ok := ctx.Value(resultEmitterCtx).(ResultEmitter)
+	if !ok {
+		return ErrNoResultEmitter
+	}
+
+	result, err := newTaskResult(value)
+	if err != nil {
+		return err
+	}
+	return emit(result)
+}
@@ -0,0 +1,29 @@
+package tasks_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestEmitResult(t *testing.T) {
+	t.Parallel()
+
+	var emitted []*tasks.TaskResult
+	ctx := tasks.ContextWithResultEmitter(context.Background(), func(result *tasks.TaskResult) error {
+		emitted = append(emitted, result)
+		return nil
+	})
+
+	assert.NoError(t, tasks.EmitResult(ctx, []string{"a", "b"}))
+	assert.NoError(t, tasks.EmitResult(ctx, int64(2)))
+	assert.Equal(t, []*tasks.TaskResult{
+		{Type: "[]string", Value: []string{"a", "b"}},
+		{Type: "int64", Value: int64(2)},
+	}, emitted)
+
+	assert.Equal(t, tasks.ErrNoResultEmitter, tasks.EmitResult(context.Background(), "page"))
+}
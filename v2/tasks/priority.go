@@ -0,0 +1,44 @@
+package tasks
+
+// Priorities of the three levels tasks are consumed by on brokers without
+// native message priorities. Tasks without a priority have the low priority.
+const (
+	PriorityLow    uint8 = 0
+	PriorityMedium uint8 = 5
+	PriorityHigh   uint8 = 9
+)
+
+// PriorityLevel maps a priority to its level: priorities up to 3 are low,
+// from 4 to 6 medium and from 7 high
+func PriorityLevel(priority uint8) uint8 {
+	switch {
+	case priority >= 7:
+		return PriorityHigh
+	case priority >= 4:
+		return PriorityMedium
+	}
+	return PriorityLow
+}
+
+// PriorityQueue returns the name of the queue tasks of the queue with the
+// priority are placed on, low priority tasks stay on the queue itself while
+// medium and high priority ones have the "_medium" and "_high" suffixes
+func PriorityQueue(queue string, priority uint8) string {
+	switch PriorityLevel(priority) {
+	case PriorityHigh:
+		return queue + "_high"
+	case PriorityMedium:
+		return queue + "_medium"
+	}
+	return queue
+}
+
+// PriorityQueues returns the names of the queues of all priority levels of
+// the queue, from the highest priority
+func PriorityQueues(queue string) []string {
+	return []string{
+		PriorityQueue(queue, PriorityHigh),
+		PriorityQueue(queue, PriorityMedium),
+		PriorityQueue(queue, PriorityLow),
+	}
+}
@@ -0,0 +1,26 @@
+package tasks_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestPriorityQueue(t *testing.T) {
+	t.Parallel()
+
+	for priority, queue := range map[uint8]string{
+		0:   "machinery_tasks",
+		3:   "machinery_tasks",
+		4:   "machinery_tasks_medium",
+		6:   "machinery_tasks_medium",
+		7:   "machinery_tasks_high",
+		255: "machinery_tasks_high",
+	} {
+		assert.Equal(t, queue, tasks.PriorityQueue("machinery_tasks", priority))
+	}
+
+	assert.Equal(t, []string{"machinery_tasks_high", "machinery_tasks_medium", "machinery_tasks"}, tasks.PriorityQueues("machinery_tasks"))
+}
@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"encoding/base64"
+	"fmt"
+	"reflect"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// ProtoType is the type of args and results holding a protobuf message. Their
+// value is the message packed into a serialized google.protobuf.Any, so it
+// carries the type URL the message is decoded with from the protobuf registry,
+// also when it was sent by a producer written in another language.
+const ProtoType = "proto"
+
+var protoMessageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// NewProtoArg creates an arg holding the protobuf message, the task receives
+// it as its generated type, e.g. *pb.Order
+func NewProtoArg(message proto.Message) (Arg, error) {
+	encoded, err := marshalProto(message)
+	if err != nil {
+		return Arg{}, err
+	}
+	return Arg{Type: ProtoType, Value: encoded}, nil
+}
+
+// marshalProto packs the message into a serialized google.protobuf.Any
+func marshalProto(message proto.Message) ([]byte, error) {
+	packed, err := anypb.New(message)
+	if err != nil {
+		return nil, fmt.Errorf("Pack protobuf message error: %s", err)
+	}
+	return proto.Marshal(packed)
+}
+
+// reflectProtoValue decodes the message packed by marshalProto, its type is
+// looked up in the protobuf registry by the type URL
+func reflectProtoValue(value interface{}) (reflect.Value, error) {
+	var encoded []byte
+	switch v := value.(type) {
+	case []byte:
+		encoded = v
+	case string:
+		// JSON encodes []byte as a base64 string
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		encoded = decoded
+	default:
+		return reflect.Value{}, typeConversionError(value, ProtoType)
+	}
+
+	packed := new(anypb.Any)
+	if err := proto.Unmarshal(encoded, packed); err != nil {
+		return reflect.Value{}, fmt.Errorf("Unmarshal protobuf message error: %s", err)
+	}
+	message, err := packed.UnmarshalNew()
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("Unpack protobuf message %s error: %s", packed.GetTypeUrl(), err)
+	}
+	return reflect.ValueOf(message), nil
+}
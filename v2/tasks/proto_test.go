@@ -0,0 +1,56 @@
+package tasks_test
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestProtoArg(t *testing.T) {
+	t.Parallel()
+
+	message := timestamppb.New(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	arg, err := tasks.NewProtoArg(message)
+	require.NoError(t, err)
+	assert.Equal(t, tasks.ProtoType, arg.Type)
+
+	// The arg is decoded from its raw bytes and from base64 as sent in JSON
+	for _, value := range []interface{}{arg.Value, base64.StdEncoding.EncodeToString(arg.Value.([]byte))} {
+		decoded, err := tasks.ReflectValue(arg.Type, value)
+		if assert.NoError(t, err) {
+			assert.True(t, proto.Equal(message, decoded.Interface().(*timestamppb.Timestamp)))
+		}
+	}
+}
+
+func TestProtoTaskResult(t *testing.T) {
+	t.Parallel()
+
+	arg, err := tasks.NewProtoArg(timestamppb.New(time.Unix(1577934245, 0)))
+	require.NoError(t, err)
+	signature := &tasks.Signature{Name: "next_day", Args: []tasks.Arg{arg}}
+
+	task, err := tasks.NewWithSignature(func(ctx context.Context, ts *timestamppb.Timestamp) (*timestamppb.Timestamp, error) {
+		return timestamppb.New(ts.AsTime().Add(24 * time.Hour)), nil
+	}, signature)
+	require.NoError(t, err)
+
+	taskResults, err := task.Call()
+	require.NoError(t, err)
+	if assert.Len(t, taskResults, 1) {
+		assert.Equal(t, tasks.ProtoType, taskResults[0].Type)
+	}
+
+	results, err := tasks.ReflectTaskResults(taskResults)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(1578020645), results[0].Interface().(*timestamppb.Timestamp).GetSeconds())
+	}
+}
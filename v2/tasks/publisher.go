@@ -0,0 +1,59 @@
+package tasks
+
+import "context"
+
+// SendFunc sends a task, it is implemented by the server
+type SendFunc func(ctx context.Context, signature *Signature) error
+
+// Publisher sends child tasks from a running task, their ParentUUID is set
+// to the UUID of the running task
+type Publisher struct {
+	parent *Signature
+	send   SendFunc
+}
+
+type publisherCtxType struct{}
+
+var publisherCtx publisherCtxType
+
+// NewPublisher creates Publisher instance sending children of the parent task
+func NewPublisher(parent *Signature, send SendFunc) *Publisher {
+	return &Publisher{
+		parent: parent,
+		send:   send,
+	}
+}
+
+// ContextWithPublisher returns a copy of ctx carrying the publisher
+func ContextWithPublisher(ctx context.Context, publisher *Publisher) context.Context {
+	return context.WithValue(ctx, publisherCtx, publisher)
+}
+
+// PublisherFromContext gets the publisher from the context of a running task,
+// nil if the task is not run by a worker
+func PublisherFromContext(ctx context.Context) *Publisher {
+	if ctx == nil {
+		return nil
+	}
+
+	publisher, _ := ctx.Value(publisherCtx).(*Publisher)
+	return publisher
+}
+
+// Parent returns the signature of the running task
+func (p *Publisher) Parent() *Signature {
+	return p.parent
+}
+
+// Send sends the task as a child of the running task, its UUID is set once
+// it has been sent
+func (p *Publisher) Send(signature *Signature) error {
+	return p.SendWithContext(context.Background(), signature)
+}
+
+// SendWithContext is the same as Send but passes ctx to the server, e.g.
+// to propagate the trace of the running task
+func (p *Publisher) SendWithContext(ctx context.Context, signature *Signature) error {
+	signature.ParentUUID = p.parent.UUID
+	return p.send(ctx, signature)
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 )
@@ -68,6 +69,10 @@ func (e ErrUnsupportedType) Error() string {
 
 // ReflectValue converts interface{} to reflect.Value based on string type
 func ReflectValue(valueType string, value interface{}) (reflect.Value, error) {
+	if valueType == ProtoType {
+		return reflectProtoValue(value)
+	}
+
 	if strings.HasPrefix(valueType, "[]") {
 		return reflectValues(valueType, value)
 	}
@@ -279,12 +284,17 @@ func getIntValue(theType string, value interface{}) (int64, error) {
 		return n.Int64()
 	}
 
-	n, ok := value.(int64)
-	if !ok {
-		return 0, typeConversionError(value, typesMap[theType].String())
+	switch value := value.(type) {
+	case int64:
+		return value, nil
+	case uint64:
+		// Binary codecs, e.g. CBOR, decode non-negative integers as uint64
+		if value > math.MaxInt64 {
+			return 0, typeConversionError(value, typesMap[theType].String())
+		}
+		return int64(value), nil
 	}
-
-	return n, nil
+	return 0, typeConversionError(value, typesMap[theType].String())
 }
 
 func getUintValue(theType string, value interface{}) (uint64, error) {
@@ -311,6 +321,11 @@ func getUintValue(theType string, value interface{}) (uint64, error) {
 		n = value
 	case uint8:
 		n = uint64(value)
+	case int64:
+		if value < 0 {
+			return 0, typeConversionError(value, typesMap[theType].String())
+		}
+		n = uint64(value)
 	default:
 		return 0, typeConversionError(value, typesMap[theType].String())
 	}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+
+	"google.golang.org/protobuf/proto"
 )
 
 // TaskResult represents an actual return value of a processed task
@@ -12,6 +14,23 @@ type TaskResult struct {
 	Value interface{} `bson:"value"`
 }
 
+// newTaskResult creates a result holding the value, protobuf messages are
+// packed with their type URL
+func newTaskResult(value interface{}) (*TaskResult, error) {
+	if message, ok := value.(proto.Message); ok {
+		encoded, err := marshalProto(message)
+		if err != nil {
+			return nil, err
+		}
+		return &TaskResult{Type: ProtoType, Value: encoded}, nil
+	}
+
+	return &TaskResult{
+		Type:  reflect.TypeOf(value).String(),
+		Value: value,
+	}, nil
+}
+
 // ReflectTaskResults ...
 func ReflectTaskResults(taskResults []*TaskResult) ([]reflect.Value, error) {
 	resultValues := make([]reflect.Value, len(taskResults))
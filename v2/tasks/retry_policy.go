@@ -0,0 +1,61 @@
+package tasks
+
+import (
+	"errors"
+
+	"github.com/RichardKnop/machinery/v2/retry"
+)
+
+// RetryPolicy is the default retry behaviour of a task, attached to it when
+// it is registered so producers do not have to set it on every signature
+type RetryPolicy struct {
+	// MaxRetries is the number of retries of a task whose signature does not
+	// set RetryCount
+	MaxRetries int
+	// Backoff spaces out the retries unless the signature names a
+	// RetryStrategy, Fibonacci when nil
+	Backoff retry.Strategy
+	// RetryableErrors are the errors the task is retried on, matched with
+	// errors.Is
+	RetryableErrors []error
+	// RetryIf decides whether the task is retried on the error, e.g. on
+	// errors of a type with IsErrorType. The task is retried on errors
+	// matching either RetryableErrors or RetryIf, on all errors when neither
+	// is set.
+	RetryIf func(err error) bool
+}
+
+// IsRetryable returns true if the task is retried when it fails with the
+// error
+func (p *RetryPolicy) IsRetryable(err error) bool {
+	if len(p.RetryableErrors) == 0 && p.RetryIf == nil {
+		return true
+	}
+
+	for _, retryable := range p.RetryableErrors {
+		if errors.Is(err, retryable) {
+			return true
+		}
+	}
+	return p.RetryIf != nil && p.RetryIf(err)
+}
+
+// IsErrorType returns true if the error or an error it wraps is of type E,
+// e.g. IsErrorType[*net.OpError] as the RetryIf of a retry policy
+func IsErrorType[E error](err error) bool {
+	var target E
+	return errors.As(err, &target)
+}
+
+// AnyErrorType returns a predicate matching errors matched by any of the
+// predicates, e.g. by IsErrorType of several types
+func AnyErrorType(predicates ...func(err error) bool) func(err error) bool {
+	return func(err error) bool {
+		for _, predicate := range predicates {
+			if predicate(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
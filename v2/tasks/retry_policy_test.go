@@ -0,0 +1,37 @@
+package tasks_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestRetryPolicyIsRetryable(t *testing.T) {
+	t.Parallel()
+
+	errUnavailable := errors.New("unavailable")
+	opErr := &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+	dnsErr := &net.DNSError{Err: "no such host"}
+	invalid := errors.New("invalid request")
+
+	policy := new(tasks.RetryPolicy)
+	assert.True(t, policy.IsRetryable(invalid))
+
+	policy = &tasks.RetryPolicy{RetryableErrors: []error{errUnavailable}}
+	assert.True(t, policy.IsRetryable(fmt.Errorf("charge: %w", errUnavailable)))
+	assert.False(t, policy.IsRetryable(invalid))
+
+	policy = &tasks.RetryPolicy{
+		RetryableErrors: []error{errUnavailable},
+		RetryIf:         tasks.AnyErrorType(tasks.IsErrorType[*net.OpError], tasks.IsErrorType[*net.DNSError]),
+	}
+	assert.True(t, policy.IsRetryable(errUnavailable))
+	assert.True(t, policy.IsRetryable(fmt.Errorf("charge: %w", opErr)))
+	assert.True(t, policy.IsRetryable(dnsErr))
+	assert.False(t, policy.IsRetryable(invalid))
+}
@@ -0,0 +1,146 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/scheduler"
+)
+
+// Kinds of what a schedule sends
+const (
+	ScheduleTask  = "task"
+	ScheduleChain = "chain"
+	ScheduleGroup = "group"
+	ScheduleChord = "chord"
+)
+
+// DefaultRunningTTL is how long a run of a schedule skipping runs while it is
+// running is considered running at most when its RunningTTL is zero
+const DefaultRunningTTL = 24 * time.Hour
+
+// Policies of schedules for the runs missed while no server was sending them
+const (
+	// CatchUpSkip skips the missed runs
+	CatchUpSkip = "skip"
+	// CatchUpOnce sends a single run for all the missed runs
+	CatchUpOnce = "once"
+	// CatchUpAll sends each missed run
+	CatchUpAll = "all"
+)
+
+// Schedule is a periodic task, chain, group or chord, stored so it survives
+// restarts and can be changed at runtime by any server
+type Schedule struct {
+	// Name identifies the schedule, runs of a schedule with the same name and
+	// spec are sent once across servers
+	Name string
+	// Spec is the cron spec of the runs, or another spec of scheduler.Parse,
+	// it may start with CRON_TZ= and the name of its time zone, e.g.
+	// CRON_TZ=Europe/Berlin 0 9 * * *
+	Spec string
+	// Runs are used instead of the spec to tell when runs are due, e.g. for
+	// calendar rules which have no spec, such schedules cannot be stored
+	Runs scheduler.Schedule `json:"-"`
+	// Timezone is the IANA name of the time zone of the spec when it has no
+	// CRON_TZ= prefix, e.g. Europe/Berlin or the String of a time.Location
+	// loaded with time.LoadLocation, the local time zone when empty
+	Timezone string
+	// Kind is what is sent on each run, a task by default
+	Kind string
+	// Signatures are the task, the tasks of the chain or of the group
+	Signatures []*Signature
+	// Callback is the callback of a chord
+	Callback *Signature
+	// Jitter delays each run by a random duration up to it, so runs of many
+	// schedules with the same spec are spread instead of all being sent at
+	// once, it should be shorter than the time between runs
+	Jitter time.Duration
+	// CatchUp is the policy for the runs missed while no server was sending
+	// them, e.g. because all servers were down, CatchUpSkip when empty. The
+	// last run of schedules catching up is recorded in the result backend.
+	CatchUp string
+	// SkipIfRunning skips runs while the tasks sent by the previous run have
+	// not finished, e.g. for long jobs which would pile up otherwise
+	SkipIfRunning bool
+	// RunningTTL is how long a run is considered running at most, e.g. when
+	// the server waiting for its tasks died, DefaultRunningTTL when zero
+	RunningTTL time.Duration
+	// SendConcurrency limits how many tasks of a group or chord are sent at
+	// once, all of them when it is zero
+	SendConcurrency int
+	// UpdatedAt is when the schedule was saved for the last time
+	UpdatedAt time.Time
+}
+
+// Validate checks the schedule has a name, the signatures its kind needs, a
+// known catch up policy, no negative jitter and a known time zone
+func (schedule *Schedule) Validate() error {
+	if schedule.Name == "" {
+		return errors.New("Name of the schedule is required")
+	}
+	if len(schedule.Signatures) == 0 {
+		return fmt.Errorf("Schedule %s has no signatures", schedule.Name)
+	}
+
+	switch schedule.Kind {
+	case "", ScheduleTask:
+		if len(schedule.Signatures) != 1 {
+			return fmt.Errorf("Schedule %s of a task has %d signatures", schedule.Name, len(schedule.Signatures))
+		}
+	case ScheduleChain, ScheduleGroup:
+	case ScheduleChord:
+		if schedule.Callback == nil {
+			return fmt.Errorf("Schedule %s of a chord has no callback", schedule.Name)
+		}
+	default:
+		return fmt.Errorf("Schedule %s has unknown kind %s", schedule.Name, schedule.Kind)
+	}
+
+	switch schedule.CatchUp {
+	case "", CatchUpSkip, CatchUpOnce, CatchUpAll:
+	default:
+		return fmt.Errorf("Schedule %s has unknown catch up policy %s", schedule.Name, schedule.CatchUp)
+	}
+	if schedule.Jitter < 0 {
+		return fmt.Errorf("Schedule %s has negative jitter %s", schedule.Name, schedule.Jitter)
+	}
+	if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+		return fmt.Errorf("Schedule %s has unknown time zone %s", schedule.Name, schedule.Timezone)
+	}
+	return nil
+}
+
+// GetRunningTTL returns how long a run is considered running at most
+func (schedule *Schedule) GetRunningTTL() time.Duration {
+	if schedule.RunningTTL > 0 {
+		return schedule.RunningTTL
+	}
+	return DefaultRunningTTL
+}
+
+// CatchesUp returns whether missed runs of the schedule are sent
+func (schedule *Schedule) CatchesUp() bool {
+	return schedule.CatchUp == CatchUpOnce || schedule.CatchUp == CatchUpAll
+}
+
+// CronSpec returns the spec prefixed with CRON_TZ= and the time zone of the
+// schedule, unless it has no time zone or the spec has its own
+func (schedule *Schedule) CronSpec() string {
+	if schedule.Timezone == "" || strings.HasPrefix(schedule.Spec, "CRON_TZ=") || strings.HasPrefix(schedule.Spec, "TZ=") {
+		return schedule.Spec
+	}
+	return fmt.Sprintf("CRON_TZ=%s %s", schedule.Timezone, schedule.Spec)
+}
+
+// CopySchedule copies the schedule and its signatures
+func CopySchedule(schedule *Schedule) *Schedule {
+	copied := *schedule
+	copied.Signatures = CopySignatures(schedule.Signatures...)
+	if schedule.Callback != nil {
+		copied.Callback = CopySignature(schedule.Callback)
+	}
+	return &copied
+}
@@ -0,0 +1,51 @@
+package tasks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestScheduleValidate(t *testing.T) {
+	t.Parallel()
+
+	schedule := &tasks.Schedule{
+		Name:       "report",
+		Spec:       "0 9 * * *",
+		Timezone:   "Europe/Berlin",
+		Signatures: []*tasks.Signature{{Name: "send_report"}},
+	}
+	assert.NoError(t, schedule.Validate())
+
+	schedule.Timezone = "Nowhere/City"
+	assert.EqualError(t, schedule.Validate(), "Schedule report has unknown time zone Nowhere/City")
+
+	schedule.Timezone = ""
+	schedule.Jitter = -time.Second
+	assert.EqualError(t, schedule.Validate(), "Schedule report has negative jitter -1s")
+
+	schedule.Jitter = 0
+	schedule.CatchUp = "twice"
+	assert.EqualError(t, schedule.Validate(), "Schedule report has unknown catch up policy twice")
+
+	schedule.CatchUp = tasks.CatchUpAll
+	schedule.Kind = tasks.ScheduleChord
+	assert.EqualError(t, schedule.Validate(), "Schedule report of a chord has no callback")
+}
+
+func TestScheduleCronSpec(t *testing.T) {
+	t.Parallel()
+
+	schedule := &tasks.Schedule{Spec: "0 9 * * *"}
+	assert.Equal(t, "0 9 * * *", schedule.CronSpec())
+
+	schedule.Timezone = "Europe/Berlin"
+	assert.Equal(t, "CRON_TZ=Europe/Berlin 0 9 * * *", schedule.CronSpec())
+
+	// The time zone of the spec takes precedence
+	schedule.Spec = "CRON_TZ=America/New_York 0 9 * * *"
+	assert.Equal(t, "CRON_TZ=America/New_York 0 9 * * *", schedule.CronSpec())
+}
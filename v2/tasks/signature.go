@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"fmt"
+	"github.com/RichardKnop/machinery/v2/retry"
 	"github.com/RichardKnop/machinery/v2/utils"
 	"time"
 
@@ -59,6 +60,48 @@ type Signature struct {
 	OnSuccess      []*Signature
 	OnError        []*Signature
 	ChordCallback  *Signature
+	// DAG is set on tasks of a DAG sent by the server or workers
+	DAG *DAGMeta
+	// Branches are the tasks a decider task chooses from by the branch name
+	// it returns as its first result
+	Branches map[string]*Signature
+	// CompensateWith is the task undoing the task when a later task of its saga
+	// fails permanently
+	CompensateWith *Signature
+	// SagaUUID is set on tasks of a chain with compensation tasks
+	SagaUUID string
+	// Compensations undo the succeeded tasks of the saga, latest first, they
+	// are passed along the chain by workers
+	Compensations []*Signature
+	// ParentUUID is set on tasks sent by a running task through its publisher
+	ParentUUID string
+	// TimeoutSeconds limits how long the task may run, its context is then
+	// done and it fails with ErrTaskTimedOut, no limit when zero
+	TimeoutSeconds int
+	// IdempotencyKey identifies the task across sends, sending a task with the
+	// key of a task sent within the idempotency window returns the result of
+	// the sent task instead
+	IdempotencyKey string
+	// UniqueTTL makes the task unique, it is not sent while a task with the
+	// same name and args is queued or running, for at most the TTL
+	UniqueTTL time.Duration
+	// Broadcast is set on tasks sent to every worker by Server.SendBroadcast,
+	// they are not retried and dropped by workers which did not register them
+	Broadcast bool
+	// RetryStrategy names the retry.Strategy spacing out retries of the task,
+	// the strategy the task was registered with or Fibonacci when empty
+	RetryStrategy string
+	// RetryAttempt counts the retries of the task so far
+	RetryAttempt int
+	// Failures are the failed attempts of the task, kept across retries so
+	// tasks moved to a dead letter queue carry their failure history
+	Failures []*Failure
+	// ReplayOf is the UUID of the failed task this task replays, see
+	// Server.ReplayTask
+	ReplayOf string
+	// PassPartialResults passes the results the task emitted with EmitResult
+	// to its success callbacks and chord callback, before its return values
+	PassPartialResults bool
 	//MessageGroupId for Broker, e.g. SQS
 	BrokerMessageGroupId string
 	//ReceiptHandle of SQS Message
@@ -71,14 +114,41 @@ type Signature struct {
 	IgnoreWhenTaskNotRegistered bool
 }
 
+// NextRetryDelay counts a retry of the task and returns the delay before it
+// given by the strategy, RetryTimeout is set to the delay in seconds
+func (signature *Signature) NextRetryDelay(strategy retry.Strategy) time.Duration {
+	signature.RetryAttempt++
+	delay := strategy(signature.RetryAttempt, time.Duration(signature.RetryTimeout)*time.Second)
+	signature.RetryTimeout = int(delay / time.Second)
+	return delay
+}
+
+// ContinueSaga passes the saga of the succeeded task to the next task, the
+// compensation of the task is run first if the saga fails
+func (signature *Signature) ContinueSaga(next *Signature) {
+	if signature.SagaUUID == "" {
+		return
+	}
+
+	next.SagaUUID = signature.SagaUUID
+	next.Compensations = signature.Compensations
+	if signature.CompensateWith != nil {
+		next.Compensations = append([]*Signature{signature.CompensateWith}, signature.Compensations...)
+	}
+}
+
 // NewSignature creates a new task signature
-func NewSignature(name string, args []Arg) (*Signature, error) {
+func NewSignature(name string, args []Arg, opts ...SignatureOption) (*Signature, error) {
 	signatureID := uuid.New().String()
-	return &Signature{
+	signature := &Signature{
 		UUID: fmt.Sprintf("task_%v", signatureID),
 		Name: name,
 		Args: args,
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(signature)
+	}
+	return signature, nil
 }
 
 func CopySignatures(signatures ...*Signature) []*Signature {
@@ -15,6 +15,8 @@ const (
 	StateSuccess = "SUCCESS"
 	// StateFailure - when processing of the task fails
 	StateFailure = "FAILURE"
+	// StateCanceled - when the task has been canceled before it finished
+	StateCanceled = "CANCELED"
 )
 
 // TaskState represents a state of a task
@@ -92,10 +94,19 @@ func NewRetryTaskState(signature *Signature) *TaskState {
 	}
 }
 
-// IsCompleted returns true if state is SUCCESS or FAILURE,
-// i.e. the task has finished processing and either succeeded or failed.
+// NewCanceledTaskState ...
+func NewCanceledTaskState(signature *Signature) *TaskState {
+	return &TaskState{
+		TaskUUID: signature.UUID,
+		State:    StateCanceled,
+	}
+}
+
+// IsCompleted returns true if state is SUCCESS, FAILURE or CANCELED,
+// i.e. the task has finished processing and either succeeded, failed or
+// has been canceled.
 func (taskState *TaskState) IsCompleted() bool {
-	return taskState.IsSuccess() || taskState.IsFailure()
+	return taskState.IsSuccess() || taskState.IsFailure() || taskState.IsCanceled()
 }
 
 // IsSuccess returns true if state is SUCCESS
@@ -107,3 +118,8 @@ func (taskState *TaskState) IsSuccess() bool {
 func (taskState *TaskState) IsFailure() bool {
 	return taskState.State == StateFailure
 }
+
+// IsCanceled returns true if state is CANCELED
+func (taskState *TaskState) IsCanceled() bool {
+	return taskState.State == StateCanceled
+}
@@ -28,4 +28,8 @@ func TestTaskStateIsCompleted(t *testing.T) {
 
 	taskState.State = tasks.StateFailure
 	assert.True(t, taskState.IsCompleted())
+
+	taskState.State = tasks.StateCanceled
+	assert.True(t, taskState.IsCompleted())
+	assert.True(t, taskState.IsCanceled())
 }
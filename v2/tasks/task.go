@@ -17,6 +17,9 @@ import (
 // ErrTaskPanicked ...
 var ErrTaskPanicked = errors.New("Invoking task caused a panic")
 
+// ErrTaskTimedOut is returned when a task runs longer than its timeout
+var ErrTaskTimedOut = errors.New("Task timed out")
+
 // Task wraps a signature and methods used to reflect task arguments and
 // return values after invoking the task
 type Task struct {
@@ -108,26 +111,20 @@ func (t *Task) Call() (taskResults []*TaskResult, err error) {
 	defer func() {
 		// Recover from panic and set err.
 		if e := recover(); e != nil {
-			switch e := e.(type) {
-			default:
-				err = ErrTaskPanicked
-			case error:
-				err = e
-			case string:
-				err = errors.New(e)
-			}
+			panicked := NewErrPanicked(e, debug.Stack())
+			err = panicked
 
 			// mark the span as failed and dump the error and stack trace to the span
 			if span := opentracing.SpanFromContext(t.Context); span != nil {
 				opentracing_ext.Error.Set(span, true)
 				span.LogFields(
 					opentracing_log.Error(err),
-					opentracing_log.Object("stack", string(debug.Stack())),
+					opentracing_log.Object("stack", panicked.Stack),
 				)
 			}
 
 			// Print stack trace
-			log.ERROR.Printf("%s", debug.Stack())
+			log.ERROR.Printf("%s", panicked.Stack)
 		}
 	}()
 
@@ -173,11 +170,9 @@ func (t *Task) Call() (taskResults []*TaskResult, err error) {
 	// Convert reflect values to task results
 	taskResults = make([]*TaskResult, len(results)-1)
 	for i := 0; i < len(results)-1; i++ {
-		val := results[i].Interface()
-		typeStr := reflect.TypeOf(val).String()
-		taskResults[i] = &TaskResult{
-			Type:  typeStr,
-			Value: val,
+		taskResults[i], err = newTaskResult(results[i].Interface())
+		if err != nil {
+			return nil, err
 		}
 	}
 
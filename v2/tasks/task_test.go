@@ -3,6 +3,7 @@ package tasks_test
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"testing"
 	"time"
@@ -38,6 +39,41 @@ func TestTaskCallErrorTest(t *testing.T) {
 	assert.Nil(t, results)
 	assert.NotNil(t, err)
 	assert.Equal(t, "some error", err.Error())
+
+	// Create test task that returns a non-retryable error
+	nonRetryable := func() error { return tasks.NewErrNonRetryable(errors.New("invalid card")) }
+
+	task, err = tasks.New(nonRetryable, []tasks.Arg{})
+	assert.NoError(t, err)
+
+	// Invoke TryCall and validate that returned error is non-retryable
+	results, err = task.Call()
+	assert.Nil(t, results)
+	assert.True(t, tasks.IsNonRetryable(err))
+	assert.True(t, tasks.IsNonRetryable(fmt.Errorf("charge: %w", err)))
+	assert.Equal(t, "invalid card", err.Error())
+
+	// Create test task that panics
+	panicking := func() error { panic(42) }
+
+	task, err = tasks.New(panicking, []tasks.Arg{})
+	assert.NoError(t, err)
+
+	// Invoke TryCall and validate that the recovered value and the stack are kept
+	results, err = task.Call()
+	assert.Nil(t, results)
+	assert.True(t, errors.Is(err, tasks.ErrTaskPanicked))
+	var panicked tasks.ErrPanicked
+	if assert.True(t, errors.As(err, &panicked)) {
+		assert.Equal(t, 42, panicked.Value)
+		assert.Contains(t, panicked.Stack, "panic")
+	}
+
+	failure := tasks.NewFailure(&tasks.Signature{RetryAttempt: 1}, err, time.Now())
+	assert.Equal(t, 2, failure.Attempt)
+	assert.Equal(t, tasks.ErrTaskPanicked.Error(), failure.Error)
+	assert.Equal(t, "int", failure.ErrorType)
+	assert.Equal(t, panicked.Stack, failure.Stack)
 }
 
 func TestTaskReflectArgs(t *testing.T) {
@@ -0,0 +1,33 @@
+package tasks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SignatureOption configures optional features of a signature
+type SignatureOption func(*Signature)
+
+// WithUnique makes the task unique, it is not sent while a task with the same
+// name and args is queued or running. The lock of a task whose worker stopped
+// while running it expires after the TTL.
+func WithUnique(ttl time.Duration) SignatureOption {
+	return func(signature *Signature) {
+		signature.UniqueTTL = ttl
+	}
+}
+
+// UniqueKey returns the name of the lock of a unique task, derived from its
+// name and a hash of its args
+func (signature *Signature) UniqueKey() (string, error) {
+	encoded, err := json.Marshal(signature.Args)
+	if err != nil {
+		return "", fmt.Errorf("Marshal args of task %s error: %s", signature.Name, err)
+	}
+
+	hash := sha256.Sum256(encoded)
+	return fmt.Sprintf("machinery_unique:%s:%s", signature.Name, hex.EncodeToString(hash[:])), nil
+}
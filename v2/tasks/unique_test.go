@@ -0,0 +1,37 @@
+package tasks_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+func TestUniqueKey(t *testing.T) {
+	t.Parallel()
+
+	signature, err := tasks.NewSignature("sync", []tasks.Arg{{Type: "string", Value: "account-1"}}, tasks.WithUnique(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, signature.UniqueTTL)
+
+	same, err := tasks.NewSignature("sync", []tasks.Arg{{Type: "string", Value: "account-1"}})
+	assert.NoError(t, err)
+	other, err := tasks.NewSignature("sync", []tasks.Arg{{Type: "string", Value: "account-2"}})
+	assert.NoError(t, err)
+
+	key, err := signature.UniqueKey()
+	assert.NoError(t, err)
+	sameKey, err := same.UniqueKey()
+	assert.NoError(t, err)
+	otherKey, err := other.UniqueKey()
+	assert.NoError(t, err)
+
+	assert.Equal(t, key, sameKey)
+	assert.NotEqual(t, key, otherKey)
+
+	other.Args = []tasks.Arg{{Type: "func", Value: func() {}}}
+	_, err = other.UniqueKey()
+	assert.Error(t, err)
+}
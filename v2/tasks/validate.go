@@ -2,6 +2,7 @@ package tasks
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
 )
 
@@ -40,3 +41,73 @@ func ValidateTask(task interface{}) error {
 
 	return nil
 }
+
+// ArgsValidator checks the args of a task before it is sent, see
+// MatchArgs for a validator checking them against the task function
+type ArgsValidator func(args []Arg) error
+
+// ErrInvalidArgs is returned when a task is sent with args rejected by the
+// validator it was registered with
+type ErrInvalidArgs struct {
+	TaskName string
+	Err      error
+}
+
+// Error implements the error interface
+func (e ErrInvalidArgs) Error() string {
+	return fmt.Sprintf("Invalid args of task %s: %s", e.TaskName, e.Err)
+}
+
+// Unwrap returns the error of the validator
+func (e ErrInvalidArgs) Unwrap() error {
+	return e.Err
+}
+
+// MatchArgs returns a validator checking the args are as many as the
+// parameters of the task function, apart from its context, and that their
+// types are the types of the parameters
+func MatchArgs(taskFunc interface{}) ArgsValidator {
+	t := reflect.TypeOf(taskFunc)
+
+	var params []reflect.Type
+	for i := 0; i < t.NumIn(); i++ {
+		if i == 0 && IsContextType(t.In(i)) {
+			continue
+		}
+		params = append(params, t.In(i))
+	}
+
+	return func(args []Arg) error {
+		if t.IsVariadic() {
+			if len(args) < len(params)-1 {
+				return fmt.Errorf("got %d args, want at least %d", len(args), len(params)-1)
+			}
+		} else if len(args) != len(params) {
+			return fmt.Errorf("got %d args, want %d", len(args), len(params))
+		}
+
+		for i, arg := range args {
+			var param reflect.Type
+			if t.IsVariadic() && i >= len(params)-1 {
+				param = params[len(params)-1].Elem()
+			} else {
+				param = params[i]
+			}
+
+			if arg.Type == ProtoType {
+				if !param.Implements(protoMessageType) {
+					return fmt.Errorf("arg %d is a protobuf message, want %s", i, param)
+				}
+				continue
+			}
+			argType, ok := typesMap[arg.Type]
+			if !ok {
+				return fmt.Errorf("arg %d: %s", i, NewErrUnsupportedType(arg.Type))
+			}
+			if !argType.AssignableTo(param) {
+				return fmt.Errorf("arg %d is %s, want %s", i, argType, param)
+			}
+		}
+		return nil
+	}
+}
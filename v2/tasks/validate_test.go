@@ -1,6 +1,7 @@
 package tasks_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/RichardKnop/machinery/v2/tasks"
@@ -30,3 +31,22 @@ func TestValidateTask(t *testing.T) {
 	err = tasks.ValidateTask(validTask)
 	assert.NoError(t, err)
 }
+
+func TestMatchArgs(t *testing.T) {
+	t.Parallel()
+
+	validate := tasks.MatchArgs(func(ctx context.Context, name string, sizes ...int64) error { return nil })
+
+	assert.NoError(t, validate([]tasks.Arg{{Type: "string", Value: "a"}}))
+	assert.NoError(t, validate([]tasks.Arg{
+		{Type: "string", Value: "a"},
+		{Type: "int64", Value: 1},
+		{Type: "int64", Value: 2},
+	}))
+	assert.EqualError(t, validate(nil), "got 0 args, want at least 1")
+	assert.EqualError(t, validate([]tasks.Arg{{Type: "int64", Value: 1}}), "arg 0 is int64, want string")
+	assert.EqualError(t, validate([]tasks.Arg{{Type: "string", Value: "a"}, {Type: "uuid", Value: "b"}}), "arg 1: uuid is not one of supported types")
+
+	validate = tasks.MatchArgs(func(a, b int64) (int64, error) { return a + b, nil })
+	assert.EqualError(t, validate([]tasks.Arg{{Type: "int64", Value: 1}}), "got 1 args, want 2")
+}
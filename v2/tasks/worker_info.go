@@ -0,0 +1,33 @@
+package tasks
+
+import (
+	"time"
+)
+
+// WorkerInfo describes a worker registered in the result backend
+type WorkerInfo struct {
+	// ID identifies the worker, it is unique even for workers sharing a
+	// consumer tag
+	ID          string
+	ConsumerTag string
+	Hostname    string
+	PID         int
+	// Queues are the queues the worker consumes from
+	Queues []string
+	// Concurrency is the number of tasks the worker processes at once, 0 if
+	// it is only limited by the broker
+	Concurrency int
+	// Version is the version of the application running the worker
+	Version   string
+	StartedAt time.Time
+	// HeartbeatAt is the time the worker was last registered
+	HeartbeatAt time.Time
+	// Running is the number of tasks the worker was running
+	Running int
+	// Succeeded and Failed count the tasks the worker completed since it
+	// started, e.g. to compute the throughput of workers
+	Succeeded int64
+	Failed    int64
+	Paused    bool
+	Draining  bool
+}
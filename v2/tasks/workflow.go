@@ -6,9 +6,16 @@ import (
 	"github.com/google/uuid"
 )
 
+// ItemArgType is the type of a placeholder argument of a mapper task, it is
+// replaced by the item the task is mapped over
+const ItemArgType = "machinery_item"
+
 // Chain creates a chain of tasks to be executed one after another
 type Chain struct {
 	Tasks []*Signature
+	// SagaUUID is the group compensation tasks are run in when a task with
+	// compensation tasks before it fails, empty if there are none
+	SagaUUID string
 }
 
 // Group creates a set of tasks to be executed in parallel
@@ -52,9 +59,49 @@ func NewChain(signatures ...*Signature) (*Chain, error) {
 
 	chain := &Chain{Tasks: signatures}
 
+	// Tasks with compensation tasks make the chain a saga, the compensation
+	// task UUIDs are known upfront to look their states up
+	for _, signature := range signatures {
+		if signature.CompensateWith == nil {
+			continue
+		}
+		if signature.CompensateWith.UUID == "" {
+			signature.CompensateWith.UUID = fmt.Sprintf("compensation_%v", uuid.New().String())
+		}
+		if chain.SagaUUID == "" {
+			chain.SagaUUID = fmt.Sprintf("saga_%v", uuid.New().String())
+		}
+	}
+	if chain.SagaUUID != "" {
+		for _, signature := range signatures {
+			signature.SagaUUID = chain.SagaUUID
+		}
+	}
+
 	return chain, nil
 }
 
+// NewConditionalChain creates a new chain of tasks ending with a decider task
+// which chooses the branch continuing the chain. The decider returns the name
+// of the branch as its first result, its other results are passed to the first
+// task of the branch unless it is immutable. A name without a branch ends the
+// chain. Branches may end with decider tasks themselves.
+func NewConditionalChain(decider *Signature, branches map[string]*Chain, signatures ...*Signature) (*Chain, error) {
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("Conditional chain has no branches")
+	}
+
+	decider.Branches = make(map[string]*Signature, len(branches))
+	for name, branch := range branches {
+		if branch == nil || len(branch.Tasks) == 0 {
+			return nil, fmt.Errorf("Branch %s of conditional chain has no tasks", name)
+		}
+		decider.Branches[name] = branch.Tasks[0]
+	}
+
+	return NewChain(append(signatures, decider)...)
+}
+
 // NewGroup creates a new group of tasks to be processed in parallel
 func NewGroup(signatures ...*Signature) (*Group, error) {
 	// Generate a group UUID
@@ -93,3 +140,43 @@ func NewChord(group *Group, callback *Signature) (*Chord, error) {
 
 	return &Chord{Group: group, Callback: callback}, nil
 }
+
+// NewMapReduce creates a new chord mapping the mapper task over the items in
+// parallel and passing the results to the reducer task. Arguments of the mapper
+// of type ItemArgType are replaced by the item, keeping their name unless the
+// item has one, the item is appended when there are none.
+func NewMapReduce(mapper *Signature, items []Arg, reducer *Signature) (*Chord, error) {
+	if len(items) == 0 {
+		return nil, fmt.Errorf("Map/reduce has no items")
+	}
+
+	signatures := make([]*Signature, len(items))
+	for i, item := range items {
+		signature := CopySignature(mapper)
+		signature.UUID = ""
+
+		replaced := false
+		for j, arg := range signature.Args {
+			if arg.Type != ItemArgType {
+				continue
+			}
+			value := item
+			if value.Name == "" {
+				value.Name = arg.Name
+			}
+			signature.Args[j] = value
+			replaced = true
+		}
+		if !replaced {
+			signature.Args = append(signature.Args, item)
+		}
+
+		signatures[i] = signature
+	}
+
+	group, err := NewGroup(signatures...)
+	if err != nil {
+		return nil, err
+	}
+	return NewChord(group, reducer)
+}
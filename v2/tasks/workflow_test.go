@@ -59,3 +59,111 @@ func TestNewChain(t *testing.T) {
 	assert.Equal(t, "bar", firstTask.OnSuccess[0].Name)
 	assert.Equal(t, "qux", firstTask.OnSuccess[0].OnSuccess[0].Name)
 }
+
+func TestNewConditionalChain(t *testing.T) {
+	t.Parallel()
+
+	even, err := tasks.NewChain(&tasks.Signature{Name: "half"}, &tasks.Signature{Name: "print"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	odd, err := tasks.NewChain(&tasks.Signature{Name: "triple"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decider := &tasks.Signature{Name: "parity"}
+	chain, err := tasks.NewConditionalChain(decider, map[string]*tasks.Chain{"even": even, "odd": odd}, &tasks.Signature{Name: "add"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Len(t, chain.Tasks, 2)
+	assert.Equal(t, "parity", chain.Tasks[0].OnSuccess[0].Name)
+	assert.Equal(t, "half", decider.Branches["even"].Name)
+	assert.Equal(t, "print", decider.Branches["even"].OnSuccess[0].Name)
+	assert.Equal(t, "triple", decider.Branches["odd"].Name)
+
+	_, err = tasks.NewConditionalChain(decider, nil)
+	assert.Error(t, err)
+	_, err = tasks.NewConditionalChain(decider, map[string]*tasks.Chain{"empty": {}})
+	assert.Error(t, err)
+}
+
+func TestNewMapReduce(t *testing.T) {
+	t.Parallel()
+
+	mapper := &tasks.Signature{
+		Name: "scale",
+		Args: []tasks.Arg{
+			{Name: "n", Type: tasks.ItemArgType},
+			{Name: "factor", Type: "int64", Value: 10},
+		},
+	}
+	reducer := &tasks.Signature{Name: "sum"}
+	items := []tasks.Arg{{Type: "int64", Value: 1}, {Type: "int64", Value: 2}}
+
+	chord, err := tasks.NewMapReduce(mapper, items, reducer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, reducer, chord.Callback)
+	if assert.Len(t, chord.Group.Tasks, 2) {
+		for i, task := range chord.Group.Tasks {
+			assert.Equal(t, "scale", task.Name)
+			assert.Equal(t, tasks.Arg{Name: "n", Type: "int64", Value: items[i].Value}, task.Args[0])
+			assert.Equal(t, 10, task.Args[1].Value)
+			assert.Equal(t, chord.Group.GroupUUID, task.GroupUUID)
+			assert.Equal(t, reducer, task.ChordCallback)
+		}
+		assert.NotEqual(t, chord.Group.Tasks[0].UUID, chord.Group.Tasks[1].UUID)
+	}
+	// The mapper itself is left as it is
+	assert.Equal(t, tasks.ItemArgType, mapper.Args[0].Type)
+
+	// Items are appended without placeholders
+	chord, err = tasks.NewMapReduce(&tasks.Signature{Name: "double"}, items, reducer)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []tasks.Arg{items[1]}, chord.Group.Tasks[1].Args)
+	}
+
+	_, err = tasks.NewMapReduce(mapper, nil, reducer)
+	assert.Error(t, err)
+}
+
+func TestNewChainSaga(t *testing.T) {
+	t.Parallel()
+
+	step1 := &tasks.Signature{Name: "reserve", CompensateWith: &tasks.Signature{Name: "release"}}
+	step2 := &tasks.Signature{Name: "notify"}
+	step3 := &tasks.Signature{Name: "charge", CompensateWith: &tasks.Signature{Name: "refund"}}
+
+	chain, err := tasks.NewChain(step1, step2, step3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NotEmpty(t, chain.SagaUUID)
+	for _, step := range chain.Tasks {
+		assert.Equal(t, chain.SagaUUID, step.SagaUUID)
+	}
+	assert.NotEmpty(t, step1.CompensateWith.UUID)
+
+	// Compensations of succeeded tasks are passed along, latest first
+	step1.ContinueSaga(step2)
+	step2.ContinueSaga(step3)
+	next := &tasks.Signature{Name: "ship"}
+	step3.ContinueSaga(next)
+	assert.Equal(t, []*tasks.Signature{step1.CompensateWith}, step3.Compensations)
+	assert.Equal(t, []*tasks.Signature{step3.CompensateWith, step1.CompensateWith}, next.Compensations)
+
+	// Chains without compensation tasks are no sagas
+	chain, err = tasks.NewChain(&tasks.Signature{Name: "foo"}, &tasks.Signature{Name: "bar"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, chain.SagaUUID)
+	chain.Tasks[0].ContinueSaga(chain.Tasks[1])
+	assert.Empty(t, chain.Tasks[1].Compensations)
+}
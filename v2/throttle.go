@@ -0,0 +1,166 @@
+package machinery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RichardKnop/machinery/v2/log"
+)
+
+// DefaultThrottleInterval is the default time between checks of the gauge of
+// a throttle
+const DefaultThrottleInterval = time.Second
+
+// ResourceGauge returns the pressure on a resource of the worker, e.g. 0.8
+// when 80% of its memory is used
+type ResourceGauge func() (float64, error)
+
+// Throttle stops a worker from fetching and processing new tasks while a
+// resource is under pressure, e.g. so bursts of memory-heavy tasks do not get
+// the worker killed
+type Throttle struct {
+	// Gauge measures the pressure on the resource
+	Gauge ResourceGauge
+	// High is the pressure from which new tasks are not processed anymore
+	High float64
+	// Low is the pressure below which new tasks are processed again, High
+	// when zero
+	Low float64
+	// Interval is the time between checks of the gauge,
+	// DefaultThrottleInterval when zero
+	Interval time.Duration
+}
+
+// SetThrottle sets the throttle of the worker, it has to be set before the
+// worker is launched. Running tasks are finished when the worker is
+// throttled, brokers stop fetching tasks like when it is paused.
+func (worker *Worker) SetThrottle(throttle Throttle) {
+	worker.throttle = &throttle
+}
+
+// IsThrottled returns true if the worker is throttled
+func (worker *Worker) IsThrottled() bool {
+	return worker.concurrencyLimiter().isThrottled()
+}
+
+// startThrottle checks the gauge of the throttle every interval, the returned
+// function stops it
+func (worker *Worker) startThrottle() context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	if worker.throttle == nil || worker.throttle.Gauge == nil {
+		return cancel
+	}
+
+	interval := worker.throttle.Interval
+	if interval <= 0 {
+		interval = DefaultThrottleInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				worker.concurrencyLimiter().setThrottled(false)
+				return
+			case <-ticker.C:
+				worker.checkThrottle()
+			}
+		}
+	}()
+	return cancel
+}
+
+// checkThrottle throttles the worker once the pressure reached the high
+// threshold and stops throttling it once it fell below the low threshold
+func (worker *Worker) checkThrottle() {
+	pressure, err := worker.throttle.Gauge()
+	if err != nil {
+		log.ERROR.Printf("Failed to measure the pressure of the throttle: %s", err)
+		return
+	}
+
+	low := worker.throttle.Low
+	if low <= 0 {
+		low = worker.throttle.High
+	}
+
+	limiter := worker.concurrencyLimiter()
+	throttled := limiter.isThrottled()
+	if !throttled && pressure >= worker.throttle.High {
+		limiter.setThrottled(true)
+		log.WARNING.Printf("Worker %s throttled, pressure %.2f", worker.ConsumerTag, pressure)
+	} else if throttled && pressure < low {
+		limiter.setThrottled(false)
+		log.INFO.Printf("Worker %s not throttled anymore, pressure %.2f", worker.ConsumerTag, pressure)
+	}
+}
+
+// MemoryGauge measures the memory obtained from the OS by the Go runtime
+// relative to the limit in bytes
+func MemoryGauge(limit uint64) ResourceGauge {
+	return func() (float64, error) {
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return float64(stats.Sys) / float64(limit), nil
+	}
+}
+
+// CgroupMemoryGauge measures the memory used by the cgroup of the worker
+// relative to its limit, e.g. the memory limit of a Kubernetes container. It
+// supports cgroup v2 and v1.
+func CgroupMemoryGauge() ResourceGauge {
+	return func() (float64, error) {
+		usage, limit, err := readCgroupMemory("/sys/fs/cgroup/memory.current", "/sys/fs/cgroup/memory.max")
+		if errors.Is(err, os.ErrNotExist) {
+			usage, limit, err = readCgroupMemory("/sys/fs/cgroup/memory/memory.usage_in_bytes", "/sys/fs/cgroup/memory/memory.limit_in_bytes")
+		}
+		if err != nil {
+			return 0, err
+		}
+		return float64(usage) / float64(limit), nil
+	}
+}
+
+// readCgroupMemory reads the memory usage and limit of a cgroup
+func readCgroupMemory(usagePath, limitPath string) (uint64, uint64, error) {
+	usage, err := readCgroupValue(usagePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	limit, err := readCgroupValue(limitPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit == 0 {
+		return 0, 0, errors.New("Cgroup has no memory limit")
+	}
+	return usage, limit, nil
+}
+
+// readCgroupValue reads a number from a cgroup file, a limit of max is
+// returned as zero
+func readCgroupValue(path string) (uint64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Parse %s error: %s", path, err)
+	}
+	return n, nil
+}
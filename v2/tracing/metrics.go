@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// meterName is the instrumentation name of the meter recording the metrics
+const meterName = "github.com/RichardKnop/machinery/v2"
+
+// Metrics records OpenTelemetry metrics of the tasks processed by workers:
+//
+//	machinery.tasks           counter of tasks by name and outcome: success, failure or canceled
+//	machinery.task.duration   histogram of the durations of tasks in milliseconds, by name and outcome
+//	machinery.tasks.in_flight up down counter of the started tasks, by name
+//	machinery.task.retries    counter of retried tasks, by name
+type Metrics struct {
+	tasks     syncint64.Counter
+	durations syncfloat64.Histogram
+	inFlight  syncint64.UpDownCounter
+	retries   syncint64.Counter
+	// started holds the start times of the running tasks by their UUIDs
+	started sync.Map
+}
+
+// NewMetrics creates the instruments with a meter of the provider, the
+// global meter provider if it is nil
+func NewMetrics(provider metric.MeterProvider) (*Metrics, error) {
+	if provider == nil {
+		provider = global.MeterProvider()
+	}
+	meter := provider.Meter(meterName)
+
+	var (
+		m   = new(Metrics)
+		err error
+	)
+	if m.tasks, err = meter.SyncInt64().Counter(
+		"machinery.tasks",
+		instrument.WithDescription("Number of processed tasks by name and outcome"),
+	); err != nil {
+		return nil, err
+	}
+	if m.durations, err = meter.SyncFloat64().Histogram(
+		"machinery.task.duration",
+		instrument.WithDescription("Durations of tasks from their start to their outcome"),
+		instrument.WithUnit(unit.Milliseconds),
+	); err != nil {
+		return nil, err
+	}
+	if m.inFlight, err = meter.SyncInt64().UpDownCounter(
+		"machinery.tasks.in_flight",
+		instrument.WithDescription("Number of started tasks being processed"),
+	); err != nil {
+		return nil, err
+	}
+	if m.retries, err = meter.SyncInt64().Counter(
+		"machinery.task.retries",
+		instrument.WithDescription("Number of retried tasks"),
+	); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ObserveState records the new state of the task, it is meant to be the
+// state handler of workers:
+//
+//	worker.SetStateHandler(metrics.ObserveState)
+func (m *Metrics) ObserveState(signature *tasks.Signature, state string, latency time.Duration) {
+	ctx := context.Background()
+	name := attribute.String("task.name", signature.Name)
+
+	switch state {
+	case tasks.StateStarted:
+		m.started.Store(signature.UUID, time.Now())
+		m.inFlight.Add(ctx, 1, name)
+		return
+	case tasks.StateRetry:
+		m.retries.Add(ctx, 1, name)
+	case tasks.StateSuccess, tasks.StateFailure, tasks.StateCanceled:
+		m.tasks.Add(ctx, 1, name, attribute.String("task.outcome", strings.ToLower(state)))
+	default:
+		return
+	}
+
+	// Tasks canceled or failed before they started are not in flight
+	if startedAt, ok := m.started.LoadAndDelete(signature.UUID); ok {
+		m.inFlight.Add(ctx, -1, name)
+		if state != tasks.StateRetry {
+			duration := float64(time.Since(startedAt.(time.Time))) / float64(time.Millisecond)
+			m.durations.Record(ctx, duration, name, attribute.String("task.outcome", strings.ToLower(state)))
+		}
+	}
+}
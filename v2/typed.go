@@ -0,0 +1,86 @@
+package machinery
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/RichardKnop/machinery/v2/serialization"
+	"github.com/RichardKnop/machinery/v2/tasks"
+)
+
+// RegisterTaskFunc registers a task taking its args as a single value of type
+// A and returning a single value of type R. Unlike tasks registered with
+// RegisterTask, args and results are not reflected from typed tasks.Arg
+// values, they are encoded with the SerializationCodec of the server and sent
+// as a single []byte arg, see NewTaskFuncSignature and DecodeTaskFuncResult.
+func RegisterTaskFunc[A, R any](server *Server, name string, fn func(ctx context.Context, args A) (R, error)) error {
+	if fn == nil {
+		return fmt.Errorf("Task func of task %s is nil", name)
+	}
+	codec, err := server.codec()
+	if err != nil {
+		return err
+	}
+
+	return server.RegisterTask(name, func(ctx context.Context, encodedArgs []byte) ([]byte, error) {
+		var args A
+		if err := codec.Unmarshal(encodedArgs, &args); err != nil {
+			return nil, fmt.Errorf("Decode args of task %s error: %s", name, err)
+		}
+
+		result, err := fn(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+
+		return codec.Marshal(result)
+	})
+}
+
+// NewTaskFuncSignature creates a signature of a task registered with
+// RegisterTaskFunc, the args are encoded with the SerializationCodec of the
+// server
+func NewTaskFuncSignature[A any](server *Server, name string, args A) (*tasks.Signature, error) {
+	codec, err := server.codec()
+	if err != nil {
+		return nil, err
+	}
+
+	encodedArgs, err := codec.Marshal(args)
+	if err != nil {
+		return nil, fmt.Errorf("Encode args of task %s error: %s", name, err)
+	}
+
+	return tasks.NewSignature(name, []tasks.Arg{{Type: "[]byte", Value: encodedArgs}})
+}
+
+// DecodeTaskFuncResult decodes the result of a task registered with
+// RegisterTaskFunc from the results returned by AsyncResult.Get
+func DecodeTaskFuncResult[R any](server *Server, results []reflect.Value) (R, error) {
+	var result R
+	if len(results) != 1 {
+		return result, fmt.Errorf("Task func returned %d results instead of 1", len(results))
+	}
+	encodedResult, ok := results[0].Interface().([]byte)
+	if !ok {
+		return result, fmt.Errorf("Task func returned %s instead of []byte", results[0].Type())
+	}
+
+	codec, err := server.codec()
+	if err != nil {
+		return result, err
+	}
+	if err := codec.Unmarshal(encodedResult, &result); err != nil {
+		return result, fmt.Errorf("Decode task func result error: %s", err)
+	}
+	return result, nil
+}
+
+// codec returns the codec of the SerializationCodec setting of the server
+func (server *Server) codec() (serialization.Codec, error) {
+	if server.config == nil {
+		return serialization.JSON, nil
+	}
+	return serialization.Get(server.config.SerializationCodec)
+}
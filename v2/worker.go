@@ -1,17 +1,21 @@
 package machinery
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"os/signal"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/RichardKnop/machinery/v2/backends"
 	"github.com/RichardKnop/machinery/v2/backends/amqp"
 	"github.com/RichardKnop/machinery/v2/brokers/errs"
+	"github.com/RichardKnop/machinery/v2/config"
 	"github.com/RichardKnop/machinery/v2/log"
 	"github.com/RichardKnop/machinery/v2/retry"
 	"github.com/RichardKnop/machinery/v2/tasks"
@@ -23,11 +27,50 @@ type Worker struct {
 	server            *Server
 	ConsumerTag       string
 	Concurrency       int
+	MaxConcurrency    int
 	Queue             string
+	Prefetch          int
+	PanicPolicy       PanicPolicy
+	HealthAddr        string
+	Version           string
 	errorHandler      func(err error)
+	retryHandler      func(signature *tasks.Signature, attempt int, err error, eta time.Time)
 	preTaskHandler    func(*tasks.Signature)
 	postTaskHandler   func(*tasks.Signature)
+	stateHandler      func(signature *tasks.Signature, state string, latency time.Duration)
 	preConsumeHandler func(*Worker) bool
+	// running holds the running tasks by their UUIDs
+	running sync.Map
+	// batches holds the batches waiting to be processed by task names
+	batches   map[string]*batch
+	batchesMu sync.Mutex
+	// breakers holds the circuit breakers by task names
+	breakers              sync.Map
+	circuitBreakerHandler func(name string, state CircuitState)
+	panicHandler          func(signature *tasks.Signature, value interface{}, stack string)
+	// limiter limits the tasks processed at once, see SetConcurrency
+	limiter     *concurrencyLimiter
+	limiterOnce sync.Once
+	drain       drain
+	// consuming is set while the broker is consuming
+	consuming int32
+	throttle  *Throttle
+	// id is the ID the worker is registered with, see ID
+	id        string
+	idOnce    sync.Once
+	startedAt time.Time
+	// succeeded and failed count the completed tasks, see WorkerInfo
+	succeeded int64
+	failed    int64
+}
+
+// runningTask is a task being processed by the worker
+type runningTask struct {
+	signature *tasks.Signature
+	// cancel cancels the context of the task
+	cancel context.CancelFunc
+	// requeued is set once the task has been requeued by a worker quitting
+	requeued int32
 }
 
 var (
@@ -60,6 +103,12 @@ func (worker *Worker) LaunchAsync(errorsChan chan<- error) {
 	} else {
 		log.INFO.Printf("- CustomQueue: %s", worker.Queue)
 	}
+	if worker.Prefetch > 0 {
+		log.INFO.Printf("- Prefetch: %d", worker.Prefetch)
+	}
+	if worker.MaxConcurrency > worker.Concurrency {
+		log.INFO.Printf("- MaxConcurrency: %d", worker.MaxConcurrency)
+	}
 	log.INFO.Printf("- ResultBackend: %s", RedactURL(cnf.ResultBackend))
 	if cnf.AMQP != nil {
 		log.INFO.Printf("- AMQP: %s", cnf.AMQP.Exchange)
@@ -69,11 +118,26 @@ func (worker *Worker) LaunchAsync(errorsChan chan<- error) {
 		log.INFO.Printf("  - PrefetchCount: %d", cnf.AMQP.PrefetchCount)
 	}
 
+	// Goroutine purging expired results of backends without native TTLs
+	stopGC := worker.startGC()
+	// Goroutine canceling running tasks canceled in the result backend
+	stopCancelChecks := worker.startCancelChecks()
+	// Goroutine saving heartbeats of running tasks and looking for stuck tasks
+	stopHeartbeats := worker.startHeartbeats()
+	// Goroutine serving the health endpoints
+	stopHealthServer := worker.startHealthServer()
+	// Goroutine throttling the worker while a resource is under pressure
+	stopThrottle := worker.startThrottle()
+	// Goroutine registering the worker in the result backend
+	stopRegistration := worker.startRegistration()
+
 	var signalWG sync.WaitGroup
 	// Goroutine to start broker consumption and handle retries when broker connection dies
 	go func() {
 		for {
-			retry, err := broker.StartConsuming(worker.ConsumerTag, worker.Concurrency, worker)
+			atomic.StoreInt32(&worker.consuming, 1)
+			retry, err := broker.StartConsuming(worker.ConsumerTag, worker.maxConcurrency(), worker)
+			atomic.StoreInt32(&worker.consuming, 0)
 
 			if retry {
 				if worker.errorHandler != nil {
@@ -82,6 +146,12 @@ func (worker *Worker) LaunchAsync(errorsChan chan<- error) {
 					log.WARNING.Printf("Broker failed with error: %s", err)
 				}
 			} else {
+				stopGC()
+				stopCancelChecks()
+				stopHeartbeats()
+				stopHealthServer()
+				stopThrottle()
+				stopRegistration()
 				signalWG.Wait()
 				errorsChan <- err // stop the goroutine
 				return
@@ -117,18 +187,211 @@ func (worker *Worker) LaunchAsync(errorsChan chan<- error) {
 	}
 }
 
+// startGC collects garbage of the result backend every ResultsGCInterval
+// seconds, the returned function stops it
+func (worker *Worker) startGC() context.CancelFunc {
+	cnf := worker.server.GetConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	if cnf.ResultsGCInterval <= 0 || worker.server.GetBackend() == nil {
+		return cancel
+	}
+
+	gc := backends.NewGC(worker.server.GetBackend(), time.Duration(cnf.ResultsGCInterval)*time.Second)
+	if !gc.Supported() {
+		log.WARNING.Print("ResultsGCInterval is set but the result backend does not collect garbage")
+		return cancel
+	}
+	log.INFO.Printf("- ResultsGCInterval: %ds", cnf.ResultsGCInterval)
+
+	go gc.Run(ctx)
+	return cancel
+}
+
+// startCancelChecks checks the result backend for canceled running tasks
+// every CancelCheckInterval seconds and cancels their contexts, the returned
+// function stops it
+func (worker *Worker) startCancelChecks() context.CancelFunc {
+	cnf := worker.server.GetConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	backend := worker.server.GetBackend()
+	if cnf.CancelCheckInterval < 0 || backend == nil || backend.IsAMQP() {
+		return cancel
+	}
+
+	interval := cnf.CancelCheckInterval
+	if interval == 0 {
+		interval = config.DefaultCancelCheckInterval
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				worker.running.Range(func(key, value interface{}) bool {
+					if worker.isCanceled(key.(string)) {
+						value.(*runningTask).cancel()
+					}
+					return true
+				})
+			}
+		}
+	}()
+	return cancel
+}
+
+// startHeartbeats saves heartbeats of running tasks every HeartbeatInterval
+// seconds and handles tasks without a heartbeat for StuckTaskDeadline seconds,
+// the returned function stops it
+func (worker *Worker) startHeartbeats() context.CancelFunc {
+	cnf := worker.server.GetConfig()
+	ctx, cancel := context.WithCancel(context.Background())
+	if cnf.HeartbeatInterval <= 0 || worker.server.GetBackend() == nil {
+		return cancel
+	}
+
+	if !backends.HeartbeatsSupported(worker.server.GetBackend()) {
+		log.WARNING.Print("HeartbeatInterval is set but the result backend does not record heartbeats")
+		return cancel
+	}
+	log.INFO.Printf("- HeartbeatInterval: %ds", cnf.HeartbeatInterval)
+	if cnf.StuckTaskDeadline > 0 {
+		log.INFO.Printf("- StuckTaskDeadline: %ds", cnf.StuckTaskDeadline)
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(cnf.HeartbeatInterval) * time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				worker.running.Range(func(key, value interface{}) bool {
+					worker.heartbeat(value.(*runningTask).signature)
+					return true
+				})
+				if cnf.StuckTaskDeadline > 0 {
+					worker.handleStuckTasks(time.Duration(cnf.StuckTaskDeadline) * time.Second)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+// heartbeat saves a heartbeat of the running task if heartbeats are enabled
+func (worker *Worker) heartbeat(signature *tasks.Signature) {
+	if worker.server.GetConfig().HeartbeatInterval <= 0 {
+		return
+	}
+
+	err := backends.Heartbeat(worker.server.GetBackend(), signature)
+	if err != nil && err != backends.ErrHeartbeatsNotSupported {
+		log.ERROR.Printf("Failed to save heartbeat of task %s: %s", signature.UUID, err)
+	}
+}
+
+// removeHeartbeat removes the heartbeat of the finished task if heartbeats
+// are enabled
+func (worker *Worker) removeHeartbeat(signature *tasks.Signature) {
+	if worker.server.GetConfig().HeartbeatInterval <= 0 {
+		return
+	}
+
+	_, err := backends.RemoveHeartbeat(worker.server.GetBackend(), signature.UUID)
+	if err != nil && err != backends.ErrHeartbeatsNotSupported {
+		log.ERROR.Printf("Failed to remove heartbeat of task %s: %s", signature.UUID, err)
+	}
+}
+
+// handleStuckTasks requeues or fails started tasks without a heartbeat for
+// the deadline. Workers claim a stuck task by removing its heartbeat, so only
+// one of them handles it.
+func (worker *Worker) handleStuckTasks(deadline time.Duration) {
+	backend := worker.server.GetBackend()
+	signatures, err := backends.StaleHeartbeats(backend, time.Now().Add(-deadline))
+	if err != nil {
+		log.ERROR.Printf("Failed to look for stuck tasks: %s", err)
+		return
+	}
+
+	for _, signature := range signatures {
+		claimed, err := backends.RemoveHeartbeat(backend, signature.UUID)
+		if err != nil {
+			log.ERROR.Printf("Failed to remove heartbeat of task %s: %s", signature.UUID, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		// The task finished or has been retried in the meantime
+		state, err := backend.GetState(signature.UUID)
+		if err != nil || state.State != tasks.StateStarted {
+			continue
+		}
+
+		if worker.server.GetConfig().RequeueStuckTasks {
+			log.WARNING.Printf("Task %s is stuck, no heartbeat for %.0f seconds. Going to requeue it.", signature.UUID, deadline.Seconds())
+			if _, err := worker.server.resendTask(signature); err != nil {
+				log.ERROR.Printf("Failed to requeue stuck task %s: %s", signature.UUID, err)
+			}
+			continue
+		}
+
+		stuckErr := fmt.Errorf("Task %s is stuck, no heartbeat for %.0f seconds", signature.UUID, deadline.Seconds())
+		if err := worker.taskFailed(signature, stuckErr); err != nil {
+			log.ERROR.Printf("Failed to fail stuck task %s: %s", signature.UUID, err)
+		}
+	}
+}
+
+// isCanceled returns true if the task has been canceled in the result backend,
+// the state is not read when canceling tasks is disabled
+func (worker *Worker) isCanceled(taskUUID string) bool {
+	// States are consumed when they are read from AMQP
+	if worker.server.GetConfig().CancelCheckInterval < 0 || worker.server.GetBackend().IsAMQP() {
+		return false
+	}
+
+	state, err := worker.server.GetBackend().GetState(taskUUID)
+	return err == nil && state.IsCanceled()
+}
+
 // CustomQueue returns Custom Queue of the running worker process
 func (worker *Worker) CustomQueue() string {
 	return worker.Queue
 }
 
+// CustomPrefetch returns how many messages the running worker process fetches
+// ahead of processing (AMQP prefetch count, messages buffered by Redis, SQS
+// messages received at once), zero keeps the broker configuration
+func (worker *Worker) CustomPrefetch() int {
+	return worker.Prefetch
+}
+
 // Quit tears down the running worker process
 func (worker *Worker) Quit() {
-	worker.server.GetBroker().StopConsuming()
+	// Tasks received while the worker was paused would otherwise keep
+	// waiting and block quitting
+	worker.Resume()
+	worker.stopConsuming()
 }
 
 // Process handles received tasks and triggers success/error callbacks
 func (worker *Worker) Process(signature *tasks.Signature) error {
+	// Control tasks broadcast by the server, e.g. by Server.PauseWorkers, are
+	// handled by the worker itself
+	if worker.processControl(signature) {
+		return nil
+	}
+
 	// If the task is not registered with this worker, do not continue
 	// but only return nil as we do not want to restart the worker process
 	if !worker.server.IsTaskRegistered(signature.Name) {
@@ -140,16 +403,62 @@ func (worker *Worker) Process(signature *tasks.Signature) error {
 		return nil
 	}
 
+	// Drop the task if it has been canceled before it was received
+	if worker.isCanceled(signature.UUID) {
+		log.WARNING.Printf("Task %s has been canceled, dropping it", signature.UUID)
+		return worker.taskCanceled(signature)
+	}
+
+	// Tasks are not processed while their circuit breaker is open
+	breaker := worker.getCircuitBreaker(signature.Name)
+	if breaker != nil {
+		allowed, until, halfOpened := breaker.allow(time.Now())
+		if halfOpened {
+			worker.circuitChanged(signature.Name, CircuitHalfOpen)
+		}
+		if !allowed {
+			return worker.requeueUntil(signature, until)
+		}
+	}
+
+	// Tasks exceeding their rate limit are processed once a token is available
+	if wait := worker.takeToken(signature); wait > 0 {
+		return worker.requeueRateLimited(signature, wait)
+	}
+
+	// Wait until the task can be processed within the concurrency of the
+	// worker, which can be changed while it is running. Tasks processed
+	// outside of consumption, e.g. by the eager broker which processes retries
+	// while the failed task is still being processed, are not limited.
+	if atomic.LoadInt32(&worker.consuming) == 1 {
+		limiter := worker.concurrencyLimiter()
+		limiter.acquire()
+		defer limiter.release()
+	}
+
 	// Update task state to RECEIVED
-	if err = worker.server.GetBackend().SetStateReceived(signature); err != nil {
+	if err = worker.setState(signature, tasks.StateReceived, worker.server.GetBackend().SetStateReceived); err != nil {
 		return fmt.Errorf("Set state to 'received' for task %s returned error: %s", signature.UUID, err)
 	}
 
+	// Tasks of a batch handler are processed together with other tasks
+	if batchTask, ok := taskFunc.(*batchTask); ok {
+		return worker.processBatched(signature, batchTask)
+	}
+
+	// A task delivered too many times without finishing, e.g. because it
+	// crashes its workers, is quarantined instead of being processed again
+	if deliveries, poison := worker.isPoison(signature); poison {
+		return worker.quarantine(signature, deliveries)
+	}
+
 	// Prepare task for processing
 	task, err := tasks.NewWithSignature(taskFunc, signature)
 	// if this failed, it means the task is malformed, probably has invalid
 	// signature, go directly to task failed without checking whether to retry
 	if err != nil {
+		worker.recordFailure(signature, err, time.Now())
+		worker.moveToDeadLetterQueue(signature, tasks.DeadLetterReasonUnprocessable, err)
 		worker.taskFailed(signature, err)
 		return err
 	}
@@ -159,12 +468,33 @@ func (worker *Worker) Process(signature *tasks.Signature) error {
 	// argument. Start a new span if it isn't found.
 	ctx, _ := tracing.StartSpanFromHeaders(signature.Headers, signature.Name)
 	tracing.AnnotateSpanWithSignatureInfo(ctx, signature)
-	task.Context = ctx
+
+	// The context is canceled when the task is canceled while it is running
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	running := &runningTask{signature: signature, cancel: cancel}
+	worker.running.Store(signature.UUID, running)
+	defer worker.running.Delete(signature.UUID)
+
+	// The context of the task is done once its timeout passed
+	taskCtx := ctx
+	if signature.TimeoutSeconds > 0 {
+		var cancelTimeout context.CancelFunc
+		taskCtx, cancelTimeout = context.WithTimeout(ctx, time.Duration(signature.TimeoutSeconds)*time.Second)
+		defer cancelTimeout()
+	}
+	task.Context = tasks.ContextWithPublisher(taskCtx, tasks.NewPublisher(signature, worker.sendChild))
+	task.Context = tasks.ContextWithResultEmitter(task.Context, worker.resultEmitter(signature))
 
 	// Update task state to STARTED
-	if err = worker.server.GetBackend().SetStateStarted(signature); err != nil {
+	if err = worker.setState(signature, tasks.StateStarted, worker.server.GetBackend().SetStateStarted); err != nil {
 		return fmt.Errorf("Set state to 'started' for task %s returned error: %s", signature.UUID, err)
 	}
+	worker.server.emitEvent(EventTaskStarted, signature, nil, "")
+
+	// The task is found by other workers if this one stops while running it
+	worker.heartbeat(signature)
+	defer worker.removeHeartbeat(signature)
 
 	//Run handler before the task is called
 	if worker.preTaskHandler != nil {
@@ -177,55 +507,219 @@ func (worker *Worker) Process(signature *tasks.Signature) error {
 	}
 
 	// Call the task
-	results, err := task.Call()
-	if err != nil {
-		// If a tasks.ErrRetryTaskLater was returned from the task,
-		// retry the task after specified duration
-		retriableErr, ok := interface{}(err).(tasks.ErrRetryTaskLater)
-		if ok {
-			return worker.retryTaskIn(signature, retriableErr.RetryIn())
-		}
+	startedAt := time.Now()
+	results, err := worker.callTask(taskCtx, task, signature.TimeoutSeconds > 0)
 
-		// Otherwise, execute default retry logic based on signature.RetryCount
-		// and signature.RetryTimeout values
-		if signature.RetryCount > 0 {
-			return worker.taskRetry(signature)
+	// The results of a task canceled while it was running are discarded
+	if ctx.Err() != nil {
+		if atomic.LoadInt32(&running.requeued) == 1 {
+			log.WARNING.Printf("Task %s has been requeued", signature.UUID)
+			return nil
 		}
+		log.WARNING.Printf("Task %s has been canceled", signature.UUID)
+		return worker.taskCanceled(signature)
+	}
 
-		return worker.taskFailed(signature, err)
+	// Whatever a task returns once its timeout passed, e.g. the error of its
+	// context, it timed out
+	if err != nil && taskCtx.Err() == context.DeadlineExceeded {
+		err = tasks.ErrTaskTimedOut
+	}
+
+	if breaker != nil {
+		worker.updateCircuit(breaker, signature.Name, err)
+	}
+
+	// The attempt finished, the task is not poison unless it is going to crash
+	// the worker. Deliveries are reset before the task is retried.
+	if !worker.crashesOn(err) {
+		worker.resetDeliveries(signature)
+	}
+
+	if err != nil {
+		worker.recordFailure(signature, err, startedAt)
+		return worker.taskErroredOrPanicked(signature, err)
 	}
 
 	return worker.taskSucceeded(signature, results)
 }
 
+// taskErrored retries the task which returned the error or fails it
+func (worker *Worker) taskErrored(signature *tasks.Signature, err error) error {
+	// Broadcast tasks would be retried by a single worker
+	if signature.Broadcast {
+		return worker.taskFailed(signature, err)
+	}
+
+	// A task which will never succeed fails at once
+	if tasks.IsNonRetryable(err) {
+		worker.moveToDeadLetterQueue(signature, tasks.DeadLetterReasonNotRetryable, err)
+		return worker.taskFailed(signature, err)
+	}
+
+	// If a tasks.ErrRetryTaskLater was returned from the task,
+	// retry the task after specified duration
+	retriableErr, ok := interface{}(err).(tasks.ErrRetryTaskLater)
+	if ok {
+		return worker.retryTaskIn(signature, retriableErr.RetryIn(), err)
+	}
+
+	// Errors the retry policy of the task does not retry fail it at once
+	policy := &worker.server.getTaskOptions(signature.Name).retryPolicy
+	if !policy.IsRetryable(err) {
+		worker.moveToDeadLetterQueue(signature, tasks.DeadLetterReasonNotRetryable, err)
+		return worker.taskFailed(signature, err)
+	}
+
+	// A task which does not set its retry count on its first failure is
+	// retried as many times as its policy allows
+	if signature.RetryCount == 0 && signature.RetryAttempt == 0 {
+		signature.RetryCount = policy.MaxRetries
+	}
+
+	// Otherwise, execute default retry logic based on signature.RetryCount
+	// and signature.RetryTimeout values
+	if signature.RetryCount > 0 {
+		return worker.taskRetry(signature, err)
+	}
+
+	worker.moveToDeadLetterQueue(signature, tasks.DeadLetterReasonRetriesExhausted, err)
+	return worker.taskFailed(signature, err)
+}
+
+// recordFailure keeps the failed attempt with the task, so it is retried or
+// moved to the dead letter queue with its failure history, and records it in
+// the result backend
+func (worker *Worker) recordFailure(signature *tasks.Signature, err error, startedAt time.Time) {
+	failure := tasks.NewFailure(signature, err, startedAt)
+	failure.Hostname, _ = os.Hostname()
+	signature.RecordFailure(failure)
+
+	if err := backends.AppendFailure(worker.server.GetBackend(), signature.UUID, failure); err != nil && err != backends.ErrFailureHistoryNotSupported {
+		log.ERROR.Printf("Failed to record failure of task %s: %s", signature.UUID, err)
+	}
+}
+
+// callTask calls the task. A task with a timeout is called in a goroutine and
+// is no longer waited for once its context is done, so a task which does not
+// stop then keeps running in the background but frees its concurrency slot.
+func (worker *Worker) callTask(ctx context.Context, task *tasks.Task, hasTimeout bool) ([]*tasks.TaskResult, error) {
+	if !hasTimeout {
+		return task.Call()
+	}
+
+	type callResult struct {
+		results []*tasks.TaskResult
+		err     error
+	}
+	done := make(chan callResult, 1)
+	go func() {
+		results, err := task.Call()
+		done <- callResult{results: results, err: err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.results, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// taskCanceled records the canceled state again with the group of the task,
+// callbacks of the task are not sent
+func (worker *Worker) taskCanceled(signature *tasks.Signature) error {
+	worker.releaseUnique(signature)
+
+	if err := worker.setState(signature, tasks.StateCanceled, worker.server.GetBackend().SetStateCanceled); err != nil {
+		return fmt.Errorf("Set state to 'canceled' for task %s returned error: %s", signature.UUID, err)
+	}
+	return nil
+}
+
+// releaseUnique releases the lock of a finished unique task, so it can be sent
+// again
+func (worker *Worker) releaseUnique(signature *tasks.Signature) {
+	if signature.UniqueTTL > 0 {
+		worker.server.unlockUnique(signature)
+	}
+}
+
+// sendChild sends a task published by a running task
+func (worker *Worker) sendChild(ctx context.Context, signature *tasks.Signature) error {
+	_, err := worker.server.SendTaskWithContext(ctx, signature)
+	return err
+}
+
+// resultEmitter returns the emitter recording partial results of the task in
+// the backend
+func (worker *Worker) resultEmitter(signature *tasks.Signature) tasks.ResultEmitter {
+	return func(result *tasks.TaskResult) error {
+		return backends.AppendPartialResult(worker.server.GetBackend(), signature.UUID, result)
+	}
+}
+
+// withPartialResults prepends the partial results emitted by the task to its
+// results, the results are returned alone if they cannot be read
+func (worker *Worker) withPartialResults(taskUUID string, taskResults []*tasks.TaskResult) []*tasks.TaskResult {
+	partialResults, err := backends.PartialResults(worker.server.GetBackend(), taskUUID)
+	if err != nil {
+		log.ERROR.Printf("Failed to get partial results of task %s: %s", taskUUID, err)
+		return taskResults
+	}
+	return append(partialResults, taskResults...)
+}
+
 // retryTask decrements RetryCount counter and republishes the task to the queue
-func (worker *Worker) taskRetry(signature *tasks.Signature) error {
+func (worker *Worker) taskRetry(signature *tasks.Signature, taskErr error) error {
 	// Update task state to RETRY
-	if err := worker.server.GetBackend().SetStateRetry(signature); err != nil {
+	if err := worker.setState(signature, tasks.StateRetry, worker.server.GetBackend().SetStateRetry); err != nil {
 		return fmt.Errorf("Set state to 'retry' for task %s returned error: %s", signature.UUID, err)
 	}
 
 	// Decrement the retry counter, when it reaches 0, we won't retry again
 	signature.RetryCount--
 
-	// Increase retry timeout
-	signature.RetryTimeout = retry.FibonacciNext(signature.RetryTimeout)
-
-	// Delay task by signature.RetryTimeout seconds
-	eta := time.Now().UTC().Add(time.Second * time.Duration(signature.RetryTimeout))
+	// Delay task by the delay of its retry strategy
+	attempt := signature.RetryAttempt + 1
+	retryIn := signature.NextRetryDelay(worker.retryStrategy(signature))
+	eta := time.Now().UTC().Add(retryIn)
 	signature.ETA = &eta
 
-	log.WARNING.Printf("Task %s failed. Going to retry in %d seconds.", signature.UUID, signature.RetryTimeout)
+	log.WARNING.Printf("Task %s failed. Going to retry in %.0f seconds.", signature.UUID, retryIn.Seconds())
+	if worker.retryHandler != nil {
+		worker.retryHandler(signature, attempt, taskErr, eta)
+	}
 
 	// Send the task back to the queue
-	_, err := worker.server.SendTask(signature)
-	return err
+	if _, err := worker.server.resendTask(signature); err != nil {
+		return err
+	}
+	worker.server.emitEvent(EventTaskRetried, signature, nil, taskErr.Error())
+	return nil
+}
+
+// retryStrategy returns the retry strategy named by the task, or the backoff
+// of its retry policy, Fibonacci by default
+func (worker *Worker) retryStrategy(signature *tasks.Signature) retry.Strategy {
+	if signature.RetryStrategy == "" {
+		if strategy := worker.server.getTaskOptions(signature.Name).retryPolicy.Backoff; strategy != nil {
+			return strategy
+		}
+	}
+
+	strategy, err := retry.GetStrategy(signature.RetryStrategy)
+	if err != nil {
+		log.ERROR.Printf("Task %s falls back to the default retry strategy: %s", signature.UUID, err)
+		return retry.FibonacciStrategy()
+	}
+	return strategy
 }
 
 // taskRetryIn republishes the task to the queue with ETA of now + retryIn.Seconds()
-func (worker *Worker) retryTaskIn(signature *tasks.Signature, retryIn time.Duration) error {
+func (worker *Worker) retryTaskIn(signature *tasks.Signature, retryIn time.Duration, taskErr error) error {
 	// Update task state to RETRY
-	if err := worker.server.GetBackend().SetStateRetry(signature); err != nil {
+	if err := worker.setState(signature, tasks.StateRetry, worker.server.GetBackend().SetStateRetry); err != nil {
 		return fmt.Errorf("Set state to 'retry' for task %s returned error: %s", signature.UUID, err)
 	}
 
@@ -234,19 +728,57 @@ func (worker *Worker) retryTaskIn(signature *tasks.Signature, retryIn time.Durat
 	signature.ETA = &eta
 
 	log.WARNING.Printf("Task %s failed. Going to retry in %.0f seconds.", signature.UUID, retryIn.Seconds())
+	if worker.retryHandler != nil {
+		worker.retryHandler(signature, signature.RetryAttempt+1, taskErr, eta)
+	}
 
 	// Send the task back to the queue
-	_, err := worker.server.SendTask(signature)
-	return err
+	if _, err := worker.server.resendTask(signature); err != nil {
+		return err
+	}
+	worker.server.emitEvent(EventTaskRetried, signature, nil, taskErr.Error())
+	return nil
+}
+
+// moveToDeadLetterQueue publishes a copy of the failed task to the dead letter
+// queue of its queue, it does nothing when no dead letter queue is configured
+func (worker *Worker) moveToDeadLetterQueue(signature *tasks.Signature, reason string, taskErr error) {
+	queue := signature.RoutingKey
+	if queue == "" {
+		queue = worker.server.GetConfig().DefaultQueue
+	}
+
+	deadLetterQueue := worker.server.GetConfig().GetDeadLetterQueue(queue)
+	if reason == tasks.DeadLetterReasonPoison {
+		deadLetterQueue = worker.server.GetConfig().GetPoisonQueue(queue)
+	}
+	if deadLetterQueue == "" {
+		return
+	}
+
+	deadLetter := tasks.NewDeadLetterSignature(signature, queue, deadLetterQueue, reason, taskErr)
+	if err := worker.server.GetBroker().Publish(context.Background(), deadLetter); err != nil {
+		log.ERROR.Printf("Failed to move task %s to dead letter queue %s: %s", signature.UUID, deadLetterQueue, err)
+		return
+	}
+
+	log.WARNING.Printf("Task %s moved to dead letter queue %s", signature.UUID, deadLetterQueue)
 }
 
 // taskSucceeded updates the task state and triggers success callbacks or a
 // chord callback if this was the last task of a group with a chord callback
 func (worker *Worker) taskSucceeded(signature *tasks.Signature, taskResults []*tasks.TaskResult) error {
+	worker.releaseUnique(signature)
+	atomic.AddInt64(&worker.succeeded, 1)
+
 	// Update task state to SUCCESS
-	if err := worker.server.GetBackend().SetStateSuccess(signature, taskResults); err != nil {
+	setSuccess := func(signature *tasks.Signature) error {
+		return worker.server.GetBackend().SetStateSuccess(signature, taskResults)
+	}
+	if err := worker.setState(signature, tasks.StateSuccess, setSuccess); err != nil {
 		return fmt.Errorf("Set state to 'success' for task %s returned error: %s", signature.UUID, err)
 	}
+	worker.server.emitEvent(EventTaskSucceeded, signature, taskResults, "")
 
 	// Log human readable results of the processed task
 	var debugResults = "[]"
@@ -260,41 +792,59 @@ func (worker *Worker) taskSucceeded(signature *tasks.Signature, taskResults []*t
 
 	// Trigger success callbacks
 
+	callbackResults := taskResults
+	if signature.PassPartialResults && len(signature.OnSuccess) > 0 {
+		callbackResults = worker.withPartialResults(signature.UUID, taskResults)
+	}
 	for _, successTask := range signature.OnSuccess {
 		if signature.Immutable == false {
 			// Pass results of the task to success callbacks
-			for _, taskResult := range taskResults {
+			for _, taskResult := range callbackResults {
 				successTask.Args = append(successTask.Args, tasks.Arg{
 					Type:  taskResult.Type,
 					Value: taskResult.Value,
 				})
 			}
 		}
+		signature.ContinueSaga(successTask)
 
 		worker.server.SendTask(successTask)
 	}
 
+	// Continue a conditional chain with the branch chosen by the decider task
+	if len(signature.Branches) > 0 {
+		if err := worker.sendBranch(signature, taskResults); err != nil {
+			return err
+		}
+	}
+
+	// Send the tasks of the DAG waiting for this one
+	if signature.DAG != nil {
+		if err := worker.sendDAGDependents(signature); err != nil {
+			return err
+		}
+	}
+
 	// If the task was not part of a group, just return
 	if signature.GroupUUID == "" {
 		return nil
 	}
 
-	// There is no chord callback, just return
-	if signature.ChordCallback == nil {
+	// There is no chord callback nor anyone waiting for the group to complete,
+	// just return
+	if signature.ChordCallback == nil && !worker.server.events.active() {
 		return nil
 	}
 
 	// Check if all task in the group has completed
-	groupCompleted, err := worker.server.GetBackend().GroupCompleted(
-		signature.GroupUUID,
-		signature.GroupTaskCount,
-	)
+	groupCompleted, err := worker.groupCompleted(signature)
 	if err != nil {
-		return fmt.Errorf("Completed check for group %s returned error: %s", signature.GroupUUID, err)
+		return err
 	}
 
-	// If the group has not yet completed, just return
-	if !groupCompleted {
+	// If the group has not yet completed or there is no chord callback, just
+	// return
+	if !groupCompleted || signature.ChordCallback == nil {
 		return nil
 	}
 
@@ -337,7 +887,11 @@ func (worker *Worker) taskSucceeded(signature *tasks.Signature, taskResults []*t
 
 		if signature.ChordCallback.Immutable == false {
 			// Pass results of the task to the chord callback
-			for _, taskResult := range taskState.Results {
+			stateResults := taskState.Results
+			if signature.PassPartialResults {
+				stateResults = worker.withPartialResults(taskState.TaskUUID, stateResults)
+			}
+			for _, taskResult := range stateResults {
 				signature.ChordCallback.Args = append(signature.ChordCallback.Args, tasks.Arg{
 					Type:  taskResult.Type,
 					Value: taskResult.Value,
@@ -351,16 +905,175 @@ func (worker *Worker) taskSucceeded(signature *tasks.Signature, taskResults []*t
 	if err != nil {
 		return err
 	}
+	worker.server.emitEvent(EventChordTriggered, signature.ChordCallback, nil, "")
+
+	return nil
+}
+
+// groupCompleted checks if all the tasks of the group of the task completed
+// and emits EventGroupCompleted if so. The event can be emitted more than once
+// when the last tasks of the group complete at the same time.
+func (worker *Worker) groupCompleted(signature *tasks.Signature) (bool, error) {
+	completed, err := worker.server.GetBackend().GroupCompleted(
+		signature.GroupUUID,
+		signature.GroupTaskCount,
+	)
+	if err != nil {
+		return false, fmt.Errorf("Completed check for group %s returned error: %s", signature.GroupUUID, err)
+	}
+	if completed {
+		worker.server.emitEvent(EventGroupCompleted, signature, nil, "")
+	}
+	return completed, nil
+}
+
+// sendBranch sends the first task of the branch named by the first result of
+// the decider task, passing the other results unless the task is immutable
+func (worker *Worker) sendBranch(signature *tasks.Signature, taskResults []*tasks.TaskResult) error {
+	if len(taskResults) == 0 {
+		return fmt.Errorf("Decider task %s returned no branch name", signature.UUID)
+	}
+	name, ok := taskResults[0].Value.(string)
+	if !ok {
+		return fmt.Errorf("Decider task %s returned %v instead of a branch name", signature.UUID, taskResults[0].Value)
+	}
+
+	branchTask, ok := signature.Branches[name]
+	if !ok {
+		log.WARNING.Printf("Decider task %s chose branch %s which does not exist, the chain ends", signature.UUID, name)
+		return nil
+	}
+
+	if branchTask.Immutable == false {
+		for _, taskResult := range taskResults[1:] {
+			branchTask.Args = append(branchTask.Args, tasks.Arg{
+				Type:  taskResult.Type,
+				Value: taskResult.Value,
+			})
+		}
+	}
+
+	signature.ContinueSaga(branchTask)
+
+	_, err := worker.server.SendTask(branchTask)
+	return err
+}
+
+// compensate sends the compensation tasks of the succeeded tasks of the saga
+// of the failed task one after another, latest first. They are recorded in a
+// group with the saga UUID and are not passed results of each other.
+func (worker *Worker) compensate(signature *tasks.Signature) error {
+	compensations := tasks.CopySignatures(signature.Compensations...)
+	taskUUIDs := make([]string, len(compensations))
+	for i, compensation := range compensations {
+		compensation.GroupUUID = signature.SagaUUID
+		compensation.GroupTaskCount = len(compensations)
+		compensation.Immutable = true
+		if i > 0 {
+			compensations[i-1].OnSuccess = append(compensations[i-1].OnSuccess, compensation)
+		}
+		taskUUIDs[i] = compensation.UUID
+	}
+
+	backend := worker.server.GetBackend()
+	if err := backend.InitGroup(signature.SagaUUID, taskUUIDs); err != nil {
+		return err
+	}
+	for _, compensation := range compensations {
+		if err := backend.SetStatePending(compensation); err != nil {
+			return err
+		}
+	}
+
+	log.WARNING.Printf("Task %s of saga %s failed, running %d compensation tasks", signature.UUID, signature.SagaUUID, len(compensations))
+	_, err := worker.server.SendTask(compensations[0])
+	return err
+}
+
+// sendDAGDependents sends the tasks of the DAG depending on the succeeded task
+// whose dependencies all succeeded, with their results unless immutable. The
+// backend flags the group of the dependencies so a task is sent only once,
+// even when its dependencies finish at the same time.
+func (worker *Worker) sendDAGDependents(signature *tasks.Signature) error {
+	dag := signature.DAG
+	backend := worker.server.GetBackend()
+
+	for _, dependent := range dag.Dependents(dag.Node) {
+		var (
+			args      []tasks.Arg
+			succeeded = true
+		)
+		for _, dependency := range dag.Dependencies(dependent) {
+			taskState, err := backend.GetState(dependency.Signature.UUID)
+			if err != nil {
+				return fmt.Errorf("Get state of task %s returned error: %s", dependency.Signature.UUID, err)
+			}
+			if !taskState.IsSuccess() {
+				succeeded = false
+				break
+			}
+			for _, taskResult := range taskState.Results {
+				args = append(args, tasks.Arg{
+					Type:  taskResult.Type,
+					Value: taskResult.Value,
+				})
+			}
+		}
+
+		// The last dependency to succeed sends the task
+		if !succeeded {
+			continue
+		}
+
+		shouldSend, err := backend.TriggerChord(dag.JoinUUID(dependent.Name))
+		if err != nil {
+			return fmt.Errorf("Triggering task %s of DAG %s returned error: %s", dependent.Name, dag.DAGUUID, err)
+		}
+		if !shouldSend {
+			continue
+		}
+
+		dependentSignature := tasks.CopySignature(dependent.Signature)
+		if !dependentSignature.Immutable {
+			dependentSignature.Args = append(dependentSignature.Args, args...)
+		}
+		dependentSignature.DAG = &tasks.DAGMeta{DAG: dag.DAG, Node: dependent.Name}
+
+		if _, err := worker.server.SendTask(dependentSignature); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 // taskFailed updates the task state and triggers error callbacks
 func (worker *Worker) taskFailed(signature *tasks.Signature, taskErr error) error {
+	worker.releaseUnique(signature)
+	atomic.AddInt64(&worker.failed, 1)
+
+	// Record the task so it can be replayed once it is seen failed, see
+	// Server.ReplayTask
+	failed := &tasks.FailedTask{Signature: signature, Error: taskErr.Error(), FailedAt: time.Now().UTC()}
+	if err := backends.RecordFailedTask(worker.server.GetBackend(), failed); err != nil && err != backends.ErrFailedTasksNotSupported {
+		log.ERROR.Printf("Failed to record failed task %s: %s", signature.UUID, err)
+	}
+
 	// Update task state to FAILURE
-	if err := worker.server.GetBackend().SetStateFailure(signature, taskErr.Error()); err != nil {
+	setFailure := func(signature *tasks.Signature) error {
+		return worker.server.GetBackend().SetStateFailure(signature, taskErr.Error())
+	}
+	if err := worker.setState(signature, tasks.StateFailure, setFailure); err != nil {
 		return fmt.Errorf("Set state to 'failure' for task %s returned error: %s", signature.UUID, err)
 	}
+	worker.server.emitEvent(EventTaskFailed, signature, nil, taskErr.Error())
+
+	// The failed task can be the last one of its group
+	if signature.GroupUUID != "" && worker.server.events.active() {
+		if _, err := worker.groupCompleted(signature); err != nil {
+			log.ERROR.Print(err)
+		}
+	}
 
 	if worker.errorHandler != nil {
 		worker.errorHandler(taskErr)
@@ -379,6 +1092,23 @@ func (worker *Worker) taskFailed(signature *tasks.Signature, taskErr error) erro
 		worker.server.SendTask(errorTask)
 	}
 
+	// Undo the succeeded tasks of the saga
+	if len(signature.Compensations) > 0 {
+		if err := worker.compensate(signature); err != nil {
+			log.ERROR.Printf("Compensating saga %s returned error: %s", signature.SagaUUID, err)
+		}
+	}
+
+	// Tasks of the DAG depending on this one can never be sent
+	if signature.DAG != nil {
+		for _, descendant := range signature.DAG.Descendants(signature.DAG.Node) {
+			dependencyErr := fmt.Sprintf("Dependency %s of DAG %s failed: %s", signature.DAG.Node, signature.DAG.DAGUUID, taskErr)
+			if err := worker.server.GetBackend().SetStateFailure(descendant.Signature, dependencyErr); err != nil {
+				log.ERROR.Printf("Set state to 'failure' for task %s returned error: %s", descendant.Signature.UUID, err)
+			}
+		}
+	}
+
 	if signature.StopTaskDeletionOnError {
 		return errs.ErrStopTaskDeletion
 	}
@@ -398,6 +1128,33 @@ func (worker *Worker) SetErrorHandler(handler func(err error)) {
 	worker.errorHandler = handler
 }
 
+// SetRetryHandler sets a handler called when a task which failed is going to
+// be retried, with the number of the attempt which failed, counted from 1,
+// and the time of the retry, e.g. to alert on tasks retried over and over
+func (worker *Worker) SetRetryHandler(handler func(signature *tasks.Signature, attempt int, err error, eta time.Time)) {
+	worker.retryHandler = handler
+}
+
+// SetStateHandler sets a handler called each time the worker recorded a new
+// state of a task in the result backend, with how long recording it took,
+// e.g. to measure task durations and backend latencies
+func (worker *Worker) SetStateHandler(handler func(signature *tasks.Signature, state string, latency time.Duration)) {
+	worker.stateHandler = handler
+}
+
+// setState records the state of the task with set and calls the state
+// handler
+func (worker *Worker) setState(signature *tasks.Signature, state string, set func(*tasks.Signature) error) error {
+	start := time.Now()
+	if err := set(signature); err != nil {
+		return err
+	}
+	if worker.stateHandler != nil {
+		worker.stateHandler(signature, state, time.Since(start))
+	}
+	return nil
+}
+
 //SetPreTaskHandler sets a custom handler func before a job is started
 func (worker *Worker) SetPreTaskHandler(handler func(*tasks.Signature)) {
 	worker.preTaskHandler = handler
@@ -420,6 +1177,11 @@ func (worker *Worker) GetServer() *Server {
 
 //
 func (worker *Worker) PreConsumeHandler() bool {
+	// Paused and throttled workers stop pulling new tasks
+	if worker.IsPaused() || worker.IsThrottled() {
+		return false
+	}
+
 	if worker.preConsumeHandler == nil {
 		return true
 	}
@@ -1,11 +1,32 @@
 package machinery_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/RichardKnop/machinery/v2"
+	"github.com/RichardKnop/machinery/v2/backends"
+	"github.com/RichardKnop/machinery/v2/backends/iface"
+	"github.com/RichardKnop/machinery/v2/backends/result"
+	"github.com/RichardKnop/machinery/v2/brokers"
+	"github.com/RichardKnop/machinery/v2/config"
+	"github.com/RichardKnop/machinery/v2/tasks"
+
+	backend "github.com/RichardKnop/machinery/v2/backends/eager"
+	memorybackend "github.com/RichardKnop/machinery/v2/backends/memory"
+	broker "github.com/RichardKnop/machinery/v2/brokers/eager"
+	memorybroker "github.com/RichardKnop/machinery/v2/brokers/memory"
+	lock "github.com/RichardKnop/machinery/v2/locks/eager"
 )
 
 func TestRedactURL(t *testing.T) {
@@ -28,3 +49,681 @@ func TestPreConsumeHandler(t *testing.T) {
 func SamplePreConsumeHandler(w *machinery.Worker) bool {
 	return true
 }
+
+type deadLetterBroker struct {
+	*broker.Broker
+	deadLetters []*tasks.Signature
+}
+
+func (b *deadLetterBroker) Publish(ctx context.Context, signature *tasks.Signature) error {
+	if signature.RoutingKey == "dead_letters" {
+		b.deadLetters = append(b.deadLetters, signature)
+		return nil
+	}
+	return b.Broker.Publish(ctx, signature)
+}
+
+func TestDeadLetterQueue(t *testing.T) {
+	t.Parallel()
+
+	b := &deadLetterBroker{Broker: broker.New().(*broker.Broker)}
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", DeadLetterQueue: "dead_letters"}
+	server := machinery.NewServer(cnf, b, backend.New(), lock.New())
+	assert.NoError(t, server.RegisterTask("fail", func() error { return errors.New("boom") }))
+	assert.NoError(t, server.RegisterTask("succeed", func() error { return nil }))
+	b.AssignWorker(server.NewWorker("test_worker", 1))
+
+	_, err := server.SendTask(&tasks.Signature{Name: "succeed"})
+	assert.NoError(t, err)
+	assert.Empty(t, b.deadLetters)
+
+	_, err = server.SendTask(&tasks.Signature{Name: "fail", Args: []tasks.Arg{{Type: "unknown", Value: "unexpected"}}})
+	assert.Error(t, err)
+
+	_, err = server.SendTask(&tasks.Signature{Name: "fail", UUID: "failing_task"})
+	assert.NoError(t, err)
+
+	if assert.Len(t, b.deadLetters, 2) {
+		assert.Equal(t, tasks.DeadLetterReasonUnprocessable, b.deadLetters[0].Headers[tasks.DeadLetterReasonHeader])
+
+		deadLetter := b.deadLetters[1]
+		assert.Equal(t, "failing_task", deadLetter.UUID)
+		assert.Equal(t, tasks.DeadLetterReasonRetriesExhausted, deadLetter.Headers[tasks.DeadLetterReasonHeader])
+		assert.Equal(t, "boom", deadLetter.Headers[tasks.DeadLetterErrorHeader])
+		assert.Equal(t, "machinery_tasks", deadLetter.Headers[tasks.DeadLetterQueueHeader])
+	}
+}
+
+func TestProcessCanceledTask(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	server := machinery.NewServer(cnf, broker.New(), memorybackend.New(cnf), lock.New())
+	var called bool
+	assert.NoError(t, server.RegisterTask("canceled", func() error {
+		called = true
+		return nil
+	}))
+	worker := server.NewWorker("test_worker", 1)
+
+	signature := &tasks.Signature{Name: "canceled", UUID: "canceled_task", GroupUUID: "group"}
+	assert.NoError(t, server.GetBackend().SetStatePending(signature))
+	assert.NoError(t, server.CancelTask(signature.UUID))
+
+	// The canceled task is dropped when it is received
+	assert.NoError(t, worker.Process(signature))
+	assert.False(t, called)
+	state, err := server.GetBackend().GetState(signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateCanceled, state.State)
+	}
+
+	// A finished task cannot be canceled
+	assert.Error(t, server.CancelTask(signature.UUID))
+}
+
+// stateReadCountingBackend counts reads of task states
+type stateReadCountingBackend struct {
+	iface.Backend
+	reads int32
+}
+
+func (b *stateReadCountingBackend) GetState(taskUUID string) (*tasks.TaskState, error) {
+	atomic.AddInt32(&b.reads, 1)
+	return b.Backend.GetState(taskUUID)
+}
+
+func TestProcessWithCancelingDisabled(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", CancelCheckInterval: -1}
+	counting := &stateReadCountingBackend{Backend: memorybackend.New(cnf)}
+	server := machinery.NewServer(cnf, broker.New(), counting, lock.New())
+	assert.NoError(t, server.RegisterTask("add", func() error { return nil }))
+	worker := server.NewWorker("test_worker", 1)
+
+	// Received tasks are processed without reading their states
+	signature := &tasks.Signature{Name: "add", UUID: "add_task"}
+	assert.NoError(t, worker.Process(signature))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&counting.reads))
+
+	assert.Error(t, server.CancelTask(signature.UUID))
+}
+
+func TestStuckTasks(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{
+		DefaultQueue:      "machinery_tasks",
+		NoUnixSignals:     true,
+		HeartbeatInterval: 1,
+		StuckTaskDeadline: 1,
+		RequeueStuckTasks: true,
+	}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	assert.NoError(t, server.RegisterTask("stuck", func() error { return nil }))
+
+	// The task has been started by a worker which stopped while running it
+	signature := &tasks.Signature{Name: "stuck", UUID: "stuck_task"}
+	assert.NoError(t, server.GetBackend().SetStateStarted(signature))
+	assert.NoError(t, backends.Heartbeat(server.GetBackend(), signature))
+
+	worker := server.NewWorker("test_worker", 1)
+	go worker.Launch()
+	defer worker.Quit()
+
+	// It is requeued and processed by the running worker
+	assert.Eventually(t, func() bool {
+		state, err := server.GetBackend().GetState(signature.UUID)
+		return err == nil && state.IsSuccess()
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestTaskTimeout(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	b := broker.New().(*broker.Broker)
+	server := machinery.NewServer(cnf, b, memorybackend.New(cnf), lock.New())
+
+	// The task ignores its context and keeps running until the test ends
+	release := make(chan struct{})
+	defer close(release)
+	assert.NoError(t, server.RegisterTask("hang", func() error {
+		<-release
+		return nil
+	}))
+	b.AssignWorker(server.NewWorker("test_worker", 1))
+
+	// The worker stops waiting for the task once its timeout passed
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "hang", TimeoutSeconds: 1})
+	assert.NoError(t, err)
+
+	state, err := server.GetBackend().GetState(asyncResult.Signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateFailure, state.State)
+		assert.Equal(t, tasks.ErrTaskTimedOut.Error(), state.Error)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	var down int32 = 1
+	assert.NoError(t, server.RegisterTask("call_downstream", func() error {
+		if atomic.LoadInt32(&down) == 1 {
+			return errors.New("downstream unavailable")
+		}
+		return nil
+	}, machinery.WithCircuitBreaker(2, time.Minute, 500*time.Millisecond)))
+
+	worker := server.NewWorker("test_worker", 1)
+	states := make(chan machinery.CircuitState, 3)
+	worker.SetCircuitBreakerHandler(func(name string, state machinery.CircuitState) {
+		assert.Equal(t, "call_downstream", name)
+		states <- state
+	})
+	go worker.Launch()
+	defer worker.Quit()
+
+	// The circuit is opened by the second failure
+	for i := 0; i < 2; i++ {
+		asyncResult, err := server.SendTask(&tasks.Signature{Name: "call_downstream"})
+		assert.NoError(t, err)
+		_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+		assert.EqualError(t, err, "downstream unavailable")
+	}
+	assert.Equal(t, machinery.CircuitOpen, <-states)
+	assert.Equal(t, machinery.CircuitOpen, worker.CircuitState("call_downstream"))
+
+	// A task received while the circuit is open is processed after the cooldown
+	atomic.StoreInt32(&down, 0)
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "call_downstream"})
+	assert.NoError(t, err)
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.NoError(t, err)
+
+	assert.Equal(t, machinery.CircuitHalfOpen, <-states)
+	assert.Equal(t, machinery.CircuitClosed, <-states)
+	assert.Equal(t, machinery.CircuitClosed, worker.CircuitState("call_downstream"))
+}
+
+func TestSetConcurrency(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	var running int32
+	release := make(chan struct{})
+	assert.NoError(t, server.RegisterTask("wait", func() error {
+		atomic.AddInt32(&running, 1)
+		<-release
+		return nil
+	}))
+
+	worker := server.NewWorker("test_worker", 1)
+	worker.MaxConcurrency = 3
+	go worker.Launch()
+	defer worker.Quit()
+
+	asyncResults := make([]*result.AsyncResult, 3)
+	for i := range asyncResults {
+		asyncResult, err := server.SendTask(&tasks.Signature{Name: "wait"})
+		assert.NoError(t, err)
+		asyncResults[i] = asyncResult
+	}
+
+	// Only one task is processed at once until the concurrency is grown
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&running))
+
+	// The concurrency can not be grown beyond MaxConcurrency
+	worker.SetConcurrency(10)
+	assert.Equal(t, 3, worker.GetConcurrency())
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&running) == 3
+	}, 5*time.Second, 5*time.Millisecond)
+
+	close(release)
+	for _, asyncResult := range asyncResults {
+		_, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+		assert.NoError(t, err)
+	}
+}
+
+func TestPauseWorkers(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	var processed int32
+	assert.NoError(t, server.RegisterTask("count", func() error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	}))
+
+	worker := server.NewWorker("test_worker", 1)
+	go worker.Launch()
+	defer worker.Quit()
+
+	// Broadcast tasks only reach workers which started consuming
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "count"})
+	assert.NoError(t, err)
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.NoError(t, err)
+
+	// Workers of other queues are not paused
+	assert.NoError(t, server.PauseWorkers("other_tasks"))
+	asyncResult, err = server.SendTask(&tasks.Signature{Name: "count"})
+	assert.NoError(t, err)
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, worker.IsPaused())
+
+	assert.NoError(t, server.PauseWorkers(""))
+	assert.Eventually(t, worker.IsPaused, 5*time.Second, 5*time.Millisecond)
+
+	// Tasks are not processed while the worker is paused
+	asyncResult, err = server.SendTask(&tasks.Signature{Name: "count"})
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&processed))
+
+	assert.NoError(t, server.ResumeWorkers("machinery_tasks"))
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, worker.IsPaused())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&processed))
+}
+
+func TestQuitRequeuesRunningTasks(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true, ShutdownTimeout: 1}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	started := make(chan struct{})
+	assert.NoError(t, server.RegisterTask("long_running", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	worker := server.NewWorker("test_worker", 1)
+	go worker.Launch()
+
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "long_running"})
+	assert.NoError(t, err)
+	<-started
+
+	go worker.Quit()
+	assert.Eventually(t, func() bool {
+		return worker.DrainStatus().Draining
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, worker.DrainStatus().Running)
+
+	// The task still running once the shutdown timeout passed is requeued
+	select {
+	case <-worker.Drained():
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker has not been drained")
+	}
+	assert.Equal(t, machinery.DrainStatus{Draining: true, Drained: true, Requeued: 1}, worker.DrainStatus())
+
+	state, err := server.GetBackend().GetState(asyncResult.Signature.UUID)
+	assert.NoError(t, err)
+	assert.Equal(t, tasks.StatePending, state.State)
+
+	pending, err := server.GetBroker().GetPendingTasks("machinery_tasks")
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, asyncResult.Signature.UUID, pending[0].UUID)
+	}
+}
+
+func TestQuitKeepsTasksFailingToRequeue(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true, ShutdownTimeout: 1}
+	var failPublish int32
+	requeueFailed := make(chan struct{}, 1)
+	broker := brokers.WithMiddleware(memorybroker.New(cnf), brokers.MiddlewareFuncs{
+		Publish: func(next brokers.PublishFunc) brokers.PublishFunc {
+			return func(ctx context.Context, signature *tasks.Signature) error {
+				if atomic.LoadInt32(&failPublish) == 1 {
+					requeueFailed <- struct{}{}
+					return errors.New("broker is down")
+				}
+				return next(ctx, signature)
+			}
+		},
+	})
+	server := machinery.NewServer(cnf, broker, memorybackend.New(cnf), lock.New())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var canceled int32
+	assert.NoError(t, server.RegisterTask("long_running", func(ctx context.Context) error {
+		close(started)
+		select {
+		case <-ctx.Done():
+			atomic.StoreInt32(&canceled, 1)
+			return ctx.Err()
+		case <-release:
+			return nil
+		}
+	}))
+
+	worker := server.NewWorker("test_worker", 1)
+	go worker.Launch()
+
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "long_running"})
+	assert.NoError(t, err)
+	<-started
+
+	atomic.StoreInt32(&failPublish, 1)
+	go worker.Quit()
+
+	// The task which could not be requeued once the shutdown timeout passed
+	// keeps running
+	select {
+	case <-requeueFailed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("task has not been requeued")
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&canceled))
+	assert.Equal(t, machinery.DrainStatus{Draining: true, Running: 1}, worker.DrainStatus())
+
+	close(release)
+	select {
+	case <-worker.Drained():
+	case <-time.After(10 * time.Second):
+		t.Fatal("worker has not been drained")
+	}
+	assert.Equal(t, machinery.DrainStatus{Draining: true, Drained: true}, worker.DrainStatus())
+
+	state, err := server.GetBackend().GetState(asyncResult.Signature.UUID)
+	assert.NoError(t, err)
+	assert.Equal(t, tasks.StateSuccess, state.State)
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	var processedAt []time.Time
+	assert.NoError(t, server.RegisterTask("call_api", func() error {
+		processedAt = append(processedAt, time.Now())
+		return nil
+	}, machinery.WithRateLimit(2, time.Second)))
+
+	worker := server.NewWorker("test_worker", 1)
+	go worker.Launch()
+	defer worker.Quit()
+
+	asyncResults := make([]*result.AsyncResult, 3)
+	for i := range asyncResults {
+		asyncResult, err := server.SendTask(&tasks.Signature{Name: "call_api"})
+		assert.NoError(t, err)
+		asyncResults[i] = asyncResult
+	}
+	for _, asyncResult := range asyncResults {
+		_, err := asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+		assert.NoError(t, err)
+	}
+
+	// The third task waits for a token, refilled every half second
+	if assert.Len(t, processedAt, 3) {
+		assert.GreaterOrEqual(t, processedAt[2].Sub(processedAt[0]), 400*time.Millisecond)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+	worker := server.NewWorker("test_worker", 1)
+	handler := worker.HealthHandler()
+
+	check := func(path string) (int, machinery.HealthStatus) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var status machinery.HealthStatus
+		assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&status))
+		return recorder.Code, status
+	}
+
+	// The worker is alive but not ready until it consumes
+	code, status := check("/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", status.Status)
+	code, status = check("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, status.Consuming)
+
+	go worker.Launch()
+	assert.Eventually(t, func() bool {
+		code, _ := check("/readyz")
+		return code == http.StatusOK
+	}, 5*time.Second, 5*time.Millisecond)
+
+	// A draining worker is not ready anymore
+	worker.Quit()
+	code, status = check("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.True(t, status.Draining)
+	assert.Equal(t, 0, status.Running)
+}
+
+func TestThrottle(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	var processed int32
+	assert.NoError(t, server.RegisterTask("count", func() error {
+		atomic.AddInt32(&processed, 1)
+		return nil
+	}))
+
+	var pressure int32 = 100
+	worker := server.NewWorker("test_worker", 1)
+	worker.SetThrottle(machinery.Throttle{
+		Gauge: func() (float64, error) {
+			return float64(atomic.LoadInt32(&pressure)) / 100, nil
+		},
+		High:     0.9,
+		Low:      0.5,
+		Interval: 5 * time.Millisecond,
+	})
+	go worker.Launch()
+	defer worker.Quit()
+
+	assert.Eventually(t, worker.IsThrottled, 5*time.Second, 5*time.Millisecond)
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "count"})
+	assert.NoError(t, err)
+
+	// The worker is throttled until the pressure fell below the low threshold
+	atomic.StoreInt32(&pressure, 70)
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, worker.IsThrottled())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&processed))
+
+	atomic.StoreInt32(&pressure, 20)
+	_, err = asyncResult.GetWithTimeout(5*time.Second, 5*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, worker.IsThrottled())
+}
+
+func TestGetWorkers(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", NoUnixSignals: true}
+	server := machinery.NewServer(cnf, memorybroker.New(cnf), memorybackend.New(cnf), lock.New())
+
+	worker := server.NewWorker("test_worker", 2)
+	worker.Version = "1.2.3"
+	go worker.Launch()
+
+	var workers []*tasks.WorkerInfo
+	assert.Eventually(t, func() bool {
+		var err error
+		workers, err = server.GetWorkers()
+		return err == nil && len(workers) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	assert.Equal(t, worker.ID(), workers[0].ID)
+	assert.Equal(t, "test_worker", workers[0].ConsumerTag)
+	assert.Equal(t, []string{"machinery_tasks"}, workers[0].Queues)
+	assert.Equal(t, 2, workers[0].Concurrency)
+	assert.Equal(t, "1.2.3", workers[0].Version)
+	assert.Equal(t, os.Getpid(), workers[0].PID)
+	assert.False(t, workers[0].StartedAt.IsZero())
+
+	// A worker which stopped is unregistered
+	worker.Quit()
+	assert.Eventually(t, func() bool {
+		workers, err := server.GetWorkers()
+		return err == nil && len(workers) == 0
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestPanicPolicy(t *testing.T) {
+	t.Parallel()
+
+	b := &deadLetterBroker{Broker: broker.New().(*broker.Broker)}
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", DeadLetterQueue: "dead_letters"}
+	server := machinery.NewServer(cnf, b, memorybackend.New(cnf), lock.New())
+
+	var attempts int32
+	assert.NoError(t, server.RegisterTask("explode", func() error {
+		atomic.AddInt32(&attempts, 1)
+		panic("out of fuel")
+	}))
+
+	worker := server.NewWorker("test_worker", 1)
+	var recovered []interface{}
+	worker.SetPanicHandler(func(signature *tasks.Signature, value interface{}, stack string) {
+		assert.Equal(t, "explode", signature.Name)
+		assert.Contains(t, stack, "panic")
+		recovered = append(recovered, value)
+	})
+	b.AssignWorker(worker)
+
+	// By default a task which panicked is retried
+	_, err := server.SendTask(&tasks.Signature{Name: "explode", RetryCount: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	assert.Equal(t, []interface{}{"out of fuel", "out of fuel"}, recovered)
+
+	// It is moved to the dead letter queue at once without being retried
+	atomic.StoreInt32(&attempts, 0)
+	recovered = nil
+	worker.PanicPolicy = machinery.PanicDeadLetter
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "explode", RetryCount: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+	assert.Equal(t, []interface{}{"out of fuel"}, recovered)
+
+	state, err := server.GetBackend().GetState(asyncResult.Signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateFailure, state.State)
+		assert.Equal(t, "out of fuel", state.Error)
+	}
+	if assert.Len(t, b.deadLetters, 2) {
+		assert.Equal(t, tasks.DeadLetterReasonRetriesExhausted, b.deadLetters[0].Headers[tasks.DeadLetterReasonHeader])
+		assert.Equal(t, tasks.DeadLetterReasonPanicked, b.deadLetters[1].Headers[tasks.DeadLetterReasonHeader])
+	}
+}
+
+func TestPoisonTaskQuarantine(t *testing.T) {
+	t.Parallel()
+
+	b := &deadLetterBroker{Broker: broker.New().(*broker.Broker)}
+	cnf := &config.Config{DefaultQueue: "machinery_tasks", DeadLetterQueue: "dead_letters", MaxDeliveries: 2}
+	server := machinery.NewServer(cnf, b, memorybackend.New(cnf), lock.New())
+
+	var calls int32
+	assert.NoError(t, server.RegisterTask("flaky", func() error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("try again")
+		}
+		return nil
+	}))
+	b.AssignWorker(server.NewWorker("test_worker", 1))
+
+	// Retries of a task which finishes its attempts are not counted
+	asyncResult, err := server.SendTask(&tasks.Signature{Name: "flaky", RetryCount: 3})
+	assert.NoError(t, err)
+	state, err := server.GetBackend().GetState(asyncResult.Signature.UUID)
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateSuccess, state.State)
+	}
+	assert.Empty(t, b.deadLetters)
+
+	// The task crashed the workers it has been delivered to twice
+	for i := 0; i < 2; i++ {
+		_, err := backends.CountDelivery(server.GetBackend(), "crashing_task")
+		assert.NoError(t, err)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	_, err = server.SendTask(&tasks.Signature{Name: "flaky", UUID: "crashing_task"})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	state, err = server.GetBackend().GetState("crashing_task")
+	if assert.NoError(t, err) {
+		assert.Equal(t, tasks.StateFailure, state.State)
+		assert.Equal(t, "Task crashing_task has been delivered 3 times without finishing", state.Error)
+	}
+	if assert.Len(t, b.deadLetters, 1) {
+		assert.Equal(t, tasks.DeadLetterReasonPoison, b.deadLetters[0].Headers[tasks.DeadLetterReasonHeader])
+	}
+}
+
+func TestRetryHandler(t *testing.T) {
+	t.Parallel()
+
+	cnf := &config.Config{DefaultQueue: "machinery_tasks"}
+	b := broker.New().(*broker.Broker)
+	server := machinery.NewServer(cnf, b, memorybackend.New(cnf), lock.New())
+
+	var calls int32
+	assert.NoError(t, server.RegisterTask("flaky", func() error {
+		if n := atomic.AddInt32(&calls, 1); n < 3 {
+			return fmt.Errorf("attempt %d failed", n)
+		}
+		return nil
+	}))
+
+	type retried struct {
+		attempt int
+		err     string
+	}
+	var retries []retried
+	worker := server.NewWorker("test_worker", 1)
+	worker.SetRetryHandler(func(signature *tasks.Signature, attempt int, err error, eta time.Time) {
+		assert.Equal(t, "flaky", signature.Name)
+		assert.True(t, eta.After(time.Now()))
+		retries = append(retries, retried{attempt: attempt, err: err.Error()})
+	})
+	b.AssignWorker(worker)
+
+	_, err := server.SendTask(&tasks.Signature{Name: "flaky", RetryCount: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, []retried{
+		{attempt: 1, err: "attempt 1 failed"},
+		{attempt: 2, err: "attempt 2 failed"},
+	}, retries)
+}